@@ -0,0 +1,164 @@
+// Package abiutil encodes and decodes contract calls by their Solidity signatures, such as
+// "transfer(address,uint256)". It wraps go-ethereum's abi package, and accepts the *uint256.Int, [32]byte
+// and integer values used in moeingevm where go-ethereum requires *big.Int. Tuples are not supported.
+package abiutil
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+// Returns the first 4 bytes of the keccak256 hash of a canonical signature
+func Selector(signature string) [4]byte {
+	var sel [4]byte
+	copy(sel[:], crypto.Keccak256([]byte(signature)))
+	return sel
+}
+
+// Split a signature into the function name and the argument types
+func ParseSignature(signature string) (name string, argTypes []string, err error) {
+	open := strings.IndexByte(signature, '(')
+	if open <= 0 || !strings.HasSuffix(signature, ")") {
+		return "", nil, fmt.Errorf("invalid signature %q", signature)
+	}
+	name = signature[:open]
+	inner := signature[open+1 : len(signature)-1]
+	if strings.ContainsAny(inner, "() ") {
+		return "", nil, fmt.Errorf("unsupported signature %q", signature)
+	}
+	if len(inner) != 0 {
+		argTypes = strings.Split(inner, ",")
+	}
+	return name, argTypes, nil
+}
+
+func newArguments(argTypes []string) (abi.Arguments, error) {
+	args := make(abi.Arguments, len(argTypes))
+	for i, s := range argTypes {
+		t, err := abi.NewType(s, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = abi.Argument{Type: t}
+	}
+	return args, nil
+}
+
+// Returns the call data of a function with the selector of signature and the encoded args
+func Pack(signature string, args ...interface{}) ([]byte, error) {
+	_, argTypes, err := ParseSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	packed, err := Encode(argTypes, args...)
+	if err != nil {
+		return nil, err
+	}
+	sel := Selector(signature)
+	return append(sel[:], packed...), nil
+}
+
+// Returns the ABI encoding of args, whose types are argTypes
+func Encode(argTypes []string, args ...interface{}) ([]byte, error) {
+	arguments, err := newArguments(argTypes)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != len(arguments) {
+		return nil, fmt.Errorf("%d arguments for %d types", len(args), len(arguments))
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = toABIValue(arguments[i].Type, arg)
+	}
+	return arguments.Pack(values...)
+}
+
+// Decode data of the types argTypes. The unsigned integers wider than 64 bits are returned as
+// *uint256.Int, and the other values are returned as go-ethereum's abi does.
+func Decode(argTypes []string, data []byte) ([]interface{}, error) {
+	arguments, err := newArguments(argTypes)
+	if err != nil {
+		return nil, err
+	}
+	values, err := arguments.UnpackValues(data)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		if b, ok := v.(*big.Int); ok && arguments[i].Type.T == abi.UintTy {
+			values[i], _ = uint256.FromBig(b)
+		}
+	}
+	return values, nil
+}
+
+// Decode the arguments of call data packed with signature, after checking its selector
+func Unpack(signature string, data []byte) ([]interface{}, error) {
+	_, argTypes, err := ParseSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	sel := Selector(signature)
+	if len(data) < 4 || string(data[:4]) != string(sel[:]) {
+		return nil, fmt.Errorf("call data does not match %q", signature)
+	}
+	return Decode(argTypes, data[4:])
+}
+
+// Convert the values of moeingevm to the ones accepted by go-ethereum's abi for t
+func toABIValue(t abi.Type, v interface{}) interface{} {
+	if t.T != abi.UintTy && t.T != abi.IntTy {
+		return v
+	}
+	var b *big.Int
+	switch x := v.(type) {
+	case *uint256.Int:
+		b = x.ToBig()
+	case uint256.Int:
+		b = x.ToBig()
+	case [32]byte:
+		b = new(big.Int).SetBytes(x[:])
+	case int:
+		b = big.NewInt(int64(x))
+	case int64:
+		b = big.NewInt(x)
+	case uint64:
+		b = new(big.Int).SetUint64(x)
+	default:
+		return v
+	}
+	if t.Size > 64 {
+		return b
+	}
+	// go-ethereum requires the Go integer type of the same size for the narrow integers
+	if t.T == abi.UintTy {
+		switch t.Size {
+		case 8:
+			return uint8(b.Uint64())
+		case 16:
+			return uint16(b.Uint64())
+		case 32:
+			return uint32(b.Uint64())
+		case 64:
+			return b.Uint64()
+		}
+	} else {
+		switch t.Size {
+		case 8:
+			return int8(b.Int64())
+		case 16:
+			return int16(b.Int64())
+		case 32:
+			return int32(b.Int64())
+		case 64:
+			return b.Int64()
+		}
+	}
+	return b
+}
@@ -0,0 +1,55 @@
+package abiutil
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelector(t *testing.T) {
+	sel := Selector("transfer(address,uint256)")
+	require.Equal(t, "a9059cbb", hex.EncodeToString(sel[:]))
+}
+
+func TestParseSignature(t *testing.T) {
+	name, argTypes, err := ParseSignature("transfer(address,uint256)")
+	require.NoError(t, err)
+	require.Equal(t, "transfer", name)
+	require.Equal(t, []string{"address", "uint256"}, argTypes)
+	_, argTypes, err = ParseSignature("totalSupply()")
+	require.NoError(t, err)
+	require.Equal(t, 0, len(argTypes))
+	for _, sig := range []string{"", "foo", "(uint256)", "foo(uint256", "foo((uint256,address))", "foo(uint256, address)"} {
+		_, _, err = ParseSignature(sig)
+		require.Error(t, err, sig)
+	}
+}
+
+func TestPackUnpack(t *testing.T) {
+	to := common.HexToAddress("0x1234")
+	var word [32]byte
+	word[31] = 7
+	data, err := Pack("f(address,uint256,bytes32,uint64,int256,uint256)", to, uint256.NewInt(100), word, 9, big.NewInt(-1), word)
+	require.NoError(t, err)
+	require.Equal(t, 4+6*32, len(data))
+
+	values, err := Unpack("f(address,uint256,bytes32,uint64,int256,uint256)", data)
+	require.NoError(t, err)
+	require.Equal(t, to, values[0])
+	require.Equal(t, uint256.NewInt(100), values[1])
+	require.Equal(t, word, values[2])
+	require.Equal(t, uint64(9), values[3])
+	require.Equal(t, big.NewInt(-1), values[4])
+	require.Equal(t, uint256.NewInt(7), values[5])
+
+	_, err = Unpack("g(address,uint256,bytes32,uint64,int256,uint256)", data)
+	require.Error(t, err)
+	_, err = Pack("f(address,uint256)", to)
+	require.Error(t, err)
+	_, err = Encode([]string{"foo"}, 1)
+	require.Error(t, err)
+}
@@ -0,0 +1,98 @@
+// Command migrate exports the receipts, the standby queue and the engine metadata of a stopped node into a
+// file, and imports them on a new node. Without -ads, the standby queue and the engine metadata are skipped,
+// which is for the new node getting the world state by state sync:
+//
+//	migrate export -modb <dir> [-ads <dir>] -from <height> -to <height> -file <file>
+//	migrate import -modb <dir> [-ads <dir>] -file <file>
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/smartbch/moeingads"
+	"github.com/smartbch/moeingads/store"
+	"github.com/smartbch/moeingdb/modb"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/migration"
+)
+
+var (
+	GuardStart = []byte{0, 0, 0, 0, 0, 0, 0, 0}
+	GuardEnd   = []byte{255, 255, 255, 255, 255, 255, 255, 255, 255}
+)
+
+func main() {
+	if len(os.Args) < 2 || (os.Args[1] != "export" && os.Args[1] != "import") {
+		fail("usage: migrate export|import [flags]")
+	}
+	cmd := os.Args[1]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	modbDir := fs.String("modb", "", "the directory of MoDB")
+	adsDir := fs.String("ads", "", "the directory of MoeingADS, empty to skip the engine state")
+	file := fs.String("file", "", "the migration file")
+	from := fs.Int64("from", 1, "the first height to export")
+	to := fs.Int64("to", -1, "the last height to export, negative means the latest one")
+	_ = fs.Parse(os.Args[2:])
+	if *modbDir == "" || *file == "" {
+		fail("-modb and -file are required")
+	}
+
+	db := modb.NewMoDB(*modbDir, log.NewNopLogger())
+	node := migration.Node{Db: db}
+	defer db.Close()
+	var trunk *store.TrunkStore
+	if *adsDir != "" {
+		mads, err := moeingads.NewMoeingADS(*adsDir, false, [][]byte{GuardStart, GuardEnd})
+		if err != nil {
+			fail("cannot open MoeingADS: %v", err)
+		}
+		root := store.NewRootStore(mads, nil)
+		root.SetHeight(mads.GetCurrHeight())
+		defer root.Close()
+		trunk = root.GetTrunkStore(1000).(*store.TrunkStore)
+		node.Trunk = trunk
+	}
+
+	var stats migration.Stats
+	if cmd == "export" {
+		if *to < 0 {
+			*to = db.GetLatestHeight()
+		}
+		f, err := os.Create(*file)
+		if err != nil {
+			fail("cannot create %s: %v", *file, err)
+		}
+		stats, err = migration.Export(f, node, *from, *to)
+		if err == nil {
+			err = f.Close()
+		}
+		if trunk != nil {
+			trunk.Close(false)
+		}
+		if err != nil {
+			fail("cannot export: %v", err)
+		}
+	} else {
+		f, err := os.Open(*file)
+		if err != nil {
+			fail("cannot open %s: %v", *file, err)
+		}
+		stats, err = migration.Import(f, node)
+		f.Close()
+		if trunk != nil {
+			trunk.Close(err == nil)
+		}
+		if err != nil {
+			fail("cannot import: %v", err)
+		}
+	}
+	fmt.Printf("%sed %d state entries and %d blocks\n", cmd, stats.StateEntries, stats.Blocks)
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,198 @@
+// Command soak keeps sending random transfers to a testutil.Chain and checks the invariants of the engine every
+// few blocks. It exits with 1 when an invariant is violated.
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+
+	"github.com/smartbch/moeingevm/ebp"
+	"github.com/smartbch/moeingevm/testutil"
+	"github.com/smartbch/moeingevm/types"
+)
+
+const initBalance = 1e18
+
+var (
+	blocks     = flag.Int64("blocks", 0, "the number of blocks to run, zero means forever")
+	checkEvery = flag.Int64("check", 10, "check the invariants every this many blocks")
+	numAcc     = flag.Int("accounts", 50, "the number of accounts sending and receiving TXs")
+	txsPerBlk  = flag.Int("txs", 200, "the max number of TXs sent in a block")
+	seed       = flag.Int64("seed", 0, "the seed of the load, zero means the current time")
+)
+
+type soak struct {
+	chain *testutil.Chain
+	rand  *rand.Rand
+	keys  []*ecdsa.PrivateKey
+	addrs []common.Address
+
+	tips      uint256.Int // the gas fees kept in the system account
+	ignored   uint256.Int // the prepaid gas fees of the TXs ignored for being too old, which are not refunded
+	burnt     uint256.Int
+	lastNonce map[common.Address]uint64
+	txCount   int
+}
+
+func main() {
+	flag.Parse()
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	fmt.Printf("seed %d\n", *seed)
+	s := newSoak(*seed, *numAcc)
+	for n := int64(1); *blocks == 0 || n <= *blocks; n++ {
+		s.runBlock()
+		if n%*checkEvery != 0 {
+			continue
+		}
+		if err := s.check(); err != nil {
+			fmt.Fprintf(os.Stderr, "invariant violated at height %d: %v\n", s.chain.Height(), err)
+			os.Exit(1)
+		}
+		fmt.Printf("height %d, %d TXs committed, standby queue %d\n", s.chain.Height(), s.txCount, s.chain.Engine.StandbyQLen())
+	}
+}
+
+func newSoak(seed int64, n int) *soak {
+	s := &soak{
+		chain:     testutil.NewChain(),
+		rand:      rand.New(rand.NewSource(seed)),
+		lastNonce: make(map[common.Address]uint64, n),
+	}
+	// halts in Execute if the supply is not conserved in a block, the knob is not in TxExecutor
+	s.chain.Engine.(interface{ SetSupplyCheck(b bool) }).SetSupplyCheck(true)
+	for i := 0; i < n; i++ {
+		key, addr := testutil.NewKey()
+		s.chain.Fund(addr, uint256.NewInt(initBalance))
+		s.keys = append(s.keys, key)
+		s.addrs = append(s.addrs, addr)
+	}
+	return s
+}
+
+// Send random transfers and produce a block. Some of them fail because the value is more than the balance.
+func (s *soak) runBlock() {
+	for i := s.rand.Intn(*txsPerBlk + 1); i > 0; i-- {
+		from := s.rand.Intn(len(s.keys))
+		to := s.addrs[s.rand.Intn(len(s.addrs))]
+		value := big.NewInt(s.rand.Int63n(initBalance / 1000))
+		if s.rand.Intn(50) == 0 {
+			value.SetUint64(2 * initBalance)
+		}
+		gasLimit := []uint64{21000, 30000, 100000}[s.rand.Intn(3)]
+		tx := s.chain.SignTx(s.keys[from], &to, value, gasLimit, nil)
+		if err := s.chain.SendTx(tx); err != nil {
+			fail("cannot send tx: %v", err)
+		}
+	}
+	txs := s.chain.AdvanceBlock()
+	s.txCount += len(txs)
+	for _, tx := range txs {
+		if tx.StatusStr == ebp.StatusToStr(types.IGNORE_TOO_OLD_TX) {
+			fee := uint256.NewInt(tx.Gas)
+			s.ignored.Add(&s.ignored, fee.Mul(fee, gasPrice(tx.GasPrice)))
+		}
+	}
+	// pay the refunds from the system account, as a node does at the block boundaries
+	_, feeRefund, gasFee := s.chain.Engine.GasUsedInfo()
+	ctx := s.chain.Context()
+	if err := ebp.SubSystemAccBalance(ctx, &feeRefund); err != nil {
+		fail("cannot pay the refund: %v", err)
+	}
+	ctx.Close(true)
+	s.tips.Add(&s.tips, &gasFee)
+	burnt := s.chain.Engine.BlockResults().BurntFee
+	s.burnt.Add(&s.burnt, &burnt)
+}
+
+func (s *soak) check() error {
+	ctx := s.chain.Context()
+	defer ctx.Close(false)
+	queuedFee, err := checkStandbyQueue(ctx, s.chain.Engine.StandbyQLen())
+	if err != nil {
+		return err
+	}
+
+	// the engine mints nothing, and the fees are moved into the system and blackhole accounts
+	system := ebp.GetSystemBalance(ctx)
+	blackHole := ebp.GetBlackHoleBalance(ctx)
+	total := new(uint256.Int).Add(system, blackHole)
+	for _, addr := range s.addrs {
+		acc := ctx.GetAccount(addr)
+		total.Add(total, acc.Balance())
+		if nonce := acc.Nonce(); nonce < s.lastNonce[addr] {
+			return fmt.Errorf("nonce of %s decreased from %d to %d", addr, s.lastNonce[addr], nonce)
+		} else {
+			s.lastNonce[addr] = nonce
+		}
+	}
+	supply := new(uint256.Int).Mul(uint256.NewInt(initBalance), uint256.NewInt(uint64(len(s.addrs))))
+	if !total.Eq(supply) {
+		return fmt.Errorf("total supply is %s, expected %s", total, supply)
+	}
+
+	// the system account keeps the tips of the executed TXs, and the gas fees of the ignored and queued TXs
+	pending := new(uint256.Int).Add(&s.tips, queuedFee)
+	pending.Add(pending, &s.ignored)
+	if !system.Eq(pending) {
+		return fmt.Errorf("system account has %s, while the pending fees are %s", system, pending)
+	}
+	if !blackHole.Eq(&s.burnt) {
+		return fmt.Errorf("blackhole account has %s, while %s is burnt", blackHole, &s.burnt)
+	}
+	return nil
+}
+
+// Check the pointers and the entries of standby queue, and return the gas fees prepaid by the queued TXs
+func checkStandbyQueue(ctx *types.Context, qLen int) (*uint256.Int, error) {
+	store := ctx.Rbt.GetBaseStore()
+	var start, end uint64
+	if bz := store.Get(types.StandbyTxQueueKey[:]); bz != nil {
+		if len(bz) != 16 {
+			return nil, fmt.Errorf("the range of standby queue has %d bytes", len(bz))
+		}
+		start, end = binary.BigEndian.Uint64(bz[:8]), binary.BigEndian.Uint64(bz[8:])
+	}
+	if start > end || end-start != uint64(qLen) {
+		return nil, fmt.Errorf("standby queue is [%d, %d), while its length is %d", start, end, qLen)
+	}
+	if bz := store.Get(types.GetStandbyTxKey(start - 1)); start != 0 && bz != nil {
+		return nil, fmt.Errorf("the entry %d before standby queue is not deleted", start-1)
+	}
+	fee := uint256.NewInt(0)
+	for i := start; i < end; i++ {
+		bz := store.Get(types.GetStandbyTxKey(i))
+		if bz == nil {
+			return nil, fmt.Errorf("the entry %d of standby queue is missing", i)
+		}
+		var tx types.TxToRun
+		tx.FromBytes(bz)
+		price := gasPrice(tx.GasPrice)
+		fee.Add(fee, price.Mul(price, uint256.NewInt(tx.Gas)))
+	}
+	return fee, nil
+}
+
+// The gas price charged by the engine
+func gasPrice(price [32]byte) *uint256.Int {
+	p := uint256.NewInt(0).SetBytes32(price[:])
+	if p.GtUint64(ebp.MaxGasPrice) {
+		p.SetUint64(ebp.MaxGasPrice)
+	}
+	return p
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
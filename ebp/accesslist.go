@@ -0,0 +1,147 @@
+package ebp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// Predict the short keys a TX touches from its sender, recipient and access list, before it is run. All the
+// keys are taken as written, because the list does not tell reads from writes. A TX can touch keys not in its
+// list, so the prediction only reduces the conflicts, and the conflicts missed are still found after running.
+func predictRWList(ctx *types.Context, tx *types.TxToRun) rwList {
+	rwl := newRWList()
+	addKey := func(key []byte) {
+		path, _ := ctx.Rbt.GetShortKeyPath(key)
+		for _, k := range path {
+			rwl.add(binary.LittleEndian.Uint64(k[:]), true)
+		}
+	}
+	for _, addr := range []common.Address{tx.From, tx.To} {
+		if addr != (common.Address{}) {
+			addKey(types.GetAccountKey(addr))
+		}
+	}
+	for _, tuple := range tx.AccessList {
+		addKey(types.GetAccountKey(tuple.Address))
+		acc := ctx.GetAccount(tuple.Address)
+		if acc == nil { // a non-existent account has no storage
+			continue
+		}
+		for _, key := range tuple.StorageKeys {
+			addKey(types.GetValueKey(acc.Sequence(), string(key[:])))
+		}
+	}
+	sortUint64s(rwl.wList)
+	return rwl
+}
+
+// AccessListResult is the result of CreateAccessList, which is the same as the one of eth_createAccessList
+type AccessListResult struct {
+	AccessList gethtypes.AccessList `json:"accessList"`
+	GasUsed    hexutil.Uint64       `json:"gasUsed"` // with the gas of AccessList
+	Error      string               `json:"error,omitempty"`
+}
+
+// a call touching new keys with its list must touch them without the list, so the list is soon stable
+const maxAccessListRuns = 8
+
+// CreateAccessList runs msg as ExecuteReadOnly does, with the access list touched by the former run, until the
+// list is stable. As in geth, the sender, the recipient, the created contract and the precompiled contracts are
+// not in the list, and the first run uses the list of msg. The accounts which do not exist are not recorded.
+func CreateAccessList(ctx *types.Context, msg ethereum.CallMsg, currBlock *types.BlockInfo) *AccessListResult {
+	list := sortedAccessList(msg.AccessList)
+	for i := 1; ; i++ {
+		msg.AccessList = list
+		runner := NewTxRunner(ctx.WithRbtCopy(), callMsgToTx(&msg, currBlock))
+		runner.recordRWList = true
+		RunTxForRpc(currBlock, false, runner)
+		runner.Ctx.Close(false)
+		touched := touchedAccessList(runner)
+		if reflect.DeepEqual(touched, list) || i == maxAccessListRuns {
+			res := &AccessListResult{AccessList: touched, GasUsed: hexutil.Uint64(runner.GasUsed)}
+			if err := runner.Err(); err != nil {
+				res.Error = err.Error()
+			}
+			return res
+		}
+		list = touched
+	}
+}
+
+// Returns the accounts and storage slots in the read/write lists of runner, sorted by addresses and keys
+func touchedAccessList(runner *TxRunner) gethtypes.AccessList {
+	slots := make(map[common.Address]map[common.Hash]struct{})
+	addAccount := func(addr common.Address) {
+		if _, ok := slots[addr]; !ok {
+			slots[addr] = make(map[common.Hash]struct{})
+		}
+	}
+	seq2addr := make(map[uint64]common.Address)
+	for _, ops := range [][]types.AccountRWOp{runner.RwLists.AccountRList, runner.RwLists.AccountWList} {
+		for _, op := range ops {
+			addAccount(op.Addr)
+			if len(op.Account) != 0 {
+				seq2addr[types.NewAccountInfo(op.Account).Sequence()] = op.Addr
+			}
+		}
+	}
+	for _, op := range runner.RwLists.BytecodeRList {
+		addAccount(op.Addr)
+	}
+	for _, ops := range [][]types.StorageRWOp{runner.RwLists.StorageRList, runner.RwLists.StorageWList} {
+		for _, op := range ops {
+			if addr, ok := seq2addr[op.Seq]; ok {
+				slots[addr][common.BytesToHash([]byte(op.Key))] = struct{}{}
+			}
+		}
+	}
+	for _, addr := range []common.Address{runner.Tx.From, runner.Tx.To, runner.CreatedContractAddress} {
+		delete(slots, addr)
+	}
+	list := make(gethtypes.AccessList, 0, len(slots))
+	for addr, keys := range slots {
+		if isPrecompiled(addr) {
+			continue
+		}
+		tuple := gethtypes.AccessTuple{Address: addr, StorageKeys: make([]common.Hash, 0, len(keys))}
+		for key := range keys {
+			tuple.StorageKeys = append(tuple.StorageKeys, key)
+		}
+		list = append(list, tuple)
+	}
+	return sortedAccessList(list)
+}
+
+// Returns a copy of list sorted by addresses and keys
+func sortedAccessList(list gethtypes.AccessList) gethtypes.AccessList {
+	res := make(gethtypes.AccessList, len(list))
+	for i, tuple := range list {
+		res[i] = gethtypes.AccessTuple{Address: tuple.Address, StorageKeys: append([]common.Hash{}, tuple.StorageKeys...)}
+		keys := res[i].StorageKeys
+		sort.Slice(keys, func(a, b int) bool { return bytes.Compare(keys[a][:], keys[b][:]) < 0 })
+	}
+	sort.Slice(res, func(a, b int) bool { return bytes.Compare(res[a].Address[:], res[b].Address[:]) < 0 })
+	return res
+}
+
+// The same as is_precompiled in host_context.cpp, without the forks of SEP109 and the precompiles
+// enabled by ChainConfig
+func isPrecompiled(addr common.Address) bool {
+	for _, b := range addr[:12] {
+		if b != 0 {
+			return false
+		}
+	}
+	id := binary.BigEndian.Uint64(addr[12:])
+	return (1 <= id && id <= 0x12) || (0x2710 <= id && id <= 0x2713) || (0x2715 <= id && id <= 0x2716) || id == 0x2718 ||
+		(NATIVE_MODULE_ID_START <= id && id <= NATIVE_MODULE_ID_END)
+}
@@ -0,0 +1,217 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+var contract1 = common.HexToAddress("0x30")
+
+func newAccessListTx(e *txEngine, from common.Address, nonce, gas uint64, list gethtypes.AccessList) *gethtypes.Transaction {
+	tx, _ := gethtypes.NewTx(&gethtypes.AccessListTx{
+		Nonce:      nonce,
+		To:         &to1,
+		Value:      big.NewInt(100),
+		Gas:        gas,
+		GasPrice:   big.NewInt(1),
+		AccessList: list,
+	}).WithSignature(e.signer, from.Bytes())
+	return tx
+}
+
+func TestPredictRWList(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	ctx.SetAccount(contract1, types.ZeroAccountInfo())
+	slot := common.Hash{1}
+	tx1 := &types.TxToRun{}
+	tx1.From, tx1.To = from1, to1
+	tx2 := &types.TxToRun{}
+	tx2.From, tx2.To = from2, to2
+	touchedSet := make(map[uint64]struct{})
+	predictRWList(ctx, tx1).updateTouchedSet(touchedSet)
+	require.False(t, predictRWList(ctx, tx2).conflictsWith(touchedSet))
+
+	tx2.AccessList = gethtypes.AccessList{{Address: contract1, StorageKeys: []common.Hash{slot}}}
+	rwl := predictRWList(ctx, tx2)
+	require.Equal(t, 4, len(rwl.wList)) // from2, to2, contract1 and its slot
+	require.False(t, rwl.conflictsWith(touchedSet))
+	tx2.AccessList = gethtypes.AccessList{{Address: to1}}
+	require.True(t, predictRWList(ctx, tx2).conflictsWith(touchedSet))
+	ctx.Close(false)
+}
+
+func TestAccessListAffinity(t *testing.T) {
+	e := &txEngine{accountAffinity: true}
+	txBundle := make([]types.TxToRun, 3)
+	txBundle[0].From, txBundle[0].To = from1, to1
+	txBundle[1].From, txBundle[1].To = from2, to2
+	txBundle[2].From, txBundle[2].To = from3, contract1
+	require.Equal(t, [][]int{{0}, {1}, {2}}, e.groupTxBundle(txBundle))
+	txBundle[2].AccessList = gethtypes.AccessList{{Address: to1}}
+	require.Equal(t, [][]int{{0, 2}, {1}}, e.groupTxBundle(txBundle))
+}
+
+func TestAccessListTx(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	acc := types.ZeroAccountInfo()
+	acc.UpdateBalance(uint256.NewInt(1e18))
+	e.cleanCtx.SetAccount(from1, acc)
+	e.cleanCtx.SetAccount(from2, acc)
+	e.cleanCtx.Close(true)
+
+	list := gethtypes.AccessList{{Address: contract1, StorageKeys: []common.Hash{{1}, {2}}}}
+	listGas := uint64(2400 + 2*1900)
+	berlinCtx := func() *types.Context {
+		ctx := prepareCtx(trunk)
+		ctx.SetChainConfig(&types.ChainConfig{Upgrades: []types.Upgrade{
+			{Height: 1, Rules: types.Rules{Revision: types.Berlin, RefundQuotient: 5}}}})
+		return ctx
+	}
+	e.SetAccessLists(true)
+	e.SetContext(berlinCtx())
+	e.CollectTx(newAccessListTx(e, from1, 0, 100000, list))
+	e.CollectTx(newAccessListTx(e, from2, 0, listGas, list)) // cannot pay the list
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(berlinCtx())
+	e.Execute(&types.BlockInfo{Number: 1})
+	require.Equal(t, 2, len(e.committedTxs))
+	for _, tx := range e.committedTxs {
+		if tx.From == from1 {
+			require.Equal(t, "success", tx.StatusStr)
+			require.Equal(t, 21000+listGas, tx.GasUsed)
+		} else {
+			require.Equal(t, "out-of-gas", tx.StatusStr)
+			require.Equal(t, listGas, tx.GasUsed)
+		}
+	}
+
+	// the lists are dropped when they are not enabled
+	e.SetAccessLists(false)
+	e.SetContext(prepareCtx(trunk))
+	e.CollectTx(newAccessListTx(e, from1, 1, 100000, list))
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 2})
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, uint64(21000), e.committedTxs[0].GasUsed)
+
+	// the lists are not charged before Berlin
+	e.SetAccessLists(true)
+	e.SetContext(prepareCtx(trunk))
+	e.CollectTx(newAccessListTx(e, from1, 2, 100000, list))
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 3})
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, uint64(21000), e.committedTxs[0].GasUsed)
+}
+
+func TestTouchedAccessList(t *testing.T) {
+	acc := types.ZeroAccountInfo()
+	acc.UpdateSequence(7)
+	slot1, slot2 := common.Hash{1}, common.Hash{2}
+	runner := &TxRunner{
+		Tx: &types.TxToRun{BasicTx: types.BasicTx{From: from1, To: to1}},
+		RwLists: &types.ReadWriteLists{
+			AccountRList: []types.AccountRWOp{
+				{Addr: from1, Account: types.ZeroAccountInfo().Bytes()},
+				{Addr: to1, Account: types.ZeroAccountInfo().Bytes()},
+				{Addr: contract1, Account: acc.Bytes()},
+				{Addr: common.BytesToAddress([]byte{4})}, // a precompiled contract
+			},
+			BytecodeRList: []types.BytecodeRWOp{{Addr: to2}},
+			StorageRList:  []types.StorageRWOp{{Seq: 7, Key: string(slot2[:])}},
+			StorageWList:  []types.StorageRWOp{{Seq: 7, Key: string(slot1[:])}, {Seq: 7, Key: string(slot2[:])}},
+		},
+	}
+	list := touchedAccessList(runner)
+	require.Equal(t, gethtypes.AccessList{
+		{Address: to2, StorageKeys: []common.Hash{}},
+		{Address: contract1, StorageKeys: []common.Hash{slot1, slot2}},
+	}, list)
+}
+
+func TestCreateAccessList(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	blk := &types.BlockInfo{Number: 1}
+	identity := common.BytesToAddress([]byte{4})
+	res := CreateAccessList(ctx, ethereum.CallMsg{From: from1, To: &identity, Data: []byte("call"),
+		AccessList: gethtypes.AccessList{{Address: contract1}}}, blk)
+	require.Empty(t, res.AccessList) // the unused tuple is dropped
+	require.Empty(t, res.Error)
+	require.Equal(t, ExecuteReadOnly(ctx, ethereum.CallMsg{From: from1, To: &identity, Data: []byte("call")}, blk).GasUsed,
+		uint64(res.GasUsed))
+}
+
+func TestAccessedSet(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	blk := &types.BlockInfo{Number: 1}
+	gasUsed := func(revision types.Revision, code hexutil.Bytes) uint64 {
+		ctx.SetChainConfig(&types.ChainConfig{Upgrades: []types.Upgrade{
+			{Height: 1, Rules: types.Rules{Revision: revision, RefundQuotient: 5}}}})
+		res, err := ExecuteReadOnlyWithOverrides(ctx, ethereum.CallMsg{From: from1, To: &contract1}, blk,
+			StateOverride{contract1: {Code: &code}}, nil)
+		require.NoError(t, err)
+		require.False(t, res.Failed())
+		return res.GasUsed
+	}
+	sload := hexutil.Bytes{0x60, 0x01, 0x54, 0x50} // PUSH1 1 SLOAD POP
+	once := append(append(hexutil.Bytes{}, sload...), 0x00)
+	twice := append(append(append(hexutil.Bytes{}, sload...), sload...), 0x00)
+	require.Equal(t, uint64(3+800+2), gasUsed(types.Istanbul, twice)-gasUsed(types.Istanbul, once))
+	require.Equal(t, uint64(3+100+2), gasUsed(types.Berlin, twice)-gasUsed(types.Berlin, once)) // warm
+
+	// the slot in the access list is warm, while the list is charged
+	code := once
+	res, err := ExecuteReadOnlyWithOverrides(ctx, ethereum.CallMsg{From: from1, To: &contract1,
+		AccessList: gethtypes.AccessList{{Address: contract1, StorageKeys: []common.Hash{{31: 1}}}}}, blk,
+		StateOverride{contract1: {Code: &code}}, nil)
+	require.NoError(t, err)
+	require.Equal(t, gasUsed(types.Berlin, once)-(2100-100)+2400+1900, res.GasUsed)
+
+	// PUSH1 addr BALANCE POP STOP: the precompiled contracts are warm
+	balanceOf := func(addr byte) hexutil.Bytes { return hexutil.Bytes{0x60, addr, 0x31, 0x50, 0x00} }
+	require.Equal(t, uint64(2600-100), gasUsed(types.Berlin, balanceOf(0x99))-gasUsed(types.Berlin, balanceOf(0x04)))
+
+	// calls the child twice, whose accessed slot is cold again after it reverts
+	child := common.HexToAddress("0x31")
+	callChild := append(hexutil.Bytes{0x60, 0x00, 0x60, 0x00, 0x60, 0x00, 0x60, 0x00, 0x60, 0x00, 0x73}, child[:]...)
+	callChild = append(callChild, 0x5a, 0xf1, 0x50) // GAS CALL POP
+	parent := append(append(append(hexutil.Bytes{}, callChild...), callChild...), 0x00)
+	childGasUsed := func(childCode hexutil.Bytes) uint64 {
+		ctx.SetChainConfig(&types.ChainConfig{Upgrades: []types.Upgrade{
+			{Height: 1, Rules: types.Rules{Revision: types.Berlin, RefundQuotient: 5}}}})
+		res, err := ExecuteReadOnlyWithOverrides(ctx, ethereum.CallMsg{From: from1, To: &contract1}, blk,
+			StateOverride{contract1: {Code: &parent}, child: {Code: &childCode}}, nil)
+		require.NoError(t, err)
+		require.False(t, res.Failed())
+		return res.GasUsed
+	}
+	reverting := append(append(hexutil.Bytes{}, sload...), 0x60, 0x00, 0x60, 0x00, 0xfd) // REVERT(0, 0)
+	stopping := append(append(hexutil.Bytes{}, sload...), 0x00)
+	// (2105+6)*2 versus 2105+105, where 6 is the gas of the PUSH1s before REVERT
+	require.Equal(t, uint64(2*(2105+6)-(2105+105)), childGasUsed(reverting)-childGasUsed(stopping))
+}
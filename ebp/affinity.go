@@ -0,0 +1,74 @@
+package ebp
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// With account affinity, the TXs sharing a sender, a recipient or an address in their access lists are put
+// into one group, and a runner runs the TXs of a group one by one on a shared Context. So they do not
+// conflict with each other, and they are committed (or not) together. Without account affinity, each TX is a group by itself.
+// The groups are ordered by their first TXs, and the TXs in a group keep their order in txBundle, so
+// the grouping only depends on txBundle.
+func (exec *txEngine) groupTxBundle(txBundle []types.TxToRun) [][]int {
+	if !exec.accountAffinity {
+		groups := make([][]int, len(txBundle))
+		for i := range txBundle {
+			groups[i] = []int{i}
+		}
+		return groups
+	}
+	// a disjoint-set forest whose roots are the smallest indexes of the trees
+	parent := make([]int, len(txBundle))
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	owner := make(map[common.Address]int, 2*len(txBundle))
+	for i := range txBundle {
+		parent[i] = i
+		for _, addr := range affinityAddrs(&txBundle[i]) {
+			if addr == (common.Address{}) { // contract creation
+				continue
+			}
+			j, ok := owner[addr]
+			if !ok {
+				owner[addr] = i
+				continue
+			}
+			ri, rj := find(i), find(j)
+			if ri < rj {
+				parent[rj] = ri
+			} else if rj < ri {
+				parent[ri] = rj
+			}
+		}
+	}
+	groups := make([][]int, 0, len(txBundle))
+	groupOf := make([]int, len(txBundle))
+	for i := range txBundle {
+		root := find(i)
+		if root == i {
+			groupOf[i] = len(groups)
+			groups = append(groups, []int{i})
+		} else {
+			g := groupOf[root]
+			groups[g] = append(groups[g], i)
+		}
+	}
+	return groups
+}
+
+// The sender, the recipient, and the addresses in the access list
+func affinityAddrs(tx *types.TxToRun) []common.Address {
+	addrs := make([]common.Address, 0, 2+len(tx.AccessList))
+	addrs = append(addrs, tx.From, tx.To)
+	for _, tuple := range tx.AccessList {
+		addrs = append(addrs, tuple.Address)
+	}
+	return addrs
+}
@@ -0,0 +1,90 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+/*
+testcase:
+account1 send txs(nonce): 0, 1, 2 to account1
+account2 send txs(nonce): 0 to account2
+with sender sharding, the TXs of account1 run in three rounds without failures
+*/
+func TestTxEngine_SenderSharding(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareEngine(trunk)
+	e.SetSenderSharding(true)
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	tx3, _ := gethtypes.NewTransaction(1, to1, big.NewInt(103), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	e.CollectTx(tx3)
+	tx4, _ := gethtypes.NewTransaction(2, to1, big.NewInt(104), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	e.CollectTx(tx4)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	startKey, endKey := e.getStandbyQueueRange()
+	txsStandby, ignored := e.loadStandbyTxs(&TxRange{start: startKey, end: endKey})
+	require.Equal(t, 2, len(txsStandby))
+	require.NotEqual(t, txsStandby[0].From, txsStandby[1].From)
+	require.Equal(t, 2, len(ignored))
+
+	e.Execute(&types.BlockInfo{})
+	require.Equal(t, 4, len(e.committedTxs))
+	require.Equal(t, 0, e.requeuedCount)
+	e.SetContext(prepareCtx(trunk))
+	to1 := e.cleanCtx.GetAccount(*txs[0].To())
+	require.Equal(t, uint64(100+103+104), to1.Balance().Uint64())
+	e.cleanCtx.Close(false)
+}
+
+/*
+testcase:
+account1 send txs(nonce): 0, 1, 2 to account3
+account2 send txs(nonce): 0 to account3
+with account affinity, all of them are committed in one round
+*/
+func TestTxEngine_AccountAffinity(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(1, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetAccountAffinity(true)
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+	e.SetContext(prepareCtx(trunk))
+	for i, from := range []common.Address{from1, from1, from1, from2} {
+		nonce := uint64(i)
+		if from == from2 {
+			nonce = 0
+		}
+		tx, _ := gethtypes.NewTransaction(nonce, from3, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from.Bytes())
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	startKey, endKey := e.getStandbyQueueRange()
+	txsStandby, _ := e.loadStandbyTxs(&TxRange{start: startKey, end: endKey})
+	require.Equal(t, [][]int{{0, 1, 2, 3}}, e.groupTxBundle(txsStandby))
+	e.Execute(&types.BlockInfo{})
+	require.Equal(t, 4, len(e.committedTxs))
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, uint64(10000_0000_0000+400), e.cleanCtx.GetAccount(from3).Balance().Uint64())
+	require.Equal(t, uint64(3), e.cleanCtx.GetAccount(from1).Nonce())
+	require.Equal(t, uint64(1), e.cleanCtx.GetAccount(from2).Nonce())
+	e.cleanCtx.Close(false)
+	e.SetContext(prepareCtx(trunk))
+	startKey, endKey = e.getStandbyQueueRange()
+	require.Equal(t, true, startKey == endKey)
+}
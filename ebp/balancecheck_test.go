@@ -0,0 +1,39 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+/*
+testcase:
+account1 send txs(nonce): 0, 1 to account3, the balance covers the gas fees but not the values of both
+account2 send txs(nonce): 0 to account4
+with strict balance check, the tx with nonce 1 is not inserted into standby queue
+*/
+func TestTxEngine_StrictBalanceCheck(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		trunk, root := prepareTruck()
+		e, txs := prepareEngine(trunk)
+		e.SetStrictBalanceCheck(strict)
+		for _, tx := range txs {
+			e.CollectTx(tx)
+		}
+		// one more than the balance left after the gas fees and the value of tx1
+		value := big.NewInt(10000_0000_0000 - 100 - 2*100000 + 1)
+		tx3, _ := gethtypes.NewTransaction(1, to1, value, 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+		e.CollectTx(tx3)
+		e.Prepare(0, 0, DefaultTxGasLimit)
+		e.SetContext(prepareCtx(trunk))
+		if strict {
+			require.Equal(t, 2, e.StandbyQLen())
+		} else {
+			require.Equal(t, 3, e.StandbyQLen())
+		}
+		e.cleanCtx.Close(false)
+		closeTestCtx(root)
+	}
+}
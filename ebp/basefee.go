@@ -0,0 +1,93 @@
+package ebp
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+	storetypes "github.com/smartbch/moeingads/store/types"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// The gas bookkeeping of the last executed block, which is stored at types.BaseFeeKey as
+// baseFee(32 bytes) + gasUsed(8 bytes) + gasTarget(8 bytes)
+type gasUsage struct {
+	baseFee   uint256.Int
+	gasUsed   uint64
+	gasTarget uint64
+}
+
+func (u *gasUsage) toBytes() []byte {
+	bz := make([]byte, 48)
+	u.baseFee.WriteToSlice(bz[:32])
+	binary.BigEndian.PutUint64(bz[32:40], u.gasUsed)
+	binary.BigEndian.PutUint64(bz[40:48], u.gasTarget)
+	return bz
+}
+
+func (u *gasUsage) fromBytes(bz []byte) {
+	u.baseFee.SetBytes32(bz[:32])
+	u.gasUsed = binary.BigEndian.Uint64(bz[32:40])
+	u.gasTarget = binary.BigEndian.Uint64(bz[40:48])
+}
+
+// The base fee of the next block, following the formula of EIP-1559
+func (u *gasUsage) nextBaseFee() *uint256.Int {
+	next := u.baseFee.Clone()
+	if u.gasUsed == u.gasTarget || u.gasTarget == 0 {
+		return next
+	}
+	var delta uint256.Int
+	if u.gasUsed > u.gasTarget {
+		delta.SetUint64(u.gasUsed - u.gasTarget)
+		delta.Mul(&delta, &u.baseFee)
+		delta.Div(&delta, uint256.NewInt(u.gasTarget))
+		delta.Div(&delta, uint256.NewInt(params.BaseFeeChangeDenominator))
+		if delta.IsZero() {
+			delta.SetOne()
+		}
+		return next.Add(next, &delta)
+	}
+	delta.SetUint64(u.gasTarget - u.gasUsed)
+	delta.Mul(&delta, &u.baseFee)
+	delta.Div(&delta, uint256.NewInt(u.gasTarget))
+	delta.Div(&delta, uint256.NewInt(params.BaseFeeChangeDenominator))
+	return next.Sub(next, &delta)
+}
+
+// Returns the recorded gas usage of the last block, or nil if nothing is recorded
+func (exec *txEngine) loadGasUsage() *gasUsage {
+	ctx := exec.readCtx()
+	defer ctx.Close(false)
+	bz := ctx.Rbt.GetBaseStore().Get(types.BaseFeeKey[:])
+	if len(bz) != 48 {
+		return nil
+	}
+	u := &gasUsage{}
+	u.fromBytes(bz)
+	return u
+}
+
+// Returns the base fee of the next block. Before any block is recorded, it is params.InitialBaseFee.
+func (exec *txEngine) NextBaseFee() *uint256.Int {
+	u := exec.loadGasUsage()
+	if u == nil {
+		return uint256.NewInt(params.InitialBaseFee)
+	}
+	return u.nextBaseFee()
+}
+
+// Record the gas used by the executed block against the gas target, if the target is set
+func (exec *txEngine) recordGasUsage() {
+	if exec.gasTarget == 0 {
+		return
+	}
+	u := &gasUsage{gasUsed: exec.cumulativeGasUsed, gasTarget: exec.gasTarget}
+	u.baseFee = *exec.NextBaseFee() // the base fee of the executed block
+	trunk := exec.cleanCtx.Rbt.GetBaseStore()
+	trunk.PrepareForUpdate(types.BaseFeeKey[:])
+	trunk.Update(func(store storetypes.SetDeleter) {
+		store.Set(types.BaseFeeKey[:], u.toBytes())
+	})
+}
@@ -0,0 +1,38 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestNextBaseFee(t *testing.T) {
+	u := &gasUsage{gasUsed: 15000, gasTarget: 10000}
+	u.baseFee.SetUint64(1000)
+	require.Equal(t, uint64(1062), u.nextBaseFee().Uint64())
+	u.gasUsed = 10000
+	require.Equal(t, uint64(1000), u.nextBaseFee().Uint64())
+	u.gasUsed = 0
+	require.Equal(t, uint64(875), u.nextBaseFee().Uint64())
+	u.baseFee.SetUint64(1)
+	u.gasUsed = 10001
+	require.Equal(t, uint64(2), u.nextBaseFee().Uint64())
+
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareEngine(trunk)
+	e.SetGasTarget(21000)
+	require.Equal(t, uint64(1e9), e.NextBaseFee().Uint64())
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{})
+	require.Equal(t, uint64(1e9+1e9/8), e.NextBaseFee().Uint64())
+	e.Execute(&types.BlockInfo{}) // an empty block
+	require.Equal(t, uint64(1e9+1e9/8-(1e9+1e9/8)/8), e.NextBaseFee().Uint64())
+}
@@ -0,0 +1,333 @@
+package ebp
+
+import (
+	"encoding/binary"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+
+	"github.com/smartbch/moeingevm/abiutil"
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+//#include <stdint.h>
+//#include "../evmwrap/host_bridge/bridge.h"
+import "C"
+
+// The system contract relaying the headers of the BCH mainchain
+var BchHeaderRelayAddress = common.Address([20]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x27, 0x17})
+
+const (
+	SubmitBchHeadersSig = "submitHeaders(uint256,bytes)"
+
+	BchRelayBaseGas      uint64 = 30000
+	BchRelayPerHeaderGas uint64 = 20000
+	// The max count of headers submitted in one tx
+	MaxBchHeadersPerTx = 144
+	// ASERT halves the difficulty for each half-life the blocks are late by
+	BchAsertHalfLife = 2 * 24 * 3600
+	// A header must be later than the median time of so many blocks before it
+	BchMedianTimeSpan = 11
+	// A header cannot be later than the current block by more than so many seconds
+	BchMaxFutureTime = 2 * 3600
+)
+
+var (
+	submitBchHeadersSel = abiutil.Selector(SubmitBchHeadersSig)
+	// BchTipChanged(uint256 indexed height, bytes32 hash)
+	bchTipChangedEvent = common.BytesToHash(crypto.Keccak256([]byte("BchTipChanged(uint256,bytes32)")))
+)
+
+// Returns the hash of a BCH header, in the byte order used in the serialized blocks
+func BchHeaderHash(header []byte) [32]byte {
+	return doubleSha256(header)
+}
+
+// Returns the total work of the BCH mainchain until the block at height, or nil if it is unknown
+func GetBchChainWork(ctx *types.Context, height uint64) *uint256.Int {
+	if GetBchHeader(ctx, height) == nil {
+		return nil
+	}
+	bz := ctx.Rbt.Get(types.GetBchChainWorkKey(height))
+	if len(bz) != 32 {
+		return nil
+	}
+	return uint256.NewInt(0).SetBytes32(bz)
+}
+
+// Decode the compact target in a header, returning nil if it is negative or zero
+func compactToTarget(bits uint32) *big.Int {
+	mantissa := int64(bits & 0x007fffff)
+	if bits&0x00800000 != 0 || mantissa == 0 {
+		return nil
+	}
+	exponent := uint(bits >> 24)
+	target := big.NewInt(mantissa)
+	if exponent <= 3 {
+		return target.Rsh(target, 8*(3-exponent))
+	}
+	return target.Lsh(target, 8*(exponent-3))
+}
+
+// The expected count of hashes for the target, which is 2^256/(target+1)
+func targetToWork(target *big.Int) *uint256.Int {
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	work.Div(work, new(big.Int).Add(target, big.NewInt(1)))
+	res, _ := uint256.FromBig(work)
+	return res
+}
+
+func bchHeaderBits(header []byte) uint32 {
+	return binary.LittleEndian.Uint32(header[72:76])
+}
+
+func bchHeaderTime(header []byte) uint32 {
+	return binary.LittleEndian.Uint32(header[68:72])
+}
+
+// A header stored by its hash, which is on the mainchain or a side branch
+type bchHeaderRecord struct {
+	header []byte
+	height uint64
+	work   *uint256.Int // the total work of the chain until the header
+}
+
+func getBchHeaderRecord(ctx *types.Context, hash [32]byte) *bchHeaderRecord {
+	bz := ctx.Rbt.Get(types.GetBchHeaderByHashKey(hash))
+	if len(bz) != BchHeaderLen+8+32 {
+		return nil
+	}
+	return &bchHeaderRecord{
+		header: bz[:BchHeaderLen],
+		height: binary.BigEndian.Uint64(bz[BchHeaderLen:]),
+		work:   uint256.NewInt(0).SetBytes32(bz[BchHeaderLen+8:]),
+	}
+}
+
+func setBchHeaderRecord(ctx *types.Context, rec *bchHeaderRecord) {
+	bz := make([]byte, BchHeaderLen+8+32)
+	copy(bz, rec.header)
+	binary.BigEndian.PutUint64(bz[BchHeaderLen:], rec.height)
+	work := rec.work.Bytes32()
+	copy(bz[BchHeaderLen+8:], work[:])
+	ctx.Rbt.Set(types.GetBchHeaderByHashKey(BchHeaderHash(rec.header)), bz)
+}
+
+// Returns the median of the times, which is the element in the middle after sorting, as BCH does
+func medianBchTime(times []uint32) uint32 {
+	sorted := append([]uint32{}, times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+// BchHeaderRelay is the system contract at BchHeaderRelayAddress. The submitters, which are decided by
+// governance, submit the headers of the BCH mainchain with system TXs calling submitHeaders(height, headers),
+// where headers are consecutive 80-byte headers and height is the height of the first one. Their parent must
+// be a stored header, either on the main chain or on a side branch. A header is accepted if it meets its own
+// target, and its target is not easier than powLimit, nor than the one of its parent by more than the
+// adjustment ASERT can make for the time between them. Its time must be later than the median time of the
+// BchMedianTimeSpan headers before it, and not later than the current block by more than BchMaxFutureTime,
+// so the time between the headers cannot be stretched to relax the target.
+// All the accepted headers are stored by their hashes with their total work. A branch becomes the main chain
+// once its total work is more than the one of the current main chain, so a reorg of the BCH mainchain is
+// followed by submitting the headers of the new branch, in as many TXs as needed. The headers of the main
+// chain are queried by GetBchHeader and verified against by the BCH SPV precompile.
+// It must be registered with the same parameters on all the nodes.
+type BchHeaderRelay struct {
+	submitters       map[common.Address]struct{}
+	powLimit         *big.Int
+	checkpointHeight uint64
+	checkpoint       []byte
+	checkpointWork   *uint256.Int
+}
+
+var _ types.SystemContractExecutor = (*BchHeaderRelay)(nil)
+
+// The relay starts from the checkpoint header at checkpointHeight, whose chain work is checkpointWork. The
+// headers before it cannot be submitted. powLimitBits is the compact target of the easiest difficulty.
+func NewBchHeaderRelay(submitters []common.Address, powLimitBits uint32, checkpointHeight uint64,
+	checkpoint []byte, checkpointWork *uint256.Int) *BchHeaderRelay {
+	relay := &BchHeaderRelay{
+		submitters:       make(map[common.Address]struct{}, len(submitters)),
+		powLimit:         compactToTarget(powLimitBits),
+		checkpointHeight: checkpointHeight,
+		checkpoint:       append([]byte{}, checkpoint...),
+		checkpointWork:   checkpointWork.Clone(),
+	}
+	for _, addr := range submitters {
+		relay.submitters[addr] = struct{}{}
+	}
+	return relay
+}
+
+// Store the checkpoint if there is no header stored yet
+func (relay *BchHeaderRelay) Init(ctx *types.Context) {
+	if _, ok := GetBchHeaderTip(ctx); ok {
+		return
+	}
+	setBchHeaderRecord(ctx, &bchHeaderRecord{relay.checkpoint, relay.checkpointHeight, relay.checkpointWork})
+	relay.storeHeader(ctx, relay.checkpointHeight, relay.checkpoint, relay.checkpointWork)
+}
+
+func (relay *BchHeaderRelay) IsSystemContract(addr common.Address) bool {
+	return addr == BchHeaderRelayAddress
+}
+
+func (relay *BchHeaderRelay) RequiredGas(input []byte) uint64 {
+	return BchRelayBaseGas
+}
+
+// The headers can only be submitted by TXs, not by contracts
+func (relay *BchHeaderRelay) Run(input []byte) ([]byte, error) {
+	return nil, errors.ErrNotCallableByContract
+}
+
+func (relay *BchHeaderRelay) storeHeader(ctx *types.Context, height uint64, header []byte, work *uint256.Int) {
+	StoreBchHeader(ctx, height, header)
+	bz := work.Bytes32()
+	ctx.Rbt.Set(types.GetBchChainWorkKey(height), bz[:])
+}
+
+func (relay *BchHeaderRelay) Execute(ctx *types.Context, currBlock *types.BlockInfo, tx *types.TxToRun) (status int, logs []types.EvmLog, gasUsed uint64, outData []byte) {
+	status = int(C.EVMC_FAILURE)
+	if tx.Gas < BchRelayBaseGas {
+		return int(C.EVMC_OUT_OF_GAS), nil, tx.Gas, nil
+	}
+	gasUsed = BchRelayBaseGas
+	if len(tx.Data) < 4 || string(tx.Data[:4]) != string(submitBchHeadersSel[:]) {
+		return
+	}
+	args, err := abiutil.Unpack(SubmitBchHeadersSig, tx.Data)
+	if err != nil {
+		return
+	}
+	headers := args[1].([]byte)
+	count := len(headers) / BchHeaderLen
+	gasUsed = BchRelayBaseGas + uint64(count)*BchRelayPerHeaderGas
+	if tx.Gas < gasUsed {
+		return int(C.EVMC_OUT_OF_GAS), nil, tx.Gas, nil
+	}
+	if _, ok := relay.submitters[tx.From]; !ok || tx.Value != [32]byte{} || count == 0 ||
+		count > MaxBchHeadersPerTx || len(headers)%BchHeaderLen != 0 || !args[0].(*uint256.Int).IsUint64() {
+		return
+	}
+	height := args[0].(*uint256.Int).Uint64()
+	var parentHash [32]byte
+	copy(parentHash[:], headers[4:36])
+	parent := getBchHeaderRecord(ctx, parentHash)
+	if parent == nil || height != parent.height+1 {
+		return
+	}
+	times := relay.ancestorTimes(ctx, parent)
+	recs := make([]*bchHeaderRecord, count)
+	for i := 0; i < count; i++ {
+		header := headers[i*BchHeaderLen : (i+1)*BchHeaderLen]
+		target := relay.checkHeader(header, parent.header, times, currBlock.Timestamp)
+		if target == nil {
+			return
+		}
+		recs[i] = &bchHeaderRecord{
+			header: header,
+			height: height + uint64(i),
+			work:   new(uint256.Int).Add(parent.work, targetToWork(target)),
+		}
+		parent = recs[i]
+		times = append(times, bchHeaderTime(header))
+		if len(times) > BchMedianTimeSpan {
+			times = times[1:]
+		}
+	}
+	for _, rec := range recs {
+		setBchHeaderRecord(ctx, rec)
+	}
+	tip, _ := GetBchHeaderTip(ctx)
+	if !parent.work.Gt(GetBchChainWork(ctx, tip)) {
+		return int(C.EVMC_SUCCESS), nil, gasUsed, nil // stored on a side branch
+	}
+	relay.switchTip(ctx, parent)
+	hash := BchHeaderHash(parent.header)
+	logs = []types.EvmLog{{
+		Address: BchHeaderRelayAddress,
+		Topics:  []common.Hash{bchTipChangedEvent, common.BigToHash(new(big.Int).SetUint64(parent.height))},
+		Data:    hash[:],
+	}}
+	return int(C.EVMC_SUCCESS), logs, gasUsed, nil
+}
+
+// Returns the times of at most BchMedianTimeSpan headers until rec, from the earliest one. The headers
+// before the checkpoint are not stored, so there are fewer of them near it.
+func (relay *BchHeaderRelay) ancestorTimes(ctx *types.Context, rec *bchHeaderRecord) []uint32 {
+	times := make([]uint32, BchMedianTimeSpan)
+	n := 0
+	for rec != nil && n < BchMedianTimeSpan {
+		n++
+		times[BchMedianTimeSpan-n] = bchHeaderTime(rec.header)
+		if rec.height == relay.checkpointHeight {
+			break
+		}
+		var parentHash [32]byte
+		copy(parentHash[:], rec.header[4:36])
+		rec = getBchHeaderRecord(ctx, parentHash)
+	}
+	return times[BchMedianTimeSpan-n:]
+}
+
+// Make the branch ending with tip the main chain. The headers of it are stored by their heights, from the
+// one after the fork point.
+func (relay *BchHeaderRelay) switchTip(ctx *types.Context, tip *bchHeaderRecord) {
+	var branch []*bchHeaderRecord
+	for rec := tip; rec != nil; {
+		if main := GetBchHeader(ctx, rec.height); main != nil && string(main) == string(rec.header) {
+			break // the fork point
+		}
+		branch = append(branch, rec)
+		var parentHash [32]byte
+		copy(parentHash[:], rec.header[4:36])
+		rec = getBchHeaderRecord(ctx, parentHash)
+	}
+	for i := len(branch) - 1; i >= 0; i-- {
+		relay.storeHeader(ctx, branch[i].height, branch[i].header, branch[i].work)
+	}
+}
+
+// Returns the target of header if it is a valid child of parent, otherwise nil. times are the ones of the
+// headers until parent for the median time, and now is the time of the current block.
+func (relay *BchHeaderRelay) checkHeader(header, parent []byte, times []uint32, now int64) *big.Int {
+	parentHash := BchHeaderHash(parent)
+	if string(header[4:36]) != string(parentHash[:]) {
+		return nil
+	}
+	if t := bchHeaderTime(header); t <= medianBchTime(times) || int64(t) > now+BchMaxFutureTime {
+		return nil
+	}
+	target := compactToTarget(bchHeaderBits(header))
+	if target == nil || target.Cmp(relay.powLimit) > 0 {
+		return nil
+	}
+	// the target can be doubled for each half-life passed since the parent, and one more time for the
+	// rounding of ASERT
+	maxTarget := compactToTarget(bchHeaderBits(parent))
+	if maxTarget == nil {
+		return nil
+	}
+	elapsed := int64(bchHeaderTime(header)) - int64(bchHeaderTime(parent))
+	shift := uint(1)
+	if elapsed > 0 {
+		shift += uint(elapsed / BchAsertHalfLife)
+	}
+	if shift < 256 && target.Cmp(maxTarget.Lsh(maxTarget, shift)) > 0 {
+		return nil
+	}
+	hash := BchHeaderHash(header)
+	for i := 0; i < 16; i++ { // the hash is a little-endian number
+		hash[i], hash[31-i] = hash[31-i], hash[i]
+	}
+	if new(big.Int).SetBytes(hash[:]).Cmp(target) > 0 {
+		return nil
+	}
+	return target
+}
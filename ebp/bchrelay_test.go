@@ -0,0 +1,214 @@
+package ebp
+
+import (
+	"encoding/binary"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/abiutil"
+	"github.com/smartbch/moeingevm/types"
+)
+
+const regtestBits = 0x207fffff
+
+// Returns a child of parent meeting the target of bits
+func mineBchHeader(parent []byte, timestamp, bits uint32) []byte {
+	header := make([]byte, BchHeaderLen)
+	parentHash := BchHeaderHash(parent)
+	copy(header[4:36], parentHash[:])
+	binary.LittleEndian.PutUint32(header[68:72], timestamp)
+	binary.LittleEndian.PutUint32(header[72:76], bits)
+	target := compactToTarget(bits)
+	for nonce := uint32(0); ; nonce++ {
+		binary.LittleEndian.PutUint32(header[76:80], nonce)
+		hash := BchHeaderHash(header)
+		for i := 0; i < 16; i++ {
+			hash[i], hash[31-i] = hash[31-i], hash[i]
+		}
+		if new(big.Int).SetBytes(hash[:]).Cmp(target) <= 0 {
+			return header
+		}
+	}
+}
+
+func mineBchChain(parent []byte, count int, timestamp, bits uint32) (headers []byte) {
+	for i := 0; i < count; i++ {
+		parent = mineBchHeader(parent, timestamp+uint32(i)*600, bits)
+		headers = append(headers, parent...)
+	}
+	return
+}
+
+func submitHeadersTx(from common.Address, height uint64, headers []byte) *types.TxToRun {
+	data, _ := abiutil.Pack(SubmitBchHeadersSig, height, headers)
+	return &types.TxToRun{BasicTx: types.BasicTx{From: from, To: BchHeaderRelayAddress, Gas: 10000000, Data: data}}
+}
+
+func TestCompactToTarget(t *testing.T) {
+	require.Equal(t, "ffff0000000000000000000000000000000000000000000000000000", compactToTarget(0x1d00ffff).Text(16))
+	require.Equal(t, int64(0x12), compactToTarget(0x01123456).Int64())
+	require.Nil(t, compactToTarget(0x04923456)) // negative
+	require.Nil(t, compactToTarget(0x1d000000))
+	// the genesis block has the work of 2^32+2^16+1
+	require.Equal(t, uint64(0x100010001), targetToWork(compactToTarget(0x1d00ffff)).Uint64())
+}
+
+func TestBchHeaderRelay(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	checkpoint := make([]byte, BchHeaderLen)
+	binary.LittleEndian.PutUint32(checkpoint[72:76], regtestBits)
+	relay := NewBchHeaderRelay([]common.Address{from1}, regtestBits, 100, checkpoint, uint256.NewInt(1000))
+	relay.Init(ctx)
+	tip, ok := GetBchHeaderTip(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(100), tip)
+	unitWork := targetToWork(compactToTarget(regtestBits))
+	blk := &types.BlockInfo{Number: 1, Timestamp: 2000000}
+	success := 0 // EVMC_SUCCESS
+
+	headers := mineBchChain(checkpoint, 3, 600, regtestBits)
+	status, _, _, _ := relay.Execute(ctx, blk, submitHeadersTx(from2, 101, headers)) // not a submitter
+	require.NotEqual(t, success, status)
+	status, _, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 102, headers)) // wrong height
+	require.NotEqual(t, success, status)
+	status, logs, gasUsed, _ := relay.Execute(ctx, blk, submitHeadersTx(from1, 101, headers))
+	require.Equal(t, success, status)
+	require.Equal(t, BchRelayBaseGas+3*BchRelayPerHeaderGas, gasUsed)
+	require.Equal(t, 1, len(logs))
+	require.Equal(t, common.BigToHash(big.NewInt(103)), logs[0].Topics[1])
+	tip, _ = GetBchHeaderTip(ctx)
+	require.Equal(t, uint64(103), tip)
+	require.Equal(t, headers[160:], GetBchHeader(ctx, 103))
+	work := uint256.NewInt(1000)
+	work.Add(work, new(uint256.Int).Mul(unitWork, uint256.NewInt(3)))
+	require.Equal(t, work, GetBchChainWork(ctx, 103))
+
+	// a fork from 101 with the same work is stored on a side branch
+	fork := mineBchChain(headers[:80], 2, 1000, regtestBits)
+	status, logs, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 102, fork))
+	require.Equal(t, success, status)
+	require.Equal(t, 0, len(logs))
+	tip, _ = GetBchHeaderTip(ctx)
+	require.Equal(t, uint64(103), tip)
+	require.Equal(t, headers[80:160], GetBchHeader(ctx, 102))
+	// with more work it becomes the main chain
+	status, logs, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 104, mineBchHeader(fork[80:], 3000, regtestBits)))
+	require.Equal(t, success, status)
+	require.Equal(t, 1, len(logs))
+	tip, _ = GetBchHeaderTip(ctx)
+	require.Equal(t, uint64(104), tip)
+	require.Equal(t, fork[:80], GetBchHeader(ctx, 102))
+	require.Equal(t, fork[80:], GetBchHeader(ctx, 103))
+	// the old branch can still be extended, and it becomes the main chain again with more work
+	old := mineBchChain(headers[160:], 2, 5000, regtestBits)
+	status, _, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 104, old))
+	require.Equal(t, success, status)
+	tip, _ = GetBchHeaderTip(ctx)
+	require.Equal(t, uint64(105), tip)
+	require.Equal(t, headers[80:160], GetBchHeader(ctx, 102))
+	require.Equal(t, old[80:], GetBchHeader(ctx, 105))
+	work.Add(work, new(uint256.Int).Mul(unitWork, uint256.NewInt(2)))
+	require.Equal(t, work, GetBchChainWork(ctx, 105))
+
+	// the headers cannot be easier than powLimit
+	status, _, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 106, mineBchHeader(old[80:], 7000, 0x2100ffff)))
+	require.NotEqual(t, success, status)
+	// nor can their parents be unknown
+	status, _, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 102, mineBchHeader(fork, 7000, regtestBits)))
+	require.NotEqual(t, success, status)
+	// the headers at or before the checkpoint cannot be submitted
+	status, _, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 100, checkpoint))
+	require.NotEqual(t, success, status)
+}
+
+func TestBchHeaderRelayDifficulty(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	const hardBits = 0x1f7fffff // 256 times as hard as regtestBits
+	checkpoint := make([]byte, BchHeaderLen)
+	binary.LittleEndian.PutUint32(checkpoint[72:76], hardBits)
+	relay := NewBchHeaderRelay([]common.Address{from1}, regtestBits, 100, checkpoint, uint256.NewInt(1000))
+	relay.Init(ctx)
+	blk := &types.BlockInfo{Number: 1, Timestamp: 2000000}
+	success := 0 // EVMC_SUCCESS
+
+	// the target can be almost doubled within a half-life, but not tripled
+	status, _, _, _ := relay.Execute(ctx, blk, submitHeadersTx(from1, 101, mineBchHeader(checkpoint, 600, 0x20017fff)))
+	require.NotEqual(t, success, status)
+	easier := mineBchHeader(checkpoint, 600, 0x2000ffff)
+	status, _, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 101, easier))
+	require.Equal(t, success, status)
+	// 128 times as easy is too much after a short time
+	status, _, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 102, mineBchHeader(easier, 1200, regtestBits)))
+	require.NotEqual(t, success, status)
+	// but it is allowed after seven half-lives
+	status, _, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 102, mineBchHeader(easier, 600+7*BchAsertHalfLife, regtestBits)))
+	require.Equal(t, success, status)
+}
+
+// The headers of a branch are submitted in several TXs, and the ones before the last do not have more work
+func TestBchHeaderRelayLongReorg(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	checkpoint := make([]byte, BchHeaderLen)
+	binary.LittleEndian.PutUint32(checkpoint[72:76], regtestBits)
+	relay := NewBchHeaderRelay([]common.Address{from1}, regtestBits, 100, checkpoint, uint256.NewInt(1000))
+	relay.Init(ctx)
+	blk := &types.BlockInfo{Number: 1, Timestamp: 2000000}
+	success := 0 // EVMC_SUCCESS
+
+	main := mineBchChain(checkpoint, MaxBchHeadersPerTx, 600, regtestBits)
+	status, _, _, _ := relay.Execute(ctx, blk, submitHeadersTx(from1, 101, main))
+	require.Equal(t, success, status)
+	branch := mineBchChain(checkpoint, MaxBchHeadersPerTx+1, 700, regtestBits)
+	status, logs, _, _ := relay.Execute(ctx, blk, submitHeadersTx(from1, 101, branch[:MaxBchHeadersPerTx*BchHeaderLen]))
+	require.Equal(t, success, status)
+	require.Equal(t, 0, len(logs))
+	require.Equal(t, main[:80], GetBchHeader(ctx, 101))
+	status, logs, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 101+MaxBchHeadersPerTx, branch[MaxBchHeadersPerTx*BchHeaderLen:]))
+	require.Equal(t, success, status)
+	require.Equal(t, 1, len(logs))
+	tip, _ := GetBchHeaderTip(ctx)
+	require.Equal(t, uint64(101+MaxBchHeadersPerTx), tip)
+	for i := 0; i <= MaxBchHeadersPerTx; i++ {
+		require.Equal(t, branch[i*BchHeaderLen:(i+1)*BchHeaderLen], GetBchHeader(ctx, 101+uint64(i)))
+	}
+}
+
+func TestBchHeaderRelayTime(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	checkpoint := make([]byte, BchHeaderLen)
+	binary.LittleEndian.PutUint32(checkpoint[68:72], 10000)
+	binary.LittleEndian.PutUint32(checkpoint[72:76], regtestBits)
+	relay := NewBchHeaderRelay([]common.Address{from1}, regtestBits, 100, checkpoint, uint256.NewInt(1000))
+	relay.Init(ctx)
+	blk := &types.BlockInfo{Number: 1, Timestamp: 20000}
+	success := 0 // EVMC_SUCCESS
+
+	headers := mineBchChain(checkpoint, BchMedianTimeSpan, 10600, regtestBits)
+	status, _, _, _ := relay.Execute(ctx, blk, submitHeadersTx(from1, 101, headers))
+	require.Equal(t, success, status)
+	tip := headers[len(headers)-BchHeaderLen:]
+	// the median time of the last 11 headers is 13600
+	status, _, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 112, mineBchHeader(tip, 13600, regtestBits)))
+	require.NotEqual(t, success, status)
+	// the time cannot be later than the current block by more than two hours
+	status, _, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 112, mineBchHeader(tip, 20000+BchMaxFutureTime+1, regtestBits)))
+	require.NotEqual(t, success, status)
+	status, _, _, _ = relay.Execute(ctx, blk, submitHeadersTx(from1, 112, mineBchHeader(tip, 13601, regtestBits)))
+	require.Equal(t, success, status)
+}
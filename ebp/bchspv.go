@@ -0,0 +1,122 @@
+package ebp
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+const (
+	BchHeaderLen = 80
+	// The max count of hashes in a merkle branch, which allows 2^32 TXs in a block
+	MaxBchMerkleDepth = 32
+)
+
+// Returns the header of the BCH mainchain block at height, or nil if it is not stored or above the tip
+func GetBchHeader(ctx *types.Context, height uint64) []byte {
+	tip, ok := GetBchHeaderTip(ctx)
+	if !ok || height > tip {
+		return nil
+	}
+	return ctx.Rbt.Get(types.GetBchHeaderKey(height))
+}
+
+// Returns the height of the latest BCH mainchain header stored, false if there is none
+func GetBchHeaderTip(ctx *types.Context) (uint64, bool) {
+	bz := ctx.Rbt.Get(types.BchHeaderTipKey)
+	if len(bz) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(bz), true
+}
+
+// Store the header of the BCH mainchain block at height and make it the tip. The headers above it, which
+// were stored before a reorg, are ignored since then. It does not validate the header, which is left to
+// BchHeaderRelay.
+func StoreBchHeader(ctx *types.Context, height uint64, header []byte) {
+	var tip [8]byte
+	binary.BigEndian.PutUint64(tip[:], height)
+	ctx.Rbt.Set(types.GetBchHeaderKey(height), append([]byte{}, header...))
+	ctx.Rbt.Set(types.BchHeaderTipKey, tip[:])
+}
+
+func doubleSha256(data []byte) [32]byte {
+	h := sha256.Sum256(data)
+	return sha256.Sum256(h[:])
+}
+
+// Returns true if the merkle branch proves that txHash is the index-th tx of the block with merkleRoot. The
+// hashes are in the byte order used in the serialized blocks, which is the reverse of the one displayed.
+func verifyBchMerkleProof(txHash [32]byte, index uint64, branch [][32]byte, merkleRoot []byte) bool {
+	if len(branch) > MaxBchMerkleDepth || index>>uint(len(branch)) != 0 {
+		return false
+	}
+	var buf [64]byte
+	curr := txHash
+	for _, sibling := range branch {
+		if index&1 == 0 {
+			copy(buf[:32], curr[:])
+			copy(buf[32:], sibling[:])
+		} else {
+			copy(buf[:32], sibling[:])
+			copy(buf[32:], curr[:])
+		}
+		curr = doubleSha256(buf[:])
+		index >>= 1
+	}
+	return string(curr[:]) == string(merkleRoot)
+}
+
+// BchSpvVerifyContract verifies that a tx is included in a BCH mainchain block, whose header is stored by
+// the system. It returns the count of confirmations, counting the block itself, or zero if the proof is
+// invalid or the header is unknown. Like other SPV verifiers, it cannot tell a 64-byte tx from an inner
+// node of the merkle tree, so the callers should check the length of the tx they hash.
+type BchSpvVerifyContract struct{}
+
+var _ statefulPrecompiledContract = (*BchSpvVerifyContract)(nil)
+
+func (bsvc *BchSpvVerifyContract) RequiredGas(input []byte) uint64 {
+	return precompileGasTables[BchSpvAddress].Gas(input)
+}
+
+func (bsvc *BchSpvVerifyContract) Run(input []byte) ([]byte, error) {
+	return nil, errors.ErrStateNotAvailable
+}
+
+func (bsvc *BchSpvVerifyContract) RunWithContext(ctx *types.Context, input []byte) ([]byte, error) {
+	var result [32]byte
+	// prepare input: abi.encodePacked(height/*uint256*/, txHash/*bytes32*/, index/*uint256*/, branch/*bytes32[]*/)
+	if len(input) < 96 || len(input)%32 != 0 {
+		return result[:], errors.ErrInvalidInputLength
+	}
+	if !isUint64(input[0:32]) || !isUint64(input[64:96]) {
+		return result[:], nil
+	}
+	height := binary.BigEndian.Uint64(input[24:32])
+	index := binary.BigEndian.Uint64(input[88:96])
+	var txHash [32]byte
+	copy(txHash[:], input[32:64])
+	branch := make([][32]byte, (len(input)-96)/32)
+	for i := range branch {
+		copy(branch[i][:], input[96+32*i:])
+	}
+	header := GetBchHeader(ctx, height)
+	if len(header) != BchHeaderLen || !verifyBchMerkleProof(txHash, index, branch, header[36:68]) {
+		return result[:], nil
+	}
+	tip, _ := GetBchHeaderTip(ctx)
+	binary.BigEndian.PutUint64(result[24:], tip-height+1)
+	return result[:], nil
+}
+
+// Returns true if the 32-byte big-endian word fits in uint64
+func isUint64(word []byte) bool {
+	for _, b := range word[:24] {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
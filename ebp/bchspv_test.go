@@ -0,0 +1,148 @@
+package ebp
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// the header of the genesis block, whose only tx is the coinbase one
+const bchGenesisHeader = "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b2" +
+	"7ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c"
+
+func spvInput(height uint64, txHash [32]byte, index uint64, branch ...[32]byte) []byte {
+	input := append(common.LeftPadBytes(new(big.Int).SetUint64(height).Bytes(), 32), txHash[:]...)
+	input = append(input, common.LeftPadBytes(new(big.Int).SetUint64(index).Bytes(), 32)...)
+	for _, h := range branch {
+		input = append(input, h[:]...)
+	}
+	return input
+}
+
+// Returns the merkle tree of the hashes, level by level, in the way of Bitcoin
+func bchMerkleTree(hashes [][32]byte) [][][32]byte {
+	tree := [][][32]byte{hashes}
+	for len(hashes) > 1 {
+		if len(hashes)%2 == 1 {
+			hashes = append(hashes, hashes[len(hashes)-1])
+		}
+		next := make([][32]byte, len(hashes)/2)
+		for i := range next {
+			next[i] = doubleSha256(append(hashes[2*i][:], hashes[2*i+1][:]...))
+		}
+		tree = append(tree, next)
+		hashes = next
+	}
+	return tree
+}
+
+func TestVerifyBchMerkleProof(t *testing.T) {
+	header, _ := hex.DecodeString(bchGenesisHeader)
+	hash := doubleSha256(header)
+	require.Equal(t, "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f", reverseHex(hash))
+	var coinbase [32]byte
+	copy(coinbase[:], header[36:68])
+	require.True(t, verifyBchMerkleProof(coinbase, 0, nil, header[36:68]))
+	require.False(t, verifyBchMerkleProof(coinbase, 1, nil, header[36:68]))
+
+	txs := [][32]byte{{1}, {2}, {3}, {4}, {5}}
+	tree := bchMerkleTree(txs)
+	root := tree[len(tree)-1][0]
+	for i := range txs {
+		var branch [][32]byte
+		idx := i
+		for _, level := range tree[:len(tree)-1] {
+			sibling := idx ^ 1
+			if sibling >= len(level) {
+				sibling = idx // the last hash is paired with itself
+			}
+			branch = append(branch, level[sibling])
+			idx >>= 1
+		}
+		require.True(t, verifyBchMerkleProof(txs[i], uint64(i), branch, root[:]))
+		if branch[0] != txs[i] { // the last one paired with itself proves both positions
+			require.False(t, verifyBchMerkleProof(txs[i], uint64(i^1), branch, root[:]))
+		}
+		require.False(t, verifyBchMerkleProof(txs[i], uint64(i+8), branch, root[:]))
+	}
+	require.False(t, verifyBchMerkleProof(root, 0, make([][32]byte, MaxBchMerkleDepth+1), root[:]))
+}
+
+// Returns the hex of h in the displayed order
+func reverseHex(h [32]byte) string {
+	for i := 0; i < 16; i++ {
+		h[i], h[31-i] = h[31-i], h[i]
+	}
+	return hex.EncodeToString(h[:])
+}
+
+func TestBchHeaderStore(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	_, ok := GetBchHeaderTip(ctx)
+	require.False(t, ok)
+	require.Nil(t, GetBchHeader(ctx, 0))
+	StoreBchHeader(ctx, 100, []byte{1})
+	StoreBchHeader(ctx, 101, []byte{2})
+	tip, ok := GetBchHeaderTip(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(101), tip)
+	require.Equal(t, []byte{2}, GetBchHeader(ctx, 101))
+	StoreBchHeader(ctx, 100, []byte{3}) // a reorg
+	require.Equal(t, []byte{3}, GetBchHeader(ctx, 100))
+	require.Nil(t, GetBchHeader(ctx, 101))
+}
+
+func TestBchSpvPrecompile(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	txs := [][32]byte{{1}, {2}, {3}}
+	tree := bchMerkleTree(txs)
+	header := make([]byte, BchHeaderLen)
+	copy(header[36:68], tree[2][0][:])
+	ctx := prepareCtx(trunk)
+	StoreBchHeader(ctx, 700000, header)
+	StoreBchHeader(ctx, 700001, make([]byte, BchHeaderLen))
+	StoreBchHeader(ctx, 700002, make([]byte, BchHeaderLen))
+	ctx.Close(true)
+	ctx = prepareCtx(trunk)
+	defer ctx.Close(false)
+	ctx.SetChainConfig(&types.ChainConfig{Upgrades: []types.Upgrade{
+		{Height: 2, Rules: types.Rules{Revision: types.Istanbul, RefundQuotient: 2, BchSpvPrecompile: true}}}})
+	input := spvInput(700000, txs[2], 2, txs[2], tree[1][0])
+	msg := ethereum.CallMsg{From: from1, To: &BchSpvAddress, Data: input}
+
+	res := ExecuteReadOnly(ctx, msg, &types.BlockInfo{Number: 1}) // not enabled yet
+	require.False(t, res.Failed())
+	require.Empty(t, res.OutData)
+
+	res = ExecuteReadOnly(ctx, msg, &types.BlockInfo{Number: 2})
+	require.False(t, res.Failed())
+	require.Equal(t, common.LeftPadBytes([]byte{3}, 32), res.OutData)
+	require.Equal(t, BCH_SPV_VERIFY_GAS+2*BCH_SPV_PER_LEVEL_GAS, (&BchSpvVerifyContract{}).RequiredGas(input))
+
+	msg.Data = spvInput(700000, txs[1], 2, txs[2], tree[1][0])
+	res = ExecuteReadOnly(ctx, msg, &types.BlockInfo{Number: 2})
+	require.False(t, res.Failed())
+	require.Equal(t, make([]byte, 32), res.OutData)
+
+	msg.Data = spvInput(700003, txs[2], 2, txs[2], tree[1][0]) // the header is unknown
+	res = ExecuteReadOnly(ctx, msg, &types.BlockInfo{Number: 2})
+	require.Equal(t, make([]byte, 32), res.OutData)
+
+	msg.Data = input[:100]
+	res = ExecuteReadOnly(ctx, msg, &types.BlockInfo{Number: 2})
+	require.True(t, res.Failed())
+
+	_, err := (&BchSpvVerifyContract{}).Run(input)
+	require.ErrorIs(t, err, errors.ErrStateNotAvailable)
+}
@@ -0,0 +1,203 @@
+package ebp
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// CachedBlock is the full results of an executed block
+type CachedBlock struct {
+	Height  int64
+	Hash    [32]byte
+	Results BlockResults
+	Txs     []*types.Transaction // the receipts, with their logs
+	Traces  [][]byte             // the traces of the TXs, if the node records them with SetTraces
+	size    int
+}
+
+func (b *CachedBlock) estimateSize() int {
+	size := 0
+	for _, tx := range b.Txs {
+		size += tx.Msgsize()
+	}
+	for _, trace := range b.Traces {
+		size += len(trace)
+	}
+	return size
+}
+
+type BlockCacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64 // the blocks evicted because there are too many blocks
+	SizeEvictions uint64 // the blocks evicted or not cached because they are too large
+	Blocks        int
+	Bytes         int
+}
+
+// BlockCache keeps the full results of the last few executed blocks in memory, such that the common RPC
+// queries about the latest blocks and the pending confirmations do not hit MoDB. It is bounded by both
+// the count of blocks and their estimated size, and the oldest blocks are evicted first.
+type BlockCache struct {
+	mtx       sync.Mutex
+	maxBlocks int
+	maxBytes  int
+	blocks    []*CachedBlock // in increasing order of height
+	txs       map[common.Hash]*types.Transaction
+	stats     BlockCacheStats
+}
+
+func NewBlockCache(maxBlocks, maxBytes int) *BlockCache {
+	return &BlockCache{
+		maxBlocks: maxBlocks,
+		maxBytes:  maxBytes,
+		blocks:    make([]*CachedBlock, 0, maxBlocks+1),
+		txs:       make(map[common.Hash]*types.Transaction),
+	}
+}
+
+// Add a block, the cached ones at its height and later are dropped first
+func (c *BlockCache) Add(b *CachedBlock) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for len(c.blocks) != 0 && c.blocks[len(c.blocks)-1].Height >= b.Height {
+		c.remove(len(c.blocks) - 1)
+	}
+	b.size = b.estimateSize()
+	if b.size > c.maxBytes {
+		c.stats.SizeEvictions++
+		return
+	}
+	c.blocks = append(c.blocks, b)
+	c.stats.Bytes += b.size
+	for _, tx := range b.Txs {
+		c.txs[tx.Hash] = tx
+	}
+	c.evict()
+}
+
+func (c *BlockCache) evict() {
+	for len(c.blocks) > c.maxBlocks {
+		c.remove(0)
+		c.stats.Evictions++
+	}
+	for c.stats.Bytes > c.maxBytes {
+		c.remove(0)
+		c.stats.SizeEvictions++
+	}
+}
+
+func (c *BlockCache) remove(i int) {
+	b := c.blocks[i]
+	for _, tx := range b.Txs {
+		if c.txs[tx.Hash] == tx {
+			delete(c.txs, tx.Hash)
+		}
+	}
+	c.stats.Bytes -= b.size
+	c.blocks = append(c.blocks[:i], c.blocks[i+1:]...)
+}
+
+// Attach the traces of the TXs to the cached block at height. Returns false if it is not cached.
+func (c *BlockCache) SetTraces(height int64, traces [][]byte) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	b := c.find(height)
+	if b == nil {
+		return false
+	}
+	oldSize := b.size
+	b.Traces = traces
+	b.size = b.estimateSize()
+	c.stats.Bytes += b.size - oldSize
+	c.evict()
+	return true
+}
+
+func (c *BlockCache) find(height int64) *CachedBlock {
+	if len(c.blocks) == 0 {
+		return nil
+	}
+	i := height - c.blocks[0].Height
+	if i < 0 || i >= int64(len(c.blocks)) || c.blocks[i].Height != height {
+		// the heights may be discontinuous if a block was too large to be cached
+		for _, b := range c.blocks {
+			if b.Height == height {
+				return b
+			}
+		}
+		return nil
+	}
+	return c.blocks[i]
+}
+
+func (c *BlockCache) count(found bool) {
+	if found {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+}
+
+// The returned block is shared and must not be modified
+func (c *BlockCache) Get(height int64) (*CachedBlock, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	b := c.find(height)
+	c.count(b != nil)
+	return b, b != nil
+}
+
+func (c *BlockCache) GetByHash(hash [32]byte) (*CachedBlock, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for i := len(c.blocks) - 1; i >= 0; i-- {
+		if c.blocks[i].Hash == hash {
+			c.count(true)
+			return c.blocks[i], true
+		}
+	}
+	c.count(false)
+	return nil, false
+}
+
+// Returns the receipt of a tx committed in the cached blocks
+func (c *BlockCache) GetTx(hash common.Hash) (*types.Transaction, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	tx, ok := c.txs[hash]
+	c.count(ok)
+	return tx, ok
+}
+
+// Returns the block with the highest height
+func (c *BlockCache) Latest() (*CachedBlock, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if len(c.blocks) == 0 {
+		c.count(false)
+		return nil, false
+	}
+	c.count(true)
+	return c.blocks[len(c.blocks)-1], true
+}
+
+func (c *BlockCache) Stats() BlockCacheStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	stats := c.stats
+	stats.Blocks = len(c.blocks)
+	return stats
+}
+
+func (exec *txEngine) cacheBlock() {
+	exec.blockCache.Add(&CachedBlock{
+		Height:  exec.currentBlock.Number,
+		Hash:    exec.currentBlock.Hash,
+		Results: exec.blockResults,
+		Txs:     append([]*types.Transaction(nil), exec.committedTxs...),
+	})
+}
@@ -0,0 +1,105 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func cachedBlock(height int64, hashes ...byte) *CachedBlock {
+	b := &CachedBlock{Height: height, Hash: [32]byte{byte(height)}}
+	for _, h := range hashes {
+		b.Txs = append(b.Txs, &types.Transaction{Hash: common.Hash{h}, BlockNumber: height})
+	}
+	return b
+}
+
+func TestBlockCache(t *testing.T) {
+	c := NewBlockCache(2, 1<<20)
+	_, ok := c.Latest()
+	require.False(t, ok)
+	c.Add(cachedBlock(1, 1))
+	c.Add(cachedBlock(2, 2))
+	c.Add(cachedBlock(3, 3, 4))
+	_, ok = c.Get(1)
+	require.False(t, ok)
+	b, ok := c.Get(2)
+	require.True(t, ok)
+	require.Equal(t, int64(2), b.Height)
+	b, ok = c.GetByHash([32]byte{3})
+	require.True(t, ok)
+	require.Equal(t, 2, len(b.Txs))
+	tx, ok := c.GetTx(common.Hash{4})
+	require.True(t, ok)
+	require.Equal(t, int64(3), tx.BlockNumber)
+	_, ok = c.GetTx(common.Hash{1})
+	require.False(t, ok)
+
+	// a block at an existing height replaces it and the later ones
+	c.Add(cachedBlock(2, 5))
+	b, ok = c.Latest()
+	require.True(t, ok)
+	require.Equal(t, int64(2), b.Height)
+	_, ok = c.GetTx(common.Hash{3})
+	require.False(t, ok)
+
+	require.True(t, c.SetTraces(2, [][]byte{{1, 2, 3}}))
+	require.False(t, c.SetTraces(3, nil))
+	stats := c.Stats()
+	require.Equal(t, uint64(4), stats.Hits)
+	require.Equal(t, uint64(4), stats.Misses)
+	require.Equal(t, uint64(1), stats.Evictions)
+	require.Equal(t, 1, stats.Blocks)
+	require.Equal(t, cachedBlock(2, 5).estimateSize()+3, stats.Bytes)
+}
+
+func TestBlockCacheSizeLimit(t *testing.T) {
+	size := cachedBlock(1, 1).estimateSize()
+	c := NewBlockCache(10, 2*size)
+	c.Add(cachedBlock(1, 1))
+	c.Add(cachedBlock(2, 2))
+	c.Add(cachedBlock(3, 3))
+	_, ok := c.Get(1)
+	require.False(t, ok)
+	c.Add(cachedBlock(4, 4, 5, 6)) // too large to be cached
+	_, ok = c.Get(4)
+	require.False(t, ok)
+	require.True(t, c.SetTraces(3, [][]byte{make([]byte, size)}))
+	_, ok = c.Get(2)
+	require.False(t, ok)
+	stats := c.Stats()
+	require.Equal(t, uint64(3), stats.SizeEvictions)
+	require.Equal(t, 1, stats.Blocks)
+	require.Equal(t, 2*size, stats.Bytes)
+}
+
+func TestBlockCacheInExecute(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	c := NewBlockCache(4, 1<<20)
+	e.SetBlockCache(c)
+	e.SetContext(prepareCtx(trunk))
+	txs := prepareAccAndTx(e)
+	e.SetContext(prepareCtx(trunk))
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 1, Hash: [32]byte{1}})
+	b, ok := c.GetByHash([32]byte{1})
+	require.True(t, ok)
+	require.Equal(t, e.CommittedTxs(), b.Txs)
+	require.Equal(t, e.BlockResults(), b.Results)
+	require.Equal(t, 2, b.Results.TxCount)
+	tx, ok := c.GetTx(txs[0].Hash())
+	require.True(t, ok)
+	require.Equal(t, int64(1), tx.BlockNumber)
+}
@@ -0,0 +1,53 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestReserveBlockGas(t *testing.T) {
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetBlockGasLimit(100)
+	e.updateBlockGasLeft(nil)
+	require.True(t, e.reserveBlockGas(150, 0)) // the first tx of a block
+	require.Equal(t, uint64(0), e.blockGasLeft)
+	require.False(t, e.reserveBlockGas(1, 1))
+
+	e.cumulativeGasUsed = 10
+	e.updateBlockGasLeft([]*TxRunner{{GasUsed: 20}})
+	require.Equal(t, uint64(70), e.blockGasLeft)
+	require.False(t, e.reserveBlockGas(80, 0))
+	require.True(t, e.reserveBlockGas(70, 0))
+	require.Equal(t, uint64(0), e.blockGasLeft)
+}
+
+/*
+testcase:
+account1 send txs(nonce): 0 to account3
+account2 send txs(nonce): 0 to account4
+the block gas limit only covers the gas limit of one tx, so the other one is executed in the next block
+*/
+func TestTxEngine_BlockGasLimit(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareEngine(trunk)
+	e.SetBlockGasLimit(150000)
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 1})
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, 1, e.StandbyQLen())
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 2})
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, 0, e.StandbyQLen())
+}
@@ -0,0 +1,175 @@
+package ebp
+
+import (
+	"encoding/binary"
+
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+// BlockMeta is a compact summary of an executed block, for the block lists of explorers
+type BlockMeta struct {
+	Height        int64
+	Timestamp     int64
+	Hash          [32]byte
+	Proposer      [20]byte
+	TxCount       uint32
+	FailedTxCount uint32
+	LogCount      uint32
+	DataSize      uint64 // the total length of the TXs' input data
+	GasUsed       uint64
+	GasFee        uint256.Int // the fees collected from the TXs
+	FeeRefund     uint256.Int
+	BaseFee       uint256.Int // zero if the base fee is not used
+	// zero in the records written before the field was added
+	OrderingAlgorithm OrderingAlgorithm
+}
+
+const (
+	blockMetaV1Len = 8 + 8 + 32 + 20 + 4 + 4 + 4 + 8 + 8 + 32 + 32 + 32
+	blockMetaLen   = blockMetaV1Len + 1
+)
+
+func (m *BlockMeta) ToBytes() []byte {
+	bz := make([]byte, blockMetaLen)
+	binary.BigEndian.PutUint64(bz[0:8], uint64(m.Height))
+	binary.BigEndian.PutUint64(bz[8:16], uint64(m.Timestamp))
+	copy(bz[16:48], m.Hash[:])
+	copy(bz[48:68], m.Proposer[:])
+	binary.BigEndian.PutUint32(bz[68:72], m.TxCount)
+	binary.BigEndian.PutUint32(bz[72:76], m.FailedTxCount)
+	binary.BigEndian.PutUint32(bz[76:80], m.LogCount)
+	binary.BigEndian.PutUint64(bz[80:88], m.DataSize)
+	binary.BigEndian.PutUint64(bz[88:96], m.GasUsed)
+	m.GasFee.WriteToSlice(bz[96:128])
+	m.FeeRefund.WriteToSlice(bz[128:160])
+	m.BaseFee.WriteToSlice(bz[160:192])
+	bz[192] = byte(m.OrderingAlgorithm)
+	return bz
+}
+
+// Returns false if bz is not a valid encoding
+func (m *BlockMeta) FromBytes(bz []byte) bool {
+	if len(bz) != blockMetaLen && len(bz) != blockMetaV1Len {
+		return false
+	}
+	m.Height = int64(binary.BigEndian.Uint64(bz[0:8]))
+	m.Timestamp = int64(binary.BigEndian.Uint64(bz[8:16]))
+	copy(m.Hash[:], bz[16:48])
+	copy(m.Proposer[:], bz[48:68])
+	m.TxCount = binary.BigEndian.Uint32(bz[68:72])
+	m.FailedTxCount = binary.BigEndian.Uint32(bz[72:76])
+	m.LogCount = binary.BigEndian.Uint32(bz[76:80])
+	m.DataSize = binary.BigEndian.Uint64(bz[80:88])
+	m.GasUsed = binary.BigEndian.Uint64(bz[88:96])
+	m.GasFee.SetBytes32(bz[96:128])
+	m.FeeRefund.SetBytes32(bz[128:160])
+	m.BaseFee.SetBytes32(bz[160:192])
+	m.OrderingAlgorithm = 0
+	if len(bz) == blockMetaLen {
+		m.OrderingAlgorithm = OrderingAlgorithm(bz[192])
+	}
+	return true
+}
+
+// KVStore is the storage of the off-chain indexes, such as a database of the node. It is not world state,
+// so the records do not affect the state root.
+type KVStore interface {
+	Get(key []byte) []byte // returns nil if the key does not exist
+	Set(key, value []byte)
+}
+
+// BlockMetaStore persists a BlockMeta for each block executed by the engine
+type BlockMetaStore struct {
+	db KVStore
+}
+
+func NewBlockMetaStore(db KVStore) *BlockMetaStore {
+	return &BlockMetaStore{db: db}
+}
+
+var blockMetaLatestKey = []byte("bm-latest")
+
+func blockMetaKey(height int64) []byte {
+	bz := make([]byte, 3+8)
+	copy(bz, "bm-")
+	binary.BigEndian.PutUint64(bz[3:], uint64(height))
+	return bz
+}
+
+func (s *BlockMetaStore) Put(m *BlockMeta) {
+	s.db.Set(blockMetaKey(m.Height), m.ToBytes())
+	if latest, ok := s.LatestHeight(); !ok || m.Height > latest {
+		var bz [8]byte
+		binary.BigEndian.PutUint64(bz[:], uint64(m.Height))
+		s.db.Set(blockMetaLatestKey, bz[:])
+	}
+}
+
+func (s *BlockMetaStore) Get(height int64) (*BlockMeta, bool) {
+	m := &BlockMeta{}
+	if !m.FromBytes(s.db.Get(blockMetaKey(height))) {
+		return nil, false
+	}
+	return m, true
+}
+
+// Returns the highest height which has a BlockMeta
+func (s *BlockMetaStore) LatestHeight() (int64, bool) {
+	bz := s.db.Get(blockMetaLatestKey)
+	if len(bz) != 8 {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(bz)), true
+}
+
+// Returns the BlockMetas in the heights [from, to], in increasing order of height. The missing ones
+// are skipped. At most limit records are returned if limit is positive.
+func (s *BlockMetaStore) Range(from, to int64, limit int) []*BlockMeta {
+	res := make([]*BlockMeta, 0, 16)
+	for h := from; h <= to && (limit <= 0 || len(res) < limit); h++ {
+		if m, ok := s.Get(h); ok {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// Returns at most n BlockMetas before and including the latest height, in decreasing order of height
+func (s *BlockMetaStore) Latest(n int) []*BlockMeta {
+	latest, ok := s.LatestHeight()
+	res := make([]*BlockMeta, 0, n)
+	for h := latest; ok && h >= 0 && len(res) < n; h-- {
+		if m, found := s.Get(h); found {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+func (exec *txEngine) recordBlockMeta() {
+	blk := exec.currentBlock
+	m := &BlockMeta{
+		Height:    blk.Number,
+		Timestamp: blk.Timestamp,
+		Hash:      blk.Hash,
+		Proposer:  blk.Coinbase,
+		TxCount:   uint32(len(exec.committedTxs)),
+		GasUsed:   exec.cumulativeGasUsed,
+		GasFee:    *exec.cumulativeGasFee,
+		FeeRefund: *exec.cumulativeFeeRefund,
+
+		OrderingAlgorithm: exec.preparedOrdering,
+	}
+	if exec.gasTarget != 0 {
+		m.BaseFee = *exec.NextBaseFee() // the base fee of this block, before recordGasUsage
+	}
+	for _, tx := range exec.committedTxs {
+		if tx.Status != gethtypes.ReceiptStatusSuccessful {
+			m.FailedTxCount++
+		}
+		m.LogCount += uint32(len(tx.Logs))
+		m.DataSize += uint64(len(tx.Input))
+	}
+	exec.blockMetaStore.Put(m)
+}
@@ -0,0 +1,101 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+type memKVStore map[string][]byte
+
+func (m memKVStore) Get(key []byte) []byte {
+	return m[string(key)]
+}
+
+func (m memKVStore) Set(key, value []byte) {
+	m[string(key)] = value
+}
+
+func TestBlockMetaBytes(t *testing.T) {
+	m := &BlockMeta{
+		Height:        7,
+		Timestamp:     1234,
+		Hash:          [32]byte{1},
+		Proposer:      [20]byte{2},
+		TxCount:       3,
+		FailedTxCount: 1,
+		LogCount:      5,
+		DataSize:      100,
+		GasUsed:       63000,
+		GasFee:        *uint256.NewInt(63000),
+		FeeRefund:     *uint256.NewInt(7),
+		BaseFee:       *uint256.NewInt(10),
+
+		OrderingAlgorithm: OrderingSeededHashV2,
+	}
+	var m2 BlockMeta
+	require.True(t, m2.FromBytes(m.ToBytes()))
+	require.Equal(t, *m, m2)
+	require.False(t, m2.FromBytes(nil))
+
+	// a record written before OrderingAlgorithm was added
+	require.True(t, m2.FromBytes(m.ToBytes()[:blockMetaV1Len]))
+	require.Equal(t, OrderingAlgorithm(0), m2.OrderingAlgorithm)
+	require.Equal(t, m.BaseFee, m2.BaseFee)
+}
+
+func TestBlockMetaStore(t *testing.T) {
+	s := NewBlockMetaStore(memKVStore{})
+	_, ok := s.LatestHeight()
+	require.False(t, ok)
+	require.Equal(t, 0, len(s.Latest(3)))
+	for _, h := range []int64{1, 2, 4, 5} {
+		s.Put(&BlockMeta{Height: h, TxCount: uint32(h)})
+	}
+	latest, ok := s.LatestHeight()
+	require.True(t, ok)
+	require.Equal(t, int64(5), latest)
+	_, ok = s.Get(3)
+	require.False(t, ok)
+
+	metas := s.Range(2, 5, 0)
+	require.Equal(t, 3, len(metas))
+	require.Equal(t, uint32(4), metas[1].TxCount)
+	require.Equal(t, 2, len(s.Range(1, 5, 2)))
+	metas = s.Latest(3)
+	require.Equal(t, 3, len(metas))
+	require.Equal(t, int64(5), metas[0].Height)
+	require.Equal(t, int64(2), metas[2].Height)
+}
+
+func TestBlockMetaInExecute(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	s := NewBlockMetaStore(memKVStore{})
+	e.SetBlockMetaStore(s)
+	e.SetContext(prepareCtx(trunk))
+	txs := prepareAccAndTx(e)
+	e.SetContext(prepareCtx(trunk))
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 1, Timestamp: 1000, Coinbase: [20]byte{9}})
+	m, ok := s.Get(1)
+	require.True(t, ok)
+	require.Equal(t, int64(1000), m.Timestamp)
+	require.Equal(t, [20]byte{9}, m.Proposer)
+	require.Equal(t, uint32(2), m.TxCount)
+	require.Equal(t, uint32(0), m.FailedTxCount)
+	require.Equal(t, uint64(2*21000), m.GasUsed)
+	require.True(t, m.BaseFee.IsZero())
+	require.Equal(t, OrderingShuffleV1, m.OrderingAlgorithm)
+}
@@ -33,7 +33,8 @@ extern void get_value(int handler,
                       size_t* size);
 extern evmc_bytes32 get_block_hash(int handler, uint64_t num);
 extern void collect_result(int handler, struct all_changed* result, struct evmc_result* ret_value);
-extern void call_precompiled_contract (struct evmc_address* contract_addr,
+extern void call_precompiled_contract (int handler,
+                                       struct evmc_address* contract_addr,
                                        void* input_ptr,
                                        int input_size,
                                        uint64_t* gas_left,
@@ -41,6 +42,22 @@ extern void call_precompiled_contract (struct evmc_address* contract_addr,
                                        int* out_of_gas,
                                        struct small_buffer* output_ptr,
                                        int* output_size);
+extern void call_native_module(int handler,
+                               void* txctrl,
+                               struct evmc_address* module_addr,
+                               struct evmc_address* caller,
+                               struct evmc_bytes32* value,
+                               bool is_static,
+                               void* input_ptr,
+                               int input_size,
+                               uint64_t* gas_left,
+                               int* ret_value,
+                               int* out_of_gas,
+                               struct small_buffer* output_ptr,
+                               int* output_size);
+extern uint64_t get_storage_quota(int handler, uint64_t acc_sequence);
+extern void trace_step(int handler, struct trace_step* step);
+extern void trace_end(int handler, int32_t depth, enum evmc_status_code status_code, int64_t gas_left);
 
 int64_t zero_depth_call_wrap(evmc_bytes32 gas_price,
                              int64_t gas_limit,
@@ -49,11 +66,14 @@ int64_t zero_depth_call_wrap(evmc_bytes32 gas_price,
                              const evmc_bytes32* value,
                              const uint8_t* input_data,
                              size_t input_size,
+                             const struct access_list_entry* access_list,
+                             size_t access_list_size,
                              const struct block_info* block,
                              int collector_handler,
                              bool need_gas_estimation,
                              enum evmc_revision revision,
-		             bridge_query_executor_fn query_executor_fn) {
+		             bridge_query_executor_fn query_executor_fn,
+                             bool need_trace) {
        return zero_depth_call(gas_price,
                              gas_limit,
                              destination,
@@ -61,6 +81,8 @@ int64_t zero_depth_call_wrap(evmc_bytes32 gas_price,
                              value,
                              input_data,
                              input_size,
+                             access_list,
+                             access_list_size,
                              block,
                              collector_handler,
                              need_gas_estimation,
@@ -72,7 +94,11 @@ int64_t zero_depth_call_wrap(evmc_bytes32 gas_price,
                              get_value,
                              get_block_hash,
                              collect_result,
-                             call_precompiled_contract);
+                             call_precompiled_contract,
+                             call_native_module,
+                             get_storage_quota,
+                             need_trace ? trace_step : NULL,
+                             need_trace ? trace_end : NULL);
 }
 
 bridge_query_executor_fn load_func_from_dl(_GoString_ path, int* status) {
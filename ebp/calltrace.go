@@ -0,0 +1,154 @@
+package ebp
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// The tracer generating the tree of call frames, whose output is the same as geth's callTracer
+const CallTracer = "callTracer"
+
+func init() {
+	RegisterTxTracer(CallTracer, callTracer)
+}
+
+type CallTracerConfig struct {
+	OnlyTopCall bool `json:"onlyTopCall"` // if true, the sub frames are not included
+}
+
+// CallFrame is a CALL, STATICCALL, DELEGATECALL, CALLCODE, CREATE or CREATE2 frame. For CREATE and CREATE2,
+// To is the created contract, which is nil if the creation fails. Value is nil for STATICCALL and
+// DELEGATECALL, which cannot transfer value.
+type CallFrame struct {
+	Type    string          `json:"type"`
+	From    common.Address  `json:"from"`
+	To      *common.Address `json:"to,omitempty"`
+	Value   *hexutil.Big    `json:"value,omitempty"`
+	Gas     hexutil.Uint64  `json:"gas"`
+	GasUsed hexutil.Uint64  `json:"gasUsed"`
+	Input   hexutil.Bytes   `json:"input"`
+	Output  hexutil.Bytes   `json:"output,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Calls   []*CallFrame    `json:"calls,omitempty"`
+}
+
+// Returns the outermost frame, whose gas and gasUsed are the ones of the tx, including the intrinsic gas.
+func callTracer(runner *TxRunner, _ *TraceTxContext, config json.RawMessage) (interface{}, error) {
+	var cfg CallTracerConfig
+	if len(config) != 0 {
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	var top *CallFrame
+	stack := make([]*CallFrame, 0, 8)
+	err := replayCallFrames(runner.InternalTxCalls, runner.InternalTxReturns,
+		func(call *types.InternalTxCall) error {
+			frame := newCallFrame(call)
+			if len(stack) == 0 {
+				top = frame
+			} else if !cfg.OnlyTopCall {
+				parent := stack[len(stack)-1]
+				parent.Calls = append(parent.Calls, frame)
+			}
+			stack = append(stack, frame)
+			return nil
+		},
+		func(call *types.InternalTxCall, ret *types.InternalTxReturn) error {
+			stack[len(stack)-1].setResult(call, ret)
+			stack = stack[:len(stack)-1]
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	if top == nil { // the tx did not enter EVM, such as a call to a predefined contract
+		top = newTxCallFrame(runner)
+	}
+	top.Gas = hexutil.Uint64(runner.Tx.Gas)
+	top.GasUsed = hexutil.Uint64(runner.GasUsed)
+	return top, nil
+}
+
+func newCallFrame(call *types.InternalTxCall) *CallFrame {
+	frame := &CallFrame{
+		Type:  callKindName(call),
+		From:  call.Sender,
+		Gas:   hexutil.Uint64(call.Gas),
+		Input: call.Input,
+	}
+	if frame.Type != "CREATE" && frame.Type != "CREATE2" {
+		to := common.Address(call.Destination)
+		frame.To = &to
+	}
+	if frame.Type != "STATICCALL" && frame.Type != "DELEGATECALL" {
+		frame.Value = (*hexutil.Big)(new(big.Int).SetBytes(call.Value[:]))
+	}
+	return frame
+}
+
+func newTxCallFrame(runner *TxRunner) *CallFrame {
+	tx := runner.Tx
+	frame := &CallFrame{
+		Type:   "CALL",
+		From:   tx.From,
+		Value:  (*hexutil.Big)(new(big.Int).SetBytes(tx.Value[:])),
+		Input:  tx.Data,
+		Output: runner.OutData,
+	}
+	to := tx.To
+	if to == (common.Address{}) {
+		frame.Type, to = "CREATE", runner.CreatedContractAddress
+	}
+	frame.To = &to
+	if StatusIsFailure(runner.Status) {
+		frame.Error = callFrameError(runner.Status)
+	}
+	return frame
+}
+
+func (frame *CallFrame) setResult(call *types.InternalTxCall, ret *types.InternalTxReturn) {
+	frame.GasUsed = hexutil.Uint64(call.Gas - ret.GasLeft)
+	if !StatusIsFailure(ret.StatusCode) {
+		frame.Output = ret.Output
+		if frame.Type == "CREATE" || frame.Type == "CREATE2" {
+			to := common.Address(ret.CreateAddress)
+			frame.To = &to
+		}
+		return
+	}
+	frame.Error = callFrameError(ret.StatusCode)
+	if StatusIsRevert(ret.StatusCode) { // only the output of REVERT is kept, as the revert reason
+		frame.Output = ret.Output
+	}
+}
+
+// Use the error messages of geth for the common failures
+func callFrameError(status int) string {
+	switch StatusToStr(status) {
+	case "revert":
+		return "execution reverted"
+	case "out-of-gas":
+		return "out of gas"
+	case "invalid-instruction", "undefined-instruction":
+		return "invalid opcode"
+	case "bad-jump-destination":
+		return "invalid jump destination"
+	case "stack-overflow":
+		return "stack limit reached"
+	case "stack-underflow":
+		return "stack underflow"
+	case "static-mode-violation":
+		return "write protection"
+	case "call-depth-exceeded":
+		return "max call depth exceeded"
+	case "insufficient-balance":
+		return "insufficient balance for transfer"
+	}
+	return StatusToStr(status)
+}
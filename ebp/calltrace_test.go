@@ -0,0 +1,73 @@
+package ebp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestCallTracer(t *testing.T) {
+	// the tx calls 1, which creates 2 and then delegate-calls 3, which reverts
+	runner := &TxRunner{
+		Tx:      &types.TxToRun{BasicTx: types.BasicTx{Gas: 1100}},
+		GasUsed: 1050,
+		InternalTxCalls: []types.InternalTxCall{
+			{Depth: 0, Gas: 1000, Sender: [20]byte{9}, Destination: [20]byte{1}, Value: [32]byte{31: 5}},
+			{Kind: 3, Depth: 1, Gas: 500, Sender: [20]byte{1}, Input: []byte{0x60}},
+			{Kind: 1, Depth: 1, Gas: 300, Sender: [20]byte{1}, Destination: [20]byte{3}},
+		},
+		InternalTxReturns: []types.InternalTxReturn{
+			{GasLeft: 400, Output: []byte{0xfe}, CreateAddress: [20]byte{2}},
+			{StatusCode: 2, GasLeft: 100, Output: []byte{0xaa}}, // EVMC_REVERT
+			{GasLeft: 10, Output: []byte{1}},
+		},
+	}
+	res, err := callTracer(runner, &TraceTxContext{}, nil)
+	require.NoError(t, err)
+	top := res.(*CallFrame)
+	require.Equal(t, "CALL", top.Type)
+	require.Equal(t, uint64(1100), uint64(top.Gas))
+	require.Equal(t, uint64(1050), uint64(top.GasUsed))
+	require.Equal(t, uint64(5), top.Value.ToInt().Uint64())
+	require.Equal(t, 2, len(top.Calls))
+
+	bz, err := json.Marshal(top.Calls[0])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":"CREATE","from":"0x0100000000000000000000000000000000000000",
+		"to":"0x0200000000000000000000000000000000000000","value":"0x0","gas":"0x1f4","gasUsed":"0x64",
+		"input":"0x60","output":"0xfe"}`, string(bz))
+	require.Equal(t, "DELEGATECALL", top.Calls[1].Type)
+	require.Nil(t, top.Calls[1].Value)
+	require.Equal(t, "execution reverted", top.Calls[1].Error)
+	require.Equal(t, []byte{0xaa}, []byte(top.Calls[1].Output))
+
+	res, err = callTracer(runner, &TraceTxContext{}, []byte(`{"onlyTopCall":true}`))
+	require.NoError(t, err)
+	require.Empty(t, res.(*CallFrame).Calls)
+}
+
+func TestTraceTransactionWithCallTracer(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+	backend := &testTraceBackend{
+		trunk: trunk,
+		txs:   []*types.Transaction{newTransferTx(common.Hash{1}, 0, 100)},
+	}
+	res, err := TraceTransaction(backend, common.Hash{1}, &TraceConfig{Tracer: CallTracer})
+	require.NoError(t, err)
+	top := res.(*CallFrame)
+	require.Equal(t, "CALL", top.Type)
+	require.Equal(t, to1, *top.To)
+	require.Equal(t, uint64(100), top.Value.ToInt().Uint64())
+	require.Equal(t, uint64(100000), uint64(top.Gas))
+	require.Empty(t, top.Error)
+}
@@ -0,0 +1,186 @@
+package ebp
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"sync"
+
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+const SecondsPerDay = 24 * 3600
+
+// hyperLogLog estimates the number of distinct items with 2^hllPrecision one-byte registers.
+// The standard error is about 1.04/sqrt(2^hllPrecision), i.e. 1.6%.
+const hllPrecision = 12
+
+type hyperLogLog [1 << hllPrecision]uint8
+
+func (h *hyperLogLog) add(data []byte) {
+	sum := sha256.Sum256(data)
+	x := binary.BigEndian.Uint64(sum[:8])
+	idx := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h[idx] {
+		h[idx] = rank
+	}
+}
+
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	for i, r := range other {
+		if r > h[i] {
+			h[i] = r
+		}
+	}
+}
+
+func (h *hyperLogLog) count() uint64 {
+	const m = float64(len(h))
+	sum, zeros := 0.0, 0
+	for _, r := range h {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros != 0 { // linear counting for the small cardinalities
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// DailyStats aggregates the blocks executed in a UTC day
+type DailyStats struct {
+	Day           int64 // timestamp / SecondsPerDay
+	BlockCount    uint64
+	TxCount       uint64
+	FailedTxCount uint64
+	GasUsed       uint64
+	GasFee        uint256.Int // the fees collected from the TXs
+	senders       hyperLogLog
+}
+
+// The estimated number of the distinct senders of the TXs in this day
+func (s *DailyStats) ActiveSenders() uint64 {
+	return s.senders.count()
+}
+
+const dailyStatsLen = 8*6 + 32 + len(hyperLogLog{})
+
+func (s *DailyStats) ToBytes() []byte {
+	bz := make([]byte, dailyStatsLen)
+	binary.BigEndian.PutUint64(bz[0:8], uint64(s.Day))
+	binary.BigEndian.PutUint64(bz[8:16], s.BlockCount)
+	binary.BigEndian.PutUint64(bz[16:24], s.TxCount)
+	binary.BigEndian.PutUint64(bz[24:32], s.FailedTxCount)
+	binary.BigEndian.PutUint64(bz[32:40], s.GasUsed)
+	s.GasFee.WriteToSlice(bz[48:80]) // bz[40:48] is reserved
+	copy(bz[80:], s.senders[:])
+	return bz
+}
+
+// Returns false if bz is not a valid encoding
+func (s *DailyStats) FromBytes(bz []byte) bool {
+	if len(bz) != dailyStatsLen {
+		return false
+	}
+	s.Day = int64(binary.BigEndian.Uint64(bz[0:8]))
+	s.BlockCount = binary.BigEndian.Uint64(bz[8:16])
+	s.TxCount = binary.BigEndian.Uint64(bz[16:24])
+	s.FailedTxCount = binary.BigEndian.Uint64(bz[24:32])
+	s.GasUsed = binary.BigEndian.Uint64(bz[32:40])
+	s.GasFee.SetBytes32(bz[48:80])
+	copy(s.senders[:], bz[80:])
+	return true
+}
+
+// ChainStats keeps a DailyStats for each day in a KVStore, which is updated after each block is executed
+type ChainStats struct {
+	mtx sync.Mutex
+	db  KVStore
+}
+
+func NewChainStats(db KVStore) *ChainStats {
+	return &ChainStats{db: db}
+}
+
+func dailyStatsKey(day int64) []byte {
+	bz := make([]byte, 3+8)
+	copy(bz, "cs-")
+	binary.BigEndian.PutUint64(bz[3:], uint64(day))
+	return bz
+}
+
+// Add the TXs committed in a block, whose timestamp decides the day
+func (cs *ChainStats) AddBlock(timestamp int64, txs []*types.Transaction) {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	day := timestamp / SecondsPerDay
+	s, ok := cs.daily(day)
+	if !ok {
+		s = &DailyStats{Day: day}
+	}
+	s.BlockCount++
+	var fee uint256.Int
+	for _, tx := range txs {
+		s.TxCount++
+		if tx.Status != gethtypes.ReceiptStatusSuccessful {
+			s.FailedTxCount++
+		}
+		s.GasUsed += tx.GasUsed
+		fee.SetBytes32(tx.GasPrice[:])
+		if fee.GtUint64(MaxGasPrice) { // as in GetGasFee
+			fee.SetUint64(MaxGasPrice)
+		}
+		fee.Mul(&fee, uint256.NewInt(tx.GasUsed))
+		s.GasFee.Add(&s.GasFee, &fee)
+		s.senders.add(tx.From[:])
+	}
+	cs.db.Set(dailyStatsKey(day), s.ToBytes())
+}
+
+func (cs *ChainStats) daily(day int64) (*DailyStats, bool) {
+	s := &DailyStats{}
+	if !s.FromBytes(cs.db.Get(dailyStatsKey(day))) {
+		return nil, false
+	}
+	return s, true
+}
+
+func (cs *ChainStats) Daily(day int64) (*DailyStats, bool) {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	return cs.daily(day)
+}
+
+// Returns the DailyStats of the days in [fromDay, toDay] which have blocks, in increasing order of day
+func (cs *ChainStats) DailyRange(fromDay, toDay int64) []*DailyStats {
+	cs.mtx.Lock()
+	defer cs.mtx.Unlock()
+	res := make([]*DailyStats, 0, 16)
+	for day := fromDay; day <= toDay; day++ {
+		if s, ok := cs.daily(day); ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// The estimated number of the distinct senders in the days [fromDay, toDay]
+func (cs *ChainStats) ActiveSenders(fromDay, toDay int64) uint64 {
+	var senders hyperLogLog
+	for _, s := range cs.DailyRange(fromDay, toDay) {
+		senders.merge(&s.senders)
+	}
+	return senders.count()
+}
+
+func (exec *txEngine) recordChainStats() {
+	exec.chainStats.AddBlock(exec.currentBlock.Timestamp, exec.committedTxs)
+}
@@ -0,0 +1,77 @@
+package ebp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	var h hyperLogLog
+	require.Equal(t, uint64(0), h.count())
+	for _, n := range []int{100, 10000, 100000} {
+		h = hyperLogLog{}
+		for i := 0; i < n; i++ {
+			var bz [8]byte
+			binary.BigEndian.PutUint64(bz[:], uint64(i))
+			h.add(bz[:])
+			h.add(bz[:]) // duplicated
+		}
+		require.InDelta(t, n, h.count(), float64(n)*0.05)
+	}
+}
+
+func TestChainStats(t *testing.T) {
+	cs := NewChainStats(memKVStore{})
+	tx := func(from byte, status uint64) *types.Transaction {
+		return &types.Transaction{From: common.Address{from}, GasUsed: 21000, GasPrice: [32]byte{31: 2}, Status: status}
+	}
+	cs.AddBlock(10, []*types.Transaction{tx(1, gethtypes.ReceiptStatusSuccessful), tx(2, gethtypes.ReceiptStatusFailed)})
+	cs.AddBlock(20, []*types.Transaction{tx(1, gethtypes.ReceiptStatusSuccessful)})
+	cs.AddBlock(SecondsPerDay+5, []*types.Transaction{tx(3, gethtypes.ReceiptStatusSuccessful)})
+	cs.AddBlock(3*SecondsPerDay, nil)
+
+	s, ok := cs.Daily(0)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), s.BlockCount)
+	require.Equal(t, uint64(3), s.TxCount)
+	require.Equal(t, uint64(1), s.FailedTxCount)
+	require.Equal(t, uint64(3*21000), s.GasUsed)
+	require.Equal(t, uint64(3*21000*2), s.GasFee.Uint64())
+	require.Equal(t, uint64(2), s.ActiveSenders())
+	_, ok = cs.Daily(2)
+	require.False(t, ok)
+
+	require.Equal(t, 3, len(cs.DailyRange(0, 3)))
+	require.Equal(t, uint64(3), cs.ActiveSenders(0, 1))
+	require.Equal(t, uint64(0), cs.ActiveSenders(3, 3))
+}
+
+func TestChainStatsInExecute(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	cs := NewChainStats(memKVStore{})
+	e.SetChainStats(cs)
+	e.SetContext(prepareCtx(trunk))
+	txs := prepareAccAndTx(e)
+	e.SetContext(prepareCtx(trunk))
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 1, Timestamp: 2 * SecondsPerDay})
+	s, ok := cs.Daily(2)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), s.TxCount)
+	require.Equal(t, uint64(2), s.ActiveSenders())
+}
@@ -0,0 +1,126 @@
+package ebp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// CodePattern is a byte sequence found in the runtime bytecode of a known malicious contract template
+type CodePattern struct {
+	Tag   string
+	bytes []byte
+	wild  []bool // the bytes which match any value
+}
+
+// Parse a pattern in hex, where "??" matches any byte, such as "6080604052??35"
+func ParseCodePattern(tag, pattern string) (*CodePattern, error) {
+	pattern = strings.TrimPrefix(pattern, "0x")
+	if len(pattern) == 0 || len(pattern)%2 != 0 {
+		return nil, fmt.Errorf("invalid length of pattern %q", pattern)
+	}
+	p := &CodePattern{Tag: tag, bytes: make([]byte, len(pattern)/2), wild: make([]bool, len(pattern)/2)}
+	for i := range p.bytes {
+		s := pattern[2*i : 2*i+2]
+		if s == "??" {
+			p.wild[i] = true
+			continue
+		}
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		p.bytes[i] = b[0]
+	}
+	return p, nil
+}
+
+func (p *CodePattern) MatchedBy(code []byte) bool {
+	for start := 0; start+len(p.bytes) <= len(code); start++ {
+		i := 0
+		for ; i < len(p.bytes); i++ {
+			if !p.wild[i] && code[start+i] != p.bytes[i] {
+				break
+			}
+		}
+		if i == len(p.bytes) {
+			return true
+		}
+	}
+	return false
+}
+
+// CodeScanner tags the contracts created in each block, whose runtime bytecode matches the patterns. The tags
+// are kept in an off-chain store for explorers and wallets, and the contracts still work as usual.
+type CodeScanner struct {
+	patterns []*CodePattern
+	db       KVStore
+}
+
+func NewCodeScanner(db KVStore, patterns []*CodePattern) *CodeScanner {
+	return &CodeScanner{patterns: patterns, db: db}
+}
+
+func codeTagsKey(addr common.Address) []byte {
+	return append([]byte("ct-"), addr[:]...)
+}
+
+// Returns the tags of the patterns which code matches
+func (s *CodeScanner) Scan(code []byte) []string {
+	var tags []string
+	for _, p := range s.patterns {
+		if p.MatchedBy(code) {
+			tags = append(tags, p.Tag)
+		}
+	}
+	return tags
+}
+
+// Returns the tags of the contract at addr, or nil if it matches no pattern
+func (s *CodeScanner) Tags(addr common.Address) []string {
+	var tags []string
+	if bz := s.db.Get(codeTagsKey(addr)); len(bz) != 0 {
+		_ = json.Unmarshal(bz, &tags)
+	}
+	return tags
+}
+
+// Returns the contracts created by txs, including the ones created by contracts
+func createdContracts(txs []*types.Transaction) []common.Address {
+	var addrs []common.Address
+	for _, tx := range txs {
+		if tx.ContractAddress != (common.Address{}) {
+			addrs = append(addrs, tx.ContractAddress)
+		}
+		for _, ret := range tx.InternalTxReturns {
+			if ret.CreateAddress != [20]byte{} && ret.CreateAddress != tx.ContractAddress {
+				addrs = append(addrs, ret.CreateAddress)
+			}
+		}
+	}
+	return addrs
+}
+
+func (exec *txEngine) scanCreatedContracts() {
+	addrs := createdContracts(exec.committedTxs)
+	if len(addrs) == 0 {
+		return
+	}
+	ctx := exec.cleanCtx.WithRbtCopy()
+	defer ctx.Close(false)
+	for _, addr := range addrs {
+		code := ctx.GetCode(addr)
+		if code == nil {
+			continue // the creation was reverted
+		}
+		if tags := exec.codeScanner.Scan(code.BytecodeSlice()); len(tags) != 0 {
+			bz, _ := json.Marshal(tags)
+			exec.codeScanner.db.Set(codeTagsKey(addr), bz)
+		}
+	}
+}
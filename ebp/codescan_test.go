@@ -0,0 +1,62 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartbch/moeingads/store"
+	"github.com/smartbch/moeingads/store/rabbit"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestCodePattern(t *testing.T) {
+	p, err := ParseCodePattern("rug", "0x60??52")
+	require.NoError(t, err)
+	require.True(t, p.MatchedBy([]byte{0x00, 0x60, 0x80, 0x52}))
+	require.True(t, p.MatchedBy([]byte{0x60, 0x00, 0x52}))
+	require.False(t, p.MatchedBy([]byte{0x60, 0x80, 0x53}))
+	require.False(t, p.MatchedBy([]byte{0x60, 0x80}))
+	for _, bad := range []string{"", "6", "60zz", "0x"} {
+		_, err = ParseCodePattern("bad", bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestScanCreatedContracts(t *testing.T) {
+	trunk := store.NewMockRootStore().GetTrunkStore(100).(*store.TrunkStore)
+	newCtx := func() *types.Context {
+		rbt := rabbit.NewRabbitStore(trunk)
+		return types.NewContext(&rbt, nil)
+	}
+	ctx := newCtx()
+	bad, good, inner, reverted := common.Address{1}, common.Address{2}, common.Address{3}, common.Address{4}
+	setCode := func(addr common.Address, code []byte) {
+		ctx.Rbt.Set(types.GetBytecodeKey(addr), append(make([]byte, 33), code...))
+	}
+	setCode(bad, []byte{0x60, 0x80, 0xff})
+	setCode(good, []byte{0x60, 0x80, 0x52})
+	setCode(inner, []byte{0xff})
+	ctx.Close(true)
+
+	p1, _ := ParseCodePattern("selfdestruct", "ff")
+	p2, _ := ParseCodePattern("template", "6080ff")
+	db := memKVStore{}
+	s := NewCodeScanner(db, []*CodePattern{p1, p2})
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetCodeScanner(s)
+	e.SetContext(newCtx())
+	e.committedTxs = []*types.Transaction{
+		{ContractAddress: bad},
+		{ContractAddress: good},
+		{InternalTxReturns: []types.InternalTxReturn{{CreateAddress: inner}, {CreateAddress: reverted}}},
+	}
+	e.scanCreatedContracts()
+	require.Equal(t, []string{"selfdestruct", "template"}, s.Tags(bad))
+	require.Nil(t, s.Tags(good))
+	require.Equal(t, []string{"selfdestruct"}, s.Tags(inner))
+	require.Nil(t, s.Tags(reverted))
+}
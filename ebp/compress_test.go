@@ -0,0 +1,32 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestCompressStandbyTxs(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, _ := prepareEngine(trunk)
+	e.SetCompressThreshold(100)
+	data := make([]byte, 1000)
+	tx, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(1), data).WithSignature(e.signer, from1.Bytes())
+	e.CollectTx(tx)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	startKey, endKey := e.getStandbyQueueRange()
+	require.Equal(t, uint64(1), endKey-startKey)
+	bz := e.cleanCtx.Rbt.GetBaseStore().Get(types.GetStandbyTxKey(startKey))
+	require.Less(t, len(bz), len(data))
+	txsStandby, _ := e.loadStandbyTxs(&TxRange{start: startKey, end: endKey})
+	require.Equal(t, data, txsStandby[0].Data)
+	require.Equal(t, tx.Hash(), txsStandby[0].HashID)
+	e.cleanCtx.Close(false)
+}
@@ -0,0 +1,82 @@
+package ebp
+
+import (
+	"sort"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// retryTx is a tx which was not committed in a level of executeOneRoundWithRetries, to be run again in a
+// later level or requeued
+type retryTx struct {
+	tx  types.TxToRun
+	seq int // its position in the bundle loaded from the standby queue, which is the order of the TXs
+	// the seqs of the earlier TXs it depends on, which were not committed either. It does not run again until
+	// all of them are committed or requeued, because its result would be overwritten by them.
+	blockers []int
+}
+
+// Build the dependency DAG of the groups run in a level from their read/write lists: a group depends on an
+// earlier group if it reads or writes a key written by the earlier one. Only the edges between the groups
+// which are not committed are returned, in deps[g] for a failed group g, because the committed ones are
+// not run again. The result only depends on the lists and their order, so it is the same for all the nodes.
+func buildTxDAG(rwLists []rwList, failed []bool) (deps [][]int) {
+	deps = make([][]int, len(rwLists))
+	writers := make(map[uint64][]int) // key => the failed groups writing it, in ascending order
+	for g, rwList := range rwLists {
+		if !failed[g] {
+			continue
+		}
+		var seen map[int]struct{}
+		for _, l := range [2][]uint64{rwList.rList, rwList.wList} {
+			for _, k := range l {
+				for _, w := range writers[k] {
+					if seen == nil {
+						seen = make(map[int]struct{})
+					}
+					if _, ok := seen[w]; !ok {
+						seen[w] = struct{}{}
+						deps[g] = append(deps[g], w)
+					}
+				}
+			}
+		}
+		sort.Ints(deps[g])
+		for _, k := range rwList.wList {
+			writers[k] = append(writers[k], g)
+		}
+	}
+	return
+}
+
+// Split pending into the TXs to run in the next level, whose blockers are all resolved, and the ones still
+// waiting. A tx only gets blockers among the TXs run in the same level as it, which form a DAG, so some TXs
+// of a non-empty pending are always ready.
+func splitReadyTxs(pending []retryTx) (ready, waiting []retryTx) {
+	pendingSeqs := make(map[int]struct{}, len(pending))
+	for _, r := range pending {
+		pendingSeqs[r.seq] = struct{}{}
+	}
+	for _, r := range pending {
+		isReady := true
+		for _, seq := range r.blockers {
+			if _, ok := pendingSeqs[seq]; ok {
+				isReady = false
+				break
+			}
+		}
+		if isReady {
+			ready = append(ready, r)
+		} else {
+			waiting = append(waiting, r)
+		}
+	}
+	return
+}
+
+// Merge the TXs failed in a level into the waiting ones, in the order of their seqs
+func mergeRetryTxs(waiting, failed []retryTx) []retryTx {
+	merged := append(waiting, failed...)
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].seq < merged[j].seq })
+	return merged
+}
@@ -0,0 +1,119 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestTxEngine_Retries(t *testing.T) {
+	AdjustGasUsed = false
+	for _, c := range []struct {
+		retries    int
+		dag        bool
+		reexecuted int
+	}{
+		{3, false, 3 + 2 + 1}, // all the conflicting TXs are run again in each level
+		{3, true, 2 + 2 + 1},  // the TXs of from1 wait for its earlier ones, but the one of from2 does not
+		{1, true, 2},
+	} {
+		levels := c.retries + 1
+		trunk, root := prepareTruck()
+		e := NewEbpTxExec(1, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+		e.SetMaxRetries(c.retries)
+		e.SetDAGScheduling(c.dag)
+		e.SetContext(prepareCtx(trunk))
+		_ = prepareAccAndTx(e)
+		e.SetContext(prepareCtx(trunk))
+		// all of them pay from3, so each one conflicts with the former ones
+		for i, from := range []common.Address{from1, from1, from1, from2} {
+			nonce := uint64(i)
+			if from == from2 {
+				nonce = 0
+			}
+			tx, _ := gethtypes.NewTransaction(nonce, from3, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from.Bytes())
+			e.CollectTx(tx)
+		}
+		e.Prepare(0, 0, DefaultTxGasLimit)
+		e.SetContext(prepareCtx(trunk))
+		e.Execute(&types.BlockInfo{})
+		// one TX is committed in each level
+		require.Equal(t, levels, len(e.committedTxs))
+		for i, tx := range e.committedTxs {
+			require.Equal(t, int64(i), tx.TransactionIndex)
+			if i < 3 {
+				require.Equal(t, from1, common.Address(tx.From))
+				require.Equal(t, uint64(i), tx.Nonce)
+			}
+		}
+		e.SetContext(prepareCtx(trunk))
+		res := e.BlockResults()
+		require.Equal(t, c.reexecuted, res.Reexecuted)
+		require.Equal(t, 4-levels, res.Requeued)
+		require.Equal(t, uint64(10000_0000_0000+100*levels), e.cleanCtx.GetAccount(from3).Balance().Uint64())
+		e.cleanCtx.Close(false)
+		e.SetContext(prepareCtx(trunk))
+		require.Equal(t, 4-levels, e.StandbyQLen())
+		e.cleanCtx.Close(false)
+		closeTestCtx(root)
+	}
+}
+
+func TestBuildTxDAG(t *testing.T) {
+	rwLists := []rwList{
+		{wList: []uint64{1}},
+		{rList: []uint64{1}, wList: []uint64{2}},
+		{rList: []uint64{2}},
+		{rList: []uint64{2, 3}, wList: []uint64{4}},
+		{rList: []uint64{4}, wList: []uint64{2}},
+	}
+	// the first group is committed, so it is not a dependency any more
+	deps := buildTxDAG(rwLists, []bool{false, true, true, true, true})
+	require.Equal(t, [][]int{nil, nil, {1}, {1}, {1, 3}}, deps)
+
+	pending := []retryTx{{seq: 1}, {seq: 2, blockers: []int{1}}, {seq: 3, blockers: []int{0}}, {seq: 4, blockers: []int{1, 3}}}
+	ready, waiting := splitReadyTxs(pending)
+	require.Equal(t, []retryTx{pending[0], pending[2]}, ready)
+	require.Equal(t, []retryTx{pending[1], pending[3]}, waiting)
+	merged := mergeRetryTxs(waiting, []retryTx{{seq: 3, blockers: []int{2}}})
+	require.Equal(t, []int{2, 3, 4}, []int{merged[0].seq, merged[1].seq, merged[2].seq})
+}
+
+// The validators re-run the conflicting TXs in the same order, so they commit the same list of TXs
+func TestTxEngine_DAGSchedulingIsDeterministic(t *testing.T) {
+	AdjustGasUsed = false
+	var results [][]common.Hash
+	for i := 0; i < 2; i++ {
+		trunk, root := prepareTruck()
+		e := NewEbpTxExec(2, 100, 4, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+		e.SetMaxRetries(2)
+		e.SetDAGScheduling(true)
+		e.SetContext(prepareCtx(trunk))
+		_ = prepareAccAndTx(e)
+		e.SetContext(prepareCtx(trunk))
+		for j := 0; j < 20; j++ {
+			from, to := []common.Address{from1, from2}[j%2], []common.Address{to1, to2, from3}[j%3]
+			tx, _ := gethtypes.NewTransaction(uint64(j/2), to, big.NewInt(int64(j+1)), 100000, big.NewInt(1), nil).WithSignature(e.signer, from.Bytes())
+			e.CollectTx(tx)
+		}
+		e.Prepare(0, 0, DefaultTxGasLimit)
+		e.SetContext(prepareCtx(trunk))
+		e.Execute(&types.BlockInfo{})
+		hashes := make([]common.Hash, 0, len(e.committedTxs))
+		for _, tx := range e.committedTxs {
+			hashes = append(hashes, tx.Hash)
+		}
+		results = append(results, hashes)
+		e.cleanCtx.Close(false)
+		closeTestCtx(root)
+	}
+	require.NotEmpty(t, results[0])
+	require.Equal(t, results[0], results[1])
+}
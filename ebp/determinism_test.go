@@ -0,0 +1,103 @@
+package ebp
+
+import (
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/internal/detguard"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// the standby queue, the balances and the frontier must not depend on parallelNum and the speeds of goroutines
+func TestPrepareIsDeterministic(t *testing.T) {
+	type result struct {
+		queue    [][]byte
+		balances []*uint256.Int
+		frontier *frontier
+	}
+	senders := make([]common.Address, 12)
+	for i := range senders {
+		senders[i] = common.BigToAddress(big.NewInt(int64(0x100 + i)))
+	}
+	var results []result
+	for _, parallelNum := range []int{1, 1, 3, 3, 8, 8} {
+		trunk, root := prepareTruck()
+		e := NewEbpTxExec(5, 100, parallelNum, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+		e.SetContext(prepareCtx(trunk))
+		for _, sender := range senders[:10] { // the last two senders do not exist
+			acc := types.ZeroAccountInfo()
+			acc.UpdateBalance(uint256.NewInt(300_000))
+			e.cleanCtx.SetAccount(sender, acc)
+		}
+		e.cleanCtx.Close(true)
+		e.SetContext(prepareCtx(trunk))
+		for j := 0; j < 60; j++ {
+			from := senders[(j*7)%len(senders)]
+			nonce := uint64(j / len(senders))
+			if j%11 == 0 {
+				nonce += 3 // incorrect nonce
+			}
+			tx, _ := gethtypes.NewTransaction(nonce, to1, big.NewInt(int64(j+1)), 100000, big.NewInt(1), nil).WithSignature(e.signer, from.Bytes())
+			e.CollectTx(tx)
+		}
+		res := result{frontier: e.Prepare(7, 0, DefaultTxGasLimit).(*frontier)}
+		e.SetContext(prepareCtx(trunk))
+		start, end := e.getStandbyQueueRange()
+		for k := start; k < end; k++ {
+			res.queue = append(res.queue, e.cleanCtx.Rbt.GetBaseStore().Get(types.GetStandbyTxKey(k)))
+		}
+		for _, sender := range senders {
+			if acc := e.cleanCtx.GetAccount(sender); acc != nil {
+				res.balances = append(res.balances, acc.Balance())
+			} else {
+				res.balances = append(res.balances, nil)
+			}
+		}
+		res.balances = append(res.balances, GetSystemBalance(e.cleanCtx))
+		e.cleanCtx.Close(false)
+		closeTestCtx(root)
+		results = append(results, res)
+	}
+	require.NotEmpty(t, results[0].queue)
+	require.Less(t, len(results[0].queue), 60)
+	for _, res := range results[1:] {
+		require.Equal(t, results[0], res)
+	}
+}
+
+// Returns the names of the non-test Go files in dir, except the excluded ones
+func nonTestGoFiles(t *testing.T, dir string, excluded ...string) []string {
+	skipped := make(map[string]bool, len(excluded))
+	for _, name := range excluded {
+		skipped[name] = true
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	require.NoError(t, err)
+	var names []string
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if !strings.HasSuffix(name, "_test.go") && !skipped[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestNoClockInConsensusPaths(t *testing.T) {
+	// only the statistics and the replaying tool may read the clock
+	found, err := detguard.FindClockCalls(".", nonTestGoFiles(t, ".", "execstats.go", "replay.go"))
+	require.NoError(t, err)
+	require.Empty(t, found)
+	found, err = detguard.FindClockCalls("../types", nonTestGoFiles(t, "../types"))
+	require.NoError(t, err)
+	require.Empty(t, found)
+}
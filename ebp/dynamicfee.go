@@ -0,0 +1,63 @@
+package ebp
+
+import (
+	"github.com/holiman/uint256"
+
+	"github.com/smartbch/moeingevm/types"
+	"github.com/smartbch/moeingevm/utils"
+)
+
+// Set the effective gas price of a dynamic fee tx, which pays baseFee, or return the reason why it is
+// invalid. When the base fee is not used, baseFee is nil and the tx pays its fee cap as a legacy tx.
+func applyBaseFee(tx *types.TxToRun, baseFee *uint256.Int) string {
+	if !tx.IsDynamicFee() || baseFee == nil {
+		return ""
+	}
+	feeCap := utils.U256FromSlice32(tx.GasFeeCap[:])
+	tipCap := utils.U256FromSlice32(tx.GasTipCap[:])
+	if tipCap.Gt(feeCap) {
+		return "tip higher than fee cap"
+	}
+	if feeCap.Lt(baseFee) {
+		return "fee cap less than base fee"
+	}
+	price, overflow := tipCap.AddOverflow(tipCap, baseFee)
+	if overflow || price.Gt(feeCap) {
+		price = feeCap
+	}
+	tx.GasPrice = price.Bytes32()
+	tx.BaseFee = baseFee.Bytes32()
+	return ""
+}
+
+// The base fee of the TXs prepared now, or nil if the base fee is not used
+func (exec *txEngine) preparedBaseFee() *uint256.Int {
+	if exec.gasTarget == 0 {
+		return nil
+	}
+	return exec.NextBaseFee()
+}
+
+// Add the gas fee of runner to the cumulative ones. The base fee portion is burnt and the rest is the tip.
+func (exec *txEngine) addGasFee(runner *TxRunner) {
+	fee := runner.GetGasFee()
+	burnt := runner.GetBurntFee()
+	exec.cumulativeGasFee.Add(exec.cumulativeGasFee, fee.Sub(fee, burnt))
+	exec.cumulativeBurntFee.Add(exec.cumulativeBurntFee, burnt)
+}
+
+// The gas fees are added to the system account when the TXs are prepared. Move the burnt portion out of it,
+// such that only the tips are left.
+func (exec *txEngine) burnBaseFees() {
+	if exec.cumulativeBurntFee.IsZero() {
+		return
+	}
+	ctx := exec.cleanCtx.WithRbtCopy()
+	if err := SubSystemAccBalance(ctx, exec.cumulativeBurntFee); err != nil {
+		exec.logger.Error("Cannot burn base fees", "amount", exec.cumulativeBurntFee.String(), "err", err)
+		ctx.Close(false)
+		return
+	}
+	_ = updateBalance(ctx, blackHoleContractAddress, exec.cumulativeBurntFee, true)
+	ctx.Close(true)
+}
@@ -0,0 +1,98 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func dynamicFeeTxToRun(feeCap, tipCap uint64) *types.TxToRun {
+	tx := &types.TxToRun{Type: gethtypes.DynamicFeeTxType}
+	tx.GasPrice = uint256.NewInt(feeCap).Bytes32()
+	tx.GasFeeCap = uint256.NewInt(feeCap).Bytes32()
+	tx.GasTipCap = uint256.NewInt(tipCap).Bytes32()
+	return tx
+}
+
+func TestApplyBaseFee(t *testing.T) {
+	legacy := &types.TxToRun{}
+	legacy.GasPrice = uint256.NewInt(7).Bytes32()
+	require.Empty(t, applyBaseFee(legacy, uint256.NewInt(10)))
+	require.Equal(t, uint256.NewInt(7).Bytes32(), legacy.GasPrice)
+	require.Equal(t, [32]byte{}, legacy.BaseFee)
+
+	tx := dynamicFeeTxToRun(30, 5)
+	require.Empty(t, applyBaseFee(tx, uint256.NewInt(10)))
+	require.Equal(t, uint256.NewInt(15).Bytes32(), tx.GasPrice)
+	require.Equal(t, uint256.NewInt(10).Bytes32(), tx.BaseFee)
+	tx = dynamicFeeTxToRun(30, 25)
+	require.Empty(t, applyBaseFee(tx, uint256.NewInt(10)))
+	require.Equal(t, uint256.NewInt(30).Bytes32(), tx.GasPrice)
+
+	require.Equal(t, "fee cap less than base fee", applyBaseFee(dynamicFeeTxToRun(9, 1), uint256.NewInt(10)))
+	require.Equal(t, "fee cap less than base fee", applyBaseFee(dynamicFeeTxToRun(0, 0), uint256.NewInt(10)))
+	require.Equal(t, "tip higher than fee cap", applyBaseFee(dynamicFeeTxToRun(30, 31), uint256.NewInt(10)))
+
+	tx = dynamicFeeTxToRun(30, 5) // before the base fee is used
+	require.Empty(t, applyBaseFee(tx, nil))
+	require.Equal(t, uint256.NewInt(30).Bytes32(), tx.GasPrice)
+	require.Equal(t, [32]byte{}, tx.BaseFee)
+}
+
+func TestDynamicFeeTx(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetGasTarget(21000)
+	e.SetContext(prepareCtx(trunk))
+	acc := types.ZeroAccountInfo()
+	acc.UpdateBalance(uint256.NewInt(1e18))
+	e.cleanCtx.SetAccount(from1, acc)
+	e.cleanCtx.SetAccount(from2, acc)
+	e.cleanCtx.Close(true)
+
+	newTx := func(from common.Address, feeCap, tipCap int64) *gethtypes.Transaction {
+		tx, _ := gethtypes.NewTx(&gethtypes.DynamicFeeTx{
+			To:        &to1,
+			Value:     big.NewInt(100),
+			Gas:       100000,
+			GasFeeCap: big.NewInt(feeCap),
+			GasTipCap: big.NewInt(tipCap),
+		}).WithSignature(e.signer, from.Bytes())
+		return tx
+	}
+	e.SetContext(prepareCtx(trunk))
+	e.CollectTx(newTx(from1, 3e9, 1e9))
+	e.CollectTx(newTx(from2, 5e8, 1e8)) // cannot pay the base fee of 1e9
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, "fee cap less than base fee", e.committedTxs[0].StatusStr)
+
+	e.SetContext(prepareCtx(trunk))
+	blk := &types.BlockInfo{Number: 1}
+	e.Execute(blk)
+	require.Equal(t, [32]byte{}, blk.BaseFee) // the block of the caller is not changed
+	require.Equal(t, *uint256.NewInt(1e9), e.BlockResults().BaseFee)
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, uint256.NewInt(2e9).Bytes32(), e.committedTxs[0].GasPrice) // min(3e9, 1e9+1e9)
+	burnt := uint256.NewInt(21000 * 1e9)
+	_, _, gasFee := e.GasUsedInfo()
+	require.Equal(t, *burnt, gasFee) // the tip is the same as the base fee
+	require.Equal(t, *burnt, e.BlockResults().BurntFee)
+
+	ctx := prepareCtx(trunk)
+	require.Equal(t, burnt, GetBlackHoleBalance(ctx))
+	// the fee of the whole gas limit is added in Prepare, and the refund is left to the application
+	require.Equal(t, uint256.NewInt(100000*2e9-21000*1e9), GetSystemBalance(ctx))
+	require.Equal(t, uint256.NewInt(1e18-100-100000*2e9+(100000-21000)*2e9), ctx.GetAccount(from1).Balance())
+	ctx.Close(false)
+}
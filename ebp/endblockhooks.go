@@ -0,0 +1,71 @@
+package ebp
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// EndBlockHook is run by Execute after the TXs of each block, such as to distribute the fees or to run the
+// system TXs, which may write the same accounts as the other hooks. It runs on a sub-context made by
+// types.Context.RunScoped: if it returns an error or panics, all of its changes are discarded and the next
+// hook runs as if it were not registered. The failed hooks are recorded in BlockResults.
+type EndBlockHook func(ctx *types.Context, blk *types.BlockInfo) error
+
+type namedEndBlockHook struct {
+	name     string
+	priority int
+	hook     EndBlockHook
+}
+
+// RegisterEndBlockHook adds hook, which runs after the ones with smaller priorities. The hooks with the same
+// priority run in the order of their names, such that the order does not depend on the order of the
+// registrations. It panics if name is already registered. It must be called before Execute.
+func (exec *txEngine) RegisterEndBlockHook(name string, priority int, hook EndBlockHook) {
+	for _, h := range exec.endBlockHooks {
+		if h.name == name {
+			panic(fmt.Sprintf("end-block hook %s is already registered", name))
+		}
+	}
+	exec.endBlockHooks = append(exec.endBlockHooks, namedEndBlockHook{name: name, priority: priority, hook: hook})
+	sort.Slice(exec.endBlockHooks, func(i, j int) bool {
+		a, b := exec.endBlockHooks[i], exec.endBlockHooks[j]
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		return a.name < b.name
+	})
+}
+
+// Run the hooks one by one, each of them sees the changes committed by the former ones
+func (exec *txEngine) runEndBlockHooks() {
+	exec.failedHooks = nil
+	if len(exec.endBlockHooks) == 0 {
+		return
+	}
+	span := exec.startSpan(SpanEndBlockHooks)
+	defer span.End()
+	for _, h := range exec.endBlockHooks {
+		if err := exec.runEndBlockHookSafely(h); err != nil {
+			exec.logger.Error("End-block hook failed", "name", h.name, "height", exec.currentBlock.Number,
+				"err", err.Error())
+			exec.failedHooks = append(exec.failedHooks, h.name)
+		}
+	}
+	span.SetAttribute("hooks", int64(len(exec.endBlockHooks)))
+	span.SetAttribute("failed", int64(len(exec.failedHooks)))
+}
+
+func (exec *txEngine) runEndBlockHookSafely(h namedEndBlockHook) (err error) {
+	defer func() {
+		if r := recover(); r != nil { // the changes are already discarded by RunScoped
+			err = fmt.Errorf("panic: %v", r)
+			exec.logger.Error("Panic in end-block hook", "name", h.name, "stack", string(debug.Stack()))
+		}
+	}()
+	return exec.cleanCtx.RunScoped(func(ctx *types.Context) error {
+		return h.hook(ctx, exec.currentBlock)
+	})
+}
@@ -0,0 +1,65 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestEndBlockHooks(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+
+	var order []string
+	addBalance := func(ctx *types.Context, amount uint64) {
+		acc := ctx.GetAccount(from3)
+		acc.UpdateBalance(uint256.NewInt(0).Add(acc.Balance(), uint256.NewInt(amount)))
+		ctx.SetAccount(from3, acc)
+	}
+	e.RegisterEndBlockHook("b", 1, func(ctx *types.Context, blk *types.BlockInfo) error {
+		order = append(order, "b")
+		// the changes of the failed hook 'a' are not seen
+		require.Equal(t, uint256.NewInt(10000_0000_0000+1), ctx.GetAccount(from3).Balance())
+		addBalance(ctx, 2)
+		return nil
+	})
+	e.RegisterEndBlockHook("a", 1, func(ctx *types.Context, blk *types.BlockInfo) error {
+		order = append(order, "a")
+		addBalance(ctx, 100)
+		return errors.New("failed")
+	})
+	e.RegisterEndBlockHook("z", 0, func(ctx *types.Context, blk *types.BlockInfo) error {
+		order = append(order, "z")
+		require.Equal(t, int64(5), blk.Number)
+		addBalance(ctx, 1)
+		return nil
+	})
+	e.RegisterEndBlockHook("p", 2, func(ctx *types.Context, blk *types.BlockInfo) error {
+		order = append(order, "p")
+		addBalance(ctx, 1000)
+		panic("hook panicked")
+	})
+	require.Panics(t, func() {
+		e.RegisterEndBlockHook("a", 3, func(ctx *types.Context, blk *types.BlockInfo) error { return nil })
+	})
+
+	// the hooks also run in a block without TXs
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 5})
+	e.cleanCtx.Close(false)
+	require.Equal(t, []string{"z", "a", "b", "p"}, order)
+	require.Equal(t, []string{"a", "p"}, e.BlockResults().FailedHooks)
+
+	ctx := prepareCtx(trunk)
+	require.Equal(t, uint256.NewInt(10000_0000_0000+3), ctx.GetAccount(from3).Balance())
+	ctx.Close(false)
+}
@@ -2,21 +2,23 @@ package ebp
 
 import (
 	"encoding/binary"
-	"errors"
-	"sync"
+	"fmt"
+	"math"
+	"runtime/debug"
+	"sort"
 	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common"
 	gethtypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/holiman/uint256"
-	"github.com/seehuhn/mt19937"
 	"github.com/tendermint/tendermint/libs/log"
 
 	dt "github.com/smartbch/moeingads/datatree"
-	"github.com/smartbch/moeingads/store/rabbit"
 	storetypes "github.com/smartbch/moeingads/store/types"
 	modbtypes "github.com/smartbch/moeingdb/types"
 
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/internal/detguard"
 	"github.com/smartbch/moeingevm/types"
 	"github.com/smartbch/moeingevm/utils"
 )
@@ -37,48 +39,6 @@ type TxRange struct {
 	end   uint64
 }
 
-type rwList struct {
-	rList []uint64
-	wList []uint64
-}
-
-func newRWList() rwList {
-	return rwList{
-		rList: make([]uint64, 0, 32),
-		wList: make([]uint64, 0, 32),
-	}
-}
-
-func (rwl *rwList) reset() {
-	rwl.wList = rwl.wList[:0]
-	rwl.rList = rwl.rList[:0]
-}
-
-func (rwl *rwList) add(k uint64, isWrite bool) {
-	if isWrite {
-		rwl.wList = append(rwl.wList, k)
-	} else {
-		rwl.rList = append(rwl.rList, k)
-	}
-}
-
-func (rwl rwList) conflictsWith(touchedSet map[uint64]struct{}) bool {
-	for _, l := range [2][]uint64{rwl.rList, rwl.wList} {
-		for _, k := range l {
-			if _, ok := touchedSet[k]; ok {
-				return true
-			}
-		}
-	}
-	return false
-}
-
-func (rwl rwList) updateTouchedSet(touchedSet map[uint64]struct{}) {
-	for _, k := range rwl.wList {
-		touchedSet[k] = struct{}{}
-	}
-}
-
 type txEngine struct {
 	// How many parallel execution round are performed for each block
 	roundNum int //consensus parameter
@@ -90,24 +50,151 @@ type txEngine struct {
 	// txEngine will close it at the end of 'Prepare'
 	cleanCtx *types.Context
 	// CollectTx fills txList and 'Prepare' handles and clears txList
-	txList       []*gethtypes.Transaction
+	txList []*gethtypes.Transaction
+	// the indexes of the scheduled TXs in txList => the heights they are scheduled at
+	txNotBefore  map[int]uint64
 	committedTxs []*types.Transaction
+	// the index of the next log in the current block
+	nextLogIndex uint
 	// Used to check signatures
 	signer       gethtypes.Signer
 	currentBlock *types.BlockInfo
 
 	rwListMap        map[common.Hash]rwList
 	checkRWInLoading bool
+	// Let the runners abort early using the hints about the accounts written by former runners. The hints
+	// never change which TXs are committed, they only save the time spent on the TXs which will conflict.
+	earlyConflictHints bool //per-node parameter
+	// Run the TXs sharing a sender or a recipient one by one in the same runner
+	accountAffinity bool //consensus parameter
+	// Load at most one tx of a sender into the bundle of a round, unless accountAffinity is enabled
+	senderSharding bool //consensus parameter
+	// Defer the TXs whose senders have earlier TXs inserted back into the standby queue in this block
+	deferLaterNonces bool //consensus parameter
+	inFlight         inFlightNonces
+	// Charge the gas of the access lists declared by TXs and use them in scheduling
+	accessLists bool //consensus parameter
+	// Reject the TXs in Prepare if their senders' balances cannot cover both their values and gas fees
+	strictBalanceCheck bool //consensus parameter
+	// Drop the TXs in Prepare which are already queued or collected, and index the queued TXs by hashes
+	dropDuplicates bool //consensus parameter
+	// If it is not zero, a tx replaces the one waiting in the standby queue with the same sender and nonce,
+	// when its gas price is higher by at least replaceByFeeBump percent. Zero disables the replacement.
+	replaceByFeeBump uint64 //consensus parameter
+	// The max length of the standby queue, zero means no limit. The TXs with the lowest gas prices are evicted
+	// in Prepare to keep the queue within it.
+	maxQueueLen uint64 //consensus parameter
+	// The max count of the TXs a sender can have in the standby queue, zero means no limit. The excess ones
+	// are rejected in Prepare.
+	maxTxsPerSender uint64 //consensus parameter
+	// If it is not zero, a tx which has waited in the standby queue for more than queueTTL blocks is dropped
+	// when it is loaded. Zero means the TXs can wait forever.
+	queueTTL uint64 //consensus parameter
+	// If it is not zero, in each round, the TXs conflicting with the committed ones are run again on the
+	// updated state at most maxRetries times, instead of being inserted back into the standby queue at once.
+	maxRetries int //consensus parameter
+	// Only re-run the conflicting TXs whose blockers in the dependency DAG are resolved, which takes effect if
+	// maxRetries is not zero
+	dagScheduling bool //consensus parameter
+	// The max gas of the TXs loaded in a block, zero means no limit. A tx is not loaded if its gas limit exceeds
+	// the gas left, then it and the TXs after it are left in the standby queue for the next block.
+	blockGasLimit uint64          //consensus parameter
+	blockGasLeft  uint64          // the gas left for the TXs loaded in the rest rounds of the block
+	blockGasFull  bool            // a tx was left in the standby queue because of blockGasLimit
+	expiredTxs    []types.TxToRun // the TXs dropped by queueTTL in the current round
 
 	cumulativeGasUsed   uint64
 	cumulativeFeeRefund *uint256.Int
-	cumulativeGasFee    *uint256.Int
+	cumulativeGasFee    *uint256.Int // the tips, without the burnt base fees
+	cumulativeBurntFee  *uint256.Int
 
 	aotDir            string
 	aotReloadInterval int64
 
+	// the accounts touched by committed TXs are recorded into it, if it is not nil
+	hotAccounts *HotAccounts
+
+	// the recently queued and committed TXs, which are rejected by ValidateTx if it is not nil
+	recentHashes *RecentHashes
+	// the TXs executed in the current block, whose nonces are consumed
+	executedHashes []common.Hash
+
+	// the timestamps of the executed blocks are recorded into it, if it is not nil
+	timeIndex *BlockTimeIndex
+
+	// a BlockMeta of each executed block is written into it, if it is not nil
+	blockMetaStore *BlockMetaStore
+
+	// the daily statistics are updated after each block is executed, if it is not nil
+	chainStats *ChainStats
+
+	// the results of each executed block are cached into it, if it is not nil
+	blockCache *BlockCache
+
+	// the first and the last heights at which each account is touched by committed TXs, if it is not nil
+	watermarks *ActivityWatermarks
+
+	// the inactive accounts are archived after each block, if it is not nil
+	stateExpiry   *StateExpiry //consensus parameter
+	resurrections []resurrection
+	resurrected   []common.Address
+
+	// the max number of storage slots a contract may occupy, zero means no limit
+	maxStorageSlots uint64           //consensus parameter
+	quotaExempt     []common.Address //consensus parameter
+	storageQuota    *storageQuota    // resolved from the two fields above in each block
+
+	// it tags the contracts created in each block, if it is not nil
+	codeScanner *CodeScanner
+
+	// it is called with the invalid TXs found in Prepare, if it is not nil
+	misbehaviorHandler MisbehaviorHandler
+
+	orderingAlgorithm OrderingAlgorithm //consensus parameter
+	orderingForks     []OrderingFork    //consensus parameter, sorted by height
+	// the algorithm used by the last Prepare, which is recorded in the results of the next block
+	preparedOrdering OrderingAlgorithm
+	blockResults     BlockResults
+
+	nonceReservations nonceReservations
+	pendingNonces     pendingNonces
+
+	// the max encoded size of a tx, zero means no limit
+	maxTxSize uint64 //consensus parameter
+
+	// the max length of OutData recorded in the receipts, zero means no limit
+	maxOutDataSize uint64 //consensus parameter
+
+	// the TXs whose data are longer than it are compressed in standby queue, zero means no compression
+	compressThreshold int //consensus parameter
+
+	// it traces all the TXs run by the runners, if it is not nil
+	tracer Tracer
+
+	// it traces the phases of Prepare and Execute, if it is not nil
+	spanTracer SpanTracer
+	// it collects the statistics returned by Execute, and is nil outside Execute
+	execStats *execStatsCollector
+
+	// sorted by priorities and names
+	endBlockHooks []namedEndBlockHook //consensus parameter
+	failedHooks   []string            // the names of the hooks failed in the current block
+
+	// it limits the data in the records returned by CommittedTxsForMoDB and EachCommittedTx, if it is not nil
+	dataRetention *DataRetention
+
+	// the gas target of a block for the base fee, zero means the base fee is not used
+	gasTarget uint64 //consensus parameter
+
+	// it halts the node if the supply is not conserved in a block, if it is not nil
+	supplyChecker *supplyChecker
+
 	logger log.Logger
 
+	// the counts recorded in BlockResults
+	reexecutedCount int
+	requeuedCount   int
+
 	// for ut
 	txExecutedCount int
 }
@@ -121,14 +208,21 @@ type preparedInfo struct {
 	tx       *types.TxToRun
 	txBytes  []byte
 	errorStr string
+	// the tx in the standby queue replaced by tx, and its position
+	replaced   *types.TxToRun
+	replacePos uint64
+	// tx is not due in the next block, so it is inserted into the scheduled queue at scheduledPos
+	scheduled    bool
+	scheduledPos uint64
 }
 
 // Generated by parallelReadAccounts and Prepare will use them for some validations.
 type ctxAndAccounts struct {
 	ctx          *types.Context
-	accounts     []common.Address
+	accounts     []common.Address                //the senders owned by this entry, assigned by assignSenders
 	changed      bool                            //this ctx is changed so it must be written back
 	totalGasFee  *uint256.Int                    //the gas fees payed by the accounts
+	refundedFee  *uint256.Int                    //the gas fees of the replaced TXs, refunded to the accounts
 	addr2nonce   map[common.Address]uint64       //caches the latest nonce of accounts and won't write back to states
 	addr2Balance map[common.Address]*uint256.Int //caches latest balance
 }
@@ -221,6 +315,8 @@ func NewEbpTxExec(exeRoundCount, runnerNumber, parallelNum, defaultTxListCap int
 		committedTxs: make([]*types.Transaction, 0, defaultTxListCap),
 		signer:       s,
 		logger:       logger,
+
+		orderingAlgorithm: DefaultOrderingAlgorithm,
 	}
 }
 
@@ -228,34 +324,299 @@ func (exec *txEngine) SetCheckRWInLoading(b bool) {
 	exec.checkRWInLoading = b
 }
 
+func (exec *txEngine) SetEarlyConflictHints(b bool) {
+	exec.earlyConflictHints = b
+}
+
+func (exec *txEngine) SetAccountAffinity(b bool) {
+	exec.accountAffinity = b
+}
+
+// Guarantee that two TXs of a sender never run in parallel in one round: the later ones are left in the
+// standby queue for the next rounds. Without it, such TXs fail with TX_NONCE_TOO_LARGE or conflict with the
+// earlier one. With account affinity, they run one by one in the same runner instead, so it has no effects.
+func (exec *txEngine) SetSenderSharding(b bool) {
+	exec.senderSharding = b
+}
+
+// Keep the TXs of a sender in the order of nonces across rounds: a tx is not run until its sender's earlier
+// TXs which failed to commit or were skipped in former rounds are loaded again.
+func (exec *txEngine) SetDeferLaterNonces(b bool) {
+	exec.deferLaterNonces = b
+}
+
+// In Prepare, a tx is invalid if its sender's balance does not cover its gas fee and value, as well as the
+// values of the sender's former TXs in the same block. Without it, only the gas fee is checked, and the
+// underfunded TXs fail when they are executed, taking the slots of the runners.
+func (exec *txEngine) SetStrictBalanceCheck(b bool) {
+	exec.strictBalanceCheck = b
+}
+
+// A tx with the same sender and nonce as a tx waiting in the standby queue replaces it in Prepare, if its gas
+// price is higher by at least bumpPercent percent, and the gas fee of the replaced one is refunded. Otherwise
+// the stale one runs first and the new one fails for its nonce. Zero disables the replacement.
+func (exec *txEngine) SetReplaceByFee(bumpPercent uint64) {
+	exec.replaceByFeeBump = bumpPercent
+}
+
+// Cap the length of the standby queue. When Prepare would make it longer, the TXs with the lowest gas prices
+// are evicted, with their gas fees refunded, and they are reported in CommittedTxs as "evicted-from-queue".
+// Zero means no limit.
+func (exec *txEngine) SetMaxStandbyQueueLen(n uint64) {
+	exec.maxQueueLen = n
+}
+
+// Limit the count of the TXs a sender can have in the standby queue. The TXs over the limit are rejected in
+// Prepare and reported in CommittedTxs as "sender-queue-full", while replacing a queued tx is still allowed.
+// Zero means no limit.
+func (exec *txEngine) SetMaxQueuedTxsPerSender(n uint64) {
+	exec.maxTxsPerSender = n
+}
+
+// Drop the TXs which have waited in the standby queue for more than 'blocks' blocks, counting from the height
+// at which they were enqueued, or from NotBefore if it is later. They are reported in CommittedTxs as
+// "expired-in-queue", and their gas fees are not refunded, just like the too-old TXs. Zero disables it.
+func (exec *txEngine) SetQueueTTL(blocks uint64) {
+	exec.queueTTL = blocks
+}
+
+func (exec *txEngine) SetAccessLists(b bool) {
+	exec.accessLists = b
+}
+
+// In Prepare, a tx which is waiting in the standby queue or the scheduled queue, or collected earlier for the
+// same block, is dropped without a receipt. Otherwise it is queued again and fails for its nonce. The queued
+// TXs are indexed by hashes in world state since it is enabled, and the ones queued before are not found.
+func (exec *txEngine) SetDropDuplicateTxs(b bool) {
+	exec.dropDuplicates = b
+}
+
+// Run the TXs conflicting with the committed ones of a round again at most n times in the round, on the state
+// updated by the committed ones, before they are inserted back into the standby queue. Zero disables it.
+func (exec *txEngine) SetMaxRetries(n int) {
+	exec.maxRetries = n
+}
+
+// Re-run a conflicting tx only after the TXs it depends on are committed or requeued, as told by the dependency
+// DAG built from the read/write lists of its last run. It takes effect if SetMaxRetries is called with n > 0.
+func (exec *txEngine) SetDAGScheduling(b bool) {
+	exec.dagScheduling = b
+}
+
+// Limit the gas of the TXs loaded in a block, zero means no limit. The gas limits of the loaded TXs are
+// reserved, such that the gas used by a block never exceeds the limit, except the first tx of a block.
+func (exec *txEngine) SetBlockGasLimit(limit uint64) {
+	exec.blockGasLimit = limit
+}
+
+func (exec *txEngine) SetSupplyCheck(b bool) {
+	exec.supplyChecker = nil
+	if b {
+		exec.supplyChecker = &supplyChecker{}
+	}
+}
+
+func (exec *txEngine) SetGasTarget(target uint64) {
+	exec.gasTarget = target
+}
+
+func (exec *txEngine) SetHotAccounts(h *HotAccounts) {
+	exec.hotAccounts = h
+}
+
+// Preload the states of the first n hot accounts. It must be called after SetContext and SetHotAccounts.
+func (exec *txEngine) WarmUp(n int) {
+	if exec.hotAccounts == nil {
+		return
+	}
+	addrs := exec.hotAccounts.Addresses()
+	if len(addrs) > n {
+		addrs = addrs[:n]
+	}
+	ctx := exec.cleanCtx.WithRbtCopy()
+	WarmUp(ctx, addrs)
+	ctx.Close(false)
+}
+
 func (exec *txEngine) SetAotParam(aotDir string, aotReloadInterval int64) {
 	exec.aotDir = aotDir
 	exec.aotReloadInterval = aotReloadInterval
 }
 
+// Track the recent TX hashes to reject the resubmitted TXs in ValidateTx. It is a per-node option, because
+// the hashes live in memory, so they never decide which TXs of a block enter standby queue.
+func (exec *txEngine) SetRecentHashes(r *RecentHashes) {
+	exec.recentHashes = r
+}
+
+// Record the timestamps of the executed blocks, for the queries with time ranges
+func (exec *txEngine) SetTimeIndex(idx *BlockTimeIndex) {
+	exec.timeIndex = idx
+}
+
+// Write a BlockMeta into s after each block is executed
+func (exec *txEngine) SetBlockMetaStore(s *BlockMetaStore) {
+	exec.blockMetaStore = s
+}
+
+// Keep the full results of the last few executed blocks in c, for the RPC queries about the latest blocks
+func (exec *txEngine) SetBlockCache(c *BlockCache) {
+	exec.blockCache = c
+}
+
+// Update the daily statistics in cs after each block is executed
+func (exec *txEngine) SetChainStats(cs *ChainStats) {
+	exec.chainStats = cs
+}
+
+// Record the heights at which the accounts are touched into w, after each block is executed
+func (exec *txEngine) SetActivityWatermarks(w *ActivityWatermarks) {
+	exec.watermarks = w
+}
+
+// Archive the inactive accounts with se after each block. All the nodes must enable it at the same height.
+func (exec *txEngine) SetStateExpiry(se *StateExpiry) {
+	exec.stateExpiry = se
+}
+
+// Limit the number of storage slots a contract may occupy. The SSTORE creating a slot beyond the quota fails,
+// and so does the tx with STORAGE_QUOTA_EXCEEDED if the failure reaches it, unless the contract is in the
+// exempt list decided by governance.
+func (exec *txEngine) SetStorageQuota(maxSlots uint64, exempt []common.Address) {
+	exec.maxStorageSlots = maxSlots
+	exec.quotaExempt = exempt
+}
+
+// Select the algorithm ordering the TXs of a block in Prepare. An invalid one is ignored.
+func (exec *txEngine) SetOrderingAlgorithm(alg OrderingAlgorithm) {
+	if alg.IsValid() {
+		exec.orderingAlgorithm = alg
+	}
+}
+
+func (exec *txEngine) OrderingAlgorithm() OrderingAlgorithm {
+	return exec.orderingAlgorithm
+}
+
+// Switch the ordering algorithm at the heights of forks, such that a block replayed from history is
+// prepared with the algorithm in effect at its height. The forks with invalid algorithms are ignored.
+func (exec *txEngine) SetOrderingForks(forks []OrderingFork) {
+	exec.orderingForks = make([]OrderingFork, 0, len(forks))
+	for _, fork := range forks {
+		if fork.Algorithm.IsValid() {
+			exec.orderingForks = append(exec.orderingForks, fork)
+		}
+	}
+	sort.SliceStable(exec.orderingForks, func(i, j int) bool {
+		return exec.orderingForks[i].Height < exec.orderingForks[j].Height
+	})
+}
+
+// Returns the results of the last executed block
+func (exec *txEngine) BlockResults() BlockResults {
+	return exec.blockResults
+}
+
+// Tag the contracts created in each block with the bytecode patterns of s. The tags do not affect consensus.
+func (exec *txEngine) SetCodeScanner(s *CodeScanner) {
+	exec.codeScanner = s
+}
+
+// Report the TXs which an honest proposer would not include, for the host chain's slashing logic
+func (exec *txEngine) SetMisbehaviorHandler(h MisbehaviorHandler) {
+	exec.misbehaviorHandler = h
+}
+
+// Limit the encoded size of a tx. The larger TXs are rejected by ValidateTx, and the ones in a block are
+// not inserted into standby queue, but get receipts of TX_TOO_LARGE in Prepare. Zero means no limit.
+func (exec *txEngine) SetMaxTxSize(size uint64) {
+	exec.maxTxSize = size
+}
+
+// Limit the length of OutData recorded in the receipts. The longer output data are truncated to size and the
+// receipts have OutDataTruncated set. Zero means no limit.
+func (exec *txEngine) SetMaxOutDataSize(size uint64) {
+	exec.maxOutDataSize = size
+}
+
+// Compress the data of the TXs in standby queue if they are longer than threshold. Zero means no compression.
+// Both formats can always be loaded, but the stored bytes affect the state root.
+func (exec *txEngine) SetCompressThreshold(threshold int) {
+	exec.compressThreshold = threshold
+}
+
+// Trace all the TXs run in Execute with t, which is called by the runners in parallel
+func (exec *txEngine) SetTracer(t Tracer) {
+	exec.tracer = t
+}
+
+// Limit the input and output data of the TXs in the records persisted by the host. It is a per-node option.
+func (exec *txEngine) SetDataRetention(r *DataRetention) {
+	exec.dataRetention = r
+}
+
 // A new context must be set before Execute
+// Returns a copy of cleanCtx for the read-only queries. Prepare closes cleanCtx to release the trunk, and
+// the queries read the trunk through a reopened Context until the host calls SetContext again.
+func (exec *txEngine) readCtx() *types.Context {
+	if exec.cleanCtx.IsClosed() {
+		return exec.cleanCtx.Reopen()
+	}
+	return exec.cleanCtx.WithRbtCopy()
+}
+
 func (exec *txEngine) SetContext(ctx *types.Context) {
 	exec.cleanCtx = ctx
+	exec.pendingNonces.invalidateQueued() // the queues may be changed by the last Prepare or Execute
 }
 
-// Check transactions' signatures and insert the valid ones into standby queue
+// Check transactions' signatures and insert the valid ones into standby queue.
+// If the minimum gas price is stored in world state, it overrides the minGasPrice argument.
 func (exec *txEngine) Prepare(reorderSeed int64, minGasPrice, maxTxGasLimit uint64) Frontier {
+	span := exec.startSpan(SpanPrepare)
+	defer span.End()
+	span.SetAttribute("txs", int64(len(exec.txList)))
+	exec.pendingNonces.resetCollected()
+	// the TXs collected now are prepared for the block after the current one
+	exec.preparedOrdering = exec.orderingAlgorithmAt(int64(exec.getCurrHeight()) + 1)
+	minGasPrice = exec.adjustMinGasPrice(minGasPrice)
+	if len(exec.resurrections) != 0 {
+		exec.resurrectAccounts()
+	}
+	if exec.recentHashes != nil {
+		exec.loadQueuedHashes()
+	}
 	exec.cleanCtx.Rbt.GetBaseStore().PrepareForUpdate(types.StandbyTxQueueKey[:])
+	exec.dropDuplicateTxs()
 	if len(exec.txList) == 0 {
+		exec.txNotBefore = nil
 		exec.cleanCtx.Close(false)
 		return GetEmptyFrontier()
 	}
-	infoList, ctxAA := exec.parallelReadAccounts(minGasPrice, maxTxGasLimit)
-	addr2idx := make(map[common.Address]int, len(exec.txList)) // map address to ctxAA's index
+	readSpan := exec.startSpan(SpanReadAccounts)
+	infoList, ctxAA := exec.parallelReadAccounts(minGasPrice, maxTxGasLimit, exec.preparedBaseFee())
+	readSpan.SetAttribute("txs", int64(len(infoList)))
+	readSpan.End()
+	exec.txNotBefore = nil
+	var addr2Infos map[common.Address][]*preparedInfo
+	reorderedList := detguard.Twice("reorderInfoList", func() (out []*preparedInfo) {
+		out, addr2Infos = orderInfoList(exec.preparedOrdering, infoList, reorderSeed)
+		return
+	})
+	// which entry reads an account first depends on the speeds of goroutines, so the owners are assigned
+	// from reorderedList instead
+	var owned [][]common.Address
+	addr2idx := detguard.Twice("assignSenders", func() (out map[common.Address]int) {
+		out, owned = assignSenders(reorderedList, ctxAA)
+		return
+	})
 	for idx, entry := range ctxAA {
-		for _, addr := range entry.accounts {
-			if _, ok := addr2idx[addr]; !ok {
-				//when we meet an address for the first time
-				addr2idx[addr] = idx
-			}
-		}
+		entry.accounts = owned[idx]
+	}
+	var queued map[common.Address]map[uint64]*queuedTx
+	if exec.replaceByFeeBump != 0 || exec.maxTxsPerSender != 0 {
+		queued = exec.loadQueuedTxs(addr2Infos)
 	}
-	reorderedList, addr2Infos := reorderInfoList(infoList, reorderSeed)
 	ctx := exec.cleanCtx.WithRbtCopy()
 	startEndBz := ctx.Rbt.GetBaseStore().Get(types.StandbyTxQueueKey[:])
 	queueEnd := uint64(0)
@@ -272,16 +633,31 @@ func (exec *txEngine) Prepare(reorderSeed int64, minGasPrice, maxTxGasLimit uint
 			k := types.GetStandbyTxKey(queueEnd + uint64(i)) // warm up the entry in standby queue
 			entry.ctx.Rbt.GetBaseStore().PrepareForUpdate(k)
 		}
+		var reservedValues map[common.Address]*uint256.Int // the values of the former TXs of the senders
+		if exec.strictBalanceCheck {
+			reservedValues = make(map[common.Address]*uint256.Int)
+		}
 		for _, addr := range entry.accounts {
-			if addr2idx[addr] != idx {
-				// this addr does not belong to this entry
-				continue
+			if _, ok := entry.addr2nonce[addr]; !ok { // it was read by another entry
+				acc := entry.ctx.GetAccount(addr)
+				entry.addr2nonce[addr] = acc.Nonce()
+				entry.addr2Balance[addr] = acc.Balance().Clone()
 			}
 			for _, info := range addr2Infos[addr] {
 				if len(info.errorStr) != 0 {
 					continue //skip it if already found error
 				}
 				sender := info.tx.From
+				scheduled := exec.isScheduledLater(info.tx) // it does not replace a tx in standby queue
+				if q, ok := queued[sender][info.tx.Nonce]; ok && exec.replaceByFeeBump != 0 && !scheduled {
+					exec.replaceQueuedTx(info, q, entry, reservedValues)
+					continue
+				}
+				if exec.maxTxsPerSender != 0 && uint64(len(queued[sender])) >= exec.maxTxsPerSender {
+					// checked before the nonce, such that the later TXs of the sender get the same error
+					info.errorStr = StatusToStr(types.SENDER_QUEUE_FULL)
+					continue
+				}
 				if entry.addr2nonce[sender] != info.tx.Nonce {
 					//skip it if nonce is wrong
 					exec.logger.Debug("prepare::incorrect nonce", "txHash", info.tx.HashID.String())
@@ -289,17 +665,28 @@ func (exec *txEngine) Prepare(reorderSeed int64, minGasPrice, maxTxGasLimit uint
 					continue
 				}
 				entry.addr2nonce[sender]++
+				if reservedValues != nil && !coversValueAndGasFee(info, entry, reservedValues) {
+					continue
+				}
 				if exec.deductGasFeeAndUpdateFrontier(sender, info, entry) != nil {
 					continue
 				}
 				entry.changed = true //now this context needs writeback
-				info.txBytes = info.tx.ToBytes()
+				info.txBytes = exec.txToBytes(info.tx)
+				info.scheduled = scheduled
+				if queued != nil {
+					queued[sender][info.tx.Nonce] = &queuedTx{info: info}
+				}
 			}
 		}
 	})
 	for i := range ctxAA {
 		ctxAA[i].ctx.Close(ctxAA[i].changed)
 	}
+	var evictions *queueEvictions
+	if exec.maxQueueLen != 0 {
+		evictions = exec.planEvictions(reorderedList, startEndBz)
+	}
 	// the value of exec.parallelNum and the speeds of goroutines must have
 	// no effects on the order of TXs in standby queue.
 	ctx = exec.cleanCtx.WithRbtCopy()
@@ -308,27 +695,99 @@ func (exec *txEngine) Prepare(reorderSeed int64, minGasPrice, maxTxGasLimit uint
 		totalGasFee.Add(totalGasFee, ctxAA[i].totalGasFee)
 	}
 	_ = AddSystemAccBalance(ctx, totalGasFee)
+	refundedFee := uint256.NewInt(0)
+	for i := range ctxAA {
+		refundedFee.Add(refundedFee, ctxAA[i].refundedFee)
+	}
+	if evictions != nil {
+		refundedFee.Add(refundedFee, evictions.refund(ctx))
+	}
+	if !refundedFee.IsZero() {
+		_ = SubSystemAccBalance(ctx, refundedFee)
+	}
 	trunk := ctx.Rbt.GetBaseStore()
 	ctx.Close(true)
-	exec.insertToStandbyTxQ(trunk, reorderedList, startEndBz, queueEnd)
+	exec.insertToScheduledTxQ(trunk, reorderedList)
+	exec.insertToStandbyTxQ(trunk, reorderedList, startEndBz, queueEnd, evictions)
+	if exec.misbehaviorHandler != nil {
+		exec.reportMisbehaviors(infoList)
+	}
 	exec.txList = exec.txList[:0] // clear txList after consumption
 	//write ctx state to trunk
 	exec.cleanCtx.Close(false)
-	return NewFrontierWithCtxAA(ctxAA, addr2idx)
+	return detguard.Twice("NewFrontierWithCtxAA", func() *frontier {
+		return NewFrontierWithCtxAA(ctxAA, addr2idx)
+	})
 }
 
-func (exec *txEngine) deductGasFeeAndUpdateFrontier(sender common.Address, info *preparedInfo, entry *ctxAndAccounts) error {
-	gasFee := uint256.NewInt(0).SetUint64(info.tx.Gas)
-	gasPrice := utils.U256FromSlice32(info.tx.GasPrice[:])
+// Assigns each existing sender to an entry of ctxAA, in the order of their first TXs in reorderedList and
+// round-robin. Returns the map from sender to the entry's index, and the senders owned by each entry.
+func assignSenders(reorderedList []*preparedInfo, ctxAA []*ctxAndAccounts) (map[common.Address]int, [][]common.Address) {
+	owned := make([][]common.Address, len(ctxAA))
+	addr2idx := make(map[common.Address]int)
+	for _, info := range reorderedList {
+		sender := info.tx.From
+		if _, ok := addr2idx[sender]; ok || !accountWasRead(ctxAA, sender) {
+			continue
+		}
+		idx := len(addr2idx) % len(ctxAA)
+		addr2idx[sender] = idx
+		owned[idx] = append(owned[idx], sender)
+	}
+	return addr2idx, owned
+}
+
+// An account was read by parallelReadAccounts if and only if it exists and one of its TXs is checked to be valid
+func accountWasRead(ctxAA []*ctxAndAccounts, addr common.Address) bool {
+	for _, entry := range ctxAA {
+		if _, ok := entry.addr2nonce[addr]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func txGasFee(tx *types.TxToRun) *uint256.Int {
+	gasFee := uint256.NewInt(0).SetUint64(tx.Gas)
+	gasPrice := utils.U256FromSlice32(tx.GasPrice[:])
 	if gasPrice.GtUint64(MaxGasPrice) {
 		gasPrice = uint256.NewInt(MaxGasPrice)
 	}
-	gasFee.Mul(gasFee, gasPrice)
+	return gasFee.Mul(gasFee, gasPrice)
+}
+
+// Check whether the balance of the sender covers the gas fee and the value of the tx, as well as the values
+// in reserved, which are the sums of the values of the senders' former TXs. The gas fees of the former TXs
+// are already deducted from the balance. The value of the tx is added into reserved if it is covered.
+func coversValueAndGasFee(info *preparedInfo, entry *ctxAndAccounts, reserved map[common.Address]*uint256.Int) bool {
+	sender := info.tx.From
+	value, _ := uint256.FromBig(utils.BigIntFromSlice32(info.tx.Value[:]))
+	overflow := false
+	if r, ok := reserved[sender]; ok {
+		_, overflow = value.AddOverflow(value, r)
+	}
+	need, overflowFee := new(uint256.Int).AddOverflow(value, txGasFee(info.tx))
+	overflow = overflow || overflowFee
+	balance := uint256.NewInt(0)
+	if acc := entry.ctx.GetAccount(sender); acc != nil {
+		balance = acc.Balance()
+	}
+	if overflow || balance.Lt(need) {
+		entry.addr2Balance[sender] = uint256.NewInt(0)
+		info.errorStr = "not enough balance to pay value and gasfee"
+		return false
+	}
+	reserved[sender] = value
+	return true
+}
+
+func (exec *txEngine) deductGasFeeAndUpdateFrontier(sender common.Address, info *preparedInfo, entry *ctxAndAccounts) error {
+	gasFee := txGasFee(info.tx)
 	if info.tx.From == BlockedAddress {
 		exec.logger.Debug("Blocked Account", "txHash", info.tx.HashID.String())
 		entry.addr2Balance[sender] = uint256.NewInt(0)
 		info.errorStr = "Blocked Account"
-		return errors.New("Blocked Account")
+		return errors.ErrBlockedAccount
 	}
 	err := SubSenderAccBalance(entry.ctx, sender, gasFee)
 	if err != nil {
@@ -370,7 +829,7 @@ func (exec *txEngine) getCurrHeight() uint64 {
 }
 
 // Read accounts' information in parallel, while checking accounts' existence and signatures' validity
-func (exec *txEngine) parallelReadAccounts(minGasPrice, maxTxGasLimit uint64) (infoList []*preparedInfo, ctxAA []*ctxAndAccounts) {
+func (exec *txEngine) parallelReadAccounts(minGasPrice, maxTxGasLimit uint64, baseFee *uint256.Int) (infoList []*preparedInfo, ctxAA []*ctxAndAccounts) {
 	//for each tx, we fetch some info for it
 	infoList = make([]*preparedInfo, len(exec.txList))
 	//the ctx and accounts that a worker works at
@@ -383,6 +842,7 @@ func (exec *txEngine) parallelReadAccounts(minGasPrice, maxTxGasLimit uint64) (i
 			accounts:     make([]common.Address, 0, estimatedSize),
 			changed:      false,
 			totalGasFee:  uint256.NewInt(0),
+			refundedFee:  uint256.NewInt(0),
 			addr2nonce:   make(map[common.Address]uint64, estimatedSize),
 			addr2Balance: make(map[common.Address]*uint256.Int, estimatedSize),
 		}
@@ -398,12 +858,21 @@ func (exec *txEngine) parallelReadAccounts(minGasPrice, maxTxGasLimit uint64) (i
 			//set txToRun first
 			txToRun := &types.TxToRun{}
 			txToRun.FromGethTx(tx, sender, exec.getCurrHeight())
+			txToRun.NotBefore = exec.txNotBefore[int(myIdx)]
+			if !exec.accessLists {
+				txToRun.AccessList = nil // it is neither charged nor stored
+			}
 			infoList[myIdx].tx = txToRun
 			if err != nil {
 				infoList[myIdx].errorStr = "invalid signature"
 				continue
 			}
-			if !tx.GasPrice().IsInt64() || tx.GasPrice().Int64() < int64(minGasPrice) {
+			if errStr := applyBaseFee(txToRun, baseFee); errStr != "" {
+				infoList[myIdx].errorStr = errStr
+				continue
+			}
+			gasPrice := utils.U256FromSlice32(txToRun.GasPrice[:]) // the effective one of a dynamic fee tx
+			if !gasPrice.IsUint64() || gasPrice.Uint64() > math.MaxInt64 || gasPrice.Uint64() < minGasPrice {
 				infoList[myIdx].errorStr = "invalid gas price"
 				continue
 			}
@@ -411,6 +880,10 @@ func (exec *txEngine) parallelReadAccounts(minGasPrice, maxTxGasLimit uint64) (i
 				infoList[myIdx].errorStr = "invalid gas limit"
 				continue
 			}
+			if exec.isTooLarge(tx) {
+				infoList[myIdx].errorStr = StatusToStr(types.TX_TOO_LARGE)
+				continue
+			}
 			// access disk to fetch the account's detail
 			acc := ctxAA[workerId].ctx.GetAccount(sender)
 			if acc == nil {
@@ -418,7 +891,6 @@ func (exec *txEngine) parallelReadAccounts(minGasPrice, maxTxGasLimit uint64) (i
 				continue
 			}
 			if _, ok := ctxAA[workerId].addr2nonce[sender]; !ok {
-				ctxAA[workerId].accounts = append(ctxAA[workerId].accounts, sender)
 				ctxAA[workerId].addr2nonce[sender] = acc.Nonce()
 				ctxAA[workerId].addr2Balance[sender] = acc.Balance().Clone()
 			}
@@ -427,34 +899,14 @@ func (exec *txEngine) parallelReadAccounts(minGasPrice, maxTxGasLimit uint64) (i
 	return
 }
 
-func reorderInfoList(infoList []*preparedInfo, reorderSeed int64) (out []*preparedInfo, addr2Infos map[common.Address][]*preparedInfo) {
-	out = make([]*preparedInfo, 0, len(infoList))
-	addr2Infos = make(map[common.Address][]*preparedInfo, len(infoList))
-	addrList := make([]common.Address, 0, len(infoList))
-	for _, info := range infoList {
-		if _, ok := addr2Infos[info.tx.From]; ok {
-			addr2Infos[info.tx.From] = append(addr2Infos[info.tx.From], info)
-		} else {
-			addr2Infos[info.tx.From] = []*preparedInfo{info}
-			addrList = append(addrList, info.tx.From)
-		}
-	}
-	rand := mt19937.New()
-	rand.Seed(reorderSeed)
-	for i := 0; i < len(addrList); i++ { // shuffle the addresses
-		r0 := int(rand.Int63()) % len(addrList)
-		r1 := int(rand.Int63()) % len(addrList)
-		addrList[r0], addrList[r1] = addrList[r1], addrList[r0]
-	}
-	for _, addr := range addrList {
-		out = append(out, addr2Infos[addr]...)
-	}
-	return
-}
-
 // insert valid transactions into standby queue
-func (exec *txEngine) insertToStandbyTxQ(trunk storetypes.BaseStoreI, infoList []*preparedInfo, startEnd []byte, end uint64) {
+func (exec *txEngine) insertToStandbyTxQ(trunk storetypes.BaseStoreI, infoList []*preparedInfo, startEnd []byte, end uint64,
+	evictions *queueEvictions) {
 	trunk.Update(func(store storetypes.SetDeleter) {
+		if evictions != nil {
+			exec.rebuildStandbyTxQ(store, infoList, evictions, startEnd, end)
+			return
+		}
 		for _, info := range infoList {
 			// six kinds of errors: invalid signature; incorrect nonce;
 			// no such account; balance not enough; gas limit too high; gas price too low;
@@ -463,19 +915,39 @@ func (exec *txEngine) insertToStandbyTxQ(trunk storetypes.BaseStoreI, infoList [
 				exec.recordInvalidTx(info)
 				continue
 			}
+			if info.scheduled {
+				continue // it is in the scheduled queue
+			}
+			if info.replaced != nil { // it takes the position of the replaced one
+				k := types.GetStandbyTxKey(info.replacePos)
+				store.Set(k, info.txBytes)
+				exec.unindexQueuedTx(store, info.replaced.HashID)
+				exec.indexQueuedTx(store, info.tx.HashID, k)
+				exec.recordInvalidTx(&preparedInfo{tx: info.replaced, errorStr: replacedByFee})
+				continue
+			}
 			k := types.GetStandbyTxKey(end)
 			store.Set(k, info.txBytes)
+			exec.indexQueuedTx(store, info.tx.HashID, k)
 			end++
 		}
 		binary.BigEndian.PutUint64(startEnd[8:], end)
 		store.Set(types.StandbyTxQueueKey[:], startEnd) //update start&end pointers of standby queue
 	})
+	if exec.recentHashes != nil {
+		hashes := make([]common.Hash, 0, len(infoList))
+		for _, info := range infoList {
+			if len(info.errorStr) == 0 {
+				hashes = append(hashes, info.tx.HashID)
+			}
+		}
+		exec.recentHashes.addQueued(hashes)
+	}
 }
 
 func (exec *txEngine) recordInvalidTx(info *preparedInfo) {
 	tx := &types.Transaction{
 		Hash:              info.tx.HashID,
-		TransactionIndex:  int64(len(exec.committedTxs)),
 		Nonce:             info.tx.Nonce,
 		BlockNumber:       int64(exec.getCurrHeight()),
 		From:              info.tx.From,
@@ -488,21 +960,109 @@ func (exec *txEngine) recordInvalidTx(info *preparedInfo) {
 		GasUsed:           0,
 		Status:            gethtypes.ReceiptStatusFailed,
 		StatusStr:         info.errorStr,
+		Type:              info.tx.Type,
+		EffectiveGasPrice: info.tx.GasPrice,
 	}
 	if exec.currentBlock != nil {
 		tx.BlockHash = exec.currentBlock.Hash
 	}
+	exec.appendCommittedTx(tx)
+}
+
+// Append tx to committedTxs and assign the indexes of it and its logs. As in Ethereum, the indexes of the
+// logs are continuous in a block, no matter whether the TXs are valid.
+func (exec *txEngine) appendCommittedTx(tx *types.Transaction) {
+	tx.TransactionIndex = int64(len(exec.committedTxs))
+	for i := range tx.Logs {
+		tx.Logs[i].TxIndex = uint(tx.TransactionIndex)
+		tx.Logs[i].Index = exec.nextLogIndex
+		exec.nextLogIndex++
+	}
 	exec.committedTxs = append(exec.committedTxs, tx)
 }
 
-// Fetch TXs from standby queue and execute them
-func (exec *txEngine) Execute(currBlock *types.BlockInfo) {
+// Fetch TXs from standby queue and execute them. currBlock is not changed: if the dynamic fee is enabled, the
+// TXs run on a copy of it whose BaseFee is filled, and the base fee is returned in BlockResults.
+func (exec *txEngine) Execute(currBlock *types.BlockInfo) (stats BlockExecStats) {
+	span := exec.startSpan(SpanExecute)
+	span.SetAttribute("height", currBlock.Number)
+	exec.execStats = newExecStatsCollector(currBlock.Number)
+	defer func() { // the recordings deferred below are also in this span and the statistics
+		stats = exec.execStats.finish()
+		exec.execStats = nil
+		span.SetAttribute("committed", int64(len(exec.committedTxs)))
+		span.End()
+	}()
 	exec.committedTxs = exec.committedTxs[:0]
+	exec.executedHashes = exec.executedHashes[:0]
+	exec.nextLogIndex = 0
 	exec.cumulativeGasUsed = 0
 	exec.cumulativeFeeRefund = uint256.NewInt(0)
 	exec.cumulativeGasFee = uint256.NewInt(0)
+	exec.cumulativeBurntFee = uint256.NewInt(0)
+	exec.reexecutedCount, exec.requeuedCount = 0, 0
+	if baseFee := exec.preparedBaseFee(); baseFee != nil {
+		blk := *currBlock
+		blk.BaseFee = baseFee.Bytes32()
+		currBlock = &blk
+	}
 	exec.currentBlock = currBlock
 	exec.rwListMap = make(map[common.Hash]rwList, 1024)
+	exec.inFlight = nil
+	if exec.deferLaterNonces {
+		exec.inFlight = make(inFlightNonces)
+	}
+	if exec.supplyChecker != nil {
+		exec.supplyChecker.reset()
+	}
+	defer exec.recordGasUsage() // an empty block is also recorded
+	if exec.blockCache != nil {
+		defer exec.cacheBlock() // runs after recordBlockResults
+	}
+	defer exec.recordBlockResults()
+	if exec.recentHashes != nil {
+		defer exec.recordCommittedHashes()
+	}
+	if exec.blockMetaStore != nil {
+		defer exec.recordBlockMeta() // runs before recordGasUsage
+	}
+	if exec.chainStats != nil {
+		defer exec.recordChainStats()
+	}
+	if exec.dataRetention != nil && exec.dataRetention.FullData != nil {
+		defer exec.storeFullTxData()
+	}
+	exec.storageQuota = nil
+	if exec.maxStorageSlots != 0 {
+		ctx := exec.cleanCtx.WithRbtCopy()
+		exec.storageQuota = newStorageQuota(ctx, exec.maxStorageSlots, exec.quotaExempt)
+		ctx.Close(false)
+	}
+	if exec.stateExpiry != nil {
+		defer exec.expireAccounts()
+	}
+	if exec.watermarks != nil {
+		defer exec.recordActivity()
+	}
+	if exec.codeScanner != nil {
+		defer exec.scanCreatedContracts()
+	}
+	if exec.timeIndex != nil {
+		exec.timeIndex.AddBlock(currBlock.Number, currBlock.Timestamp)
+	}
+	if currBlock.RandomBeacon != [32]byte{} {
+		exec.recordRandomBeacon(currBlock)
+	}
+	defer exec.runEndBlockHooks() // runs before the deferred recordings, even if there are no TXs
+	moved := exec.moveDueScheduledTxs(uint64(currBlock.Number))
+	if exec.inFlight != nil { // the later TXs of their senders must wait for the scheduled ones
+		for i := range moved {
+			exec.inFlight.add(&moved[i])
+		}
+		ctx := exec.cleanCtx.WithRbtCopy()
+		exec.scanScheduledTxs(ctx, exec.inFlight.add)
+		ctx.Close(false)
+	}
 	startKey, endKey := exec.getStandbyQueueRange()
 	if startKey == endKey {
 		return
@@ -512,6 +1072,7 @@ func (exec *txEngine) Execute(currBlock *types.BlockInfo) {
 		end:   endKey,
 	}
 	exec.txExecutedCount = 0
+	exec.blockGasFull = false
 	committableRunnerList := make([]*TxRunner, 0, 4096)
 	// Repeat exec.roundNum round for execute txs in standby q. At the end of each round
 	// modifications made by TXs are written to world state. So TXs in later rounds can
@@ -520,32 +1081,47 @@ func (exec *txEngine) Execute(currBlock *types.BlockInfo) {
 		if txRange.start == txRange.end {
 			break
 		}
-		numTx := exec.executeOneRound(txRange, exec.currentBlock)
+		exec.updateBlockGasLeft(committableRunnerList)
+		roundSpan := exec.startSpan(SpanRound)
+		roundSpan.SetAttribute("round", int64(i))
+		committedBefore, requeuedBefore, endBefore := len(committableRunnerList), exec.requeuedCount, txRange.end
+		var numTx int
+		if exec.maxRetries != 0 {
+			numTx, committableRunnerList = exec.executeOneRoundWithRetries(txRange, exec.currentBlock, committableRunnerList)
+		} else {
+			numTx = exec.executeOneRound(txRange, exec.currentBlock)
+			committableRunnerList = takeCommittableRunners(numTx, committableRunnerList)
+		}
+		roundSpan.SetAttribute("txs", int64(numTx))
+		roundSpan.End()
+		exec.execStats.addRound(numTx, committableRunnerList[committedBefore:], exec.requeuedCount-requeuedBefore,
+			int(txRange.end-endBefore))
 		exec.txExecutedCount += numTx
-		if numTx == 0 && exec.checkRWInLoading {
+		if (numTx == 0 && exec.checkRWInLoading) || exec.blockGasFull {
 			break
 		}
-		for i := 0; i < numTx; i++ {
-			if Runners[i] == nil {
-				continue // the TX is not committable and needs re-execution
-			}
-			committableRunnerList = append(committableRunnerList, Runners[i])
-			Runners[i] = nil
-		}
 	}
 	exec.setStandbyQueueRange(txRange.start, txRange.end)
 	exec.collectCommittableTxs(committableRunnerList)
+	if exec.supplyChecker != nil {
+		exec.checkSupply()
+	}
+	exec.burnBaseFees()
 	exec.reloadQueryExecutorFn()
+	return // stats is set by the first deferred function
 }
 
 // Get the start and end position of standby queue
 func (exec *txEngine) getStandbyQueueRange() (start, end uint64) {
-	ctx := exec.cleanCtx.WithRbtCopy()
+	ctx := exec.readCtx()
 	defer ctx.Close(false)
 	startEnd := ctx.Rbt.GetBaseStore().Get(types.StandbyTxQueueKey[:])
 	if startEnd == nil {
 		return 0, 0
 	}
+	if len(startEnd) != 16 {
+		panic(fmt.Errorf("%w: the range has %d bytes", errors.ErrQueueCorrupted, len(startEnd)))
+	}
 	return binary.BigEndian.Uint64(startEnd[:8]), binary.BigEndian.Uint64(startEnd[8:])
 }
 
@@ -563,18 +1139,111 @@ func (exec *txEngine) setStandbyQueueRange(start, end uint64) {
 // Execute 'runnerNumber' transactions in parallel and commit the ones without any interdependency
 func (exec *txEngine) executeOneRound(txRange *TxRange, currBlock *types.BlockInfo) int {
 	txBundle, ignoreList := exec.loadStandbyTxs(txRange)
-	if exec.checkRWInLoading && len(txBundle) == 0 {
+	if exec.checkRWInLoading && len(txBundle) == 0 && len(exec.expiredTxs) == 0 {
 		return 0
 	}
-	kvCount := exec.runTxInParallel(txRange, txBundle, len(ignoreList), currBlock)
-	exec.checkTxDepsAndUptStandbyQ(txRange, txBundle, ignoreList, int(kvCount))
+	groups := detguard.Twice("groupTxBundle", func() [][]int {
+		return exec.groupTxBundle(txBundle)
+	})
+	// trunk is not updated until the end of checkTxDepsAndUptStandbyQ, so the runners can share what
+	// they read from it, and their write-backs are batched into one update
+	cow := types.NewCowBaseStore(exec.cleanCtx.Rbt.GetBaseStore())
+	kvCount := exec.runTxInParallel(txRange, txBundle, groups, len(ignoreList)+len(exec.expiredTxs), cow, currBlock)
+	exec.checkTxDepsAndUptStandbyQ(txRange, txBundle, groups, ignoreList, int(kvCount), cow, currBlock, nil)
 	return len(txBundle)
 }
 
-// Load at most 'exec.runnerNumber' transactions from standby queue
+// Append the committable runners among the first n ones to list, and clear Runners for the next round
+func takeCommittableRunners(n int, list []*TxRunner) []*TxRunner {
+	for i := 0; i < n; i++ {
+		if Runners[i] == nil {
+			continue // the TX is not committable and needs re-execution
+		}
+		list = append(list, Runners[i])
+		Runners[i] = nil
+	}
+	return list
+}
+
+// Like executeOneRound, but the TXs conflicting with the committed ones are run again in the next level,
+// on the state updated by the committed ones, at most maxRetries times. With dagScheduling, the dependency
+// DAG built from the read/write lists of a level tells which of them depend on the other conflicting ones,
+// and they wait until those are committed, instead of running again only to conflict with them. The TXs in
+// a level only conflict with the earlier TXs in the same level, so committing the levels one by one is
+// equivalent to running the committed TXs serially in the order of the returned list. The TXs left after the
+// retries are inserted back into the standby queue, in the order they were loaded.
+func (exec *txEngine) executeOneRoundWithRetries(txRange *TxRange, currBlock *types.BlockInfo,
+	committable []*TxRunner) (int, []*TxRunner) {
+	txBundle, ignoreList := exec.loadStandbyTxs(txRange)
+	if exec.checkRWInLoading && len(txBundle) == 0 && len(exec.expiredTxs) == 0 {
+		return 0, committable
+	}
+	numTx := len(txBundle)
+	var pending []retryTx
+	for level := 0; level <= exec.maxRetries; level++ {
+		var ready []retryTx
+		if level != 0 {
+			if exec.dagScheduling {
+				ready, pending = splitReadyTxs(pending)
+			} else {
+				ready, pending = pending, nil
+			}
+			txBundle = make([]types.TxToRun, 0, len(ready)) // the committed runners point into the former one
+			for _, r := range ready {
+				txBundle = append(txBundle, r.tx)
+			}
+			exec.reexecutedCount += len(txBundle)
+		}
+		if len(txBundle) == 0 {
+			break
+		}
+		groups := detguard.Twice("groupTxBundle", func() [][]int {
+			return exec.groupTxBundle(txBundle)
+		})
+		cow := types.NewCowBaseStore(exec.cleanCtx.Rbt.GetBaseStore())
+		retry := make([]retryTx, 0, len(txBundle))
+		if level == 0 { // the loaded TXs are removed from the standby queue in the first level
+			kvCount := exec.runTxInParallel(txRange, txBundle, groups, len(ignoreList)+len(exec.expiredTxs), cow, currBlock)
+			exec.checkTxDepsAndUptStandbyQ(txRange, txBundle, groups, ignoreList, int(kvCount), cow, currBlock, &retry)
+		} else {
+			kvCount := exec.runTxInParallel(nil, txBundle, groups, 0, cow, currBlock)
+			exec.checkTxDepsAndUptStandbyQ(nil, txBundle, groups, nil, int(kvCount), cow, currBlock, &retry)
+			for i := range retry { // the indexes in this level are mapped to the seqs
+				retry[i].seq = ready[retry[i].seq].seq
+				for j, idx := range retry[i].blockers {
+					retry[i].blockers[j] = ready[idx].seq
+				}
+			}
+		}
+		committable = takeCommittableRunners(len(txBundle), committable)
+		pending = mergeRetryTxs(pending, retry)
+	}
+	exec.requeuedCount += len(pending)
+	if len(pending) != 0 {
+		trunk := exec.cleanCtx.Rbt.GetBaseStore()
+		trunk.Update(func(store storetypes.SetDeleter) {
+			for _, r := range pending {
+				k := types.GetStandbyTxKey(txRange.end)
+				store.Set(k, exec.txToBytes(&r.tx))
+				exec.indexQueuedTx(store, r.tx.HashID, k)
+				txRange.end++
+				exec.inFlight.add(&r.tx)
+			}
+		})
+	}
+	return numTx, committable
+}
+
+// Load at most 'exec.runnerNumber' transactions from standby queue. The TXs which must not run in this round
+// are returned in ignoreList, in the order of the queue. The expired TXs are collected in exec.expiredTxs.
 func (exec *txEngine) loadStandbyTxs(txRange *TxRange) (txBundle, ignoreList []types.TxToRun) {
 	touchedSet := make(map[uint64]struct{}, 4096)
-	ctx := exec.cleanCtx.WithRbtCopy()
+	var senders map[common.Address]struct{} // the senders of the TXs in txBundle
+	if exec.senderSharding && !exec.accountAffinity {
+		senders = make(map[common.Address]struct{}, exec.runnerNumber)
+	}
+	ctx := exec.readCtx()
+	exec.expiredTxs = exec.expiredTxs[:0]
 	txBundle = make([]types.TxToRun, 0, exec.runnerNumber)
 	ignoreList = make([]types.TxToRun, 0, 2*exec.runnerNumber)
 	for i := txRange.start; i < txRange.end && len(txBundle) < exec.runnerNumber && len(ignoreList) < 2*exec.runnerNumber; i++ {
@@ -582,118 +1251,286 @@ func (exec *txEngine) loadStandbyTxs(txRange *TxRange) (txBundle, ignoreList []t
 		bz := ctx.Rbt.GetBaseStore().Get(k)
 		var txToRun types.TxToRun
 		txToRun.FromBytes(bz)
+		if exec.expiredInQueue(&txToRun) {
+			exec.expiredTxs = append(exec.expiredTxs, txToRun) // it is removed from the queue without running
+			continue
+		}
+		if exec.inFlight.mustDefer(&txToRun) {
+			ignoreList = append(ignoreList, txToRun) // an earlier tx of its sender must run first
+			continue
+		}
+		if _, ok := senders[txToRun.From]; ok {
+			ignoreList = append(ignoreList, txToRun) // its sender has a tx in this round
+			exec.inFlight.add(&txToRun)
+			continue
+		}
 		rwList, isRecorded := exec.rwListMap[txToRun.HashID]
 		hasConflicts := exec.checkRWInLoading && isRecorded && rwList.conflictsWith(touchedSet)
+		if !isRecorded && len(txToRun.AccessList) != 0 && !exec.accountAffinity {
+			// the TXs declaring overlapped access lists are run in different rounds
+			rwList = predictRWList(ctx, &txToRun)
+			hasConflicts = rwList.conflictsWith(touchedSet)
+		}
 		if hasConflicts {
 			ignoreList = append(ignoreList, txToRun)
+			exec.inFlight.add(&txToRun)
 		} else {
+			if exec.blockGasLimit != 0 && !exec.reserveBlockGas(txToRun.Gas, len(txBundle)) {
+				exec.blockGasFull = true
+				break // it and the TXs after it are left in the standby queue
+			}
 			rwList.updateTouchedSet(touchedSet)
 			txBundle = append(txBundle, txToRun)
+			if senders != nil {
+				senders[txToRun.From] = struct{}{}
+			}
 		}
 	}
 	ctx.Close(false)
 	return
 }
 
-// Assign the transactions to global 'Runners' and run them in parallel.
-// Record the count of touched KV pairs and return it as a hint for checkTxDepsAndUptStandbyQ
-func (exec *txEngine) runTxInParallel(txRange *TxRange, txBundle []types.TxToRun, ignoreLen int, currBlock *types.BlockInfo) (kvCount int64) {
+// Compute the gas left for the next round from the gas used by the committable TXs and the invalid TXs
+func (exec *txEngine) updateBlockGasLeft(committable []*TxRunner) {
+	if exec.blockGasLimit == 0 {
+		return
+	}
+	gasUsed := exec.cumulativeGasUsed // the invalid TXs
+	for _, runner := range committable {
+		gasUsed += runner.GasUsed
+	}
+	exec.blockGasLeft = 0
+	if gasUsed < exec.blockGasLimit {
+		exec.blockGasLeft = exec.blockGasLimit - gasUsed
+	}
+}
+
+// Reserve the gas of a tx to be loaded into the bundle with bundleLen TXs. The first tx of a block is always
+// loaded, otherwise a tx whose gas limit exceeds blockGasLimit would block the standby queue forever.
+func (exec *txEngine) reserveBlockGas(gas uint64, bundleLen int) bool {
+	isFirst := bundleLen == 0 && exec.blockGasLeft == exec.blockGasLimit
+	if gas > exec.blockGasLeft && !isFirst {
+		return false
+	}
+	if gas > exec.blockGasLeft {
+		gas = exec.blockGasLeft
+	}
+	exec.blockGasLeft -= gas
+	return true
+}
+
+// Assign the transactions to global 'Runners' and run the groups of them in parallel.
+// Record the count of touched KV pairs and return it as a hint for checkTxDepsAndUptStandbyQ.
+// txRange is nil if the transactions are not in the standby queue.
+func (exec *txEngine) runTxInParallel(txRange *TxRange, txBundle []types.TxToRun, groups [][]int, ignoreLen int,
+	cow *types.CowBaseStore, currBlock *types.BlockInfo) (kvCount int64) {
+	span := exec.startSpan(SpanRunTxs)
+	span.SetAttribute("txs", int64(len(txBundle)))
+	span.SetAttribute("groups", int64(len(groups)))
+	defer func() {
+		span.SetAttribute("kvs", kvCount)
+		span.End()
+	}()
 	sharedIdx := int64(-1)
 	trunk := exec.cleanCtx.Rbt.GetBaseStore()
+	var hints *conflictHints
+	// The read/write lists of the requeued TXs are recorded for checkRWInLoading, so they must be full ones
+	if exec.earlyConflictHints && !exec.checkRWInLoading {
+		hints = newConflictHints()
+	}
 	dt.ParallelRun(exec.parallelNum, func(_ int) {
 		for {
 			myIdx := atomic.AddInt64(&sharedIdx, 1)
 			if myIdx >= int64(len(txBundle)+ignoreLen) {
 				return
 			}
-			k := types.GetStandbyTxKey(txRange.start + uint64(myIdx))
-			trunk.PrepareForDeletion(k) // remove it from the standby queue
-			k = types.GetStandbyTxKey(txRange.end + uint64(myIdx))
-			trunk.PrepareForUpdate(k) //warm up
-			if myIdx >= int64(len(txBundle)) {
+			if txRange != nil {
+				k := types.GetStandbyTxKey(txRange.start + uint64(myIdx))
+				trunk.PrepareForDeletion(k) // remove it from the standby queue
+				k = types.GetStandbyTxKey(txRange.end + uint64(myIdx))
+				trunk.PrepareForUpdate(k) //warm up
+			}
+			if myIdx >= int64(len(groups)) {
 				continue
 			}
-			Runners[myIdx] = NewTxRunner(exec.cleanCtx.WithRbtCopy(), &txBundle[myIdx])
-			if myIdx > 0 && txBundle[myIdx-1].From == txBundle[myIdx].From {
-				// In reorderInfoList, we placed the tx with same 'From' back-to-back
-				// same from-address as previous transaction, cannot run in same round
-				Runners[myIdx].Status = types.TX_NONCE_TOO_LARGE
-			} else {
-				runTx(int(myIdx), currBlock)
-				atomic.AddInt64(&kvCount, int64(Runners[myIdx].Ctx.Rbt.CachedEntryCount()))
+			ctx := exec.cleanCtx.WithCowRbtCopy(cow)
+			var slotDeltas map[uint64]int64 // shared by the group like ctx
+			if exec.storageQuota != nil {
+				slotDeltas = make(map[uint64]int64)
+			}
+			for _, idx := range groups[myIdx] {
+				Runners[idx] = NewTxRunner(ctx, &txBundle[idx])
+				Runners[idx].storageQuota, Runners[idx].slotDeltas = exec.storageQuota, slotDeltas
+				Runners[idx].tracer = exec.tracer
+				if len(groups[myIdx]) != 1 {
+					continue // the TXs in a group run one by one and do not need hints
+				}
+				Runners[idx].hintIdx, Runners[idx].hints = idx, hints
+				if idx > 0 && txBundle[idx-1].From == txBundle[idx].From {
+					// In orderInfoList, we placed the tx with same 'From' back-to-back
+					// same from-address as previous transaction, cannot run in same round
+					// (with account affinity, such TXs are in one group)
+					Runners[idx].Status = types.TX_NONCE_TOO_LARGE
+				}
+			}
+			for i, idx := range groups[myIdx] {
+				if Runners[idx].Status != types.TX_NONCE_TOO_LARGE && exec.runTxSafely(idx, currBlock) {
+					exec.recoverPanickedGroup(groups[myIdx], i, cow, currBlock)
+					break
+				}
 			}
+			atomic.AddInt64(&kvCount, int64(Runners[groups[myIdx][0]].Ctx.Rbt.CachedEntryCount()))
 		}
 	})
 	return
 }
 
-type indexAndBool struct {
-	idx       int
-	canCommit bool
-}
-
 // Check interdependency of TXs using 'touchedSet'. The ones with dependency with former committed TXs cannot
 // be committed and should be inserted back into the standby queue.
-func (exec *txEngine) checkTxDepsAndUptStandbyQ(txRange *TxRange, txBundle, ignoreList []types.TxToRun, kvCount int) {
-	touchedSet := make(map[uint64]struct{}, kvCount)
-	var wg sync.WaitGroup
-	idxChan := make(chan indexAndBool, 10)
-	wg.Add(1)
-	go func() { // this goroutine commits the rabbit stores
-		for {
-			idxAndBool := <-idxChan
-			if idxAndBool.idx < 0 {
-				break
-			}
-			Runners[idxAndBool.idx].Ctx.Rbt.CloseAndWriteBack(idxAndBool.canCommit)
+// The committed RabbitStores and the changes of the standby queue are written to trunk in one update.
+// If retry is not nil, the TXs to be re-executed are appended to it instead of the standby queue, with their
+// indexes in txBundle as seqs and the ones of their blockers from the dependency DAG, and txRange is nil if
+// txBundle is not in the standby queue.
+func (exec *txEngine) checkTxDepsAndUptStandbyQ(txRange *TxRange, txBundle []types.TxToRun, groups [][]int,
+	ignoreList []types.TxToRun, kvCount int, cow *types.CowBaseStore, currBlock *types.BlockInfo,
+	retry *[]retryTx) {
+	span := exec.startSpan(SpanCheckConflicts)
+	span.SetAttribute("txs", int64(len(txBundle)))
+	conflicting := 0
+	rwLists := exec.parallelCollectRWLists(groups)
+	// Only the contested keys are tracked in touchedSet, until a rerun changes a list and they are outdated
+	contested := findContestedKeys(rwLists, exec.parallelNum)
+	touchedSet := make(map[uint64]struct{})
+	fullSet := false
+	conflictsWith := func(g int) bool {
+		if fullSet {
+			return rwLists[g].conflictsWith(touchedSet)
 		}
-		wg.Done()
-	}()
-	rwList := newRWList()
-	for idx := range txBundle {
-		canCommit := true
-		Runners[idx].Ctx.Rbt.ScanAllShortKeys(func(key [rabbit.KeySize]byte, dirty bool) (stop bool) {
-			k := binary.LittleEndian.Uint64(key[:])
-			rwList.add(k, dirty)
-			if canCommit {
-				if _, ok := touchedSet[k]; ok {
-					canCommit = false // cannot commit if conflicts with touched KV set
-					Runners[idx].Status = types.FAILED_TO_COMMIT
+		return hasAnyKey(touchedSet, contested[g].in)
+	}
+	failed := make([]bool, len(groups))
+	// Merge the lists in the order of groups, such that the result is deterministic
+	for g := range rwLists {
+		first := groups[g][0] // the TXs in a group share one Context
+		if Runners[first].Status == types.ABORTED_BY_HINTS && !conflictsWith(g) {
+			// The partial list is a subset of the full one, so a conflict found with it is certain. Otherwise
+			// the hint came from a TX which does not commit, and the result must be got by really running it.
+			rwLists[g] = exec.rerunTx(first, cow, currBlock)
+			if !fullSet { // fall back to tracking all the keys written by the committed groups
+				fullSet = true
+				touchedSet = make(map[uint64]struct{}, kvCount)
+				for h := 0; h < g; h++ {
+					if !failed[h] {
+						rwLists[h].updateTouchedSet(touchedSet)
+					}
 				}
 			}
-			return false
-		})
-		if canCommit { // record the dirty KVs written by a committable TX into toucchedSet
-			rwList.updateTouchedSet(touchedSet)
 		}
-		if exec.checkRWInLoading {
-			exec.rwListMap[Runners[idx].Tx.HashID] = rwList
-			rwList = newRWList()
+		rwList := rwLists[g]
+		exec.execStats.addRWList(rwList)
+		canCommit := !conflictsWith(g)
+		if canCommit && exec.storageQuota != nil {
+			// the slot counts are not in the read/write lists, and the slots are counted when merging
+			canCommit = exec.storageQuota.commit(Runners[first].slotDeltas)
+		}
+		if canCommit { // record the dirty KVs written by a committable group into toucchedSet
+			if fullSet {
+				rwList.updateTouchedSet(touchedSet)
+			} else {
+				addKeys(touchedSet, contested[g].out)
+			}
 		} else {
-			rwList.reset()
+			conflicting += len(groups[g])
+			failed[g] = true
+		}
+		for _, idx := range groups[g] {
+			if !canCommit {
+				// cannot commit if conflicts with touched KV set, and a panicked TX is charged when it commits
+				Runners[idx].Status = types.FAILED_TO_COMMIT
+			}
+			if exec.checkRWInLoading {
+				exec.rwListMap[Runners[idx].Tx.HashID] = rwList
+			}
+		}
+		// the write-back is just queued in cow
+		Runners[first].Ctx.Rbt.CloseAndWriteBack(canCommit)
+	}
+	span.SetAttribute("conflicting", int64(conflicting))
+	span.End()
+	var blockers [][]int // the blockers of the TXs in txBundle
+	if retry != nil && conflicting != 0 {
+		blockers = make([][]int, len(txBundle))
+		for g, deps := range buildTxDAG(rwLists, failed) {
+			for _, dep := range deps {
+				for _, idx := range groups[g] {
+					blockers[idx] = append(blockers[idx], groups[dep]...)
+				}
+			}
+		}
+		// a tx whose nonce is too large only reads its sender, so it gets no edge from the read/write lists
+		lastFailed := make(map[common.Address]int) // sender => the last tx of it which is not committed
+		for idx := range txBundle {
+			status := Runners[idx].Status
+			if status != types.FAILED_TO_COMMIT && status != types.TX_NONCE_TOO_LARGE {
+				continue
+			}
+			if prev, ok := lastFailed[txBundle[idx].From]; ok {
+				blockers[idx] = append(blockers[idx], prev)
+			}
+			lastFailed[txBundle[idx].From] = idx
 		}
-		idxChan <- indexAndBool{idx, canCommit}
 	}
-	idxChan <- indexAndBool{-1, false}
-	wg.Wait()
 
+	span = exec.startSpan(SpanWriteBack)
+	span.SetAttribute("kvs", int64(kvCount))
+	defer span.End()
 	trunk := exec.cleanCtx.Rbt.GetBaseStore()
 	trunk.Update(func(store storetypes.SetDeleter) {
+		if exec.supplyChecker != nil {
+			cow.ApplyPendingUpdatesAndObserve(store, exec.supplyChecker.observe)
+		} else {
+			cow.ApplyPendingUpdates(store)
+		}
+		if exec.storageQuota != nil {
+			exec.storageQuota.writeBack(store)
+		}
 		for idx, tx := range txBundle {
 			status := Runners[idx].Status
-			k := types.GetStandbyTxKey(txRange.start)
-			txRange.start++
-			store.Delete(k)
-			if status == types.FAILED_TO_COMMIT || status == types.TX_NONCE_TOO_LARGE {
+			if txRange != nil {
+				store.Delete(types.GetStandbyTxKey(txRange.start))
+				txRange.start++
+			}
+			if retry != nil && (status == types.FAILED_TO_COMMIT || status == types.TX_NONCE_TOO_LARGE) {
+				r := retryTx{tx: tx, seq: idx}
+				if blockers != nil {
+					r.blockers = blockers[idx]
+				}
+				*retry = append(*retry, r)
+				Runners[idx] = nil
+			} else if status == types.FAILED_TO_COMMIT || status == types.TX_NONCE_TOO_LARGE {
 				newK := types.GetStandbyTxKey(txRange.end)
 				txRange.end++
-				store.Set(newK, tx.ToBytes()) // insert the failed TXs back into standby queue
-				Runners[idx] = nil
-			} else if status == types.ACCOUNT_NOT_EXIST || status == types.TX_NONCE_TOO_SMALL {
-				//collect invalid tx`s all gas
-				exec.cumulativeGasUsed += Runners[idx].Tx.Gas
-				exec.cumulativeGasFee.Add(exec.cumulativeGasFee, Runners[idx].GetGasFee())
+				store.Set(newK, exec.txToBytes(&tx)) // insert the failed TXs back into standby queue
+				exec.indexQueuedTx(store, tx.HashID, newK)
+				exec.inFlight.add(&tx)
+				exec.requeuedCount++
 				Runners[idx] = nil
+			} else {
+				exec.unindexQueuedTx(store, tx.HashID) // it leaves the standby queue
+				if status == types.ACCOUNT_NOT_EXIST || status == types.TX_NONCE_TOO_SMALL {
+					//collect invalid tx`s all gas
+					exec.cumulativeGasUsed += Runners[idx].Tx.Gas
+					exec.addGasFee(Runners[idx])
+					Runners[idx] = nil
+				}
+			}
+		}
+		if txRange != nil {
+			for i := range exec.expiredTxs {
+				store.Delete(types.GetStandbyTxKey(txRange.start))
+				txRange.start++
+				exec.unindexQueuedTx(store, exec.expiredTxs[i].HashID)
+				exec.recordExpiredTx(&exec.expiredTxs[i])
 			}
 		}
 		for _, tx := range ignoreList {
@@ -702,21 +1539,120 @@ func (exec *txEngine) checkTxDepsAndUptStandbyQ(txRange *TxRange, txBundle, igno
 			txRange.start++
 			newK := types.GetStandbyTxKey(txRange.end)
 			txRange.end++
-			store.Set(newK, tx.ToBytes())
+			store.Set(newK, exec.txToBytes(&tx))
+			exec.indexQueuedTx(store, tx.HashID, newK)
+		}
+	})
+}
+
+// Scan the RabbitStores of the groups in parallel. Scanning and sorting the keys are the most
+// time-consuming parts of checkTxDepsAndUptStandbyQ, and they do not depend on each other.
+func (exec *txEngine) parallelCollectRWLists(groups [][]int) []rwList {
+	rwLists := make([]rwList, len(groups))
+	sharedIdx := int64(-1)
+	dt.ParallelRun(exec.parallelNum, func(_ int) {
+		for {
+			myIdx := atomic.AddInt64(&sharedIdx, 1)
+			if myIdx >= int64(len(groups)) {
+				return
+			}
+			rwLists[myIdx] = detguard.Twice("rwList.collect", func() rwList {
+				rwList := newRWList()
+				rwList.collect(Runners[groups[myIdx][0]].Ctx.Rbt)
+				return rwList
+			})
 		}
 	})
+	return rwLists
+}
+
+// Run the idx-th TX and recover from the panic in it, such that one bad TX does not kill the node.
+// The panicked TX gets the EXECUTION_PANIC status, and the Context of its group must be rebuilt by
+// recoverPanickedGroup.
+// The panics in the precompiled contracts and the native modules are recovered in their callbacks, which
+// fail the calls, because a Go panic must not unwind the C++ frames of evmone.
+func (exec *txEngine) runTxSafely(idx int, currBlock *types.BlockInfo) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			Runners[idx].Status = types.EXECUTION_PANIC
+			exec.logger.Error("Panic when running tx", "txHash", Runners[idx].Tx.HashID.String(),
+				"panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			panicked = true
+		}
+	}()
+	runTx(idx, currBlock)
+	return
+}
+
+// Rebuild the Context of a group after its p-th TX panics, because the shared Context may be broken by the
+// panic. The TXs before it run again on a new Context. Then the panicked TX is charged like a failed TX: its
+// nonce is consumed and all its gas is used, but none of its changes are kept. So the later TXs of its sender
+// are not blocked by a nonce gap. The TXs after it in the group go back to the standby queue.
+func (exec *txEngine) recoverPanickedGroup(group []int, p int, cow *types.CowBaseStore, currBlock *types.BlockInfo) {
+	Runners[group[0]].Ctx.Rbt.CloseAndWriteBack(false)
+	ctx := exec.cleanCtx.WithCowRbtCopy(cow)
+	var slotDeltas map[uint64]int64
+	if exec.storageQuota != nil {
+		slotDeltas = make(map[uint64]int64)
+	}
+	for i, idx := range group {
+		status := Runners[idx].Status
+		Runners[idx] = NewTxRunner(ctx, Runners[idx].Tx)
+		Runners[idx].storageQuota, Runners[idx].slotDeltas = exec.storageQuota, slotDeltas
+		Runners[idx].tracer = exec.tracer
+		if i < p {
+			if status == types.TX_NONCE_TOO_LARGE {
+				Runners[idx].Status = status // it was not run
+			} else if exec.runTxSafely(idx, currBlock) {
+				exec.recoverPanickedGroup(group, i, cow, currBlock)
+				return
+			}
+		} else if i == p {
+			chargePanickedTx(Runners[idx])
+		} else {
+			Runners[idx].Status = types.FAILED_TO_COMMIT
+		}
+	}
+}
+
+func chargePanickedTx(runner *TxRunner) {
+	runner.Status = types.EXECUTION_PANIC
+	runner.GasUsed = runner.Tx.Gas // the gas fee was deducted in Prepare, and nothing is refunded
+	acc, err := runner.Ctx.CheckNonce(runner.Tx.From, runner.Tx.Nonce)
+	if err == nil && acc != nil {
+		acc.UpdateNonce(acc.Nonce() + 1)
+		runner.Ctx.SetAccount(runner.Tx.From, acc)
+	}
+}
+
+// Run the idx-th TX again without aborting, and return its read/write list. cow still has the state
+// before this round, which the other runners see.
+func (exec *txEngine) rerunTx(idx int, cow *types.CowBaseStore, currBlock *types.BlockInfo) rwList {
+	Runners[idx].Ctx.Rbt.CloseAndWriteBack(false)
+	Runners[idx] = NewTxRunner(exec.cleanCtx.WithCowRbtCopy(cow), Runners[idx].Tx)
+	Runners[idx].storageQuota = exec.storageQuota
+	if exec.storageQuota != nil {
+		Runners[idx].slotDeltas = make(map[uint64]int64)
+	}
+	Runners[idx].tracer = exec.tracer
+	// nothing is published in the fresh hints, but the recipient is read as in the other runners
+	Runners[idx].hintIdx, Runners[idx].hints = idx, newConflictHints()
+	if exec.runTxSafely(idx, currBlock) {
+		exec.recoverPanickedGroup([]int{idx}, 0, cow, currBlock)
+	}
+	rwList := newRWList()
+	rwList.collect(Runners[idx].Ctx.Rbt)
+	return rwList
 }
 
 // Fill 'exec.committedTxs' with 'committableRunnerList'
 func (exec *txEngine) collectCommittableTxs(committableRunnerList []*TxRunner) {
-	var logIndex uint
-	for idx, runner := range committableRunnerList {
+	for _, runner := range committableRunnerList {
 		exec.cumulativeGasUsed += runner.GasUsed
 		exec.cumulativeFeeRefund.Add(exec.cumulativeFeeRefund, &runner.FeeRefund)
-		exec.cumulativeGasFee.Add(exec.cumulativeGasFee, runner.GetGasFee())
+		exec.addGasFee(runner)
 		tx := &types.Transaction{
 			Hash:              runner.Tx.HashID,
-			TransactionIndex:  int64(idx),
 			Nonce:             runner.Tx.Nonce,
 			BlockHash:         exec.currentBlock.Hash,
 			BlockNumber:       exec.currentBlock.Number,
@@ -729,17 +1665,23 @@ func (exec *txEngine) collectCommittableTxs(committableRunnerList []*TxRunner) {
 			CumulativeGasUsed: exec.cumulativeGasUsed,
 			GasUsed:           runner.GasUsed,
 			ContractAddress:   runner.CreatedContractAddress, //20 Bytes - the contract address created, if the transaction was a contract creation, otherwise - null.
-			OutData:           append([]byte{}, runner.OutData...),
+			OutData:           exec.capOutData(runner.OutData),
 			Status:            gethtypes.ReceiptStatusSuccessful,
 			StatusStr:         StatusToStr(runner.Status),
 			InternalTxCalls:   runner.InternalTxCalls,
 			InternalTxReturns: runner.InternalTxReturns,
 			RwLists:           runner.RwLists,
+			Type:              runner.Tx.Type,
+			EffectiveGasPrice: runner.Tx.GasPrice, // min(GasFeeCap, BaseFee+GasTipCap) for a dynamic fee tx
 		}
 		exec.logger.Debug("collectCommittableTxs:", "status", tx.StatusStr, "hash", common.Hash(tx.Hash).String())
 		if StatusIsFailure(runner.Status) {
 			tx.Status = gethtypes.ReceiptStatusFailed
 		}
+		if StatusIsRevert(runner.Status) {
+			tx.RevertReason, _ = types.UnpackRevertReason(runner.OutData) // decoded before truncation
+		}
+		tx.OutDataTruncated = len(tx.OutData) < len(runner.OutData)
 		tx.Logs = make([]types.Log, len(runner.Logs))
 		for i, log := range runner.Logs {
 			copy(tx.Logs[i].Address[:], log.Address[:])
@@ -752,14 +1694,18 @@ func (exec *txEngine) collectCommittableTxs(committableRunnerList []*TxRunner) {
 			tx.Logs[i].BlockNumber = uint64(exec.currentBlock.Number)
 			copy(tx.Logs[i].BlockHash[:], exec.currentBlock.Hash[:])
 			copy(tx.Logs[i].TxHash[:], tx.Hash[:])
-			//txIndex = index in committableRunnerList
-			tx.Logs[i].TxIndex = uint(idx)
-			tx.Logs[i].Index = logIndex
-			logIndex++
 			tx.Logs[i].Removed = false
 		}
 		tx.LogsBloom = LogsBloom(tx.Logs)
-		exec.committedTxs = append(exec.committedTxs, tx)
+		exec.appendCommittedTx(tx)
+		if exec.recentHashes != nil && runner.Status != types.IGNORE_TOO_OLD_TX {
+			exec.executedHashes = append(exec.executedHashes, tx.Hash)
+		}
+		if exec.hotAccounts != nil {
+			exec.hotAccounts.Touch(tx.From)
+			exec.hotAccounts.Touch(tx.To)
+			exec.hotAccounts.Touch(tx.ContractAddress)
+		}
 	}
 }
 
@@ -796,32 +1742,144 @@ func (exec *txEngine) CommittedTxIds() [][32]byte {
 func (exec *txEngine) CommittedTxsForMoDB() []modbtypes.Tx {
 	txList := make([]modbtypes.Tx, len(exec.committedTxs))
 	for i, tx := range exec.committedTxs {
-		t := modbtypes.Tx{}
-		copy(t.HashId[:], tx.Hash[:])
-		copy(t.SrcAddr[:], tx.From[:])
-		copy(t.DstAddr[:], tx.To[:])
-		txContent, err := tx.MarshalMsg(nil)
-		if err != nil {
-			panic(err)
-		}
-		t.Content = txContent
-		t.LogList = make([]modbtypes.Log, len(tx.Logs))
-		for j, l := range tx.Logs {
-			copy(t.LogList[j].Address[:], l.Address[:])
-			if len(l.Topics) != 0 {
-				t.LogList[j].Topics = make([][32]byte, len(l.Topics))
-			}
-			for k, topic := range l.Topics {
-				copy(t.LogList[j].Topics[k][:], topic[:])
-			}
+		txList[i] = TxForMoDB(exec.dataRetention.apply(tx))
+	}
+	return txList
+}
+
+// Call fn with the committed TXs one by one, in the order of their indexes, until fn returns an error,
+// which is returned. tx has the full data, while the data in modbTx are limited by the DataRetention.
+// Unlike CommittedTxsForMoDB, the records of MoDB are built one at a time, such that the host can persist
+// the TXs of a very large block without another copy of all the TXs in memory.
+func (exec *txEngine) EachCommittedTx(fn func(tx *types.Transaction, modbTx modbtypes.Tx) error) error {
+	for _, tx := range exec.committedTxs {
+		if err := fn(tx, TxForMoDB(exec.dataRetention.apply(tx))); err != nil {
+			return err
 		}
-		txList[i] = t
+	}
+	return nil
+}
+
+// Convert the TXs into the records of MoDB, which index them by sender, recipient and logs
+func TxsForMoDB(txs []*types.Transaction) []modbtypes.Tx {
+	txList := make([]modbtypes.Tx, len(txs))
+	for i, tx := range txs {
+		txList[i] = TxForMoDB(tx)
 	}
 	return txList
 }
 
+// Convert a TX into the record of MoDB
+func TxForMoDB(tx *types.Transaction) modbtypes.Tx {
+	t := modbtypes.Tx{}
+	copy(t.HashId[:], tx.Hash[:])
+	copy(t.SrcAddr[:], tx.From[:])
+	copy(t.DstAddr[:], tx.To[:])
+	txContent, err := tx.MarshalMsg(nil)
+	if err != nil {
+		panic(err)
+	}
+	t.Content = txContent
+	t.LogList = make([]modbtypes.Log, len(tx.Logs))
+	for j, l := range tx.Logs {
+		copy(t.LogList[j].Address[:], l.Address[:])
+		if len(l.Topics) != 0 {
+			t.LogList[j].Topics = make([][32]byte, len(l.Topics))
+		}
+		for k, topic := range l.Topics {
+			copy(t.LogList[j].Topics[k][:], topic[:])
+		}
+	}
+	return t
+}
+
+// Collect tx into txList. The recent hashes are not checked here, because the TXs of a block must be
+// collected in the same way by all the nodes; the duplicated TXs are dropped in Prepare.
 func (exec *txEngine) CollectTx(tx *gethtypes.Transaction) {
 	exec.txList = append(exec.txList, tx)
+	exec.pendingNonces.collect(tx)
+}
+
+// Collect a tx which will be executed no earlier than the block at height notBefore. If it is not due in the
+// next block, it waits in the scheduled queue and is moved to the end of standby queue at that height. Like
+// the other TXs, it occupies its nonce once it is prepared, so the sender's TXs with larger nonces cannot be
+// executed before it.
+func (exec *txEngine) CollectScheduledTx(tx *gethtypes.Transaction, notBefore uint64) {
+	exec.CollectTx(tx)
+	if notBefore != 0 {
+		if exec.txNotBefore == nil {
+			exec.txNotBefore = make(map[int]uint64)
+		}
+		exec.txNotBefore[len(exec.txList)-1] = notBefore
+	}
+}
+
+// Drop the TXs in txList which are in standby queue or scheduled queue, or collected before in txList, without
+// receipts, such that a TX resubmitted to a block does not fail with an incorrect nonce. It only depends on
+// txList and world state, so all the nodes drop the same TXs. The queues are looked up by the index of hashes,
+// so the cost is linear to the length of txList.
+func (exec *txEngine) dropDuplicateTxs() {
+	if !exec.dropDuplicates || len(exec.txList) == 0 {
+		return
+	}
+	seen := make(map[common.Hash]struct{}, len(exec.txList))
+	ctx := exec.cleanCtx.WithRbtCopy()
+	defer ctx.Close(false)
+	txList := exec.txList[:0]
+	var txNotBefore map[int]uint64
+	for i, tx := range exec.txList {
+		hash := tx.Hash()
+		if _, ok := seen[hash]; ok || isQueuedTx(ctx.Rbt.GetBaseStore(), hash) {
+			continue
+		}
+		seen[hash] = struct{}{}
+		if notBefore, ok := exec.txNotBefore[i]; ok {
+			if txNotBefore == nil {
+				txNotBefore = make(map[int]uint64)
+			}
+			txNotBefore[len(txList)] = notBefore
+		}
+		txList = append(txList, tx)
+	}
+	exec.txList, exec.txNotBefore = txList, txNotBefore
+}
+
+// Check whether tx can be collected, without collecting it. If recent hashes are tracked, a tx which is
+// already queued or recently committed is rejected with ErrAlreadyKnown.
+func (exec *txEngine) ValidateTx(tx *gethtypes.Transaction) error {
+	if exec.isTooLarge(tx) {
+		return errors.ErrTxTooLarge
+	}
+	if exec.recentHashes == nil {
+		return nil
+	}
+	if exec.recentHashes.Contains(tx.Hash()) {
+		return errors.ErrAlreadyKnown
+	}
+	return nil
+}
+
+func (exec *txEngine) txToBytes(tx *types.TxToRun) []byte {
+	if exec.compressThreshold != 0 && len(tx.Data) > exec.compressThreshold {
+		return tx.ToCompressedBytes()
+	}
+	return tx.ToBytes()
+}
+
+func (exec *txEngine) isTooLarge(tx *gethtypes.Transaction) bool {
+	return exec.maxTxSize != 0 && uint64(tx.Size()) > exec.maxTxSize
+}
+
+// Only the executed TXs are recorded as committed. The other TXs with receipts, such as the invalid, evicted
+// and expired ones, do not consume their nonces and can be valid when they are submitted again, so they
+// just leave the queued ones.
+func (exec *txEngine) recordCommittedHashes() {
+	hashes := make([]common.Hash, len(exec.committedTxs))
+	for i, tx := range exec.committedTxs {
+		hashes[i] = tx.Hash
+	}
+	exec.recentHashes.removeQueued(hashes)
+	exec.recentHashes.AddBlock(exec.currentBlock.Number, exec.executedHashes)
 }
 
 func (exec *txEngine) CollectedTxsCount() int {
@@ -835,6 +1893,14 @@ func (exec *txEngine) GasUsedInfo() (gasUsed uint64, feeRefund, gasFee uint256.I
 	return exec.cumulativeGasUsed, *exec.cumulativeFeeRefund, *exec.cumulativeGasFee
 }
 
+// Returns a copy of outData, truncated to maxOutDataSize
+func (exec *txEngine) capOutData(outData []byte) []byte {
+	if exec.maxOutDataSize != 0 && uint64(len(outData)) > exec.maxOutDataSize {
+		outData = outData[:exec.maxOutDataSize]
+	}
+	return append([]byte{}, outData...)
+}
+
 func (exec *txEngine) StandbyQLen() int {
 	s, e := exec.getStandbyQueueRange()
 	return int(e - s)
@@ -882,7 +1948,7 @@ func updateBalance(ctx *types.Context, address common.Address, amount *uint256.I
 		acc.UpdateBalance(s.Add(s, amount))
 	} else {
 		if s.Cmp(amount) < 0 {
-			return errors.New("balance not enough")
+			return errors.ErrBalanceNotEnough
 		}
 		acc.UpdateBalance(s.Sub(s, amount))
 	}
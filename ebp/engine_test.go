@@ -80,6 +80,15 @@ func prepareAccAndTx(e *txEngine) []*gethtypes.Transaction {
 	return []*gethtypes.Transaction{tx1, tx2}
 }
 
+// Returns an engine with a new Context on trunk, after the accounts are prepared by prepareAccAndTx
+func prepareEngine(trunk *store.TrunkStore) (*txEngine, []*gethtypes.Transaction) {
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	txs := prepareAccAndTx(e)
+	e.SetContext(prepareCtx(trunk))
+	return e, txs
+}
+
 /*
 testcase:
 account1 send txs(nonce): 0
@@ -248,8 +257,10 @@ func TestRandomTxExecuteConsistent(t *testing.T) {
 	defer closeTestCtx(root)
 	randomTxs := generateRandomTx(&testcase.DumbSigner{})
 	for i := 100; i > 0; i-- {
-		r1 := executeTxs(randomTxs, root.GetTrunkStore(1000).(*store.TrunkStore))
-		r2 := executeTxs(randomTxs, root.GetTrunkStore(1000).(*store.TrunkStore))
+		r1 := executeTxs(randomTxs, root.GetTrunkStore(1000).(*store.TrunkStore), nil)
+		r2 := executeTxs(randomTxs, root.GetTrunkStore(1000).(*store.TrunkStore), func(e *txEngine) {
+			e.SetEarlyConflictHints(i%2 == 0)
+		})
 		//check txs
 		require.Equal(t, len(r1.standbyTxs), len(r2.standbyTxs))
 		for i, tx1 := range r1.standbyTxs {
@@ -299,8 +310,11 @@ type executeResult struct {
 	txR          *TxRange
 }
 
-func executeTxs(randomTxs []*gethtypes.Transaction, trunk *store.TrunkStore) executeResult {
+func executeTxs(randomTxs []*gethtypes.Transaction, trunk *store.TrunkStore, setup func(e *txEngine)) executeResult {
 	e := NewEbpTxExec(2000, 200, 30, 2000, &testcase.DumbSigner{}, log.NewNopLogger())
+	if setup != nil {
+		setup(e)
+	}
 	e.SetContext(prepareCtx(trunk))
 	_ = prepareAccAndTx(e)
 	e.SetContext(prepareCtx(trunk))
@@ -486,8 +500,8 @@ func TestConsistentForDebug(t *testing.T) {
 	txs[7] = tx
 	tx, _ = gethtypes.NewTransaction(3, to2, big.NewInt(109), 100000, big.NewInt(1), nil).WithSignature(signer, from2.Bytes())
 	txs[8] = tx
-	executeTxs(txs, trunk)
-	//r := executeTxs(txs, trunk)
+	executeTxs(txs, trunk, nil)
+	//r := executeTxs(txs, trunk, nil)
 	//fmt.Println(r.from1.Balance().Uint64())
 	//fmt.Println(r.from2.Balance().Uint64())
 	//fmt.Println(r.to1.Balance().Uint64())
@@ -0,0 +1,56 @@
+package ebp
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// EstimateGas returns the minimal gas limit with which msg succeeds, by binary searching between the intrinsic
+// gas and a cap, which is msg.Gas, or the gas limit of currBlock if msg.Gas is zero. If msg fails with the
+// cap, a RevertError is returned if it is reverted, errors.ErrGasExceedsAllowance if it runs out of gas, and
+// another error for the other failures.
+func EstimateGas(ctx *types.Context, msg ethereum.CallMsg, currBlock *types.BlockInfo) (uint64, error) {
+	hi := msg.Gas
+	if hi == 0 {
+		hi = uint64(currBlock.GasLimit)
+	}
+	if hi == 0 {
+		hi = DefaultTxGasLimit
+	}
+	intrinsic, err := core.IntrinsicGas(msg.Data, msg.AccessList, msg.To == nil, true, true)
+	if err != nil {
+		return 0, err
+	}
+	if intrinsic > hi {
+		return 0, fmt.Errorf("%w (%d < intrinsic gas %d)", errors.ErrGasExceedsAllowance, hi, intrinsic)
+	}
+	run := func(gas uint64) CallResult {
+		msg.Gas = gas
+		return ExecuteReadOnly(ctx, msg, currBlock)
+	}
+	if res := run(hi); res.Failed() {
+		if res.Reverted {
+			return 0, NewRevertError(res.OutData)
+		} else if StatusIsOutOfGas(res.Status) {
+			return 0, fmt.Errorf("%w (%d)", errors.ErrGasExceedsAllowance, hi)
+		}
+		return 0, fmt.Errorf("execution failed: %s", StatusToStr(res.Status))
+	}
+	// it fails with lo and succeeds with hi. Any failure below hi, including a revert, is taken as a sign
+	// of too little gas, because a contract may revert when gasleft() is not enough.
+	lo := intrinsic - 1
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		if run(mid).Failed() {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi, nil
+}
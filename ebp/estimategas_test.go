@@ -0,0 +1,59 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// It runs out of gas if its gas limit is less than 60000
+type gasHungryExecutor struct{ panicExecutor }
+
+func (ge gasHungryExecutor) Execute(ctx *types.Context, currBlock *types.BlockInfo, tx *types.TxToRun) (int, []types.EvmLog, uint64, []byte) {
+	if tx.Gas < 60000 {
+		return 3 /*EVMC_OUT_OF_GAS*/, nil, tx.Gas, nil
+	}
+	return 0, nil, 60000, nil
+}
+
+func TestEstimateGas(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	blk := &types.BlockInfo{Number: 1}
+
+	identity := common.BytesToAddress([]byte{4})
+	msg := ethereum.CallMsg{From: from1, To: &identity, Data: make([]byte, 100)}
+	gas, err := EstimateGas(ctx, msg, blk)
+	require.NoError(t, err)
+	msg.Gas = gas
+	require.False(t, ExecuteReadOnly(ctx, msg, blk).Failed())
+	msg.Gas = gas - 1
+	require.True(t, ExecuteReadOnly(ctx, msg, blk).Failed())
+
+	hungryAddr := common.HexToAddress("0x2712")
+	PredefinedContractManager[hungryAddr] = gasHungryExecutor{}
+	defer delete(PredefinedContractManager, hungryAddr)
+	gas, err = EstimateGas(ctx, ethereum.CallMsg{From: from1, To: &hungryAddr}, blk)
+	require.NoError(t, err)
+	require.Equal(t, uint64(60000), gas)
+	_, err = EstimateGas(ctx, ethereum.CallMsg{From: from1, To: &hungryAddr, Gas: 50000}, blk)
+	require.ErrorIs(t, err, errors.ErrGasExceedsAllowance)
+	_, err = EstimateGas(ctx, ethereum.CallMsg{From: from1, To: &hungryAddr, Gas: 20000}, blk)
+	require.ErrorIs(t, err, errors.ErrGasExceedsAllowance) // below the intrinsic gas
+
+	revertAddr := common.HexToAddress("0x2711")
+	PredefinedContractManager[revertAddr] = revertExecutor{}
+	defer delete(PredefinedContractManager, revertAddr)
+	_, err = EstimateGas(ctx, ethereum.CallMsg{From: from1, To: &revertAddr, Data: []byte("reason")}, blk)
+	require.ErrorIs(t, err, errors.ErrExecutionReverted)
+	var revertErr *RevertError
+	require.True(t, errors.As(err, &revertErr))
+	require.Equal(t, []byte("reason"), revertErr.Data)
+}
@@ -0,0 +1,70 @@
+package ebp
+
+import (
+	"fmt"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// RevertError is returned when a call is reverted, errors.Is(err, errors.ErrExecutionReverted) holds for it
+type RevertError struct {
+	Data   []byte // the revert data
+	Reason string // decoded from Data, empty if Data is neither Error(string) nor Panic(uint256)
+}
+
+func NewRevertError(data []byte) *RevertError {
+	reason, _ := types.UnpackRevertReason(data)
+	return &RevertError{Data: data, Reason: reason}
+}
+
+// The same as the error message of geth if the reason is decoded
+func (e *RevertError) Error() string {
+	if len(e.Reason) != 0 {
+		return fmt.Sprintf("%s: %s", errors.ErrExecutionReverted, e.Reason)
+	}
+	return fmt.Sprintf("%s: 0x%x", errors.ErrExecutionReverted, e.Data)
+}
+
+func (e *RevertError) Unwrap() error {
+	return errors.ErrExecutionReverted
+}
+
+// ExecutionError is a failure other than reverting, errors.Is(err, errors.ErrOutOfGas) holds for it if the
+// gas runs out, and errors.Is(err, errors.ErrWriteProtection) holds for it if the state is modified in a
+// static context
+type ExecutionError struct {
+	Status int
+}
+
+func (e *ExecutionError) Error() string {
+	return callFrameError(e.Status)
+}
+
+func (e *ExecutionError) Unwrap() error {
+	if StatusIsOutOfGas(e.Status) {
+		return errors.ErrOutOfGas
+	} else if StatusIsStaticViolation(e.Status) {
+		return errors.ErrWriteProtection
+	}
+	return nil
+}
+
+// Returns nil for success, a RevertError for reverting, and an ExecutionError for the other failures.
+// outData is the output of the tx or the call.
+func StatusToError(status int, outData []byte) error {
+	if !StatusIsFailure(status) {
+		return nil
+	} else if StatusIsRevert(status) {
+		return NewRevertError(outData)
+	}
+	return &ExecutionError{Status: status}
+}
+
+func (res CallResult) Err() error {
+	return StatusToError(res.Status, res.OutData)
+}
+
+func (runner *TxRunner) Err() error {
+	return StatusToError(runner.Status, runner.OutData)
+}
@@ -0,0 +1,34 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/errors"
+)
+
+func TestStatusToError(t *testing.T) {
+	require.NoError(t, StatusToError(0, []byte{1}))
+
+	data := hexutil.MustDecode("0x4e487b710000000000000000000000000000000000000000000000000000000000000001")
+	err := StatusToError(2 /*EVMC_REVERT*/, data)
+	require.ErrorIs(t, err, errors.ErrExecutionReverted)
+	require.Equal(t, "execution reverted: panic: assert(false) (0x1)", err.Error())
+	var revertErr *RevertError
+	require.True(t, errors.As(err, &revertErr))
+	require.Equal(t, data, revertErr.Data)
+	require.Equal(t, "execution reverted: 0x0102", StatusToError(2, []byte{1, 2}).Error())
+
+	err = (&TxRunner{Status: 3 /*EVMC_OUT_OF_GAS*/}).Err()
+	require.ErrorIs(t, err, errors.ErrOutOfGas)
+	require.Equal(t, "out of gas", err.Error())
+	err = CallResult{Status: 5 /*EVMC_UNDEFINED_INSTRUCTION*/}.Err()
+	require.False(t, errors.Is(err, errors.ErrOutOfGas))
+	require.Equal(t, "invalid opcode", err.Error())
+	err = CallResult{Status: 11 /*EVMC_STATIC_MODE_VIOLATION*/}.Err()
+	require.ErrorIs(t, err, errors.ErrWriteProtection)
+	require.True(t, StatusIsStaticViolation(11))
+	require.Equal(t, "write protection", err.Error())
+}
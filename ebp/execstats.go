@@ -0,0 +1,88 @@
+package ebp
+
+import (
+	"time"
+)
+
+// BlockExecStats reports how Execute ran a block, which is useful for tuning roundNum, runnerNumber and
+// parallelNum in production. The wall-clock times are measured on this node and never affect consensus.
+type BlockExecStats struct {
+	Height   int64
+	Duration time.Duration // the wall-clock time of Execute
+	// the total wall-clock time of each phase in Execute, keyed by the span names such as SpanRunTxs
+	PhaseTimes map[string]time.Duration
+	Rounds     []RoundExecStats
+	// the short keys of RabbitStore read and written by the TXs, including the ones not committed
+	RabbitReads  int
+	RabbitWrites int
+	// the most entries appended to the standby queue in one round
+	MaxQueueGrowth int
+}
+
+type RoundExecStats struct {
+	Loaded    int // the TXs loaded from the standby queue
+	Committed int // including the failed ones, whose gas fees are still charged
+	Failed    int
+	Requeued  int // inserted back into the standby queue because of the conflicts
+	// the entries appended to the standby queue, which are the requeued TXs and the ones ignored in loading
+	QueueGrowth int
+}
+
+// It is only set during Execute, such that the phases of Prepare are not timed
+type execStatsCollector struct {
+	stats BlockExecStats
+	start time.Time
+}
+
+func newExecStatsCollector(height int64) *execStatsCollector {
+	return &execStatsCollector{
+		stats: BlockExecStats{Height: height, PhaseTimes: make(map[string]time.Duration)},
+		start: time.Now(),
+	}
+}
+
+type timedSpan struct {
+	Span
+	c     *execStatsCollector
+	name  string
+	start time.Time
+}
+
+func (s *timedSpan) End() {
+	s.c.stats.PhaseTimes[s.name] += time.Since(s.start)
+	s.Span.End()
+}
+
+func (c *execStatsCollector) timeSpan(name string, span Span) Span {
+	return &timedSpan{Span: span, c: c, name: name, start: time.Now()}
+}
+
+func (c *execStatsCollector) addRWList(rwList rwList) {
+	if c == nil {
+		return
+	}
+	c.stats.RabbitReads += len(rwList.rList)
+	c.stats.RabbitWrites += len(rwList.wList)
+}
+
+// committed are the runners committed in the round
+func (c *execStatsCollector) addRound(loaded int, committed []*TxRunner, requeued, queueGrowth int) {
+	if c == nil {
+		return
+	}
+	round := RoundExecStats{Loaded: loaded, Committed: len(committed), Requeued: requeued, QueueGrowth: queueGrowth}
+	for _, runner := range committed {
+		if StatusIsFailure(runner.Status) {
+			round.Failed++
+		}
+	}
+	c.stats.Rounds = append(c.stats.Rounds, round)
+	if queueGrowth > c.stats.MaxQueueGrowth {
+		c.stats.MaxQueueGrowth = queueGrowth
+	}
+}
+
+func (c *execStatsCollector) finish() BlockExecStats {
+	c.stats.Duration = time.Since(c.start)
+	return c.stats
+}
@@ -0,0 +1,49 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestBlockExecStats(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, _ := prepareEngine(trunk)
+	// they conflict on the balance of from3, so the second one is requeued and committed in the next round
+	tx1, _ := gethtypes.NewTransaction(0, from3, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	tx2, _ := gethtypes.NewTransaction(0, from3, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from2.Bytes())
+	e.CollectTx(tx1)
+	e.CollectTx(tx2)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	stats := e.Execute(&types.BlockInfo{Number: 2})
+	require.Equal(t, 2, len(e.committedTxs))
+	e.cleanCtx.Close(false)
+
+	require.Equal(t, int64(2), stats.Height)
+	require.Equal(t, []RoundExecStats{
+		{Loaded: 2, Committed: 1, Requeued: 1, QueueGrowth: 1},
+		{Loaded: 1, Committed: 1},
+	}, stats.Rounds)
+	require.Equal(t, 1, stats.MaxQueueGrowth)
+	require.Zero(t, stats.RabbitReads) // all the keys touched by the transfers are written
+	require.Positive(t, stats.RabbitWrites)
+	require.Positive(t, stats.Duration)
+	for _, name := range []string{SpanRound, SpanRunTxs, SpanCheckConflicts, SpanWriteBack} {
+		require.Contains(t, stats.PhaseTimes, name)
+	}
+	require.NotContains(t, stats.PhaseTimes, SpanReadAccounts) // Prepare is not timed
+
+	// an empty block has no rounds
+	e.SetContext(prepareCtx(trunk))
+	stats = e.Execute(&types.BlockInfo{Number: 3})
+	e.cleanCtx.Close(false)
+	require.Equal(t, int64(3), stats.Height)
+	require.Empty(t, stats.Rounds)
+}
@@ -12,13 +12,22 @@ import (
 type TxExecutor interface {
 	SetAotParam(aotDir string, aotReloadInterval int64)
 	SetCheckRWInLoading(b bool)
+	WarmUp(n int)
 
 	//step 1: for deliverTx, collect block txs in engine.txList
 	CollectTx(tx *gethtypes.Transaction)
+	CollectScheduledTx(tx *gethtypes.Transaction, notBefore uint64)
+	ValidateTx(tx *gethtypes.Transaction) error
+	CollectResurrection(addr common.Address, witness []byte) error
+	ReserveNonces(addr common.Address, count uint64) (first uint64, err error)
+	//governance: must be called on all the nodes at the same height, before Prepare
+	SetMinGasPriceTarget(target uint64)
 	//step 2: for commit, check sig, insert regular txs standbyTxQ
 	Prepare(reorderSeed int64, minGasPrice, maxTxGasLimit uint64) Frontier
 	//step 3: for postCommit, parallel execute tx in standbyTxQ
-	Execute(currBlock *types.BlockInfo)
+	//currBlock is not changed and is kept until the next Execute, the base fee used is in BlockResults.
+	//The returned stats are measured on this node and must not affect consensus.
+	Execute(currBlock *types.BlockInfo) BlockExecStats
 
 	//set context
 	SetContext(ctx *types.Context)
@@ -29,8 +38,18 @@ type TxExecutor interface {
 	CommittedTxs() []*types.Transaction
 	CommittedTxIds() [][32]byte
 	CommittedTxsForMoDB() []modbtypes.Tx
+	EachCommittedTx(fn func(tx *types.Transaction, modbTx modbtypes.Tx) error) error
+	// gasFee does not include the base fees burnt in BlockResults
 	GasUsedInfo() (gasUsed uint64, feeRefund, gasFee uint256.Int)
+	BlockResults() BlockResults
+	NextBaseFee() *uint256.Int
+	MinGasPrice() (minGasPrice uint64, ok bool)
 	StandbyQLen() int
+	SimulateNextBlock(currBlock *types.BlockInfo) *BlockSimulation
+	QueuedTxStatus(hash common.Hash) (QueuedTxStatus, bool)
+	IterateStandbyTxs(start, limit int) (txs []StandbyTx, queueLen int)
+	DropStandbyTx(hash common.Hash) (*types.TxToRun, bool)
+	FlushStandbyTxs() []types.TxToRun
 }
 
 type Frontier interface {
@@ -0,0 +1,152 @@
+package ebp
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// StateExpiry is a prototype of archiving the inactive accounts to control the growth of world state.
+// After each block, the externally owned accounts which have not been touched for inactiveBlocks blocks
+// are removed from world state, leaving only the hashes of their records. The full records are kept in
+// the archive KVStore, from which a node can serve them as witnesses. To resurrect an archived account,
+// its witness is submitted with CollectResurrection, and it is restored in the next Prepare.
+//
+// Which accounts are archived depends on the watermarks and the archive, so all the nodes must enable it
+// at the same height with empty stores, and must never lose them. It is a consensus parameter.
+type StateExpiry struct {
+	inactiveBlocks int64
+	watermarks     *ActivityWatermarks
+	archive        KVStore // also stores the accounts touched at each height
+}
+
+func NewStateExpiry(inactiveBlocks int64, watermarks *ActivityWatermarks, archive KVStore) *StateExpiry {
+	return &StateExpiry{
+		inactiveBlocks: inactiveBlocks,
+		watermarks:     watermarks,
+		archive:        archive,
+	}
+}
+
+func touchedAtKey(height int64) []byte {
+	bz := make([]byte, 3+8)
+	copy(bz, "se-")
+	binary.BigEndian.PutUint64(bz[3:], uint64(height))
+	return bz
+}
+
+func archivedRecordKey(addr common.Address) []byte {
+	return append([]byte("sa-"), addr[:]...)
+}
+
+// Returns the record of the archived account at addr, which is the witness to resurrect it, or nil
+func (se *StateExpiry) Witness(addr common.Address) []byte {
+	return se.archive.Get(archivedRecordKey(addr))
+}
+
+// The system accounts and the precompiled contracts are never archived
+func isExpirable(addr common.Address) bool {
+	return !bytes.Equal(addr[:8], make([]byte, 8)) && addr != Sep206Address && addr != BlockedAddress
+}
+
+type resurrection struct {
+	addr    common.Address
+	witness []byte
+}
+
+// Collect the witness of an archived account, which is restored in the next Prepare, before the TXs
+// are checked. The witness is only checked against the hash in world state there.
+func (exec *txEngine) CollectResurrection(addr common.Address, witness []byte) error {
+	if exec.stateExpiry == nil || len(witness) != len(types.ZeroAccountInfo().Bytes()) {
+		return errors.ErrInvalidWitness
+	}
+	exec.resurrections = append(exec.resurrections, resurrection{addr: addr, witness: witness})
+	return nil
+}
+
+// If an account has been created again at an archived address, the archived balance is added to it
+func (exec *txEngine) resurrectAccounts() {
+	ctx := exec.cleanCtx.WithRbtCopy()
+	for _, r := range exec.resurrections {
+		k := types.GetArchivedAccountKey(r.addr)
+		if !bytes.Equal(ctx.Rbt.Get(k), crypto.Keccak256(r.witness)) {
+			exec.logger.Debug("resurrectAccounts: invalid witness", "addr", r.addr.String())
+			continue
+		}
+		acc := types.NewAccountInfo(append([]byte{}, r.witness...))
+		if curr := ctx.GetAccount(r.addr); curr != nil {
+			mergeArchivedAccount(acc, curr)
+		}
+		ctx.SetAccount(r.addr, acc)
+		ctx.Rbt.Delete(k)
+		exec.resurrected = append(exec.resurrected, r.addr)
+	}
+	ctx.Close(true)
+	exec.resurrections = nil
+}
+
+// Merge the account created again at an archived address into the archived one, adding their balances and
+// taking the larger nonce
+func mergeArchivedAccount(archived, curr *types.AccountInfo) {
+	balance := curr.Balance()
+	archived.UpdateBalance(balance.Add(balance, archived.Balance()))
+	if curr.Nonce() > archived.Nonce() {
+		archived.UpdateNonce(curr.Nonce())
+	}
+	archived.UpdateSequence(curr.Sequence())
+}
+
+// Record the accounts touched in this block, and archive the ones whose last activity was inactiveBlocks
+// blocks ago. The resurrected accounts are regarded as touched. An account created again at an archived
+// address, and not resurrected, is merged into the archived record when it is archived again.
+func (exec *txEngine) expireAccounts() {
+	se := exec.stateExpiry
+	height := exec.currentBlock.Number
+	touched := append(touchedAccounts(exec.committedTxs), exec.resurrected...)
+	exec.resurrected = nil
+	se.watermarks.Touch(height, touched)
+	bz := make([]byte, 0, len(touched)*20)
+	for _, addr := range touched {
+		bz = append(bz, addr[:]...)
+	}
+	se.archive.Set(touchedAtKey(height), bz)
+
+	inactiveHeight := height - se.inactiveBlocks
+	bz = se.archive.Get(touchedAtKey(inactiveHeight))
+	if inactiveHeight <= 0 || len(bz) == 0 {
+		return
+	}
+	ctx := exec.cleanCtx.WithRbtCopy()
+	for i := 0; i+20 <= len(bz); i += 20 {
+		addr := common.BytesToAddress(bz[i : i+20])
+		if wm, ok := se.watermarks.Get(addr); !ok || wm.LastActive != inactiveHeight || !isExpirable(addr) {
+			continue
+		}
+		acc := ctx.GetAccount(addr)
+		if acc == nil || ctx.GetCode(addr) != nil {
+			continue // the contracts are not archived, because their storage would be left behind
+		}
+		record := acc.Bytes()
+		archivedKey := types.GetArchivedAccountKey(addr)
+		if hash := ctx.Rbt.Get(archivedKey); hash != nil {
+			// it was created again without being resurrected, so the archived record is merged into it
+			old := se.archive.Get(archivedRecordKey(addr))
+			if !bytes.Equal(crypto.Keccak256(old), hash) {
+				continue // the archive is lost, so it is not archived to keep the old hash
+			}
+			merged := types.NewAccountInfo(append([]byte{}, old...))
+			mergeArchivedAccount(merged, acc)
+			record = merged.Bytes()
+		}
+		se.archive.Set(archivedRecordKey(addr), record)
+		ctx.Rbt.Set(archivedKey, crypto.Keccak256(record))
+		ctx.Rbt.Delete(types.GetAccountKey(addr))
+	}
+	ctx.Close(true)
+	se.archive.Set(touchedAtKey(inactiveHeight), nil)
+}
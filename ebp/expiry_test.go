@@ -0,0 +1,137 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestStateExpiry(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	se := NewStateExpiry(2, NewActivityWatermarks(memKVStore{}), memKVStore{})
+	require.ErrorIs(t, e.CollectResurrection(from1, nil), errors.ErrInvalidWitness)
+	e.SetStateExpiry(se)
+	e.SetContext(prepareCtx(trunk))
+	txs := prepareAccAndTx(e)
+	e.SetContext(prepareCtx(trunk))
+	e.CollectTx(txs[0])
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 1})
+	require.Equal(t, 1, len(e.committedTxs))
+
+	runBlock := func(height int64) {
+		e.SetContext(prepareCtx(trunk))
+		e.Prepare(0, 0, DefaultTxGasLimit)
+		e.SetContext(prepareCtx(trunk))
+		e.Execute(&types.BlockInfo{Number: height})
+	}
+	runBlock(2)
+	ctx := prepareCtx(trunk)
+	acc := ctx.GetAccount(from1)
+	require.NotNil(t, acc)
+	balance := acc.Balance()
+	ctx.Close(false)
+
+	runBlock(3) // the accounts touched at height 1 are archived
+	ctx = prepareCtx(trunk)
+	require.Nil(t, ctx.GetAccount(from1))
+	require.NotNil(t, ctx.GetAccount(to1))   // a low address like the system accounts
+	require.NotNil(t, ctx.GetAccount(from2)) // never touched
+	require.Equal(t, 32, len(ctx.Rbt.Get(types.GetArchivedAccountKey(from1))))
+	ctx.Close(false)
+	witness := se.Witness(from1)
+	require.NotNil(t, witness)
+
+	// a transfer re-creates the account, and the archived balance is merged into it when resurrected
+	e.SetContext(prepareCtx(trunk))
+	ctx = e.cleanCtx.WithRbtCopy()
+	fresh := types.ZeroAccountInfo()
+	fresh.UpdateBalance(uint256.NewInt(7))
+	ctx.SetAccount(from1, fresh)
+	ctx.Close(true)
+	e.cleanCtx.Close(true)
+
+	bad := append([]byte{}, witness...)
+	bad[1]++
+	require.NoError(t, e.CollectResurrection(from1, bad))
+	require.NoError(t, e.CollectResurrection(from1, witness))
+	runBlock(4)
+	ctx = prepareCtx(trunk)
+	acc = ctx.GetAccount(from1)
+	require.NotNil(t, acc)
+	require.Equal(t, balance.AddUint64(balance, 7), acc.Balance())
+	require.Equal(t, uint64(1), acc.Nonce())
+	require.Nil(t, ctx.Rbt.Get(types.GetArchivedAccountKey(from1)))
+	ctx.Close(false)
+
+	wm, _ := se.watermarks.Get(from1)
+	require.Equal(t, int64(4), wm.LastActive)
+	_, ok := se.watermarks.Get(from2)
+	require.False(t, ok)
+	require.False(t, isExpirable(Sep206Address))
+	require.False(t, isExpirable(common.Address(systemContractAddress)))
+}
+
+func TestStateExpiryArchivedTwice(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	se := NewStateExpiry(2, NewActivityWatermarks(memKVStore{}), memKVStore{})
+	e.SetStateExpiry(se)
+	e.SetContext(prepareCtx(trunk))
+	txs := prepareAccAndTx(e)
+	runBlock := func(height int64, txList ...*gethtypes.Transaction) {
+		e.SetContext(prepareCtx(trunk))
+		for _, tx := range txList {
+			e.CollectTx(tx)
+		}
+		e.Prepare(0, 0, DefaultTxGasLimit)
+		e.SetContext(prepareCtx(trunk))
+		e.Execute(&types.BlockInfo{Number: height})
+	}
+	runBlock(1, txs[0])
+	require.Equal(t, 1, len(e.committedTxs))
+	runBlock(2)
+	runBlock(3) // from1 is archived
+	archived := types.NewAccountInfo(se.Witness(from1))
+	require.Equal(t, uint64(1), archived.Nonce())
+
+	// a transfer re-creates the account, which is archived again without being resurrected
+	tx, _ := gethtypes.NewTransaction(0, from1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from2.Bytes())
+	runBlock(4, tx)
+	require.Equal(t, 1, len(e.committedTxs))
+	ctx := prepareCtx(trunk)
+	require.Equal(t, uint64(100), ctx.GetAccount(from1).Balance().Uint64())
+	ctx.Close(false)
+	runBlock(5)
+	runBlock(6)
+	ctx = prepareCtx(trunk)
+	require.Nil(t, ctx.GetAccount(from1))
+	ctx.Close(false)
+
+	// the two records are merged, so no balance is lost
+	witness := se.Witness(from1)
+	merged := types.NewAccountInfo(witness)
+	balance := archived.Balance()
+	require.Equal(t, balance.AddUint64(balance, 100), merged.Balance())
+	require.Equal(t, uint64(1), merged.Nonce())
+	require.NoError(t, e.CollectResurrection(from1, witness))
+	runBlock(7)
+	ctx = prepareCtx(trunk)
+	require.Equal(t, merged.Balance(), ctx.GetAccount(from1).Balance())
+	ctx.Close(false)
+}
@@ -0,0 +1,142 @@
+package ebp
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// The tracer generating the flat traces of OpenEthereum's trace_transaction and trace_block
+const FlatCallTracer = "flatCallTracer"
+
+func init() {
+	RegisterTxTracer(FlatCallTracer, flatCallTracer)
+}
+
+// FlatCallAction is the 'action' of a flat trace. For the 'create' traces, Init is used instead of
+// CallType, To and Input.
+type FlatCallAction struct {
+	CallType string          `json:"callType,omitempty"`
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to,omitempty"`
+	Gas      hexutil.Uint64  `json:"gas"`
+	Input    *hexutil.Bytes  `json:"input,omitempty"`
+	Init     *hexutil.Bytes  `json:"init,omitempty"`
+	Value    *hexutil.Big    `json:"value"`
+}
+
+// FlatCallResult is the 'result' of a flat trace. For the 'create' traces, Address and Code are used
+// instead of Output.
+type FlatCallResult struct {
+	GasUsed hexutil.Uint64  `json:"gasUsed"`
+	Output  *hexutil.Bytes  `json:"output,omitempty"`
+	Address *common.Address `json:"address,omitempty"`
+	Code    *hexutil.Bytes  `json:"code,omitempty"`
+}
+
+type FlatCallTrace struct {
+	Action              FlatCallAction  `json:"action"`
+	BlockHash           common.Hash     `json:"blockHash"`
+	BlockNumber         int64           `json:"blockNumber"`
+	Error               string          `json:"error,omitempty"`
+	Result              *FlatCallResult `json:"result,omitempty"`
+	Subtraces           int             `json:"subtraces"`
+	TraceAddress        []int           `json:"traceAddress"`
+	TransactionHash     common.Hash     `json:"transactionHash"`
+	TransactionPosition int             `json:"transactionPosition"`
+	Type                string          `json:"type"`
+}
+
+// Returns the frames of the tx in the order of entering. Each frame's TraceAddress is the path of indexes
+// from the outermost frame to it.
+func flatCallTracer(runner *TxRunner, txCtx *TraceTxContext, _ json.RawMessage) (interface{}, error) {
+	traces := make([]*FlatCallTrace, 0, len(runner.InternalTxCalls))
+	stack := make([]*FlatCallTrace, 0, 8)
+	err := replayCallFrames(runner.InternalTxCalls, runner.InternalTxReturns,
+		func(call *types.InternalTxCall) error {
+			trace := newFlatCallTrace(call, txCtx)
+			if len(stack) != 0 {
+				parent := stack[len(stack)-1]
+				trace.TraceAddress = append(append([]int{}, parent.TraceAddress...), parent.Subtraces)
+				parent.Subtraces++
+			}
+			traces = append(traces, trace)
+			stack = append(stack, trace)
+			return nil
+		},
+		func(call *types.InternalTxCall, ret *types.InternalTxReturn) error {
+			stack[len(stack)-1].setResult(call, ret)
+			stack = stack[:len(stack)-1]
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return traces, nil
+}
+
+func newFlatCallTrace(call *types.InternalTxCall, txCtx *TraceTxContext) *FlatCallTrace {
+	trace := &FlatCallTrace{
+		Action: FlatCallAction{
+			From:  call.Sender,
+			Gas:   hexutil.Uint64(call.Gas),
+			Value: (*hexutil.Big)(new(big.Int).SetBytes(call.Value[:])),
+		},
+		BlockHash:           txCtx.BlockHash,
+		BlockNumber:         txCtx.BlockNumber,
+		TraceAddress:        []int{},
+		TransactionHash:     txCtx.TxHash,
+		TransactionPosition: txCtx.TxIndex,
+	}
+	input := hexutil.Bytes(call.Input)
+	kind := callKindName(call)
+	if kind == "CREATE" || kind == "CREATE2" {
+		trace.Type = "create"
+		trace.Action.Init = &input
+	} else {
+		trace.Type = "call"
+		to := common.Address(call.Destination)
+		trace.Action.CallType = strings.ToLower(kind)
+		trace.Action.To = &to
+		trace.Action.Input = &input
+	}
+	return trace
+}
+
+func (trace *FlatCallTrace) setResult(call *types.InternalTxCall, ret *types.InternalTxReturn) {
+	if StatusIsFailure(ret.StatusCode) {
+		trace.Error = flatCallError(ret.StatusCode)
+		return
+	}
+	output := hexutil.Bytes(ret.Output)
+	trace.Result = &FlatCallResult{GasUsed: hexutil.Uint64(call.Gas - ret.GasLeft)}
+	if trace.Type == "create" {
+		addr := common.Address(ret.CreateAddress)
+		trace.Result.Address = &addr
+		trace.Result.Code = &output
+	} else {
+		trace.Result.Output = &output
+	}
+}
+
+// Use the error messages of OpenEthereum for the common failures
+func flatCallError(status int) string {
+	switch StatusToStr(status) {
+	case "revert":
+		return "Reverted"
+	case "out-of-gas":
+		return "Out of gas"
+	case "invalid-instruction", "undefined-instruction":
+		return "Bad instruction"
+	case "bad-jump-destination":
+		return "Bad jump destination"
+	case "stack-overflow", "stack-underflow":
+		return "Stack limit reached"
+	}
+	return StatusToStr(status)
+}
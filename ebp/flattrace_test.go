@@ -0,0 +1,71 @@
+package ebp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestFlatCallTracer(t *testing.T) {
+	// the tx calls 1, which creates 2 and then delegate-calls 3, which reverts
+	runner := &TxRunner{
+		InternalTxCalls: []types.InternalTxCall{
+			{Depth: 0, Gas: 1000, Destination: [20]byte{1}},
+			{Kind: 3, Depth: 1, Gas: 500, Sender: [20]byte{1}, Input: []byte{0x60}},
+			{Kind: 1, Depth: 1, Gas: 300, Sender: [20]byte{1}, Destination: [20]byte{3}},
+		},
+		InternalTxReturns: []types.InternalTxReturn{
+			{GasLeft: 400, Output: []byte{0xfe}, CreateAddress: [20]byte{2}},
+			{StatusCode: 2, GasLeft: 100}, // EVMC_REVERT
+			{GasLeft: 10, Output: []byte{1}},
+		},
+	}
+	txCtx := &TraceTxContext{BlockHash: common.Hash{7}, BlockNumber: 9, TxIndex: 2, TxHash: common.Hash{8}}
+	res, err := flatCallTracer(runner, txCtx, nil)
+	require.NoError(t, err)
+	traces := res.([]*FlatCallTrace)
+	require.Equal(t, 3, len(traces))
+	require.Equal(t, 2, traces[0].Subtraces)
+	require.Equal(t, []int{}, traces[0].TraceAddress)
+	require.Equal(t, []int{0}, traces[1].TraceAddress)
+	require.Equal(t, []int{1}, traces[2].TraceAddress)
+
+	bz, err := json.Marshal(traces[1])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"action":{"from":"0x0100000000000000000000000000000000000000","gas":"0x1f4","init":"0x60","value":"0x0"},
+		"blockHash":"0x0700000000000000000000000000000000000000000000000000000000000000","blockNumber":9,
+		"result":{"gasUsed":"0x64","address":"0x0200000000000000000000000000000000000000","code":"0xfe"},
+		"subtraces":0,"traceAddress":[0],
+		"transactionHash":"0x0800000000000000000000000000000000000000000000000000000000000000",
+		"transactionPosition":2,"type":"create"}`, string(bz))
+	require.Equal(t, "delegatecall", traces[2].Action.CallType)
+	require.Equal(t, "Reverted", traces[2].Error)
+	require.Nil(t, traces[2].Result)
+	require.Equal(t, uint64(990), uint64(traces[0].Result.GasUsed))
+}
+
+func TestTraceTransactionInFlatFormat(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+	backend := &testTraceBackend{
+		trunk: trunk,
+		txs:   []*types.Transaction{newTransferTx(common.Hash{1}, 0, 100)},
+	}
+	res, err := TraceTransaction(backend, common.Hash{1}, &TraceConfig{Tracer: FlatCallTracer})
+	require.NoError(t, err)
+	traces := res.([]*FlatCallTrace)
+	require.Equal(t, 1, len(traces))
+	require.Equal(t, "call", traces[0].Action.CallType)
+	require.Equal(t, to1, *traces[0].Action.To)
+	require.Equal(t, uint64(100), traces[0].Action.Value.ToInt().Uint64())
+	require.Equal(t, int64(2), traces[0].BlockNumber)
+}
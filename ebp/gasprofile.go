@@ -0,0 +1,159 @@
+package ebp
+
+import (
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// The tracer attributing the gas used by a tx to its call frames and storage operations
+const GasProfileTracer = "gasProfileTracer"
+
+func init() {
+	RegisterTxTracer(GasProfileTracer, gasProfileTracer)
+}
+
+// The gas costs of storage operations under the Istanbul rules (EIP-2200)
+const (
+	sloadGas       = 800
+	sstoreSetGas   = 20000
+	sstoreResetGas = 5000
+	sstoreNoopGas  = 800
+)
+
+type GasProfile struct {
+	GasLimit     uint64          `json:"gasLimit"`
+	IntrinsicGas uint64          `json:"intrinsicGas"` // the gas charged before the outermost frame runs
+	Frames       []*FrameGas     `json:"frames"`       // in the order of entering
+	StorageOps   []*StorageOpGas `json:"storageOps"`
+}
+
+type FrameGas struct {
+	TraceAddress []int          `json:"traceAddress"`
+	Type         string         `json:"type"`
+	From         common.Address `json:"from"`
+	To           common.Address `json:"to"`
+	Gas          uint64         `json:"gas"`
+	GasUsed      uint64         `json:"gasUsed"`     // including the gas used by the sub frames
+	SelfGasUsed  uint64         `json:"selfGasUsed"` // excluding the gas used by the sub frames
+
+	subframes int
+}
+
+// StorageOpGas is the first load or the final store of a storage slot in a tx. The EVM does not report the
+// cost of each SLOAD and SSTORE, so EstimatedGas is the cost of one such operation, which is a lower bound.
+type StorageOpGas struct {
+	Address      common.Address `json:"address"`
+	Key          common.Hash    `json:"key"`
+	Op           string         `json:"op"` // "load" or "store"
+	Original     common.Hash    `json:"original"`
+	Value        common.Hash    `json:"value"`
+	EstimatedGas uint64         `json:"estimatedGas"`
+}
+
+func gasProfileTracer(runner *TxRunner, _ *TraceTxContext, _ json.RawMessage) (interface{}, error) {
+	profile := &GasProfile{
+		GasLimit:   runner.Tx.Gas,
+		Frames:     make([]*FrameGas, 0, len(runner.InternalTxCalls)),
+		StorageOps: storageOpsGas(runner.RwLists),
+	}
+	if len(runner.InternalTxCalls) != 0 && uint64(runner.InternalTxCalls[0].Gas) <= runner.Tx.Gas {
+		profile.IntrinsicGas = runner.Tx.Gas - uint64(runner.InternalTxCalls[0].Gas)
+	}
+	stack := make([]*FrameGas, 0, 8)
+	err := replayCallFrames(runner.InternalTxCalls, runner.InternalTxReturns,
+		func(call *types.InternalTxCall) error {
+			frame := &FrameGas{
+				TraceAddress: []int{},
+				Type:         callKindName(call),
+				From:         call.Sender,
+				To:           call.Destination,
+				Gas:          uint64(call.Gas),
+			}
+			if len(stack) != 0 {
+				parent := stack[len(stack)-1]
+				frame.TraceAddress = append(append([]int{}, parent.TraceAddress...), parent.subframes)
+				parent.subframes++
+			}
+			profile.Frames = append(profile.Frames, frame)
+			stack = append(stack, frame)
+			return nil
+		},
+		func(call *types.InternalTxCall, ret *types.InternalTxReturn) error {
+			frame := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			frame.GasUsed = uint64(call.Gas - ret.GasLeft)
+			frame.SelfGasUsed += frame.GasUsed
+			if len(stack) != 0 {
+				stack[len(stack)-1].SelfGasUsed -= frame.GasUsed // will be added back by its own GasUsed
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func storageOpsGas(rwLists *types.ReadWriteLists) []*StorageOpGas {
+	if rwLists == nil {
+		return nil
+	}
+	seq2addr := seqToAddr(rwLists)
+	type slot struct {
+		seq uint64
+		key string
+	}
+	originals := make(map[slot][]byte, len(rwLists.StorageRList))
+	ops := make([]*StorageOpGas, 0, len(rwLists.StorageRList)+len(rwLists.StorageWList))
+	for _, op := range rwLists.StorageRList {
+		s := slot{op.Seq, op.Key}
+		if _, ok := originals[s]; ok {
+			continue
+		}
+		originals[s] = op.Value
+		ops = append(ops, &StorageOpGas{
+			Address:      seq2addr[op.Seq],
+			Key:          common.BytesToHash([]byte(op.Key)),
+			Op:           "load",
+			Original:     common.BytesToHash(op.Value),
+			Value:        common.BytesToHash(op.Value),
+			EstimatedGas: sloadGas,
+		})
+	}
+	for _, op := range rwLists.StorageWList {
+		original := common.BytesToHash(originals[slot{op.Seq, op.Key}])
+		value := common.BytesToHash(op.Value)
+		gas := uint64(sstoreNoopGas)
+		if original != value {
+			gas = sstoreResetGas
+			if original == (common.Hash{}) {
+				gas = sstoreSetGas
+			}
+		}
+		ops = append(ops, &StorageOpGas{
+			Address:      seq2addr[op.Seq],
+			Key:          common.BytesToHash([]byte(op.Key)),
+			Op:           "store",
+			Original:     original,
+			Value:        value,
+			EstimatedGas: gas,
+		})
+	}
+	return ops
+}
+
+// Map the sequences of the accounts in rwLists to their addresses
+func seqToAddr(rwLists *types.ReadWriteLists) map[uint64]common.Address {
+	seq2addr := make(map[uint64]common.Address)
+	for _, list := range [][]types.AccountRWOp{rwLists.AccountRList, rwLists.AccountWList} {
+		for _, op := range list {
+			if len(op.Account) != 0 {
+				seq2addr[types.NewAccountInfo(op.Account).Sequence()] = op.Addr
+			}
+		}
+	}
+	return seq2addr
+}
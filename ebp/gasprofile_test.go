@@ -0,0 +1,88 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestGasProfileTracer(t *testing.T) {
+	// the tx calls 1, which calls 2, which calls 3
+	acc := types.ZeroAccountInfo()
+	acc.UpdateSequence(12)
+	runner := &TxRunner{
+		Tx: &types.TxToRun{BasicTx: types.BasicTx{Gas: 1100}},
+		InternalTxCalls: []types.InternalTxCall{
+			{Depth: 0, Gas: 1000, Destination: [20]byte{1}},
+			{Depth: 1, Gas: 500, Sender: [20]byte{1}, Destination: [20]byte{2}},
+			{Depth: 2, Gas: 200, Sender: [20]byte{2}, Destination: [20]byte{3}},
+		},
+		InternalTxReturns: []types.InternalTxReturn{
+			{GasLeft: 150},
+			{GasLeft: 100},
+			{GasLeft: 10},
+		},
+		RwLists: &types.ReadWriteLists{
+			AccountRList: []types.AccountRWOp{{Addr: common.Address{1}, Account: acc.Bytes()}},
+			StorageRList: []types.StorageRWOp{
+				{Seq: 12, Key: string(common.Hash{1}.Bytes()), Value: nil},
+				{Seq: 12, Key: string(common.Hash{2}.Bytes()), Value: []byte{5}},
+				{Seq: 12, Key: string(common.Hash{1}.Bytes()), Value: nil},
+			},
+			StorageWList: []types.StorageRWOp{
+				{Seq: 12, Key: string(common.Hash{1}.Bytes()), Value: []byte{1}},
+				{Seq: 12, Key: string(common.Hash{2}.Bytes()), Value: []byte{6}},
+			},
+		},
+	}
+	res, err := gasProfileTracer(runner, &TraceTxContext{}, nil)
+	require.NoError(t, err)
+	profile := res.(*GasProfile)
+	require.Equal(t, uint64(1100), profile.GasLimit)
+	require.Equal(t, uint64(100), profile.IntrinsicGas)
+	require.Equal(t, 3, len(profile.Frames))
+	require.Equal(t, []int{}, profile.Frames[0].TraceAddress)
+	require.Equal(t, []int{0}, profile.Frames[1].TraceAddress)
+	require.Equal(t, []int{0, 0}, profile.Frames[2].TraceAddress)
+	require.Equal(t, uint64(990), profile.Frames[0].GasUsed)
+	require.Equal(t, uint64(590), profile.Frames[0].SelfGasUsed)
+	require.Equal(t, uint64(400), profile.Frames[1].GasUsed)
+	require.Equal(t, uint64(350), profile.Frames[1].SelfGasUsed)
+	require.Equal(t, uint64(50), profile.Frames[2].GasUsed)
+	require.Equal(t, uint64(50), profile.Frames[2].SelfGasUsed)
+
+	require.Equal(t, 4, len(profile.StorageOps))
+	for _, op := range profile.StorageOps {
+		require.Equal(t, common.Address{1}, op.Address)
+	}
+	require.Equal(t, "load", profile.StorageOps[0].Op)
+	require.Equal(t, uint64(sloadGas), profile.StorageOps[1].EstimatedGas)
+	require.Equal(t, "store", profile.StorageOps[2].Op)
+	require.Equal(t, uint64(sstoreSetGas), profile.StorageOps[2].EstimatedGas)
+	require.Equal(t, common.BytesToHash([]byte{5}), profile.StorageOps[3].Original)
+	require.Equal(t, uint64(sstoreResetGas), profile.StorageOps[3].EstimatedGas)
+}
+
+func TestTraceTransactionGasProfile(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+	backend := &testTraceBackend{
+		trunk: trunk,
+		txs:   []*types.Transaction{newTransferTx(common.Hash{1}, 0, 100)},
+	}
+	res, err := TraceTransaction(backend, common.Hash{1}, &TraceConfig{Tracer: GasProfileTracer})
+	require.NoError(t, err)
+	profile := res.(*GasProfile)
+	require.Equal(t, uint64(100000), profile.GasLimit)
+	require.Equal(t, 1, len(profile.Frames))
+	require.Equal(t, to1, profile.Frames[0].To)
+	require.Equal(t, profile.Frames[0].GasUsed, profile.Frames[0].SelfGasUsed)
+}
@@ -0,0 +1,45 @@
+package ebp
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// conflictHints is shared by the runners of one round. Each runner publishes the accounts it writes, and a
+// runner which finds that its sender or recipient was written by a runner placed before it will very likely
+// fail to commit, so it aborts before running EVM.
+// Whether a runner sees a hint depends on timing, so the hints only decide which runners skip the EVM work.
+// An aborted runner has read its sender and recipient, so its partial read/write list is a subset of the
+// full one. In checkTxDepsAndUptStandbyQ, it is requeued if the partial list already conflicts, which a full
+// run would do too, and is re-run otherwise. So the committed TXs do not depend on timing. The hints are not
+// used with checkRWInLoading, which records the read/write lists of the requeued TXs.
+type conflictHints struct {
+	writers sync.Map // common.Address => *int64, the smallest index of the runners writing this account
+}
+
+func newConflictHints() *conflictHints {
+	return &conflictHints{}
+}
+
+func (h *conflictHints) publish(idx int, addr common.Address) {
+	i := int64(idx)
+	v, loaded := h.writers.LoadOrStore(addr, &i)
+	if !loaded {
+		return
+	}
+	ptr := v.(*int64)
+	for {
+		old := atomic.LoadInt64(ptr)
+		if old <= int64(idx) || atomic.CompareAndSwapInt64(ptr, old, int64(idx)) {
+			return
+		}
+	}
+}
+
+// returns whether addr is written by a runner whose index is smaller than idx
+func (h *conflictHints) writtenBefore(idx int, addr common.Address) bool {
+	v, ok := h.writers.Load(addr)
+	return ok && atomic.LoadInt64(v.(*int64)) < int64(idx)
+}
@@ -0,0 +1,84 @@
+package ebp
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestConflictHints(t *testing.T) {
+	h := newConflictHints()
+	addr := common.Address{1}
+	var wg sync.WaitGroup
+	for i := 10; i > 2; i-- {
+		wg.Add(1)
+		go func(idx int) {
+			h.publish(idx, addr)
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+	require.False(t, h.writtenBefore(2, addr))
+	require.False(t, h.writtenBefore(3, addr))
+	require.True(t, h.writtenBefore(4, addr))
+	require.False(t, h.writtenBefore(100, common.Address{2}))
+}
+
+// Returns the recorded read/write lists, how many times the TXs were run and how many runs were aborted
+func runConflictingTransfers(t *testing.T, hints, checkRWInLoading bool) (rwListMap map[common.Hash]rwList, runs, aborted int) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	// with one round and one worker, the second TX is always aborted by the hint of the first one
+	e := NewEbpTxExec(1, 100, 1, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetCheckRWInLoading(checkRWInLoading)
+	e.SetEarlyConflictHints(hints)
+	tracer := &recordingTracer{}
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+	e.SetContext(prepareCtx(trunk))
+	tx1, _ := gethtypes.NewTransaction(0, from3, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	tx2, _ := gethtypes.NewTransaction(0, from3, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from2.Bytes())
+	e.CollectTx(tx1)
+	e.CollectTx(tx2)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.SetTracer(tracer)
+	e.Execute(&types.BlockInfo{})
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, 1, e.StandbyQLen())
+	for _, event := range tracer.events {
+		if strings.HasPrefix(event, "start") {
+			runs++
+		} else if event == fmt.Sprintf("end %d", types.ABORTED_BY_HINTS) {
+			aborted++
+		}
+	}
+	e.cleanCtx.Close(false)
+	return e.rwListMap, runs, aborted
+}
+
+func TestAbortedByHints(t *testing.T) {
+	// the aborted runner conflicts for sure, so it is requeued without being re-run
+	_, runs, aborted := runConflictingTransfers(t, true, false)
+	require.Equal(t, 2, runs)
+	require.Equal(t, 1, aborted)
+
+	// the read/write lists recorded for loading the next round must be the same as without the hints
+	expected, _, _ := runConflictingTransfers(t, false, true)
+	rwListMap, runs, aborted := runConflictingTransfers(t, true, true)
+	require.Equal(t, 2, runs)
+	require.Zero(t, aborted)
+	require.Len(t, expected, 2)
+	require.Equal(t, expected, rwListMap)
+}
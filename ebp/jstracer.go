@@ -0,0 +1,269 @@
+package ebp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+var ErrJSTracer = errors.New("js tracer error")
+
+const DefaultJSTracerTimeout = 5 * time.Second
+
+// The opcode-level hooks of geth's JS tracers, which cannot be supported with the call frames of TxRunner
+var unsupportedJSHooks = []string{"step", "fault"}
+
+// A tracer which is not registered is regarded as the code of a geth-style JS tracer, if it looks like
+// a JS object literal.
+func isJSTracer(code string) bool {
+	code = strings.TrimSpace(code)
+	return strings.HasPrefix(code, "{") && strings.HasSuffix(code, "}")
+}
+
+type jsTracerConfig struct {
+	Timeout string `json:"timeout"` // such as "10s"
+}
+
+// Returns a TxTracer running the JS tracer in code. The tracer object must have a 'result(ctx, db)' function,
+// and it can have 'setup(config)', 'enter(frame)' and 'exit(frameResult)' functions. As in geth, 'enter' and
+// 'exit' are called for the frames in the order of execution, except the outermost one.
+func newJSTracer(code string) TxTracer {
+	return func(runner *TxRunner, txCtx *TraceTxContext, config json.RawMessage) (interface{}, error) {
+		timeout := DefaultJSTracerTimeout
+		if len(config) != 0 {
+			var cfg jsTracerConfig
+			if err := json.Unmarshal(config, &cfg); err != nil {
+				return nil, err
+			}
+			if cfg.Timeout != "" {
+				d, err := time.ParseDuration(cfg.Timeout)
+				if err != nil {
+					return nil, err
+				}
+				timeout = d
+			}
+		}
+		vm := goja.New()
+		timer := time.AfterFunc(timeout, func() { vm.Interrupt("timeout") })
+		defer timer.Stop()
+		result, err := runJSTracer(vm, code, runner, txCtx, config)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrJSTracer, err)
+		}
+		return result, nil
+	}
+}
+
+func runJSTracer(vm *goja.Runtime, code string, runner *TxRunner, txCtx *TraceTxContext, config json.RawMessage) (interface{}, error) {
+	vm.Set("toHex", func(v goja.Value) string { return hexutil.Encode(jsToBytes(v)) })
+	vm.Set("toAddress", func(v goja.Value) string { return jsToAddress(v).Hex() })
+	v, err := vm.RunString("(" + code + ")")
+	if err != nil {
+		return nil, err
+	}
+	obj := v.ToObject(vm)
+	for _, name := range unsupportedJSHooks {
+		if _, ok := goja.AssertFunction(obj.Get(name)); ok {
+			return nil, fmt.Errorf("the '%s' hook is not supported", name)
+		}
+	}
+	resultFn, ok := goja.AssertFunction(obj.Get("result"))
+	if !ok {
+		return nil, errors.New("the 'result' function is missing")
+	}
+	if setup, ok := goja.AssertFunction(obj.Get("setup")); ok {
+		if _, err = setup(obj, vm.ToValue(string(config))); err != nil {
+			return nil, err
+		}
+	}
+	enter, hasEnter := goja.AssertFunction(obj.Get("enter"))
+	exit, hasExit := goja.AssertFunction(obj.Get("exit"))
+	err = replayCallFrames(runner.InternalTxCalls, runner.InternalTxReturns,
+		func(call *types.InternalTxCall) error {
+			if !hasEnter || call.Depth == 0 {
+				return nil
+			}
+			_, err := enter(obj, newJSCallFrame(vm, call))
+			return err
+		},
+		func(call *types.InternalTxCall, ret *types.InternalTxReturn) error {
+			if !hasExit || call.Depth == 0 {
+				return nil
+			}
+			_, err := exit(obj, newJSFrameResult(vm, call, ret))
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+	res, err := resultFn(obj, newJSTxContext(vm, runner, txCtx), newJSDB(vm, runner.Ctx))
+	if err != nil {
+		return nil, err
+	}
+	return res.Export(), nil
+}
+
+// Pair the internal calls, which are in the order of entering, and the returns, which are in the order of
+// exiting, by their depths. Then call enter and exit in the order of execution. The outermost call, whose
+// depth is zero, is also included.
+func replayCallFrames(calls []types.InternalTxCall, returns []types.InternalTxReturn,
+	enter func(call *types.InternalTxCall) error,
+	exit func(call *types.InternalTxCall, ret *types.InternalTxReturn) error) error {
+	stack := make([]*types.InternalTxCall, 0, 8)
+	retIdx := 0
+	popUntil := func(depth int32) error {
+		for len(stack) != 0 && stack[len(stack)-1].Depth >= depth {
+			if retIdx >= len(returns) {
+				return errors.New("internal calls and returns do not match")
+			}
+			if err := exit(stack[len(stack)-1], &returns[retIdx]); err != nil {
+				return err
+			}
+			retIdx++
+			stack = stack[:len(stack)-1]
+		}
+		return nil
+	}
+	for i := range calls {
+		if err := popUntil(calls[i].Depth); err != nil {
+			return err
+		}
+		if err := enter(&calls[i]); err != nil {
+			return err
+		}
+		stack = append(stack, &calls[i])
+	}
+	return popUntil(0)
+}
+
+var callKindNames = []string{"CALL", "DELEGATECALL", "CALLCODE", "CREATE", "CREATE2"}
+
+func callKindName(call *types.InternalTxCall) string {
+	if call.Kind < 0 || call.Kind >= len(callKindNames) {
+		return "UNKNOWN"
+	}
+	if call.Kind == 0 && call.Flags&1 != 0 { // EVMC_STATIC
+		return "STATICCALL"
+	}
+	return callKindNames[call.Kind]
+}
+
+func newJSCallFrame(vm *goja.Runtime, call *types.InternalTxCall) goja.Value {
+	obj := vm.NewObject()
+	_ = obj.Set("getType", func() string { return callKindName(call) })
+	_ = obj.Set("getFrom", func() string { return common.Address(call.Sender).Hex() })
+	_ = obj.Set("getTo", func() string { return common.Address(call.Destination).Hex() })
+	_ = obj.Set("getInput", func() string { return hexutil.Encode(call.Input) })
+	_ = obj.Set("getGas", func() int64 { return call.Gas })
+	_ = obj.Set("getValue", func() string { return new(big.Int).SetBytes(call.Value[:]).String() })
+	_ = obj.Set("getDepth", func() int32 { return call.Depth })
+	return obj
+}
+
+func newJSFrameResult(vm *goja.Runtime, call *types.InternalTxCall, ret *types.InternalTxReturn) goja.Value {
+	obj := vm.NewObject()
+	_ = obj.Set("getGasUsed", func() int64 { return call.Gas - ret.GasLeft })
+	_ = obj.Set("getOutput", func() string { return hexutil.Encode(ret.Output) })
+	_ = obj.Set("getError", func() goja.Value {
+		if StatusIsFailure(ret.StatusCode) {
+			return vm.ToValue(StatusToStr(ret.StatusCode))
+		}
+		return goja.Undefined()
+	})
+	return obj
+}
+
+func newJSTxContext(vm *goja.Runtime, runner *TxRunner, txCtx *TraceTxContext) goja.Value {
+	tx := runner.Tx
+	obj := vm.NewObject()
+	typ, to := "CALL", tx.To
+	if tx.To == (common.Address{}) {
+		typ, to = "CREATE", runner.CreatedContractAddress
+	}
+	_ = obj.Set("type", typ)
+	_ = obj.Set("from", tx.From.Hex())
+	_ = obj.Set("to", to.Hex())
+	_ = obj.Set("input", hexutil.Encode(tx.Data))
+	_ = obj.Set("gas", tx.Gas)
+	_ = obj.Set("gasPrice", new(big.Int).SetBytes(tx.GasPrice[:]).String())
+	_ = obj.Set("value", new(big.Int).SetBytes(tx.Value[:]).String())
+	_ = obj.Set("block", txCtx.BlockNumber)
+	_ = obj.Set("blockHash", txCtx.BlockHash.Hex())
+	_ = obj.Set("txIndex", txCtx.TxIndex)
+	_ = obj.Set("txHash", txCtx.TxHash.Hex())
+	_ = obj.Set("output", hexutil.Encode(runner.OutData))
+	if StatusIsFailure(runner.Status) {
+		_ = obj.Set("error", StatusToStr(runner.Status))
+	}
+	return obj
+}
+
+// The db object reads the state after the tx
+func newJSDB(vm *goja.Runtime, ctx *types.Context) goja.Value {
+	obj := vm.NewObject()
+	_ = obj.Set("exists", func(addr goja.Value) bool {
+		return ctx.GetAccount(jsToAddress(addr)) != nil
+	})
+	_ = obj.Set("getBalance", func(addr goja.Value) string {
+		if acc := ctx.GetAccount(jsToAddress(addr)); acc != nil {
+			return acc.Balance().ToBig().String()
+		}
+		return "0"
+	})
+	_ = obj.Set("getNonce", func(addr goja.Value) uint64 {
+		if acc := ctx.GetAccount(jsToAddress(addr)); acc != nil {
+			return acc.Nonce()
+		}
+		return 0
+	})
+	_ = obj.Set("getCode", func(addr goja.Value) string {
+		if info := ctx.GetCode(jsToAddress(addr)); info != nil {
+			return hexutil.Encode(info.BytecodeSlice())
+		}
+		return "0x"
+	})
+	_ = obj.Set("getState", func(addr, key goja.Value) string {
+		acc := ctx.GetAccount(jsToAddress(addr))
+		if acc == nil {
+			return common.Hash{}.Hex()
+		}
+		value := ctx.GetStorageAt(acc.Sequence(), string(common.BytesToHash(jsToBytes(key)).Bytes()))
+		return common.BytesToHash(value).Hex()
+	})
+	return obj
+}
+
+// Accepts a hex string or an array of bytes
+func jsToBytes(v goja.Value) []byte {
+	switch x := v.Export().(type) {
+	case string:
+		return common.FromHex(x)
+	case []byte:
+		return x
+	case []interface{}:
+		bz := make([]byte, len(x))
+		for i, b := range x {
+			switch n := b.(type) {
+			case int64:
+				bz[i] = byte(n)
+			case float64:
+				bz[i] = byte(n)
+			}
+		}
+		return bz
+	}
+	return nil
+}
+
+func jsToAddress(v goja.Value) common.Address {
+	return common.BytesToAddress(jsToBytes(v))
+}
@@ -0,0 +1,70 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestReplayCallFrames(t *testing.T) {
+	// 1 calls 2 and 4, and 2 calls 3
+	calls := []types.InternalTxCall{{Depth: 1, Gas: 1}, {Depth: 2, Gas: 2}, {Depth: 3, Gas: 3}, {Depth: 2, Gas: 4}}
+	returns := []types.InternalTxReturn{{GasLeft: 3}, {GasLeft: 2}, {GasLeft: 4}, {GasLeft: 1}}
+	var events []int64
+	err := replayCallFrames(calls, returns, func(call *types.InternalTxCall) error {
+		events = append(events, call.Gas)
+		return nil
+	}, func(call *types.InternalTxCall, ret *types.InternalTxReturn) error {
+		require.Equal(t, call.Gas, ret.GasLeft)
+		events = append(events, -call.Gas)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 2, 3, -3, -2, 4, -4, -1}, events)
+	err = replayCallFrames(calls, returns[:3], func(*types.InternalTxCall) error { return nil },
+		func(*types.InternalTxCall, *types.InternalTxReturn) error { return nil })
+	require.Error(t, err)
+}
+
+func TestJSTracer(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+	backend := &testTraceBackend{
+		trunk: trunk,
+		txs:   []*types.Transaction{newTransferTx([32]byte{1}, 0, 100)},
+	}
+	code := `{
+		calls: 0,
+		setup: function(cfg) { this.cfg = JSON.parse(cfg); },
+		enter: function(frame) { this.calls++; },
+		result: function(ctx, db) {
+			return {type: ctx.type, to: toHex(ctx.to), value: ctx.value, balance: db.getBalance(ctx.to),
+				nonce: db.getNonce(ctx.from), calls: this.calls, timeout: this.cfg.timeout};
+		}
+	}`
+	res, err := TraceTransaction(backend, [32]byte{1}, &TraceConfig{Tracer: code, TracerConfig: []byte(`{"timeout":"1s"}`)})
+	require.NoError(t, err)
+	out := res.(map[string]interface{})
+	require.Equal(t, "CALL", out["type"])
+	require.Equal(t, "0x0000000000000000000000000000000000000010", out["to"])
+	require.Equal(t, "100", out["value"])
+	require.Equal(t, "100", out["balance"])
+	require.EqualValues(t, 1, out["nonce"])
+	require.EqualValues(t, 0, out["calls"])
+	require.Equal(t, "1s", out["timeout"])
+
+	_, err = TraceTransaction(backend, [32]byte{1}, &TraceConfig{Tracer: `{step: function() {}, result: function() {}}`})
+	require.ErrorIs(t, err, ErrJSTracer)
+	_, err = TraceTransaction(backend, [32]byte{1}, &TraceConfig{Tracer: `{}`})
+	require.ErrorIs(t, err, ErrJSTracer)
+	_, err = TraceTransaction(backend, [32]byte{1}, &TraceConfig{Tracer: `{result: function() { for(;;) {} }}`,
+		TracerConfig: []byte(`{"timeout":"100ms"}`)})
+	require.ErrorIs(t, err, ErrJSTracer)
+}
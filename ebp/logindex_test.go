@@ -0,0 +1,72 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// It emits two logs
+type logExecutor struct{ panicExecutor }
+
+func (le logExecutor) Execute(ctx *types.Context, currBlock *types.BlockInfo, tx *types.TxToRun) (int, []types.EvmLog, uint64, []byte) {
+	logs := []types.EvmLog{{Address: tx.To, Topics: []common.Hash{{1}}}, {Address: tx.To, Data: []byte{2}}}
+	return 0, logs, 21000, nil
+}
+
+// The indexes of the logs are continuous in a block, as geth derives them from the receipts
+func TestLogIndexContinuity(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	logAddr := common.HexToAddress("0x2713")
+	PredefinedContractManager[logAddr] = logExecutor{}
+	defer delete(PredefinedContractManager, logAddr)
+	e, _ := prepareEngine(trunk)
+	for _, from := range []common.Address{from1, from2} {
+		tx, _ := gethtypes.NewTransaction(0, logAddr, big.NewInt(0), 100000, big.NewInt(1), nil).WithSignature(e.signer, from.Bytes())
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 1})
+	// the invalid TXs found in Prepare are appended to the TXs committed in the last Execute
+	invalid, _ := gethtypes.NewTransaction(5, logAddr, big.NewInt(0), 100000, big.NewInt(1), nil).WithSignature(e.signer, from3.Bytes())
+	valid, _ := gethtypes.NewTransaction(1, logAddr, big.NewInt(0), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	e.CollectTx(invalid)
+	e.CollectTx(valid)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	require.Equal(t, 3, len(e.committedTxs))
+
+	gethTxs := make(gethtypes.Transactions, len(e.committedTxs))
+	receipts := make(gethtypes.Receipts, len(e.committedTxs))
+	for i, tx := range e.committedTxs {
+		require.Equal(t, int64(i), tx.TransactionIndex)
+		gethTxs[i] = gethtypes.NewTransaction(tx.Nonce, tx.To, big.NewInt(0), tx.Gas, big.NewInt(1), nil)
+		receipts[i] = &gethtypes.Receipt{}
+		for range tx.Logs {
+			receipts[i].Logs = append(receipts[i].Logs, &gethtypes.Log{})
+		}
+	}
+	require.NoError(t, receipts.DeriveFields(params.TestChainConfig, common.Hash{}, 1, gethTxs))
+	for i, tx := range e.committedTxs {
+		require.Equal(t, len(receipts[i].Logs), len(tx.Logs))
+		for j, l := range tx.Logs {
+			require.Equal(t, receipts[i].Logs[j].Index, l.Index)
+			require.Equal(t, receipts[i].Logs[j].TxIndex, l.TxIndex)
+		}
+	}
+
+	// the indexes restart in the next block
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 2})
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, uint(0), e.committedTxs[0].Logs[0].Index)
+	require.Equal(t, uint(1), e.committedTxs[0].Logs[1].Index)
+}
@@ -0,0 +1,79 @@
+package ebp
+
+import (
+	"encoding/binary"
+
+	storetypes "github.com/smartbch/moeingads/store/types"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// In each block, the minimum gas price moves towards its target by at most 1/MinGasPriceChangeDenominator
+const MinGasPriceChangeDenominator = 8
+
+// The minimum gas price and its target are stored at types.MinGasPriceKey as current(8 bytes) + target(8 bytes).
+// Before the target is set by governance, there is no record, and the minGasPrice argument of Prepare is used.
+func (exec *txEngine) loadMinGasPrice() (curr, target uint64, ok bool) {
+	ctx := exec.readCtx()
+	defer ctx.Close(false)
+	bz := ctx.Rbt.GetBaseStore().Get(types.MinGasPriceKey[:])
+	if len(bz) != 16 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint64(bz[:8]), binary.BigEndian.Uint64(bz[8:]), true
+}
+
+func (exec *txEngine) storeMinGasPrice(curr, target uint64) {
+	bz := make([]byte, 16)
+	binary.BigEndian.PutUint64(bz[:8], curr)
+	binary.BigEndian.PutUint64(bz[8:], target)
+	trunk := exec.cleanCtx.Rbt.GetBaseStore()
+	trunk.PrepareForUpdate(types.MinGasPriceKey[:])
+	trunk.Update(func(store storetypes.SetDeleter) {
+		store.Set(types.MinGasPriceKey[:], bz)
+	})
+}
+
+// Returns the minimum gas price in world state, ok is false if governance has not set it
+func (exec *txEngine) MinGasPrice() (minGasPrice uint64, ok bool) {
+	minGasPrice, _, ok = exec.loadMinGasPrice()
+	return
+}
+
+// Set the target of the minimum gas price, which is decided by governance (such as the voting of
+// validators). It must be called on all the nodes at the same height, before Prepare.
+// When the target is set for the first time, the minimum gas price starts from the target.
+func (exec *txEngine) SetMinGasPriceTarget(target uint64) {
+	curr, _, ok := exec.loadMinGasPrice()
+	if !ok {
+		curr = target
+	}
+	exec.storeMinGasPrice(curr, target)
+}
+
+// Move the minimum gas price in world state towards its target and return it. If there is no record,
+// minGasPrice is returned.
+func (exec *txEngine) adjustMinGasPrice(minGasPrice uint64) uint64 {
+	curr, target, ok := exec.loadMinGasPrice()
+	if !ok {
+		return minGasPrice
+	}
+	next := nextMinGasPrice(curr, target)
+	if next != curr {
+		exec.storeMinGasPrice(next, target)
+	}
+	return next
+}
+
+func nextMinGasPrice(curr, target uint64) uint64 {
+	maxDelta := curr / MinGasPriceChangeDenominator
+	if maxDelta == 0 {
+		maxDelta = 1
+	}
+	if target > curr && target-curr > maxDelta {
+		return curr + maxDelta
+	} else if target < curr && curr-target > maxDelta {
+		return curr - maxDelta
+	}
+	return target
+}
@@ -0,0 +1,38 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMinGasPriceInState(t *testing.T) {
+	require.Equal(t, uint64(1125), nextMinGasPrice(1000, 2000))
+	require.Equal(t, uint64(1010), nextMinGasPrice(1000, 1010))
+	require.Equal(t, uint64(875), nextMinGasPrice(1000, 0))
+	require.Equal(t, uint64(1), nextMinGasPrice(0, 5))
+
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareEngine(trunk)
+	_, ok := e.MinGasPrice()
+	require.False(t, ok)
+	e.SetMinGasPriceTarget(1)
+	e.SetMinGasPriceTarget(8)
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit) // the gas price of txs is 1, which is not less than 2
+	e.SetContext(prepareCtx(trunk))
+	minGasPrice, ok := e.MinGasPrice()
+	require.True(t, ok)
+	require.Equal(t, uint64(2), minGasPrice)
+	startKey, endKey := e.getStandbyQueueRange()
+	require.Equal(t, startKey, endKey)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	minGasPrice, _ = e.MinGasPrice()
+	require.Equal(t, uint64(3), minGasPrice)
+	e.cleanCtx.Close(false)
+}
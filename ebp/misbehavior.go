@@ -0,0 +1,79 @@
+package ebp
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+type MisbehaviorKind int
+
+const (
+	// A tx fails the deterministic validation in Prepare, such as the signature and the gas fee checks
+	MisbehaviorInvalidTx MisbehaviorKind = iota
+	// A tx's gas limit is over the max gas limit of a tx
+	MisbehaviorOverLimitGas
+	// A sender's TXs are not ordered by their nonces, or have gaps between the nonces
+	MisbehaviorInvalidOrdering
+)
+
+func (kind MisbehaviorKind) String() string {
+	switch kind {
+	case MisbehaviorInvalidTx:
+		return "invalid-tx"
+	case MisbehaviorOverLimitGas:
+		return "over-limit-gas"
+	case MisbehaviorInvalidOrdering:
+		return "invalid-ordering"
+	}
+	return "unknown"
+}
+
+// MisbehaviorEvent reports a tx which an honest proposer would not include in its block. The block is the
+// one whose TXs were collected before Prepare, so the host chain attaches its height and proposer.
+type MisbehaviorEvent struct {
+	Kind    MisbehaviorKind
+	TxIndex int // the index of the tx in the block
+	TxHash  common.Hash
+	Sender  common.Address // zero if the signature is invalid
+	Reason  string
+	// The binary encoding of the tx, which can be checked against the block and re-validated
+	Evidence []byte
+}
+
+// A handler is called in Prepare with the misbehavior events of a block, in the order of the TXs
+type MisbehaviorHandler func(events []*MisbehaviorEvent)
+
+func misbehaviorKind(errorStr string) MisbehaviorKind {
+	switch errorStr {
+	case "invalid gas limit":
+		return MisbehaviorOverLimitGas
+	case "incorrect nonce":
+		return MisbehaviorInvalidOrdering
+	}
+	return MisbehaviorInvalidTx
+}
+
+// infoList is in the order of exec.txList
+func (exec *txEngine) reportMisbehaviors(infoList []*preparedInfo) {
+	var events []*MisbehaviorEvent
+	for i, info := range infoList {
+		if len(info.errorStr) == 0 || info.errorStr == replacedByFee ||
+			info.errorStr == StatusToStr(types.EVICTED_FROM_QUEUE) ||
+			info.errorStr == StatusToStr(types.SENDER_QUEUE_FULL) {
+			continue
+		}
+		evidence, _ := exec.txList[i].MarshalBinary()
+		events = append(events, &MisbehaviorEvent{
+			Kind:     misbehaviorKind(info.errorStr),
+			TxIndex:  i,
+			TxHash:   info.tx.HashID,
+			Sender:   info.tx.From,
+			Reason:   info.errorStr,
+			Evidence: evidence,
+		})
+	}
+	if len(events) != 0 {
+		exec.misbehaviorHandler(events)
+	}
+}
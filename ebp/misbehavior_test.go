@@ -0,0 +1,48 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+)
+
+func TestMisbehaviorEvents(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	var events []*MisbehaviorEvent
+	e.SetMisbehaviorHandler(func(evs []*MisbehaviorEvent) {
+		events = append(events, evs...)
+	})
+	e.SetContext(prepareCtx(trunk))
+	txs := prepareAccAndTx(e)
+	e.SetContext(prepareCtx(trunk))
+	tooMuchGas, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), DefaultTxGasLimit+1, big.NewInt(1), nil).WithSignature(e.signer, from3.Bytes())
+	wrongNonce, _ := gethtypes.NewTransaction(2, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	noAccount, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, common.Address{0x99}.Bytes())
+	for _, tx := range []*gethtypes.Transaction{txs[0], tooMuchGas, wrongNonce, noAccount} {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	require.Equal(t, 3, len(events))
+
+	require.Equal(t, MisbehaviorOverLimitGas, events[0].Kind)
+	require.Equal(t, 1, events[0].TxIndex)
+	require.Equal(t, from3, events[0].Sender)
+	var evidence gethtypes.Transaction
+	require.NoError(t, evidence.UnmarshalBinary(events[0].Evidence))
+	require.Equal(t, tooMuchGas.Hash(), evidence.Hash())
+	require.Equal(t, common.Hash(evidence.Hash()), events[0].TxHash)
+
+	require.Equal(t, MisbehaviorInvalidOrdering, events[1].Kind)
+	require.Equal(t, 2, events[1].TxIndex)
+	require.Equal(t, "invalid-ordering", events[1].Kind.String())
+	require.Equal(t, MisbehaviorInvalidTx, events[2].Kind)
+	require.Equal(t, "non-existent account", events[2].Reason)
+}
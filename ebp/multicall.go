@@ -0,0 +1,66 @@
+package ebp
+
+import (
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	dt "github.com/smartbch/moeingads/datatree"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// ViewCall is a read-only call in ReadMulticall. If Gas is zero, DefaultTxGasLimit is used.
+type ViewCall struct {
+	From common.Address
+	To   common.Address
+	Data []byte
+	Gas  uint64
+}
+
+type ViewResult struct {
+	Status  int
+	OutData []byte
+}
+
+// Run the calls against the same state of ctx and return their results in order. Each call runs on its own
+// copy of ctx, such that the calls do not see each other's changes, and ctx is not changed.
+func ReadMulticall(ctx *types.Context, currBlock *types.BlockInfo, calls []ViewCall) []ViewResult {
+	results := make([]ViewResult, len(calls))
+	workerCount := RpcRunnersCount
+	if len(calls) < workerCount {
+		workerCount = len(calls)
+	}
+	sharedIdx := int64(-1)
+	dt.ParallelRun(workerCount, func(_ int) {
+		for {
+			myIdx := int(atomic.AddInt64(&sharedIdx, 1))
+			if myIdx >= len(calls) {
+				return
+			}
+			results[myIdx] = runViewCall(ctx, currBlock, &calls[myIdx])
+		}
+	})
+	return results
+}
+
+func runViewCall(ctx *types.Context, currBlock *types.BlockInfo, call *ViewCall) ViewResult {
+	tx := &types.TxToRun{
+		BasicTx: types.BasicTx{
+			From: call.From,
+			To:   call.To,
+			Data: call.Data,
+			Gas:  call.Gas,
+		},
+		Height: uint64(currBlock.Number),
+	}
+	if tx.Gas == 0 {
+		tx.Gas = DefaultTxGasLimit
+	}
+	runner := NewTxRunner(ctx.WithRbtCopy(), tx)
+	defer runner.Ctx.Close(false)
+	RunTxForRpc(currBlock, false, runner)
+	return ViewResult{
+		Status:  runner.Status,
+		OutData: runner.OutData,
+	}
+}
@@ -0,0 +1,33 @@
+package ebp
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestReadMulticall(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	data := []byte("multicall")
+	calls := []ViewCall{
+		{From: from1, To: common.BytesToAddress([]byte{4}), Data: data}, // identity
+		{From: from1, To: common.BytesToAddress([]byte{2}), Data: data}, // sha256
+		{From: from1, To: to1},
+	}
+	results := ReadMulticall(ctx, &types.BlockInfo{Number: 1}, calls)
+	require.Equal(t, 3, len(results))
+	require.Equal(t, data, results[0].OutData)
+	hash := sha256.Sum256(data)
+	require.Equal(t, hash[:], results[1].OutData)
+	for _, res := range results {
+		require.False(t, StatusIsFailure(res.Status))
+	}
+	require.Nil(t, ctx.GetAccount(to1))
+}
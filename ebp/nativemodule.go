@@ -0,0 +1,278 @@
+package ebp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+
+	"github.com/smartbch/moeingevm/errors"
+)
+
+//#include <stdint.h>
+//#include "../evmwrap/host_bridge/bridge.h"
+import "C"
+
+// The same as the ones in host_context.h
+const (
+	NATIVE_MODULE_ID_START = 0x2800
+	NATIVE_MODULE_ID_END   = 0x28ff
+)
+
+const (
+	MODULE_READ_GAS     uint64 = 800   // the same as SLOAD_GAS in evmwrap
+	MODULE_WRITE_GAS    uint64 = 5000  // the same as SSTORE_RESET_GAS in evmwrap
+	MODULE_NEW_SLOT_GAS uint64 = 20000 // the same as SSTORE_SET_GAS in evmwrap
+	MODULE_TRANSFER_GAS uint64 = 9000  // the same as the value transfer of CALL
+
+	MaxModuleValueSize = 24576 // the same as MAX_VALUE_SIZE in evmwrap
+
+	// A module's storage sequence is this base plus its id. Contracts cannot reach it, because their sequences
+	// are the creation counters shifted left by 8 bits.
+	NativeModuleSequenceBase uint64 = 0xffffffff00000000
+)
+
+// NativeModule is implemented in golang and called by the contracts at an address in 0x2800~0x28ff, like a
+// precompiled contract, when the NativeModules rule of ChainConfig is enabled. RequiredGas is charged before
+// Run, which accesses the state of the running TX through state. If Run returns an error or panics, the call
+// fails and all the changes made through state are reverted.
+type NativeModule interface {
+	RequiredGas(input []byte) uint64
+	Run(state *ModuleState, input []byte) ([]byte, error)
+}
+
+type namedModule struct {
+	NativeModule
+	name string
+}
+
+var nativeModules = make(map[common.Address]namedModule)
+
+// RegisterNativeModule makes module callable at addr, and name is shown in ActivePrecompiles. It is not
+// thread-safe and must be called before any execution, such as in init().
+func RegisterNativeModule(addr common.Address, name string, module NativeModule) {
+	if !IsNativeModuleAddress(addr) {
+		panic(fmt.Sprintf("%s is not an address for native modules", addr.String()))
+	}
+	if _, ok := nativeModules[addr]; ok {
+		panic(fmt.Sprintf("native module %s is already registered", addr.String()))
+	}
+	nativeModules[addr] = namedModule{NativeModule: module, name: name}
+}
+
+func IsNativeModuleAddress(addr common.Address) bool {
+	for _, b := range addr[:18] {
+		if b != 0 {
+			return false
+		}
+	}
+	id := binary.BigEndian.Uint16(addr[18:])
+	return NATIVE_MODULE_ID_START <= id && id <= NATIVE_MODULE_ID_END
+}
+
+// NativeModuleSequence returns the sequence of the storage of the native module at addr
+func NativeModuleSequence(addr common.Address) uint64 {
+	return NativeModuleSequenceBase | uint64(binary.BigEndian.Uint16(addr[18:]))
+}
+
+// ModuleState gives a native module controlled access to the state of the running TX: it can read and write
+// its own storage, read the balances, and transfer its own balance. The accesses are made in the cached state
+// of evmwrap, such that they see the changes made earlier in this TX and are reverted with the calling frame.
+// Each access is charged from the gas left after RequiredGas, and ErrOutOfGas is returned when it is used up.
+type ModuleState struct {
+	Module   common.Address
+	Caller   common.Address
+	Value    *uint256.Int // transferred to Module before Run
+	IsStatic bool         // the changes are forbidden in static calls
+	Height   int64
+
+	txctrl   unsafe.Pointer
+	sequence uint64
+	gasLeft  uint64
+	outOfGas bool
+	returned bool // set after Run returns, such that a retained ModuleState cannot access a finished call
+}
+
+func (state *ModuleState) GasLeft() uint64 {
+	return state.gasLeft
+}
+
+func (state *ModuleState) useGas(gas uint64) error {
+	if state.returned {
+		panic("ModuleState is used after Run returns")
+	}
+	if gas > state.gasLeft {
+		state.gasLeft = 0
+		state.outOfGas = true
+		return errors.ErrOutOfGas
+	}
+	state.gasLeft -= gas
+	return nil
+}
+
+// Get returns the value at key in the module's storage, or nil if it does not exist
+func (state *ModuleState) Get(key [32]byte) ([]byte, error) {
+	if err := state.useGas(MODULE_READ_GAS); err != nil {
+		return nil, err
+	}
+	var k evmc_bytes32
+	writeCBytes32WithSlice(&k, key[:])
+	var size C.size_t
+	ptr := C.native_module_get_value(state.txctrl, C.uint64_t(state.sequence), &k, &size)
+	if size == 0 {
+		return nil, nil
+	}
+	return C.GoBytes(unsafe.Pointer(ptr), C.int(size)), nil
+}
+
+// Set writes value at key in the module's storage, and an empty value deletes key
+func (state *ModuleState) Set(key [32]byte, value []byte) error {
+	if state.IsStatic {
+		return errors.ErrWriteProtection
+	}
+	if len(value) > MaxModuleValueSize {
+		return errors.ErrValueTooLarge
+	}
+	if err := state.useGas(MODULE_WRITE_GAS); err != nil {
+		return err
+	}
+	var k evmc_bytes32
+	writeCBytes32WithSlice(&k, key[:])
+	var ptr *C.uint8_t
+	if len(value) != 0 {
+		ptr = (*C.uint8_t)(unsafe.Pointer(&value[0])) // evmwrap copies it
+	}
+	status := C.native_module_set_value(state.txctrl, C.uint64_t(state.sequence), &k, ptr, C.size_t(len(value)))
+	if status == C.EVMC_STORAGE_QUOTA_EXCEEDED {
+		return errors.ErrStorageQuotaExceeded
+	}
+	if status == C.EVMC_STORAGE_ADDED {
+		return state.useGas(MODULE_NEW_SLOT_GAS - MODULE_WRITE_GAS)
+	}
+	return nil
+}
+
+func (state *ModuleState) Balance(addr common.Address) (*uint256.Int, error) {
+	if err := state.useGas(MODULE_READ_GAS); err != nil {
+		return nil, err
+	}
+	var a evmc_address
+	writeCBytes20WithArray(&a, addr)
+	var balance evmc_bytes32
+	C.native_module_get_balance(state.txctrl, &a, &balance)
+	return uint256.NewInt(0).SetBytes32(C.GoBytes(unsafe.Pointer(&balance.bytes[0]), 32)), nil
+}
+
+// Transfer sends amount from the module's balance to recipient
+func (state *ModuleState) Transfer(recipient common.Address, amount *uint256.Int) error {
+	if state.IsStatic {
+		return errors.ErrWriteProtection
+	}
+	if err := state.useGas(MODULE_TRANSFER_GAS); err != nil {
+		return err
+	}
+	var sender, to evmc_address
+	writeCBytes20WithArray(&sender, state.Module)
+	writeCBytes20WithArray(&to, recipient)
+	var value evmc_bytes32
+	bz := amount.Bytes32()
+	writeCBytes32WithSlice(&value, bz[:])
+	if !C.native_module_transfer(state.txctrl, &sender, &to, &value) {
+		return errors.ErrBalanceNotEnough
+	}
+	return nil
+}
+
+//export call_native_module
+func call_native_module(handler C.int,
+	txctrl unsafe.Pointer,
+	module_addr *evmc_address,
+	caller *evmc_address,
+	value *evmc_bytes32,
+	is_static C.bool,
+	input_ptr unsafe.Pointer,
+	input_size C.int,
+	gas_left *C.uint64_t,
+	ret_value *C.int,
+	out_of_gas *C.int,
+	output_ptr *small_buffer,
+	output_size *C.int) {
+	*output_size = 0
+	*ret_value = 0
+	*out_of_gas = 0
+	// a Go panic must not unwind the C++ frames of evmone, so it fails the call instead
+	defer func() {
+		if r := recover(); r != nil {
+			*ret_value = 0
+			*out_of_gas = 0
+			*output_size = 0
+		}
+	}()
+	addr := toAddress(module_addr)
+	module, ok := nativeModules[addr]
+	if !ok {
+		return
+	}
+	input := C.GoBytes(input_ptr, input_size)
+	gasRequired := module.RequiredGas(input)
+	if gasRequired > uint64(*gas_left) {
+		*out_of_gas = 1
+		*gas_left = 0
+		return
+	}
+	state := &ModuleState{
+		Module:   addr,
+		Caller:   toAddress(caller),
+		Value:    uint256.NewInt(0).SetBytes32(C.GoBytes(unsafe.Pointer(&value.bytes[0]), 32)),
+		IsStatic: bool(is_static),
+		Height:   getRunner(int(handler)).Ctx.Height,
+		txctrl:   txctrl,
+		sequence: NativeModuleSequence(addr),
+		gasLeft:  uint64(*gas_left) - gasRequired,
+	}
+	output, err := runNativeModule(module, state, input)
+	if state.outOfGas {
+		*out_of_gas = 1
+		*gas_left = 0
+		return
+	}
+	if err != nil {
+		return
+	}
+	*gas_left = C.uint64_t(state.gasLeft)
+	size := len(output)
+	if size > SMALL_BUF_SIZE { // limit the copied data to prevent overflow
+		size = SMALL_BUF_SIZE
+	}
+	*output_size = C.int(size)
+	for i := 0; i < size; i++ {
+		output_ptr.data[i] = C.uint8_t(output[i])
+	}
+	*ret_value = 1
+}
+
+// Run module, and a panic in it, such as a bug of the module or the use of state after it returns, fails the
+// call like an error does, in which all the gas is consumed and the changes are reverted
+func runNativeModule(module NativeModule, state *ModuleState, input []byte) (output []byte, err error) {
+	defer func() {
+		state.returned = true
+		if r := recover(); r != nil {
+			output, err = nil, fmt.Errorf("native module %s panics: %v", state.Module.String(), r)
+		}
+	}()
+	return module.Run(state, input)
+}
+
+// returns the registered native modules, in the order of addresses
+func nativeModuleInfos() []PrecompileInfo {
+	res := make([]PrecompileInfo, 0, len(nativeModules))
+	for id := NATIVE_MODULE_ID_START; id <= NATIVE_MODULE_ID_END; id++ {
+		addr := common.BytesToAddress([]byte{byte(id >> 8), byte(id)})
+		if module, ok := nativeModules[addr]; ok {
+			res = append(res, PrecompileInfo{Address: addr, Name: module.name})
+		}
+	}
+	return res
+}
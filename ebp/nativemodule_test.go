@@ -0,0 +1,203 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+var counterModuleAddr = common.HexToAddress("0x0000000000000000000000000000000000002800")
+
+const counterModuleGas = 100
+
+// counterModule counts the calls in its storage, and refunds the value to the caller
+type counterModule struct{}
+
+func (counterModule) RequiredGas(input []byte) uint64 { return counterModuleGas }
+
+func (counterModule) Run(state *ModuleState, input []byte) ([]byte, error) {
+	var key [32]byte
+	bz, err := state.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	count := uint256.NewInt(0).SetBytes(bz)
+	count.AddUint64(count, 1)
+	res := count.Bytes32()
+	if err = state.Set(key, res[:]); err != nil {
+		return nil, err
+	}
+	if !state.Value.IsZero() {
+		if err = state.Transfer(state.Caller, state.Value); err != nil {
+			return nil, err
+		}
+	}
+	if len(input) != 0 && input[0] == 1 {
+		return nil, errors.ErrExecutionReverted // the changes are reverted
+	}
+	for len(input) != 0 && input[0] == 2 { // reads until out of gas
+		if _, err = state.Get(key); err != nil {
+			return nil, nil // out of gas anyway
+		}
+	}
+	return res[:], nil
+}
+
+func init() {
+	RegisterNativeModule(counterModuleAddr, "counter", counterModule{})
+}
+
+func nativeModulesConfig() *types.ChainConfig {
+	return &types.ChainConfig{Upgrades: []types.Upgrade{
+		{Height: 2, Rules: types.Rules{Revision: types.Istanbul, RefundQuotient: 2, NativeModules: true}}}}
+}
+
+func getCount(ctx *types.Context) uint64 {
+	var key [32]byte
+	bz := ctx.GetStorageAt(NativeModuleSequence(counterModuleAddr), string(key[:]))
+	return uint256.NewInt(0).SetBytes(bz).Uint64()
+}
+
+func TestRegisterNativeModule(t *testing.T) {
+	require.True(t, IsNativeModuleAddress(counterModuleAddr))
+	require.True(t, IsNativeModuleAddress(common.HexToAddress("0x28ff")))
+	require.False(t, IsNativeModuleAddress(common.HexToAddress("0x2900")))
+	require.False(t, IsNativeModuleAddress(common.HexToAddress("0x1000000000000000000000000000000000002800")))
+	require.Panics(t, func() { RegisterNativeModule(counterModuleAddr, "counter", counterModule{}) })
+	require.Panics(t, func() { RegisterNativeModule(BeaconAddress, "counter", counterModule{}) })
+	require.Equal(t, uint64(0xffffffff00002800), NativeModuleSequence(counterModuleAddr))
+
+	state := &ModuleState{IsStatic: true}
+	require.Equal(t, errors.ErrWriteProtection, state.Set([32]byte{}, []byte{1}))
+	require.Equal(t, errors.ErrWriteProtection, state.Transfer(from1, uint256.NewInt(1)))
+	state = &ModuleState{gasLeft: MODULE_READ_GAS - 1}
+	_, err := state.Get([32]byte{})
+	require.Equal(t, errors.ErrOutOfGas, err)
+	require.True(t, state.outOfGas)
+
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	ctx.SetChainConfig(nativeModulesConfig())
+	ctx.Height = 2
+	list := ActivePrecompiles(ctx)
+	require.Equal(t, PrecompileInfo{Address: counterModuleAddr, Name: "counter"}, list[len(list)-1])
+}
+
+func TestNativeModuleGas(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	ctx.SetChainConfig(nativeModulesConfig())
+	blk := &types.BlockInfo{Number: 2}
+	res := ExecuteReadOnly(ctx, ethereum.CallMsg{From: from1, To: &counterModuleAddr}, blk)
+	require.False(t, res.Failed())
+	require.Equal(t, uint64(1), uint256.NewInt(0).SetBytes(res.OutData).Uint64())
+	require.Equal(t, 21000+counterModuleGas+MODULE_READ_GAS+MODULE_NEW_SLOT_GAS, res.GasUsed)
+
+	res = ExecuteReadOnly(ctx, ethereum.CallMsg{From: from1, To: &counterModuleAddr, Data: []byte{2}}, blk)
+	require.True(t, StatusIsOutOfGas(res.Status))
+
+	// before the upgrade, it is an account without code
+	res = ExecuteReadOnly(ctx, ethereum.CallMsg{From: from1, To: &counterModuleAddr}, &types.BlockInfo{Number: 1})
+	require.False(t, res.Failed())
+	require.Empty(t, res.OutData)
+}
+
+func TestNativeModuleInBlocks(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 5, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	prepareAccAndTx(e)
+	newCtx := func() *types.Context {
+		ctx := prepareCtx(trunk)
+		ctx.SetChainConfig(nativeModulesConfig())
+		return ctx
+	}
+	runBlock := func(height int64, txs ...*gethtypes.Transaction) []*types.Transaction {
+		e.SetContext(newCtx())
+		for _, tx := range txs {
+			e.CollectTx(tx)
+		}
+		e.Prepare(0, 0, DefaultTxGasLimit)
+		e.SetContext(newCtx())
+		e.Execute(&types.BlockInfo{Number: height})
+		return e.CommittedTxs()
+	}
+	newTx := func(from common.Address, nonce uint64, value int64, data []byte) *gethtypes.Transaction {
+		tx, _ := gethtypes.NewTransaction(nonce, counterModuleAddr, big.NewInt(value), 100000, big.NewInt(1),
+			data).WithSignature(e.signer, from.Bytes())
+		return tx
+	}
+	runBlock(1) // the block at height 2 is prepared by the one at height 1
+	txs := runBlock(2,
+		newTx(from1, 0, 0, nil),
+		newTx(from2, 0, 0, []byte{1}), // fails, and its change is reverted
+		newTx(from3, 0, 500, nil))     // the value is refunded by the module
+	require.Len(t, txs, 3)
+	for _, tx := range txs {
+		if tx.From == from2 {
+			require.Equal(t, gethtypes.ReceiptStatusFailed, tx.Status)
+		} else {
+			require.Equal(t, gethtypes.ReceiptStatusSuccessful, tx.Status, tx.StatusStr)
+		}
+	}
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, uint64(2), getCount(e.cleanCtx))
+	acc := e.cleanCtx.GetAccount(counterModuleAddr) // the empty account is removed
+	require.True(t, acc == nil || acc.Balance().IsZero())
+	e.cleanCtx.Close(false)
+}
+
+var retainedState *ModuleState
+
+// retainingModule keeps the state of its first call, and uses it in the later ones
+type retainingModule struct{}
+
+func (retainingModule) RequiredGas(input []byte) uint64 { return 0 }
+
+func (retainingModule) Run(state *ModuleState, input []byte) ([]byte, error) {
+	if retainedState == nil {
+		retainedState = state
+		return nil, nil
+	}
+	return retainedState.Get([32]byte{}) // panics
+}
+
+func TestNativeModulePanic(t *testing.T) {
+	state := &ModuleState{gasLeft: 100000}
+	_, err := runNativeModule(retainingModule{}, state, nil)
+	require.Nil(t, err)
+	require.True(t, state.returned)
+	_, err = runNativeModule(retainingModule{}, &ModuleState{gasLeft: 100000}, nil)
+	require.NotNil(t, err)
+	retainedState = nil
+	_, err = runNativeModule(panicModule{}, &ModuleState{}, nil)
+	require.NotNil(t, err)
+
+	RegisterNativeModule(panicModuleAddr, "panic", panicModule{})
+	defer delete(nativeModules, panicModuleAddr)
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	ctx.SetChainConfig(nativeModulesConfig())
+	blk := &types.BlockInfo{Number: 2}
+	res := ExecuteReadOnly(ctx, ethereum.CallMsg{From: from1, To: &panicModuleAddr, Gas: 100000}, blk)
+	require.True(t, res.Failed())
+	require.Equal(t, uint64(100000), res.GasUsed) // all the gas is consumed
+}
@@ -0,0 +1,151 @@
+package ebp
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// nonceReservations tracks the nonce ranges handed out by ReserveNonces, which are not used by TXs yet
+type nonceReservations struct {
+	mtx  sync.Mutex
+	next map[common.Address]uint64 // the nonce after the last reserved range of an account
+}
+
+// pendingNonces tracks the nonces after the largest ones of the senders in standby queue, scheduled queue
+// and txList, such that the pending nonces are read without scanning them on each call. The senders of the
+// collected TXs are resolved when they are read, each one only once, to keep CollectTx cheap. The queued
+// ones are loaded once after the queues change.
+type pendingNonces struct {
+	mtx         sync.Mutex
+	collected   []*gethtypes.Transaction // the TXs in txList
+	resolved    int                      // how many TXs in collected are counted in next
+	next        map[common.Address]uint64
+	queued      map[common.Address]uint64
+	queueLoaded bool
+}
+
+func (p *pendingNonces) collect(tx *gethtypes.Transaction) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.collected = append(p.collected, tx)
+}
+
+// Forget the collected TXs, which are consumed by Prepare
+func (p *pendingNonces) resetCollected() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.collected, p.resolved, p.next = nil, 0, nil
+}
+
+// Load the queues again at the next read, since they are changed
+func (p *pendingNonces) invalidateQueued() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.queued, p.queueLoaded = nil, false
+}
+
+func raiseNonce(m map[common.Address]uint64, addr common.Address, nonce uint64) {
+	if n, ok := m[addr]; !ok || nonce+1 > n {
+		m[addr] = nonce + 1
+	}
+}
+
+// Returns the pending nonce of addr, which is the account nonce in world state increased by the TXs of addr
+// waiting in standby queue or scheduled queue and the ones collected for the next Prepare
+func (exec *txEngine) pendingNonce(addr common.Address) (uint64, error) {
+	ctx := exec.readCtx()
+	defer ctx.Close(false)
+	acc := ctx.GetAccount(addr)
+	if acc == nil {
+		return 0, errors.ErrAccountNotExist
+	}
+	p := &exec.pendingNonces
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if !p.queueLoaded {
+		p.queued = make(map[common.Address]uint64)
+		start, end := exec.getStandbyQueueRange()
+		for i := start; i < end; i++ {
+			var txToRun types.TxToRun
+			txToRun.FromBytes(ctx.Rbt.GetBaseStore().Get(types.GetStandbyTxKey(i)))
+			raiseNonce(p.queued, txToRun.From, txToRun.Nonce)
+		}
+		exec.scanScheduledTxs(ctx, func(tx *types.TxToRun) {
+			raiseNonce(p.queued, tx.From, tx.Nonce)
+		})
+		p.queueLoaded = true
+	}
+	if p.next == nil {
+		p.next = make(map[common.Address]uint64)
+	}
+	for ; p.resolved < len(p.collected); p.resolved++ {
+		tx := p.collected[p.resolved]
+		if sender, err := exec.signer.Sender(tx); err == nil {
+			raiseNonce(p.next, sender, tx.Nonce())
+		}
+	}
+	nonce := acc.Nonce()
+	for _, m := range [2]map[common.Address]uint64{p.queued, p.next} {
+		if n := m[addr]; n > nonce {
+			nonce = n
+		}
+	}
+	return nonce, nil
+}
+
+// Reserve count contiguous nonces for addr and return the first one. The range starts after the pending
+// nonce and the ranges reserved before, so concurrent callers never get overlapping ranges. A range is
+// released once the pending nonce passes it. The queues are scanned once after they change, so the cost
+// is linear to their lengths at most once in a block. It reads the clean context, which must not be used by Prepare or Execute at the same time.
+func (exec *txEngine) ReserveNonces(addr common.Address, count uint64) (first uint64, err error) {
+	first, err = exec.pendingNonce(addr)
+	if err != nil {
+		return 0, err
+	}
+	r := &exec.nonceReservations
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if next, ok := r.next[addr]; ok && next > first {
+		first = next
+	} else if ok {
+		delete(r.next, addr) // all the reserved nonces are used
+	}
+	if count == 0 {
+		return first, nil
+	}
+	if r.next == nil {
+		r.next = make(map[common.Address]uint64)
+	}
+	r.next[addr] = first + count
+	return first, nil
+}
+
+// inFlightNonces tracks the TXs loaded from the standby queue in this block but inserted back into it, by
+// their senders. A later tx of the sender is deferred until the earliest in-flight one is loaded again, such
+// that it does not overtake the earlier one across rounds and fail with TX_NONCE_TOO_LARGE.
+type inFlightNonces map[common.Address]uint64 // sender => the smallest nonce of its in-flight TXs
+
+// Record tx which is inserted back into the standby queue. It does nothing if m is nil.
+func (m inFlightNonces) add(tx *types.TxToRun) {
+	if m == nil {
+		return
+	}
+	if n, ok := m[tx.From]; !ok || tx.Nonce < n {
+		m[tx.From] = tx.Nonce
+	}
+}
+
+// Returns true if tx, which is just loaded, must wait for an in-flight tx of its sender with a smaller nonce.
+// The earliest in-flight tx is not tracked once it is loaded.
+func (m inFlightNonces) mustDefer(tx *types.TxToRun) bool {
+	n, ok := m[tx.From]
+	if ok && tx.Nonce == n {
+		delete(m, tx.From)
+	}
+	return ok && tx.Nonce > n
+}
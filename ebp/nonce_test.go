@@ -0,0 +1,141 @@
+package ebp
+
+import (
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestReserveNonces(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareEngine(trunk)
+	e.CollectTx(txs[0]) // from1, nonce 0
+
+	first, err := e.ReserveNonces(from1, 3)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), first) // after the collected tx
+	first, err = e.ReserveNonces(from1, 2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), first)
+	first, err = e.ReserveNonces(from3, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), first)
+	_, err = e.ReserveNonces(common.Address{0x77}, 1)
+	require.True(t, errors.Is(err, errors.ErrAccountNotExist))
+
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	first, err = e.ReserveNonces(from1, 0) // the tx is in standby queue now
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), first)
+	first, err = e.ReserveNonces(from2, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), first)
+
+	// the reservations are released once the pending nonce passes them
+	e.nonceReservations.next[from3] = 0
+	first, err = e.ReserveNonces(from3, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), first)
+	_, ok := e.nonceReservations.next[from3]
+	require.False(t, ok)
+}
+
+// countingSigner counts the calls of Sender
+type countingSigner struct {
+	testcase.DumbSigner
+	calls int64
+}
+
+func (s *countingSigner) Sender(tx *gethtypes.Transaction) (common.Address, error) {
+	atomic.AddInt64(&s.calls, 1)
+	return s.DumbSigner.Sender(tx)
+}
+
+func TestPendingNonceWhileCollecting(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+	signer := &countingSigner{}
+	e.signer = signer
+	e.SetContext(prepareCtx(trunk))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for nonce := uint64(0); nonce < 20; nonce++ {
+			tx, _ := gethtypes.NewTransaction(nonce, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(signer, from1.Bytes())
+			e.CollectTx(tx)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		_, err := e.pendingNonce(from1)
+		require.NoError(t, err)
+	}
+	wg.Wait()
+	nonce, err := e.pendingNonce(from1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), nonce)
+	nonce, err = e.pendingNonce(from2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), nonce)
+	require.Equal(t, int64(20), atomic.LoadInt64(&signer.calls)) // each sender is resolved only once
+	e.cleanCtx.Close(false)
+}
+
+func TestInFlightNonces(t *testing.T) {
+	var m inFlightNonces
+	m.add(&types.TxToRun{BasicTx: types.BasicTx{From: from1, Nonce: 3}}) // nil means disabled
+	require.False(t, m.mustDefer(&types.TxToRun{BasicTx: types.BasicTx{From: from1, Nonce: 4}}))
+
+	m = make(inFlightNonces)
+	m.add(&types.TxToRun{BasicTx: types.BasicTx{From: from1, Nonce: 3}})
+	m.add(&types.TxToRun{BasicTx: types.BasicTx{From: from1, Nonce: 5}})
+	m.add(&types.TxToRun{BasicTx: types.BasicTx{From: from1, Nonce: 2}})
+	require.True(t, m.mustDefer(&types.TxToRun{BasicTx: types.BasicTx{From: from1, Nonce: 5}}))
+	require.False(t, m.mustDefer(&types.TxToRun{BasicTx: types.BasicTx{From: from2, Nonce: 5}}))
+	require.False(t, m.mustDefer(&types.TxToRun{BasicTx: types.BasicTx{From: from1, Nonce: 1}}))
+	require.False(t, m.mustDefer(&types.TxToRun{BasicTx: types.BasicTx{From: from1, Nonce: 2}}))
+	require.False(t, m.mustDefer(&types.TxToRun{BasicTx: types.BasicTx{From: from1, Nonce: 5}}))
+}
+
+func TestTxEngine_DeferLaterNonces(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, _ := prepareEngine(trunk)
+	e.SetDeferLaterNonces(true)
+	scheduled, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	later, _ := gethtypes.NewTransaction(1, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	e.CollectScheduledTx(scheduled, 2)
+	e.CollectTx(later)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 1})
+	require.Equal(t, 0, len(e.committedTxs))
+	require.Equal(t, 0, e.requeuedCount) // the later tx waits instead of failing with TX_NONCE_TOO_LARGE
+
+	e.SetContext(prepareCtx(trunk))
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 2})
+	require.Equal(t, 2, len(e.committedTxs))
+	require.Equal(t, scheduled.Hash(), common.Hash(e.committedTxs[0].Hash))
+	require.Equal(t, later.Hash(), common.Hash(e.committedTxs[1].Hash))
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, 0, e.StandbyQLen())
+	e.cleanCtx.Close(false)
+}
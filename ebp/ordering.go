@@ -0,0 +1,254 @@
+package ebp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+	"github.com/seehuhn/mt19937"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// OrderingAlgorithm identifies how Prepare orders the TXs of a block in standby queue. It is a consensus
+// parameter, and a new version must be activated at the same height on all the nodes.
+type OrderingAlgorithm uint8
+
+const (
+	// The senders are shuffled with mt19937 seeded by reorderSeed, which swaps random pairs of them. A
+	// sender's TXs keep their order in the block.
+	OrderingShuffleV1 OrderingAlgorithm = 1
+	// The senders are sorted by keccak256(reorderSeed, sender), and the ties are broken by the sender
+	// addresses. A sender's TXs are sorted by their nonces, and the ties are broken by their hashes.
+	OrderingSeededHashV2 OrderingAlgorithm = 2
+	// The senders are sorted by the arrival of their first TXs in the block. A sender's TXs keep their order.
+	OrderingArrivalV3 OrderingAlgorithm = 3
+	// The senders are put into OrderingShardCount shards by the last bytes of their addresses, and the shards
+	// take turns to contribute their senders, starting from the shard selected by reorderSeed. In a shard,
+	// the senders are sorted by their arrival. Adjacent senders are likely to touch different accounts.
+	OrderingShardedV4 OrderingAlgorithm = 4
+	// The senders are sorted by the effective gas prices of their first TXs in descending order, and the ties
+	// are broken as OrderingSeededHashV2 does. A sender's TXs are sorted as OrderingSeededHashV2 does.
+	OrderingGasPriceV5 OrderingAlgorithm = 5
+
+	DefaultOrderingAlgorithm = OrderingShuffleV1
+
+	OrderingShardCount = 16
+)
+
+func (alg OrderingAlgorithm) IsValid() bool {
+	_, ok := orderingPolicies[alg]
+	return ok
+}
+
+// SenderGroup contains the TXs of one sender collected for a block, in the order of their arrival
+type SenderGroup struct {
+	Sender common.Address
+	Txs    []*types.TxToRun
+}
+
+// OrderingPolicy decides the order of the TXs collected for a block. Order reorders groups, which are in
+// the order of arrival, and it may also reorder the TXs in each group, but must neither add nor remove TXs.
+// A sender's TXs are always kept back-to-back. The result must only depend on groups and reorderSeed.
+type OrderingPolicy interface {
+	Order(groups []SenderGroup, reorderSeed int64)
+}
+
+var orderingPolicies = map[OrderingAlgorithm]OrderingPolicy{
+	OrderingShuffleV1:    shuffleOrdering{},
+	OrderingSeededHashV2: seededHashOrdering{},
+	OrderingArrivalV3:    arrivalOrdering{},
+	OrderingShardedV4:    shardedOrdering{},
+	OrderingGasPriceV5:   gasPriceOrdering{},
+}
+
+// RegisterOrderingPolicy makes policy selectable by alg with SetOrderingAlgorithm and SetOrderingForks.
+// It is not thread-safe and must be called before the engine is configured, such as in init(). The
+// registered algorithms cannot be overridden.
+func RegisterOrderingPolicy(alg OrderingAlgorithm, policy OrderingPolicy) {
+	if alg == 0 || alg.IsValid() {
+		panic(fmt.Sprintf("ordering algorithm %d is reserved or registered", alg))
+	}
+	orderingPolicies[alg] = policy
+}
+
+// OrderingFork activates Algorithm from the block at Height on
+type OrderingFork struct {
+	Height    int64
+	Algorithm OrderingAlgorithm
+}
+
+// BlockResults records how a block was produced by the engine, such that a replay can verify it
+type BlockResults struct {
+	Height int64
+	// the algorithm ordering the TXs collected for this block, which are prepared right before it is executed
+	OrderingAlgorithm OrderingAlgorithm
+	TxCount           int
+	GasUsed           uint64
+	BaseFee           uint256.Int // zero if the dynamic fee is not enabled
+	BurntFee          uint256.Int // the base fees of the dynamic fee TXs, which are not in the gas fee
+	// how many times the conflicting TXs were run again in the block, with the retries of SetMaxRetries
+	Reexecuted int
+	// how many conflicting TXs were inserted back into the standby queue
+	Requeued int
+	// the names of the end-block hooks which failed and whose changes were discarded
+	FailedHooks []string
+}
+
+// Returns the algorithm in effect at height. Before the first fork, it is the one set by SetOrderingAlgorithm.
+func (exec *txEngine) orderingAlgorithmAt(height int64) OrderingAlgorithm {
+	alg := exec.orderingAlgorithm
+	for _, fork := range exec.orderingForks {
+		if fork.Height > height {
+			break
+		}
+		alg = fork.Algorithm
+	}
+	return alg
+}
+
+// Returns the TXs of infoList in the order of alg, and the TXs of each sender in that order
+func orderInfoList(alg OrderingAlgorithm, infoList []*preparedInfo, reorderSeed int64) (out []*preparedInfo, addr2Infos map[common.Address][]*preparedInfo) {
+	policy, ok := orderingPolicies[alg]
+	if !ok {
+		policy = orderingPolicies[DefaultOrderingAlgorithm]
+	}
+	tx2Info := make(map[*types.TxToRun]*preparedInfo, len(infoList))
+	addr2Group := make(map[common.Address]int, len(infoList))
+	groups := make([]SenderGroup, 0, len(infoList))
+	for _, info := range infoList {
+		tx2Info[info.tx] = info
+		idx, ok := addr2Group[info.tx.From]
+		if !ok {
+			idx = len(groups)
+			addr2Group[info.tx.From] = idx
+			groups = append(groups, SenderGroup{Sender: info.tx.From})
+		}
+		groups[idx].Txs = append(groups[idx].Txs, info.tx)
+	}
+	policy.Order(groups, reorderSeed)
+	out = make([]*preparedInfo, 0, len(infoList))
+	addr2Infos = make(map[common.Address][]*preparedInfo, len(groups))
+	for _, group := range groups {
+		infos := make([]*preparedInfo, len(group.Txs))
+		for i, tx := range group.Txs {
+			infos[i] = tx2Info[tx]
+		}
+		addr2Infos[group.Sender] = infos
+		out = append(out, infos...)
+	}
+	return
+}
+
+type shuffleOrdering struct{}
+
+func (shuffleOrdering) Order(groups []SenderGroup, reorderSeed int64) {
+	rand := mt19937.New()
+	rand.Seed(reorderSeed)
+	for i := 0; i < len(groups); i++ { // shuffle the senders
+		r0 := int(rand.Int63()) % len(groups)
+		r1 := int(rand.Int63()) % len(groups)
+		groups[r0], groups[r1] = groups[r1], groups[r0]
+	}
+}
+
+type seededHashOrdering struct{}
+
+func (seededHashOrdering) Order(groups []SenderGroup, reorderSeed int64) {
+	keys := seededKeys(groups, reorderSeed)
+	sort.Slice(groups, func(i, j int) bool {
+		return lessBySeededKey(keys, groups[i].Sender, groups[j].Sender)
+	})
+	sortByNonce(groups)
+}
+
+type gasPriceOrdering struct{}
+
+func (gasPriceOrdering) Order(groups []SenderGroup, reorderSeed int64) {
+	sortByNonce(groups)
+	keys := seededKeys(groups, reorderSeed)
+	prices := make(map[common.Address]*uint256.Int, len(groups))
+	for _, group := range groups {
+		prices[group.Sender] = uint256.NewInt(0).SetBytes32(group.Txs[0].GasPrice[:])
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		pi, pj := prices[groups[i].Sender], prices[groups[j].Sender]
+		if !pi.Eq(pj) {
+			return pi.Gt(pj)
+		}
+		return lessBySeededKey(keys, groups[i].Sender, groups[j].Sender)
+	})
+}
+
+// returns keccak256(reorderSeed, sender) of the senders
+func seededKeys(groups []SenderGroup, reorderSeed int64) map[common.Address][]byte {
+	var seed [8]byte
+	binary.BigEndian.PutUint64(seed[:], uint64(reorderSeed))
+	keys := make(map[common.Address][]byte, len(groups))
+	for _, group := range groups {
+		keys[group.Sender] = crypto.Keccak256(seed[:], group.Sender[:])
+	}
+	return keys
+}
+
+func lessBySeededKey(keys map[common.Address][]byte, a, b common.Address) bool {
+	if c := bytes.Compare(keys[a], keys[b]); c != 0 {
+		return c < 0
+	}
+	return bytes.Compare(a[:], b[:]) < 0
+}
+
+// sorts the TXs of each sender by their nonces, and the ties are broken by their hashes
+func sortByNonce(groups []SenderGroup) {
+	for _, group := range groups {
+		txs := group.Txs
+		sort.SliceStable(txs, func(i, j int) bool {
+			if txs[i].Nonce != txs[j].Nonce {
+				return txs[i].Nonce < txs[j].Nonce
+			}
+			return bytes.Compare(txs[i].HashID[:], txs[j].HashID[:]) < 0
+		})
+	}
+}
+
+type arrivalOrdering struct{}
+
+func (arrivalOrdering) Order(groups []SenderGroup, reorderSeed int64) {}
+
+type shardedOrdering struct{}
+
+func (shardedOrdering) Order(groups []SenderGroup, reorderSeed int64) {
+	var shards [OrderingShardCount][]SenderGroup
+	for _, group := range groups {
+		shard := group.Sender[common.AddressLength-1] % OrderingShardCount
+		shards[shard] = append(shards[shard], group)
+	}
+	first := int(uint64(reorderSeed) % OrderingShardCount)
+	for n, round := 0, 0; n < len(groups); round++ {
+		for i := 0; i < OrderingShardCount; i++ {
+			shard := shards[(first+i)%OrderingShardCount]
+			if round < len(shard) {
+				groups[n] = shard[round]
+				n++
+			}
+		}
+	}
+}
+
+func (exec *txEngine) recordBlockResults() {
+	exec.blockResults = BlockResults{
+		Height:            exec.currentBlock.Number,
+		OrderingAlgorithm: exec.preparedOrdering,
+		TxCount:           len(exec.committedTxs),
+		GasUsed:           exec.cumulativeGasUsed,
+		BaseFee:           *new(uint256.Int).SetBytes32(exec.currentBlock.BaseFee[:]),
+		BurntFee:          *exec.cumulativeBurntFee,
+		Reexecuted:        exec.reexecutedCount,
+		Requeued:          exec.requeuedCount,
+		FailedHooks:       exec.failedHooks,
+	}
+}
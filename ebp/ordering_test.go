@@ -0,0 +1,190 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func newOrderingInfo(from byte, nonce uint64, hash byte) *preparedInfo {
+	return &preparedInfo{tx: &types.TxToRun{
+		BasicTx: types.BasicTx{From: common.Address{from}, Nonce: nonce},
+		HashID:  common.Hash{hash},
+	}}
+}
+
+func orderedHashes(infos []*preparedInfo) []byte {
+	res := make([]byte, len(infos))
+	for i, info := range infos {
+		res[i] = info.tx.HashID[0]
+	}
+	return res
+}
+
+func TestOrderBySeededHash(t *testing.T) {
+	infoList := []*preparedInfo{
+		newOrderingInfo(1, 1, 10),
+		newOrderingInfo(2, 0, 20),
+		newOrderingInfo(1, 0, 11),
+		newOrderingInfo(3, 0, 30),
+		newOrderingInfo(1, 1, 9), // same nonce, smaller hash
+		newOrderingInfo(4, 0, 40),
+	}
+	out, addr2Infos := orderInfoList(OrderingSeededHashV2, infoList, 7)
+	require.Equal(t, len(infoList), len(out))
+	require.Equal(t, []byte{11, 9, 10}, orderedHashes(addr2Infos[common.Address{1}]))
+
+	// the result only depends on the seed, not on the order of the senders in the block
+	reversed := make([]*preparedInfo, len(infoList))
+	for i, info := range infoList {
+		reversed[len(infoList)-1-i] = info
+	}
+	out2, _ := orderInfoList(OrderingSeededHashV2, reversed, 7)
+	require.Equal(t, orderedHashes(out), orderedHashes(out2))
+
+	differs := false
+	for seed := int64(0); seed < 10 && !differs; seed++ {
+		out3, _ := orderInfoList(OrderingSeededHashV2, infoList, seed)
+		differs = string(orderedHashes(out3)) != string(orderedHashes(out))
+	}
+	require.True(t, differs)
+}
+
+func TestOrderingAlgorithmOfEngine(t *testing.T) {
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	require.Equal(t, OrderingShuffleV1, e.OrderingAlgorithm())
+	e.SetOrderingAlgorithm(OrderingAlgorithm(99))
+	require.Equal(t, OrderingShuffleV1, e.OrderingAlgorithm())
+	e.SetOrderingAlgorithm(OrderingSeededHashV2)
+	require.Equal(t, OrderingSeededHashV2, e.OrderingAlgorithm())
+
+	infoList := []*preparedInfo{newOrderingInfo(1, 1, 10), newOrderingInfo(1, 0, 11)}
+	out, _ := orderInfoList(OrderingShuffleV1, infoList, 0)
+	require.Equal(t, []byte{10, 11}, orderedHashes(out)) // the order in the block is kept
+}
+
+func TestOrderingForks(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetOrderingForks([]OrderingFork{
+		{Height: 10, Algorithm: OrderingShuffleV1},
+		{Height: 5, Algorithm: OrderingSeededHashV2},
+		{Height: 7, Algorithm: OrderingAlgorithm(99)}, // ignored
+	})
+	require.Equal(t, OrderingShuffleV1, e.orderingAlgorithmAt(4))
+	require.Equal(t, OrderingSeededHashV2, e.orderingAlgorithmAt(5))
+	require.Equal(t, OrderingSeededHashV2, e.orderingAlgorithmAt(9))
+	require.Equal(t, OrderingShuffleV1, e.orderingAlgorithmAt(10))
+
+	// the block at height 5 is prepared when the block at height 4 is the current one
+	for h := int64(4); h <= 5; h++ {
+		e.SetContext(prepareCtx(trunk))
+		e.Prepare(0, 0, DefaultTxGasLimit)
+		e.SetContext(prepareCtx(trunk))
+		e.Execute(&types.BlockInfo{Number: h})
+	}
+	res := e.BlockResults()
+	require.Equal(t, int64(5), res.Height)
+	require.Equal(t, OrderingSeededHashV2, res.OrderingAlgorithm)
+	require.Equal(t, 0, res.TxCount)
+}
+
+func TestOrderByArrival(t *testing.T) {
+	infoList := []*preparedInfo{
+		newOrderingInfo(3, 1, 30),
+		newOrderingInfo(1, 0, 10),
+		newOrderingInfo(3, 0, 31),
+		newOrderingInfo(2, 0, 20),
+	}
+	out, addr2Infos := orderInfoList(OrderingArrivalV3, infoList, 7)
+	require.Equal(t, []byte{30, 31, 10, 20}, orderedHashes(out))
+	require.Equal(t, []byte{30, 31}, orderedHashes(addr2Infos[common.Address{3}]))
+}
+
+func TestOrderBySharding(t *testing.T) {
+	newInfo := func(last byte, hash byte) *preparedInfo {
+		info := newOrderingInfo(hash, 0, hash)
+		info.tx.From[common.AddressLength-1] = last
+		return info
+	}
+	infoList := []*preparedInfo{
+		newInfo(0x01, 1), // shard 1
+		newInfo(0x11, 2), // shard 1
+		newInfo(0x02, 3), // shard 2
+		newInfo(0x21, 4), // shard 1
+		newInfo(0x0f, 5), // shard 15
+	}
+	out, _ := orderInfoList(OrderingShardedV4, infoList, 0)
+	require.Equal(t, []byte{1, 3, 5, 2, 4}, orderedHashes(out))
+	out, _ = orderInfoList(OrderingShardedV4, infoList, 2)
+	require.Equal(t, []byte{3, 5, 1, 2, 4}, orderedHashes(out))
+	out, _ = orderInfoList(OrderingShardedV4, infoList, OrderingShardCount+15)
+	require.Equal(t, []byte{5, 1, 3, 2, 4}, orderedHashes(out))
+}
+
+type reversedOrdering struct{}
+
+func (reversedOrdering) Order(groups []SenderGroup, reorderSeed int64) {
+	for i, j := 0, len(groups)-1; i < j; i, j = i+1, j-1 {
+		groups[i], groups[j] = groups[j], groups[i]
+	}
+}
+
+func TestRegisterOrderingPolicy(t *testing.T) {
+	const alg = OrderingAlgorithm(200)
+	require.False(t, alg.IsValid())
+	RegisterOrderingPolicy(alg, reversedOrdering{})
+	defer delete(orderingPolicies, alg)
+	require.True(t, alg.IsValid())
+	require.Panics(t, func() { RegisterOrderingPolicy(alg, reversedOrdering{}) })
+	require.Panics(t, func() { RegisterOrderingPolicy(OrderingShuffleV1, reversedOrdering{}) })
+	require.Panics(t, func() { RegisterOrderingPolicy(0, reversedOrdering{}) })
+
+	infoList := []*preparedInfo{newOrderingInfo(1, 0, 10), newOrderingInfo(2, 0, 20), newOrderingInfo(1, 1, 11)}
+	out, _ := orderInfoList(alg, infoList, 0)
+	require.Equal(t, []byte{20, 10, 11}, orderedHashes(out))
+
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetOrderingAlgorithm(alg)
+	require.Equal(t, alg, e.OrderingAlgorithm())
+}
+
+func TestOrderByGasPrice(t *testing.T) {
+	newInfo := func(from byte, nonce uint64, hash byte, price uint64) *preparedInfo {
+		info := newOrderingInfo(from, nonce, hash)
+		info.tx.GasPrice = uint256.NewInt(price).Bytes32()
+		return info
+	}
+	infoList := []*preparedInfo{
+		newInfo(1, 1, 11, 50),
+		newInfo(2, 0, 20, 10),
+		newInfo(1, 0, 10, 5), // the first TX of sender 1 decides its priority
+		newInfo(3, 0, 30, 10),
+		newInfo(4, 0, 40, 20),
+	}
+	out, addr2Infos := orderInfoList(OrderingGasPriceV5, infoList, 7)
+	require.Equal(t, []byte{10, 11}, orderedHashes(addr2Infos[common.Address{1}]))
+	hashes := orderedHashes(out)
+	require.Equal(t, byte(40), hashes[0])
+	require.Equal(t, []byte{10, 11}, hashes[3:])
+
+	// the tie of sender 2 and 3 is broken as OrderingSeededHashV2 does
+	tied := []*preparedInfo{infoList[1], infoList[3]}
+	expected, _ := orderInfoList(OrderingSeededHashV2, tied, 7)
+	require.Equal(t, orderedHashes(expected), hashes[1:3])
+
+	reversed := make([]*preparedInfo, len(infoList))
+	for i, info := range infoList {
+		reversed[len(infoList)-1-i] = info
+	}
+	out2, _ := orderInfoList(OrderingGasPriceV5, reversed, 7)
+	require.Equal(t, hashes, orderedHashes(out2))
+}
@@ -0,0 +1,41 @@
+package ebp
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestMaxOutDataSize(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, _ := prepareEngine(trunk)
+	e.SetMaxOutDataSize(40)
+	identity := common.BytesToAddress([]byte{4}) // the precompile returns its input
+	short, long := bytes.Repeat([]byte{1}, 40), bytes.Repeat([]byte{2}, 100)
+	tx1, _ := gethtypes.NewTransaction(0, identity, big.NewInt(0), 100000, big.NewInt(1), short).WithSignature(e.signer, from1.Bytes())
+	tx2, _ := gethtypes.NewTransaction(0, identity, big.NewInt(0), 100000, big.NewInt(1), long).WithSignature(e.signer, from2.Bytes())
+	e.CollectTx(tx1)
+	e.CollectTx(tx2)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{})
+	require.Equal(t, 2, len(e.committedTxs))
+	for _, tx := range e.committedTxs {
+		if tx.Hash == tx1.Hash() {
+			require.Equal(t, short, tx.OutData)
+			require.False(t, tx.OutDataTruncated)
+		} else {
+			require.Equal(t, long[:40], tx.OutData)
+			require.True(t, tx.OutDataTruncated)
+		}
+	}
+	e.cleanCtx.Close(false)
+}
@@ -0,0 +1,199 @@
+package ebp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+const (
+	eoaSequence    = ^uint64(0)
+	sep206Sequence = ^uint64(1)
+)
+
+// OverrideAccount replaces some fields of an account before a read-only call, as the state override set of
+// eth_call in geth. A nil field is not overridden. State replaces the whole storage, while StateDiff only
+// replaces the given slots, so they cannot be both set.
+type OverrideAccount struct {
+	Nonce     *hexutil.Uint64              `json:"nonce"`
+	Code      *hexutil.Bytes               `json:"code"`
+	Balance   *hexutil.Big                 `json:"balance"`
+	State     *map[common.Hash]common.Hash `json:"state"`
+	StateDiff *map[common.Hash]common.Hash `json:"stateDiff"`
+}
+
+// StateOverride is the set of the accounts overridden before a read-only call
+type StateOverride map[common.Address]OverrideAccount
+
+// Apply writes the overrides into ctx, which must be a temporary copy, such as the one from WithRbtCopy.
+// The account whose whole storage is replaced, or which gets storage or code for the first time, is assigned
+// a new sequence, such that its former storage is not seen.
+func (o StateOverride) Apply(ctx *types.Context) error {
+	for addr, account := range o {
+		if account.State != nil && account.StateDiff != nil {
+			return fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
+		}
+		acc := ctx.GetAccount(addr)
+		if acc == nil {
+			acc = types.ZeroAccountInfo()
+			acc.UpdateSequence(eoaSequence)
+		}
+		if account.Nonce != nil {
+			acc.UpdateNonce(uint64(*account.Nonce))
+		}
+		if account.Balance != nil {
+			balance, overflow := uint256.FromBig((*big.Int)(account.Balance))
+			if overflow || (*big.Int)(account.Balance).Sign() < 0 {
+				return fmt.Errorf("account %s has an invalid balance", addr.Hex())
+			}
+			acc.UpdateBalance(balance)
+		}
+		seq := acc.Sequence()
+		needStorage := account.State != nil || account.StateDiff != nil
+		if seq == sep206Sequence && (needStorage || account.Code != nil) {
+			return errors.New("the code and storage of SEP206 cannot be overridden")
+		}
+		if account.State != nil || (seq == eoaSequence && (needStorage || account.Code != nil)) {
+			acc.UpdateSequence(newSequence(ctx, addr))
+		}
+		ctx.SetAccount(addr, acc)
+		if account.Code != nil {
+			setBytecode(ctx, addr, *account.Code)
+		}
+		slots := account.StateDiff
+		if account.State != nil {
+			slots = account.State
+		}
+		if slots != nil {
+			for key, value := range *slots {
+				if value == (common.Hash{}) {
+					ctx.DeleteStorageAt(acc.Sequence(), string(key[:]))
+				} else {
+					ctx.SetStorageAt(acc.Sequence(), string(key[:]), value[:])
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// allocate a sequence in the way of set_bytecode in evmwrap
+func newSequence(ctx *types.Context, addr common.Address) uint64 {
+	k := types.GetCreationCounterKey(addr[0])
+	var counter uint64
+	if v := ctx.Rbt.Get(k); v != nil {
+		counter = binary.BigEndian.Uint64(v)
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], counter+1)
+	ctx.Rbt.Set(k, buf[:])
+	return (counter << 8) | uint64(addr[0])
+}
+
+func setBytecode(ctx *types.Context, addr common.Address, code []byte) {
+	k := types.GetBytecodeKey(addr)
+	if len(code) == 0 {
+		ctx.Rbt.Delete(k)
+		return
+	}
+	bz := make([]byte, 33, 33+len(code))
+	bz[0] = 0 // version byte is zero
+	copy(bz[1:33], crypto.Keccak256(code))
+	ctx.Rbt.Set(k, append(bz, code...))
+}
+
+// BlockOverrides replaces some fields of the block info before a read-only call, such that the contracts
+// depending on the time or the height can be tested. A nil field is not overridden. Random overrides
+// Difficulty, which is the PREVRANDAO after the merge.
+type BlockOverrides struct {
+	Number     *hexutil.Uint64 `json:"number"`
+	Time       *hexutil.Uint64 `json:"time"`
+	GasLimit   *hexutil.Uint64 `json:"gasLimit"`
+	Coinbase   *common.Address `json:"coinbase"`
+	Difficulty *hexutil.Big    `json:"difficulty"`
+	Random     *common.Hash    `json:"random"`
+	BaseFee    *hexutil.Big    `json:"baseFee"`
+}
+
+// Apply returns a copy of blk with the overridden fields, blk is not changed
+func (o *BlockOverrides) Apply(blk *types.BlockInfo) (*types.BlockInfo, error) {
+	res := *blk
+	if o == nil {
+		return &res, nil
+	}
+	if o.Difficulty != nil && o.Random != nil {
+		return nil, errors.New("both 'difficulty' and 'random' are overridden")
+	}
+	if o.Number != nil {
+		if uint64(*o.Number) > math.MaxInt64 {
+			return nil, errors.New("the overridden block number is too large")
+		}
+		res.Number = int64(*o.Number)
+	}
+	if o.Time != nil {
+		if uint64(*o.Time) > math.MaxInt64 {
+			return nil, errors.New("the overridden timestamp is too large")
+		}
+		res.Timestamp = int64(*o.Time)
+	}
+	if o.GasLimit != nil {
+		if uint64(*o.GasLimit) > math.MaxInt64 {
+			return nil, errors.New("the overridden gas limit is too large")
+		}
+		res.GasLimit = int64(*o.GasLimit)
+	}
+	if o.Coinbase != nil {
+		res.Coinbase = *o.Coinbase
+	}
+	if o.Random != nil {
+		res.Difficulty = *o.Random
+	}
+	var err error
+	if o.Difficulty != nil {
+		res.Difficulty, err = bigToOverride("difficulty", o.Difficulty)
+	}
+	if err == nil && o.BaseFee != nil {
+		res.BaseFee, err = bigToOverride("base fee", o.BaseFee)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func bigToOverride(name string, b *hexutil.Big) ([32]byte, error) {
+	v, overflow := uint256.FromBig((*big.Int)(b))
+	if overflow || (*big.Int)(b).Sign() < 0 {
+		return [32]byte{}, fmt.Errorf("the overridden %s is invalid", name)
+	}
+	return v.Bytes32(), nil
+}
+
+// ExecuteReadOnlyWithOverrides runs msg as ExecuteReadOnly does, after applying the overrides on the copy of
+// ctx and currBlock. Both overrides can be nil. Returns an error if the overrides are invalid.
+func ExecuteReadOnlyWithOverrides(ctx *types.Context, msg ethereum.CallMsg, currBlock *types.BlockInfo,
+	overrides StateOverride, blockOverrides *BlockOverrides) (CallResult, error) {
+	blk, err := blockOverrides.Apply(currBlock)
+	if err != nil {
+		return CallResult{}, err
+	}
+	rbtCopy := ctx.WithRbtCopy()
+	defer rbtCopy.Close(false)
+	if blk.Number != currBlock.Number {
+		rbtCopy.SetCurrentHeight(blk.Number) // the forks are decided by the overridden height
+	}
+	if err := overrides.Apply(rbtCopy); err != nil {
+		return CallResult{}, err
+	}
+	return runReadOnly(rbtCopy, &msg, blk), nil
+}
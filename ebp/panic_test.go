@@ -0,0 +1,135 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+type panicExecutor struct{}
+
+func (pe panicExecutor) RequiredGas(input []byte) uint64           { return 0 }
+func (pe panicExecutor) Run(input []byte) ([]byte, error)          { return nil, nil }
+func (pe panicExecutor) Init(ctx *types.Context)                   {}
+func (pe panicExecutor) IsSystemContract(addr common.Address) bool { return true }
+func (pe panicExecutor) Execute(ctx *types.Context, currBlock *types.BlockInfo, tx *types.TxToRun) (int, []types.EvmLog, uint64, []byte) {
+	panic("bad executor")
+}
+
+func TestPanicInRunner(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	panicAddr := common.HexToAddress("0x2710")
+	PredefinedContractManager[panicAddr] = panicExecutor{}
+	defer delete(PredefinedContractManager, panicAddr)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	txs := prepareAccAndTx(e)
+	tx1, _ := gethtypes.NewTransaction(0, panicAddr, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	txs[0] = tx1
+	e.SetContext(prepareCtx(trunk))
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	require.NotPanics(t, func() { e.Execute(&types.BlockInfo{}) })
+	// the panicked TX fails like a failed TX, which uses all its gas and consumes its nonce
+	require.Equal(t, 2, len(e.committedTxs))
+	require.Equal(t, from1, common.Address(e.committedTxs[0].From))
+	require.Equal(t, gethtypes.ReceiptStatusFailed, e.committedTxs[0].Status)
+	require.Equal(t, "execution-panic", e.committedTxs[0].StatusStr)
+	require.Equal(t, uint64(100000), e.committedTxs[0].GasUsed)
+	require.Equal(t, from2, common.Address(e.committedTxs[1].From))
+	gasUsed, _, _ := e.GasUsedInfo()
+	require.Equal(t, uint64(100000+21000), gasUsed)
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, uint64(1), e.cleanCtx.GetAccount(from1).Nonce())
+	require.Equal(t, uint64(10000_0000_0000-100000), e.cleanCtx.GetAccount(from1).Balance().Uint64())
+	e.cleanCtx.Close(false)
+	e.SetContext(prepareCtx(trunk))
+	startKey, endKey := e.getStandbyQueueRange()
+	require.Equal(t, startKey, endKey)
+}
+
+func TestPanicDoesNotBlockSender(t *testing.T) {
+	AdjustGasUsed = false
+	panicAddr := common.HexToAddress("0x2710")
+	PredefinedContractManager[panicAddr] = panicExecutor{}
+	defer delete(PredefinedContractManager, panicAddr)
+	for _, setup := range []func(e *txEngine){
+		func(e *txEngine) {},
+		func(e *txEngine) { e.SetAccountAffinity(true) }, // the two TXs run in one group
+		func(e *txEngine) { e.SetEarlyConflictHints(true) },
+	} {
+		trunk, root := prepareTruck()
+		e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+		setup(e)
+		e.SetContext(prepareCtx(trunk))
+		_ = prepareAccAndTx(e)
+		e.SetContext(prepareCtx(trunk))
+		tx0, _ := gethtypes.NewTransaction(0, panicAddr, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+		tx1, _ := gethtypes.NewTransaction(1, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+		e.CollectTx(tx0)
+		e.CollectTx(tx1)
+		e.Prepare(0, 0, DefaultTxGasLimit)
+		e.SetContext(prepareCtx(trunk))
+		require.NotPanics(t, func() { e.Execute(&types.BlockInfo{}) })
+		// the later TX of the sender runs after the nonce of the panicked one is consumed
+		require.Equal(t, 2, len(e.committedTxs))
+		require.Equal(t, "execution-panic", e.committedTxs[0].StatusStr)
+		require.Equal(t, tx1.Hash(), common.Hash(e.committedTxs[1].Hash))
+		require.Equal(t, gethtypes.ReceiptStatusSuccessful, e.committedTxs[1].Status)
+		require.Equal(t, 0, e.StandbyQLen())
+		e.SetContext(prepareCtx(trunk))
+		require.Equal(t, uint64(2), e.cleanCtx.GetAccount(from1).Nonce())
+		e.cleanCtx.Close(false)
+		closeTestCtx(root)
+	}
+}
+
+var panicModuleAddr = common.HexToAddress("0x0000000000000000000000000000000000002801")
+
+// panicModule panics in the Go callback of evmone
+type panicModule struct{}
+
+func (panicModule) RequiredGas(input []byte) uint64                      { return 0 }
+func (panicModule) Run(state *ModuleState, input []byte) ([]byte, error) { panic("bad module") }
+
+func TestPanicInEVMRecovered(t *testing.T) {
+	defer func(adjust bool) { AdjustGasUsed = adjust }(AdjustGasUsed)
+	AdjustGasUsed = false
+	RegisterNativeModule(panicModuleAddr, "panic", panicModule{})
+	defer delete(nativeModules, panicModuleAddr)
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+	newCtx := func() *types.Context {
+		ctx := prepareCtx(trunk)
+		ctx.SetChainConfig(nativeModulesConfig())
+		return ctx
+	}
+	e.SetContext(newCtx())
+	tx, _ := gethtypes.NewTransaction(0, panicModuleAddr, big.NewInt(0), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	e.CollectTx(tx)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(newCtx())
+	// the panic is recovered in the callback of evmone, which fails the call
+	require.NotPanics(t, func() { e.Execute(&types.BlockInfo{Number: 2}) })
+	require.Len(t, e.committedTxs, 1)
+	require.Equal(t, gethtypes.ReceiptStatusFailed, e.committedTxs[0].Status)
+	require.Equal(t, uint64(100000), e.committedTxs[0].GasUsed)
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, uint64(1), e.cleanCtx.GetAccount(from1).Nonce())
+	e.cleanCtx.Close(false)
+}
@@ -1,13 +1,17 @@
 package ebp
 
 import (
-	"errors"
+	"crypto/sha256"
+	"math/big"
 	"unsafe"
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/vechain/go-ecvrf"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
 )
 
 //#include <stdint.h>
@@ -28,19 +32,23 @@ import "C"
 //byte{9}): &blake2F{},
 
 const (
-	VRF_VERIFY_GAS uint64 = 5000
+	VRF_VERIFY_GAS        uint64 = 5000
+	SCHNORR_VERIFY_GAS    uint64 = 3000
+	BCH_SPV_VERIFY_GAS    uint64 = 2000
+	BCH_SPV_PER_LEVEL_GAS uint64 = 200  // for each hash in the merkle branch
+	RANDOM_BEACON_GAS     uint64 = 2100 // the same as a cold SLOAD
 )
 
 type VrfVerifyContract struct{}
 
 func (vdfc *VrfVerifyContract) RequiredGas(input []byte) uint64 {
-	return VRF_VERIFY_GAS
+	return precompileGasTables[Sep109Address].Gas(input)
 }
 
 func (vdfc *VrfVerifyContract) Run(input []byte) ([]byte, error) {
 	var zeros [32]byte
 	if len(input) <= 32+33 {
-		return zeros[:], errors.New("input two short")
+		return zeros[:], errors.ErrInputTooShort
 	}
 	// prepare input: abi.encodePacked(alpha/*uint256*/, pubKeyBytes/*33 bytes*/, pi/*variable-length bytes*/)
 	alpha := input[0:32]
@@ -58,8 +66,85 @@ func (vdfc *VrfVerifyContract) Run(input []byte) ([]byte, error) {
 	return beta, nil
 }
 
+// statefulPrecompiledContract is a precompiled contract reading the world state. Its Run is used when the
+// state is not available, such as in the gas estimation without a TxRunner.
+type statefulPrecompiledContract interface {
+	vm.PrecompiledContract
+	RunWithContext(ctx *types.Context, input []byte) ([]byte, error)
+}
+
+// Returns the golang implementation of the precompiled contract at addr
+func goPrecompiledContract(addr common.Address) (vm.PrecompiledContract, bool) {
+	if addr == common.Address([20]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x27, 0x13}) {
+		return &VrfVerifyContract{}, true
+	} else if addr == SchnorrAddress {
+		return &SchnorrVerifyContract{}, true
+	} else if addr == BchSpvAddress {
+		return &BchSpvVerifyContract{}, true
+	} else if addr == BeaconAddress {
+		return &RandomBeaconContract{}, true
+	} else if executor, exist := PredefinedContractManager[addr]; exist {
+		return executor, true
+	}
+	if contract, ok := vm.PrecompiledContractsIstanbul[addr]; ok {
+		return contract, true
+	}
+	contract, ok := vm.PrecompiledContractsBLS[addr] // evmwrap calls them only if they are enabled
+	return contract, ok
+}
+
+// SchnorrVerifyContract verifies the Schnorr signatures of Bitcoin Cash, which are checked by OP_CHECKSIG and
+// OP_CHECKDATASIG since the upgrade of 2019. OP_CHECKDATASIG signs the SHA256 of the data.
+type SchnorrVerifyContract struct{}
+
+func (svc *SchnorrVerifyContract) RequiredGas(input []byte) uint64 {
+	return precompileGasTables[SchnorrAddress].Gas(input)
+}
+
+func (svc *SchnorrVerifyContract) Run(input []byte) ([]byte, error) {
+	var result [32]byte
+	// prepare input: abi.encodePacked(hash/*bytes32*/, pubKeyBytes/*33 bytes*/, sig/*64 bytes*/)
+	if len(input) != 32+33+64 {
+		return result[:], errors.ErrInvalidInputLength
+	}
+	hash := input[0:32]
+	pubKey, err := btcec.ParsePubKey(input[32:32+33], btcec.S256())
+	if err != nil {
+		return result[:], err
+	}
+	if verifyBchSchnorr(hash, pubKey, input[32+33:]) {
+		result[31] = 1
+	}
+	return result[:], nil
+}
+
+// sig is r||s, which is valid if R=s*G-e*P is not at infinity, R.y is a quadratic residue and R.x equals r,
+// where e=SHA256(r||compressed(P)||hash)
+func verifyBchSchnorr(hash []byte, pubKey *btcec.PublicKey, sig []byte) bool {
+	curve := btcec.S256()
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if r.Cmp(curve.P) >= 0 || s.Cmp(curve.N) >= 0 {
+		return false
+	}
+	h := sha256.New()
+	h.Write(sig[:32])
+	h.Write(pubKey.SerializeCompressed())
+	h.Write(hash)
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	e.Sub(curve.N, e.Mod(e, curve.N)) // -e
+	sGx, sGy := curve.ScalarBaseMult(s.Bytes())
+	ePx, ePy := curve.ScalarMult(pubKey.X, pubKey.Y, e.Bytes())
+	rx, ry := curve.Add(sGx, sGy, ePx, ePy)
+	if rx.Sign() == 0 && ry.Sign() == 0 {
+		return false
+	}
+	return big.Jacobi(ry, curve.P) == 1 && rx.Cmp(r) == 0
+}
+
 //export call_precompiled_contract
-func call_precompiled_contract(contract_addr *evmc_address,
+func call_precompiled_contract(handler C.int,
+	contract_addr *evmc_address,
 	input_ptr unsafe.Pointer,
 	input_size C.int,
 	gas_left *C.uint64_t,
@@ -68,22 +153,23 @@ func call_precompiled_contract(contract_addr *evmc_address,
 	output_ptr *small_buffer,
 	output_size *C.int) {
 	*output_size = 0
+	// a Go panic must not unwind the C++ frames of evmone, so it fails the call instead
+	defer func() {
+		if r := recover(); r != nil {
+			*ret_value = 0
+			*out_of_gas = 0
+			*output_size = 0
+		}
+	}()
 	addr := toAddress(contract_addr)
-	contract, ok := vm.PrecompiledContractsIstanbul[addr]
-	if addr == common.Address([20]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x27, 0x13}) {
-		contract = &VrfVerifyContract{}
-		ok = true
-	} else if executor, exist := PredefinedContractManager[addr]; exist {
-		contract = executor
-		ok = true
-	}
+	contract, ok := goPrecompiledContract(addr)
 	if !ok {
 		*ret_value = 0
 		*out_of_gas = 0
 		return
 	}
 	input := C.GoBytes(input_ptr, input_size)
-	gasRequired := C.uint64_t(contract.RequiredGas(input))
+	gasRequired := C.uint64_t(precompileRequiredGas(addr, contract, input))
 	if gasRequired > *gas_left {
 		*ret_value = 0
 		*out_of_gas = 1
@@ -91,7 +177,13 @@ func call_precompiled_contract(contract_addr *evmc_address,
 		return
 	}
 	*gas_left -= gasRequired
-	output, err := contract.Run(input)
+	var output []byte
+	var err error
+	if c, ok := contract.(statefulPrecompiledContract); ok {
+		output, err = c.RunWithContext(getRunner(int(handler)).Ctx, input)
+	} else {
+		output, err = contract.Run(input)
+	}
 	if err != nil {
 		*ret_value = 0
 		*out_of_gas = 0
@@ -0,0 +1,111 @@
+package ebp
+
+import (
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// Sign hash in the way of Bitcoin Cash with the nonce k
+func bchSchnorrSign(key *btcec.PrivateKey, hash []byte, k *big.Int) []byte {
+	curve := btcec.S256()
+	rx, ry := curve.ScalarBaseMult(k.Bytes())
+	if big.Jacobi(ry, curve.P) != 1 {
+		k = new(big.Int).Sub(curve.N, k)
+	}
+	r := common.LeftPadBytes(rx.Bytes(), 32)
+	h := sha256.New()
+	h.Write(r)
+	h.Write(key.PubKey().SerializeCompressed())
+	h.Write(hash)
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	s := e.Mul(e, key.D)
+	s.Add(s, k).Mod(s, curve.N)
+	return append(r, common.LeftPadBytes(s.Bytes(), 32)...)
+}
+
+func schnorrInput(hash, pubKey, sig []byte) []byte {
+	return append(append(append([]byte{}, hash...), pubKey...), sig...)
+}
+
+func TestSchnorrVerifyContract(t *testing.T) {
+	c := &SchnorrVerifyContract{}
+	valid, invalid := common.LeftPadBytes([]byte{1}, 32), make([]byte, 32)
+	// the test vectors of the Schnorr specification of Bitcoin Cash
+	for _, v := range []struct{ pubKey, hash, sig string }{
+		{"0279BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798",
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"787A848E71043D280C50470E8E1532B2DD5D20EE912A45DBDD2BD1DFBF187EF67031A98831859DC34DFFEEDDA86831842CCD0079E1F92AF177F7F22CC1DCED05"},
+		{"02DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+			"243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+			"2A298DACAE57395A15D0795DDBFD1DCB564DA82B0F269BC70A74F8220429BA1D1E51A22CCEC35599B8F266912281F8365FFC2D035A230434A1A64DC59F7013FD"},
+	} {
+		input := schnorrInput(common.FromHex(v.hash), common.FromHex(v.pubKey), common.FromHex(v.sig))
+		out, err := c.Run(input)
+		require.NoError(t, err)
+		require.Equal(t, valid, out)
+		input[len(input)-1] ^= 1
+		out, err = c.Run(input)
+		require.NoError(t, err)
+		require.Equal(t, invalid, out)
+	}
+
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(t, err)
+	pubKey := key.PubKey().SerializeCompressed()
+	hash := sha256.Sum256([]byte("data signed for OP_CHECKDATASIG"))
+	for k := int64(1); k <= 4; k++ { // R.y of some nonces is not a quadratic residue
+		sig := bchSchnorrSign(key, hash[:], big.NewInt(k*1000003))
+		out, err := c.Run(schnorrInput(hash[:], pubKey, sig))
+		require.NoError(t, err)
+		require.Equal(t, valid, out)
+		otherHash := sha256.Sum256([]byte("other data"))
+		out, _ = c.Run(schnorrInput(otherHash[:], pubKey, sig))
+		require.Equal(t, invalid, out)
+	}
+
+	// r must be less than P and s less than N
+	sig := bchSchnorrSign(key, hash[:], big.NewInt(7))
+	copy(sig[32:], common.LeftPadBytes(btcec.S256().N.Bytes(), 32))
+	out, _ := c.Run(schnorrInput(hash[:], pubKey, sig))
+	require.Equal(t, invalid, out)
+	_, err = c.Run(schnorrInput(hash[:], pubKey, sig[:63]))
+	require.ErrorIs(t, err, errors.ErrInvalidInputLength)
+	_, err = c.Run(schnorrInput(hash[:], make([]byte, 33), sig))
+	require.Error(t, err)
+	require.Equal(t, SCHNORR_VERIFY_GAS, c.RequiredGas(nil))
+}
+
+func TestSchnorrPrecompile(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	ctx.SetChainConfig(&types.ChainConfig{Upgrades: []types.Upgrade{
+		{Height: 2, Rules: types.Rules{Revision: types.Istanbul, RefundQuotient: 2, SchnorrPrecompile: true}}}})
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(t, err)
+	hash := sha256.Sum256([]byte("data"))
+	input := schnorrInput(hash[:], key.PubKey().SerializeCompressed(), bchSchnorrSign(key, hash[:], big.NewInt(12345)))
+	msg := ethereum.CallMsg{From: from1, To: &SchnorrAddress, Data: input}
+
+	res := ExecuteReadOnly(ctx, msg, &types.BlockInfo{Number: 1}) // not enabled yet
+	require.False(t, res.Failed())
+	require.Empty(t, res.OutData)
+
+	res = ExecuteReadOnly(ctx, msg, &types.BlockInfo{Number: 2})
+	require.False(t, res.Failed())
+	require.Equal(t, common.LeftPadBytes([]byte{1}, 32), res.OutData)
+
+	msg.Data = input[:100]
+	res = ExecuteReadOnly(ctx, msg, &types.BlockInfo{Number: 2})
+	require.True(t, res.Failed())
+}
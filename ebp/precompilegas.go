@@ -0,0 +1,73 @@
+package ebp
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// PrecompileGasTable declares the gas formula of a precompiled contract implemented in golang:
+// Base + PerByte*len(input) + PerItem*items, where items is the count of the complete ItemSize-byte
+// items following the first HeaderSize bytes of input. The result saturates at math.MaxUint64.
+type PrecompileGasTable struct {
+	Base       uint64
+	PerByte    uint64
+	PerItem    uint64
+	HeaderSize int
+	ItemSize   int
+}
+
+func (table PrecompileGasTable) Gas(input []byte) uint64 {
+	gas := table.Base
+	gas = addGas(gas, table.PerByte, uint64(len(input)))
+	if table.PerItem != 0 && len(input) > table.HeaderSize {
+		gas = addGas(gas, table.PerItem, uint64((len(input)-table.HeaderSize)/table.ItemSize))
+	}
+	return gas
+}
+
+// returns gas+price*count, or math.MaxUint64 if it overflows
+func addGas(gas, price, count uint64) uint64 {
+	hi, lo := bits.Mul64(price, count)
+	sum, carry := bits.Add64(gas, lo, 0)
+	if hi != 0 || carry != 0 {
+		return math.MaxUint64
+	}
+	return sum
+}
+
+var precompileGasTables = map[common.Address]PrecompileGasTable{
+	Sep109Address:  {Base: VRF_VERIFY_GAS},
+	SchnorrAddress: {Base: SCHNORR_VERIFY_GAS},
+	BchSpvAddress:  {Base: BCH_SPV_VERIFY_GAS, PerItem: BCH_SPV_PER_LEVEL_GAS, HeaderSize: 96, ItemSize: 32},
+	BeaconAddress:  {Base: RANDOM_BEACON_GAS},
+}
+
+// RegisterPrecompileGasTable declares the gas formula of the golang precompiled contract at addr, which is
+// charged by call_precompiled_contract instead of its RequiredGas. It is not thread-safe and must be called
+// before any execution, such as in init(). The precompiles implemented in evmwrap cannot be overridden.
+func RegisterPrecompileGasTable(addr common.Address, table PrecompileGasTable) {
+	for _, info := range standardPrecompiles {
+		if info.Native && info.Address == addr {
+			panic(fmt.Sprintf("precompile %s is implemented in evmwrap", addr.String()))
+		}
+	}
+	if addr == Sep206Address || addr == Sep101Address || addr == StakingAddress {
+		panic(fmt.Sprintf("precompile %s is implemented in evmwrap", addr.String()))
+	}
+	if table.HeaderSize < 0 || (table.PerItem != 0 && table.ItemSize <= 0) {
+		panic(fmt.Sprintf("invalid gas table for %s", addr.String()))
+	}
+	precompileGasTables[addr] = table
+}
+
+// returns the gas declared by the gas table of addr, or the RequiredGas of contract if there is no table
+func precompileRequiredGas(addr common.Address, contract vm.PrecompiledContract, input []byte) uint64 {
+	if table, ok := precompileGasTables[addr]; ok {
+		return table.Gas(input)
+	}
+	return contract.RequiredGas(input)
+}
@@ -0,0 +1,59 @@
+package ebp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestPrecompileGasTable(t *testing.T) {
+	table := PrecompileGasTable{Base: 100, PerByte: 2, PerItem: 50, HeaderSize: 4, ItemSize: 8}
+	require.Equal(t, uint64(100), table.Gas(nil))
+	require.Equal(t, uint64(100+2*4), table.Gas(make([]byte, 4)))
+	require.Equal(t, uint64(100+2*11), table.Gas(make([]byte, 11)))      // the incomplete item is free
+	require.Equal(t, uint64(100+2*20+50*2), table.Gas(make([]byte, 20))) // two items
+	table.PerByte = math.MaxUint64
+	require.Equal(t, uint64(math.MaxUint64), table.Gas(make([]byte, 2)))
+
+	spv := precompileGasTables[BchSpvAddress]
+	require.Equal(t, BCH_SPV_VERIFY_GAS, spv.Gas(make([]byte, 96)))
+	require.Equal(t, BCH_SPV_VERIFY_GAS+3*BCH_SPV_PER_LEVEL_GAS, spv.Gas(make([]byte, 96+3*32)))
+
+	require.Panics(t, func() {
+		RegisterPrecompileGasTable(common.BytesToAddress([]byte{2}), PrecompileGasTable{Base: 1})
+	})
+	require.Panics(t, func() {
+		RegisterPrecompileGasTable(Sep206Address, PrecompileGasTable{Base: 1})
+	})
+	require.Panics(t, func() {
+		RegisterPrecompileGasTable(common.BytesToAddress([]byte{1}), PrecompileGasTable{PerItem: 1})
+	})
+}
+
+func TestRegisterPrecompileGasTable(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	ecrecoverAddr := common.BytesToAddress([]byte{1})
+	RegisterPrecompileGasTable(ecrecoverAddr, PrecompileGasTable{Base: 7000, PerItem: 500, ItemSize: 32})
+	defer delete(precompileGasTables, ecrecoverAddr)
+
+	input := make([]byte, 64)
+	gas, ok := PrecompileGas(ecrecoverAddr, input)
+	require.True(t, ok)
+	require.Equal(t, uint64(8000), gas)
+
+	blk := &types.BlockInfo{Number: 1}
+	res := ExecuteReadOnly(ctx, ethereum.CallMsg{From: from1, To: &ecrecoverAddr, Data: input}, blk)
+	require.False(t, res.Failed())
+	require.Equal(t, 21000+64*4+gas, res.GasUsed)
+	res = ExecuteReadOnly(ctx, ethereum.CallMsg{From: from1, To: &ecrecoverAddr, Data: input,
+		Gas: 21000 + 64*4 + gas - 1}, blk)
+	require.True(t, StatusIsOutOfGas(res.Status))
+}
@@ -0,0 +1,111 @@
+package ebp
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// The same as the ones in host_context.h
+const (
+	SHA256_BASE_GAS        uint64 = 60
+	SHA256_PER_WORD_GAS    uint64 = 12
+	RIPEMD160_BASE_GAS     uint64 = 600
+	RIPEMD160_PER_WORD_GAS uint64 = 120
+	IDENTITY_BASE_GAS      uint64 = 15
+	IDENTITY_PER_WORD_GAS  uint64 = 3
+)
+
+var (
+	StakingAddress = common.HexToAddress("0x0000000000000000000000000000000000002710")
+	Sep101Address  = common.HexToAddress("0x0000000000000000000000000000000000002712")
+	Sep109Address  = common.HexToAddress("0x0000000000000000000000000000000000002713")
+	SchnorrAddress = common.HexToAddress("0x0000000000000000000000000000000000002715")
+	BchSpvAddress  = common.HexToAddress("0x0000000000000000000000000000000000002716")
+	BeaconAddress  = common.HexToAddress("0x0000000000000000000000000000000000002718")
+)
+
+// PrecompileInfo describes a precompiled contract. Native is true if it is implemented in evmwrap, otherwise
+// it is implemented in golang and its output is truncated to SMALL_BUF_SIZE bytes.
+type PrecompileInfo struct {
+	Address common.Address
+	Name    string
+	Native  bool
+}
+
+var standardPrecompiles = []PrecompileInfo{
+	{Address: common.BytesToAddress([]byte{1}), Name: "ecrecover"},
+	{Address: common.BytesToAddress([]byte{2}), Name: "sha256", Native: true},
+	{Address: common.BytesToAddress([]byte{3}), Name: "ripemd160", Native: true},
+	{Address: common.BytesToAddress([]byte{4}), Name: "identity", Native: true},
+	{Address: common.BytesToAddress([]byte{5}), Name: "modexp"},
+	{Address: common.BytesToAddress([]byte{6}), Name: "bn256Add"},
+	{Address: common.BytesToAddress([]byte{7}), Name: "bn256ScalarMul"},
+	{Address: common.BytesToAddress([]byte{8}), Name: "bn256Pairing"},
+	{Address: common.BytesToAddress([]byte{9}), Name: "blake2f"},
+}
+
+var blsPrecompiles = []PrecompileInfo{
+	{Address: common.BytesToAddress([]byte{0x0a}), Name: "blsG1Add"},
+	{Address: common.BytesToAddress([]byte{0x0b}), Name: "blsG1Mul"},
+	{Address: common.BytesToAddress([]byte{0x0c}), Name: "blsG1MultiExp"},
+	{Address: common.BytesToAddress([]byte{0x0d}), Name: "blsG2Add"},
+	{Address: common.BytesToAddress([]byte{0x0e}), Name: "blsG2Mul"},
+	{Address: common.BytesToAddress([]byte{0x0f}), Name: "blsG2MultiExp"},
+	{Address: common.BytesToAddress([]byte{0x10}), Name: "blsPairing"},
+	{Address: common.BytesToAddress([]byte{0x11}), Name: "blsMapG1"},
+	{Address: common.BytesToAddress([]byte{0x12}), Name: "blsMapG2"},
+}
+
+// ActivePrecompiles lists the precompiled contracts active at the height of ctx, in the order of addresses,
+// the same as is_precompiled in evmwrap
+func ActivePrecompiles(ctx *types.Context) []PrecompileInfo {
+	res := append([]PrecompileInfo{}, standardPrecompiles...)
+	rules := ctx.ChainConfig.RulesAt(ctx.Height)
+	if rules.BLSPrecompiles {
+		res = append(res, blsPrecompiles...)
+	}
+	res = append(res,
+		PrecompileInfo{Address: StakingAddress, Name: "staking"},
+		PrecompileInfo{Address: Sep206Address, Name: "SEP206", Native: true},
+		PrecompileInfo{Address: Sep101Address, Name: "SEP101", Native: true})
+	if ctx.IsXHedgeFork() {
+		res = append(res, PrecompileInfo{Address: Sep109Address, Name: "SEP109"})
+	}
+	if rules.SchnorrPrecompile {
+		res = append(res, PrecompileInfo{Address: SchnorrAddress, Name: "schnorrVerify"})
+	}
+	if rules.BchSpvPrecompile {
+		res = append(res, PrecompileInfo{Address: BchSpvAddress, Name: "bchSpvVerify"})
+	}
+	if rules.RandomBeaconPrecompile {
+		res = append(res, PrecompileInfo{Address: BeaconAddress, Name: "randomBeacon"})
+	}
+	if rules.NativeModules {
+		res = append(res, nativeModuleInfos()...)
+	}
+	return res
+}
+
+// PrecompileGas returns the gas charged for calling the precompiled contract at addr with input, in the
+// same way as evmwrap does. It returns false for the contracts whose gas depends on the state, such as
+// SEP101 and SEP206, and for the addresses without precompiled contracts. The precompiles enabled by
+// ChainConfig are included whether or not they are enabled.
+func PrecompileGas(addr common.Address, input []byte) (uint64, bool) {
+	words := (uint64(len(input)) + 31) / 32
+	switch addr {
+	case standardPrecompiles[1].Address:
+		return words*SHA256_PER_WORD_GAS + SHA256_BASE_GAS, true
+	case standardPrecompiles[2].Address:
+		return words*RIPEMD160_PER_WORD_GAS + RIPEMD160_BASE_GAS, true
+	case standardPrecompiles[3].Address:
+		return words*IDENTITY_PER_WORD_GAS + IDENTITY_BASE_GAS, true
+	case Sep101Address, Sep206Address, StakingAddress:
+		return 0, false
+	}
+	contract, ok := goPrecompiledContract(addr)
+	if !ok {
+		return 0, false
+	}
+	return precompileRequiredGas(addr, contract, input), true
+}
@@ -0,0 +1,191 @@
+package ebp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// The vectors in testdata/precompiles are copied from go-ethereum v1.10.7, whose gas is the one of Istanbul.
+// Only the first three vectors of each BLS precompile are kept.
+type precompileVector struct {
+	Input         string
+	Expected      string
+	ExpectedError string
+	Gas           uint64
+	Name          string
+}
+
+func loadPrecompileVectors(t *testing.T) map[byte][]precompileVector {
+	files := map[string]byte{"ecRecover": 1, "modexp": 5, "bn256Add": 6, "bn256ScalarMul": 7,
+		"bn256Pairing": 8, "blake2F": 9, "fail-blake2f": 9}
+	res := loadVectorFiles(t, files)
+	// the native ones use the outputs and gas of go-ethereum as the expected values
+	for id := byte(2); id <= 4; id++ {
+		contract := vm.PrecompiledContractsIstanbul[common.BytesToAddress([]byte{id})]
+		for _, size := range []int{0, 1, 31, 32, 33, 64, 100, 1000} {
+			input := make([]byte, size)
+			for i := range input {
+				input[i] = byte(i*7 + 1)
+			}
+			out, err := contract.Run(input)
+			require.NoError(t, err)
+			res[id] = append(res[id], precompileVector{Input: common.Bytes2Hex(input),
+				Expected: common.Bytes2Hex(out), Gas: contract.RequiredGas(input)})
+		}
+	}
+	return res
+}
+
+func loadBLSVectors(t *testing.T) map[byte][]precompileVector {
+	return loadVectorFiles(t, map[string]byte{"blsG1Add": 0x0a, "fail-blsG1Add": 0x0a, "blsG1Mul": 0x0b,
+		"blsG1MultiExp": 0x0c, "blsG2Add": 0x0d, "blsG2Mul": 0x0e, "blsG2MultiExp": 0x0f, "blsPairing": 0x10,
+		"fail-blsPairing": 0x10, "blsMapG1": 0x11, "blsMapG2": 0x12})
+}
+
+func loadVectorFiles(t *testing.T, files map[string]byte) map[byte][]precompileVector {
+	res := make(map[byte][]precompileVector)
+	for name, id := range files {
+		bz, err := os.ReadFile(filepath.Join("testdata", "precompiles", name+".json"))
+		require.NoError(t, err)
+		var vectors []precompileVector
+		require.NoError(t, json.Unmarshal(bz, &vectors))
+		res[id] = append(res[id], vectors...)
+	}
+	return res
+}
+
+func TestPrecompileGas(t *testing.T) {
+	all := loadPrecompileVectors(t)
+	for id, vectors := range loadBLSVectors(t) {
+		all[id] = vectors
+	}
+	for id, vectors := range all {
+		addr := common.BytesToAddress([]byte{id})
+		for _, v := range vectors {
+			gas, ok := PrecompileGas(addr, common.Hex2Bytes(v.Input))
+			require.True(t, ok)
+			if len(v.ExpectedError) == 0 {
+				require.Equal(t, v.Gas, gas, v.Name)
+			}
+		}
+	}
+	_, ok := PrecompileGas(Sep206Address, nil)
+	require.False(t, ok)
+	_, ok = PrecompileGas(common.BytesToAddress([]byte{0x13}), nil)
+	require.False(t, ok)
+	gas, ok := PrecompileGas(Sep109Address, nil)
+	require.True(t, ok)
+	require.Equal(t, VRF_VERIFY_GAS, gas)
+}
+
+func TestActivePrecompiles(t *testing.T) {
+	ctx := &types.Context{Height: 10, XHedgeForkBlock: 11}
+	list := ActivePrecompiles(ctx)
+	require.Equal(t, 12, len(list))
+	for i := 0; i < 9; i++ {
+		require.Equal(t, common.BytesToAddress([]byte{byte(i + 1)}), list[i].Address)
+	}
+	require.Equal(t, "identity", list[3].Name)
+	require.True(t, list[3].Native)
+	require.False(t, list[4].Native)
+	require.Equal(t, Sep101Address, list[11].Address)
+
+	ctx.Height = 11
+	list = ActivePrecompiles(ctx)
+	require.Equal(t, 13, len(list))
+	require.Equal(t, "SEP109", list[12].Name)
+
+	ctx.ChainConfig = &types.ChainConfig{Upgrades: []types.Upgrade{
+		{Height: 12, Rules: types.Rules{Revision: types.Istanbul, RefundQuotient: 2, BLSPrecompiles: true}}}}
+	require.Equal(t, 13, len(ActivePrecompiles(ctx)))
+	ctx.Height = 12
+	list = ActivePrecompiles(ctx)
+	require.Equal(t, 22, len(list))
+	require.Equal(t, "blsG1Add", list[9].Name)
+	require.Equal(t, common.BytesToAddress([]byte{0x12}), list[17].Address)
+	require.Equal(t, StakingAddress, list[18].Address)
+
+	ctx.ChainConfig.Upgrades[0].SchnorrPrecompile = true
+	list = ActivePrecompiles(ctx)
+	require.Equal(t, 23, len(list))
+	require.Equal(t, SchnorrAddress, list[22].Address)
+
+	ctx.ChainConfig.Upgrades[0].BchSpvPrecompile = true
+	list = ActivePrecompiles(ctx)
+	require.Equal(t, 24, len(list))
+	require.Equal(t, BchSpvAddress, list[23].Address)
+
+	ctx.ChainConfig.Upgrades[0].RandomBeaconPrecompile = true
+	list = ActivePrecompiles(ctx)
+	require.Equal(t, 25, len(list))
+	require.Equal(t, BeaconAddress, list[24].Address)
+}
+
+func TestPrecompileConformance(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	blk := &types.BlockInfo{Number: 1}
+	for id, vectors := range loadPrecompileVectors(t) {
+		addr := common.BytesToAddress([]byte{id})
+		for _, v := range vectors {
+			input := common.Hex2Bytes(v.Input)
+			res := ExecuteReadOnly(ctx, ethereum.CallMsg{From: from1, To: &addr, Data: input}, blk)
+			if len(v.ExpectedError) != 0 {
+				require.True(t, res.Failed(), v.Name)
+				continue
+			}
+			require.False(t, res.Failed(), v.Name)
+			require.Equal(t, v.Expected, common.Bytes2Hex(res.OutData), v.Name)
+			intrinsic, err := core.IntrinsicGas(input, nil, false, true, true)
+			require.NoError(t, err)
+			require.Equal(t, intrinsic+v.Gas, res.GasUsed, v.Name)
+		}
+	}
+	// out of gas if the gas limit cannot cover the precompile
+	sha256Addr := common.BytesToAddress([]byte{2})
+	res := ExecuteReadOnly(ctx, ethereum.CallMsg{From: from1, To: &sha256Addr, Gas: 21000 + SHA256_BASE_GAS - 1}, blk)
+	require.True(t, StatusIsOutOfGas(res.Status))
+}
+
+func TestBLSPrecompiles(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	ctx.SetChainConfig(&types.ChainConfig{Upgrades: []types.Upgrade{
+		{Height: 2, Rules: types.Rules{Revision: types.Istanbul, RefundQuotient: 2, BLSPrecompiles: true}}}})
+	for id, vectors := range loadBLSVectors(t) {
+		addr := common.BytesToAddress([]byte{id})
+		for _, v := range vectors {
+			input := common.Hex2Bytes(v.Input)
+			msg := ethereum.CallMsg{From: from1, To: &addr, Data: input}
+			// before the upgrade, it is an account without code
+			res := ExecuteReadOnly(ctx, msg, &types.BlockInfo{Number: 1})
+			require.False(t, res.Failed(), v.Name)
+			require.Empty(t, res.OutData, v.Name)
+
+			res = ExecuteReadOnly(ctx, msg, &types.BlockInfo{Number: 2})
+			if len(v.ExpectedError) != 0 {
+				require.True(t, res.Failed(), v.Name)
+				continue
+			}
+			require.False(t, res.Failed(), v.Name)
+			require.Equal(t, v.Expected, common.Bytes2Hex(res.OutData), v.Name)
+			intrinsic, err := core.IntrinsicGas(input, nil, false, true, true)
+			require.NoError(t, err)
+			require.Equal(t, intrinsic+v.Gas, res.GasUsed, v.Name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package ebp
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+
+	storetypes "github.com/smartbch/moeingads/store/types"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// DropStandbyTx removes the tx with the hash from the standby queue and refunds its gas fee, which was
+// deducted in Prepare. The TXs after it are moved forward by one position, so the queue is still continuous
+// and its start is not changed. The later TXs of the same sender are kept, and they wait for a tx taking the
+// dropped nonce, or until they expire. It returns false if the tx is not in the queue.
+// Its hash is removed from the recent hashes, so it can be submitted again.
+// It changes the world state, so all the nodes must call it with the same hash between the same two blocks,
+// after SetContext and before Prepare.
+func (exec *txEngine) DropStandbyTx(hash common.Hash) (*types.TxToRun, bool) {
+	start, end := exec.getStandbyQueueRange()
+	ctx := exec.readCtx()
+	pos := end
+	var dropped *types.TxToRun
+	for i := start; i < end; i++ {
+		tx := &types.TxToRun{}
+		tx.FromBytes(ctx.Rbt.GetBaseStore().Get(types.GetStandbyTxKey(i)))
+		if tx.HashID == hash {
+			pos, dropped = i, tx
+			break
+		}
+	}
+	if dropped == nil {
+		ctx.Close(false)
+		return nil, false
+	}
+	moved := make([][]byte, 0, end-pos-1)
+	for i := pos + 1; i < end; i++ {
+		moved = append(moved, ctx.Rbt.GetBaseStore().Get(types.GetStandbyTxKey(i)))
+	}
+	refundGasFees(ctx, []types.TxToRun{*dropped})
+	trunk := ctx.Rbt.GetBaseStore()
+	ctx.Close(true)
+	trunk.Update(func(store storetypes.SetDeleter) {
+		for i, bz := range moved {
+			k := types.GetStandbyTxKey(pos + uint64(i))
+			store.Set(k, bz)
+			if exec.dropDuplicates {
+				var tx types.TxToRun
+				tx.FromBytes(bz)
+				exec.indexQueuedTx(store, tx.HashID, k)
+			}
+		}
+		store.Delete(types.GetStandbyTxKey(end - 1))
+		exec.unindexQueuedTx(store, hash)
+	})
+	exec.setStandbyQueueRange(start, end-1)
+	exec.pendingNonces.invalidateQueued()
+	if exec.recentHashes != nil {
+		exec.recentHashes.removeQueued([]common.Hash{hash})
+	}
+	return dropped, true
+}
+
+// FlushStandbyTxs removes all the TXs from the standby queue and refunds their gas fees, which were deducted
+// in Prepare. The start of the queue is moved to its end, so the positions are never reused. It returns the
+// removed TXs in the order of the queue, whose hashes are removed from the recent hashes.
+// It changes the world state, so all the nodes must call it between the same two blocks, after SetContext
+// and before Prepare.
+func (exec *txEngine) FlushStandbyTxs() []types.TxToRun {
+	start, end := exec.getStandbyQueueRange()
+	if start == end {
+		return nil
+	}
+	ctx := exec.readCtx()
+	flushed := make([]types.TxToRun, end-start)
+	for i := range flushed {
+		flushed[i].FromBytes(ctx.Rbt.GetBaseStore().Get(types.GetStandbyTxKey(start + uint64(i))))
+	}
+	refundGasFees(ctx, flushed)
+	trunk := ctx.Rbt.GetBaseStore()
+	ctx.Close(true)
+	trunk.Update(func(store storetypes.SetDeleter) {
+		for i := start; i < end; i++ {
+			store.Delete(types.GetStandbyTxKey(i))
+		}
+		for i := range flushed {
+			exec.unindexQueuedTx(store, flushed[i].HashID)
+		}
+	})
+	exec.setStandbyQueueRange(end, end)
+	exec.pendingNonces.invalidateQueued()
+	if exec.recentHashes != nil {
+		hashes := make([]common.Hash, len(flushed))
+		for i := range flushed {
+			hashes[i] = flushed[i].HashID
+		}
+		exec.recentHashes.removeQueued(hashes)
+	}
+	return flushed
+}
+
+// Move the gas fees of txList from the system account back to their senders
+func refundGasFees(ctx *types.Context, txList []types.TxToRun) {
+	total := uint256.NewInt(0)
+	for i := range txList {
+		fee := txGasFee(&txList[i])
+		_ = updateBalance(ctx, txList[i].From, fee, true)
+		total.Add(total, fee)
+	}
+	_ = SubSystemAccBalance(ctx, total)
+}
@@ -0,0 +1,112 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingads/store"
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// Returns an engine with the TXs of account1, account2 and account3 in the standby queue
+func prepareQueueWithThreeTxs(t *testing.T, trunk *store.TrunkStore) (*txEngine, []*gethtypes.Transaction) {
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	txs := prepareAccAndTx(e)
+	tx3, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from3.Bytes())
+	txs = append(txs, tx3)
+	e.SetContext(prepareCtx(trunk))
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, 3, e.StandbyQLen())
+	return e, txs
+}
+
+func TestTxEngine_DropStandbyTx(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, _ := prepareQueueWithThreeTxs(t, trunk)
+	queued, _ := e.IterateStandbyTxs(0, 3)
+	_, ok := e.DropStandbyTx(common.Hash{1})
+	require.False(t, ok)
+
+	dropped, ok := e.DropStandbyTx(queued[1].Tx.HashID)
+	require.True(t, ok)
+	require.Equal(t, queued[1].Tx.HashID, dropped.HashID)
+	left, queueLen := e.IterateStandbyTxs(0, 3)
+	require.Equal(t, 2, queueLen)
+	require.Equal(t, queued[0].Tx.HashID, left[0].Tx.HashID)
+	require.Equal(t, queued[2].Tx.HashID, left[1].Tx.HashID)
+	e.cleanCtx.Close(false)
+
+	ctx := prepareCtx(trunk)
+	require.Equal(t, uint64(10000_0000_0000), ctx.GetAccount(dropped.From).Balance().Uint64())
+	ctx.Close(false)
+
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 1})
+	require.Equal(t, 2, len(e.committedTxs))
+	require.Equal(t, 0, e.StandbyQLen())
+}
+
+func TestTxEngine_FlushStandbyTxs(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareQueueWithThreeTxs(t, trunk)
+	start, end := e.getStandbyQueueRange()
+	flushed := e.FlushStandbyTxs()
+	require.Equal(t, 3, len(flushed))
+	require.Equal(t, 0, e.StandbyQLen())
+	newStart, newEnd := e.getStandbyQueueRange()
+	require.Equal(t, end, newStart)
+	require.Equal(t, end, newEnd)
+	require.Nil(t, e.FlushStandbyTxs())
+	e.cleanCtx.Close(false)
+	require.Less(t, start, end)
+
+	ctx := prepareCtx(trunk)
+	for _, from := range []common.Address{from1, from2, from3} {
+		require.Equal(t, uint64(10000_0000_0000), ctx.GetAccount(from).Balance().Uint64())
+	}
+	ctx.Close(false)
+
+	// the nonces are free again
+	e.SetContext(prepareCtx(trunk))
+	e.CollectTx(txs[0])
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, 1, e.StandbyQLen())
+	e.cleanCtx.Close(false)
+}
+
+func TestTxEngine_RemovedTxsNotKnown(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareQueueWithThreeTxs(t, trunk)
+	e.SetRecentHashes(NewRecentHashes(1))
+	e.loadQueuedHashes()
+	for _, tx := range txs {
+		require.ErrorIs(t, e.ValidateTx(tx), errors.ErrAlreadyKnown)
+	}
+
+	// the removed TXs can be submitted again
+	_, ok := e.DropStandbyTx(txs[1].Hash())
+	require.True(t, ok)
+	require.NoError(t, e.ValidateTx(txs[1]))
+	require.ErrorIs(t, e.ValidateTx(txs[0]), errors.ErrAlreadyKnown)
+	require.Equal(t, 2, len(e.FlushStandbyTxs()))
+	for _, tx := range txs {
+		require.NoError(t, e.ValidateTx(tx))
+	}
+	e.cleanCtx.Close(false)
+}
@@ -0,0 +1,147 @@
+package ebp
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+
+	storetypes "github.com/smartbch/moeingads/store/types"
+
+	"github.com/smartbch/moeingevm/types"
+	"github.com/smartbch/moeingevm/utils"
+)
+
+// queueSlot is a tx in the standby queue after Prepare inserts the new TXs
+type queueSlot struct {
+	tx      *types.TxToRun
+	bz      []byte
+	info    *preparedInfo // nil if the tx was in the queue before this Prepare
+	evicted bool
+}
+
+// queueEvictions is the standby queue rebuilt by insertToStandbyTxQ when some TXs are evicted
+type queueEvictions struct {
+	start uint64
+	slots []*queueSlot
+}
+
+// Returns nil if the standby queue does not exceed maxQueueLen after infoList is inserted. Otherwise the TXs
+// with the lowest gas prices are evicted, the newest first among the ones with the same price, together with
+// the TXs of their senders with larger nonces, which could not run any more. The queue is scanned, so the
+// cost is linear to its length.
+func (exec *txEngine) planEvictions(infoList []*preparedInfo, startEnd []byte) *queueEvictions {
+	start := binary.BigEndian.Uint64(startEnd[:8])
+	end := binary.BigEndian.Uint64(startEnd[8:])
+	queueLen := end - start
+	for _, info := range infoList {
+		if len(info.errorStr) == 0 && info.replaced == nil && !info.scheduled {
+			queueLen++
+		}
+	}
+	if queueLen <= exec.maxQueueLen {
+		return nil
+	}
+	res := &queueEvictions{start: start, slots: make([]*queueSlot, 0, queueLen)}
+	ctx := exec.cleanCtx.WithRbtCopy()
+	for i := start; i < end; i++ {
+		bz := ctx.Rbt.GetBaseStore().Get(types.GetStandbyTxKey(i))
+		tx := &types.TxToRun{}
+		tx.FromBytes(bz)
+		res.slots = append(res.slots, &queueSlot{tx: tx, bz: bz})
+	}
+	ctx.Close(false)
+	for _, info := range infoList {
+		if len(info.errorStr) != 0 || info.scheduled {
+			continue
+		}
+		slot := &queueSlot{tx: info.tx, bz: info.txBytes, info: info}
+		if info.replaced != nil {
+			res.slots[info.replacePos-start] = slot
+		} else {
+			res.slots = append(res.slots, slot)
+		}
+	}
+	order := make([]int, len(res.slots))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		priceA := utils.U256FromSlice32(res.slots[order[a]].tx.GasPrice[:])
+		priceB := utils.U256FromSlice32(res.slots[order[b]].tx.GasPrice[:])
+		if !priceA.Eq(priceB) {
+			return priceA.Lt(priceB)
+		}
+		return order[a] > order[b]
+	})
+	bySender := make(map[common.Address][]*queueSlot)
+	for _, slot := range res.slots {
+		bySender[slot.tx.From] = append(bySender[slot.tx.From], slot)
+	}
+	evictedCount := uint64(0)
+	for _, idx := range order {
+		if queueLen-evictedCount <= exec.maxQueueLen {
+			break
+		}
+		slot := res.slots[idx]
+		if slot.evicted {
+			continue // already evicted with an earlier tx of its sender
+		}
+		for _, s := range bySender[slot.tx.From] {
+			if !s.evicted && s.tx.Nonce >= slot.tx.Nonce {
+				s.evicted = true
+				evictedCount++
+			}
+		}
+	}
+	for _, slot := range res.slots {
+		if slot.evicted && slot.info != nil {
+			slot.info.errorStr = StatusToStr(types.EVICTED_FROM_QUEUE)
+		}
+	}
+	return res
+}
+
+// Refund the gas fees of the evicted TXs, which were deducted in Prepare, and return their sum
+func (e *queueEvictions) refund(ctx *types.Context) *uint256.Int {
+	total := uint256.NewInt(0)
+	for _, slot := range e.slots {
+		if slot.evicted {
+			fee := txGasFee(slot.tx)
+			_ = updateBalance(ctx, slot.tx.From, fee, true)
+			total.Add(total, fee)
+		}
+	}
+	return total
+}
+
+// Record the invalid and evicted TXs, and rewrite the standby queue with the TXs left in their order
+func (exec *txEngine) rebuildStandbyTxQ(store storetypes.SetDeleter, infoList []*preparedInfo, e *queueEvictions,
+	startEnd []byte, oldEnd uint64) {
+	for _, info := range infoList {
+		if len(info.errorStr) != 0 && info.errorStr != StatusToStr(types.EVICTED_FROM_QUEUE) {
+			exec.recordInvalidTx(info)
+		} else if info.replaced != nil {
+			exec.unindexQueuedTx(store, info.replaced.HashID)
+			exec.recordInvalidTx(&preparedInfo{tx: info.replaced, errorStr: replacedByFee})
+		}
+	}
+	end := e.start
+	for _, slot := range e.slots {
+		if slot.evicted {
+			exec.unindexQueuedTx(store, slot.tx.HashID)
+			exec.recordInvalidTx(&preparedInfo{tx: slot.tx, errorStr: StatusToStr(types.EVICTED_FROM_QUEUE)})
+			continue
+		}
+		k := types.GetStandbyTxKey(end)
+		store.Set(k, slot.bz)
+		exec.indexQueuedTx(store, slot.tx.HashID, k)
+		end++
+	}
+	for i := end; i < oldEnd; i++ {
+		store.Delete(types.GetStandbyTxKey(i))
+	}
+	binary.BigEndian.PutUint64(startEnd[8:], end)
+	store.Set(types.StandbyTxQueueKey[:], startEnd)
+}
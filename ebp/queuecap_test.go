@@ -0,0 +1,73 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+/*
+testcase:
+the queue is capped at 2 TXs after account1 and account2 send txs(nonce): 0 with gas price 1
+account3 send txs(nonce): 0 with gas price 1, which is evicted as the newest one with the lowest price
+account3 send txs(nonce): 0 with gas price 3, which evicts the later one of the two queued TXs
+*/
+func TestTxEngine_MaxStandbyQueueLen(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareEngine(trunk)
+	e.SetMaxStandbyQueueLen(2)
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+
+	evicted := StatusToStr(types.EVICTED_FROM_QUEUE)
+	balance := uint64(10000_0000_0000)
+	balanceOf := func(addr common.Address) uint64 {
+		ctx := prepareCtx(trunk)
+		defer ctx.Close(false)
+		return ctx.GetAccount(addr).Balance().Uint64()
+	}
+	e.SetContext(prepareCtx(trunk))
+	e.committedTxs = e.committedTxs[:0]
+	tx3, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from3.Bytes())
+	e.CollectTx(tx3)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, 2, e.StandbyQLen())
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, tx3.Hash(), common.Hash(e.committedTxs[0].Hash))
+	require.Equal(t, evicted, e.committedTxs[0].StatusStr)
+	require.Equal(t, balance, balanceOf(from3))
+
+	// the one at position 1 has the same price as the other one, but it is newer
+	last := txs[0]
+	if status, _ := e.QueuedTxStatus(txs[1].Hash()); status.Position == 1 {
+		last = txs[1]
+	}
+	e.committedTxs = e.committedTxs[:0]
+	tx4, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(3), nil).WithSignature(e.signer, from3.Bytes())
+	e.CollectTx(tx4)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, 2, e.StandbyQLen())
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, last.Hash(), common.Hash(e.committedTxs[0].Hash))
+	require.Equal(t, evicted, e.committedTxs[0].StatusStr)
+	status, ok := e.QueuedTxStatus(tx4.Hash())
+	require.True(t, ok)
+	require.Equal(t, 1, status.Position)
+	sender := from1
+	if last == txs[1] {
+		sender = from2
+	}
+	require.Equal(t, balance, balanceOf(sender)) // the gas fee is refunded
+	require.Equal(t, balance-3*100000, balanceOf(from3))
+	e.cleanCtx.Close(false)
+}
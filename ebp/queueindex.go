@@ -0,0 +1,50 @@
+package ebp
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	storetypes "github.com/smartbch/moeingads/store/types"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// When dropDuplicates is enabled, the TXs in the standby queue and the scheduled queue are indexed by their
+// hashes in world state, such that Prepare finds the resubmitted ones without scanning the queues. An entry
+// is the key of the slot holding the tx, and it is only trusted if that slot still holds the tx, so a missed
+// update can only let a duplicated tx through, as if the index were disabled. The TXs queued before the
+// index is enabled are not indexed.
+
+// Record that the tx with hash is at slotKey, which is a key in the standby queue or the scheduled queue
+func (exec *txEngine) indexQueuedTx(store storetypes.SetDeleter, hash common.Hash, slotKey []byte) {
+	if !exec.dropDuplicates {
+		return
+	}
+	k := types.GetQueuedTxHashKey(hash)
+	exec.cleanCtx.Rbt.GetBaseStore().PrepareForUpdate(k)
+	store.Set(k, slotKey)
+}
+
+// Remove the index entry of the tx with hash, which has left the queues
+func (exec *txEngine) unindexQueuedTx(store storetypes.SetDeleter, hash common.Hash) {
+	if !exec.dropDuplicates {
+		return
+	}
+	k := types.GetQueuedTxHashKey(hash)
+	exec.cleanCtx.Rbt.GetBaseStore().PrepareForDeletion(k)
+	store.Delete(k)
+}
+
+// Returns whether the tx with hash is waiting in the standby queue or the scheduled queue
+func isQueuedTx(store storetypes.BaseStoreI, hash common.Hash) bool {
+	slotKey := store.Get(types.GetQueuedTxHashKey(hash))
+	if slotKey == nil {
+		return false
+	}
+	bz := store.Get(slotKey)
+	if bz == nil {
+		return false
+	}
+	var tx types.TxToRun
+	tx.FromBytes(bz)
+	return tx.HashID == hash
+}
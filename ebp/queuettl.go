@@ -0,0 +1,23 @@
+package ebp
+
+import (
+	"github.com/smartbch/moeingevm/types"
+)
+
+// Returns true if tx has waited in the standby queue for more than queueTTL blocks. A scheduled tx starts
+// waiting at the height it is scheduled at.
+func (exec *txEngine) expiredInQueue(tx *types.TxToRun) bool {
+	if exec.queueTTL == 0 {
+		return false
+	}
+	startHeight := tx.Height
+	if tx.NotBefore > startHeight {
+		startHeight = tx.NotBefore
+	}
+	return startHeight+exec.queueTTL < exec.getCurrHeight()
+}
+
+// Record an expired tx as a failed one, which does not use any gas
+func (exec *txEngine) recordExpiredTx(tx *types.TxToRun) {
+	exec.recordInvalidTx(&preparedInfo{tx: tx, errorStr: StatusToStr(types.EXPIRED_IN_QUEUE)})
+}
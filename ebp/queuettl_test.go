@@ -0,0 +1,56 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestExpiredInQueue(t *testing.T) {
+	e := NewEbpTxExec(2, 10, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.currentBlock = &types.BlockInfo{Number: 100}
+	tx := &types.TxToRun{Height: 90}
+	require.False(t, e.expiredInQueue(tx)) // no TTL
+	e.SetQueueTTL(10)
+	require.False(t, e.expiredInQueue(tx))
+	tx.Height = 89
+	require.True(t, e.expiredInQueue(tx))
+	// a scheduled tx starts waiting at the height it is scheduled at
+	tx.NotBefore = 95
+	require.False(t, e.expiredInQueue(tx))
+}
+
+/*
+testcase:
+account1 and account2 send txs(nonce): 0 at height 0, with the TTL of 2 blocks
+both are dropped without running at height 3
+*/
+func TestTxEngine_QueueTTL(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareEngine(trunk)
+	e.SetQueueTTL(2)
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 3})
+	require.Equal(t, 0, e.StandbyQLen())
+	require.Equal(t, 2, len(e.committedTxs))
+	for i, tx := range txs {
+		require.Equal(t, tx.Hash(), common.Hash(e.committedTxs[i].Hash))
+		require.Equal(t, StatusToStr(types.EXPIRED_IN_QUEUE), e.committedTxs[i].StatusStr)
+		require.Equal(t, uint64(0), e.committedTxs[i].GasUsed)
+	}
+	e.SetContext(prepareCtx(trunk))
+	require.Nil(t, e.cleanCtx.GetAccount(*txs[0].To())) // the value is not transferred
+	// the gas fee is not refunded
+	require.Equal(t, uint64(10000_0000_0000-100000), e.cleanCtx.GetAccount(from1).Balance().Uint64())
+	e.cleanCtx.Close(false)
+}
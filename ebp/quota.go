@@ -0,0 +1,157 @@
+package ebp
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	storetypes "github.com/smartbch/moeingads/store/types"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// storageQuota limits the number of storage slots occupied by a contract. Only the slots created after the
+// quota is enabled are counted, and the counts are kept in trunk at types.GetStorageCountKey, out of the
+// RabbitStores like the standby queue.
+// The quota is enforced in EVM when a new slot is stored. The TXs do not read or write the counts through
+// their RabbitStores, or else all the TXs creating slots of a contract would conflict with each other. Instead,
+// the slots created by each group of TXs are added to the counts when the group is merged, and the counts are
+// written to trunk along with the merged groups.
+type storageQuota struct {
+	maxSlots   uint64
+	exemptSeqs map[uint64]struct{} // the sequences of the exempted contracts
+	trunk      storetypes.BaseStoreI
+
+	mtx       sync.Mutex          // the runners load the counts in parallel
+	counts    map[uint64]uint64   // the counts of the contracts in this block, loaded from trunk on demand
+	dirtySeqs map[uint64]struct{} // the contracts whose counts are not written to trunk yet
+}
+
+func newStorageQuota(ctx *types.Context, maxSlots uint64, exempt []common.Address) *storageQuota {
+	q := &storageQuota{
+		maxSlots:   maxSlots,
+		exemptSeqs: make(map[uint64]struct{}, len(exempt)),
+		trunk:      ctx.Rbt.GetBaseStore(),
+		counts:     make(map[uint64]uint64),
+		dirtySeqs:  make(map[uint64]struct{}),
+	}
+	for _, addr := range exempt {
+		if acc := ctx.GetAccount(addr); acc != nil {
+			q.exemptSeqs[acc.Sequence()] = struct{}{}
+		}
+	}
+	return q
+}
+
+// Returns the count of the contract with seq, including the slots created by the merged groups of this block
+func (q *storageQuota) count(seq uint64) uint64 {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	count, ok := q.counts[seq]
+	if !ok {
+		if bz := q.trunk.Get(types.GetStorageCountKey(seq)); len(bz) == 8 {
+			count = binary.BigEndian.Uint64(bz)
+		}
+		q.counts[seq] = count
+	}
+	return count
+}
+
+// Add the slots created by a group of TXs to the counts. Returns false without changing anything if a
+// contract would occupy more slots than the quota, which happens when the other groups merged before it
+// created slots of the same contract. Then the group must run again with the new counts.
+func (q *storageQuota) commit(deltas map[uint64]int64) bool {
+	for seq, delta := range deltas {
+		if delta > 0 && q.count(seq)+uint64(delta) > q.maxSlots {
+			return false
+		}
+	}
+	for seq, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+		count := int64(q.count(seq)) + delta
+		if count < 0 { // the slots created before the quota is enabled are not counted
+			count = 0
+		}
+		q.counts[seq] = uint64(count)
+		q.dirtySeqs[seq] = struct{}{}
+		q.trunk.PrepareForUpdate(types.GetStorageCountKey(seq)) //warm up
+	}
+	return true
+}
+
+// Write the changed counts into store, which is the one updating trunk
+func (q *storageQuota) writeBack(store storetypes.SetDeleter) {
+	seqs := make([]uint64, 0, len(q.dirtySeqs))
+	for seq := range q.dirtySeqs {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for _, seq := range seqs {
+		var bz [8]byte
+		binary.BigEndian.PutUint64(bz[:], q.counts[seq])
+		store.Set(types.GetStorageCountKey(seq), bz[:])
+	}
+	q.dirtySeqs = make(map[uint64]struct{})
+}
+
+// A storage slot changed by a tx
+type slotChange struct {
+	seq    uint64
+	key    string
+	exists bool // whether the slot has a non-empty value after the change
+}
+
+// Add the slots created by a tx minus the ones it cleared to the deltas of its group
+func (runner *TxRunner) addSlotDeltas(changes []slotChange) {
+	for _, chg := range changes {
+		if _, ok := runner.storageQuota.exemptSeqs[chg.seq]; ok {
+			continue
+		}
+		existed := len(runner.Ctx.Rbt.Get(types.GetValueKey(chg.seq, chg.key))) != 0
+		if existed == chg.exists {
+			continue
+		}
+		if chg.exists {
+			runner.slotDeltas[chg.seq]++
+		} else {
+			runner.slotDeltas[chg.seq]--
+		}
+	}
+}
+
+// Returns how many more slots the contract with seq may occupy, for the tx which is running. The slots
+// created by the TXs before it in the same group are counted in.
+func (runner *TxRunner) getStorageQuota(seq uint64) uint64 {
+	if runner.storageQuota == nil {
+		return math.MaxUint64
+	}
+	if _, ok := runner.storageQuota.exemptSeqs[seq]; ok {
+		return math.MaxUint64
+	}
+	used := int64(runner.storageQuota.count(seq)) + runner.slotDeltas[seq]
+	if used < 0 {
+		used = 0
+	}
+	if uint64(used) >= runner.storageQuota.maxSlots {
+		return 0
+	}
+	return runner.storageQuota.maxSlots - uint64(used)
+}
+
+// Returns the number of storage slots counted for the contract at addr
+func GetStorageSlotCount(ctx *types.Context, addr common.Address) uint64 {
+	acc := ctx.GetAccount(addr)
+	if acc == nil {
+		return 0
+	}
+	bz := ctx.Rbt.GetBaseStore().Get(types.GetStorageCountKey(acc.Sequence()))
+	if len(bz) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(bz)
+}
@@ -0,0 +1,127 @@
+package ebp
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	storetypes "github.com/smartbch/moeingads/store/types"
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestStorageQuota(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+
+	contract, exempted := common.Address{0xc1}, common.Address{0xc2}
+	acc := types.ZeroAccountInfo()
+	acc.UpdateSequence(1000)
+	ctx.SetAccount(contract, acc)
+	acc = types.ZeroAccountInfo()
+	acc.UpdateSequence(1001)
+	ctx.SetAccount(exempted, acc)
+
+	q := newStorageQuota(ctx, 2, []common.Address{exempted})
+	runner := NewTxRunner(ctx, &types.TxToRun{})
+	runner.storageQuota, runner.slotDeltas = q, make(map[uint64]int64)
+	slot := func(seq uint64, key byte, exists bool) slotChange {
+		return slotChange{seq: seq, key: string(common.Hash{31: key}.Bytes()), exists: exists}
+	}
+	// count the changes and apply them as collectResult does
+	apply := func(changes ...slotChange) {
+		runner.addSlotDeltas(changes)
+		for _, chg := range changes {
+			if chg.exists {
+				ctx.SetStorageAt(chg.seq, chg.key, []byte{1})
+			} else {
+				ctx.DeleteStorageAt(chg.seq, chg.key)
+			}
+		}
+	}
+	require.Equal(t, uint64(2), runner.getStorageQuota(1000))
+	apply(slot(1000, 1, true))
+	require.Equal(t, uint64(1), runner.getStorageQuota(1000))
+	apply(slot(1000, 2, true), slot(1000, 1, true)) // overwrite
+	require.Equal(t, uint64(0), runner.getStorageQuota(1000))
+	apply(slot(1001, 1, true), slot(1001, 2, true), slot(1001, 3, true))
+	require.Equal(t, uint64(math.MaxUint64), runner.getStorageQuota(1001))
+	require.Equal(t, map[uint64]int64{1000: 2}, runner.slotDeltas)
+
+	require.True(t, q.commit(runner.slotDeltas))
+	require.False(t, q.commit(map[uint64]int64{1000: 1})) // another group created a slot, too
+	require.Equal(t, uint64(2), q.count(1000))
+	require.True(t, q.commit(map[uint64]int64{1000: -1}))
+	require.True(t, q.commit(map[uint64]int64{1000: 1}))
+	trunk.Update(func(store storetypes.SetDeleter) {
+		q.writeBack(store)
+	})
+	require.Equal(t, uint64(2), GetStorageSlotCount(ctx, contract))
+	require.Equal(t, uint64(0), GetStorageSlotCount(ctx, exempted))
+
+	require.True(t, q.commit(map[uint64]int64{1000: -3})) // never below zero
+	require.Equal(t, uint64(0), q.count(1000))
+	// the counts are loaded from trunk in the next block
+	q = newStorageQuota(ctx, 3, nil)
+	require.Equal(t, uint64(2), q.count(1000))
+}
+
+// Each TX stores a new slot of the contract. They do not conflict with each other on the slot count.
+func TestStorageQuotaInEVM(t *testing.T) {
+	contract := common.Address{0xc1}
+	run := func(maxSlots uint64) (*txEngine, []*types.Transaction, uint64) {
+		trunk, root := prepareTruck()
+		defer closeTestCtx(root)
+		e := NewEbpTxExec(5, 100, 5, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+		e.SetStorageQuota(maxSlots, nil)
+		e.SetContext(prepareCtx(trunk))
+		acc := types.ZeroAccountInfo()
+		acc.UpdateSequence(1000)
+		e.cleanCtx.SetAccount(contract, acc)
+		// CALLER CALLER SSTORE STOP
+		e.cleanCtx.Rbt.Set(types.GetBytecodeKey(contract), append(make([]byte, 33), 0x33, 0x33, 0x55, 0x00))
+		for _, from := range []common.Address{from1, from2, from3} {
+			acc := types.ZeroAccountInfo()
+			acc.UpdateBalance(uint256.NewInt(10000_0000_0000))
+			e.cleanCtx.SetAccount(from, acc)
+		}
+		e.cleanCtx.Close(true)
+		e.SetContext(prepareCtx(trunk))
+		for _, from := range []common.Address{from1, from2, from3} {
+			tx, _ := gethtypes.NewTransaction(0, contract, big.NewInt(0), 100000, big.NewInt(1), nil).WithSignature(e.signer, from.Bytes())
+			e.CollectTx(tx)
+		}
+		e.Prepare(0, 0, DefaultTxGasLimit)
+		e.SetContext(prepareCtx(trunk))
+		e.Execute(&types.BlockInfo{})
+		e.SetContext(prepareCtx(trunk))
+		defer e.cleanCtx.Close(false)
+		return e, e.committedTxs, GetStorageSlotCount(e.cleanCtx, contract)
+	}
+
+	e, txs, count := run(10)
+	require.Equal(t, 3, len(txs))
+	for _, tx := range txs {
+		require.Equal(t, gethtypes.ReceiptStatusSuccessful, tx.Status)
+	}
+	require.Equal(t, 0, e.requeuedCount)
+	require.Equal(t, uint64(3), count)
+
+	// the third one fails to be merged in the first round, and runs out of the quota in the second one
+	e, txs, count = run(2)
+	require.Equal(t, 3, len(txs))
+	statuses := make([]string, len(txs))
+	for i, tx := range txs {
+		statuses[i] = tx.StatusStr
+	}
+	require.ElementsMatch(t, []string{"success", "success", "storage-quota-exceeded"}, statuses)
+	require.Equal(t, uint64(2), count)
+}
@@ -0,0 +1,83 @@
+package ebp
+
+import (
+	"encoding/binary"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// The count of the latest blocks whose random beacons are kept, the same as the block hashes of BLOCKHASH
+const RandomBeaconHistory = 256
+
+// Store the random beacon of currBlock and delete the one out of the history
+func (exec *txEngine) recordRandomBeacon(currBlock *types.BlockInfo) {
+	height := uint64(currBlock.Number)
+	var latest [8]byte
+	binary.BigEndian.PutUint64(latest[:], height)
+	ctx := exec.cleanCtx.WithRbtCopy()
+	ctx.Rbt.Set(types.GetRandomBeaconKey(height), append([]byte{}, currBlock.RandomBeacon[:]...))
+	ctx.Rbt.Set(types.RandomBeaconLatestKey, latest[:])
+	if height >= RandomBeaconHistory {
+		ctx.Rbt.Delete(types.GetRandomBeaconKey(height - RandomBeaconHistory))
+	}
+	ctx.Close(true)
+}
+
+// Returns the random beacon of the block at height, false if it is not kept
+func GetRandomBeacon(ctx *types.Context, height uint64) ([32]byte, bool) {
+	var beacon [32]byte
+	bz := ctx.Rbt.Get(types.GetRandomBeaconKey(height))
+	if len(bz) != 32 {
+		return beacon, false
+	}
+	copy(beacon[:], bz)
+	return beacon, true
+}
+
+// Returns the latest random beacon and the height of its block, false if there is none
+func GetLatestRandomBeacon(ctx *types.Context) (beacon [32]byte, height uint64, ok bool) {
+	bz := ctx.Rbt.Get(types.RandomBeaconLatestKey)
+	if len(bz) != 8 {
+		return
+	}
+	height = binary.BigEndian.Uint64(bz)
+	beacon, ok = GetRandomBeacon(ctx, height)
+	return
+}
+
+// RandomBeaconContract returns the random beacons provided by the consensus. With an empty input, it returns
+// the latest one, which is the one of the current block if the consensus provides it. With a 32-byte height,
+// it returns the one of that block, which must be one of the latest RandomBeaconHistory blocks. It fails if
+// the beacon is not kept, instead of returning zero. The beacon of a block is known to its proposer in
+// advance, so the contracts should commit to their requests before the beacons are generated.
+type RandomBeaconContract struct{}
+
+var _ statefulPrecompiledContract = (*RandomBeaconContract)(nil)
+
+func (rbc *RandomBeaconContract) RequiredGas(input []byte) uint64 {
+	return precompileGasTables[BeaconAddress].Gas(input)
+}
+
+func (rbc *RandomBeaconContract) Run(input []byte) ([]byte, error) {
+	return nil, errors.ErrStateNotAvailable
+}
+
+func (rbc *RandomBeaconContract) RunWithContext(ctx *types.Context, input []byte) ([]byte, error) {
+	var beacon [32]byte
+	var ok bool
+	switch {
+	case len(input) == 0:
+		beacon, _, ok = GetLatestRandomBeacon(ctx)
+	case len(input) == 32:
+		if isUint64(input) {
+			beacon, ok = GetRandomBeacon(ctx, binary.BigEndian.Uint64(input[24:]))
+		}
+	default:
+		return nil, errors.ErrInvalidInputLength
+	}
+	if !ok {
+		return nil, errors.ErrRandomBeaconNotFound
+	}
+	return beacon[:], nil
+}
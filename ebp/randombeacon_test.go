@@ -0,0 +1,77 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestRecordRandomBeacon(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	for _, height := range []int64{1, 2, 3 + RandomBeaconHistory} {
+		e.SetContext(prepareCtx(trunk))
+		e.Execute(&types.BlockInfo{Number: height, RandomBeacon: [32]byte{byte(height)}})
+		e.cleanCtx.Close(true)
+	}
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 4 + RandomBeaconHistory}) // without a beacon
+	e.cleanCtx.Close(true)
+
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	beacon, height, ok := GetLatestRandomBeacon(ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(3+RandomBeaconHistory), height)
+	require.Equal(t, [32]byte{byte(height)}, beacon)
+	beacon, ok = GetRandomBeacon(ctx, 2)
+	require.True(t, ok)
+	require.Equal(t, [32]byte{2}, beacon)
+	_, ok = GetRandomBeacon(ctx, 3) // out of the history
+	require.False(t, ok)
+}
+
+func TestRandomBeaconPrecompile(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	for height := int64(1); height <= 2; height++ {
+		e.SetContext(prepareCtx(trunk))
+		e.Execute(&types.BlockInfo{Number: height, RandomBeacon: [32]byte{byte(height)}})
+		e.cleanCtx.Close(true)
+	}
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	ctx.SetChainConfig(&types.ChainConfig{Upgrades: []types.Upgrade{
+		{Height: 2, Rules: types.Rules{Revision: types.Istanbul, RefundQuotient: 2, RandomBeaconPrecompile: true}}}})
+	msg := ethereum.CallMsg{From: from1, To: &BeaconAddress}
+
+	res := ExecuteReadOnly(ctx, msg, &types.BlockInfo{Number: 1}) // not enabled yet
+	require.False(t, res.Failed())
+	require.Empty(t, res.OutData)
+
+	blk := &types.BlockInfo{Number: 2}
+	res = ExecuteReadOnly(ctx, msg, blk)
+	require.False(t, res.Failed())
+	require.Equal(t, []byte{2}, res.OutData[:1])
+	require.Equal(t, RANDOM_BEACON_GAS+21000, res.GasUsed)
+
+	msg.Data = common.LeftPadBytes([]byte{1}, 32)
+	res = ExecuteReadOnly(ctx, msg, blk)
+	require.False(t, res.Failed())
+	require.Equal(t, []byte{1}, res.OutData[:1])
+
+	msg.Data = common.LeftPadBytes([]byte{3}, 32) // not known
+	res = ExecuteReadOnly(ctx, msg, blk)
+	require.True(t, res.Failed())
+	msg.Data = []byte{1}
+	res = ExecuteReadOnly(ctx, msg, blk)
+	require.True(t, res.Failed())
+}
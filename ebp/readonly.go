@@ -0,0 +1,82 @@
+package ebp
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// CallResult is the result of ExecuteReadOnly
+type CallResult struct {
+	Status  int
+	GasUsed uint64
+	// the returned data, or the revert data if Reverted is true
+	OutData  []byte
+	Reverted bool
+	Metrics  ExecutionMetrics
+}
+
+func (res CallResult) Failed() bool {
+	return StatusIsFailure(res.Status)
+}
+
+// Returns the revert data, or nil if the call is not reverted
+func (res CallResult) RevertData() []byte {
+	if !res.Reverted {
+		return nil
+	}
+	return res.OutData
+}
+
+func bigToBytes32(b *big.Int) (res [32]byte) {
+	if b != nil {
+		b.FillBytes(res[:])
+	}
+	return
+}
+
+// Convert msg of eth_call to a TxToRun. A nil To means contract creation and a zero Gas means
+// DefaultTxGasLimit.
+func callMsgToTx(msg *ethereum.CallMsg, currBlock *types.BlockInfo) *types.TxToRun {
+	tx := &types.TxToRun{
+		BasicTx: types.BasicTx{
+			From:     msg.From,
+			Value:    bigToBytes32(msg.Value),
+			GasPrice: bigToBytes32(msg.GasPrice),
+			Gas:      msg.Gas,
+			Data:     msg.Data,
+		},
+		Height:     uint64(currBlock.Number),
+		AccessList: msg.AccessList,
+	}
+	if msg.To != nil {
+		tx.To = *msg.To
+	}
+	if tx.Gas == 0 {
+		tx.Gas = DefaultTxGasLimit
+	}
+	return tx
+}
+
+// ExecuteReadOnly runs msg as eth_call does: it runs on a RabbitStore copy of ctx, which is discarded at
+// the end, and it has no signature, no nonce check and no gas fee.
+func ExecuteReadOnly(ctx *types.Context, msg ethereum.CallMsg, currBlock *types.BlockInfo) CallResult {
+	rbtCopy := ctx.WithRbtCopy()
+	defer rbtCopy.Close(false)
+	return runReadOnly(rbtCopy, &msg, currBlock)
+}
+
+// run msg on ctx, which is a temporary copy to be discarded
+func runReadOnly(ctx *types.Context, msg *ethereum.CallMsg, currBlock *types.BlockInfo) CallResult {
+	runner := NewTxRunner(ctx, callMsgToTx(msg, currBlock))
+	RunTxForRpc(currBlock, false, runner)
+	return CallResult{
+		Status:   runner.Status,
+		GasUsed:  runner.GasUsed,
+		OutData:  runner.OutData,
+		Reverted: StatusIsRevert(runner.Status),
+		Metrics:  runner.Metrics,
+	}
+}
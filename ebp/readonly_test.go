@@ -0,0 +1,206 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// It reverts with its input as the revert data
+type revertExecutor struct{ panicExecutor }
+
+func (re revertExecutor) Execute(ctx *types.Context, currBlock *types.BlockInfo, tx *types.TxToRun) (int, []types.EvmLog, uint64, []byte) {
+	return 2 /*EVMC_REVERT*/, nil, 5000, tx.Data
+}
+
+func TestExecuteReadOnly(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	blk := &types.BlockInfo{Number: 1}
+	identity := common.BytesToAddress([]byte{4})
+	res := ExecuteReadOnly(ctx, ethereum.CallMsg{From: from1, To: &identity, Data: []byte("call")}, blk)
+	require.False(t, res.Failed())
+	require.Equal(t, []byte("call"), res.OutData)
+	require.Nil(t, res.RevertData())
+	require.NotZero(t, res.GasUsed)
+
+	revertAddr := common.HexToAddress("0x2711")
+	PredefinedContractManager[revertAddr] = revertExecutor{}
+	defer delete(PredefinedContractManager, revertAddr)
+	res = ExecuteReadOnly(ctx, ethereum.CallMsg{From: from1, To: &revertAddr, Data: []byte("reason")}, blk)
+	require.True(t, res.Failed())
+	require.True(t, res.Reverted)
+	require.Equal(t, []byte("reason"), res.RevertData())
+	require.Equal(t, uint64(5000), res.GasUsed)
+
+	// nothing is written back
+	require.Nil(t, ctx.GetAccount(from1))
+}
+
+func TestExecuteReadOnlyWithOverrides(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	blk := &types.BlockInfo{Number: 1}
+	contract := common.HexToAddress("0x1234")
+	// returns the value at slot 1: PUSH1 1 SLOAD PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	code := hexutil.Bytes{0x60, 0x01, 0x54, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3}
+	slot1 := common.BigToHash(big.NewInt(1))
+	state := map[common.Hash]common.Hash{slot1: common.BigToHash(big.NewInt(42))}
+	balance := (*hexutil.Big)(big.NewInt(1000))
+	nonce := hexutil.Uint64(7)
+	overrides := StateOverride{
+		contract: {Code: &code, State: &state},
+		from1:    {Balance: balance, Nonce: &nonce},
+	}
+	res, err := ExecuteReadOnlyWithOverrides(ctx, ethereum.CallMsg{From: from1, To: &contract}, blk, overrides, nil)
+	require.NoError(t, err)
+	require.False(t, res.Failed())
+	require.Equal(t, state[slot1].Bytes(), res.OutData)
+
+	// nothing is written back
+	require.Nil(t, ctx.GetAccount(from1))
+	require.Nil(t, ctx.GetCode(contract))
+
+	rbtCopy := ctx.WithRbtCopy()
+	defer rbtCopy.Close(false)
+	require.NoError(t, overrides.Apply(rbtCopy))
+	acc := rbtCopy.GetAccount(from1)
+	require.Equal(t, uint64(7), acc.Nonce())
+	require.Equal(t, uint64(1000), acc.Balance().Uint64())
+	seq := rbtCopy.GetAccount(contract).Sequence()
+	require.Equal(t, uint64(contract[0]), seq&0xff)
+	require.Equal(t, []byte(code), rbtCopy.GetCode(contract).BytecodeSlice())
+
+	// the whole storage is replaced with a new sequence, while stateDiff keeps the other slots
+	slot2 := common.BigToHash(big.NewInt(2))
+	diff := map[common.Hash]common.Hash{slot2: common.BigToHash(big.NewInt(9))}
+	require.NoError(t, StateOverride{contract: {StateDiff: &diff}}.Apply(rbtCopy))
+	require.Equal(t, seq, rbtCopy.GetAccount(contract).Sequence())
+	require.Equal(t, state[slot1].Bytes(), rbtCopy.GetStorageAt(seq, string(slot1[:])))
+	require.NoError(t, StateOverride{contract: {State: &diff}}.Apply(rbtCopy))
+	newSeq := rbtCopy.GetAccount(contract).Sequence()
+	require.NotEqual(t, seq, newSeq)
+	require.Nil(t, rbtCopy.GetStorageAt(newSeq, string(slot1[:])))
+	require.Equal(t, diff[slot2].Bytes(), rbtCopy.GetStorageAt(newSeq, string(slot2[:])))
+
+	_, err = ExecuteReadOnlyWithOverrides(ctx, ethereum.CallMsg{From: from1, To: &contract}, blk,
+		StateOverride{contract: {State: &state, StateDiff: &diff}}, nil)
+	require.Error(t, err)
+}
+
+func TestBlockOverrides(t *testing.T) {
+	blk := &types.BlockInfo{Number: 10, Timestamp: 100, GasLimit: 1000}
+	var o *BlockOverrides
+	res, err := o.Apply(blk)
+	require.NoError(t, err)
+	require.Equal(t, blk, res)
+
+	number, time := hexutil.Uint64(20), hexutil.Uint64(200)
+	coinbase := common.HexToAddress("0x99")
+	random := common.HexToHash("0x1234")
+	o = &BlockOverrides{Number: &number, Time: &time, Coinbase: &coinbase, Random: &random,
+		BaseFee: (*hexutil.Big)(big.NewInt(5))}
+	res, err = o.Apply(blk)
+	require.NoError(t, err)
+	require.Equal(t, int64(20), res.Number)
+	require.Equal(t, int64(200), res.Timestamp)
+	require.Equal(t, int64(1000), res.GasLimit)
+	require.Equal(t, [20]byte(coinbase), res.Coinbase)
+	require.Equal(t, [32]byte(random), res.Difficulty)
+	require.Equal(t, [32]byte(common.BigToHash(big.NewInt(5))), res.BaseFee)
+	require.Equal(t, int64(10), blk.Number) // the original is not changed
+
+	o.Difficulty = (*hexutil.Big)(big.NewInt(1))
+	_, err = o.Apply(blk)
+	require.Error(t, err)
+	o.Random = nil
+	o.BaseFee = (*hexutil.Big)(big.NewInt(-1))
+	_, err = o.Apply(blk)
+	require.Error(t, err)
+	tooLarge := hexutil.Uint64(1 << 63)
+	_, err = (&BlockOverrides{Time: &tooLarge}).Apply(blk)
+	require.Error(t, err)
+}
+
+// A revert in a sub-call only undoes the changes and logs of the sub-call, not the ones of its parent
+func TestNestedRevert(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	parent, child := common.HexToAddress("0xaa00"), common.HexToAddress("0xbb00")
+	// SSTORE(0, 1) LOG0(0, 0) REVERT(0, 0)
+	childCode := hexutil.Bytes{0x60, 0x01, 0x60, 0x00, 0x55, 0x60, 0x00, 0x60, 0x00, 0xa0, 0x60, 0x00, 0x60, 0x00, 0xfd}
+	// LOG0(0, 0) MSTORE(0, CALL(GAS, child, 0, 0, 0, 0, 0)) RETURN(0, 32)
+	parentCode := hexutil.Bytes{0x60, 0x00, 0x60, 0x00, 0xa0,
+		0x60, 0x00, 0x60, 0x00, 0x60, 0x00, 0x60, 0x00, 0x60, 0x00, 0x73}
+	parentCode = append(parentCode, child[:]...)
+	parentCode = append(parentCode, 0x5a, 0xf1, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3)
+
+	rbtCopy := ctx.WithRbtCopy()
+	defer rbtCopy.Close(false)
+	require.NoError(t, StateOverride{parent: {Code: &parentCode}, child: {Code: &childCode}}.Apply(rbtCopy))
+	tx := &types.TxToRun{BasicTx: types.BasicTx{From: from1, To: parent, Gas: DefaultTxGasLimit}}
+	runner := NewTxRunner(rbtCopy, tx)
+	RunTxForRpc(&types.BlockInfo{Number: 1}, false, runner)
+	require.False(t, StatusIsFailure(runner.Status))
+	require.Equal(t, make([]byte, 32), runner.OutData) // the sub-call failed
+	require.Equal(t, 1, len(runner.Logs))
+	require.Equal(t, parent, runner.Logs[0].Address)
+	require.Nil(t, rbtCopy.GetStorageAt(rbtCopy.GetAccount(child).Sequence(), string(make([]byte, 32))))
+	require.Equal(t, 1, runner.Metrics.Reverts)
+	require.True(t, runner.Metrics.RevertedChanges >= 2) // at least the storage change and the log
+	require.True(t, runner.Metrics.Snapshots >= 2)
+}
+
+func TestStaticCallViolation(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	ctx := prepareCtx(trunk)
+	defer ctx.Close(false)
+	// returns the result of STATICCALL(GAS, target, 0, argsSize, 0, 0), after MSTORE(0, word) if word is not nil
+	staticCaller := func(target common.Address, word []byte, argsSize byte) hexutil.Bytes {
+		var code hexutil.Bytes
+		if word != nil {
+			code = append(append(code, 0x7f), word...)
+			code = append(code, 0x60, 0x00, 0x52)
+		}
+		code = append(code, 0x60, 0x00, 0x60, 0x00, 0x60, argsSize, 0x60, 0x00, 0x73)
+		code = append(code, target[:]...)
+		return append(code, 0x5a, 0xfa, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3)
+	}
+	parent, writer := common.HexToAddress("0xaa00"), common.HexToAddress("0xcc00")
+	writerCode := hexutil.Bytes{0x60, 0x01, 0x60, 0x00, 0x55, 0x00} // SSTORE(0, 1) STOP
+	transferWord := make([]byte, 32)
+	copy(transferWord, []byte{0xa9, 0x05, 0x9c, 0xbb}) // transfer(address,uint256)
+	for _, caller := range []hexutil.Bytes{
+		staticCaller(writer, nil, 0),
+		staticCaller(Sep206Address, transferWord, 68),
+	} {
+		code := caller
+		rbtCopy := ctx.WithRbtCopy()
+		require.NoError(t, StateOverride{parent: {Code: &code}, writer: {Code: &writerCode}}.Apply(rbtCopy))
+		tx := &types.TxToRun{BasicTx: types.BasicTx{From: from1, To: parent, Gas: DefaultTxGasLimit}}
+		runner := NewTxRunner(rbtCopy, tx)
+		RunTxForRpc(&types.BlockInfo{Number: 1}, false, runner)
+		require.False(t, StatusIsFailure(runner.Status))
+		require.Equal(t, make([]byte, 32), runner.OutData) // STATICCALL pushed zero
+		require.Equal(t, 2, len(runner.InternalTxReturns)) // the returns are recorded in post-order
+		status := runner.InternalTxReturns[0].StatusCode
+		require.True(t, StatusIsStaticViolation(status))
+		require.ErrorIs(t, StatusToError(status, nil), errors.ErrWriteProtection)
+		require.Nil(t, rbtCopy.GetStorageAt(rbtCopy.GetAccount(writer).Sequence(), string(make([]byte, 32))))
+		rbtCopy.Close(false)
+	}
+}
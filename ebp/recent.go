@@ -0,0 +1,115 @@
+package ebp
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// RecentHashes tracks the hashes of the TXs in the standby queue and of the TXs executed in the last
+// few blocks, such that resubmitted TXs are rejected by ValidateTx with ErrAlreadyKnown before they reach
+// the mempool. It lives in memory: after a restart, the hashes of the queued TXs are reloaded from world
+// state in the first Prepare, and the node can use AddBlock to reload the recently committed ones. So it
+// is never consulted by CollectTx, whose results must not depend on the history of a node.
+type RecentHashes struct {
+	mtx          sync.Mutex
+	blocks       int64                    // how many blocks the committed hashes are kept
+	queued       map[common.Hash]struct{} // the TXs in standby queue
+	committed    map[common.Hash]int64    // hash => height
+	heights      []int64                  // the heights in committed, in increasing order
+	byHeight     map[int64][]common.Hash
+	queueLoaded  bool
+	latestHeight int64
+}
+
+func NewRecentHashes(blocks int) *RecentHashes {
+	return &RecentHashes{
+		blocks:    int64(blocks),
+		queued:    make(map[common.Hash]struct{}),
+		committed: make(map[common.Hash]int64),
+		byHeight:  make(map[int64][]common.Hash),
+	}
+}
+
+func (r *RecentHashes) Contains(hash common.Hash) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.queued[hash]; ok {
+		return true
+	}
+	_, ok := r.committed[hash]
+	return ok
+}
+
+func (r *RecentHashes) addQueued(hashes []common.Hash) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, hash := range hashes {
+		r.queued[hash] = struct{}{}
+	}
+}
+
+// Forget the hashes of the TXs which are removed from the queues without being committed
+func (r *RecentHashes) removeQueued(hashes []common.Hash) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, hash := range hashes {
+		delete(r.queued, hash)
+	}
+}
+
+// Record the hashes of the TXs executed at height, which are no longer in standby queue and whose nonces
+// are consumed.
+// The hashes committed before height-blocks+1 are forgotten.
+func (r *RecentHashes) AddBlock(height int64, hashes []common.Hash) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, hash := range hashes {
+		delete(r.queued, hash)
+		r.committed[hash] = height
+	}
+	if _, ok := r.byHeight[height]; !ok {
+		r.heights = append(r.heights, height)
+	}
+	r.byHeight[height] = append(r.byHeight[height], hashes...)
+	if height > r.latestHeight {
+		r.latestHeight = height
+	}
+	for len(r.heights) != 0 && r.heights[0] <= r.latestHeight-r.blocks {
+		h := r.heights[0]
+		for _, hash := range r.byHeight[h] {
+			if r.committed[hash] == h {
+				delete(r.committed, hash)
+			}
+		}
+		delete(r.byHeight, h)
+		r.heights = r.heights[1:]
+	}
+}
+
+// Load the hashes of the TXs in standby queue, only once after the RecentHashes is created
+func (exec *txEngine) loadQueuedHashes() {
+	r := exec.recentHashes
+	r.mtx.Lock()
+	loaded := r.queueLoaded
+	r.queueLoaded = true
+	r.mtx.Unlock()
+	if loaded {
+		return
+	}
+	startKey, endKey := exec.getStandbyQueueRange()
+	ctx := exec.cleanCtx.WithRbtCopy()
+	defer ctx.Close(false)
+	hashes := make([]common.Hash, 0, endKey-startKey)
+	for i := startKey; i < endKey; i++ {
+		var txToRun types.TxToRun
+		txToRun.FromBytes(ctx.Rbt.GetBaseStore().Get(types.GetStandbyTxKey(i)))
+		hashes = append(hashes, txToRun.HashID)
+	}
+	exec.scanScheduledTxs(ctx, func(tx *types.TxToRun) {
+		hashes = append(hashes, tx.HashID)
+	})
+	r.addQueued(hashes)
+}
@@ -0,0 +1,138 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestRecentHashesPruning(t *testing.T) {
+	r := NewRecentHashes(2)
+	r.addQueued([]common.Hash{{1}, {2}})
+	require.True(t, r.Contains(common.Hash{1}))
+	r.AddBlock(10, []common.Hash{{1}})
+	r.AddBlock(11, []common.Hash{{3}})
+	require.True(t, r.Contains(common.Hash{1}))
+	r.AddBlock(12, nil)
+	require.False(t, r.Contains(common.Hash{1}))
+	require.True(t, r.Contains(common.Hash{2})) // still in queue
+	require.True(t, r.Contains(common.Hash{3}))
+	r.AddBlock(13, nil)
+	require.False(t, r.Contains(common.Hash{3}))
+}
+
+func TestCollectKnownTx(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, _ := prepareEngine(trunk)
+	e.SetDropDuplicateTxs(true)
+	e.SetRecentHashes(NewRecentHashes(1))
+	tx, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	e.CollectTx(tx)
+	require.NoError(t, e.ValidateTx(tx)) // only collected
+	// the TXs of a block are collected regardless of the recent hashes, and the duplicate is dropped in Prepare
+	e.CollectTx(tx)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	require.Equal(t, 1, e.StandbyQLen())
+	require.Equal(t, 0, len(e.committedTxs))
+	require.ErrorIs(t, e.ValidateTx(tx), errors.ErrAlreadyKnown) // queued
+
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 1})
+	require.Equal(t, 1, len(e.committedTxs))
+	require.ErrorIs(t, e.ValidateTx(tx), errors.ErrAlreadyKnown) // committed
+	e.SetContext(prepareCtx(trunk))
+	require.False(t, isQueuedTx(e.cleanCtx.Rbt.GetBaseStore(), tx.Hash()))
+	require.Nil(t, e.cleanCtx.Rbt.GetBaseStore().Get(types.GetQueuedTxHashKey(tx.Hash()))) // unindexed
+
+	e.SetContext(prepareCtx(trunk))
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 2})
+	require.NoError(t, e.ValidateTx(tx))
+}
+
+func TestDropQueuedTx(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(1, 1, 1, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetDropDuplicateTxs(true)
+	e.SetContext(prepareCtx(trunk))
+	txs := prepareAccAndTx(e)
+	e.SetContext(prepareCtx(trunk))
+	e.CollectTx(txs[0])
+	e.CollectTx(txs[1])
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 1})
+	require.Equal(t, 1, e.StandbyQLen()) // one TX is left in the queue, and it is indexed at its new slot
+	e.SetContext(prepareCtx(trunk))
+	require.True(t, isQueuedTx(e.cleanCtx.Rbt.GetBaseStore(), txs[1].Hash()))
+
+	require.Equal(t, 1, len(e.committedTxs))
+	committed := e.committedTxs[0].Hash
+
+	// the TX in standby queue is dropped without a receipt when it is in a later block again, while the
+	// committed one fails with its nonce
+	e.SetContext(prepareCtx(trunk))
+	e.CollectTx(txs[0])
+	e.CollectTx(txs[1])
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	require.Equal(t, 1, e.StandbyQLen())
+	require.Equal(t, 2, len(e.committedTxs))
+	require.Equal(t, committed, e.committedTxs[1].Hash)
+}
+
+func TestDropDuplicateTxsDisabled(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, _ := prepareEngine(trunk)
+	tx, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	e.CollectTx(tx)
+	e.CollectTx(tx)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	require.Equal(t, 1, e.StandbyQLen())
+	require.Equal(t, 1, len(e.committedTxs)) // the duplicate fails with its nonce
+	e.SetContext(prepareCtx(trunk))
+	require.Nil(t, e.cleanCtx.Rbt.GetBaseStore().Get(types.GetQueuedTxHashKey(tx.Hash())))
+	e.cleanCtx.Close(false)
+}
+
+func TestIgnoredTxNotKnown(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, _ := prepareEngine(trunk)
+	e.SetRecentHashes(NewRecentHashes(10))
+	tx, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	e.CollectTx(tx)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	require.ErrorIs(t, e.ValidateTx(tx), errors.ErrAlreadyKnown) // queued
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: int64(types.TOO_OLD_THRESHOLD) + 1})
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, "too-old-and-ignored", e.committedTxs[0].StatusStr)
+	// the ignored TX did not consume its nonce, so it can be submitted again
+	require.NoError(t, e.ValidateTx(tx))
+
+	e.SetContext(prepareCtx(trunk))
+	e.CollectTx(tx)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 1})
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, gethtypes.ReceiptStatusSuccessful, e.committedTxs[0].Status)
+	require.ErrorIs(t, e.ValidateTx(tx), errors.ErrAlreadyKnown) // its nonce is consumed now
+	e.cleanCtx.Close(false)
+}
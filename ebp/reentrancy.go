@@ -0,0 +1,129 @@
+package ebp
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// The tracer flagging the reentrant calls of a tx, for the auditors analyzing incidents
+const ReentrancyTracer = "reentrancyTracer"
+
+func init() {
+	RegisterTxTracer(ReentrancyTracer, reentrancyTracer)
+}
+
+const (
+	// A contract is called again while one of its frames is waiting for an external call
+	PatternReentrancy = "reentrancy"
+	// The storage of a reentered contract is written in the tx. The EVM does not report when a slot is
+	// written in a frame, so the write may be in the reentrant frame or after the external call returns,
+	// in which case the reentered frame has updated its state after an external call.
+	PatternStorageWriteAfterExternalCall = "storageWriteAfterExternalCall"
+)
+
+type SuspiciousPattern struct {
+	Kind     string         `json:"kind"`
+	Contract common.Address `json:"contract"` // the contract whose storage is used by the frames
+	// the frame which reentered the contract, and the one it reentered
+	TraceAddress          []int  `json:"traceAddress"`
+	ReenteredTraceAddress []int  `json:"reenteredTraceAddress"`
+	Detail                string `json:"detail,omitempty"`
+}
+
+type reentrancyFrame struct {
+	traceAddress []int
+	storageAddr  common.Address // differs from the destination for DELEGATECALL and CALLCODE
+	subframes    int
+}
+
+func reentrancyTracer(runner *TxRunner, _ *TraceTxContext, _ json.RawMessage) (interface{}, error) {
+	findings := make([]*SuspiciousPattern, 0)
+	stack := make([]*reentrancyFrame, 0, 8)
+	reentered := make(map[common.Address]*SuspiciousPattern)
+	err := replayCallFrames(runner.InternalTxCalls, runner.InternalTxReturns,
+		func(call *types.InternalTxCall) error {
+			frame := &reentrancyFrame{traceAddress: []int{}, storageAddr: call.Destination}
+			kind := callKindName(call)
+			if len(stack) != 0 {
+				parent := stack[len(stack)-1]
+				frame.traceAddress = append(append([]int{}, parent.traceAddress...), parent.subframes)
+				parent.subframes++
+				if kind == "DELEGATECALL" || kind == "CALLCODE" {
+					frame.storageAddr = parent.storageAddr
+				}
+			}
+			// a STATICCALL cannot change the state, and a created contract cannot be active
+			if kind != "STATICCALL" && kind != "CREATE" && kind != "CREATE2" {
+				if f := findReentrancy(stack, frame); f != nil {
+					findings = append(findings, f)
+					if _, ok := reentered[f.Contract]; !ok {
+						reentered[f.Contract] = f
+					}
+				}
+			}
+			stack = append(stack, frame)
+			return nil
+		},
+		func(_ *types.InternalTxCall, _ *types.InternalTxReturn) error {
+			stack = stack[:len(stack)-1]
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range writtenContracts(runner.RwLists) {
+		if f, ok := reentered[addr]; ok {
+			findings = append(findings, &SuspiciousPattern{
+				Kind:                  PatternStorageWriteAfterExternalCall,
+				Contract:              addr,
+				TraceAddress:          f.TraceAddress,
+				ReenteredTraceAddress: f.ReenteredTraceAddress,
+			})
+		}
+	}
+	return findings, nil
+}
+
+// Returns the reentrancy if frame uses the storage of an active frame, which is waiting for a frame of
+// another contract. A contract calling itself is not reentrancy.
+func findReentrancy(stack []*reentrancyFrame, frame *reentrancyFrame) *SuspiciousPattern {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].storageAddr != frame.storageAddr {
+			continue
+		}
+		if i == len(stack)-1 {
+			return nil
+		}
+		return &SuspiciousPattern{
+			Kind:                  PatternReentrancy,
+			Contract:              frame.storageAddr,
+			TraceAddress:          frame.traceAddress,
+			ReenteredTraceAddress: stack[i].traceAddress,
+			Detail:                fmt.Sprintf("reentered through %s", stack[i+1].storageAddr.Hex()),
+		}
+	}
+	return nil
+}
+
+// Returns the contracts whose storage slots are written, in the order of the first writes
+func writtenContracts(rwLists *types.ReadWriteLists) []common.Address {
+	if rwLists == nil {
+		return nil
+	}
+	seq2addr := seqToAddr(rwLists)
+	seen := make(map[common.Address]struct{})
+	var addrs []common.Address
+	for _, op := range rwLists.StorageWList {
+		addr, ok := seq2addr[op.Seq]
+		if _, dup := seen[addr]; !ok || dup {
+			continue
+		}
+		seen[addr] = struct{}{}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
@@ -0,0 +1,74 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestReentrancyTracer(t *testing.T) {
+	// the tx calls 1, which calls 2, which calls 1 again, which calls itself. Then 1 delegate-calls 3, whose
+	// code runs with the storage of 1, and calls 2, which static-calls 1.
+	runner := &TxRunner{
+		InternalTxCalls: []types.InternalTxCall{
+			{Depth: 0, Gas: 1000, Destination: [20]byte{1}},
+			{Depth: 1, Gas: 900, Sender: [20]byte{1}, Destination: [20]byte{2}},
+			{Depth: 2, Gas: 800, Sender: [20]byte{2}, Destination: [20]byte{1}},
+			{Depth: 3, Gas: 700, Sender: [20]byte{1}, Destination: [20]byte{1}},
+			{Depth: 1, Gas: 600, Sender: [20]byte{1}, Destination: [20]byte{3}, Kind: 1},
+			{Depth: 1, Gas: 500, Sender: [20]byte{1}, Destination: [20]byte{2}},
+			{Depth: 2, Gas: 400, Sender: [20]byte{2}, Destination: [20]byte{1}, Flags: 1},
+		},
+		InternalTxReturns: make([]types.InternalTxReturn, 7),
+	}
+	res, err := reentrancyTracer(runner, &TraceTxContext{}, nil)
+	require.NoError(t, err)
+	findings := res.([]*SuspiciousPattern)
+	require.Equal(t, 1, len(findings))
+	require.Equal(t, PatternReentrancy, findings[0].Kind)
+	require.Equal(t, common.Address{1}, findings[0].Contract)
+	require.Equal(t, []int{0, 0}, findings[0].TraceAddress)
+	require.Equal(t, []int{}, findings[0].ReenteredTraceAddress)
+
+	// the storage of the reentered contract is written
+	acc := types.ZeroAccountInfo()
+	acc.UpdateSequence(5)
+	runner.RwLists = &types.ReadWriteLists{
+		AccountRList: []types.AccountRWOp{{Addr: common.Address{1}, Account: acc.Bytes()}},
+		StorageWList: []types.StorageRWOp{{Seq: 5, Key: string(make([]byte, 32)), Value: []byte{1}}},
+	}
+	res, err = reentrancyTracer(runner, &TraceTxContext{}, nil)
+	require.NoError(t, err)
+	findings = res.([]*SuspiciousPattern)
+	require.Equal(t, 2, len(findings))
+	require.Equal(t, PatternStorageWriteAfterExternalCall, findings[1].Kind)
+	require.Equal(t, common.Address{1}, findings[1].Contract)
+	require.Equal(t, []int{0, 0}, findings[1].TraceAddress)
+}
+
+func TestReentrancyThroughDelegateCall(t *testing.T) {
+	// 1 calls 2, which delegate-calls 3, which calls 2: the storage of 2 is reentered
+	runner := &TxRunner{
+		InternalTxCalls: []types.InternalTxCall{
+			{Depth: 0, Gas: 1000, Destination: [20]byte{1}},
+			{Depth: 1, Gas: 900, Sender: [20]byte{1}, Destination: [20]byte{2}},
+			{Depth: 2, Gas: 800, Sender: [20]byte{2}, Destination: [20]byte{3}, Kind: 1},
+			{Depth: 3, Gas: 700, Sender: [20]byte{2}, Destination: [20]byte{2}},
+		},
+		InternalTxReturns: make([]types.InternalTxReturn, 4),
+	}
+	res, err := reentrancyTracer(runner, &TraceTxContext{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(res.([]*SuspiciousPattern))) // 3 runs as 2, so 2 calls itself
+
+	runner.InternalTxCalls[2].Kind = 0 // a CALL to 3
+	res, err = reentrancyTracer(runner, &TraceTxContext{}, nil)
+	require.NoError(t, err)
+	findings := res.([]*SuspiciousPattern)
+	require.Equal(t, 1, len(findings))
+	require.Equal(t, common.Address{2}, findings[0].Contract)
+	require.Equal(t, []int{0}, findings[0].ReenteredTraceAddress)
+}
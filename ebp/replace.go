@@ -0,0 +1,98 @@
+package ebp
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+
+	"github.com/smartbch/moeingevm/types"
+	"github.com/smartbch/moeingevm/utils"
+)
+
+const replacedByFee = "replaced by a tx with higher gas price"
+
+// queuedTx is the latest tx of a sender with a nonce, which is either waiting in the standby queue or
+// accepted in the current Prepare
+type queuedTx struct {
+	orig *types.TxToRun // the tx in the standby queue, nil if there is none
+	pos  uint64         // the position of orig
+	info *preparedInfo  // the tx accepted in the current Prepare, nil if there is none
+}
+
+func (q *queuedTx) latest() *types.TxToRun {
+	if q.info != nil {
+		return q.info.tx
+	}
+	return q.orig
+}
+
+// Scan the standby queue for the TXs sent by the senders in addr2Infos. The inner maps are created before
+// the parallel part of Prepare, so each of them is only written by the goroutine owning the sender.
+func (exec *txEngine) loadQueuedTxs(addr2Infos map[common.Address][]*preparedInfo) map[common.Address]map[uint64]*queuedTx {
+	queued := make(map[common.Address]map[uint64]*queuedTx, len(addr2Infos))
+	for addr := range addr2Infos {
+		queued[addr] = make(map[uint64]*queuedTx)
+	}
+	start, end := exec.getStandbyQueueRange()
+	ctx := exec.cleanCtx.WithRbtCopy()
+	defer ctx.Close(false)
+	for i := start; i < end; i++ {
+		txToRun := &types.TxToRun{}
+		txToRun.FromBytes(ctx.Rbt.GetBaseStore().Get(types.GetStandbyTxKey(i)))
+		if m, ok := queued[txToRun.From]; ok {
+			m[txToRun.Nonce] = &queuedTx{orig: txToRun, pos: i}
+		}
+	}
+	return queued
+}
+
+// Returns true if the gas price of newTx is higher than the one of oldTx by at least bump percent
+func bumpsGasPrice(oldTx, newTx *types.TxToRun, bump uint64) bool {
+	oldPrice := utils.U256FromSlice32(oldTx.GasPrice[:])
+	newPrice := utils.U256FromSlice32(newTx.GasPrice[:])
+	if !newPrice.Gt(oldPrice) {
+		return false
+	}
+	minPrice, overflow := new(uint256.Int).MulOverflow(oldPrice, uint256.NewInt(100+bump))
+	if overflow {
+		return false
+	}
+	minPrice.Div(minPrice, uint256.NewInt(100))
+	return !newPrice.Lt(minPrice)
+}
+
+// Let info replace the latest tx in q, refunding the gas fee of the replaced one. The balance is checked
+// in the same way as a new tx.
+func (exec *txEngine) replaceQueuedTx(info *preparedInfo, q *queuedTx, entry *ctxAndAccounts, reserved map[common.Address]*uint256.Int) {
+	old := q.latest()
+	if !bumpsGasPrice(old, info.tx, exec.replaceByFeeBump) {
+		info.errorStr = "replacement gas price too low"
+		return
+	}
+	sender := info.tx.From
+	oldFee := txGasFee(old)
+	_ = updateBalance(entry.ctx, sender, oldFee, true)
+	var oldValue *uint256.Int // the value reserved for the replaced tx
+	if reserved != nil && q.info != nil {
+		oldValue, _ = uint256.FromBig(utils.BigIntFromSlice32(old.Value[:]))
+		reserved[sender] = new(uint256.Int).Sub(reserved[sender], oldValue)
+	}
+	if (reserved != nil && !coversValueAndGasFee(info, entry, reserved)) ||
+		exec.deductGasFeeAndUpdateFrontier(sender, info, entry) != nil {
+		_ = SubSenderAccBalance(entry.ctx, sender, oldFee)
+		if oldValue != nil {
+			reserved[sender] = new(uint256.Int).Add(reserved[sender], oldValue)
+		}
+		return
+	}
+	entry.refundedFee.Add(entry.refundedFee, oldFee)
+	entry.changed = true
+	info.txBytes = exec.txToBytes(info.tx)
+	if q.info != nil {
+		q.info.errorStr = replacedByFee
+		q.info.replaced = nil
+	}
+	if q.orig != nil {
+		info.replaced, info.replacePos = q.orig, q.pos
+	}
+	q.info = info
+}
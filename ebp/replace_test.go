@@ -0,0 +1,70 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestBumpsGasPrice(t *testing.T) {
+	withPrice := func(price uint64) *types.TxToRun {
+		tx := &types.TxToRun{}
+		tx.GasPrice = uint256.NewInt(price).Bytes32()
+		return tx
+	}
+	require.True(t, bumpsGasPrice(withPrice(100), withPrice(110), 10))
+	require.False(t, bumpsGasPrice(withPrice(100), withPrice(109), 10))
+	require.True(t, bumpsGasPrice(withPrice(1), withPrice(2), 10)) // rounded down
+	require.False(t, bumpsGasPrice(withPrice(1), withPrice(1), 10))
+	require.False(t, bumpsGasPrice(withPrice(2), withPrice(1), 10))
+}
+
+/*
+testcase:
+account1 send txs(nonce): 0 with gas price 1, then 0 with gas price 2, which replaces the former one
+account2 send txs(nonce): 0 with gas price 1, then 0 with gas price 1, which is rejected
+*/
+func TestTxEngine_ReplaceByFee(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareEngine(trunk)
+	e.SetReplaceByFee(10)
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+
+	e.SetContext(prepareCtx(trunk))
+	e.committedTxs = e.committedTxs[:0]
+	tx3, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(2), nil).WithSignature(e.signer, from1.Bytes())
+	tx4, _ := gethtypes.NewTransaction(0, to2, big.NewInt(200), 100000, big.NewInt(1), nil).WithSignature(e.signer, from2.Bytes())
+	e.CollectTx(tx3)
+	e.CollectTx(tx4)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, 2, e.StandbyQLen())
+	status, ok := e.QueuedTxStatus(tx3.Hash())
+	require.True(t, ok)
+	require.Equal(t, 0, status.Position) // it takes the position of tx1
+	_, ok = e.QueuedTxStatus(txs[0].Hash())
+	require.False(t, ok)
+	_, ok = e.QueuedTxStatus(txs[1].Hash())
+	require.True(t, ok)
+	require.Equal(t, 2, len(e.committedTxs))
+	statusStrs := map[[32]byte]string{}
+	for _, tx := range e.committedTxs {
+		statusStrs[tx.Hash] = tx.StatusStr
+	}
+	require.Equal(t, "replacement gas price too low", statusStrs[tx4.Hash()])
+	require.Equal(t, replacedByFee, statusStrs[txs[0].Hash()])
+	// only the gas fee of tx3 is paid by account1
+	require.Equal(t, uint64(10000_0000_0000-2*100000), e.cleanCtx.GetAccount(from1).Balance().Uint64())
+	require.Equal(t, uint64(10000_0000_0000-100000), e.cleanCtx.GetAccount(from2).Balance().Uint64())
+	e.cleanCtx.Close(false)
+}
@@ -0,0 +1,136 @@
+package ebp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+var ErrStaleReplica = errors.New("replica has not reached the required height")
+
+// ReplayBlock is a finalized block in the stream consumed by ReplayExecutor. It carries all the inputs
+// which the validators fed to TxExecutor for this block.
+type ReplayBlock struct {
+	Info          types.BlockInfo
+	Txs           []*gethtypes.Transaction
+	ReorderSeed   int64
+	MinGasPrice   uint64
+	MaxTxGasLimit uint64
+}
+
+// ReplayExecutor maintains a read-only replica of the world state on a follower node, by running the
+// finalized blocks through a TxExecutor in the same way as the validators do. The replica serves the
+// heavy RPC and analytics queries, such that the validators are offloaded.
+// Only the changes made by TxExecutor are replayed. The changes made by the application at the block
+// boundaries must be applied by the 'commit' callback, which also persists the changes of a block.
+type ReplayExecutor struct {
+	exec TxExecutor
+	// returns a clean Context of the latest state
+	newCtx func() *types.Context
+	commit func(blk *ReplayBlock)
+
+	mtx    sync.RWMutex
+	height int64
+	// the latest height known from the block source, and when the last block was applied
+	chainHeight int64
+	appliedAt   time.Time
+}
+
+func NewReplayExecutor(exec TxExecutor, height int64, newCtx func() *types.Context, commit func(blk *ReplayBlock)) *ReplayExecutor {
+	return &ReplayExecutor{
+		exec:        exec,
+		newCtx:      newCtx,
+		commit:      commit,
+		height:      height,
+		chainHeight: height,
+	}
+}
+
+// The height of the last applied block
+func (r *ReplayExecutor) Height() int64 {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.height
+}
+
+// Apply the next block, whose number must be Height()+1
+func (r *ReplayExecutor) Apply(blk *ReplayBlock) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if blk.Info.Number != r.height+1 {
+		return fmt.Errorf("replay block %d after %d: %w", blk.Info.Number, r.height, types.ErrInvalidHeight)
+	}
+	for _, tx := range blk.Txs {
+		r.exec.CollectTx(tx)
+	}
+	r.exec.SetContext(r.newCtx()) // closed by Prepare
+	r.exec.Prepare(blk.ReorderSeed, blk.MinGasPrice, blk.MaxTxGasLimit)
+	ctx := r.newCtx()
+	r.exec.SetContext(ctx)
+	r.exec.Execute(&blk.Info) // the changes are written to the base store of ctx
+	ctx.Close(false)
+	r.commit(blk)
+	r.height = blk.Info.Number
+	if r.chainHeight < r.height {
+		r.chainHeight = r.height
+	}
+	r.appliedAt = time.Now()
+	return nil
+}
+
+// Record the latest height known from the block source, which may be larger than the height of the
+// blocks received so far
+func (r *ReplayExecutor) SetChainHeight(h int64) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.chainHeight < h {
+		r.chainHeight = h
+	}
+}
+
+// Returns how many blocks the replica is behind the chain, and when the last block was applied
+// (zero if no block was applied)
+func (r *ReplayExecutor) Staleness() (lag int64, appliedAt time.Time) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.chainHeight - r.height, r.appliedAt
+}
+
+// Apply the blocks from the stream until it is closed or an error occurs
+func (r *ReplayExecutor) Run(blocks <-chan *ReplayBlock) error {
+	for blk := range blocks {
+		if err := r.Apply(blk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run fn with a Context of the replica, which is not changed by Apply during fn. The Context is
+// closed without writing back after fn returns.
+func (r *ReplayExecutor) View(fn func(ctx *types.Context, height int64)) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	ctx := r.newCtx()
+	defer ctx.Close(false)
+	fn(ctx, r.height)
+}
+
+// Like View, but returns ErrStaleReplica without running fn if the replica is lower than minHeight.
+// The height passed to fn is the one the query is pinned at, which is not less than minHeight.
+func (r *ReplayExecutor) ViewAtLeast(minHeight int64, fn func(ctx *types.Context, height int64)) error {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	if r.height < minHeight {
+		return fmt.Errorf("at height %d but %d is required: %w", r.height, minHeight, ErrStaleReplica)
+	}
+	ctx := r.newCtx()
+	defer ctx.Close(false)
+	fn(ctx, r.height)
+	return nil
+}
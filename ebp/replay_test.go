@@ -0,0 +1,69 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingads/store"
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestReplayExecutor(t *testing.T) {
+	AdjustGasUsed = false
+	_, root := prepareTruck()
+	defer closeTestCtx(root)
+	randomTxs := generateRandomTx(&testcase.DumbSigner{})
+	expected := executeTxs(randomTxs, root.GetTrunkStore(1000).(*store.TrunkStore), nil)
+
+	trunk := root.GetTrunkStore(1000).(*store.TrunkStore)
+	e := NewEbpTxExec(2000, 200, 30, 2000, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+	committed := 0
+	r := NewReplayExecutor(e, 0, func() *types.Context {
+		return prepareCtx(trunk)
+	}, func(blk *ReplayBlock) {
+		committed++
+	})
+	blocks := make(chan *ReplayBlock, 1)
+	blocks <- &ReplayBlock{
+		Info:          types.BlockInfo{Number: 1},
+		Txs:           randomTxs,
+		MaxTxGasLimit: DefaultTxGasLimit,
+	}
+	close(blocks)
+	require.NoError(t, r.Run(blocks))
+	require.Equal(t, int64(1), r.Height())
+	require.Equal(t, 1, committed)
+	require.Equal(t, len(expected.committedTxs), len(e.CommittedTxs()))
+	r.View(func(ctx *types.Context, height int64) {
+		require.Equal(t, int64(1), height)
+		require.Equal(t, expected.from1.Balance(), ctx.GetAccount(from1).Balance())
+		require.Equal(t, expected.to2.Balance(), ctx.GetAccount(to2).Balance())
+	})
+	err := r.Apply(&ReplayBlock{Info: types.BlockInfo{Number: 3}})
+	require.True(t, errors.Is(err, types.ErrInvalidHeight))
+
+	r.SetChainHeight(5)
+	lag, appliedAt := r.Staleness()
+	require.Equal(t, int64(4), lag)
+	require.False(t, appliedAt.IsZero())
+	err = r.ViewAtLeast(2, func(ctx *types.Context, height int64) {
+		t.Fatal("must not run on a stale replica")
+	})
+	require.True(t, errors.Is(err, ErrStaleReplica))
+	pinned := int64(0)
+	require.NoError(t, r.ViewAtLeast(1, func(ctx *types.Context, height int64) {
+		pinned = height
+	}))
+	require.Equal(t, int64(1), pinned)
+
+	// a TX too large gets a receipt, as on the validators
+	e.SetMaxTxSize(1)
+	require.NoError(t, r.Apply(&ReplayBlock{Info: types.BlockInfo{Number: 2}, Txs: randomTxs[:1]}))
+	require.Equal(t, int64(2), r.Height())
+}
@@ -0,0 +1,105 @@
+package ebp
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// DataRetention limits the input and output data of the TXs in the records persisted by the host, which are
+// returned by CommittedTxsForMoDB and EachCommittedTx. The data longer than the limits are truncated, and
+// their keccak256 hashes are kept in InputHash and OutDataHash. Zero omits the data and a negative limit
+// keeps them in full. The TXs returned by CommittedTxs always have the full data.
+type DataRetention struct {
+	MaxInputSize   int
+	MaxOutDataSize int
+	// the full data of the truncated TXs are written into it after each block if it is not nil,
+	// such as on archive nodes
+	FullData *TxDataStore
+}
+
+// Returns tx itself if it is not truncated, otherwise a truncated copy
+func (r *DataRetention) apply(tx *types.Transaction) *types.Transaction {
+	if r == nil || (!exceedsLimit(tx.Input, r.MaxInputSize) && !exceedsLimit(tx.OutData, r.MaxOutDataSize)) {
+		return tx
+	}
+	res := *tx
+	if exceedsLimit(tx.Input, r.MaxInputSize) {
+		res.Input = tx.Input[:r.MaxInputSize]
+		res.InputHash = crypto.Keccak256Hash(tx.Input)
+	}
+	if exceedsLimit(tx.OutData, r.MaxOutDataSize) {
+		res.OutData = tx.OutData[:r.MaxOutDataSize]
+		res.OutDataHash = crypto.Keccak256Hash(tx.OutData)
+	}
+	return &res
+}
+
+func exceedsLimit(data []byte, limit int) bool {
+	return limit >= 0 && len(data) > limit
+}
+
+// TxDataStore keeps the full input and output data of the TXs truncated by DataRetention
+type TxDataStore struct {
+	db KVStore
+}
+
+func NewTxDataStore(db KVStore) *TxDataStore {
+	return &TxDataStore{db: db}
+}
+
+func txDataKey(hash common.Hash) []byte {
+	return append([]byte("td-"), hash[:]...)
+}
+
+func (s *TxDataStore) Put(hash common.Hash, input, outData []byte) {
+	bz := make([]byte, 4, 4+len(input)+len(outData))
+	binary.BigEndian.PutUint32(bz, uint32(len(input)))
+	bz = append(bz, input...)
+	bz = append(bz, outData...)
+	s.db.Set(txDataKey(hash), bz)
+}
+
+func (s *TxDataStore) Get(hash common.Hash) (input, outData []byte, ok bool) {
+	bz := s.db.Get(txDataKey(hash))
+	if len(bz) < 4 {
+		return nil, nil, false
+	}
+	size := int(binary.BigEndian.Uint32(bz))
+	if 4+size > len(bz) {
+		return nil, nil, false
+	}
+	return bz[4 : 4+size], bz[4+size:], true
+}
+
+// Fill the full data into tx, a record truncated by DataRetention. Returns false if the full data are not
+// found or do not match the hashes, in which case tx is not changed.
+func (s *TxDataStore) Restore(tx *types.Transaction) bool {
+	var zero [32]byte
+	if tx.InputHash == zero && tx.OutDataHash == zero {
+		return true
+	}
+	input, outData, ok := s.Get(tx.Hash)
+	if !ok || (tx.InputHash != zero && crypto.Keccak256Hash(input) != tx.InputHash) ||
+		(tx.OutDataHash != zero && crypto.Keccak256Hash(outData) != tx.OutDataHash) {
+		return false
+	}
+	if tx.InputHash != zero {
+		tx.Input, tx.InputHash = input, zero
+	}
+	if tx.OutDataHash != zero {
+		tx.OutData, tx.OutDataHash = outData, zero
+	}
+	return true
+}
+
+func (exec *txEngine) storeFullTxData() {
+	for _, tx := range exec.committedTxs {
+		if exec.dataRetention.apply(tx) != tx {
+			exec.dataRetention.FullData.Put(tx.Hash, tx.Input, tx.OutData)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package ebp
+
+import (
+	"io"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	modbtypes "github.com/smartbch/moeingdb/types"
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestDataRetention(t *testing.T) {
+	tx := &types.Transaction{Hash: [32]byte{1}, Input: []byte{1, 2, 3, 4}, OutData: []byte{5, 6}}
+	var r *DataRetention
+	require.Same(t, tx, r.apply(tx))
+	r = &DataRetention{MaxInputSize: 2, MaxOutDataSize: -1}
+	res := r.apply(tx)
+	require.Equal(t, []byte{1, 2}, res.Input)
+	require.Equal(t, [32]byte(crypto.Keccak256Hash(tx.Input)), res.InputHash)
+	require.Equal(t, []byte{5, 6}, res.OutData)
+	require.Equal(t, [32]byte{}, res.OutDataHash)
+	require.Equal(t, []byte{1, 2, 3, 4}, tx.Input) // the original is not changed
+
+	r = &DataRetention{MaxInputSize: 4, MaxOutDataSize: 0}
+	res = r.apply(tx)
+	require.Equal(t, tx.Input, res.Input)
+	require.Empty(t, res.OutData)
+	require.Equal(t, [32]byte(crypto.Keccak256Hash(tx.OutData)), res.OutDataHash)
+	require.Same(t, tx, (&DataRetention{MaxInputSize: 4, MaxOutDataSize: 2}).apply(tx))
+}
+
+func TestTxDataStore(t *testing.T) {
+	s := NewTxDataStore(memKVStore{})
+	tx := &types.Transaction{Hash: [32]byte{1}, Input: []byte{1, 2, 3, 4}, OutData: []byte{5, 6}}
+	res := (&DataRetention{MaxInputSize: 1, MaxOutDataSize: 1}).apply(tx)
+	require.False(t, s.Restore(res))
+
+	s.Put(tx.Hash, tx.Input, tx.OutData)
+	input, outData, ok := s.Get(tx.Hash)
+	require.True(t, ok)
+	require.Equal(t, tx.Input, input)
+	require.Equal(t, tx.OutData, outData)
+
+	bad := *res
+	bad.InputHash = [32]byte{9}
+	require.False(t, s.Restore(&bad))
+	require.Equal(t, []byte{1}, bad.Input)
+
+	require.True(t, s.Restore(res))
+	require.Equal(t, tx, res)
+	require.True(t, s.Restore(tx))
+}
+
+func TestTxEngine_DataRetention(t *testing.T) {
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	store := NewTxDataStore(memKVStore{})
+	e.SetDataRetention(&DataRetention{MaxInputSize: 1, MaxOutDataSize: -1, FullData: store})
+	e.committedTxs = []*types.Transaction{
+		{Hash: [32]byte{1}, Input: []byte{1}},
+		{Hash: [32]byte{2}, Input: []byte{1, 2}},
+	}
+	modbTxs := e.CommittedTxsForMoDB()
+	records := make([]types.Transaction, len(modbTxs))
+	for i := range modbTxs {
+		_, err := records[i].UnmarshalMsg(modbTxs[i].Content)
+		require.NoError(t, err)
+		require.Equal(t, []byte{1}, records[i].Input)
+	}
+	require.Equal(t, [32]byte{}, records[0].InputHash)
+	require.False(t, store.Restore(&records[1]))
+
+	e.storeFullTxData()
+	_, _, ok := store.Get(e.committedTxs[0].Hash)
+	require.False(t, ok)
+	require.True(t, store.Restore(&records[1]))
+	require.Equal(t, []byte{1, 2}, records[1].Input)
+	require.Equal(t, []byte{1, 2}, e.committedTxs[1].Input)
+}
+
+func TestEachCommittedTx(t *testing.T) {
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	for i := 0; i < 3; i++ {
+		e.committedTxs = append(e.committedTxs, &types.Transaction{
+			Hash: common.Hash{byte(i)},
+			Logs: []types.Log{{Address: common.Address{byte(i)}, Topics: [][32]byte{{1}}}},
+		})
+	}
+	modbTxs := e.CommittedTxsForMoDB()
+	n := 0
+	err := e.EachCommittedTx(func(tx *types.Transaction, modbTx modbtypes.Tx) error {
+		require.Same(t, e.committedTxs[n], tx)
+		require.Equal(t, modbTxs[n], modbTx)
+		n++
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	n = 0
+	err = e.EachCommittedTx(func(tx *types.Transaction, modbTx modbtypes.Tx) error {
+		n++
+		return io.EOF
+	})
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, 1, n)
+}
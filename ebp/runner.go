@@ -8,8 +8,11 @@ import (
 	"unsafe"
 
 	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/holiman/uint256"
 
+	"github.com/smartbch/moeingevm/errors"
 	"github.com/smartbch/moeingevm/types"
 	"github.com/smartbch/moeingevm/utils"
 )
@@ -22,11 +25,14 @@ import (
 //                             const evmc_bytes32* value,
 //                             const uint8_t* input_data,
 //                             size_t input_size,
+//                             const struct access_list_entry* access_list,
+//                             size_t access_list_size,
 //                             const struct block_info* block,
 //                             int collector_handler,
 //                             bool need_gas_estimation,
 //                             enum evmc_revision revision,
-//                             bridge_query_executor_fn query_executor_fn);
+//                             bridge_query_executor_fn query_executor_fn,
+//                             bool need_trace);
 import "C"
 
 type (
@@ -41,6 +47,7 @@ type (
 	changed_bytecode         = C.struct_changed_bytecode
 	changed_value            = C.struct_changed_value
 	added_log                = C.struct_added_log
+	access_list_entry        = C.struct_access_list_entry
 	all_changed              = C.struct_all_changed
 	block_info               = C.struct_block_info
 	big_buffer               = C.struct_big_buffer
@@ -51,6 +58,10 @@ const (
 	EnableRWList = false
 )
 
+// These lines fail to compile if types.Revision, whose values are consecutive, does not match evmc_revision
+var _ = [1]struct{}{}[int(types.Petersburg)-int(C.EVMC_PETERSBURG)]
+var _ = [1]struct{}{}[int(types.Shanghai)-int(C.EVMC_SHANGHAI)]
+
 var TotalBCHAmount [32]byte = uint256.NewInt(0).Mul(uint256.NewInt(1e18), uint256.NewInt(2100_0000)).Bytes32()
 
 var PredefinedContractManager map[common.Address]types.SystemContractExecutor
@@ -113,7 +124,7 @@ func getRunner(i int) (runner *TxRunner) {
 		runner.ForRpc = false
 	} else {
 		runner = RpcRunners[i-RpcRunnersIdStart]
-		runner.ForRpc = true
+		runner.ForRpc = !runner.asInBlock
 	}
 	return
 }
@@ -134,6 +145,45 @@ type TxRunner struct {
 	InternalTxReturns []types.InternalTxReturn
 
 	RwLists *types.ReadWriteLists
+
+	// the index in Runners and the hints shared in a round; hints is nil if they are not used
+	hintIdx int
+	hints   *conflictHints
+
+	// record RwLists even if EnableRWList is false, for tracing
+	recordRWList bool
+
+	// run on an RPC slot with the semantics of a block, set by RunTxAsInBlock
+	asInBlock bool
+
+	// nil if the storage quota is not enabled
+	storageQuota *storageQuota
+	// the slots created by the TXs in the group of this tx minus the ones they cleared, by contract sequences,
+	// which is shared by the group and is nil if the storage quota is not enabled
+	slotDeltas map[uint64]int64
+
+	// the rules of the block the tx runs in, which are set by runTxHelper
+	rules types.Rules
+
+	// nil if the tx is not traced
+	tracer Tracer
+
+	// the snapshots and reverts in EVM, which are zero if EVM is not entered
+	Metrics ExecutionMetrics
+}
+
+// ExecutionMetrics counts the snapshots of the state taken in EVM when a tx runs, and the reverts to them. A
+// snapshot is taken when a call frame starts, and the state is reverted to it if the frame fails, which only
+// undoes the changes and logs made by the frame and its sub-frames, not the ones of its parents.
+type ExecutionMetrics struct {
+	Snapshots int
+	Reverts   int
+	// the count of the changes undone by the reverts, including the logs
+	RevertedChanges int
+}
+
+func (runner *TxRunner) rwListEnabled() bool {
+	return EnableRWList || runner.recordRWList
 }
 
 func NewTxRunner(ctx *types.Context, tx *types.TxToRun) *TxRunner {
@@ -188,6 +238,22 @@ func writeCBytes20WithArray(arr *evmc_address, bz [20]byte) {
 	}
 }
 
+// flatten the access list into one entry for each account and one for each storage slot
+func toCAccessList(list gethtypes.AccessList) []access_list_entry {
+	entries := make([]access_list_entry, 0, len(list)+list.StorageKeys())
+	for _, tuple := range list {
+		var entry access_list_entry
+		writeCBytes20WithArray(&entry.addr, tuple.Address)
+		entries = append(entries, entry)
+		entry.is_slot = true
+		for _, key := range tuple.StorageKeys {
+			writeCBytes32WithSlice(&entry.key, key[:])
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
 //Following are some getter/setter functions which provide world state to the C environment and
 //apply the changes made by the C environment to world state.
 
@@ -198,7 +264,7 @@ func (runner *TxRunner) getCreationCounter(lsb uint8) uint64 {
 		return 0
 	}
 	counter := binary.BigEndian.Uint64(v)
-	if EnableRWList {
+	if runner.rwListEnabled() {
 		runner.RwLists.CreationCounterRList = append(runner.RwLists.CreationCounterRList,
 			types.CreationCounterRWOp{Lsb: lsb, Counter: counter})
 	}
@@ -210,7 +276,7 @@ func (runner *TxRunner) changeCreationCounter(chg_counter *changed_creation_coun
 	var buf [8]byte
 	binary.BigEndian.PutUint64(buf[:], uint64(chg_counter.counter))
 	runner.Ctx.Rbt.Set(k, buf[:])
-	if !EnableRWList {
+	if !runner.rwListEnabled() {
 		return
 	}
 	runner.RwLists.CreationCounterWList = append(runner.RwLists.CreationCounterWList,
@@ -227,7 +293,7 @@ func (runner *TxRunner) getAccountInfo(addr_ptr *evmc_address, balance *evmc_byt
 	writeCBytes32WithSlice(balance, acc.BalanceSlice())
 	*nonce = C.uint64_t(binary.BigEndian.Uint64(acc.NonceSlice()))
 	*sequence = C.uint64_t(binary.BigEndian.Uint64(acc.SequenceSlice()))
-	if !EnableRWList {
+	if !runner.rwListEnabled() {
 		return
 	}
 	op := types.AccountRWOp{Account: acc.Bytes(), Addr: addr}
@@ -247,7 +313,10 @@ func (runner *TxRunner) changeAccount(chg_acc *changed_account) {
 		writeSliceWithCBytes32(acc.BalanceSlice(), &chg_acc.balance)
 		runner.Ctx.Rbt.Set(k, acc.Bytes())
 	}
-	if !EnableRWList {
+	if runner.hints != nil {
+		runner.hints.publish(runner.hintIdx, addr)
+	}
+	if !runner.rwListEnabled() {
 		return
 	}
 	if addr == runner.Tx.From {
@@ -270,7 +339,7 @@ func (runner *TxRunner) getBytecode(addr_ptr *evmc_address, codehash_ptr *evmc_b
 		buf.data[i] = C.uint8_t(bs[i])
 	}
 	writeCBytes32WithSlice(codehash_ptr, bi.CodeHashSlice())
-	if !EnableRWList {
+	if !runner.rwListEnabled() {
 		return
 	}
 	op := types.BytecodeRWOp{Bytecode: bi.Bytes(), Addr: addr}
@@ -290,7 +359,7 @@ func (runner *TxRunner) changeBytecode(chg_bytecode *changed_bytecode) {
 		bz = append(bz, C.GoStringN(chg_bytecode.bytecode_data, chg_bytecode.bytecode_size)...)
 		runner.Ctx.Rbt.Set(k, bz)
 	}
-	if !EnableRWList {
+	if !runner.rwListEnabled() {
 		return
 	}
 	op := types.BytecodeRWOp{Bytecode: bz, Addr: addr}
@@ -305,7 +374,7 @@ func (runner *TxRunner) getValue(acc_seq C.uint64_t, key_ptr *C.char, buf *big_b
 	for i := range bs {
 		buf.data[i] = C.uint8_t(bs[i])
 	}
-	if !EnableRWList {
+	if !runner.rwListEnabled() {
 		return
 	}
 	op := types.StorageRWOp{Seq: seq, Key: key, Value: bs}
@@ -323,18 +392,27 @@ func (runner *TxRunner) changeValue(chg_value *changed_value) {
 		bz = C.GoBytes(unsafe.Pointer(chg_value.value_data), chg_value.value_size)
 		runner.Ctx.Rbt.Set(k, bz)
 	}
-	if !EnableRWList {
+	if !runner.rwListEnabled() {
 		return
 	}
 	op := types.StorageRWOp{Seq: seq, Key: key, Value: bz}
 	runner.RwLists.StorageWList = append(runner.RwLists.StorageWList, op)
 }
 
+// Returns the gas used after refund, which can refund no more than gasUsed/refundQuotient
+func capRefund(gasUsed, refund, refundQuotient uint64) uint64 {
+	minGasUsed := gasUsed - gasUsed/refundQuotient
+	if gasUsed < refund+minGasUsed {
+		return minGasUsed
+	}
+	return gasUsed - refund
+}
+
 //hash => height; height => block in db
 func (runner *TxRunner) getBlockHash(num C.uint64_t) (result evmc_bytes32) {
 	hash := runner.Ctx.GetBlockHashByHeight(uint64(num))
 	writeCBytes32WithSlice(&result, hash[:])
-	if !EnableRWList {
+	if !runner.rwListEnabled() {
 		return
 	}
 	op := types.BlockHashOp{Height: uint64(num), Hash: hash}
@@ -344,10 +422,11 @@ func (runner *TxRunner) getBlockHash(num C.uint64_t) (result evmc_bytes32) {
 
 // Refund gas fee to the sender according to the real consumed gas
 func (runner *TxRunner) refundGasFee(ret_value *evmc_result, refund C.uint64_t) {
-	if runner.ForRpc {
+	gasUsed := runner.Tx.Gas - uint64(ret_value.gas_left)
+	if runner.ForRpc { // no gas fee is paid, and the gas used is reported as it is
+		runner.GasUsed = capRefund(gasUsed, uint64(refund), runner.rules.RefundQuotient)
 		return
 	}
-	gasUsed := runner.Tx.Gas - uint64(ret_value.gas_left)
 	if AdjustGasUsed {
 		if gasUsed*4 < runner.Tx.Gas {
 			gasUsed = runner.Tx.Gas
@@ -355,12 +434,7 @@ func (runner *TxRunner) refundGasFee(ret_value *evmc_result, refund C.uint64_t)
 			gasUsed = (runner.Tx.Gas + gasUsed) / 2
 		}
 	}
-	half := (gasUsed + 1) / 2
-	if gasUsed < uint64(refund)+half { // can refund no more than half
-		gasUsed = half
-	} else {
-		gasUsed = gasUsed - uint64(refund)
-	}
+	gasUsed = capRefund(gasUsed, uint64(refund), runner.rules.RefundQuotient)
 
 	k := types.GetAccountKey(runner.Tx.From)
 
@@ -377,7 +451,7 @@ func (runner *TxRunner) refundGasFee(ret_value *evmc_result, refund C.uint64_t)
 	runner.Ctx.Rbt.Set(k, acc.Bytes())
 	runner.FeeRefund = returnedGasFee
 	runner.GasUsed = gasUsed
-	if !EnableRWList {
+	if !runner.rwListEnabled() {
 		return
 	}
 	op := types.AccountRWOp{Account: acc.Bytes(), Addr: runner.Tx.From}
@@ -393,6 +467,15 @@ func (runner *TxRunner) GetGasFee() *uint256.Int {
 		
 }
 
+// The base fee portion of GetGasFee, which is burnt. It is zero for a legacy tx.
+func (runner *TxRunner) GetBurntFee() *uint256.Int {
+	baseFee := uint256.NewInt(0).SetBytes(runner.Tx.BaseFee[:])
+	if baseFee.GtUint64(MaxGasPrice) { // not higher than the effective gas price in GetGasFee
+		baseFee = uint256.NewInt(MaxGasPrice)
+	}
+	return uint256.NewInt(0).Mul(uint256.NewInt(runner.GasUsed), baseFee)
+}
+
 func convertLog(log *added_log) (res types.EvmLog) {
 	if log.topic1 != nil {
 		res.Topics = append(res.Topics, toHash(log.topic1))
@@ -439,20 +522,20 @@ func (runner *TxRunner) collectResult(result *all_changed, ret_value *evmc_resul
 		runner.refundGasFee(ret_value, 0)
 		return
 	}
-	size := int(result.account_num)
+	runner.Metrics = ExecutionMetrics{
+		Snapshots:       int(result.metrics.snapshot_num),
+		Reverts:         int(result.metrics.revert_num),
+		RevertedChanges: int(result.metrics.reverted_change_num),
+	}
+	var accounts []changed_account
+	if size := int(result.account_num); size != 0 {
+		accounts = (*[1 << 30]changed_account)(unsafe.Pointer(result.accounts))[:size:size]
+	}
 	isSane := true
-	if size != 0 {
-		accounts := (*[1 << 30]changed_account)(unsafe.Pointer(result.accounts))[:size:size]
-		for _, elem := range accounts {
-			if !checkBalanceSanity(&elem) {
-				isSane = false
-				break
-			}
-		}
-		if isSane {
-			for _, elem := range accounts {
-				runner.changeAccount(&elem)
-			}
+	for _, elem := range accounts {
+		if !checkBalanceSanity(&elem) {
+			isSane = false
+			break
 		}
 	}
 	if !isSane {
@@ -460,8 +543,26 @@ func (runner *TxRunner) collectResult(result *all_changed, ret_value *evmc_resul
 		runner.refundGasFee(ret_value, 0)
 		return
 	}
+	var values []changed_value
+	if size := int(result.value_num); size != 0 {
+		values = (*[1 << 30]changed_value)(unsafe.Pointer(result.values))[:size:size]
+	}
+	if runner.storageQuota != nil {
+		changes := make([]slotChange, len(values))
+		for i := range values {
+			changes[i] = slotChange{
+				seq:    uint64(values[i].account_seq),
+				key:    C.GoStringN(values[i].key_ptr, 32),
+				exists: values[i].value_size != 0,
+			}
+		}
+		runner.addSlotDeltas(changes)
+	}
+	for _, elem := range accounts {
+		runner.changeAccount(&elem)
+	}
 	runner.OutData = C.GoBytes(unsafe.Pointer(ret_value.output_data), C.int(ret_value.output_size))
-	size = int(result.creation_counter_num)
+	size := int(result.creation_counter_num)
 	if size != 0 {
 		creation_counters := (*[1 << 30]changed_creation_counter)(unsafe.Pointer(result.creation_counters))[:size:size]
 		for _, elem := range creation_counters {
@@ -475,12 +576,8 @@ func (runner *TxRunner) collectResult(result *all_changed, ret_value *evmc_resul
 			runner.changeBytecode(&elem)
 		}
 	}
-	size = int(result.value_num)
-	if size != 0 {
-		values := (*[1 << 30]changed_value)(unsafe.Pointer(result.values))[:size:size]
-		for _, elem := range values {
-			runner.changeValue(&elem)
-		}
+	for _, elem := range values {
+		runner.changeValue(&elem)
 	}
 	size = int(result.log_num)
 	if size != 0 {
@@ -504,10 +601,54 @@ func (runner *TxRunner) collectResult(result *all_changed, ret_value *evmc_resul
 		}
 	}
 	runner.Status = int(ret_value.status_code)
+	if runner.Status == int(C.EVMC_FAILURE) && bool(result.storage_quota_exceeded) {
+		runner.Status = types.STORAGE_QUOTA_EXCEEDED
+	}
 	runner.refundGasFee(ret_value, result.refund)
 	runner.CreatedContractAddress = toAddress(&ret_value.create_address)
 }
 
+// Convert the C structure of a step to Go. The memory is not copied, so it is only valid during OnOpcode.
+func (runner *TxRunner) traceStep(step *C.struct_trace_step) {
+	size := int(step.stack_size)
+	stack := make([]common.Hash, size)
+	if size != 0 {
+		words := (*[1 << 10]evmc_bytes32)(unsafe.Pointer(step.stack))[:size:size]
+		for i := range stack {
+			stack[i] = toHash(&words[i])
+		}
+	}
+	var memory []byte
+	if size := int(step.memory_size); size != 0 {
+		memory = (*[1 << 30]byte)(unsafe.Pointer(step.memory))[:size:size]
+	}
+	runner.tracer.OnOpcode(&OpContext{
+		Pc:      uint64(step.pc),
+		Op:      vm.OpCode(step.opcode),
+		Depth:   int(step.depth),
+		Gas:     int64(step.gas),
+		Refund:  int64(step.refund),
+		Address: toAddress(&step.address),
+		Stack:   stack,
+		Memory:  memory,
+	})
+}
+
+// Read the recipient, such that the read/write list of an aborted runner is a subset of the one it would
+// get by running EVM. Then abort if the sender or the recipient was written by a former runner.
+func (runner *TxRunner) abortedByHints() bool {
+	isCreation := runner.Tx.To == (common.Address{})
+	if !isCreation {
+		runner.Ctx.GetAccount(runner.Tx.To)
+	}
+	if runner.hints.writtenBefore(runner.hintIdx, runner.Tx.From) ||
+		(!isCreation && runner.hints.writtenBefore(runner.hintIdx, runner.Tx.To)) {
+		return true
+	}
+	runner.hints.publish(runner.hintIdx, runner.Tx.From)
+	return false
+}
+
 // Functions below wrap the member functions of TxRunner with pure C function signatures.
 
 //export collect_result
@@ -540,6 +681,23 @@ func get_block_hash(handler C.int, num C.uint64_t) (result evmc_bytes32) {
 	return getRunner(int(handler)).getBlockHash(num)
 }
 
+//export get_storage_quota
+func get_storage_quota(handler C.int, acc_seq C.uint64_t) C.uint64_t {
+	return C.uint64_t(getRunner(int(handler)).getStorageQuota(uint64(acc_seq)))
+}
+
+//export trace_step
+func trace_step(handler C.int, step *C.struct_trace_step) {
+	getRunner(int(handler)).traceStep(step)
+}
+
+//export trace_end
+func trace_end(handler C.int, depth C.int32_t, status_code C.enum_evmc_status_code, gas_left C.int64_t) {
+	if t, ok := getRunner(int(handler)).tracer.(frameEndTracer); ok {
+		t.onFrameEnd(int(depth), int(status_code), int64(gas_left))
+	}
+}
+
 func runTx(idx int, currBlock *types.BlockInfo) {
 	runTxHelper(idx, currBlock, false)
 }
@@ -555,33 +713,54 @@ func RunTxForRpc(currBlock *types.BlockInfo, estimateGas bool, runner *TxRunner)
 	return runTxHelper(idx+RpcRunnersIdStart, currBlock, estimateGas)
 }
 
+// Run a committed tx again as it ran in its block, on an RPC slot: its nonce is checked, and the unused gas fee
+// is refunded to the sender, with the adjusted gas used. The gas fee must have been deducted in the state of
+// runner, which is true for the state before the block, because Prepare runs in the block before.
+func RunTxAsInBlock(currBlock *types.BlockInfo, runner *TxRunner) {
+	runner.asInBlock = true
+	RunTxForRpc(currBlock, false, runner)
+}
+
 //Start the idx-th TxRunner to run the transaction assigned to it beforehand.
 //In this function Go data structures are converted to C data structures and finally
 //call the C entrance function 'zero_depth_call_wrap'.
 func runTxHelper(idx int, currBlock *types.BlockInfo, estimateGas bool) int64 {
 	runner := getRunner(idx)
-	if !runner.ForRpc && runner.Tx.Height+types.TOO_OLD_THRESHOLD < uint64(currBlock.Number) {
+	if runner.tracer != nil {
+		runner.tracer.OnTxStart(runner)
+		defer runner.traceTxEnd()
+	}
+	startHeight := runner.Tx.Height
+	if runner.Tx.NotBefore > startHeight {
+		startHeight = runner.Tx.NotBefore // a scheduled tx gets old since the height it is scheduled at
+	}
+	if !runner.ForRpc && startHeight+types.TOO_OLD_THRESHOLD < uint64(currBlock.Number) {
 		runner.Status = types.IGNORE_TOO_OLD_TX
 		return 0
 	}
 	acc, err := runner.Ctx.CheckNonce(runner.Tx.From, runner.Tx.Nonce)
 	if !runner.ForRpc && err != nil { // For RPC, we do not care about sender and its nonce
-		if err == types.ErrAccountNotExist {
+		if errors.Is(err, errors.ErrAccountNotExist) {
 			runner.Status = types.ACCOUNT_NOT_EXIST
-		} else if err == types.ErrNonceTooLarge {
+		} else if errors.Is(err, errors.ErrNonceTooLarge) {
 			runner.Status = types.TX_NONCE_TOO_LARGE
-		} else if err == types.ErrNonceTooSmall {
+		} else if errors.Is(err, errors.ErrNonceTooSmall) {
 			runner.Status = types.TX_NONCE_TOO_SMALL
 		} else {
 			panic("Unknown Error")
 		}
 		return 0
 	}
+	if runner.hints != nil && runner.abortedByHints() {
+		runner.Status = types.ABORTED_BY_HINTS
+		return 0
+	}
 	if acc != nil {
 		// GasFee was deducted in Prepare(), so here we just increase the nonce
 		acc.UpdateNonce(acc.Nonce() + 1)
 		runner.Ctx.SetAccount(runner.Tx.From, acc)
 	}
+	runner.rules = runner.Ctx.ChainConfig.RulesAt(currBlock.Number)
 	var value, gas_price evmc_bytes32
 	var to, from evmc_address
 	writeCBytes32WithSlice(&value, runner.Tx.Value[:])
@@ -596,8 +775,14 @@ func runTxHelper(idx int, currBlock *types.BlockInfo, estimateGas bool) int64 {
 	bi.gas_limit = C.int64_t(currBlock.GasLimit)
 	bi.cfg.after_xhedge_fork = C.bool(runner.Ctx.IsXHedgeFork())
 	bi.cfg.after_symbolsbch_fork = C.bool(runner.Ctx.IsSymbolSbchFork())
+	bi.cfg.bls_precompiles = C.bool(runner.rules.BLSPrecompiles)
+	bi.cfg.schnorr_precompile = C.bool(runner.rules.SchnorrPrecompile)
+	bi.cfg.bch_spv_precompile = C.bool(runner.rules.BchSpvPrecompile)
+	bi.cfg.random_beacon_precompile = C.bool(runner.rules.RandomBeaconPrecompile)
+	bi.cfg.native_modules = C.bool(runner.rules.NativeModules)
 	writeCBytes32WithSlice(&bi.difficulty, currBlock.Difficulty[:])
 	writeCBytes32WithSlice(&bi.chain_id, currBlock.ChainId[:])
+	writeCBytes32WithSlice(&bi.base_fee, currBlock.BaseFee[:])
 	data_ptr := (*C.uint8_t)(nil)
 	if len(runner.Tx.Data) != 0 {
 		data_ptr = (*C.uint8_t)(unsafe.Pointer(&runner.Tx.Data[0]))
@@ -611,25 +796,58 @@ func runTxHelper(idx int, currBlock *types.BlockInfo, estimateGas bool) int64 {
 		return int64(gasUsed)
 	}
 
+	// the gas of the access list is charged before the EVM is entered, as EIP-2930 specifies. Before Berlin,
+	// nothing is cold, so the list is neither charged nor warmed.
+	var listGas uint64
+	var accessList []access_list_entry
+	if runner.rules.Revision >= types.Berlin {
+		listGas = runner.Tx.AccessListGas()
+		accessList = toCAccessList(runner.Tx.AccessList)
+	}
+	if listGas > runner.Tx.Gas {
+		runner.Status = int(C.EVMC_OUT_OF_GAS)
+		runner.GasUsed = runner.Tx.Gas
+		return int64(listGas)
+	}
+	list_ptr := (*access_list_entry)(nil)
+	if len(accessList) != 0 {
+		list_ptr = &accessList[0]
+	}
 	gasEstimated := C.zero_depth_call_wrap(gas_price,
-		C.int64_t(runner.Tx.Gas),
+		C.int64_t(runner.Tx.Gas-listGas),
 		&to,
 		&from,
 		&value,
 		data_ptr,
 		C.size_t(len(runner.Tx.Data)),
+		list_ptr,
+		C.size_t(len(accessList)),
 		&bi,
 		C.int(idx),
 		C.bool(estimateGas),
-		C.EVMC_ISTANBUL,
-		QueryExecutorFn)
-	return int64(gasEstimated)
+		C.enum_evmc_revision(runner.rules.Revision),
+		QueryExecutorFn,
+		C.bool(runner.tracer != nil))
+	return int64(gasEstimated) + int64(listGas)
 }
 
 func StatusIsFailure(status int) bool {
 	return status != int(C.EVMC_SUCCESS)
 }
 
+func StatusIsRevert(status int) bool {
+	return status == int(C.EVMC_REVERT)
+}
+
+func StatusIsOutOfGas(status int) bool {
+	return status == int(C.EVMC_OUT_OF_GAS)
+}
+
+// Returns true if a state modification is attempted in a static context, including the writes to SEP101 and SEP206
+func StatusIsStaticViolation(status int) bool {
+	return status == int(C.EVMC_STATIC_MODE_VIOLATION)
+}
+
 func StatusToStr(status int) string {
 	switch status {
 	case int(C.EVMC_SUCCESS):
@@ -676,6 +894,20 @@ func StatusToStr(status int) string {
 		return "account-not-exist"
 	case types.TX_NONCE_TOO_SMALL:
 		return "nonce-too-small"
+	case types.ABORTED_BY_HINTS:
+		return "aborted-by-hints"
+	case types.EXECUTION_PANIC:
+		return "execution-panic"
+	case types.TX_TOO_LARGE:
+		return "tx-too-large"
+	case types.STORAGE_QUOTA_EXCEEDED:
+		return "storage-quota-exceeded"
+	case types.EVICTED_FROM_QUEUE:
+		return "evicted-from-queue"
+	case types.EXPIRED_IN_QUEUE:
+		return "expired-in-queue"
+	case types.SENDER_QUEUE_FULL:
+		return "sender-queue-full"
 	}
 	return "unknown"
 }
@@ -0,0 +1,154 @@
+package ebp
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync/atomic"
+
+	dt "github.com/smartbch/moeingads/datatree"
+	"github.com/smartbch/moeingads/store/rabbit"
+)
+
+// rwList records the short keys read and written by a TX. The lists are sorted, such that they do not
+// depend on the iteration order of the RabbitStore's cache, which is a Go map. And all the checks
+// against touchedSet are order-insensitive: a TX conflicts as long as any of its keys is touched.
+type rwList struct {
+	rList []uint64
+	wList []uint64
+}
+
+func newRWList() rwList {
+	return rwList{
+		rList: make([]uint64, 0, 32),
+		wList: make([]uint64, 0, 32),
+	}
+}
+
+func (rwl *rwList) add(k uint64, isWrite bool) {
+	if isWrite {
+		rwl.wList = append(rwl.wList, k)
+	} else {
+		rwl.rList = append(rwl.rList, k)
+	}
+}
+
+// collect all the short keys cached in rbt, in ascending order
+func (rwl *rwList) collect(rbt *rabbit.RabbitStore) {
+	rbt.ScanAllShortKeys(func(key [rabbit.KeySize]byte, dirty bool) (stop bool) {
+		rwl.add(binary.LittleEndian.Uint64(key[:]), dirty)
+		return false
+	})
+	sortUint64s(rwl.rList)
+	sortUint64s(rwl.wList)
+}
+
+func sortUint64s(l []uint64) {
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+}
+
+func (rwl rwList) conflictsWith(touchedSet map[uint64]struct{}) bool {
+	for _, l := range [2][]uint64{rwl.rList, rwl.wList} {
+		for _, k := range l {
+			if _, ok := touchedSet[k]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (rwl rwList) updateTouchedSet(touchedSet map[uint64]struct{}) {
+	for _, k := range rwl.wList {
+		touchedSet[k] = struct{}{}
+	}
+}
+
+func hasAnyKey(touchedSet map[uint64]struct{}, keys []uint64) bool {
+	for _, k := range keys {
+		if _, ok := touchedSet[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func addKeys(touchedSet map[uint64]struct{}, keys []uint64) {
+	for _, k := range keys {
+		touchedSet[k] = struct{}{}
+	}
+}
+
+// The short keys are split into so many ranges by their highest bits, which are searched in parallel
+const rwPartitionBits = 4
+
+// contestedKeys are the keys of a group shared with the other groups of the round. A group can only conflict
+// with the committed groups before it on its in-keys, and later groups can only conflict with it on its
+// out-keys, so the merge only needs to track them, which are few if the groups rarely conflict.
+type contestedKeys struct {
+	in  []uint64 // the keys read or written by the group which are written by an earlier group
+	out []uint64 // the keys written by the group which are read or written by a later group
+}
+
+// Returns the keys of l in the p-th partition, which is a continuous range since l is sorted
+func partitionOf(l []uint64, p uint64) []uint64 {
+	start := sort.Search(len(l), func(i int) bool { return l[i]>>(64-rwPartitionBits) >= p })
+	end := sort.Search(len(l), func(i int) bool { return l[i]>>(64-rwPartitionBits) > p })
+	return l[start:end]
+}
+
+// Find the contested keys of the groups with rwLists. The partitions of the key space are searched in
+// parallel, and the results are concatenated in the order of partitions, so they are deterministic.
+func findContestedKeys(rwLists []rwList, parallelNum int) []contestedKeys {
+	parts := make([][]contestedKeys, 1<<rwPartitionBits)
+	sharedIdx := int64(-1)
+	dt.ParallelRun(parallelNum, func(_ int) {
+		for {
+			p := atomic.AddInt64(&sharedIdx, 1)
+			if p >= int64(len(parts)) {
+				return
+			}
+			parts[p] = findContestedKeysIn(rwLists, uint64(p))
+		}
+	})
+	result := make([]contestedKeys, len(rwLists))
+	for _, part := range parts {
+		for g := range result {
+			result[g].in = append(result[g].in, part[g].in...)
+			result[g].out = append(result[g].out, part[g].out...)
+		}
+	}
+	return result
+}
+
+func findContestedKeysIn(rwLists []rwList, p uint64) []contestedKeys {
+	result := make([]contestedKeys, len(rwLists))
+	writtenBefore := make(map[uint64]struct{})
+	for g, rwl := range rwLists {
+		wList := partitionOf(rwl.wList, p)
+		for _, l := range [2][]uint64{partitionOf(rwl.rList, p), wList} {
+			for _, k := range l {
+				if _, ok := writtenBefore[k]; ok {
+					result[g].in = append(result[g].in, k)
+				}
+			}
+		}
+		for _, k := range wList {
+			writtenBefore[k] = struct{}{}
+		}
+	}
+	accessedAfter := make(map[uint64]struct{})
+	for g := len(rwLists) - 1; g >= 0; g-- {
+		rList, wList := partitionOf(rwLists[g].rList, p), partitionOf(rwLists[g].wList, p)
+		for _, k := range wList {
+			if _, ok := accessedAfter[k]; ok {
+				result[g].out = append(result[g].out, k)
+			}
+		}
+		for _, l := range [2][]uint64{rList, wList} {
+			for _, k := range l {
+				accessedAfter[k] = struct{}{}
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,139 @@
+package ebp
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/smartbch/moeingads/store"
+	"github.com/smartbch/moeingads/store/rabbit"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestRWListCollectIsSorted(t *testing.T) {
+	root := store.NewMockRootStore()
+	keys := make([][]byte, 50)
+	for i := range keys {
+		keys[i] = []byte{byte(i), 1, 2, 3}
+	}
+	var lists []rwList
+	for _, reversed := range []bool{false, true} {
+		rbt := rabbit.NewRabbitStore(root)
+		for i := range keys {
+			k := keys[i]
+			if reversed {
+				k = keys[len(keys)-1-i]
+			}
+			if k[0]%2 == 0 {
+				rbt.Set(k, []byte{1})
+			} else {
+				rbt.Get(k)
+			}
+		}
+		rwl := newRWList()
+		rwl.collect(&rbt)
+		rbt.Close()
+		require.True(t, sort.SliceIsSorted(rwl.rList, func(i, j int) bool { return rwl.rList[i] < rwl.rList[j] }))
+		require.True(t, sort.SliceIsSorted(rwl.wList, func(i, j int) bool { return rwl.wList[i] < rwl.wList[j] }))
+		lists = append(lists, rwl)
+	}
+	require.Equal(t, 25, len(lists[0].wList))
+	require.Equal(t, lists[0], lists[1])
+}
+
+func TestRWListConflicts(t *testing.T) {
+	touchedSet := make(map[uint64]struct{})
+	rwl := rwList{rList: []uint64{1, 2}, wList: []uint64{3, 4}}
+	require.False(t, rwl.conflictsWith(touchedSet))
+	rwl.updateTouchedSet(touchedSet)
+	require.Equal(t, 2, len(touchedSet))
+	require.True(t, rwList{rList: []uint64{9, 4}}.conflictsWith(touchedSet))
+	require.True(t, rwList{wList: []uint64{3, 9}}.conflictsWith(touchedSet))
+	require.False(t, rwList{rList: []uint64{1, 2}, wList: []uint64{9}}.conflictsWith(touchedSet))
+}
+
+func TestParallelCollectRWLists(t *testing.T) {
+	root := store.NewMockRootStore()
+	Runners = make([]*TxRunner, 20)
+	for i := range Runners {
+		rbt := rabbit.NewRabbitStore(root)
+		for j := 0; j <= i; j++ {
+			rbt.Set([]byte{byte(i), byte(j)}, []byte{1})
+			rbt.Get([]byte{byte(j), byte(i), 0})
+		}
+		Runners[i] = NewTxRunner(types.NewContext(&rbt, nil), nil)
+	}
+	serial := make([]rwList, len(Runners))
+	for i, runner := range Runners {
+		serial[i] = newRWList()
+		serial[i].collect(runner.Ctx.Rbt)
+	}
+	groups := (&txEngine{}).groupTxBundle(make([]types.TxToRun, len(Runners)))
+	for _, parallelNum := range []int{1, 3, 8} {
+		e := &txEngine{parallelNum: parallelNum}
+		require.Equal(t, serial, e.parallelCollectRWLists(groups))
+	}
+	for _, runner := range Runners {
+		runner.Ctx.Close(false)
+	}
+	Runners = nil
+}
+
+func TestFindContestedKeys(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randList := func() []uint64 {
+		set := make(map[uint64]struct{})
+		for i := r.Intn(20); i > 0; i-- {
+			// few distinct low bits make collisions frequent, and the high bits spread the keys to partitions
+			set[uint64(r.Intn(16))<<60|uint64(r.Intn(8))] = struct{}{}
+		}
+		l := make([]uint64, 0, len(set))
+		for k := range set {
+			l = append(l, k)
+		}
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+		return l
+	}
+	rwLists := make([]rwList, 30)
+	for i := range rwLists {
+		rwLists[i] = rwList{rList: randList(), wList: randList()}
+	}
+	contested := findContestedKeys(rwLists, 4)
+	has := func(l []uint64, k uint64) bool {
+		for _, x := range l {
+			if x == k {
+				return true
+			}
+		}
+		return false
+	}
+	for g, rwl := range rwLists {
+		var in, out []uint64
+		for _, l := range [2][]uint64{rwl.rList, rwl.wList} {
+			for _, k := range l {
+				for h := 0; h < g; h++ {
+					if has(rwLists[h].wList, k) {
+						in = append(in, k)
+						break
+					}
+				}
+			}
+		}
+		for _, k := range rwl.wList {
+			for h := g + 1; h < len(rwLists); h++ {
+				if has(rwLists[h].rList, k) || has(rwLists[h].wList, k) {
+					out = append(out, k)
+					break
+				}
+			}
+		}
+		sort.Slice(in, func(i, j int) bool { return in[i] < in[j] })
+		var gotIn []uint64
+		gotIn = append(gotIn, contested[g].in...)
+		sort.Slice(gotIn, func(i, j int) bool { return gotIn[i] < gotIn[j] })
+		require.Equal(t, in, gotIn)
+		require.Equal(t, out, contested[g].out)
+	}
+}
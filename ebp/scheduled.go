@@ -0,0 +1,170 @@
+package ebp
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	storetypes "github.com/smartbch/moeingads/store/types"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// scheduledQueue keeps the TXs collected by CollectScheduledTx which are not due in the next block. They are
+// stored at [start, end) like the TXs in standby queue, and the positions of the TXs scheduled at a height are
+// stored at the key of the height. The TXs scheduled at nextHeight and later ones are not moved to standby
+// queue yet, so they are neither loaded nor rewritten in the rounds of a block before their heights.
+type scheduledQueue struct {
+	start, end uint64
+	nextHeight uint64
+}
+
+func (exec *txEngine) getScheduledQueue() (q scheduledQueue) {
+	ctx := exec.readCtx()
+	defer ctx.Close(false)
+	bz := ctx.Rbt.GetBaseStore().Get(types.ScheduledTxQueueKey[:])
+	if bz == nil {
+		return
+	}
+	if len(bz) != 24 {
+		panic(fmt.Errorf("%w: the scheduled queue has %d bytes", errors.ErrQueueCorrupted, len(bz)))
+	}
+	q.start = binary.BigEndian.Uint64(bz[:8])
+	q.end = binary.BigEndian.Uint64(bz[8:16])
+	q.nextHeight = binary.BigEndian.Uint64(bz[16:])
+	return
+}
+
+func (q *scheduledQueue) toBytes() []byte {
+	bz := make([]byte, 24)
+	binary.BigEndian.PutUint64(bz[:8], q.start)
+	binary.BigEndian.PutUint64(bz[8:16], q.end)
+	binary.BigEndian.PutUint64(bz[16:], q.nextHeight)
+	return bz
+}
+
+// Returns whether tx, which is prepared now, must wait in the scheduled queue instead of standby queue
+func (exec *txEngine) isScheduledLater(tx *types.TxToRun) bool {
+	return tx.NotBefore > exec.getCurrHeight()+1
+}
+
+// Insert the valid TXs in infoList which are scheduled later than the next block into the scheduled queue,
+// in the order of infoList
+func (exec *txEngine) insertToScheduledTxQ(trunk storetypes.BaseStoreI, infoList []*preparedInfo) {
+	var q scheduledQueue
+	var positions map[uint64][]byte // height => the positions of the TXs scheduled at it
+	var heights []uint64            // the keys of positions, in the order they are first used
+	for _, info := range infoList {
+		if len(info.errorStr) != 0 || !info.scheduled {
+			continue
+		}
+		if positions == nil {
+			q = exec.getScheduledQueue()
+			if q.start == q.end {
+				q.nextHeight = exec.getCurrHeight() + 2 // the TXs scheduled at earlier heights are not delayed
+			}
+			positions = make(map[uint64][]byte)
+		}
+		height := info.tx.NotBefore
+		if _, ok := positions[height]; !ok {
+			positions[height] = append([]byte{}, trunk.Get(types.GetScheduledHeightKey(height))...)
+			heights = append(heights, height)
+		}
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], q.end)
+		positions[height] = append(positions[height], buf[:]...)
+		info.scheduledPos = q.end
+		q.end++
+	}
+	if positions == nil {
+		return
+	}
+	trunk.Update(func(store storetypes.SetDeleter) {
+		for _, info := range infoList {
+			if len(info.errorStr) == 0 && info.scheduled {
+				k := types.GetScheduledTxKey(info.scheduledPos)
+				store.Set(k, info.txBytes)
+				exec.indexQueuedTx(store, info.tx.HashID, k)
+			}
+		}
+		for _, height := range heights {
+			store.Set(types.GetScheduledHeightKey(height), positions[height])
+		}
+		store.Set(types.ScheduledTxQueueKey[:], q.toBytes())
+	})
+}
+
+// Move the TXs scheduled at or before height to the end of standby queue, in the order of their heights and
+// then the order they were scheduled, and return them. The heights are checked one by one since the last
+// call, so the cost is linear to the count of blocks and the moved TXs, instead of the length of the queue.
+func (exec *txEngine) moveDueScheduledTxs(height uint64) (moved []types.TxToRun) {
+	q := exec.getScheduledQueue()
+	if q.start == q.end || q.nextHeight > height {
+		return nil
+	}
+	trunk := exec.cleanCtx.Rbt.GetBaseStore()
+	var dueKeys, txKeys, txBytes [][]byte
+	for ; q.nextHeight <= height; q.nextHeight++ {
+		heightKey := types.GetScheduledHeightKey(q.nextHeight)
+		positions := trunk.Get(heightKey)
+		if positions == nil {
+			continue
+		}
+		dueKeys = append(dueKeys, heightKey)
+		for i := 0; i+8 <= len(positions); i += 8 {
+			k := types.GetScheduledTxKey(binary.BigEndian.Uint64(positions[i:]))
+			bz := trunk.Get(k)
+			var tx types.TxToRun
+			tx.FromBytes(bz)
+			moved = append(moved, tx)
+			txKeys = append(txKeys, k)
+			txBytes = append(txBytes, bz)
+		}
+	}
+	start, end := exec.getStandbyQueueRange()
+	trunk.Update(func(store storetypes.SetDeleter) {
+		for i, k := range txKeys {
+			newK := types.GetStandbyTxKey(end)
+			store.Set(newK, txBytes[i])
+			store.Delete(k)
+			exec.indexQueuedTx(store, moved[i].HashID, newK)
+			end++
+		}
+		for _, k := range dueKeys {
+			store.Delete(k)
+		}
+	})
+	for q.start < q.end && trunk.Get(types.GetScheduledTxKey(q.start)) == nil {
+		q.start++ // skip the moved TXs at the head, the ones after a waiting tx are skipped later
+	}
+	trunk.Update(func(store storetypes.SetDeleter) {
+		store.Set(types.ScheduledTxQueueKey[:], q.toBytes())
+	})
+	exec.setStandbyQueueRange(start, end)
+	return moved
+}
+
+// Call fn for each tx waiting in the scheduled queue, in the order they were scheduled. The queue is scanned,
+// so the cost is linear to its length.
+func (exec *txEngine) scanScheduledTxs(ctx *types.Context, fn func(tx *types.TxToRun)) {
+	q := exec.getScheduledQueue()
+	for i := q.start; i < q.end; i++ {
+		bz := ctx.Rbt.GetBaseStore().Get(types.GetScheduledTxKey(i))
+		if bz == nil {
+			continue // it was moved to standby queue
+		}
+		var tx types.TxToRun
+		tx.FromBytes(bz)
+		fn(&tx)
+	}
+}
+
+// ScheduledQLen returns the count of the TXs waiting in the scheduled queue. Like StandbyQLen, it must be
+// called after SetContext.
+func (exec *txEngine) ScheduledQLen() int {
+	ctx := exec.readCtx()
+	defer ctx.Close(false)
+	count := 0
+	exec.scanScheduledTxs(ctx, func(*types.TxToRun) { count++ })
+	return count
+}
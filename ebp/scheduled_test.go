@@ -0,0 +1,99 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestScheduledTx(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, _ := prepareEngine(trunk)
+	scheduled, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	tx, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from2.Bytes())
+	e.CollectScheduledTx(scheduled, 3)
+	e.CollectTx(tx)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	for height := int64(1); height < 3; height++ {
+		e.SetContext(prepareCtx(trunk))
+		e.Execute(&types.BlockInfo{Number: height})
+		require.Equal(t, 0, e.StandbyQLen())
+		require.Equal(t, 1, e.ScheduledQLen())
+		if height == 1 {
+			require.Equal(t, 1, len(e.committedTxs))
+			require.Equal(t, tx.Hash(), common.Hash(e.committedTxs[0].Hash))
+		} else {
+			require.Equal(t, 0, len(e.committedTxs))
+		}
+		e.SetContext(prepareCtx(trunk))
+		e.Prepare(0, 0, DefaultTxGasLimit)
+	}
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 3})
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, scheduled.Hash(), common.Hash(e.committedTxs[0].Hash))
+	require.Equal(t, uint64(1), e.committedTxs[0].Status)
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, 0, e.StandbyQLen())
+	require.Equal(t, 0, e.ScheduledQLen())
+	require.Equal(t, uint64(1), e.cleanCtx.GetAccount(from1).Nonce())
+	e.cleanCtx.Close(false)
+}
+
+func TestScheduledTxsNotIgnored(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	// with one runner, at most two TXs are ignored in a round
+	e := NewEbpTxExec(1, 1, 1, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetDropDuplicateTxs(true)
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+	e.SetContext(prepareCtx(trunk))
+	var scheduled []*gethtypes.Transaction
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		tx, _ := gethtypes.NewTransaction(nonce, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+		e.CollectScheduledTx(tx, 5)
+		scheduled = append(scheduled, tx)
+	}
+	tx, _ := gethtypes.NewTransaction(0, to2, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from2.Bytes())
+	e.CollectTx(tx)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 1})
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, tx.Hash(), common.Hash(e.committedTxs[0].Hash))
+	require.Equal(t, 3, e.ScheduledQLen())
+
+	// the scheduled TXs collected again are dropped
+	e.SetContext(prepareCtx(trunk))
+	e.CollectScheduledTx(scheduled[0], 5)
+	e.CollectTx(scheduled[1])
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	require.Equal(t, 0, e.StandbyQLen())
+	require.Equal(t, 3, e.ScheduledQLen())
+	for height := int64(2); height <= 7; height++ {
+		e.SetContext(prepareCtx(trunk))
+		e.Execute(&types.BlockInfo{Number: height})
+		if height < 5 {
+			require.Equal(t, 0, len(e.committedTxs))
+		} else { // one tx in each block, because there is one runner and one round
+			require.Equal(t, 1, len(e.committedTxs))
+			require.Equal(t, scheduled[height-5].Hash(), common.Hash(e.committedTxs[0].Hash))
+			require.Equal(t, uint64(1), e.committedTxs[0].Status)
+		}
+		e.SetContext(prepareCtx(trunk))
+		e.Prepare(0, 0, DefaultTxGasLimit)
+	}
+	require.Equal(t, 0, e.StandbyQLen())
+	require.Equal(t, 0, e.ScheduledQLen())
+}
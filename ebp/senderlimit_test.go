@@ -0,0 +1,53 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+/*
+testcase:
+each sender can have 2 TXs in the standby queue
+account1 send txs(nonce): 0, 1, 2, and the one with nonce 2 is rejected
+account2 send txs(nonce): 0
+account1 send txs(nonce): 2 again in the next block, which is still rejected
+*/
+func TestTxEngine_MaxQueuedTxsPerSender(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareEngine(trunk)
+	e.SetMaxQueuedTxsPerSender(2)
+	var excess *gethtypes.Transaction
+	for nonce := uint64(1); nonce <= 2; nonce++ {
+		tx, _ := gethtypes.NewTransaction(nonce, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+		txs = append(txs, tx)
+		excess = tx
+	}
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, 3, e.StandbyQLen())
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, excess.Hash(), common.Hash(e.committedTxs[0].Hash))
+	require.Equal(t, StatusToStr(types.SENDER_QUEUE_FULL), e.committedTxs[0].StatusStr)
+	require.Equal(t, uint64(10000_0000_0000-2*100000), e.cleanCtx.GetAccount(from1).Balance().Uint64())
+	e.cleanCtx.Close(false)
+
+	e.SetContext(prepareCtx(trunk))
+	e.committedTxs = e.committedTxs[:0]
+	e.CollectTx(excess)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, 3, e.StandbyQLen())
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, StatusToStr(types.SENDER_QUEUE_FULL), e.committedTxs[0].StatusStr)
+	e.cleanCtx.Close(false)
+}
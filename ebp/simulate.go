@@ -0,0 +1,82 @@
+package ebp
+
+import (
+	"github.com/holiman/uint256"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// BlockSimulation is the result of SimulateNextBlock
+type BlockSimulation struct {
+	// the TXs which would be committed, in the order of the block
+	CommittedTxs []*types.Transaction
+	GasUsed      uint64
+	// the gas fees paid to the proposer, without the burnt base fees
+	Revenue  uint256.Int
+	BurntFee uint256.Int
+	// the count of the TXs left in the standby queue after the block
+	StandbyQLen int
+	Results     BlockResults
+}
+
+// SimulateNextBlock runs the TXs in the standby queue as Execute does, with the consensus parameters of this
+// engine, and returns which TXs would be committed in the block and the revenue of its proposer. The updates
+// are kept in memory and discarded, so the world state and the standby queue are not changed. Like Execute, it
+// must be called after SetContext, and it must not be called during Prepare or Execute, because they share the
+// runners. currBlock is not changed, and the base fee is filled as Execute does.
+func (exec *txEngine) SimulateNextBlock(currBlock *types.BlockInfo) *BlockSimulation {
+	overlay := types.NewOverlayBaseStore(exec.cleanCtx.Rbt.GetBaseStore())
+	ctx := exec.cleanCtx.WithOverlayRbtCopy(overlay)
+	defer ctx.Close(false)
+	sim := exec.simulationEngine(ctx)
+	blk := *currBlock
+	sim.Execute(&blk)
+	gasUsed, _, revenue := sim.GasUsedInfo()
+	results := sim.BlockResults()
+	return &BlockSimulation{
+		CommittedTxs: sim.CommittedTxs(),
+		GasUsed:      gasUsed,
+		Revenue:      revenue,
+		BurntFee:     results.BurntFee,
+		StandbyQLen:  sim.StandbyQLen(),
+		Results:      results,
+	}
+}
+
+// Returns an engine with the consensus parameters of exec, which works on ctx. The per-node stores and hooks
+// are not copied, such that nothing is recorded by the simulation.
+func (exec *txEngine) simulationEngine(ctx *types.Context) *txEngine {
+	return &txEngine{
+		roundNum:           exec.roundNum,
+		runnerNumber:       exec.runnerNumber,
+		parallelNum:        exec.parallelNum,
+		cleanCtx:           ctx,
+		signer:             exec.signer,
+		checkRWInLoading:   exec.checkRWInLoading,
+		earlyConflictHints: exec.earlyConflictHints,
+		accountAffinity:    exec.accountAffinity,
+		senderSharding:     exec.senderSharding,
+		deferLaterNonces:   exec.deferLaterNonces,
+		accessLists:        exec.accessLists,
+		dropDuplicates:     exec.dropDuplicates,
+		maxRetries:         exec.maxRetries,
+		dagScheduling:      exec.dagScheduling,
+		blockGasLimit:      exec.blockGasLimit,
+		replaceByFeeBump:   exec.replaceByFeeBump,
+		maxQueueLen:        exec.maxQueueLen,
+		maxTxsPerSender:    exec.maxTxsPerSender,
+		queueTTL:           exec.queueTTL,
+		maxStorageSlots:    exec.maxStorageSlots,
+		quotaExempt:        exec.quotaExempt,
+		orderingAlgorithm:  exec.orderingAlgorithm,
+		orderingForks:      exec.orderingForks,
+		preparedOrdering:   exec.preparedOrdering,
+		maxTxSize:          exec.maxTxSize,
+		maxOutDataSize:     exec.maxOutDataSize,
+		endBlockHooks:      exec.endBlockHooks, // they change the state, which is discarded with ctx
+		compressThreshold:  exec.compressThreshold,
+		gasTarget:          exec.gasTarget,
+		logger:             log.NewNopLogger(),
+	}
+}
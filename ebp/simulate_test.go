@@ -0,0 +1,45 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestTxEngine_SimulateNextBlock(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareEngine(trunk)
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	blk := &types.BlockInfo{Number: 1}
+	sim := e.SimulateNextBlock(blk)
+	require.Equal(t, 2, len(sim.CommittedTxs))
+	require.Equal(t, 0, sim.StandbyQLen)
+	require.Equal(t, [32]byte{}, blk.BaseFee)
+
+	// nothing is changed by the simulation
+	require.Equal(t, 2, e.StandbyQLen())
+	require.Equal(t, 0, len(e.committedTxs))
+	require.Nil(t, e.cleanCtx.GetAccount(*txs[0].To()))
+
+	e.Execute(blk)
+	gasUsed, _, revenue := e.GasUsedInfo()
+	require.Equal(t, gasUsed, sim.GasUsed)
+	require.Equal(t, revenue, sim.Revenue)
+	require.Equal(t, e.CommittedTxIds(), txHashes(sim.CommittedTxs))
+	e.cleanCtx.Close(false)
+}
+
+func txHashes(txs []*types.Transaction) [][32]byte {
+	res := make([][32]byte, len(txs))
+	for i, tx := range txs {
+		res[i] = tx.Hash
+	}
+	return res
+}
@@ -0,0 +1,53 @@
+package ebp
+
+// The names of the spans started by the engine
+const (
+	SpanPrepare        = "Prepare"
+	SpanReadAccounts   = "parallelReadAccounts"
+	SpanExecute        = "Execute"
+	SpanRound          = "round"
+	SpanRunTxs         = "runTxInParallel"
+	SpanCheckConflicts = "checkConflicts"
+	SpanWriteBack      = "writeBack"
+	SpanEndBlockHooks  = "endBlockHooks"
+)
+
+// SpanTracer starts the spans around the phases of Prepare and Execute, such that the operators can see where
+// the block time goes. It is a per-node option, and can be backed by OpenTelemetry with a thin adapter, whose
+// StartSpan calls Tracer.Start and whose SetAttribute calls span.SetAttributes(attribute.Int64(key, value)).
+//
+// The spans are started and ended by the goroutine calling Prepare or Execute, in a stack order, so an adapter
+// can make each span a child of the last unfinished one. The span of a parallel phase ends after all of its
+// goroutines finish. The engine measures the wall-clock times of the spans in Execute only for BlockExecStats,
+// and they never affect consensus, so the implementation measures the timings it reports by itself.
+type SpanTracer interface {
+	StartSpan(name string) Span
+}
+
+// Span is a phase of Prepare or Execute, with the tx counts and the like attached as integer attributes
+type Span interface {
+	SetAttribute(key string, value int64)
+	End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value int64) {}
+func (noopSpan) End()                                 {}
+
+// Trace the phases of Prepare and Execute with t. Nil disables the tracing.
+func (exec *txEngine) SetSpanTracer(t SpanTracer) {
+	exec.spanTracer = t
+}
+
+// The spans in Execute are also timed for BlockExecStats
+func (exec *txEngine) startSpan(name string) Span {
+	var span Span = noopSpan{}
+	if exec.spanTracer != nil {
+		span = exec.spanTracer.StartSpan(name)
+	}
+	if exec.execStats != nil {
+		span = exec.execStats.timeSpan(name, span)
+	}
+	return span
+}
@@ -0,0 +1,107 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+type recordedSpan struct {
+	name   string
+	parent string
+	attrs  map[string]int64
+	ended  bool
+}
+
+// records the spans and nests each one under the last unfinished one, as an OpenTelemetry adapter would
+type recordingSpanTracer struct {
+	spans []*recordedSpan
+	stack []*recordedSpan
+}
+
+func (t *recordingSpanTracer) StartSpan(name string) Span {
+	s := &recordedSpan{name: name, attrs: make(map[string]int64)}
+	if len(t.stack) != 0 {
+		s.parent = t.stack[len(t.stack)-1].name
+	}
+	t.spans = append(t.spans, s)
+	t.stack = append(t.stack, s)
+	return &recordingSpan{s: s, t: t}
+}
+
+type recordingSpan struct {
+	s *recordedSpan
+	t *recordingSpanTracer
+}
+
+func (s *recordingSpan) SetAttribute(key string, value int64) {
+	s.s.attrs[key] = value
+}
+
+func (s *recordingSpan) End() {
+	if s.t.stack[len(s.t.stack)-1] != s.s {
+		panic("the spans are not ended in the stack order")
+	}
+	s.s.ended = true
+	s.t.stack = s.t.stack[:len(s.t.stack)-1]
+}
+
+func (t *recordingSpanTracer) find(name string) []*recordedSpan {
+	var res []*recordedSpan
+	for _, s := range t.spans {
+		if s.name == name {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func TestSpanTracer(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	tracer := &recordingSpanTracer{}
+	e.SetSpanTracer(tracer)
+	e.SetContext(prepareCtx(trunk))
+	txs := prepareAccAndTx(e)
+	e.SetContext(prepareCtx(trunk))
+	e.CollectTx(txs[0])
+	e.CollectTx(txs[1])
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 3})
+	require.Equal(t, 2, len(e.committedTxs))
+	e.cleanCtx.Close(false)
+
+	require.Empty(t, tracer.stack)
+	for _, s := range tracer.spans {
+		require.True(t, s.ended, s.name)
+	}
+	prepare := tracer.find(SpanPrepare)
+	require.Len(t, prepare, 1)
+	require.Equal(t, int64(2), prepare[0].attrs["txs"])
+	read := tracer.find(SpanReadAccounts)
+	require.Len(t, read, 1)
+	require.Equal(t, SpanPrepare, read[0].parent)
+
+	execute := tracer.find(SpanExecute)
+	require.Len(t, execute, 1)
+	require.Equal(t, int64(3), execute[0].attrs["height"])
+	require.Equal(t, int64(2), execute[0].attrs["committed"])
+	rounds := tracer.find(SpanRound)
+	require.Len(t, rounds, 1)
+	require.Equal(t, SpanExecute, rounds[0].parent)
+	require.Equal(t, int64(2), rounds[0].attrs["txs"])
+	for _, name := range []string{SpanRunTxs, SpanCheckConflicts, SpanWriteBack} {
+		spans := tracer.find(name)
+		require.Len(t, spans, 1, name)
+		require.Equal(t, SpanRound, spans[0].parent, name)
+	}
+	require.Equal(t, int64(2), tracer.find(SpanRunTxs)[0].attrs["txs"])
+	require.Equal(t, int64(0), tracer.find(SpanCheckConflicts)[0].attrs["conflicting"])
+}
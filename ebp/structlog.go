@@ -0,0 +1,221 @@
+package ebp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// The tracer logging every instruction executed by a tx, whose output is the same as geth's struct logger
+// used by debug_traceTransaction
+const StructLoggerTracer = "structLogger"
+
+func init() {
+	RegisterTxTracer(StructLoggerTracer, structLoggerTracer)
+}
+
+type StructLogConfig struct {
+	EnableMemory   bool `json:"enableMemory"`
+	DisableStack   bool `json:"disableStack"`
+	DisableStorage bool `json:"disableStorage"`
+	Limit          int  `json:"limit"` // the maximum number of logged steps, zero means no limit
+}
+
+// StructLog is the state of the EVM before an instruction is executed. GasCost is the gas consumed until
+// the next instruction of the same call frame, so for CALL and CREATE it includes the gas used by the callee.
+type StructLog struct {
+	Pc      uint64             `json:"pc"`
+	Op      string             `json:"op"`
+	Gas     uint64             `json:"gas"`
+	GasCost uint64             `json:"gasCost"`
+	Depth   int                `json:"depth"` // starts from 1, as in geth
+	Error   string             `json:"error,omitempty"`
+	Stack   *[]string          `json:"stack,omitempty"`
+	Memory  *[]string          `json:"memory,omitempty"`
+	Storage *map[string]string `json:"storage,omitempty"`
+	Refund  uint64             `json:"refund,omitempty"`
+}
+
+type StructLogResult struct {
+	Gas         uint64      `json:"gas"`
+	Failed      bool        `json:"failed"`
+	ReturnValue string      `json:"returnValue"`
+	StructLogs  []StructLog `json:"structLogs"`
+}
+
+// StructLogger is a Tracer collecting the StructLogs of a tx
+type StructLogger struct {
+	cfg     StructLogConfig
+	logs    []StructLog
+	frames  []structLogFrame // the call frames running code, indexed by depth
+	storage map[common.Address]map[common.Hash]common.Hash
+}
+
+type structLogFrame struct {
+	address  common.Address
+	last     int         // the index of the last logged step of this frame, -1 if there is none
+	sloadKey common.Hash // the key of the last step, if it is SLOAD
+}
+
+func NewStructLogger(cfg *StructLogConfig) *StructLogger {
+	return &StructLogger{
+		cfg:     *cfg,
+		logs:    []StructLog{},
+		storage: make(map[common.Address]map[common.Hash]common.Hash),
+	}
+}
+
+func (l *StructLogger) OnTxStart(_ *TxRunner) {}
+
+func (l *StructLogger) OnCallEnter(_ *types.InternalTxCall) {}
+
+func (l *StructLogger) OnCallExit(_ *types.InternalTxCall, _ *types.InternalTxReturn) {}
+
+func (l *StructLogger) OnTxEnd(_ *TxRunner) {}
+
+func (l *StructLogger) OnOpcode(step *OpContext) {
+	if step.Depth == len(l.frames) {
+		l.frames = append(l.frames, structLogFrame{address: step.Address, last: -1})
+	}
+	frame := &l.frames[step.Depth]
+	if frame.last >= 0 {
+		l.finishStep(frame, step.Gas, step.Stack)
+	}
+	if l.cfg.Limit > 0 && len(l.logs) >= l.cfg.Limit {
+		frame.last = -1
+		return
+	}
+	log := StructLog{
+		Pc:     step.Pc,
+		Op:     step.Op.String(),
+		Gas:    uint64(step.Gas),
+		Depth:  step.Depth + 1,
+		Refund: uint64(step.Refund),
+	}
+	if !l.cfg.DisableStack {
+		stack := make([]string, len(step.Stack))
+		for i, word := range step.Stack {
+			stack[i] = new(uint256.Int).SetBytes32(word[:]).Hex()
+		}
+		log.Stack = &stack
+	}
+	if l.cfg.EnableMemory {
+		memory := make([]string, 0, len(step.Memory)/32)
+		for i := 0; i+32 <= len(step.Memory); i += 32 {
+			memory = append(memory, hex.EncodeToString(step.Memory[i:i+32]))
+		}
+		log.Memory = &memory
+	}
+	if !l.cfg.DisableStorage && len(step.Stack) >= 1 {
+		top := len(step.Stack) - 1
+		switch step.Op {
+		case vm.SLOAD: // the loaded value is known at the next step
+			frame.sloadKey = step.Stack[top]
+		case vm.SSTORE:
+			if top >= 1 {
+				l.storageOf(step.Address)[step.Stack[top]] = step.Stack[top-1]
+				log.Storage = l.copyStorage(step.Address)
+			}
+		}
+	}
+	l.logs = append(l.logs, log)
+	frame.last = len(l.logs) - 1
+}
+
+// Fill the gas cost of the last logged step of frame with the gas left after it, and the value it loaded
+// if it is SLOAD. stackAfter is nil if the frame ends after the step.
+func (l *StructLogger) finishStep(frame *structLogFrame, gasAfter int64, stackAfter []common.Hash) {
+	log := &l.logs[frame.last]
+	if uint64(gasAfter) < log.Gas {
+		log.GasCost = log.Gas - uint64(gasAfter)
+	}
+	if log.Op == vm.SLOAD.String() && !l.cfg.DisableStorage && len(stackAfter) != 0 {
+		l.storageOf(frame.address)[frame.sloadKey] = stackAfter[len(stackAfter)-1]
+		log.Storage = l.copyStorage(frame.address)
+	}
+}
+
+func (l *StructLogger) onFrameEnd(depth int, status int, gasLeft int64) {
+	if depth >= len(l.frames) { // this frame has no logged step
+		return
+	}
+	frame := &l.frames[depth]
+	if frame.last >= 0 {
+		l.finishStep(frame, gasLeft, nil)
+		if StatusIsFailure(status) && !StatusIsRevert(status) {
+			l.logs[frame.last].Error = StatusToStr(status)
+		}
+	}
+	l.frames = l.frames[:depth]
+}
+
+func (l *StructLogger) storageOf(addr common.Address) map[common.Hash]common.Hash {
+	storage, ok := l.storage[addr]
+	if !ok {
+		storage = make(map[common.Hash]common.Hash)
+		l.storage[addr] = storage
+	}
+	return storage
+}
+
+// geth logs all the storage slots of the contract accessed so far, at each SLOAD and SSTORE
+func (l *StructLogger) copyStorage(addr common.Address) *map[string]string {
+	storage := make(map[string]string, len(l.storage[addr]))
+	for k, v := range l.storage[addr] {
+		storage[hex.EncodeToString(k[:])] = hex.EncodeToString(v[:])
+	}
+	return &storage
+}
+
+func (l *StructLogger) Result(runner *TxRunner) *StructLogResult {
+	return &StructLogResult{
+		Gas:         runner.GasUsed,
+		Failed:      StatusIsFailure(runner.Status),
+		ReturnValue: hex.EncodeToString(runner.OutData),
+		StructLogs:  l.logs,
+	}
+}
+
+// Log the instructions executed by the runner. The code compiled ahead of time is interpreted instead.
+func (runner *TxRunner) EnableStructLogger(cfg *StructLogConfig) {
+	runner.SetTracer(NewStructLogger(cfg))
+}
+
+// Returns nil if EnableStructLogger was not called before the runner ran
+func (runner *TxRunner) StructLogResult() *StructLogResult {
+	l, ok := runner.tracer.(*StructLogger)
+	if !ok {
+		return nil
+	}
+	return l.Result(runner)
+}
+
+// Returns nil if the tracer in config is not StructLoggerTracer
+func structLogConfigOf(config *TraceConfig) (*StructLogConfig, error) {
+	if config.Tracer != StructLoggerTracer {
+		return nil, nil
+	}
+	cfg := &StructLogConfig{}
+	if len(config.TracerConfig) != 0 {
+		if err := json.Unmarshal(config.TracerConfig, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+func structLoggerTracer(runner *TxRunner, _ *TraceTxContext, _ json.RawMessage) (interface{}, error) {
+	res := runner.StructLogResult()
+	if res == nil { // the tx was not executed by EVM
+		res = &StructLogResult{
+			Failed:     StatusIsFailure(runner.Status),
+			StructLogs: []StructLog{},
+		}
+	}
+	return res, nil
+}
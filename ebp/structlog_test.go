@@ -0,0 +1,101 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func newTestSteps() []*OpContext {
+	h := func(b byte) common.Hash { return common.Hash{31: b} }
+	return []*OpContext{
+		{Pc: 0, Op: 0x60 /*PUSH1*/, Depth: 0, Gas: 1000, Address: common.Address{1}},
+		{Pc: 2, Op: 0x54 /*SLOAD*/, Depth: 0, Gas: 997, Address: common.Address{1}, Stack: []common.Hash{h(1)}},
+		{Pc: 3, Op: 0x55 /*SSTORE*/, Depth: 0, Gas: 197, Address: common.Address{1}, Stack: []common.Hash{h(5), h(9)}},
+		{Pc: 4, Op: 0xf1 /*CALL*/, Depth: 0, Gas: 100, Address: common.Address{1}, Stack: []common.Hash{h(9)}},
+		{Pc: 0, Op: 0x00 /*STOP*/, Depth: 1, Gas: 50, Address: common.Address{2}},
+		{Pc: 5, Op: 0x01 /*ADD*/, Depth: 0, Gas: 80, Address: common.Address{1}, Memory: make([]byte, 64)},
+	}
+}
+
+func TestStructLogger(t *testing.T) {
+	l := NewStructLogger(&StructLogConfig{EnableMemory: true})
+	steps := newTestSteps()
+	for _, step := range steps[:5] {
+		l.OnOpcode(step)
+	}
+	l.onFrameEnd(1, 0, 50)
+	l.OnOpcode(steps[5])
+	l.onFrameEnd(0, 3 /*EVMC_OUT_OF_GAS*/, 0)
+
+	res := l.Result(&TxRunner{GasUsed: 1000, Status: 3, OutData: []byte{1}})
+	require.Equal(t, uint64(1000), res.Gas)
+	require.True(t, res.Failed)
+	require.Equal(t, "01", res.ReturnValue)
+	logs := res.StructLogs
+	require.Equal(t, 6, len(logs))
+	for i, op := range []string{"PUSH1", "SLOAD", "SSTORE", "CALL", "STOP", "ADD"} {
+		require.Equal(t, op, logs[i].Op)
+	}
+	for i, cost := range []uint64{3, 800, 97, 20, 0, 80} {
+		require.Equal(t, cost, logs[i].GasCost)
+	}
+	for i, depth := range []int{1, 1, 1, 1, 2, 1} {
+		require.Equal(t, depth, logs[i].Depth)
+	}
+	require.Equal(t, []string{"0x5", "0x9"}, *logs[2].Stack)
+	require.Equal(t, 2, len(*logs[5].Memory))
+
+	key1 := "0000000000000000000000000000000000000000000000000000000000000001"
+	key9 := "0000000000000000000000000000000000000000000000000000000000000009"
+	require.Nil(t, logs[0].Storage)
+	require.Equal(t, map[string]string{key1: key9}, *logs[1].Storage)
+	require.Equal(t, 2, len(*logs[2].Storage))
+	require.Equal(t, "0000000000000000000000000000000000000000000000000000000000000005", (*logs[2].Storage)[key9])
+
+	require.Empty(t, logs[4].Error)
+	require.Equal(t, "out-of-gas", logs[5].Error)
+}
+
+func TestStructLoggerConfig(t *testing.T) {
+	l := NewStructLogger(&StructLogConfig{DisableStack: true, DisableStorage: true, Limit: 2})
+	for _, step := range newTestSteps()[:3] {
+		l.OnOpcode(step)
+	}
+	l.onFrameEnd(0, 0, 0)
+	logs := l.Result(&TxRunner{}).StructLogs
+	require.Equal(t, 2, len(logs))
+	require.Equal(t, uint64(800), logs[1].GasCost)
+	for _, log := range logs {
+		require.Nil(t, log.Stack)
+		require.Nil(t, log.Memory)
+		require.Nil(t, log.Storage)
+	}
+}
+
+func TestTraceTransactionStructLogger(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+	backend := &testTraceBackend{
+		trunk: trunk,
+		txs:   []*types.Transaction{newTransferTx(common.Hash{1}, 0, 100)},
+	}
+	config := &TraceConfig{Tracer: StructLoggerTracer, TracerConfig: []byte(`{"enableMemory":true}`)}
+	res, err := TraceTransaction(backend, common.Hash{1}, config)
+	require.NoError(t, err)
+	result := res.(*StructLogResult)
+	require.False(t, result.Failed)
+	require.Empty(t, result.StructLogs) // a transfer runs no code
+
+	config.TracerConfig = []byte(`{"limit":"x"}`)
+	_, err = TraceTransaction(backend, common.Hash{1}, config)
+	require.Error(t, err)
+}
@@ -0,0 +1,65 @@
+package ebp
+
+import (
+	"fmt"
+
+	"github.com/holiman/uint256"
+	"github.com/smartbch/moeingads/store/rabbit"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// supplyChecker sums up the balance changes of the accounts written by the committed TXs in a block. The EVM
+// only moves coins between accounts, and the gas fees were moved into the system account in Prepare, so the
+// sum must be the fees refunded to the senders, which are taken from the system account by the application.
+type supplyChecker struct {
+	credited uint256.Int
+	debited  uint256.Int
+}
+
+func (sc *supplyChecker) reset() {
+	sc.credited.Clear()
+	sc.debited.Clear()
+}
+
+// It is called with the raw entries written back to trunk, which are the CachedValues of RabbitStore
+func (sc *supplyChecker) observe(_, before, after []byte) {
+	sc.debited.Add(&sc.debited, accountBalanceOf(before))
+	sc.credited.Add(&sc.credited, accountBalanceOf(after))
+}
+
+// The balance of the account stored in a CachedValue, or zero if it is not an account
+func accountBalanceOf(bz []byte) *uint256.Int {
+	if bz == nil {
+		return uint256.NewInt(0)
+	}
+	cv := rabbit.BytesToCachedValue(bz)
+	if cv == nil || cv.IsEmpty() {
+		return uint256.NewInt(0)
+	}
+	if key := cv.GetKey(); len(key) != 21 || key[0] != types.ACCOUNT_KEY {
+		return uint256.NewInt(0)
+	}
+	return types.NewAccountInfo(cv.GetValue()).Balance()
+}
+
+func (sc *supplyChecker) check(feeRefund *uint256.Int) error {
+	expected := new(uint256.Int).Add(&sc.debited, feeRefund)
+	if expected.Gt(&sc.credited) {
+		return fmt.Errorf("%w: %s burnt besides the refund of %s", errors.ErrSupplyNotConserved,
+			new(uint256.Int).Sub(expected, &sc.credited), feeRefund)
+	} else if sc.credited.Gt(expected) {
+		return fmt.Errorf("%w: %s minted besides the refund of %s", errors.ErrSupplyNotConserved,
+			new(uint256.Int).Sub(&sc.credited, expected), feeRefund)
+	}
+	return nil
+}
+
+// Halt if the supply is not conserved in the executed block, instead of letting the state diverge silently
+func (exec *txEngine) checkSupply() {
+	if err := exec.supplyChecker.check(exec.cumulativeFeeRefund); err != nil {
+		exec.logger.Error("Supply check failed", "height", exec.currentBlock.Number, "err", err.Error())
+		panic(err)
+	}
+}
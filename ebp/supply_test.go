@@ -0,0 +1,75 @@
+package ebp
+
+import (
+	"encoding/binary"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/smartbch/moeingads/store/rabbit"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// It mints 1000 to the sender, which is an accounting bug
+type mintExecutor struct{ panicExecutor }
+
+func (me mintExecutor) Execute(ctx *types.Context, currBlock *types.BlockInfo, tx *types.TxToRun) (int, []types.EvmLog, uint64, []byte) {
+	acc := ctx.GetAccount(tx.From)
+	acc.UpdateBalance(new(uint256.Int).Add(acc.Balance(), uint256.NewInt(1000)))
+	ctx.SetAccount(tx.From, acc)
+	return 0, nil, 21000, nil
+}
+
+func TestSupplyChecker(t *testing.T) {
+	sc := &supplyChecker{}
+	acc := types.ZeroAccountInfo()
+	acc.UpdateBalance(uint256.NewInt(100))
+	cachedAccount := func(addr common.Address, acc *types.AccountInfo) []byte {
+		key := types.GetAccountKey(addr)
+		bz := make([]byte, rabbit.KeyStart) // not empty, and passbyNum is zero
+		binary.LittleEndian.PutUint32(bz[rabbit.KeyLenStart:], uint32(len(key)))
+		return append(append(bz, key...), acc.Bytes()...)
+	}
+	sc.observe(nil, nil, cachedAccount(from1, acc))
+	require.NoError(t, sc.check(uint256.NewInt(100))) // a refund
+	require.ErrorIs(t, sc.check(uint256.NewInt(0)), errors.ErrSupplyNotConserved)
+	sc.observe(nil, cachedAccount(from2, acc), nil)
+	require.NoError(t, sc.check(uint256.NewInt(0))) // moved from from2 to from1
+	sc.reset()
+	require.NoError(t, sc.check(uint256.NewInt(0)))
+}
+
+func TestSupplyCheckInExecute(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareEngine(trunk)
+	e.SetSupplyCheck(true)
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	require.NotPanics(t, func() { e.Execute(&types.BlockInfo{Number: 1}) })
+	require.Equal(t, 2, len(e.committedTxs))
+
+	mintAddr := common.HexToAddress("0x2711")
+	PredefinedContractManager[mintAddr] = mintExecutor{}
+	defer delete(PredefinedContractManager, mintAddr)
+	tx, _ := gethtypes.NewTransaction(1, mintAddr, big.NewInt(0), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	e.SetContext(prepareCtx(trunk))
+	e.CollectTx(tx)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	defer func() {
+		err, _ := recover().(error)
+		require.ErrorIs(t, err, errors.ErrSupplyNotConserved)
+	}()
+	e.Execute(&types.BlockInfo{Number: 2})
+	t.Fatal("the node is not halted")
+}
@@ -0,0 +1,84 @@
+package ebp
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// BlockTimeIndex maps the timestamps of the executed blocks to their heights, such that the log and tx
+// queries can accept time ranges and translate them into height ranges with binary search.
+// It lives in memory: after a restart, the node can use AddBlock to reload the blocks from its block store.
+type BlockTimeIndex struct {
+	mtx     sync.RWMutex
+	heights []int64 // in increasing order
+	times   []int64 // in non-decreasing order
+}
+
+func NewBlockTimeIndex() *BlockTimeIndex {
+	return &BlockTimeIndex{}
+}
+
+// Record the timestamp of the block at height. The heights must be added in increasing order and the
+// others are ignored. A timestamp earlier than the former block's is raised to it, to keep the times sorted.
+func (idx *BlockTimeIndex) AddBlock(height, timestamp int64) {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	n := len(idx.heights)
+	if n != 0 && height <= idx.heights[n-1] {
+		return
+	}
+	if n != 0 && timestamp < idx.times[n-1] {
+		timestamp = idx.times[n-1]
+	}
+	idx.heights = append(idx.heights, height)
+	idx.times = append(idx.times, timestamp)
+}
+
+// Returns the lowest and the highest heights of the blocks whose timestamps are in [fromTime, toTime].
+// ok is false if there is no such block.
+func (idx *BlockTimeIndex) HeightRange(fromTime, toTime int64) (fromHeight, toHeight int64, ok bool) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	start := sort.Search(len(idx.times), func(i int) bool { return idx.times[i] >= fromTime })
+	end := sort.Search(len(idx.times), func(i int) bool { return idx.times[i] > toTime })
+	if start >= end {
+		return 0, 0, false
+	}
+	return idx.heights[start], idx.heights[end-1], true
+}
+
+// Returns the timestamp of the block at height, ok is false if it is not in the index
+func (idx *BlockTimeIndex) Timestamp(height int64) (timestamp int64, ok bool) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	i := sort.Search(len(idx.heights), func(i int) bool { return idx.heights[i] >= height })
+	if i == len(idx.heights) || idx.heights[i] != height {
+		return 0, false
+	}
+	return idx.times[i], true
+}
+
+// Same as ctx.QueryLogs, but the blocks are selected by their timestamps in [fromTime, toTime]
+func (idx *BlockTimeIndex) QueryLogs(ctx *types.Context, addresses []common.Address, topics [][]common.Hash,
+	fromTime, toTime int64, filter types.FilterFunc) ([]types.Log, error) {
+	from, to, ok := idx.HeightRange(fromTime, toTime)
+	if !ok {
+		return nil, nil
+	}
+	// the end height of MoDB is exclusive
+	return ctx.QueryLogs(addresses, topics, uint32(from), uint32(to)+1, filter)
+}
+
+// Same as ctx.QueryTxByAddr, but the blocks are selected by their timestamps in [fromTime, toTime]
+func (idx *BlockTimeIndex) QueryTxByAddr(ctx *types.Context, addr common.Address, fromTime, toTime int64,
+	limit uint32) ([]*types.Transaction, [][65]byte, error) {
+	from, to, ok := idx.HeightRange(fromTime, toTime)
+	if !ok {
+		return nil, nil, nil
+	}
+	return ctx.QueryTxByAddr(addr, uint32(from), uint32(to)+1, limit)
+}
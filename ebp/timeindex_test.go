@@ -0,0 +1,95 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	modbtypes "github.com/smartbch/moeingdb/types"
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestBlockTimeIndex(t *testing.T) {
+	idx := NewBlockTimeIndex()
+	_, _, ok := idx.HeightRange(0, 100)
+	require.False(t, ok)
+	idx.AddBlock(10, 100)
+	idx.AddBlock(11, 105)
+	idx.AddBlock(11, 200) // ignored
+	idx.AddBlock(12, 103) // raised to 105
+	idx.AddBlock(13, 110)
+
+	from, to, ok := idx.HeightRange(0, 1000)
+	require.True(t, ok)
+	require.Equal(t, int64(10), from)
+	require.Equal(t, int64(13), to)
+	from, to, ok = idx.HeightRange(101, 105)
+	require.True(t, ok)
+	require.Equal(t, int64(11), from)
+	require.Equal(t, int64(12), to)
+	_, _, ok = idx.HeightRange(106, 109)
+	require.False(t, ok)
+	_, _, ok = idx.HeightRange(111, 120)
+	require.False(t, ok)
+
+	ts, ok := idx.Timestamp(12)
+	require.True(t, ok)
+	require.Equal(t, int64(105), ts)
+	_, ok = idx.Timestamp(9)
+	require.False(t, ok)
+}
+
+func TestTimeIndexInExecute(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	idx := NewBlockTimeIndex()
+	e.SetTimeIndex(idx)
+	e.SetContext(prepareCtx(trunk))
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 1, Timestamp: 1000})
+	from, to, ok := idx.HeightRange(1000, 1000)
+	require.True(t, ok)
+	require.Equal(t, int64(1), from)
+	require.Equal(t, int64(1), to)
+}
+
+// records the height ranges of the queries
+type rangeRecordingDB struct {
+	modbtypes.DB
+	ranges [][2]uint32
+}
+
+func (db *rangeRecordingDB) QueryLogs(addrOrList [][20]byte, topicsOrList [][][32]byte, startHeight, endHeight uint32, fn func([]byte) bool) error {
+	db.ranges = append(db.ranges, [2]uint32{startHeight, endHeight})
+	return nil
+}
+
+func (db *rangeRecordingDB) QueryTxBySrcOrDst(addr [20]byte, startHeight, endHeight uint32, fn func([]byte) bool) error {
+	db.ranges = append(db.ranges, [2]uint32{startHeight, endHeight})
+	return nil
+}
+
+func TestTimeIndexQueries(t *testing.T) {
+	idx := NewBlockTimeIndex()
+	idx.AddBlock(10, 100)
+	idx.AddBlock(11, 105)
+	idx.AddBlock(12, 110)
+	db := &rangeRecordingDB{}
+	ctx := types.NewContext(nil, db)
+	// the block at the end of the time range is included
+	_, err := idx.QueryLogs(ctx, nil, nil, 101, 110, nil)
+	require.NoError(t, err)
+	_, _, err = idx.QueryTxByAddr(ctx, common.Address{1}, 100, 100, 0)
+	require.NoError(t, err)
+	require.Equal(t, [][2]uint32{{11, 13}, {10, 11}}, db.ranges)
+
+	// no query is made if there is no block in the time range
+	_, err = idx.QueryLogs(ctx, nil, nil, 111, 120, nil)
+	require.NoError(t, err)
+	require.Len(t, db.ranges, 2)
+}
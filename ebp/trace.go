@@ -0,0 +1,208 @@
+package ebp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+var (
+	ErrUnknownTracer = errors.New("unknown tracer")
+	ErrTxNotInBlock  = errors.New("tx is not found in its block")
+)
+
+// TraceBackend provides the historical data needed to re-execute the TXs of a block.
+type TraceBackend interface {
+	GetTransaction(hash common.Hash) (*types.Transaction, error)
+	// Returns the TXs committed in the block, in the order of their TransactionIndex
+	GetBlockTransactions(height int64) ([]*types.Transaction, error)
+	GetBlockInfo(height int64) (*types.BlockInfo, error)
+	// Returns a Context of the state before the block, such as the Snapshot of height-1. It will be
+	// closed with Close(false) after tracing.
+	StateBeforeBlock(height int64) (*types.Context, error)
+}
+
+// The position of the traced tx
+type TraceTxContext struct {
+	BlockHash   common.Hash
+	BlockNumber int64
+	TxIndex     int
+	TxHash      common.Hash
+}
+
+// A TxTracer generates the trace of a tx from the runner which has executed it
+type TxTracer func(runner *TxRunner, txCtx *TraceTxContext, config json.RawMessage) (interface{}, error)
+
+const DefaultTracer = "resultTracer"
+
+var (
+	tracersMtx sync.RWMutex
+	tracers    = map[string]TxTracer{DefaultTracer: resultTracer}
+)
+
+// Register a TxTracer, which can be used by its name in TraceConfig
+func RegisterTxTracer(name string, tracer TxTracer) {
+	tracersMtx.Lock()
+	defer tracersMtx.Unlock()
+	tracers[name] = tracer
+}
+
+func getTxTracer(name string) (TxTracer, error) {
+	if name == "" {
+		name = DefaultTracer
+	}
+	tracersMtx.RLock()
+	defer tracersMtx.RUnlock()
+	tracer, ok := tracers[name]
+	if !ok && isJSTracer(name) {
+		return newJSTracer(name), nil
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTracer, name)
+	}
+	return tracer, nil
+}
+
+type TraceConfig struct {
+	Tracer       string          `json:"tracer"` // the name of a registered TxTracer or the code of a JS tracer, DefaultTracer if empty
+	TracerConfig json.RawMessage `json:"tracerConfig"`
+}
+
+// TxTrace is the output of DefaultTracer
+type TxTrace struct {
+	Status            int                      `json:"status"`
+	StatusStr         string                   `json:"statusStr"`
+	OutData           []byte                   `json:"outData"`
+	ContractAddress   common.Address           `json:"contractAddress"`
+	Logs              []types.EvmLog           `json:"logs"`
+	InternalTxCalls   []types.InternalTxCall   `json:"internalTxCalls"`
+	InternalTxReturns []types.InternalTxReturn `json:"internalTxReturns"`
+}
+
+func resultTracer(runner *TxRunner, _ *TraceTxContext, _ json.RawMessage) (interface{}, error) {
+	return &TxTrace{
+		Status:            runner.Status,
+		StatusStr:         StatusToStr(runner.Status),
+		OutData:           runner.OutData,
+		ContractAddress:   runner.CreatedContractAddress,
+		Logs:              runner.Logs,
+		InternalTxCalls:   runner.InternalTxCalls,
+		InternalTxReturns: runner.InternalTxReturns,
+	}, nil
+}
+
+// Re-execute the TXs before the one with hash in its block serially, and then trace it. They are executed
+// as in the block with RunTxAsInBlock.
+func TraceTransaction(backend TraceBackend, hash common.Hash, config *TraceConfig) (interface{}, error) {
+	tracer, err := getTxTracer(config.Tracer)
+	if err != nil {
+		return nil, err
+	}
+	logCfg, err := structLogConfigOf(config)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := backend.GetTransaction(hash)
+	if err != nil {
+		return nil, err
+	}
+	blk, err := backend.GetBlockInfo(tx.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	txs, err := backend.GetBlockTransactions(tx.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := backend.StateBeforeBlock(tx.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer ctx.Close(false)
+	for i, prev := range txs {
+		if prev.Hash == tx.Hash {
+			return tracer(runTxSerially(ctx, blk, prev, logCfg), newTraceTxContext(blk, i, prev), config.TracerConfig)
+		}
+		runTxSerially(ctx, blk, prev, nil)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTxNotInBlock, hash)
+}
+
+// The trace of a tx in TraceBlock. Error is not empty if the tracer fails.
+type TxTraceResult struct {
+	TxHash common.Hash `json:"txHash"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// Re-execute all the TXs of the block at height serially and trace each of them
+func TraceBlock(backend TraceBackend, height int64, config *TraceConfig) ([]TxTraceResult, error) {
+	tracer, err := getTxTracer(config.Tracer)
+	if err != nil {
+		return nil, err
+	}
+	logCfg, err := structLogConfigOf(config)
+	if err != nil {
+		return nil, err
+	}
+	blk, err := backend.GetBlockInfo(height)
+	if err != nil {
+		return nil, err
+	}
+	txs, err := backend.GetBlockTransactions(height)
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := backend.StateBeforeBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	defer ctx.Close(false)
+	results := make([]TxTraceResult, len(txs))
+	for i, tx := range txs {
+		results[i].TxHash = tx.Hash
+		results[i].Result, err = tracer(runTxSerially(ctx, blk, tx, logCfg), newTraceTxContext(blk, i, tx), config.TracerConfig)
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+	return results, nil
+}
+
+func newTraceTxContext(blk *types.BlockInfo, idx int, tx *types.Transaction) *TraceTxContext {
+	return &TraceTxContext{
+		BlockHash:   blk.Hash,
+		BlockNumber: blk.Number,
+		TxIndex:     idx,
+		TxHash:      tx.Hash,
+	}
+}
+
+// Run tx on ctx as in its block, and keep its changes in ctx, such that the TXs after it can see them.
+// Its instructions are logged if logCfg is not nil.
+func runTxSerially(ctx *types.Context, blk *types.BlockInfo, tx *types.Transaction, logCfg *StructLogConfig) *TxRunner {
+	runner := NewTxRunner(ctx, &types.TxToRun{
+		BasicTx: types.BasicTx{
+			From:     tx.From,
+			To:       tx.To,
+			Value:    tx.Value,
+			GasPrice: tx.GasPrice,
+			Gas:      tx.Gas,
+			Data:     tx.Input,
+			Nonce:    tx.Nonce,
+		},
+		HashID: tx.Hash,
+		Height: uint64(blk.Number),
+	})
+	runner.recordRWList = true
+	if logCfg != nil {
+		runner.EnableStructLogger(logCfg)
+	}
+	RunTxAsInBlock(blk, runner)
+	return runner
+}
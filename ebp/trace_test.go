@@ -0,0 +1,181 @@
+package ebp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+	"github.com/smartbch/moeingads/store"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+type testTraceBackend struct {
+	trunk *store.TrunkStore
+	txs   []*types.Transaction
+}
+
+func (b *testTraceBackend) GetTransaction(hash common.Hash) (*types.Transaction, error) {
+	for _, tx := range b.txs {
+		if tx.Hash == hash {
+			return tx, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (b *testTraceBackend) GetBlockTransactions(height int64) ([]*types.Transaction, error) {
+	return b.txs, nil
+}
+
+func (b *testTraceBackend) GetBlockInfo(height int64) (*types.BlockInfo, error) {
+	return &types.BlockInfo{Number: height}, nil
+}
+
+func (b *testTraceBackend) StateBeforeBlock(height int64) (*types.Context, error) {
+	return prepareCtx(b.trunk), nil
+}
+
+func newTransferTx(hash common.Hash, nonce uint64, value uint64) *types.Transaction {
+	tx := &types.Transaction{
+		Hash:        hash,
+		BlockNumber: 2,
+		From:        from1,
+		To:          to1,
+		Gas:         100000,
+		Nonce:       nonce,
+	}
+	v := uint256.NewInt(value).Bytes32()
+	copy(tx.Value[:], v[:])
+	return tx
+}
+
+func TestTraceTransaction(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+	backend := &testTraceBackend{
+		trunk: trunk,
+		txs: []*types.Transaction{
+			newTransferTx(common.Hash{1}, 0, 100),
+			newTransferTx(common.Hash{2}, 1, 200),
+			newTransferTx(common.Hash{3}, 1, 300), // incorrect nonce
+		},
+	}
+	RegisterTxTracer("balanceTracer", func(runner *TxRunner, _ *TraceTxContext, config json.RawMessage) (interface{}, error) {
+		var addr common.Address
+		if err := json.Unmarshal(config, &addr); err != nil {
+			return nil, err
+		}
+		return runner.Ctx.GetAccount(addr).Balance().Uint64(), nil
+	})
+	config := &TraceConfig{Tracer: "balanceTracer", TracerConfig: []byte(`"` + to1.Hex() + `"`)}
+	balance, err := TraceTransaction(backend, common.Hash{2}, config)
+	require.NoError(t, err)
+	require.Equal(t, uint64(300), balance)
+
+	trace, err := TraceTransaction(backend, common.Hash{2}, &TraceConfig{})
+	require.NoError(t, err)
+	require.Equal(t, "success", trace.(*TxTrace).StatusStr)
+	trace, err = TraceTransaction(backend, common.Hash{3}, &TraceConfig{})
+	require.NoError(t, err)
+	require.Equal(t, types.TX_NONCE_TOO_SMALL, trace.(*TxTrace).Status)
+
+	_, err = TraceTransaction(backend, common.Hash{2}, &TraceConfig{Tracer: "noSuchTracer"})
+	require.ErrorIs(t, err, ErrUnknownTracer)
+
+	e.SetContext(prepareCtx(trunk))
+	require.Nil(t, e.cleanCtx.GetAccount(to1)) // tracing does not change the state
+	e.cleanCtx.Close(false)
+}
+
+func TestTraceBlock(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.SetContext(prepareCtx(trunk))
+	_ = prepareAccAndTx(e)
+	backend := &testTraceBackend{
+		trunk: trunk,
+		txs: []*types.Transaction{
+			newTransferTx(common.Hash{1}, 0, 100),
+			newTransferTx(common.Hash{2}, 2, 200), // incorrect nonce
+			newTransferTx(common.Hash{3}, 1, 300),
+		},
+	}
+	results, err := TraceBlock(backend, 2, &TraceConfig{})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(results))
+	for i, status := range []int{0, types.TX_NONCE_TOO_LARGE, 0} {
+		require.Equal(t, backend.txs[i].Hash, [32]byte(results[i].TxHash))
+		require.Empty(t, results[i].Error)
+		require.Equal(t, status, results[i].Result.(*TxTrace).Status)
+	}
+
+	RegisterTxTracer("failingTracer", func(runner *TxRunner, _ *TraceTxContext, config json.RawMessage) (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+	results, err = TraceBlock(backend, 2, &TraceConfig{Tracer: "failingTracer"})
+	require.NoError(t, err)
+	require.Equal(t, "failed", results[0].Error)
+}
+
+// the receipt fields which TraceBlock should reproduce
+type tracedReceipt struct {
+	Status  int
+	GasUsed uint64
+	Balance uint64 // of the sender
+}
+
+func TestTraceBlockAsExecuted(t *testing.T) {
+	defer func(adjust bool) { AdjustGasUsed = adjust }(AdjustGasUsed)
+	AdjustGasUsed = true
+	// the state before the block, in which Prepare has deducted the gas fees
+	prepare := func() (*txEngine, *store.TrunkStore, *store.RootStore) {
+		trunk, root := prepareTruck()
+		e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+		e.SetContext(prepareCtx(trunk))
+		for _, tx := range prepareAccAndTx(e) {
+			e.CollectTx(tx)
+		}
+		e.SetContext(prepareCtx(trunk))
+		e.Prepare(0, 0, DefaultTxGasLimit)
+		return e, trunk, root
+	}
+	e, trunk, root := prepare()
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 2})
+	txs := e.CommittedTxs()
+	require.Equal(t, 2, len(txs))
+	ctx := prepareCtx(trunk)
+	executed := make([]tracedReceipt, len(txs))
+	for i, tx := range txs {
+		executed[i] = tracedReceipt{int(tx.Status), tx.GasUsed, ctx.GetAccount(tx.From).Balance().Uint64()}
+	}
+	ctx.Close(false)
+	closeTestCtx(root)
+
+	_, trunk, root = prepare()
+	defer closeTestCtx(root)
+	RegisterTxTracer("receiptTracer", func(runner *TxRunner, _ *TraceTxContext, _ json.RawMessage) (interface{}, error) {
+		status := 1 // ReceiptStatusSuccessful
+		if StatusIsFailure(runner.Status) {
+			status = 0
+		}
+		return tracedReceipt{status, runner.GasUsed, runner.Ctx.GetAccount(runner.Tx.From).Balance().Uint64()}, nil
+	})
+	results, err := TraceBlock(&testTraceBackend{trunk: trunk, txs: txs}, 2, &TraceConfig{Tracer: "receiptTracer"})
+	require.NoError(t, err)
+	for i, res := range results {
+		require.Empty(t, res.Error)
+		require.Equal(t, executed[i], res.Result)
+	}
+	require.Equal(t, uint64(100000), executed[0].GasUsed) // adjusted from 21000
+}
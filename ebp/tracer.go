@@ -0,0 +1,65 @@
+package ebp
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// Tracer observes the txs run by TxRunner, such that the analytics such as extracting token transfers can be
+// built without changing the execution code. It can be set on the engine with SetTracer, which traces every
+// tx of the blocks, or on a single runner with TxRunner.SetTracer, such as the one of an RPC call.
+//
+// A tracer set on the engine is called by the runners in parallel, so it must be safe for concurrent use.
+// The runs of a tx may be traced more than once, and the runs whose results are not committed are also
+// traced, such as the ones with the status FAILED_TO_COMMIT.
+//
+// OnOpcode is called before each instruction is executed, and the code compiled ahead of time is
+// interpreted instead when a tracer is set. OnCallEnter and OnCallExit are called after the instructions
+// of the tx, in the order the call frames are executed, because the frames are collected when EVM returns.
+type Tracer interface {
+	OnTxStart(runner *TxRunner)
+	OnOpcode(op *OpContext)
+	OnCallEnter(call *types.InternalTxCall)
+	OnCallExit(call *types.InternalTxCall, ret *types.InternalTxReturn)
+	// runner has the results of the tx, including the failures before EVM is entered
+	OnTxEnd(runner *TxRunner)
+}
+
+// OpContext is the state of the EVM before an instruction is executed. Stack and Memory are only valid during
+// OnOpcode, they must be copied to be kept.
+type OpContext struct {
+	Pc      uint64
+	Op      vm.OpCode
+	Depth   int // starts from 0
+	Gas     int64
+	Refund  int64
+	Address common.Address
+	Stack   []common.Hash // from the bottom to the top
+	Memory  []byte
+}
+
+// implemented by the tracers which need to know where a call frame ends in the instructions
+type frameEndTracer interface {
+	onFrameEnd(depth int, status int, gasLeft int64)
+}
+
+// Trace the txs run by this runner, instead of the tracer set on the engine
+func (runner *TxRunner) SetTracer(t Tracer) {
+	runner.tracer = t
+}
+
+func (runner *TxRunner) traceTxEnd() {
+	// a malformed list of frames is skipped, it only happens to the runners built by hand
+	_ = replayCallFrames(runner.InternalTxCalls, runner.InternalTxReturns,
+		func(call *types.InternalTxCall) error {
+			runner.tracer.OnCallEnter(call)
+			return nil
+		},
+		func(call *types.InternalTxCall, ret *types.InternalTxReturn) error {
+			runner.tracer.OnCallExit(call, ret)
+			return nil
+		})
+	runner.tracer.OnTxEnd(runner)
+}
@@ -0,0 +1,96 @@
+package ebp
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+type recordingTracer struct {
+	mtx    sync.Mutex
+	events []string
+}
+
+func (r *recordingTracer) record(format string, args ...interface{}) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingTracer) OnTxStart(runner *TxRunner) {
+	r.record("start %d", runner.Tx.Nonce)
+}
+
+func (r *recordingTracer) OnOpcode(op *OpContext) {
+	r.record("op %s", op.Op)
+}
+
+func (r *recordingTracer) OnCallEnter(call *types.InternalTxCall) {
+	r.record("enter %d", call.Depth)
+}
+
+func (r *recordingTracer) OnCallExit(call *types.InternalTxCall, ret *types.InternalTxReturn) {
+	r.record("exit %d %d", call.Depth, ret.GasLeft)
+}
+
+func (r *recordingTracer) OnTxEnd(runner *TxRunner) {
+	r.record("end %d", runner.Status)
+}
+
+func TestTracerCallFrames(t *testing.T) {
+	r := &recordingTracer{}
+	runner := &TxRunner{
+		Tx:     &types.TxToRun{},
+		Status: 2,
+		InternalTxCalls: []types.InternalTxCall{
+			{Depth: 0, Gas: 1000},
+			{Depth: 1, Gas: 500},
+			{Depth: 1, Gas: 300},
+		},
+		InternalTxReturns: []types.InternalTxReturn{
+			{GasLeft: 400},
+			{GasLeft: 100},
+			{GasLeft: 10},
+		},
+	}
+	runner.SetTracer(r)
+	runner.traceTxEnd()
+	require.Equal(t, []string{"enter 0", "enter 1", "exit 1 400", "enter 1", "exit 1 100", "exit 0 10", "end 2"},
+		r.events)
+	require.Nil(t, runner.StructLogResult())
+}
+
+func TestTxEngine_Tracer(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	r := &recordingTracer{}
+	e.SetTracer(r)
+	e.SetContext(prepareCtx(trunk))
+	txs := prepareAccAndTx(e)
+	e.SetContext(prepareCtx(trunk))
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{})
+	require.Equal(t, 2, len(e.committedTxs))
+	starts, ends := 0, 0
+	for _, event := range r.events {
+		switch event {
+		case "start 0":
+			starts++
+		case "end 0":
+			ends++
+		}
+	}
+	require.Equal(t, 2, starts)
+	require.Equal(t, 2, ends)
+}
@@ -0,0 +1,33 @@
+package ebp
+
+import (
+	"math/big"
+	"testing"
+
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/errors"
+)
+
+func TestMaxTxSize(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, _ := prepareEngine(trunk)
+	e.SetMaxTxSize(1000)
+	small, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(1), nil).WithSignature(e.signer, from1.Bytes())
+	large, _ := gethtypes.NewTransaction(0, to1, big.NewInt(100), 100000, big.NewInt(1), make([]byte, 1000)).WithSignature(e.signer, from2.Bytes())
+	require.NoError(t, e.ValidateTx(small))
+	require.ErrorIs(t, e.ValidateTx(large), errors.ErrTxTooLarge)
+
+	// the large one is in the block, so it gets a receipt
+	e.CollectTx(small)
+	e.CollectTx(large)
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	require.Equal(t, 1, len(e.committedTxs))
+	require.Equal(t, "tx-too-large", e.committedTxs[0].StatusStr)
+	e.SetContext(prepareCtx(trunk))
+	require.Equal(t, 1, e.StandbyQLen())
+	e.cleanCtx.Close(false)
+}
@@ -0,0 +1,95 @@
+package ebp
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// QueuedTxStatus tells where a tx is in the standby queue and when it is expected to run
+type QueuedTxStatus struct {
+	Position int // the count of the TXs before it in the standby queue
+	QueueLen int
+	// The estimated count of blocks until it is loaded to run, one means the next block. It assumes that each
+	// block runs the most TXs the engine can load, so the real count may be larger if the TXs conflict.
+	EstimatedBlocks int
+	// It would be ignored as a too old tx if it is not run within one more block than estimated
+	RisksEviction bool
+}
+
+// QueuedTxStatus finds the tx with the hash in the standby queue and estimates when it runs with the parameters
+// of this engine. A tx in the scheduled queue is reported as if it were at the end of standby queue, which is
+// where it is moved to at its height. It returns false if the tx is in neither queue. The queues are scanned
+// from their starts, so it is slow for long queues. Like Execute, it must be called after SetContext.
+func (exec *txEngine) QueuedTxStatus(hash common.Hash) (QueuedTxStatus, bool) {
+	start, end := exec.getStandbyQueueRange()
+	ctx := exec.readCtx()
+	defer ctx.Close(false)
+	for i := start; i < end; i++ {
+		bz := ctx.Rbt.GetBaseStore().Get(types.GetStandbyTxKey(i))
+		var tx types.TxToRun
+		tx.FromBytes(bz)
+		if tx.HashID == hash {
+			return exec.queuedTxStatusAt(int(i-start), int(end-start), &tx), true
+		}
+	}
+	var scheduled *types.TxToRun
+	exec.scanScheduledTxs(ctx, func(tx *types.TxToRun) {
+		if tx.HashID == hash {
+			scheduled = tx
+		}
+	})
+	if scheduled != nil {
+		return exec.queuedTxStatusAt(int(end-start), int(end-start), scheduled), true
+	}
+	return QueuedTxStatus{}, false
+}
+
+// StandbyTx is a tx waiting in the standby queue
+type StandbyTx struct {
+	Position int // the count of the TXs before it in the standby queue
+	Tx       types.TxToRun
+}
+
+// IterateStandbyTxs returns at most 'limit' TXs in the standby queue, from the one at the position 'start', in
+// the order they are loaded to run, together with the current length of the queue. Callers can page through
+// the queue by starting the next call at the position after the last returned tx. Like Execute, it must be
+// called after SetContext.
+func (exec *txEngine) IterateStandbyTxs(start, limit int) (txs []StandbyTx, queueLen int) {
+	qStart, qEnd := exec.getStandbyQueueRange()
+	queueLen = int(qEnd - qStart)
+	if start < 0 || start >= queueLen || limit <= 0 {
+		return nil, queueLen
+	}
+	end := queueLen
+	if limit < queueLen-start {
+		end = start + limit
+	}
+	ctx := exec.readCtx()
+	defer ctx.Close(false)
+	txs = make([]StandbyTx, 0, end-start)
+	for i := start; i < end; i++ {
+		bz := ctx.Rbt.GetBaseStore().Get(types.GetStandbyTxKey(qStart + uint64(i)))
+		entry := StandbyTx{Position: i}
+		entry.Tx.FromBytes(bz)
+		txs = append(txs, entry)
+	}
+	return txs, queueLen
+}
+
+func (exec *txEngine) queuedTxStatusAt(position, queueLen int, tx *types.TxToRun) QueuedTxStatus {
+	status := QueuedTxStatus{Position: position, QueueLen: queueLen}
+	perBlock := exec.roundNum * exec.runnerNumber
+	status.EstimatedBlocks = position/perBlock + 1
+	currHeight := exec.getCurrHeight()
+	if tx.NotBefore > currHeight+uint64(status.EstimatedBlocks) {
+		status.EstimatedBlocks = int(tx.NotBefore - currHeight)
+	}
+	startHeight := tx.Height
+	if tx.NotBefore > startHeight {
+		startHeight = tx.NotBefore
+	}
+	// the margin of one block covers the TXs requeued because of conflicts
+	status.RisksEviction = startHeight+types.TOO_OLD_THRESHOLD < currHeight+uint64(status.EstimatedBlocks)+1
+	return status
+}
@@ -0,0 +1,83 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestQueuedTxStatusAt(t *testing.T) {
+	e := NewEbpTxExec(2, 10, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	e.currentBlock = &types.BlockInfo{Number: 100}
+	tx := &types.TxToRun{Height: 100}
+	status := e.queuedTxStatusAt(19, 50, tx)
+	require.Equal(t, QueuedTxStatus{Position: 19, QueueLen: 50, EstimatedBlocks: 1}, status)
+	status = e.queuedTxStatusAt(20, 50, tx)
+	require.Equal(t, 2, status.EstimatedBlocks)
+	require.False(t, status.RisksEviction)
+
+	status = e.queuedTxStatusAt(20*9, 200, tx)
+	require.Equal(t, 10, status.EstimatedBlocks)
+	require.True(t, status.RisksEviction)
+
+	// a scheduled tx gets old since the height it is scheduled at
+	tx.NotBefore = 120
+	status = e.queuedTxStatusAt(20*9, 200, tx)
+	require.Equal(t, 20, status.EstimatedBlocks)
+	require.False(t, status.RisksEviction)
+}
+
+func TestTxEngine_QueuedTxStatus(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareEngine(trunk)
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	found := 0
+	for _, tx := range txs {
+		status, ok := e.QueuedTxStatus(tx.Hash())
+		require.True(t, ok)
+		require.Equal(t, 2, status.QueueLen)
+		require.Equal(t, 1, status.EstimatedBlocks)
+		found |= 1 << status.Position
+	}
+	require.Equal(t, 3, found)
+	_, ok := e.QueuedTxStatus([32]byte{1})
+	require.False(t, ok)
+	e.cleanCtx.Close(false)
+}
+
+func TestTxEngine_IterateStandbyTxs(t *testing.T) {
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e, txs := prepareEngine(trunk)
+	for _, tx := range txs {
+		e.CollectTx(tx)
+	}
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	all, queueLen := e.IterateStandbyTxs(0, 10)
+	require.Equal(t, 2, queueLen)
+	require.Equal(t, 2, len(all))
+	for i, entry := range all {
+		require.Equal(t, i, entry.Position)
+		status, ok := e.QueuedTxStatus(entry.Tx.HashID)
+		require.True(t, ok)
+		require.Equal(t, i, status.Position)
+	}
+	page, _ := e.IterateStandbyTxs(1, 1)
+	require.Equal(t, all[1:], page)
+	page, queueLen = e.IterateStandbyTxs(2, 1)
+	require.Equal(t, 0, len(page))
+	require.Equal(t, 2, queueLen)
+	page, _ = e.IterateStandbyTxs(0, 0)
+	require.Equal(t, 0, len(page))
+	e.cleanCtx.Close(false)
+}
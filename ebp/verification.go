@@ -0,0 +1,149 @@
+package ebp
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/smartbch/moeingevm/abiutil"
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+//#include <stdint.h>
+//#include "../evmwrap/host_bridge/bridge.h"
+import "C"
+
+// The system contract storing the verification records of contracts
+var VerificationRegistryAddress = common.Address([20]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x27, 0x14})
+
+const (
+	SetVerificationSig    = "setVerification(address,string,bytes32,bytes32)"
+	RemoveVerificationSig = "removeVerification(address)"
+
+	VerificationGas uint64 = 50000
+	// the max length of a compiler version, such as "v0.8.19+commit.7dd6d404"
+	MaxCompilerVersionLen = 128
+)
+
+var (
+	setVerificationSel    = abiutil.Selector(SetVerificationSig)
+	removeVerificationSel = abiutil.Selector(RemoveVerificationSig)
+	// VerificationChanged(address indexed contract)
+	verificationChangedEvent = common.BytesToHash(crypto.Keccak256([]byte("VerificationChanged(address)")))
+)
+
+// VerificationRecord says a contract's bytecode was reproduced by compiling the source with the compiler
+type VerificationRecord struct {
+	CompilerVersion     string
+	SourceHash          [32]byte // keccak256 of the source, or of the standard JSON input
+	ConstructorArgsHash [32]byte // keccak256 of the ABI-encoded constructor arguments
+	Height              int64    // when the record was set
+}
+
+func (r *VerificationRecord) ToBytes() []byte {
+	bz := make([]byte, 8+32+32, 8+32+32+len(r.CompilerVersion))
+	binary.BigEndian.PutUint64(bz[0:8], uint64(r.Height))
+	copy(bz[8:40], r.SourceHash[:])
+	copy(bz[40:72], r.ConstructorArgsHash[:])
+	return append(bz, r.CompilerVersion...)
+}
+
+// Returns false if bz is not a valid encoding
+func (r *VerificationRecord) FromBytes(bz []byte) bool {
+	if len(bz) < 8+32+32 {
+		return false
+	}
+	r.Height = int64(binary.BigEndian.Uint64(bz[0:8]))
+	copy(r.SourceHash[:], bz[8:40])
+	copy(r.ConstructorArgsHash[:], bz[40:72])
+	r.CompilerVersion = string(bz[72:])
+	return true
+}
+
+// Returns the verification record of contract, or nil if it is not verified
+func GetVerificationRecord(ctx *types.Context, contract common.Address) *VerificationRecord {
+	r := &VerificationRecord{}
+	if !r.FromBytes(ctx.Rbt.Get(types.GetVerificationKey(contract))) {
+		return nil
+	}
+	return r
+}
+
+// VerificationRegistry is the system contract at VerificationRegistryAddress. The verifiers, which are
+// decided by governance, set and remove the records with system TXs calling it. It must be registered
+// with the same verifiers on all the nodes.
+type VerificationRegistry struct {
+	verifiers map[common.Address]struct{}
+}
+
+var _ types.SystemContractExecutor = (*VerificationRegistry)(nil)
+
+func NewVerificationRegistry(verifiers []common.Address) *VerificationRegistry {
+	reg := &VerificationRegistry{verifiers: make(map[common.Address]struct{}, len(verifiers))}
+	for _, addr := range verifiers {
+		reg.verifiers[addr] = struct{}{}
+	}
+	return reg
+}
+
+func (reg *VerificationRegistry) Init(ctx *types.Context) {}
+
+func (reg *VerificationRegistry) IsSystemContract(addr common.Address) bool {
+	return addr == VerificationRegistryAddress
+}
+
+func (reg *VerificationRegistry) RequiredGas(input []byte) uint64 {
+	return VerificationGas
+}
+
+// The records can only be changed by TXs, not by contracts
+func (reg *VerificationRegistry) Run(input []byte) ([]byte, error) {
+	return nil, errors.ErrNotCallableByContract
+}
+
+func (reg *VerificationRegistry) Execute(ctx *types.Context, currBlock *types.BlockInfo, tx *types.TxToRun) (status int, logs []types.EvmLog, gasUsed uint64, outData []byte) {
+	status = int(C.EVMC_FAILURE)
+	if tx.Gas < VerificationGas {
+		return int(C.EVMC_OUT_OF_GAS), nil, tx.Gas, nil
+	}
+	gasUsed = VerificationGas
+	if _, ok := reg.verifiers[tx.From]; !ok || tx.Value != [32]byte{} || len(tx.Data) < 4 {
+		return
+	}
+	var contract common.Address
+	switch {
+	case string(tx.Data[:4]) == string(setVerificationSel[:]):
+		args, err := abiutil.Unpack(SetVerificationSig, tx.Data)
+		if err != nil {
+			return
+		}
+		contract = args[0].(common.Address)
+		version := args[1].(string)
+		if ctx.GetCode(contract) == nil || len(version) == 0 || len(version) > MaxCompilerVersionLen {
+			return
+		}
+		r := &VerificationRecord{
+			CompilerVersion:     version,
+			SourceHash:          args[2].([32]byte),
+			ConstructorArgsHash: args[3].([32]byte),
+			Height:              currBlock.Number,
+		}
+		ctx.Rbt.Set(types.GetVerificationKey(contract), r.ToBytes())
+	case string(tx.Data[:4]) == string(removeVerificationSel[:]):
+		args, err := abiutil.Unpack(RemoveVerificationSig, tx.Data)
+		if err != nil {
+			return
+		}
+		contract = args[0].(common.Address)
+		ctx.Rbt.Delete(types.GetVerificationKey(contract))
+	default:
+		return
+	}
+	logs = []types.EvmLog{{
+		Address: VerificationRegistryAddress,
+		Topics:  []common.Hash{verificationChangedEvent, common.BytesToHash(contract[:])},
+	}}
+	return int(C.EVMC_SUCCESS), logs, gasUsed, nil
+}
@@ -0,0 +1,67 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartbch/moeingads/store"
+	"github.com/smartbch/moeingads/store/rabbit"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/abiutil"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestVerificationRecordBytes(t *testing.T) {
+	r := &VerificationRecord{CompilerVersion: "v0.8.19", SourceHash: [32]byte{1}, ConstructorArgsHash: [32]byte{2}, Height: 9}
+	var r2 VerificationRecord
+	require.True(t, r2.FromBytes(r.ToBytes()))
+	require.Equal(t, *r, r2)
+	require.False(t, r2.FromBytes(nil))
+}
+
+func TestVerificationRegistry(t *testing.T) {
+	rbt := rabbit.NewRabbitStore(store.NewMockRootStore())
+	ctx := types.NewContext(&rbt, nil)
+	verifier, contract := common.Address{0x77}, common.Address{0x88}
+	ctx.Rbt.Set(types.GetBytecodeKey(contract), make([]byte, 34))
+	reg := NewVerificationRegistry([]common.Address{verifier})
+	require.True(t, reg.IsSystemContract(VerificationRegistryAddress))
+	_, err := reg.Run(nil)
+	require.Error(t, err)
+
+	blk := &types.BlockInfo{Number: 5}
+	setData, err := abiutil.Pack(SetVerificationSig, contract, "v0.8.19", [32]byte{1}, [32]byte{2})
+	require.NoError(t, err)
+	tx := &types.TxToRun{BasicTx: types.BasicTx{From: common.Address{0x99}, To: VerificationRegistryAddress, Gas: 100000, Data: setData}}
+	status, _, _, _ := reg.Execute(ctx, blk, tx)
+	require.True(t, StatusIsFailure(status)) // not a verifier
+	require.Nil(t, GetVerificationRecord(ctx, contract))
+
+	tx.From = verifier
+	status, logs, gasUsed, _ := reg.Execute(ctx, blk, tx)
+	require.False(t, StatusIsFailure(status))
+	require.Equal(t, VerificationGas, gasUsed)
+	require.Equal(t, 1, len(logs))
+	require.Equal(t, common.BytesToHash(contract[:]), logs[0].Topics[1])
+	r := GetVerificationRecord(ctx, contract)
+	require.NotNil(t, r)
+	require.Equal(t, "v0.8.19", r.CompilerVersion)
+	require.Equal(t, [32]byte{1}, r.SourceHash)
+	require.Equal(t, [32]byte{2}, r.ConstructorArgsHash)
+	require.Equal(t, int64(5), r.Height)
+
+	// only a contract can be verified
+	tx.Data, _ = abiutil.Pack(SetVerificationSig, common.Address{0x66}, "v0.8.19", [32]byte{1}, [32]byte{2})
+	status, _, _, _ = reg.Execute(ctx, blk, tx)
+	require.True(t, StatusIsFailure(status))
+
+	tx.Data, _ = abiutil.Pack(RemoveVerificationSig, contract)
+	tx.Gas = VerificationGas - 1
+	status, _, _, _ = reg.Execute(ctx, blk, tx)
+	require.Equal(t, "out-of-gas", StatusToStr(status))
+	tx.Gas = VerificationGas
+	status, _, _, _ = reg.Execute(ctx, blk, tx)
+	require.False(t, StatusIsFailure(status))
+	require.Nil(t, GetVerificationRecord(ctx, contract))
+}
@@ -0,0 +1,112 @@
+package ebp
+
+import (
+	"container/list"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// HotAccounts is a small LRU of the accounts touched by the recently committed TXs. It is saved to a file
+// by the node (no consensus data depends on it), and after a restart, the states of these accounts are
+// preloaded by WarmUp to avoid a slow first block.
+type HotAccounts struct {
+	mtx      sync.Mutex
+	capacity int
+	order    *list.List // of common.Address, the most recently touched one is at front
+	elems    map[common.Address]*list.Element
+}
+
+func NewHotAccounts(capacity int) *HotAccounts {
+	return &HotAccounts{
+		capacity: capacity,
+		order:    list.New(),
+		elems:    make(map[common.Address]*list.Element, capacity),
+	}
+}
+
+func (h *HotAccounts) Touch(addr common.Address) {
+	if addr == (common.Address{}) {
+		return
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if e, ok := h.elems[addr]; ok {
+		h.order.MoveToFront(e)
+		return
+	}
+	h.elems[addr] = h.order.PushFront(addr)
+	if h.order.Len() > h.capacity {
+		e := h.order.Back()
+		h.order.Remove(e)
+		delete(h.elems, e.Value.(common.Address))
+	}
+}
+
+// Returns the tracked accounts, the most recently touched one first
+func (h *HotAccounts) Addresses() []common.Address {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	addrs := make([]common.Address, 0, h.order.Len())
+	for e := h.order.Front(); e != nil; e = e.Next() {
+		addrs = append(addrs, e.Value.(common.Address))
+	}
+	return addrs
+}
+
+// Save the addresses as concatenated 20-byte strings, through a temporary file such that a crash
+// does not leave a broken file
+func (h *HotAccounts) Save(path string) error {
+	addrs := h.Addresses()
+	bz := make([]byte, 0, len(addrs)*common.AddressLength)
+	for _, addr := range addrs {
+		bz = append(bz, addr[:]...)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, bz, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load the accounts saved by Save. A missing file gives an empty HotAccounts.
+func LoadHotAccounts(path string, capacity int) (*HotAccounts, error) {
+	h := NewHotAccounts(capacity)
+	bz, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(bz)%common.AddressLength != 0 {
+		return nil, errors.New("invalid hot accounts file")
+	}
+	// touch from the least recently touched one, to keep the order
+	for i := len(bz) - common.AddressLength; i >= 0; i -= common.AddressLength {
+		h.Touch(common.BytesToAddress(bz[i : i+common.AddressLength]))
+	}
+	return h, nil
+}
+
+// Prepare the accounts and bytecodes of addrs in the trunk under ctx, which is shared by all the runners.
+// A throwaway RabbitStore only finds the short keys on their paths, and the trunk loads the entries of these
+// short keys into the hot cache of its root, which keeps them until the next block is written back.
+// ctx is not changed.
+func WarmUp(ctx *types.Context, addrs []common.Address) {
+	trunk := ctx.Rbt.GetBaseStore()
+	for _, addr := range addrs {
+		for _, k := range [2][]byte{types.GetAccountKey(addr), types.GetBytecodeKey(addr)} {
+			path, ok := ctx.Rbt.GetShortKeyPath(k)
+			if !ok {
+				continue
+			}
+			for _, sk := range path {
+				trunk.PrepareForUpdate(sk[:])
+			}
+		}
+	}
+}
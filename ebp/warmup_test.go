@@ -0,0 +1,65 @@
+package ebp
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartbch/moeingads/store"
+	"github.com/smartbch/moeingads/store/rabbit"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// prepareRecorder records the keys prepared for update
+type prepareRecorder struct {
+	*store.MockRootStore
+	prepared map[string]struct{}
+}
+
+func (r *prepareRecorder) PrepareForUpdate(key []byte) {
+	r.prepared[string(key)] = struct{}{}
+	r.MockRootStore.PrepareForUpdate(key)
+}
+
+func TestHotAccounts(t *testing.T) {
+	h := NewHotAccounts(3)
+	for _, b := range []byte{1, 2, 3, 1, 4} {
+		h.Touch(common.Address{b})
+	}
+	h.Touch(common.Address{})
+	expected := []common.Address{{4}, {1}, {3}}
+	require.Equal(t, expected, h.Addresses())
+
+	path := filepath.Join(t.TempDir(), "hot")
+	h2, err := LoadHotAccounts(path, 3)
+	require.NoError(t, err)
+	require.Empty(t, h2.Addresses())
+	require.NoError(t, h.Save(path))
+	h2, err = LoadHotAccounts(path, 3)
+	require.NoError(t, err)
+	require.Equal(t, expected, h2.Addresses())
+}
+
+func TestWarmUpPreparesTrunk(t *testing.T) {
+	root := &prepareRecorder{MockRootStore: store.NewMockRootStore(), prepared: make(map[string]struct{})}
+	hot, cold := common.Address{1}, common.Address{2}
+	rbt := rabbit.NewRabbitStore(root)
+	ctx := types.NewContext(&rbt, nil)
+	ctx.SetAccount(hot, types.ZeroAccountInfo())
+	ctx.Close(true)
+	rbt = rabbit.NewRabbitStore(root)
+	ctx = types.NewContext(&rbt, nil)
+	path, ok := ctx.Rbt.GetShortKeyPath(types.GetAccountKey(hot))
+	require.True(t, ok)
+	root.prepared = make(map[string]struct{}) // forget the ones prepared by the write-back
+
+	WarmUp(ctx, []common.Address{hot, cold})
+	// the trunk gets the short keys, and a missing account or bytecode is skipped
+	require.Len(t, root.prepared, len(path))
+	for _, sk := range path {
+		require.Contains(t, root.prepared, string(sk[:]))
+	}
+	ctx.Close(false)
+}
@@ -0,0 +1,127 @@
+package ebp
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// The heights at which an account was touched by a committed tx for the first and the last time
+type ActivityWatermark struct {
+	FirstSeen  int64
+	LastActive int64
+}
+
+// ActivityWatermarks keeps an ActivityWatermark for each account in a KVStore. The accounts touched by
+// the committed TXs of a block, i.e. their senders, recipients, created contracts and the destinations of
+// their internal calls, are updated once after the block is executed.
+type ActivityWatermarks struct {
+	mtx sync.Mutex
+	db  KVStore
+}
+
+func NewActivityWatermarks(db KVStore) *ActivityWatermarks {
+	return &ActivityWatermarks{db: db}
+}
+
+func watermarkKey(addr common.Address) []byte {
+	return append([]byte("aw-"), addr[:]...)
+}
+
+func (w *ActivityWatermarks) Get(addr common.Address) (ActivityWatermark, bool) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.get(addr)
+}
+
+func (w *ActivityWatermarks) get(addr common.Address) (ActivityWatermark, bool) {
+	bz := w.db.Get(watermarkKey(addr))
+	if len(bz) != 16 {
+		return ActivityWatermark{}, false
+	}
+	return ActivityWatermark{
+		FirstSeen:  int64(binary.BigEndian.Uint64(bz[:8])),
+		LastActive: int64(binary.BigEndian.Uint64(bz[8:])),
+	}, true
+}
+
+// Record that the accounts are active at height
+func (w *ActivityWatermarks) Touch(height int64, addrs []common.Address) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	for _, addr := range addrs {
+		wm, ok := w.get(addr)
+		if ok && wm.LastActive >= height {
+			continue
+		}
+		if !ok {
+			wm.FirstSeen = height
+		}
+		wm.LastActive = height
+		bz := make([]byte, 16)
+		binary.BigEndian.PutUint64(bz[:8], uint64(wm.FirstSeen))
+		binary.BigEndian.PutUint64(bz[8:], uint64(wm.LastActive))
+		w.db.Set(watermarkKey(addr), bz)
+	}
+}
+
+// Returns the distinct accounts touched by txs, except the zero address
+func touchedAccounts(txs []*types.Transaction) []common.Address {
+	seen := make(map[common.Address]struct{}, 2*len(txs))
+	addrs := make([]common.Address, 0, 2*len(txs))
+	add := func(addr common.Address) {
+		if _, ok := seen[addr]; ok || addr == (common.Address{}) {
+			return
+		}
+		seen[addr] = struct{}{}
+		addrs = append(addrs, addr)
+	}
+	for _, tx := range txs {
+		add(tx.From)
+		add(tx.To)
+		add(tx.ContractAddress)
+		for _, call := range tx.InternalTxCalls {
+			add(call.Destination)
+		}
+	}
+	return addrs
+}
+
+func (exec *txEngine) recordActivity() {
+	exec.watermarks.Touch(exec.currentBlock.Number, touchedAccounts(exec.committedTxs))
+}
+
+// AccountSummary is the overview of an account for explorers
+type AccountSummary struct {
+	Address    common.Address
+	Exists     bool
+	Balance    *uint256.Int
+	Nonce      uint64
+	CodeSize   int
+	FirstSeen  int64 // zero if the account has no watermark
+	LastActive int64
+}
+
+// Returns the summary of addr in ctx. The watermarks are not used if w is nil.
+func GetAccountSummary(ctx *types.Context, w *ActivityWatermarks, addr common.Address) *AccountSummary {
+	summary := &AccountSummary{Address: addr, Balance: uint256.NewInt(0)}
+	if acc := ctx.GetAccount(addr); acc != nil {
+		summary.Exists = true
+		summary.Balance = acc.Balance()
+		summary.Nonce = acc.Nonce()
+	}
+	if info := ctx.GetCode(addr); info != nil {
+		summary.CodeSize = len(info.BytecodeSlice())
+	}
+	if w != nil {
+		if wm, ok := w.Get(addr); ok {
+			summary.FirstSeen = wm.FirstSeen
+			summary.LastActive = wm.LastActive
+		}
+	}
+	return summary
+}
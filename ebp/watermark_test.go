@@ -0,0 +1,60 @@
+package ebp
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/evmwrap/testcase"
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestActivityWatermarks(t *testing.T) {
+	w := NewActivityWatermarks(memKVStore{})
+	_, ok := w.Get(common.Address{1})
+	require.False(t, ok)
+	w.Touch(5, []common.Address{{1}, {2}})
+	w.Touch(8, []common.Address{{1}})
+	w.Touch(7, []common.Address{{1}}) // not a later height
+	wm, ok := w.Get(common.Address{1})
+	require.True(t, ok)
+	require.Equal(t, ActivityWatermark{FirstSeen: 5, LastActive: 8}, wm)
+	wm, _ = w.Get(common.Address{2})
+	require.Equal(t, ActivityWatermark{FirstSeen: 5, LastActive: 5}, wm)
+
+	addrs := touchedAccounts([]*types.Transaction{
+		{From: common.Address{1}, To: common.Address{2},
+			InternalTxCalls: []types.InternalTxCall{{Destination: [20]byte{2}}, {Destination: [20]byte{3}}}},
+		{From: common.Address{1}, ContractAddress: common.Address{4}},
+	})
+	require.Equal(t, []common.Address{{1}, {2}, {3}, {4}}, addrs)
+}
+
+func TestActivityWatermarksInExecute(t *testing.T) {
+	AdjustGasUsed = false
+	trunk, root := prepareTruck()
+	defer closeTestCtx(root)
+	e := NewEbpTxExec(5, 100, 2, 10, &testcase.DumbSigner{}, log.NewNopLogger())
+	w := NewActivityWatermarks(memKVStore{})
+	e.SetActivityWatermarks(w)
+	e.SetContext(prepareCtx(trunk))
+	txs := prepareAccAndTx(e)
+	e.SetContext(prepareCtx(trunk))
+	e.CollectTx(txs[0])
+	e.Prepare(0, 0, DefaultTxGasLimit)
+	e.SetContext(prepareCtx(trunk))
+	e.Execute(&types.BlockInfo{Number: 3})
+	wm, ok := w.Get(to1)
+	require.True(t, ok)
+	require.Equal(t, ActivityWatermark{FirstSeen: 3, LastActive: 3}, wm)
+
+	summary := GetAccountSummary(e.cleanCtx, w, from1)
+	require.True(t, summary.Exists)
+	require.Equal(t, uint64(1), summary.Nonce)
+	require.Equal(t, int64(3), summary.LastActive)
+	summary = GetAccountSummary(e.cleanCtx, nil, common.Address{0xee})
+	require.False(t, summary.Exists)
+	require.True(t, summary.Balance.IsZero())
+}
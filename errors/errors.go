@@ -0,0 +1,49 @@
+// Package errors defines the errors returned by moeingevm, such that callers can check them with
+// errors.Is instead of matching strings. It can be imported in place of the standard "errors".
+package errors
+
+import (
+	stderrors "errors"
+)
+
+var (
+	ErrAccountNotExist        = New("account does not exist")
+	ErrNonceTooSmall          = New("tx nonce is smaller than the account nonce")
+	ErrNonceTooLarge          = New("tx nonce is larger than the account nonce")
+	ErrSameNonceAlredyInBlock = New("tx with same nonce already in block")
+	ErrBalanceNotEnough       = New("balance not enough")
+	ErrBlockedAccount         = New("Blocked Account")
+	ErrQueueCorrupted         = New("standby queue is corrupted")
+	ErrInputTooShort          = New("input two short")
+	ErrInvalidInputLength     = New("invalid input length")
+	ErrAlreadyKnown           = New("tx is already known")
+	ErrTxTooLarge             = New("tx is too large")
+	ErrInvalidWitness         = New("invalid witness of archived account")
+	ErrNotCallableByContract  = New("system contract cannot be called by contracts")
+	ErrSupplyNotConserved     = New("supply is not conserved")
+	ErrExecutionReverted      = New("execution reverted")
+	ErrGasExceedsAllowance    = New("gas required exceeds allowance")
+	ErrOutOfGas               = New("out of gas")
+	ErrWriteProtection        = New("write protection")
+	ErrStateNotAvailable      = New("the world state is not available")
+	ErrRandomBeaconNotFound   = New("random beacon not found")
+	ErrValueTooLarge          = New("value is too large")
+	ErrStorageQuotaExceeded   = New("storage quota exceeded")
+	ErrTooManyEntries         = New("too many candidicate entries to be returned, please limit the difference between startHeight and endHeight")
+)
+
+func New(text string) error {
+	return stderrors.New(text)
+}
+
+func Is(err, target error) bool {
+	return stderrors.Is(err, target)
+}
+
+func As(err error, target interface{}) bool {
+	return stderrors.As(err, target)
+}
+
+func Unwrap(err error) error {
+	return stderrors.Unwrap(err)
+}
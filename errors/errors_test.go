@@ -0,0 +1,36 @@
+package errors
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testError struct {
+	msg string
+}
+
+func (e *testError) Error() string {
+	return e.msg
+}
+
+func TestWrappedSentinels(t *testing.T) {
+	err := fmt.Errorf("%w: unknown format %d", ErrQueueCorrupted, 100)
+	require.True(t, Is(err, ErrQueueCorrupted))
+	require.False(t, Is(err, ErrTxTooLarge))
+	require.Equal(t, ErrQueueCorrupted, Unwrap(err))
+
+	// wrapped more than once
+	err = fmt.Errorf("prepare: %w", fmt.Errorf("%w: nonce 3", ErrNonceTooSmall))
+	require.True(t, Is(err, ErrNonceTooSmall))
+	require.Nil(t, Unwrap(Unwrap(Unwrap(err))))
+
+	// a new error with the same text is not the sentinel
+	require.False(t, Is(New(ErrOutOfGas.Error()), ErrOutOfGas))
+
+	err = fmt.Errorf("call: %w", &testError{msg: "custom"})
+	var target *testError
+	require.True(t, As(err, &target))
+	require.Equal(t, "custom", target.msg)
+}
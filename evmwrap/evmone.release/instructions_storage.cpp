@@ -130,6 +130,9 @@ Result sstore(StackTop stack, int64_t gas_left, ExecutionState& state) noexcept
             instr::cold_sload_cost :
             0;
     const auto status = state.host.set_storage(state.msg->recipient, key, value);
+    // the storage quota of the contract is exceeded, which is not an evmc_storage_status
+    if (status > EVMC_STORAGE_MODIFIED_RESTORED)
+        return {EVMC_FAILURE, gas_left};
 
     const auto [gas_cost_warm, gas_refund] = sstore_costs[state.rev][status];
     const auto gas_cost = gas_cost_warm + gas_cost_cold;
@@ -30,6 +30,8 @@ int64_t zero_depth_call_wrap(evmc_bytes32 gas_price,
                      const evmc_bytes32* value,
                      const uint8_t* input_data,
                      size_t input_size,
+                     const struct access_list_entry* access_list,
+                     size_t access_list_size,
 		     const struct block_info* block,
 		     int handler,
 		     bool need_gas_estimation,
@@ -493,6 +495,8 @@ func runTestCaseWithGasLimit(filename string, theCase *tc.TestCase, printLog boo
 		&value,
 		data_ptr,
 		C.size_t(len(currTx.Data)),
+		nil,
+		0,
 		&bi,
 		0,
 		C.bool(mode == ESTIMATE_GAS),
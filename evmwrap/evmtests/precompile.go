@@ -26,7 +26,8 @@ import "C"
 //byte{9}): &blake2F{},
 
 //export call_precompiled_contract
-func call_precompiled_contract(contract_addr *evmc_address,
+func call_precompiled_contract(handler C.int,
+	contract_addr *evmc_address,
 	input_ptr unsafe.Pointer,
 	input_size C.int,
 	gas_left *C.uint64_t,
@@ -72,3 +73,24 @@ func call_precompiled_contract(contract_addr *evmc_address,
 	*out_of_gas = 0
 	//return
 }
+
+// The native modules are not enabled in the tests of evmwrap
+//
+//export call_native_module
+func call_native_module(handler C.int,
+	txctrl unsafe.Pointer,
+	module_addr *evmc_address,
+	caller *evmc_address,
+	value *evmc_bytes32,
+	is_static C.bool,
+	input_ptr unsafe.Pointer,
+	input_size C.int,
+	gas_left *C.uint64_t,
+	ret_value *C.int,
+	out_of_gas *C.int,
+	output_ptr *small_buffer,
+	output_size *C.int) {
+	*output_size = 0
+	*ret_value = 0
+	*out_of_gas = 0
+}
@@ -85,6 +85,14 @@ struct internal_tx_return {
 	evmc_address create_address;
 };
 
+// exec_metrics counts the snapshots of the cached state taken by the call frames of a transaction, and the
+// reverts to them, which undo the changes made after the snapshots.
+struct exec_metrics {
+	uint32_t snapshot_num;
+	uint32_t revert_num;
+	uint64_t reverted_change_num; // the journal entries undone by the reverts
+};
+
 struct all_changed {
 	//these member pointers can point to keys and values in a hash map, 
 	//as long as the map is not rehashed.
@@ -104,11 +112,32 @@ struct all_changed {
 	size_t internal_tx_call_num;
 	struct internal_tx_return* internal_tx_returns;
 	size_t internal_tx_return_num;
+	struct exec_metrics metrics;
+	bool storage_quota_exceeded; // whether a call failed for storing a slot beyond the storage quota
+};
+
+// trace_step describes the state of the EVM before an instruction is executed
+struct trace_step {
+	uint32_t pc;
+	uint8_t opcode;
+	int32_t depth;
+	int64_t gas;
+	int64_t refund;
+	evmc_address address; // the account whose code is running
+	evmc_uint256be* stack; // from the bottom to the top
+	size_t stack_size;
+	const uint8_t* memory;
+	size_t memory_size;
 };
 
 struct config {
 	bool after_xhedge_fork;
 	bool after_symbolsbch_fork;
+	bool bls_precompiles; // EIP-2537
+	bool schnorr_precompile;
+	bool bch_spv_precompile;
+	bool random_beacon_precompile;
+	bool native_modules;
 };
 
 // Go environment passes information about a block through this struct to C environment
@@ -119,9 +148,18 @@ struct block_info {
 	int64_t gas_limit;         /**< The block gas limit. */
 	struct evmc_bytes32 difficulty; /**< The block difficulty. */
 	struct evmc_bytes32 chain_id;   /**< The blockchain's ChainID. */
+	struct evmc_bytes32 base_fee;   /**< The block base fee per gas, used by BASEFEE since London. */
 	struct config cfg;
 };
 
+// An entry of the EIP-2930 access list, which is warm since the TX starts. It is the storage slot 'key' of
+// 'addr' if is_slot is true, otherwise it is the account 'addr'.
+struct access_list_entry {
+	struct evmc_address addr;
+	struct evmc_bytes32 key;
+	bool is_slot;
+};
+
 // a big buffer is large enough to contain a 24KB bytecode
 struct big_buffer {
 	//uint8_t data[24*1024];
@@ -137,6 +175,11 @@ struct small_buffer {
 	uint8_t data[SMALL_BUF_SIZE]; //bigModExp's output is variable-length, but we support 2048 bytes at most
 };
 
+// tx_control::set_value returns it instead of changing the value, when a contract would occupy more storage
+// slots than its quota, and the call storing the value fails. It is out of the range of evmc_storage_status,
+// so SSTORE checks it before looking up the gas cost of the status.
+#define EVMC_STORAGE_QUOTA_EXCEEDED ((enum evmc_storage_status)(EVMC_STORAGE_MODIFIED_RESTORED + 1))
+
 // Pointers of the following functions will be provided by the Go environment
 typedef uint64_t (*bridge_get_creation_counter_fn)(int handler, uint8_t);
 typedef void (*bridge_get_account_info_fn)(int handler,
@@ -155,8 +198,11 @@ typedef void (*bridge_get_value_fn)(int handler,
                                     struct big_buffer* buf,
                                     size_t* size);
 typedef struct evmc_bytes32 (*bridge_get_block_hash_fn)(int handler, uint64_t num);
+// returns how many more storage slots the contract with acc_sequence may occupy
+typedef uint64_t (*bridge_get_storage_quota_fn)(int handler, uint64_t acc_sequence);
 typedef void (*bridge_collect_result_fn)(int handler, struct all_changed* result, struct evmc_result* ret_value);
-typedef void (*bridge_call_precompiled_contract_fn)(struct evmc_address* contract_addr,
+typedef void (*bridge_call_precompiled_contract_fn)(int handler,
+                                                    struct evmc_address* contract_addr,
                                                     void* input_ptr,
                                                     int input_size,
                                                     uint64_t *gas_left,
@@ -164,6 +210,23 @@ typedef void (*bridge_call_precompiled_contract_fn)(struct evmc_address* contrac
                                                     int* out_of_gas,
                                                     struct small_buffer* output_ptr,
                                                     int* output_size);
+typedef void (*bridge_call_native_module_fn)(int handler,
+                                             void* txctrl,
+                                             struct evmc_address* module_addr,
+                                             struct evmc_address* caller,
+                                             struct evmc_bytes32* value,
+                                             bool is_static,
+                                             void* input_ptr,
+                                             int input_size,
+                                             uint64_t *gas_left,
+                                             int* ret_value,
+                                             int* out_of_gas,
+                                             struct small_buffer* output_ptr,
+                                             int* output_size);
+
+// These two functions are provided only when the instructions are traced, otherwise they are null
+typedef void (*bridge_trace_step_fn)(int handler, struct trace_step* step);
+typedef void (*bridge_trace_end_fn)(int handler, int32_t depth, enum evmc_status_code status_code, int64_t gas_left);
 
 typedef evmc_execute_fn (*bridge_query_executor_fn)(const evmc_address* destination);
 
@@ -177,6 +240,8 @@ int64_t zero_depth_call(evmc_uint256be gas_price,
                      const evmc_uint256be* value,
                      const uint8_t* input_data,
                      size_t input_size,
+		     const struct access_list_entry* access_list,
+		     size_t access_list_size,
 		     const struct block_info* block,
 		     int handler,
 		     bool need_gas_estimation,
@@ -188,7 +253,20 @@ int64_t zero_depth_call(evmc_uint256be gas_price,
 		     bridge_get_value_fn get_value_fn,
 		     bridge_get_block_hash_fn get_block_hash_fn,
 		     bridge_collect_result_fn collect_result_fn,
-		     bridge_call_precompiled_contract_fn call_precompiled_contract_fn);
+		     bridge_call_precompiled_contract_fn call_precompiled_contract_fn,
+		     bridge_call_native_module_fn call_native_module_fn,
+		     bridge_get_storage_quota_fn get_storage_quota_fn,
+		     bridge_trace_step_fn trace_step_fn,
+		     bridge_trace_end_fn trace_end_fn);
+
+// The native modules in Go access the cached state of the running TX with the following functions, whose
+// txctrl is the one passed to bridge_call_native_module_fn. The changes are recorded in the journal, thus
+// they are reverted if the module fails or the calling frame reverts.
+const uint8_t* native_module_get_value(void* txctrl, uint64_t sequence, const struct evmc_bytes32* key, size_t* size);
+// returns the evmc_storage_status of the change, or EVMC_STORAGE_QUOTA_EXCEEDED
+int native_module_set_value(void* txctrl, uint64_t sequence, const struct evmc_bytes32* key, const uint8_t* data, size_t size);
+void native_module_get_balance(void* txctrl, const struct evmc_address* addr, struct evmc_bytes32* balance);
+bool native_module_transfer(void* txctrl, const struct evmc_address* sender, const struct evmc_address* recipient, const struct evmc_bytes32* value);
 
 #ifdef __cplusplus
 }
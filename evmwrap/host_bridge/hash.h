@@ -49,3 +49,25 @@ public:
 	}
 };
 
+
+// EIP-2929 tracks the accessed storage slots by address, instead of by sequence, because a new contract's
+// sequence is allocated after its address is accessed.
+struct slot_key {
+	evmc_address addr;
+	evmc_bytes32 key;
+};
+
+class hashfn_slot_key {
+public:
+	size_t operator() (slot_key const& k) const {
+		return fasthash(&k.addr.bytes[0], sizeof(evmc_address)) ^
+			fasthash(&k.key.bytes[0], sizeof(evmc_bytes32));
+	}
+};
+class equalfn_slot_key {
+public:
+	bool operator() (slot_key const& k1, slot_key const& k2) const {
+		return memcmp(k1.addr.bytes, k2.addr.bytes, sizeof(evmc_address)) == 0 &&
+			memcmp(k1.key.bytes, k2.key.bytes, sizeof(evmc_bytes32)) == 0;
+	}
+};
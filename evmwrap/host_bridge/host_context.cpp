@@ -2,6 +2,7 @@
 #include <array>
 #include <iostream>
 #include "host_context.h"
+#include "step_tracer.h"
 extern "C" {
 #include "../sha256/sha256.h"
 #include "../ripemd160/ripemd160.h"
@@ -22,8 +23,13 @@ static inline int64_t get_precompiled_id(const evmc_address& addr) {
 
 static inline bool is_precompiled(int64_t id, const config cfg) {
 	return (1 <= id && id <= 9) ||
+	       (0x0a <= id && id <= 0x12 && cfg.bls_precompiles) ||
 	       id == STAKING_CONTRACT_ID ||
 	       (id == SEP109_CONTRACT_ID && cfg.after_xhedge_fork) ||
+	       (id == SCHNORR_CONTRACT_ID && cfg.schnorr_precompile) ||
+	       (id == BCH_SPV_CONTRACT_ID && cfg.bch_spv_precompile) ||
+	       (id == RANDOM_BEACON_CONTRACT_ID && cfg.random_beacon_precompile) ||
+	       (NATIVE_MODULE_ID_START <= id && id <= NATIVE_MODULE_ID_END && cfg.native_modules) ||
 	       id == SEP101_CONTRACT_ID ||
 	       id == SEP206_CONTRACT_ID;
 }
@@ -298,6 +304,14 @@ bool evmc_host_context::selfdestruct(const evmc_address& addr, const evmc_addres
 	return refund;
 }
 
+// the precompiled contracts are always warm (EIP-2929)
+enum evmc_access_status evmc_host_context::access_account(const evmc_address& address) {
+	if(is_precompiled(address, txctrl->get_cfg())) {
+		return EVMC_ACCESS_WARM;
+	}
+	return txctrl->access_account(address);
+}
+
 // load bytecode into this->code before running it
 void evmc_host_context::load_code(const evmc_address& addr) {
 	const account_info& acc = txctrl->get_account(msg.recipient);
@@ -425,12 +439,15 @@ evmc_result evmc_host_context::run_precompiled_contract(const evmc_address& addr
 		return run_precompiled_contract_sep101();
 	} else if(id == SEP206_CONTRACT_ID) {
 		return run_precompiled_contract_sep206();
+	} else if(NATIVE_MODULE_ID_START <= id && id <= NATIVE_MODULE_ID_END) {
+		return run_native_module(addr);
 	}
 	// the others use golang implementations
 	int ret_value, out_of_gas, osize;
 	uint64_t gas_left = msg.gas;
 
-	this->txctrl->call_precompiled_contract((struct evmc_address*)&addr/*drop const*/, (void*)msg.input_data,
+	this->txctrl->call_precompiled_contract(this->txctrl->get_handler(),
+			(struct evmc_address*)&addr/*drop const*/, (void*)msg.input_data,
 			msg.input_size, &gas_left, &ret_value, &out_of_gas, this->smallbuf, &osize);
 	if(out_of_gas != 0) {
 		return evmc_result{.status_code=EVMC_OUT_OF_GAS};
@@ -445,6 +462,53 @@ evmc_result evmc_host_context::run_precompiled_contract(const evmc_address& addr
 		.output_size=uint64_t(osize)};
 }
 
+// A native module is a precompiled contract with state, which is implemented in Go and accesses the cached
+// state of this TX with the native_module_* functions. When it fails, call() reverts its changes.
+evmc_result evmc_host_context::run_native_module(const evmc_address& addr) {
+	int ret_value, out_of_gas, osize;
+	uint64_t gas_left = msg.gas;
+
+	this->txctrl->call_native_module(this->txctrl->get_handler(), (void*)this->txctrl,
+			(struct evmc_address*)&addr/*drop const*/, &msg.sender, &msg.value,
+			(msg.flags & EVMC_STATIC) != 0, (void*)msg.input_data, msg.input_size,
+			&gas_left, &ret_value, &out_of_gas, this->smallbuf, &osize);
+	if(out_of_gas != 0) {
+		return evmc_result{.status_code=EVMC_OUT_OF_GAS};
+	}
+	if(ret_value != 1) {
+		return evmc_result{.status_code=EVMC_PRECOMPILE_FAILURE};
+	}
+	return evmc_result{
+		.status_code=EVMC_SUCCESS,
+		.gas_left=int64_t(gas_left),
+		.output_data=this->smallbuf->data,
+		.output_size=uint64_t(osize)};
+}
+
+const uint8_t* native_module_get_value(void* txctrl, uint64_t sequence, const evmc_bytes32* key, size_t* size) {
+	const bytes& bz = ((tx_control*)txctrl)->get_value(sequence, *key);
+	*size = bz.size();
+	return bz.data();
+}
+
+int native_module_set_value(void* txctrl, uint64_t sequence, const evmc_bytes32* key, const uint8_t* data, size_t size) {
+	return int(((tx_control*)txctrl)->set_value(sequence, *key, bytes_info{.data=data, .size=size}));
+}
+
+void native_module_get_balance(void* txctrl, const evmc_address* addr, evmc_uint256be* balance) {
+	const account_info& info = ((tx_control*)txctrl)->get_account(*addr);
+	if(info.is_null() || info.selfdestructed) {
+		*balance = ZERO_BYTES32;
+		return;
+	}
+	*balance = u256_to_u256be(info.balance);
+}
+
+bool native_module_transfer(void* txctrl, const evmc_address* sender, const evmc_address* recipient, const evmc_uint256be* value) {
+	bool is_nop;
+	return transfer((tx_control*)txctrl, *sender, *recipient, *value, &is_nop);
+}
+
 inline void sha256(const uint8_t* data, size_t size, uint8_t* out) {
 	SHA256_CTX ctx;
 	sha256_init(&ctx);
@@ -548,6 +612,7 @@ evmc_result evmc_host_context::create_with_contract_addr(const evmc_address& add
 	this->codehash = ZERO_BYTES32;
 	msg.input_size = 0;
 
+	txctrl->access_account(addr); // the new contract is warm, unless the caller reverts
 	size_t snapshot = txctrl->snapshot(); //if failed, revert account creation
 	if(txctrl->get_account(addr).is_null() || txctrl->get_account(addr).is_empty()) {
 		txctrl->new_account(addr);
@@ -633,6 +698,8 @@ int64_t zero_depth_call(evmc_uint256be gas_price,
                      const evmc_uint256be* value,
                      const uint8_t* input_data,
                      size_t input_size,
+		     const access_list_entry* access_list,
+		     size_t access_list_size,
 		     const block_info* block,
 		     int handler,
 		     bool need_gas_estimation,
@@ -644,7 +711,11 @@ int64_t zero_depth_call(evmc_uint256be gas_price,
 		     bridge_get_value_fn get_value_fn,
 		     bridge_get_block_hash_fn get_block_hash_fn,
 		     bridge_collect_result_fn collect_result_fn,
-		     bridge_call_precompiled_contract_fn call_precompiled_contract_fn) {
+		     bridge_call_precompiled_contract_fn call_precompiled_contract_fn,
+		     bridge_call_native_module_fn call_native_module_fn,
+		     bridge_get_storage_quota_fn get_storage_quota_fn,
+		     bridge_trace_step_fn trace_step_fn,
+		     bridge_trace_end_fn trace_end_fn) {
 
 	std::array<big_buffer, 1> bigbuf;
 	auto r = world_state_reader {
@@ -653,6 +724,7 @@ int64_t zero_depth_call(evmc_uint256be gas_price,
 		.get_bytecode_fn = get_bytecode_fn,
 		.get_value_fn = get_value_fn,
 		.get_block_hash_fn = get_block_hash_fn,
+		.get_storage_quota_fn = get_storage_quota_fn,
 		.bigbuf = &bigbuf[0],
 		.handler = handler
 	};
@@ -681,7 +753,8 @@ int64_t zero_depth_call(evmc_uint256be gas_price,
 		.block_timestamp = block->timestamp,
 		.block_gas_limit = block->gas_limit,
 		.block_prev_randao = block->difficulty,
-		.chain_id = block->chain_id
+		.chain_id = block->chain_id,
+		.block_base_fee = block->base_fee
 	};
 	auto msg = evmc_message {
 		.kind = is_contract_creation? EVMC_CREATE : EVMC_CALL,
@@ -695,8 +768,27 @@ int64_t zero_depth_call(evmc_uint256be gas_price,
 		.value = *value
 	};
 	evmc_vm* vm = evmc_create_evmone();
-	tx_control txctrl(&r, tx_context, vm->execute, query_executor_fn, 
-			call_precompiled_contract_fn, need_gas_estimation, block->cfg);
+	tx_control txctrl(&r, tx_context, vm, query_executor_fn, 
+			call_precompiled_contract_fn, call_native_module_fn, need_gas_estimation, block->cfg);
+	if(trace_step_fn) {
+		add_step_tracer(vm, handler, trace_step_fn, trace_end_fn);
+		txctrl.set_tracing_vm(vm);
+	}
+	// EIP-2929: the origin and the recipient are warm from the beginning, and EIP-3651 warms the coinbase
+	txctrl.warm_account(*sender);
+	if(!is_contract_creation) {
+		txctrl.warm_account(*recipient);
+	}
+	if(revision >= EVMC_SHANGHAI) {
+		txctrl.warm_account(block->coinbase);
+	}
+	for(size_t i = 0; i < access_list_size; i++) {
+		if(access_list[i].is_slot) {
+			txctrl.warm_storage(access_list[i].addr, access_list[i].key);
+		} else {
+			txctrl.warm_account(access_list[i].addr);
+		}
+	}
 	small_buffer smallbuf;
 	evmc_host_context ctx(&txctrl, msg, &smallbuf, revision);
 	uint256 balance = ctx.get_balance_as_uint256(*sender);
@@ -796,7 +888,7 @@ evmc_result evmc_host_context::run_precompiled_contract_sep101() {
 			.release = (length > SMALL_BUF_SIZE)? evmc_free_result_memory : nullptr};
 	}
 	if((msg.flags & EVMC_STATIC) != 0) { // staticcall is not allowed here
-		return evmc_result{.status_code=EVMC_PRECOMPILE_FAILURE};
+		return evmc_result{.status_code=EVMC_STATIC_MODE_VIOLATION};
 	}
 	const uint8_t* value_ptr = msg.input_data + 4 + 3*32 + key_words*32;
 	uint256 value_len_256 = beptr_to_u256(value_ptr);
@@ -813,6 +905,9 @@ evmc_result evmc_host_context::run_precompiled_contract_sep101() {
 	}
 	evmc_storage_status status = txctrl->set_value(msg.recipient, key_hash,
 			                   bytes_info{.data=value_ptr+32, .size=value_len});
+	if(status == EVMC_STORAGE_QUOTA_EXCEEDED) {
+		return evmc_result{.status_code=EVMC_FAILURE};
+	}
 	switch (status) { // gas for the first 32 bytes
 	case EVMC_STORAGE_MODIFIED:
 	case EVMC_STORAGE_DELETED:
@@ -1099,7 +1194,7 @@ evmc_result evmc_host_context::run_precompiled_contract_sep206() {
 		case SELECTOR_SEP206_TRANSFER:
 		case SELECTOR_SEP206_TRANSFERFROM:
 			if((msg.flags & EVMC_STATIC) != 0) {
-				return evmc_result{.status_code=EVMC_PRECOMPILE_FAILURE};
+				return evmc_result{.status_code=EVMC_STATIC_MODE_VIOLATION};
 			}
 			break;
 		default:
@@ -42,6 +42,12 @@ const uint32_t SEP206_DECREASEALLOWANCE_GAS = 31000;
 const uint32_t SEP206_TRANSFER_GAS = 32000;
 const uint32_t SEP206_TRANSFERFROM_GAS = 40000;
 
+// the native modules in Go are at the addresses in this range
+const int64_t NATIVE_MODULE_ID_START = 0x2800;
+const int64_t NATIVE_MODULE_ID_END = 0x28ff;
+const int64_t RANDOM_BEACON_CONTRACT_ID = 0x2718;
+const int64_t BCH_SPV_CONTRACT_ID = 0x2716;
+const int64_t SCHNORR_CONTRACT_ID = 0x2715;
 const int64_t SEP109_CONTRACT_ID = 0x2713;
 const int64_t SEP101_CONTRACT_ID = 0x2712;
 const int64_t SEP206_CONTRACT_ID = 0x2711;
@@ -167,6 +173,7 @@ public:
 	evmc_result run_precompiled_contract_echo();
 	evmc_result run_precompiled_contract_sep101();
 	evmc_result run_precompiled_contract_sep206();
+	evmc_result run_native_module(const evmc_address& addr);
 	evmc_result sep206_balanceOf();
 	evmc_result sep206_allowance();
 	evmc_result sep206_approve(bool new_value, bool increase);
@@ -179,9 +186,7 @@ public:
 	evmc_result create2();
 	bool create_pre_check(const evmc_address& new_addr);
 	evmc_result create_with_contract_addr(const evmc_address& addr);
-	enum evmc_access_status access_account(const evmc_address& address) {
-		return txctrl->access_account(address);
-	}
+	enum evmc_access_status access_account(const evmc_address& address);
 	enum evmc_access_status access_storage(const evmc_address& addr, const evmc_bytes32& key) {
 		return txctrl->access_storage(addr, key);
 	}
@@ -0,0 +1,62 @@
+#include <memory>
+#include <vector>
+#include "../evmone/vm.hpp"
+#include "../evmone/execution_state.hpp"
+#include "step_tracer.h"
+
+namespace {
+
+class step_tracer : public evmone::Tracer {
+	int handler;
+	bridge_trace_step_fn trace_step_fn;
+	bridge_trace_end_fn trace_end_fn;
+	struct context {
+		int32_t depth;
+		const uint8_t* code;
+	};
+	std::vector<context> contexts; // the nested executions
+	std::vector<evmc_uint256be> stack_buf;
+
+	void on_execution_start(evmc_revision /*rev*/, const evmc_message& msg,
+			evmone::bytes_view code) noexcept override {
+		contexts.push_back(context{.depth = msg.depth, .code = code.data()});
+	}
+
+	void on_instruction_start(uint32_t pc, const intx::uint256* stack_top, int stack_height,
+			int64_t gas, const evmone::ExecutionState& state) noexcept override {
+		const intx::uint256* stack_bottom = stack_top + 1 - stack_height;
+		stack_buf.resize(stack_height);
+		for(int i = 0; i < stack_height; i++) {
+			intx::be::store(stack_buf[i].bytes, stack_bottom[i]);
+		}
+		trace_step step {
+			.pc = pc,
+			.opcode = contexts.back().code[pc],
+			.depth = state.msg->depth,
+			.gas = gas,
+			.refund = state.gas_refund,
+			.address = state.msg->recipient,
+			.stack = stack_buf.data(),
+			.stack_size = size_t(stack_height),
+			.memory = state.memory.data(),
+			.memory_size = state.memory.size()
+		};
+		trace_step_fn(handler, &step);
+	}
+
+	void on_execution_end(const evmc_result& result) noexcept override {
+		trace_end_fn(handler, contexts.back().depth, result.status_code, result.gas_left);
+		contexts.pop_back();
+	}
+public:
+	step_tracer(int h, bridge_trace_step_fn step_fn, bridge_trace_end_fn end_fn):
+		handler(h), trace_step_fn(step_fn), trace_end_fn(end_fn) {
+		stack_buf.reserve(1024);
+	}
+};
+
+}  // namespace
+
+void add_step_tracer(evmc_vm* vm, int handler, bridge_trace_step_fn trace_step_fn, bridge_trace_end_fn trace_end_fn) {
+	static_cast<evmone::VM*>(vm)->add_tracer(std::make_unique<step_tracer>(handler, trace_step_fn, trace_end_fn));
+}
@@ -0,0 +1,8 @@
+#pragma once
+
+#include "bridge.h"
+
+// Attach a tracer to the evmone instance vm. Before each instruction is interpreted, it reports the state
+// of the EVM through trace_step_fn; when each execution ends, it reports the result through trace_end_fn.
+// It must be a separate translation unit from tx_ctrl.h, because evmone's intx conflicts with intx_nooverflow.
+void add_step_tracer(evmc_vm* vm, int handler, bridge_trace_step_fn trace_step_fn, bridge_trace_end_fn trace_end_fn);
@@ -222,12 +222,33 @@ const bytes& cached_state::set_value(uint64_t sequence, const evmc_bytes32& key,
 	}
 	*old_value = std::move(iter->second);
 	iter->second = bytes(value.data, value.size);
+	slot_deltas[sequence] += int64_t(value.size != 0) - int64_t(old_value->size() != 0);
 	return iter->second;
 }
 
 // undo the effect of set_value
 void cached_state::_set_value(uint64_t sequence, const evmc_bytes32& key, bytes* value) {
-	values[skey(sequence, key)] = std::move(*value);
+	bytes& curr = values[skey(sequence, key)];
+	slot_deltas[sequence] += int64_t(value->size() != 0) - int64_t(curr.size() != 0);
+	curr = std::move(*value);
+}
+
+// returns false if the contract with sequence occupies more new slots than its quota. The quota is fetched
+// from Go only once in a TX.
+bool cached_state::check_storage_quota(uint64_t sequence) {
+	int64_t delta = slot_deltas[sequence];
+	if(delta <= 0) {
+		return true;
+	}
+	auto iter = slot_quotas.find(sequence);
+	if(iter == slot_quotas.end()) {
+		iter = slot_quotas.emplace(sequence, world->get_storage_quota(sequence)).first;
+	}
+	if(uint64_t(delta) <= iter->second) {
+		return true;
+	}
+	storage_quota_exceeded = true;
+	return false;
 }
 
 // following functions collect the modifed(dirty) entries from several caches, which will
@@ -325,7 +346,8 @@ std::vector<added_log> cached_state::collect_logs() {
 
 void cached_state::collect_result(bridge_collect_result_fn collect_result_fn,
                                   int collector_handler,
-                                  const evmc_result* ret_value) {
+                                  const evmc_result* ret_value,
+                                  const exec_metrics& metrics) {
 	std::vector<changed_account> changed_accounts = collect_accounts();
 	std::vector<changed_creation_counter> changed_creation_counters = collect_creation_counters();
 	std::vector<changed_bytecode> changed_bytecodes = collect_bytecodes();
@@ -347,7 +369,9 @@ void cached_state::collect_result(bridge_collect_result_fn collect_result_fn,
 		.internal_tx_calls = internal_tx_calls.data(),
 		.internal_tx_call_num = internal_tx_calls.size(),
 		.internal_tx_returns = internal_tx_returns.data(),
-		.internal_tx_return_num = internal_tx_returns.size()
+		.internal_tx_return_num = internal_tx_returns.size(),
+		.metrics = metrics,
+		.storage_quota_exceeded = storage_quota_exceeded
 	};
 	//std::cerr<<"Here in collect_result "<<size_t(&changes)<<std::endl;
 	// use the following callback function to pass changes to Go environment
@@ -392,6 +416,12 @@ void journal_entry::revert(cached_state* state) {
 	case LOG_QUEUE_ADD:
 		state->pop_log();
 		break;
+	case ACCOUNT_ACCESS:
+		state->_unaccess_account(access.addr);
+		break;
+	case STORAGE_ACCESS:
+		state->_unaccess_storage(access.addr, access.key);
+		break;
 	}
 }
 
@@ -483,6 +513,11 @@ evmc_storage_status tx_control::set_value(uint64_t sequence, const evmc_bytes32&
 	e.value_change.sequence = sequence;
 	const bytes& new_value = cstate.set_value(sequence, key, raw_value, &e.prev_value);
 	journal.push_back(e);
+	if(e.prev_value.size() == 0 && new_value.size() != 0 && !cstate.check_storage_quota(sequence)) {
+		journal.back().revert(&cstate); // it is not changed
+		journal.pop_back();
+		return EVMC_STORAGE_QUOTA_EXCEEDED;
+	}
 	const bytes& origin = cstate.get_origin_value(sequence, key);
 	//If current value equals new value (this is a no-op), SLOAD_GAS is deducted.
 	if(e.prev_value == new_value) {
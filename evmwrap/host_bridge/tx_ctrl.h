@@ -4,6 +4,7 @@
 #include <string>
 #include <vector>
 #include <unordered_map>
+#include <unordered_set>
 #include <iostream>
 #include <string.h>
 #include "bridge.h"
@@ -139,6 +140,8 @@ using account_map = std::unordered_map<evmc_address, account_entry, hashfn_evmc_
 using creation_counter_map = std::unordered_map<uint8_t, creation_counter_entry>;
 using bytecode_map = std::unordered_map<evmc_address, bytecode_entry, hashfn_evmc_address, equalfn_evmc_address>;
 using value_map = std::unordered_map<storage_key, bytes, hashfn_storage_key, equalfn_storage_key>;
+using address_set = std::unordered_set<evmc_address, hashfn_evmc_address, equalfn_evmc_address>;
+using slot_set = std::unordered_set<slot_key, hashfn_slot_key, equalfn_slot_key>;
 
 // Read the world state from the underlying Go environment
 struct world_state_reader {
@@ -148,6 +151,7 @@ struct world_state_reader {
 	bridge_get_bytecode_fn get_bytecode_fn;
 	bridge_get_value_fn get_value_fn;
 	bridge_get_block_hash_fn get_block_hash_fn;
+	bridge_get_storage_quota_fn get_storage_quota_fn; // null if there is no storage quota
 	// bigbuf is where Go environment writes bytecode and value.
 	big_buffer* bigbuf;
 	// the handler to a TxRunner in Go environment
@@ -176,6 +180,12 @@ struct world_state_reader {
 	evmc_bytes32 get_block_hash(uint64_t num) {
 		return get_block_hash_fn(handler, num);
 	}
+	uint64_t get_storage_quota(uint64_t seq) {
+		if(!get_storage_quota_fn) {
+			return UINT64_MAX;
+		}
+		return get_storage_quota_fn(handler, seq);
+	}
 };
 
 // This is a cached subset of the world state, EVM can modify it. And when EVM reverts,
@@ -186,12 +196,20 @@ class cached_state {
 	bytecode_map bytecodes;
 	value_map values;
 	value_map origin_values;
+	// the accessed accounts and storage slots of EIP-2929, which do not depend on what is cached
+	address_set accessed_accounts;
+	slot_set accessed_slots;
 	world_state_reader* world;
 	std::vector<evm_log> logs;
 	friend struct journal_entry;
 	std::vector<internal_tx_call> internal_tx_calls;
 	std::vector<internal_tx_return> internal_tx_returns;
 	bytes payload_data;
+	// the storage slots occupied by the TX for each contract minus the ones it cleared, and the quotas of
+	// the contracts, which are how many more slots they may occupy
+	std::unordered_map<uint64_t, int64_t> slot_deltas;
+	std::unordered_map<uint64_t, uint64_t> slot_quotas;
+	bool storage_quota_exceeded = false;
 protected:
 	//the following protected functions are used by the journal_entry to undo modification
 	void _delete_account(const evmc_address& addr) {
@@ -205,6 +223,12 @@ protected:
 	void _set_value(uint64_t sequence, const evmc_bytes32& key, bytes* value);
 	void _undelete_bytecode(const evmc_address& addr, bool dirty);
 	void _unset_bytecode(const evmc_address& addr, bool dirty);
+	void _unaccess_account(const evmc_address& addr) {
+		accessed_accounts.erase(addr);
+	}
+	void _unaccess_storage(const evmc_address& addr, const evmc_bytes32& key) {
+		accessed_slots.erase(slot_key{.addr=addr, .key=key});
+	}
 public:
 	cached_state(world_state_reader* r):
 		accounts(), creation_counters(), bytecodes(), values(), world(r), logs() {
@@ -221,6 +245,7 @@ public:
 	const bytes& get_origin_value(uint64_t sequence, const evmc_bytes32& key);
 	const bytes& set_value(uint64_t sequence, const evmc_bytes32& key, bytes_info value, bytes* old_value);
 	const bytecode_entry& get_bytecode_entry(const evmc_address& addr);
+	bool check_storage_quota(uint64_t sequence);
 	void delete_bytecode(const evmc_address& addr, bool* old_dirty);
 	void set_bytecode(const evmc_address& addr, uint64_t sequence, const bytes& code, const evmc_bytes32& codehash, bool* old_dirty);
 	void update_bytecode(const evmc_address& addr, const bytes& code, const evmc_bytes32& codehash);
@@ -234,9 +259,13 @@ public:
 	bool has_account(const evmc_address& addr) {
 		return accounts.find(addr) != accounts.end();
 	}
-	bool has_value(uint64_t sequence, const evmc_bytes32& key) {
-		storage_key k = skey(sequence, key);
-		return values.find(k) != values.end();
+	// returns true if the account was not accessed before
+	bool add_accessed_account(const evmc_address& addr) {
+		return accessed_accounts.insert(addr).second;
+	}
+	// returns true if the storage slot was not accessed before
+	bool add_accessed_storage(const evmc_address& addr, const evmc_bytes32& key) {
+		return accessed_slots.insert(slot_key{.addr=addr, .key=key}).second;
 	}
 	// Before the transaction exits, the Go environment should examine how this cached subset was modified.
 	// The modified entries in cache are marked as "dirty".
@@ -248,7 +277,8 @@ public:
 	std::vector<added_log> collect_logs();
 	void collect_result(bridge_collect_result_fn collect_result_fn,
 			int collector_handler,
-			const evmc_result* ret_value);
+			const evmc_result* ret_value,
+			const exec_metrics& metrics);
 	void add_internal_tx_call(const evmc_message& msg) {
 		internal_tx_call itx_call;
 		itx_call.kind = msg.kind;
@@ -287,6 +317,8 @@ enum journal_type {
 	BYTECODE_CREATE,
 	CREATION_COUNTER_INCR,
 	LOG_QUEUE_ADD,
+	ACCOUNT_ACCESS,
+	STORAGE_ACCESS,
 };
 
 // We use Tagged-Union for journal_entry, instead of interface pointers, because it's friendly 
@@ -337,6 +369,11 @@ struct journal_entry {
 			uint8_t lsb;
 			bool old_dirty;
 		} creation_counter_incr;
+
+		struct {
+			evmc_address addr;
+			evmc_bytes32 key; // only used by STORAGE_ACCESS
+		} access;
 	};
 	void revert(cached_state* state);
 };
@@ -351,18 +388,24 @@ class tx_control {
 	cached_state cstate;
 	world_state_reader* world;
 	evmc_tx_context tx_context;
+	evmc_vm* vm; // the interpreter, which reads its tracers from vm
 	evmc_execute_fn execute_fn;
 	bridge_query_executor_fn query_executor_fn;
 	bool need_gas_estimation;
 	config cfg;
+	evmc_vm* tracing_vm = nullptr; // the VM with a tracer, which runs all the code if it is not null
+	exec_metrics metrics = {};
 public:
 	// this function provides precompile contracts' functionality from Go to C
 	bridge_call_precompiled_contract_fn call_precompiled_contract;
-
-	tx_control(world_state_reader* r, const evmc_tx_context& c, evmc_execute_fn f,
-		bridge_query_executor_fn qef, bridge_call_precompiled_contract_fn cpc, bool nge, const config cfg):
-		journal(), cstate(r), world(r), tx_context(c), execute_fn(f), query_executor_fn(qef),
-		need_gas_estimation(nge), cfg(cfg), call_precompiled_contract(cpc) {
+	// this function dispatches the calls to the native modules in Go
+	bridge_call_native_module_fn call_native_module;
+
+	tx_control(world_state_reader* r, const evmc_tx_context& c, evmc_vm* vm,
+		bridge_query_executor_fn qef, bridge_call_precompiled_contract_fn cpc, bridge_call_native_module_fn cnm,
+		bool nge, const config cfg):
+		journal(), cstate(r), world(r), tx_context(c), vm(vm), execute_fn(vm->execute), query_executor_fn(qef),
+		need_gas_estimation(nge), cfg(cfg), call_precompiled_contract(cpc), call_native_module(cnm) {
 		journal.reserve(100);
 		if(need_gas_estimation) {
 			gas_trace.reserve(100);
@@ -373,10 +416,19 @@ public:
 		return cfg;
 	}
 
+	// the handler to the TxRunner, with which the precompiled contracts in Go read the world state
+	int get_handler() {
+		return world->handler;
+	}
+
 	int64_t get_block_number() {
 		return tx_context.block_number;
 	}
 
+	void set_tracing_vm(evmc_vm* vm) {
+		tracing_vm = vm;
+	}
+
 	void gas_trace_append(int64_t gas) {
 		if(need_gas_estimation) gas_trace.push_back(gas);
 	}
@@ -389,6 +441,9 @@ public:
 			    const struct evmc_address* code_addr,
 	                    uint8_t const* code,
 	                    size_t code_size) {
+		if(tracing_vm) { // AOT-compiled code cannot be traced, so the interpreter is used
+			return execute_fn(tracing_vm, host, context, rev, msg, code, code_size);
+		}
 		evmc_execute_fn executor = nullptr;
 		if(query_executor_fn && code_addr) { // Check AOT
 			executor = query_executor_fn(code_addr);
@@ -397,15 +452,20 @@ public:
 			executor = execute_fn;
 		}
 		//std::cout<<"query "<<to_hex(msg->recipient)<<" "<<size_t(executor)<<std::endl;
-		return executor(vm, host, context, rev, msg, code, code_size);
+		return executor(this->vm, host, context, rev, msg, code, code_size);
 	}
 	// a snapshot is just a position of the journal entry list
 	size_t snapshot() {
+		metrics.snapshot_num++;
 		return journal.size();
 	}
 	// undo modifications to revert the cached world state to a snapshot
 	void revert_to_snapshot(size_t snapshot_id) {
 		//std::cerr<<"revert "<<journal.size()<<" => "<<snapshot_id<<std::endl;
+		metrics.revert_num++;
+		if(journal.size() > snapshot_id) {
+			metrics.reverted_change_num += journal.size() - snapshot_id;
+		}
 		while(journal.size() > snapshot_id) {
 			journal.back().revert(&cstate);
 			journal.pop_back();
@@ -457,12 +517,33 @@ public:
 	const bytecode_entry& get_bytecode_entry(const evmc_address& addr) {
 		return cstate.get_bytecode_entry(addr);
 	}
-	enum evmc_access_status access_account(const evmc_address& address) {
-		return cstate.has_account(address) ? EVMC_ACCESS_WARM : EVMC_ACCESS_COLD;
+	// EIP-2929: the first access to an account or a storage slot is cold. It is journaled, such that
+	// the entry becomes cold again if the call accessing it reverts.
+	enum evmc_access_status access_account(const evmc_address& addr) {
+		if(!cstate.add_accessed_account(addr)) {
+			return EVMC_ACCESS_WARM;
+		}
+		journal_entry e {.type=ACCOUNT_ACCESS};
+		e.access.addr = addr;
+		journal.push_back(e);
+		return EVMC_ACCESS_COLD;
 	}
 	enum evmc_access_status access_storage(const evmc_address& addr, const evmc_bytes32& key) {
-		const account_info& info = cstate.get_account(addr);
-		return cstate.has_value(info.sequence, key) ? EVMC_ACCESS_WARM : EVMC_ACCESS_COLD;
+		if(!cstate.add_accessed_storage(addr, key)) {
+			return EVMC_ACCESS_WARM;
+		}
+		journal_entry e {.type=STORAGE_ACCESS};
+		e.access.addr = addr;
+		e.access.key = key;
+		journal.push_back(e);
+		return EVMC_ACCESS_COLD;
+	}
+	// the entries warmed before the TX runs are not journaled, because they stay warm until the TX ends
+	void warm_account(const evmc_address& addr) {
+		cstate.add_accessed_account(addr);
+	}
+	void warm_storage(const evmc_address& addr, const evmc_bytes32& key) {
+		cstate.add_accessed_storage(addr, key);
 	}
 	evmc_storage_status set_value(const evmc_address& addr, const evmc_bytes32& key, bytes_info value);
 	evmc_storage_status set_value(uint64_t sequence, const evmc_bytes32& key, bytes_info value);
@@ -477,7 +558,7 @@ public:
 	void collect_result(bridge_collect_result_fn collect_result_fn,
 	                    int collector_handler,
 	                    const evmc_result* ret_value) {
-		cstate.collect_result(collect_result_fn, collector_handler, ret_value);
+		cstate.collect_result(collect_result_fn, collector_handler, ret_value, metrics);
 	}
 
 	int64_t estimate_gas(int64_t init_guess);
@@ -0,0 +1,238 @@
+// Package fork runs moeingevm over the state of a live smartBCH node at some height, which is fetched
+// through the node's JSON-RPC API on the first access and cached locally, like the forking mode of
+// Hardhat and Anvil. The local changes are never sent to the node.
+package fork
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+	"github.com/smartbch/moeingads/store"
+	"github.com/smartbch/moeingads/store/rabbit"
+	storetypes "github.com/smartbch/moeingads/store/types"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// The sequences of the fetched accounts start from it, so they do not collide with the ones of the contracts
+// created locally, which are counted from zero
+const FirstFetchedSequence uint64 = 1 << 62
+
+// Fork is the RemoteState of the Contexts it creates
+type Fork struct {
+	url    string
+	height string // the block number in the RPC parameters
+	client *http.Client
+	reqID  int64
+
+	store *lockedStore
+
+	mtx      sync.Mutex
+	fetched  map[string]struct{}
+	seq2addr map[uint64]common.Address
+	nextSeq  uint64
+	err      error
+}
+
+var _ types.RemoteState = (*Fork)(nil)
+
+// Fork the state of the node at remoteRPC after the block at height. The latest block is used if height
+// is not positive.
+func NewFork(remoteRPC string, height int64) (*Fork, error) {
+	f := &Fork{
+		url:      remoteRPC,
+		client:   &http.Client{},
+		fetched:  make(map[string]struct{}),
+		seq2addr: make(map[uint64]common.Address),
+		nextSeq:  FirstFetchedSequence,
+	}
+	if height <= 0 {
+		var latest hexutil.Uint64
+		if err := f.call(&latest, "eth_blockNumber"); err != nil {
+			return nil, err
+		}
+		height = int64(latest)
+	}
+	f.height = hexutil.EncodeUint64(uint64(height))
+	root := store.NewMockRootStore()
+	f.store = &lockedStore{BaseStoreI: root.GetTrunkStore(1000).(*store.TrunkStore)}
+	return f, nil
+}
+
+// Returns a Context of the forked state, whose changes are kept locally if it is closed with true
+func ForkContext(remoteRPC string, height int64) (*types.Context, error) {
+	f, err := NewFork(remoteRPC, height)
+	if err != nil {
+		return nil, err
+	}
+	return f.NewContext(), nil
+}
+
+func (f *Fork) NewContext() *types.Context {
+	rbt := rabbit.NewRabbitStore(f.store)
+	ctx := types.NewContext(&rbt, nil)
+	ctx.Remote = f
+	return ctx
+}
+
+// Returns the first error of fetching. The state missing because of it looks like nonexistent.
+func (f *Fork) Err() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.err
+}
+
+// Fetch implements types.RemoteState. The accounts, bytecodes and storage slots are fetched, while the
+// other keys are local only.
+func (f *Fork) Fetch(key []byte) []byte {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if _, ok := f.fetched[string(key)]; ok {
+		return nil // it is missing because it is deleted locally
+	}
+	value, err := f.fetchRemote(key)
+	if err != nil {
+		if f.err == nil {
+			f.err = err
+		}
+		return nil
+	}
+	f.fetched[string(key)] = struct{}{}
+	if value != nil {
+		f.setLocal(key, value)
+	}
+	return value
+}
+
+func (f *Fork) setLocal(key, value []byte) {
+	rbt := rabbit.NewRabbitStore(f.store)
+	rbt.Set(key, value)
+	rbt.CloseAndWriteBack(true)
+}
+
+func (f *Fork) fetchRemote(key []byte) ([]byte, error) {
+	switch {
+	case len(key) == 1+20 && key[0] == types.ACCOUNT_KEY:
+		return f.fetchAccount(common.BytesToAddress(key[1:]))
+	case len(key) == 1+20 && key[0] == types.BYTECODE_KEY:
+		return f.fetchBytecode(common.BytesToAddress(key[1:]))
+	case len(key) == 1+8+32 && key[0] == types.VALUE_KEY:
+		addr, ok := f.seq2addr[new(big.Int).SetBytes(key[1:9]).Uint64()]
+		if !ok {
+			return nil, nil // a contract created locally
+		}
+		var value common.Hash
+		if err := f.call(&value, "eth_getStorageAt", addr, hexutil.Encode(key[9:]), f.height); err != nil {
+			return nil, err
+		}
+		if value == (common.Hash{}) {
+			return nil, nil
+		}
+		return value[:], nil
+	}
+	return nil, nil
+}
+
+func (f *Fork) fetchAccount(addr common.Address) ([]byte, error) {
+	var balance hexutil.Big
+	var nonce hexutil.Uint64
+	var code hexutil.Bytes
+	if err := f.call(&balance, "eth_getBalance", addr, f.height); err != nil {
+		return nil, err
+	}
+	if err := f.call(&nonce, "eth_getTransactionCount", addr, f.height); err != nil {
+		return nil, err
+	}
+	if err := f.call(&code, "eth_getCode", addr, f.height); err != nil {
+		return nil, err
+	}
+	b := (*big.Int)(&balance)
+	if b.Sign() == 0 && nonce == 0 && len(code) == 0 {
+		return nil, nil
+	}
+	acc := types.ZeroAccountInfo()
+	bal, _ := uint256.FromBig(b)
+	acc.UpdateBalance(bal)
+	acc.UpdateNonce(uint64(nonce))
+	acc.UpdateSequence(f.nextSeq)
+	f.seq2addr[f.nextSeq] = addr
+	f.nextSeq++
+	return acc.Bytes(), nil
+}
+
+func (f *Fork) fetchBytecode(addr common.Address) ([]byte, error) {
+	var code hexutil.Bytes
+	if err := f.call(&code, "eth_getCode", addr, f.height); err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return nil, nil
+	}
+	bz := make([]byte, 33, 33+len(code)) // the version byte is zero
+	copy(bz[1:], crypto.Keccak256(code))
+	return append(bz, code...), nil
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (f *Fork) call(result interface{}, method string, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	req, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      atomic.AddInt64(&f.reqID, 1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Post(f.url, "application/json", bytes.NewReader(req))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var res rpcResponse
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if res.Error != nil {
+		return fmt.Errorf("%s: %s (%d)", method, res.Error.Message, res.Error.Code)
+	}
+	return json.Unmarshal(res.Result, result)
+}
+
+// lockedStore serializes the accesses to the local store, because the fetched values are written into it
+// while the other Contexts are reading it
+type lockedStore struct {
+	storetypes.BaseStoreI
+	mtx sync.RWMutex
+}
+
+func (s *lockedStore) Get(key []byte) []byte {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.BaseStoreI.Get(key)
+}
+
+func (s *lockedStore) Update(updater func(db storetypes.SetDeleter)) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.BaseStoreI.Update(updater)
+}
@@ -0,0 +1,152 @@
+package fork
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+var (
+	eoa      = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	contract = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	code     = []byte{0x60, 0x01, 0x60, 0x00, 0x55, 0x00}
+	slot     = common.HexToHash("0x01")
+)
+
+type mockNode struct {
+	mtx   sync.Mutex
+	calls map[string]int
+}
+
+func (n *mockNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     int64             `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	n.mtx.Lock()
+	n.calls[req.Method]++
+	n.mtx.Unlock()
+	var addr common.Address
+	if len(req.Params) != 0 {
+		_ = json.Unmarshal(req.Params[0], &addr)
+	}
+	var result interface{}
+	switch req.Method {
+	case "eth_blockNumber":
+		result = "0x64"
+	case "eth_getBalance":
+		if addr == eoa {
+			result = "0x3e8"
+		} else {
+			result = "0x0"
+		}
+	case "eth_getTransactionCount":
+		switch addr {
+		case eoa:
+			result = "0x5"
+		case contract:
+			result = "0x1"
+		default:
+			result = "0x0"
+		}
+	case "eth_getCode":
+		if addr == contract {
+			result = hexutil.Encode(code)
+		} else {
+			result = "0x"
+		}
+	case "eth_getStorageAt":
+		var key common.Hash
+		_ = json.Unmarshal(req.Params[1], &key)
+		if addr == contract && key == slot {
+			result = common.BigToHash(uint256.NewInt(42).ToBig()).Hex()
+		} else {
+			result = common.Hash{}.Hex()
+		}
+	default:
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID,
+			"error": map[string]interface{}{"code": -32601, "message": "method not found"}})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+}
+
+func (n *mockNode) count(method string) int {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.calls[method]
+}
+
+func TestForkContext(t *testing.T) {
+	node := &mockNode{calls: make(map[string]int)}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	f, err := NewFork(srv.URL, 0)
+	require.NoError(t, err)
+	require.Equal(t, "0x64", f.height)
+
+	ctx := f.NewContext()
+	acc := ctx.GetAccount(eoa)
+	require.NotNil(t, acc)
+	require.Equal(t, uint64(1000), acc.Balance().Uint64())
+	require.Equal(t, uint64(5), acc.Nonce())
+	require.Nil(t, ctx.GetCode(eoa))
+	require.Nil(t, ctx.GetAccount(common.Address{0x33}))
+
+	cacc := ctx.GetAccount(contract)
+	require.NotNil(t, cacc)
+	require.Equal(t, FirstFetchedSequence+1, cacc.Sequence())
+	bi := ctx.GetCode(contract)
+	require.Equal(t, code, bi.BytecodeSlice())
+	require.Equal(t, crypto.Keccak256(code), bi.CodeHashSlice())
+	require.Equal(t, uint256.NewInt(42).PaddedBytes(32), ctx.GetStorageAt(cacc.Sequence(), string(slot[:])))
+	require.Nil(t, ctx.GetStorageAt(cacc.Sequence(), string(common.Hash{0x02}.Bytes())))
+	ctx.Close(false)
+	require.NoError(t, f.Err())
+
+	// the fetched state is cached in the fork
+	calls := node.count("eth_getBalance")
+	ctx = f.NewContext()
+	require.Equal(t, uint64(1000), ctx.GetAccount(eoa).Balance().Uint64())
+	require.Equal(t, calls, node.count("eth_getBalance"))
+
+	// the local changes are kept, and the deleted state is not fetched again
+	acc = ctx.GetAccount(eoa)
+	acc.UpdateBalance(uint256.NewInt(7))
+	ctx.SetAccount(eoa, acc)
+	ctx.Rbt.Delete(types.GetValueKey(cacc.Sequence(), string(slot[:])))
+	ctx.Close(true)
+	ctx = f.NewContext()
+	require.Equal(t, uint64(7), ctx.GetAccount(eoa).Balance().Uint64())
+	require.Nil(t, ctx.GetStorageAt(cacc.Sequence(), string(slot[:])))
+	ctx.Close(false)
+}
+
+func TestForkError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	_, err := ForkContext(srv.URL, 0)
+	require.Error(t, err)
+
+	f, err := NewFork(srv.URL, 10)
+	require.NoError(t, err)
+	ctx := f.NewContext()
+	require.Nil(t, ctx.GetAccount(eoa))
+	require.Error(t, f.Err())
+	ctx.Close(false)
+}
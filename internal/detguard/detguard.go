@@ -0,0 +1,52 @@
+// Package detguard detects the sources of nondeterminism in the consensus paths of moeingevm.
+// With the 'debug' build tag, Twice runs a computation twice and panics if the results differ, which
+// catches the outputs depending on the iteration order of Go maps (it is randomized for each range
+// loop). FindClockCalls finds the wall-clock reads in source files. Data races are caught by running
+// the tests with the 'debug' tag and '-race'.
+package detguard
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+)
+
+var clockFuncs = map[string]bool{"Now": true, "Since": true, "Until": true}
+
+// Returns the positions of the calls to time.Now, time.Since and time.Until in the files of dir
+func FindClockCalls(dir string, fileNames []string) ([]string, error) {
+	var found []string
+	fset := token.NewFileSet()
+	for _, name := range fileNames {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		timePkg := ""
+		for _, imp := range f.Imports {
+			if path, _ := strconv.Unquote(imp.Path.Value); path == "time" {
+				timePkg = "time"
+				if imp.Name != nil {
+					timePkg = imp.Name.Name
+				}
+			}
+		}
+		if timePkg == "" {
+			continue
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if id, ok := sel.X.(*ast.Ident); ok && id.Name == timePkg && clockFuncs[sel.Sel.Name] {
+				found = append(found, fmt.Sprintf("%s: time.%s", fset.Position(sel.Pos()), sel.Sel.Name))
+			}
+			return true
+		})
+	}
+	return found, nil
+}
@@ -0,0 +1,53 @@
+package detguard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindClockCalls(t *testing.T) {
+	dir := t.TempDir()
+	src := `package a
+
+import tm "time"
+
+func f() { _ = tm.Now(); _ = tm.Duration(1); _ = tm.Since(tm.Time{}) }
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte(src), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.go"), []byte("package a\n\nfunc Now() {}\n"), 0644))
+	found, err := FindClockCalls(dir, []string{"a.go", "b.go"})
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+}
+
+func TestTwice(t *testing.T) {
+	m := map[int]bool{1: true, 2: true, 3: true, 4: true, 5: true, 6: true, 7: true, 8: true}
+	sorted := func() []int {
+		out := make([]int, 0, len(m))
+		for i := 1; i <= len(m); i++ {
+			if m[i] {
+				out = append(out, i)
+			}
+		}
+		return out
+	}
+	require.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8}, Twice("sorted", sorted))
+	if !Enabled {
+		return
+	}
+	unordered := func() []int {
+		out := make([]int, 0, len(m))
+		for k := range m {
+			out = append(out, k)
+		}
+		return out
+	}
+	require.Panics(t, func() {
+		for i := 0; i < 100; i++ { // the chance of the same order in all the tries is negligible
+			Twice("unordered", unordered)
+		}
+	})
+}
@@ -0,0 +1,19 @@
+//go:build debug
+
+package detguard
+
+import (
+	"fmt"
+	"reflect"
+)
+
+const Enabled = true
+
+// Runs fn twice and panics if the results are different. fn must not have side effects.
+func Twice[T any](name string, fn func() T) T {
+	a, b := fn(), fn()
+	if !reflect.DeepEqual(a, b) {
+		panic(fmt.Sprintf("nondeterminism detected in %s:\n%v\n%v", name, a, b))
+	}
+	return a
+}
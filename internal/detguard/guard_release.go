@@ -0,0 +1,10 @@
+//go:build !debug
+
+package detguard
+
+const Enabled = false
+
+// Runs fn once. In debug builds, fn is run twice to check its determinism.
+func Twice[T any](name string, fn func() T) T {
+	return fn()
+}
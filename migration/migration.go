@@ -0,0 +1,364 @@
+// Package migration exports the data of a node which are not replayed from the world state, i.e. the receipts
+// in MoDB, the BlockMetas, the standby queue and the metadata of the engine, into a file, and imports them
+// on a new node. So the hardware of a node can be migrated without replaying the chain. The standby queue and
+// the engine metadata are in the trunk, so they are skipped if the new node gets the trunk by state sync. The
+// storage slot counts of the contracts under the storage quota are also in the trunk, but they are keyed by
+// the sequences of the contracts and cannot be listed, so they are not migrated and need state sync, or a
+// copy of the MoeingADS directory. It also upgrades the stored receipts to a new serialization format with
+// ReceiptUpgrader.
+//
+// The file is a header followed by records, each of which is a kind (1 byte), the length of the payload
+// (4 bytes) and the payload. The last record counts the records before it, so a truncated file is rejected.
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	storetypes "github.com/smartbch/moeingads/store/types"
+	modbtypes "github.com/smartbch/moeingdb/types"
+
+	"github.com/smartbch/moeingevm/ebp"
+	"github.com/smartbch/moeingevm/errors"
+	"github.com/smartbch/moeingevm/types"
+)
+
+var (
+	ErrBadFile  = errors.New("not a valid migration file")
+	ErrConflict = errors.New("the imported data conflict with the local ones")
+)
+
+var fileHeader = []byte("moeingevm-migration-v1\n")
+
+const (
+	recordStateEntry byte = 1 // a key (its length is 2 bytes) and its value in the trunk
+	recordBlock      byte = 2 // a block of MoDB, and the signatures of its TXs (65 bytes each)
+	recordBlockMeta  byte = 3 // a BlockMeta
+	recordEnd        byte = 255
+
+	maxRecordSize = 1 << 30
+)
+
+// Node is the data to be exported from or imported into a node
+type Node struct {
+	// provides the receipts
+	Db modbtypes.DB
+	// provides the standby queue and the engine metadata, nil if they are got by state sync. It must be clean,
+	// and the imported entries are written into it directly.
+	Trunk storetypes.BaseStoreI
+	// nil if the node does not keep BlockMetas
+	BlockMetas *ebp.BlockMetaStore
+}
+
+type Stats struct {
+	StateEntries int
+	Blocks       int
+	BlockMetas   int
+}
+
+// The keys of the standby queue, the scheduled queue and the other engine metadata, which are stored in the
+// trunk without RabbitStore. Some of them may not exist.
+func engineStateKeys(store storetypes.BaseStoreI) [][]byte {
+	keys := [][]byte{types.StandbyTxQueueKey[:], types.BaseFeeKey[:], types.MinGasPriceKey[:],
+		types.ScheduledTxQueueKey[:]}
+	// adds the key of a queued tx and the one of its entry in the hash index, and returns the tx
+	addTx := func(k []byte) *types.TxToRun {
+		keys = append(keys, k)
+		bz := store.Get(k)
+		if bz == nil {
+			return nil
+		}
+		var tx types.TxToRun
+		tx.FromBytes(bz)
+		keys = append(keys, types.GetQueuedTxHashKey(tx.HashID))
+		return &tx
+	}
+	if bz := store.Get(types.StandbyTxQueueKey[:]); len(bz) == 16 {
+		start, end := binary.BigEndian.Uint64(bz[:8]), binary.BigEndian.Uint64(bz[8:])
+		for i := start; i < end; i++ {
+			addTx(types.GetStandbyTxKey(i))
+		}
+	}
+	if bz := store.Get(types.ScheduledTxQueueKey[:]); len(bz) == 24 {
+		start, end := binary.BigEndian.Uint64(bz[:8]), binary.BigEndian.Uint64(bz[8:16])
+		heights := make(map[uint64]struct{})
+		for i := start; i < end; i++ {
+			tx := addTx(types.GetScheduledTxKey(i))
+			if tx == nil {
+				continue
+			}
+			if _, ok := heights[tx.NotBefore]; !ok {
+				heights[tx.NotBefore] = struct{}{}
+				keys = append(keys, types.GetScheduledHeightKey(tx.NotBefore))
+			}
+		}
+	}
+	return keys
+}
+
+type writer struct {
+	w     *bufio.Writer
+	count uint64
+}
+
+func (w *writer) write(kind byte, payloads ...[]byte) error {
+	size := 0
+	for _, p := range payloads {
+		size += len(p)
+	}
+	var buf [5]byte
+	buf[0] = kind
+	binary.BigEndian.PutUint32(buf[1:], uint32(size))
+	if _, err := w.w.Write(buf[:]); err != nil {
+		return err
+	}
+	for _, p := range payloads {
+		if _, err := w.w.Write(p); err != nil {
+			return err
+		}
+	}
+	w.count++
+	return nil
+}
+
+// Export the engine state if node.Trunk is not nil, and the receipts and BlockMetas of the blocks in
+// [fromHeight, toHeight] into out
+func Export(out io.Writer, node Node, fromHeight, toHeight int64) (stats Stats, err error) {
+	w := &writer{w: bufio.NewWriter(out)}
+	if _, err = w.w.Write(fileHeader); err != nil {
+		return
+	}
+	if node.Trunk != nil {
+		for _, key := range engineStateKeys(node.Trunk) {
+			value := node.Trunk.Get(key)
+			if value == nil {
+				continue
+			}
+			var keyLen [2]byte
+			binary.BigEndian.PutUint16(keyLen[:], uint16(len(key)))
+			if err = w.write(recordStateEntry, keyLen[:], key, value); err != nil {
+				return
+			}
+			stats.StateEntries++
+		}
+	}
+	for h := fromHeight; h <= toHeight; h++ {
+		var exported bool
+		if exported, err = exportBlock(w, node.Db, h); err != nil {
+			return
+		} else if exported {
+			stats.Blocks++
+		}
+		if node.BlockMetas == nil {
+			continue
+		}
+		if m, ok := node.BlockMetas.Get(h); ok {
+			if err = w.write(recordBlockMeta, m.ToBytes()); err != nil {
+				return
+			}
+			stats.BlockMetas++
+		}
+	}
+	var count [8]byte
+	binary.BigEndian.PutUint64(count[:], w.count)
+	if err = w.write(recordEnd, count[:]); err != nil {
+		return
+	}
+	err = w.w.Flush()
+	return
+}
+
+func exportBlock(w *writer, db modbtypes.DB, height int64) (bool, error) {
+	info := db.GetBlockByHeight(height)
+	if len(info) == 0 {
+		return false, nil
+	}
+	contents := db.GetTxListByHeight(height) // each of them is a signature (65 bytes) and a tx
+	txs := make([]*types.Transaction, len(contents))
+	sigBz := make([]byte, 0, 65*len(contents))
+	for i, content := range contents {
+		txs[i] = &types.Transaction{}
+		if len(content) < 65 {
+			return false, fmt.Errorf("tx %d of block %d is too short", i, height)
+		} else if _, err := txs[i].UnmarshalMsg(content[65:]); err != nil {
+			return false, err
+		}
+		sigBz = append(sigBz, content[:65]...)
+	}
+	blk := &modbtypes.Block{
+		Height:    height,
+		BlockHash: db.GetBlockHashByHeight(height),
+		BlockInfo: info,
+		TxList:    ebp.TxsForMoDB(txs),
+	}
+	bz, err := blk.MarshalMsg(nil)
+	if err != nil {
+		return false, err
+	}
+	return true, w.write(recordBlock, bz, sigBz)
+}
+
+// Import the records exported by Export. The whole file is checked before anything is written, so a truncated
+// or corrupted file changes nothing. The blocks already in MoDB are skipped, so an interrupted import can be
+// run again, and ErrConflict is returned if the hash of a local block is different. The state entries are
+// skipped if node.Trunk is nil. Otherwise an entry is only written if it does not exist locally, and
+// ErrConflict is returned if a local one is different, because the engine state is a part of the world state.
+func Import(in io.ReadSeeker, node Node) (stats Stats, err error) {
+	if err = scanRecords(in, func(kind byte, payload []byte) error {
+		return checkRecord(node, kind, payload)
+	}); err != nil {
+		return
+	}
+	if _, err = in.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	var entries [][2][]byte // the state entries are written together at the end
+	err = scanRecords(in, func(kind byte, payload []byte) error {
+		if kind == recordStateEntry {
+			if key, value, _ := decodeStateEntry(payload); node.Trunk != nil && node.Trunk.Get(key) == nil {
+				entries = append(entries, [2][]byte{key, value})
+				stats.StateEntries++
+			}
+			return nil
+		}
+		imported, err := importRecord(node, kind, payload)
+		if imported && kind == recordBlock {
+			stats.Blocks++
+		} else if imported {
+			stats.BlockMetas++
+		}
+		return err
+	})
+	if err != nil || len(entries) == 0 {
+		return
+	}
+	for _, e := range entries {
+		node.Trunk.PrepareForUpdate(e[0])
+	}
+	node.Trunk.Update(func(db storetypes.SetDeleter) {
+		for _, e := range entries {
+			db.Set(e[0], e[1])
+		}
+	})
+	return
+}
+
+// Calls fn on each record before the end record, and checks the header and the end record
+func scanRecords(in io.Reader, fn func(kind byte, payload []byte) error) error {
+	r := bufio.NewReader(in)
+	header := make([]byte, len(fileHeader))
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, fileHeader) {
+		return ErrBadFile
+	}
+	for count := uint64(0); ; count++ {
+		kind, payload, err := readRecord(r)
+		if err != nil {
+			return err
+		}
+		if kind == recordEnd {
+			if len(payload) != 8 || binary.BigEndian.Uint64(payload) != count {
+				return fmt.Errorf("%w: records are missing", ErrBadFile)
+			}
+			return nil
+		}
+		if err = fn(kind, payload); err != nil {
+			return err
+		}
+	}
+}
+
+func checkRecord(node Node, kind byte, payload []byte) error {
+	switch kind {
+	case recordStateEntry:
+		key, value, err := decodeStateEntry(payload)
+		if err != nil {
+			return err
+		}
+		if node.Trunk == nil {
+			return nil
+		}
+		if local := node.Trunk.Get(key); local != nil && !bytes.Equal(local, value) {
+			return fmt.Errorf("%w: key %x", ErrConflict, key)
+		}
+	case recordBlock:
+		blk, _, err := decodeBlock(payload)
+		if err != nil {
+			return err
+		}
+		if len(node.Db.GetBlockByHeight(blk.Height)) != 0 && node.Db.GetBlockHashByHeight(blk.Height) != blk.BlockHash {
+			return fmt.Errorf("%w: block %d", ErrConflict, blk.Height)
+		}
+	case recordBlockMeta:
+		var m ebp.BlockMeta
+		if !m.FromBytes(payload) {
+			return fmt.Errorf("%w: invalid BlockMeta", ErrBadFile)
+		}
+	default:
+		return fmt.Errorf("%w: unknown record kind %d", ErrBadFile, kind)
+	}
+	return nil
+}
+
+// The records are checked by checkRecord before
+func importRecord(node Node, kind byte, payload []byte) (bool, error) {
+	if kind == recordBlockMeta {
+		if node.BlockMetas == nil {
+			return false, nil
+		}
+		var m ebp.BlockMeta
+		m.FromBytes(payload)
+		node.BlockMetas.Put(&m)
+		return true, nil
+	}
+	blk, sigs, err := decodeBlock(payload)
+	if err != nil || len(node.Db.GetBlockByHeight(blk.Height)) != 0 {
+		return false, err
+	}
+	node.Db.AddBlock(blk, -1, sigs)
+	return true, nil
+}
+
+func readRecord(r io.Reader) (kind byte, payload []byte, err error) {
+	var buf [5]byte
+	if _, err = io.ReadFull(r, buf[:]); err != nil {
+		return 0, nil, fmt.Errorf("%w: %s", ErrBadFile, err)
+	}
+	size := binary.BigEndian.Uint32(buf[1:])
+	if size > maxRecordSize {
+		return 0, nil, fmt.Errorf("%w: record of %d bytes", ErrBadFile, size)
+	}
+	payload = make([]byte, size)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return 0, nil, fmt.Errorf("%w: %s", ErrBadFile, err)
+	}
+	return buf[0], payload, nil
+}
+
+func decodeStateEntry(payload []byte) (key, value []byte, err error) {
+	if len(payload) < 2 || len(payload) < 2+int(binary.BigEndian.Uint16(payload)) {
+		return nil, nil, fmt.Errorf("%w: truncated state entry", ErrBadFile)
+	}
+	keyLen := int(binary.BigEndian.Uint16(payload))
+	return payload[2 : 2+keyLen], payload[2+keyLen:], nil
+}
+
+func decodeBlock(payload []byte) (*modbtypes.Block, map[[32]byte][65]byte, error) {
+	blk := &modbtypes.Block{}
+	sigBz, err := blk.UnmarshalMsg(payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrBadFile, err)
+	}
+	if len(sigBz) != 65*len(blk.TxList) {
+		return nil, nil, fmt.Errorf("%w: %d signatures for %d TXs", ErrBadFile, len(sigBz)/65, len(blk.TxList))
+	}
+	sigs := make(map[[32]byte][65]byte, len(blk.TxList))
+	for i, tx := range blk.TxList {
+		var sig [65]byte
+		copy(sig[:], sigBz[65*i:])
+		sigs[tx.HashId] = sig
+	}
+	return blk, sigs, nil
+}
@@ -0,0 +1,141 @@
+package migration
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartbch/moeingads/store"
+	storetypes "github.com/smartbch/moeingads/store/types"
+	"github.com/smartbch/moeingdb/modb"
+	modbtypes "github.com/smartbch/moeingdb/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/ebp"
+	"github.com/smartbch/moeingevm/types"
+)
+
+type memKV map[string][]byte
+
+func (kv memKV) Get(key []byte) []byte { return kv[string(key)] }
+func (kv memKV) Set(key, value []byte) { kv[string(key)] = value }
+
+func newTestNode() Node {
+	return Node{
+		Db:         &modb.MockMoDB{},
+		Trunk:      store.NewMockRootStore().GetTrunkStore(1000).(*store.TrunkStore),
+		BlockMetas: ebp.NewBlockMetaStore(memKV{}),
+	}
+}
+
+func setEntry(n Node, key, value []byte) {
+	n.Trunk.Update(func(db storetypes.SetDeleter) { db.Set(key, value) })
+}
+
+func queueRange(start, end uint64, extra ...byte) []byte {
+	bz := make([]byte, 16, 16+len(extra))
+	binary.BigEndian.PutUint64(bz[:8], start)
+	binary.BigEndian.PutUint64(bz[8:], end)
+	return append(bz, extra...)
+}
+
+func storeBlock(n Node, h int64, hash byte) {
+	tx := &types.Transaction{Hash: common.Hash{byte(h), 1}, BlockNumber: h, From: common.Address{1},
+		Logs: []types.Log{{Address: common.Address{2}, Topics: [][32]byte{{3}}}}}
+	blk := &modbtypes.Block{Height: h, BlockHash: [32]byte{hash}, BlockInfo: []byte{byte(h)},
+		TxList: ebp.TxsForMoDB([]*types.Transaction{tx})}
+	n.Db.AddBlock(blk, -1, nil)
+}
+
+func newSourceNode() Node {
+	n := newTestNode()
+	setEntry(n, types.StandbyTxQueueKey[:], queueRange(5, 7))
+	setEntry(n, types.BaseFeeKey[:], []byte{1, 2, 3})
+	for i := uint64(5); i < 7; i++ {
+		tx := types.TxToRun{HashID: common.Hash{byte(i)}, Height: 10}
+		setEntry(n, types.GetStandbyTxKey(i), tx.ToBytes())
+		setEntry(n, types.GetQueuedTxHashKey(tx.HashID), types.GetStandbyTxKey(i))
+	}
+	// a tx scheduled at height 20
+	setEntry(n, types.ScheduledTxQueueKey[:], queueRange(0, 1, make([]byte, 8)...))
+	tx := types.TxToRun{HashID: common.Hash{9}, Height: 10, NotBefore: 20}
+	setEntry(n, types.GetScheduledTxKey(0), tx.ToBytes())
+	setEntry(n, types.GetScheduledHeightKey(20), make([]byte, 8))
+	for h := int64(1); h <= 3; h++ {
+		storeBlock(n, h, byte(h))
+		n.BlockMetas.Put(&ebp.BlockMeta{Height: h, TxCount: 1})
+	}
+	return n
+}
+
+func TestExportAndImport(t *testing.T) {
+	src := newSourceNode()
+	var file bytes.Buffer
+	stats, err := Export(&file, src, 2, 3)
+	require.NoError(t, err)
+	// the queue ranges, BaseFee, three TXs, two entries of the hash index and a scheduled height
+	require.Equal(t, Stats{StateEntries: 9, Blocks: 2, BlockMetas: 2}, stats)
+
+	dst := newTestNode()
+	imported, err := Import(bytes.NewReader(file.Bytes()), dst)
+	require.NoError(t, err)
+	require.Equal(t, stats, imported)
+	for _, key := range engineStateKeys(src.Trunk) {
+		require.Equal(t, src.Trunk.Get(key), dst.Trunk.Get(key))
+	}
+	require.Equal(t, src.Trunk.Get(types.GetScheduledHeightKey(20)), dst.Trunk.Get(types.GetScheduledHeightKey(20)))
+	require.Nil(t, dst.Db.GetBlockByHeight(1))
+	for h := int64(2); h <= 3; h++ {
+		require.Equal(t, src.Db.GetBlockByHeight(h), dst.Db.GetBlockByHeight(h))
+		require.Equal(t, src.Db.GetTxListByHeight(h), dst.Db.GetTxListByHeight(h))
+		m, ok := dst.BlockMetas.Get(h)
+		require.True(t, ok)
+		require.Equal(t, uint32(1), m.TxCount)
+	}
+
+	// importing again skips the blocks, and the equal state entries are fine
+	imported, err = Import(bytes.NewReader(file.Bytes()), dst)
+	require.NoError(t, err)
+	require.Equal(t, 0, imported.Blocks)
+
+	setEntry(dst, types.BaseFeeKey[:], []byte{4})
+	_, err = Import(bytes.NewReader(file.Bytes()), dst)
+	require.ErrorIs(t, err, ErrConflict)
+
+	// the state entries are skipped without the trunk
+	dst = newTestNode()
+	dst.Trunk = nil
+	imported, err = Import(bytes.NewReader(file.Bytes()), dst)
+	require.NoError(t, err)
+	require.Equal(t, Stats{Blocks: 2, BlockMetas: 2}, imported)
+
+	// a local block with another hash conflicts, and nothing is written
+	dst = newTestNode()
+	storeBlock(dst, 3, 9)
+	_, err = Import(bytes.NewReader(file.Bytes()), dst)
+	require.ErrorIs(t, err, ErrConflict)
+	require.Nil(t, dst.Db.GetBlockByHeight(2))
+}
+
+func TestImportBadFile(t *testing.T) {
+	src := newSourceNode()
+	var file bytes.Buffer
+	_, err := Export(&file, src, 1, 3)
+	require.NoError(t, err)
+	bz := file.Bytes()
+
+	_, err = Import(bytes.NewReader(bz[:len(bz)-20]), newTestNode()) // truncated
+	require.ErrorIs(t, err, ErrBadFile)
+	_, err = Import(bytes.NewReader(bz[1:]), newTestNode())
+	require.ErrorIs(t, err, ErrBadFile)
+
+	// nothing is written if the file is truncated
+	dst := newTestNode()
+	_, err = Import(bytes.NewReader(bz[:len(bz)-13]), dst) // without the last record
+	require.ErrorIs(t, err, ErrBadFile)
+	require.Nil(t, dst.Db.GetBlockByHeight(1))
+	_, ok := dst.BlockMetas.Get(1)
+	require.False(t, ok)
+	require.Nil(t, dst.Trunk.Get(types.StandbyTxQueueKey[:]))
+}
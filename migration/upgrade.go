@@ -0,0 +1,129 @@
+package migration
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	modbtypes "github.com/smartbch/moeingdb/types"
+
+	"github.com/smartbch/moeingevm/ebp"
+)
+
+// ReceiptUpgrade converts the stored TXs from the previous serialization format to a new one
+type ReceiptUpgrade struct {
+	// The new format version, the progress of the upgrade is kept per version
+	Version uint32
+	// Converts one stored tx, without its signature. It should return the content unchanged if it is already
+	// in the new format, because a block may be converted again if the node crashes during its rewriting.
+	Convert func(content []byte) ([]byte, error)
+}
+
+// TxRewriter replaces the stored TXs of a block. MoDB only appends blocks, so it is provided by the storage
+// of the node.
+type TxRewriter interface {
+	// Each of the contents is a signature (65 bytes) followed by a tx, as returned by GetTxListByHeight
+	RewriteTxs(height int64, contents [][]byte) error
+}
+
+// ReceiptUpgrader rewrites the history of receipts to a new format in the background, a few blocks at a time,
+// while the node keeps producing blocks in the new format. The blocks below the latest height at its first
+// run are rewritten, and its progress is persisted, so it resumes after a restart.
+type ReceiptUpgrader struct {
+	db       modbtypes.DB
+	rewriter TxRewriter
+	progress ebp.KVStore
+	upgrade  ReceiptUpgrade
+
+	BlocksPerStep int           // 100 by default
+	Interval      time.Duration // between the steps of Run, which throttles the rewriting
+}
+
+func NewReceiptUpgrader(db modbtypes.DB, rewriter TxRewriter, progress ebp.KVStore,
+	upgrade ReceiptUpgrade) *ReceiptUpgrader {
+	return &ReceiptUpgrader{
+		db:            db,
+		rewriter:      rewriter,
+		progress:      progress,
+		upgrade:       upgrade,
+		BlocksPerStep: 100,
+		Interval:      100 * time.Millisecond,
+	}
+}
+
+func (u *ReceiptUpgrader) progressKey() []byte {
+	key := make([]byte, 3+4)
+	copy(key, "ru-")
+	binary.BigEndian.PutUint32(key[3:], u.upgrade.Version)
+	return key
+}
+
+// Returns the next height to be rewritten and the end height (exclusive). started is false before the
+// first step.
+func (u *ReceiptUpgrader) Progress() (next, end int64, started bool) {
+	bz := u.progress.Get(u.progressKey())
+	if len(bz) != 16 {
+		return 0, 0, false
+	}
+	return int64(binary.BigEndian.Uint64(bz[:8])), int64(binary.BigEndian.Uint64(bz[8:])), true
+}
+
+func (u *ReceiptUpgrader) setProgress(next, end int64) {
+	var bz [16]byte
+	binary.BigEndian.PutUint64(bz[:8], uint64(next))
+	binary.BigEndian.PutUint64(bz[8:], uint64(end))
+	u.progress.Set(u.progressKey(), bz[:])
+}
+
+// Step rewrites at most BlocksPerStep blocks, and returns true if all of them are rewritten
+func (u *ReceiptUpgrader) Step() (done bool, err error) {
+	next, end, started := u.Progress()
+	if !started {
+		// the blocks after the latest one are written in the new format
+		next, end = 1, u.db.GetLatestHeight()+1
+		u.setProgress(next, end)
+	}
+	for i := 0; i < u.BlocksPerStep && next < end; i++ {
+		if err = u.rewriteBlock(next); err != nil {
+			return false, err
+		}
+		next++
+		u.setProgress(next, end)
+	}
+	return next >= end, nil
+}
+
+func (u *ReceiptUpgrader) rewriteBlock(height int64) error {
+	contents := u.db.GetTxListByHeight(height) // empty if the block is pruned
+	if len(contents) == 0 {
+		return nil
+	}
+	upgraded := make([][]byte, len(contents))
+	for i, content := range contents {
+		if len(content) < 65 {
+			return fmt.Errorf("tx %d of block %d is too short", i, height)
+		}
+		tx, err := u.upgrade.Convert(content[65:])
+		if err != nil {
+			return fmt.Errorf("cannot convert tx %d of block %d: %w", i, height, err)
+		}
+		upgraded[i] = append(append(make([]byte, 0, 65+len(tx)), content[:65]...), tx...)
+	}
+	return u.rewriter.RewriteTxs(height, upgraded)
+}
+
+// Run calls Step every Interval, until all the blocks are rewritten, an error occurs or stop is closed
+func (u *ReceiptUpgrader) Run(stop <-chan struct{}) error {
+	ticker := time.NewTicker(u.Interval)
+	defer ticker.Stop()
+	for {
+		if done, err := u.Step(); done || err != nil {
+			return err
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package migration
+
+import (
+	"bytes"
+	"testing"
+
+	modbtypes "github.com/smartbch/moeingdb/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/errors"
+)
+
+type mapRewriter map[int64][][]byte
+
+func (r mapRewriter) RewriteTxs(height int64, contents [][]byte) error {
+	r[height] = contents
+	return nil
+}
+
+var upgradeV2 = ReceiptUpgrade{
+	Version: 2,
+	Convert: func(content []byte) ([]byte, error) {
+		if bytes.HasPrefix(content, []byte("v2")) {
+			return content, nil
+		}
+		return append([]byte("v2"), content...), nil
+	},
+}
+
+func TestReceiptUpgrader(t *testing.T) {
+	src := newSourceNode()
+	progress := memKV{}
+	rewriter := mapRewriter{}
+	u := NewReceiptUpgrader(src.Db, rewriter, progress, upgradeV2)
+	u.BlocksPerStep = 2
+	_, _, started := u.Progress()
+	require.False(t, started)
+
+	done, err := u.Step()
+	require.NoError(t, err)
+	require.False(t, done)
+	next, end, started := u.Progress()
+	require.True(t, started)
+	require.Equal(t, []int64{3, 4}, []int64{next, end})
+
+	// resumes after a restart, and the blocks added after the first step are not rewritten
+	src.Db.AddBlock(&modbtypes.Block{Height: 4, BlockInfo: []byte{4},
+		TxList: []modbtypes.Tx{{HashId: [32]byte{4}, Content: []byte{4}}}}, -1, nil)
+	u = NewReceiptUpgrader(src.Db, rewriter, progress, upgradeV2)
+	require.NoError(t, u.Run(nil))
+	next, _, _ = u.Progress()
+	require.Equal(t, int64(4), next)
+	require.Len(t, rewriter, 3)
+	for h := int64(1); h <= 3; h++ {
+		orig := src.Db.GetTxListByHeight(h)[0]
+		require.Equal(t, orig[:65], rewriter[h][0][:65])
+		require.Equal(t, append([]byte("v2"), orig[65:]...), rewriter[h][0][65:])
+	}
+
+	// the progress is kept per version
+	u = NewReceiptUpgrader(src.Db, rewriter, progress, ReceiptUpgrade{Version: 3, Convert: upgradeV2.Convert})
+	_, _, started = u.Progress()
+	require.False(t, started)
+}
+
+func TestReceiptUpgraderError(t *testing.T) {
+	src := newSourceNode()
+	progress := memKV{}
+	errBad := errors.New("bad tx")
+	u := NewReceiptUpgrader(src.Db, mapRewriter{}, progress, ReceiptUpgrade{
+		Version: 2,
+		Convert: func(content []byte) ([]byte, error) { return nil, errBad },
+	})
+	require.ErrorIs(t, u.Run(make(chan struct{})), errBad)
+	next, _, _ := u.Progress()
+	require.Equal(t, int64(1), next)
+}
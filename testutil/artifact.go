@@ -0,0 +1,124 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Artifact is the ABI and creation bytecode of a contract compiled by solc, Hardhat or Foundry
+type Artifact struct {
+	ABI      abi.ABI
+	Bytecode []byte
+}
+
+// The bytecode is a hex string in "bytecode" (Hardhat), "bytecode.object" (Foundry), "evm.bytecode.object"
+// (solc standard JSON) or "bin" (solc combined JSON)
+type artifactJSON struct {
+	ABI      json.RawMessage `json:"abi"`
+	Bytecode json.RawMessage `json:"bytecode"`
+	Bin      string          `json:"bin"`
+	EVM      struct {
+		Bytecode bytecodeJSON `json:"bytecode"`
+	} `json:"evm"`
+}
+
+type bytecodeJSON struct {
+	Object string `json:"object"`
+}
+
+func ParseArtifact(bz []byte) (*Artifact, error) {
+	var aj artifactJSON
+	if err := json.Unmarshal(bz, &aj); err != nil {
+		return nil, err
+	}
+	if len(aj.ABI) == 0 {
+		return nil, fmt.Errorf("artifact has no abi")
+	}
+	abiJSON := aj.ABI
+	var abiStr string
+	if json.Unmarshal(aj.ABI, &abiStr) == nil { // solc combined JSON may embed the ABI as a string
+		abiJSON = []byte(abiStr)
+	}
+	a := &Artifact{}
+	var err error
+	if a.ABI, err = abi.JSON(strings.NewReader(string(abiJSON))); err != nil {
+		return nil, err
+	}
+	code := aj.Bin
+	if len(aj.EVM.Bytecode.Object) != 0 {
+		code = aj.EVM.Bytecode.Object
+	}
+	if len(aj.Bytecode) != 0 {
+		var str string
+		var bc bytecodeJSON
+		if json.Unmarshal(aj.Bytecode, &str) == nil {
+			code = str
+		} else if err = json.Unmarshal(aj.Bytecode, &bc); err == nil {
+			code = bc.Object
+		} else {
+			return nil, err
+		}
+	}
+	code = strings.TrimPrefix(code, "0x")
+	if len(code) == 0 {
+		return nil, fmt.Errorf("artifact has no bytecode")
+	}
+	if strings.Contains(code, "__") {
+		return nil, fmt.Errorf("artifact has unlinked libraries")
+	}
+	if a.Bytecode, err = hex.DecodeString(code); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func LoadArtifact(path string) (*Artifact, error) {
+	bz, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseArtifact(bz)
+}
+
+// Returns the creation bytecode followed by the ABI-encoded constructor arguments
+func (a *Artifact) DeployData(args ...interface{}) ([]byte, error) {
+	packed, err := a.ABI.Pack("", args...)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, a.Bytecode...), packed...), nil
+}
+
+// Returns a deployment tx signed by key, and the address of the contract it creates
+func SignDeployTx(signer gethtypes.Signer, key *ecdsa.PrivateKey, nonce, gasLimit uint64, gasPrice *big.Int,
+	a *Artifact, args ...interface{}) (common.Address, *gethtypes.Transaction, error) {
+	data, err := a.DeployData(args...)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	tx, err := gethtypes.SignTx(gethtypes.NewContractCreation(nonce, big.NewInt(0), gasLimit, gasPrice, data), signer, key)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	return crypto.CreateAddress(crypto.PubkeyToAddress(key.PublicKey), nonce), tx, nil
+}
+
+// Sign and send a tx deploying the contract of a with the constructor arguments. Returns the address of
+// the contract, which exists after the next block.
+func (c *Chain) DeployArtifact(key *ecdsa.PrivateKey, a *Artifact, args ...interface{}) (common.Address, *gethtypes.Transaction, error) {
+	data, err := a.DeployData(args...)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	return c.deploy(key, data)
+}
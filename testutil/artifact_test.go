@@ -0,0 +1,51 @@
+package testutil
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+const testABI = `[{"type":"constructor","inputs":[{"name":"x","type":"uint256"}],"stateMutability":"nonpayable"}]`
+
+func TestParseArtifact(t *testing.T) {
+	for _, js := range []string{
+		`{"abi":` + testABI + `,"bytecode":"0x6001"}`,                                                                           // Hardhat
+		`{"abi":` + testABI + `,"bytecode":{"object":"0x6001"}}`,                                                                // Foundry
+		`{"abi":` + testABI + `,"evm":{"bytecode":{"object":"6001"}}}`,                                                          // solc standard JSON
+		`{"abi":` + `"` + `[{\"type\":\"constructor\",\"inputs\":[{\"name\":\"x\",\"type\":\"uint256\"}]}]` + `","bin":"6001"}`, // solc combined JSON
+	} {
+		a, err := ParseArtifact([]byte(js))
+		require.NoError(t, err, js)
+		require.Equal(t, []byte{0x60, 0x01}, a.Bytecode)
+		data, err := a.DeployData(big.NewInt(5))
+		require.NoError(t, err)
+		require.Equal(t, append([]byte{0x60, 0x01}, common.BigToHash(big.NewInt(5)).Bytes()...), data)
+	}
+	_, err := ParseArtifact([]byte(`{"abi":[],"bytecode":"0x"}`))
+	require.Error(t, err)
+	_, err = ParseArtifact([]byte(`{"abi":[],"bytecode":"0x60__$abc$__"}`))
+	require.Error(t, err)
+	_, err = ParseArtifact([]byte(`{"bytecode":"0x6001"}`))
+	require.Error(t, err)
+}
+
+func TestSignDeployTx(t *testing.T) {
+	a, err := ParseArtifact([]byte(`{"abi":` + testABI + `,"bytecode":"0x6001"}`))
+	require.NoError(t, err)
+	c := NewChain()
+	key, from := NewKey()
+	addr, tx, err := SignDeployTx(c.Signer, key, 3, DefaultGasLimit, big.NewInt(DefaultGasPrice), a, big.NewInt(1))
+	require.NoError(t, err)
+	require.Equal(t, crypto.CreateAddress(from, 3), addr)
+	require.Nil(t, tx.To())
+	sender, err := c.Signer.Sender(tx)
+	require.NoError(t, err)
+	require.Equal(t, from, sender)
+
+	_, _, err = SignDeployTx(c.Signer, key, 3, DefaultGasLimit, big.NewInt(DefaultGasPrice), a) // missing argument
+	require.Error(t, err)
+}
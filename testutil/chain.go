@@ -0,0 +1,219 @@
+// Package testutil runs a txEngine over an in-memory store, such that the projects built on moeingevm can
+// test their contracts and TXs without a node. The engine uses the global ebp.Runners, so only one Chain
+// may be used at a time in a process.
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+	"github.com/smartbch/moeingads/store"
+	"github.com/smartbch/moeingads/store/rabbit"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/abiutil"
+	"github.com/smartbch/moeingevm/ebp"
+	"github.com/smartbch/moeingevm/types"
+)
+
+const (
+	DefaultChainID  = 10001
+	DefaultGasLimit = 1000_000
+	DefaultGasPrice = 1
+	BlockInterval   = 5 // the seconds between two blocks
+)
+
+// Chain is a single-node chain whose blocks are produced by AdvanceBlock
+type Chain struct {
+	Engine  ebp.TxExecutor
+	Signer  gethtypes.Signer
+	ChainID *big.Int
+
+	root     *store.MockRootStore
+	trunk    *store.TrunkStore
+	recorder *diffRecorder // wraps trunk
+	height   int64
+	time     int64
+}
+
+func NewChain() *Chain {
+	chainID := big.NewInt(DefaultChainID)
+	signer := gethtypes.NewEIP155Signer(chainID)
+	c := &Chain{
+		Engine:  ebp.NewEbpTxExec(10, 100, 4, 100, signer, log.NewNopLogger()),
+		Signer:  signer,
+		ChainID: chainID,
+		root:    store.NewMockRootStore(),
+		time:    1600000000,
+	}
+	c.trunk = c.root.GetTrunkStore(1000).(*store.TrunkStore)
+	c.recorder = &diffRecorder{BaseStoreI: c.trunk}
+	return c
+}
+
+// Returns a context of the latest state. The changes are written back if it is closed with true.
+func (c *Chain) Context() *types.Context {
+	rbt := rabbit.NewRabbitStore(c.recorder)
+	return types.NewContext(&rbt, nil)
+}
+
+// The height of the last block
+func (c *Chain) Height() int64 {
+	return c.height
+}
+
+// Generate a key and its address
+func NewKey() (*ecdsa.PrivateKey, common.Address) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		panic(err)
+	}
+	return key, crypto.PubkeyToAddress(key.PublicKey)
+}
+
+// Add amount to the balance of addr, creating the account if it does not exist
+func (c *Chain) Fund(addr common.Address, amount *uint256.Int) {
+	ctx := c.Context()
+	acc := ctx.GetAccount(addr)
+	if acc == nil {
+		acc = types.ZeroAccountInfo()
+	}
+	balance := acc.Balance()
+	acc.UpdateBalance(balance.Add(balance, amount))
+	ctx.SetAccount(addr, acc)
+	ctx.Close(true)
+}
+
+func (c *Chain) Balance(addr common.Address) *uint256.Int {
+	ctx := c.Context()
+	defer ctx.Close(false)
+	if acc := ctx.GetAccount(addr); acc != nil {
+		return acc.Balance()
+	}
+	return uint256.NewInt(0)
+}
+
+// Returns the nonce of addr in world state, which does not count the TXs waiting in the engine
+func (c *Chain) Nonce(addr common.Address) uint64 {
+	ctx := c.Context()
+	defer ctx.Close(false)
+	if acc := ctx.GetAccount(addr); acc != nil {
+		return acc.Nonce()
+	}
+	return 0
+}
+
+// Returns the runtime bytecode of addr, or nil if it is not a contract
+func (c *Chain) Code(addr common.Address) []byte {
+	ctx := c.Context()
+	defer ctx.Close(false)
+	if info := ctx.GetCode(addr); info != nil {
+		return info.BytecodeSlice()
+	}
+	return nil
+}
+
+// Sign a tx with the next nonce reserved for the sender, using DefaultGasPrice
+func (c *Chain) SignTx(key *ecdsa.PrivateKey, to *common.Address, value *big.Int, gasLimit uint64, data []byte) *gethtypes.Transaction {
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	c.Engine.SetContext(c.Context())
+	nonce, err := c.Engine.ReserveNonces(from, 1)
+	if err != nil {
+		panic(err)
+	}
+	var tx *gethtypes.Transaction
+	if to == nil {
+		tx = gethtypes.NewContractCreation(nonce, value, gasLimit, big.NewInt(DefaultGasPrice), data)
+	} else {
+		tx = gethtypes.NewTransaction(nonce, *to, value, gasLimit, big.NewInt(DefaultGasPrice), data)
+	}
+	tx, err = gethtypes.SignTx(tx, c.Signer, key)
+	if err != nil {
+		panic(err)
+	}
+	return tx
+}
+
+// Collect tx for the next block, if it passes ValidateTx
+func (c *Chain) SendTx(tx *gethtypes.Transaction) error {
+	c.Engine.SetContext(c.Context())
+	if err := c.Engine.ValidateTx(tx); err != nil {
+		return err
+	}
+	c.Engine.CollectTx(tx)
+	return nil
+}
+
+// Sign and send a tx transferring value to to
+func (c *Chain) Transfer(key *ecdsa.PrivateKey, to common.Address, value *big.Int) (*gethtypes.Transaction, error) {
+	tx := c.SignTx(key, &to, value, DefaultGasLimit, nil)
+	return tx, c.SendTx(tx)
+}
+
+// Sign and send a tx calling the contract at to with data
+func (c *Chain) Call(key *ecdsa.PrivateKey, to common.Address, data []byte) (*gethtypes.Transaction, error) {
+	tx := c.SignTx(key, &to, big.NewInt(0), DefaultGasLimit, data)
+	return tx, c.SendTx(tx)
+}
+
+// Sign and send a tx calling the function of signature at to, such as "transfer(address,uint256)"
+func (c *Chain) CallMethod(key *ecdsa.PrivateKey, to common.Address, signature string, args ...interface{}) (*gethtypes.Transaction, error) {
+	data, err := abiutil.Pack(signature, args...)
+	if err != nil {
+		return nil, err
+	}
+	return c.Call(key, to, data)
+}
+
+// Sign and send a tx creating a contract with the creation bytecode in hex, which may have the 0x
+// prefix. Returns the address of the contract, which exists after the next block.
+func (c *Chain) DeployHex(key *ecdsa.PrivateKey, creationHex string) (common.Address, *gethtypes.Transaction, error) {
+	code, err := hex.DecodeString(strings.TrimPrefix(creationHex, "0x"))
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	return c.deploy(key, code)
+}
+
+func (c *Chain) deploy(key *ecdsa.PrivateKey, data []byte) (common.Address, *gethtypes.Transaction, error) {
+	tx := c.SignTx(key, nil, big.NewInt(0), DefaultGasLimit, data)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	return crypto.CreateAddress(from, tx.Nonce()), tx, c.SendTx(tx)
+}
+
+// Produce a block executing the collected TXs, and return the TXs committed in it. The TXs which do not
+// fit in the rounds of one block stay in standby queue and are executed in the following blocks. The gas
+// fee refunds, which a node pays at the block boundaries, are not paid.
+func (c *Chain) AdvanceBlock() []*types.Transaction {
+	c.Engine.SetContext(c.Context())
+	c.Engine.Prepare(c.height, 0, ebp.DefaultTxGasLimit)
+	c.height++
+	c.time += BlockInterval
+	blk := &types.BlockInfo{
+		Number:    c.height,
+		Timestamp: c.time,
+		GasLimit:  int64(ebp.DefaultTxGasLimit),
+	}
+	copy(blk.ChainId[:], common.BigToHash(c.ChainID).Bytes())
+	blk.Hash = common.BigToHash(big.NewInt(c.height))
+	c.Engine.SetContext(c.Context())
+	c.Engine.Execute(blk)
+	txs := c.Engine.CommittedTxs()
+	c.recorder.addTxs(txs)
+	return txs
+}
+
+// Advance blocks until the TXs collected so far are committed, and return the committed TXs
+func (c *Chain) Commit() []*types.Transaction {
+	txs := append([]*types.Transaction{}, c.AdvanceBlock()...)
+	for c.Engine.StandbyQLen() != 0 {
+		txs = append(txs, c.AdvanceBlock()...)
+	}
+	return txs
+}
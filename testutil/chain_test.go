@@ -0,0 +1,42 @@
+package testutil
+
+import (
+	"math/big"
+	"testing"
+
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainTransfer(t *testing.T) {
+	c := NewChain()
+	key, from := NewKey()
+	_, to := NewKey()
+	c.Fund(from, uint256.NewInt(10_000_000))
+	require.Equal(t, uint256.NewInt(10_000_000), c.Balance(from))
+
+	tx1, err := c.Transfer(key, to, big.NewInt(100))
+	require.NoError(t, err)
+	tx2, err := c.Transfer(key, to, big.NewInt(200))
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), tx1.Nonce())
+	require.Equal(t, uint64(1), tx2.Nonce()) // the nonce of tx1 is reserved
+
+	txs := c.Commit()
+	require.Equal(t, 2, len(txs))
+	for _, tx := range txs {
+		require.Equal(t, gethtypes.ReceiptStatusSuccessful, tx.Status)
+	}
+	require.Equal(t, int64(1), c.Height())
+	require.Equal(t, uint64(2), c.Nonce(from))
+	require.Equal(t, uint256.NewInt(300), c.Balance(to))
+	// the fee of the whole gas limit is deducted, and the refund is left to the application
+	require.Equal(t, uint256.NewInt(10_000_000-300-2*DefaultGasLimit*DefaultGasPrice), c.Balance(from))
+
+	_, err = c.CallMethod(key, to, "transfer(address,uint256)", to) // missing argument
+	require.Error(t, err)
+	_, _, err = c.DeployHex(key, "0xzz")
+	require.Error(t, err)
+	require.Nil(t, c.Code(to))
+}
@@ -0,0 +1,97 @@
+package testutil
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+var updateGasGolden = flag.Bool("update-gas-golden", false, "write the gas used by the scenarios into the golden files")
+
+// GasGolden compares the gas used by named scenarios with the amounts recorded in a golden file, such that the
+// changes of gas accounting, which break consensus, are not made silently. When a test is run with
+// -update-gas-golden, the file is written instead, and the changes show up in the diff for review.
+type GasGolden struct {
+	path   string
+	mtx    sync.Mutex
+	golden map[string]uint64
+	got    map[string]uint64
+}
+
+// Load the golden file at path, and compare the scenarios recorded in t with it when t finishes
+func NewGasGolden(t testing.TB, path string) *GasGolden {
+	t.Helper()
+	g := &GasGolden{path: path, golden: make(map[string]uint64), got: make(map[string]uint64)}
+	bz, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(bz, &g.golden)
+	}
+	if err != nil && !(os.IsNotExist(err) && *updateGasGolden) {
+		t.Fatalf("cannot load gas golden file: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := g.finish(*updateGasGolden); err != nil {
+			t.Error(err)
+		}
+	})
+	return g
+}
+
+// Record the gas used by the scenario of name
+func (g *GasGolden) Record(name string, gasUsed uint64) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.got[name] = gasUsed
+}
+
+// Record the total gas used by txs as the scenario of name
+func (g *GasGolden) RecordTxs(name string, txs []*types.Transaction) {
+	var gasUsed uint64
+	for _, tx := range txs {
+		gasUsed += tx.GasUsed
+	}
+	g.Record(name, gasUsed)
+}
+
+// Compare the recorded scenarios with the golden ones, or write them into the golden file. The scenarios
+// which are not recorded in this run are kept, because a test may be filtered by -run.
+func (g *GasGolden) finish(update bool) error {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if update {
+		for name, gasUsed := range g.got {
+			g.golden[name] = gasUsed
+		}
+		bz, err := json.MarshalIndent(g.golden, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(g.path), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(g.path, append(bz, '\n'), 0o644)
+	}
+	var diffs []string
+	for name, gasUsed := range g.got {
+		golden, ok := g.golden[name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: %d, not in the golden file", name, gasUsed))
+		} else if golden != gasUsed {
+			diffs = append(diffs, fmt.Sprintf("%s: %d, golden %d (%+d)", name, gasUsed, golden, int64(gasUsed-golden)))
+		}
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+	sort.Strings(diffs)
+	return fmt.Errorf("gas used differs from %s, run with -update-gas-golden if it is expected:\n%s",
+		g.path, strings.Join(diffs, "\n"))
+}
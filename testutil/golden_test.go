@@ -0,0 +1,56 @@
+package testutil
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+// The gas used by the scenarios is recorded in testdata/gas.golden.json. The gas limits are close to the gas
+// used, which is not adjusted for the unused gas.
+func TestGasOfTransfers(t *testing.T) {
+	g := NewGasGolden(t, "testdata/gas.golden.json")
+	c := NewChain()
+	key, from := NewKey()
+	_, to := NewKey()
+	c.Fund(from, uint256.NewInt(1e18))
+	send := func(data []byte) {
+		require.NoError(t, c.SendTx(c.SignTx(key, &to, big.NewInt(100), 30000, data)))
+	}
+
+	send(nil)
+	g.RecordTxs("transfer", c.Commit())
+	send(nil)
+	send(nil)
+	g.RecordTxs("twoTransfers", c.Commit())
+	send([]byte{1, 2, 0, 0})
+	g.RecordTxs("transferWithData", c.Commit())
+	// the gas used is adjusted when it is less than a quarter of the gas limit
+	_, err := c.Transfer(key, to, big.NewInt(100))
+	require.NoError(t, err)
+	g.RecordTxs("transferWithDefaultGasLimit", c.Commit())
+}
+
+func TestGasGoldenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gas.json")
+	g := &GasGolden{path: path, golden: map[string]uint64{"kept": 1}, got: map[string]uint64{"a": 100}}
+	require.NoError(t, g.finish(true))
+	bz, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \"a\": 100,\n  \"kept\": 1\n}\n", string(bz))
+
+	g = NewGasGolden(t, path)
+	g.Record("a", 100)
+	require.NoError(t, g.finish(false))
+	g.Record("a", 90)
+	g.Record("b", 5)
+	err = g.finish(false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "a: 90, golden 100 (-10)")
+	require.Contains(t, err.Error(), "b: 5, not in the golden file")
+	g.got = map[string]uint64{} // not to fail in the cleanup
+}
@@ -0,0 +1,281 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartbch/moeingads/store/rabbit"
+	storetypes "github.com/smartbch/moeingads/store/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// diffRecorder is the store under the contexts of a Chain. When a snapshot is active, it records the value
+// of each key before the first write, which is decoded from the entry written by the RabbitStores.
+type diffRecorder struct {
+	storetypes.BaseStoreI
+	mtx       sync.Mutex
+	snapshots []*Snapshot
+}
+
+func (r *diffRecorder) Update(updater func(db storetypes.SetDeleter)) {
+	r.BaseStoreI.Update(func(db storetypes.SetDeleter) {
+		updater(&recordingSetDeleter{r: r, db: db})
+	})
+}
+
+type recordingSetDeleter struct {
+	r  *diffRecorder
+	db storetypes.SetDeleter
+}
+
+func (s *recordingSetDeleter) Set(key, value []byte) {
+	s.r.recordBefore(key)
+	if cv := rabbit.BytesToCachedValue(value); cv != nil {
+		s.r.touch(cv.GetKey(), nil, false) // the key is new if it was not recorded before
+	}
+	s.db.Set(key, value)
+}
+
+func (s *recordingSetDeleter) Delete(key []byte) {
+	s.r.recordBefore(key)
+	s.db.Delete(key)
+}
+
+// Record the value of the entry at the short key of rabbit, before it is changed
+func (r *diffRecorder) recordBefore(shortKey []byte) {
+	if cv := rabbit.BytesToCachedValue(r.BaseStoreI.Get(shortKey)); cv != nil {
+		var value []byte
+		if !cv.IsEmpty() {
+			value = cv.GetValue()
+		}
+		r.touch(cv.GetKey(), value, true)
+	}
+}
+
+func (r *diffRecorder) touch(key, value []byte, exists bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, s := range r.snapshots {
+		if _, ok := s.before[string(key)]; !ok {
+			s.before[string(key)] = beforeValue{value: append([]byte{}, value...), exists: exists}
+		}
+	}
+}
+
+func (r *diffRecorder) addTxs(txs []*types.Transaction) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, s := range r.snapshots {
+		s.txs = append(s.txs, txs...)
+	}
+}
+
+type beforeValue struct {
+	value  []byte
+	exists bool
+}
+
+// Snapshot captures the changes of state made after it is taken, and the TXs committed meanwhile
+type Snapshot struct {
+	chain  *Chain
+	before map[string]beforeValue
+	txs    []*types.Transaction
+}
+
+// Start capturing the changes of state, until Diff is called
+func (c *Chain) Snapshot() *Snapshot {
+	s := &Snapshot{chain: c, before: make(map[string]beforeValue)}
+	c.recorder.mtx.Lock()
+	c.recorder.snapshots = append(c.recorder.snapshots, s)
+	c.recorder.mtx.Unlock()
+	return s
+}
+
+// Stop capturing and return the changes since the snapshot was taken
+func (s *Snapshot) Diff() *StateDiff {
+	r := s.chain.recorder
+	r.mtx.Lock()
+	for i, other := range r.snapshots {
+		if other == s {
+			r.snapshots = append(r.snapshots[:i], r.snapshots[i+1:]...)
+			break
+		}
+	}
+	r.mtx.Unlock()
+
+	d := &StateDiff{
+		chain:    s.chain,
+		Accounts: make(map[common.Address]AccountChange),
+		Storage:  make(map[uint64]map[common.Hash]SlotChange),
+		Txs:      s.txs,
+	}
+	ctx := s.chain.Context()
+	defer ctx.Close(false)
+	for k, before := range s.before {
+		key := []byte(k)
+		after := ctx.Rbt.Get(key)
+		if before.exists == (after != nil) && bytes.Equal(before.value, after) {
+			continue
+		}
+		var beforeBz []byte
+		if before.exists {
+			beforeBz = before.value
+		}
+		switch {
+		case len(key) == 1+20 && key[0] == types.ACCOUNT_KEY:
+			d.Accounts[common.BytesToAddress(key[1:])] = AccountChange{
+				Before: decodeAccount(beforeBz),
+				After:  decodeAccount(after),
+			}
+		case len(key) == 1+8+32 && key[0] == types.VALUE_KEY:
+			seq := binary.BigEndian.Uint64(key[1:9])
+			if d.Storage[seq] == nil {
+				d.Storage[seq] = make(map[common.Hash]SlotChange)
+			}
+			d.Storage[seq][common.BytesToHash(key[9:])] = SlotChange{
+				Before: common.BytesToHash(beforeBz),
+				After:  common.BytesToHash(after),
+			}
+		}
+	}
+	return d
+}
+
+func decodeAccount(bz []byte) *types.AccountInfo {
+	if len(bz) == 0 {
+		return nil
+	}
+	return types.NewAccountInfo(bz)
+}
+
+type AccountChange struct {
+	Before, After *types.AccountInfo // nil if the account does not exist
+}
+
+type SlotChange struct {
+	Before, After common.Hash // zero if the slot is empty
+}
+
+// StateDiff is the changes of accounts and storage slots captured by a Snapshot, with the committed TXs
+type StateDiff struct {
+	Accounts map[common.Address]AccountChange
+	Storage  map[uint64]map[common.Hash]SlotChange // by the sequences of contracts
+	Txs      []*types.Transaction
+
+	chain *Chain
+}
+
+// Returns the change of addr's balance, which is negative if the balance is decreased
+func (d *StateDiff) BalanceChange(addr common.Address) *big.Int {
+	ch, ok := d.Accounts[addr]
+	if !ok {
+		return big.NewInt(0)
+	}
+	delta := new(big.Int)
+	if ch.After != nil {
+		delta.Set(ch.After.Balance().ToBig())
+	}
+	if ch.Before != nil {
+		delta.Sub(delta, ch.Before.Balance().ToBig())
+	}
+	return delta
+}
+
+// Returns the change of a storage slot of contract, and false if it is unchanged
+func (d *StateDiff) Slot(contract common.Address, slot common.Hash) (SlotChange, bool) {
+	var acc *types.AccountInfo
+	if ch, ok := d.Accounts[contract]; ok && ch.After == nil {
+		acc = ch.Before // the account is removed
+	} else {
+		ctx := d.chain.Context()
+		acc = ctx.GetAccount(contract)
+		ctx.Close(false)
+	}
+	if acc == nil {
+		return SlotChange{}, false
+	}
+	ch, ok := d.Storage[acc.Sequence()][slot]
+	return ch, ok
+}
+
+// Returns the logs of contract in the committed TXs, whose topics start with topics
+func (d *StateDiff) Logs(contract common.Address, topics ...common.Hash) []types.Log {
+	var logs []types.Log
+	for _, tx := range d.Txs {
+		for _, log := range tx.Logs {
+			if common.Address(log.Address) == contract && hasTopicPrefix(log.Topics, topics) {
+				logs = append(logs, log)
+			}
+		}
+	}
+	return logs
+}
+
+func hasTopicPrefix(logTopics [][32]byte, topics []common.Hash) bool {
+	if len(logTopics) < len(topics) {
+		return false
+	}
+	for i, t := range topics {
+		if common.Hash(logTopics[i]) != t {
+			return false
+		}
+	}
+	return true
+}
+
+// Expectation checks a StateDiff, and returns the reason if it does not hold
+type Expectation func(d *StateDiff) error
+
+// The balance of addr is changed by delta, which is negative for a decrease
+func BalanceChanged(addr common.Address, delta *big.Int) Expectation {
+	return func(d *StateDiff) error {
+		if got := d.BalanceChange(addr); got.Cmp(delta) != 0 {
+			return fmt.Errorf("balance of %s changed by %s, expected %s", addr.Hex(), got, delta)
+		}
+		return nil
+	}
+}
+
+// The storage slot of contract became value
+func SlotBecame(contract common.Address, slot, value common.Hash) Expectation {
+	return func(d *StateDiff) error {
+		ch, ok := d.Slot(contract, slot)
+		if !ok {
+			return fmt.Errorf("slot %s of %s is unchanged, expected %s", slot.Hex(), contract.Hex(), value.Hex())
+		}
+		if ch.After != value {
+			return fmt.Errorf("slot %s of %s became %s, expected %s", slot.Hex(), contract.Hex(), ch.After.Hex(), value.Hex())
+		}
+		return nil
+	}
+}
+
+// A log was emitted by contract, whose topics start with topics
+func LogEmitted(contract common.Address, topics ...common.Hash) Expectation {
+	return func(d *StateDiff) error {
+		if len(d.Logs(contract, topics...)) == 0 {
+			return fmt.Errorf("no log of %s with topics %v", contract.Hex(), topics)
+		}
+		return nil
+	}
+}
+
+// Check the expectations against d, failing t with the ones which do not hold
+func ExpectStateDiff(t require.TestingT, d *StateDiff, expectations ...Expectation) {
+	var failures []string
+	for _, exp := range expectations {
+		if err := exp(d); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) != 0 {
+		require.Fail(t, "unexpected state diff", strings.Join(failures, "\n"))
+	}
+}
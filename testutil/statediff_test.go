@@ -0,0 +1,82 @@
+package testutil
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestStateDiff(t *testing.T) {
+	c := NewChain()
+	key, from := NewKey()
+	_, to := NewKey()
+	contract := common.Address{0x77}
+	c.Fund(from, uint256.NewInt(10_000_000))
+	c.Fund(contract, uint256.NewInt(1))
+	ctx := c.Context()
+	seq := ctx.GetAccount(contract).Sequence()
+	ctx.SetStorageAt(seq, string(common.Hash{1}.Bytes()), common.Hash{0xaa}.Bytes())
+	ctx.Close(true)
+
+	snap := c.Snapshot()
+	_, err := c.Transfer(key, to, big.NewInt(100))
+	require.NoError(t, err)
+	c.Commit()
+	ctx = c.Context()
+	ctx.SetStorageAt(seq, string(common.Hash{1}.Bytes()), common.Hash{0xbb}.Bytes())
+	ctx.SetStorageAt(seq, string(common.Hash{2}.Bytes()), common.Hash{0xcc}.Bytes())
+	ctx.Close(true)
+	d := snap.Diff()
+
+	ExpectStateDiff(t, d,
+		BalanceChanged(to, big.NewInt(100)),
+		BalanceChanged(from, big.NewInt(-100-DefaultGasLimit*DefaultGasPrice)),
+		BalanceChanged(contract, big.NewInt(0)),
+		SlotBecame(contract, common.Hash{1}, common.Hash{0xbb}),
+		SlotBecame(contract, common.Hash{2}, common.Hash{0xcc}),
+	)
+	require.Nil(t, d.Accounts[to].Before)
+	require.Equal(t, uint64(1), d.Accounts[from].After.Nonce())
+	ch, ok := d.Slot(contract, common.Hash{1})
+	require.True(t, ok)
+	require.Equal(t, common.Hash{0xaa}, ch.Before)
+	_, ok = d.Slot(contract, common.Hash{3})
+	require.False(t, ok)
+	require.Equal(t, 1, len(d.Txs))
+
+	// the changes after Diff are not captured
+	c.Fund(to, uint256.NewInt(5))
+	require.Equal(t, big.NewInt(100), d.BalanceChange(to))
+
+	mockT := &fakeT{}
+	ExpectStateDiff(mockT, d,
+		BalanceChanged(to, big.NewInt(1)),
+		SlotBecame(contract, common.Hash{3}, common.Hash{0xdd}),
+		LogEmitted(contract),
+	)
+	require.Contains(t, mockT.msg, "changed by 100, expected 1")
+	require.Contains(t, mockT.msg, "is unchanged")
+	require.Contains(t, mockT.msg, "no log")
+
+	topic := common.Hash{0x11}
+	d.Txs = append(d.Txs, &types.Transaction{Logs: []types.Log{{Address: contract, Topics: [][32]byte{topic, {0x22}}}}})
+	ExpectStateDiff(t, d, LogEmitted(contract), LogEmitted(contract, topic), LogEmitted(contract, topic, common.Hash{0x22}))
+	require.Empty(t, d.Logs(contract, common.Hash{0x22}))
+	require.Empty(t, d.Logs(to))
+}
+
+type fakeT struct {
+	msg string
+}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.msg += fmt.Sprintf(format, args...)
+}
+
+func (t *fakeT) FailNow() {}
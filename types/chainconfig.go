@@ -0,0 +1,111 @@
+package types
+
+import (
+	"fmt"
+)
+
+// Revision is the EVM revision (hardfork) of evmone, as the evmc_revision enum. It selects the gas tables
+// and the enabled opcodes: CHAINID and SELFBALANCE since Istanbul, BASEFEE since London, and PUSH0 since
+// Shanghai.
+type Revision int32
+
+const (
+	Petersburg Revision = 6
+	Istanbul   Revision = 7
+	Berlin     Revision = 8
+	London     Revision = 9
+	Paris      Revision = 10
+	Shanghai   Revision = 11
+)
+
+var revisionNames = map[Revision]string{
+	Petersburg: "petersburg",
+	Istanbul:   "istanbul",
+	Berlin:     "berlin",
+	London:     "london",
+	Paris:      "paris",
+	Shanghai:   "shanghai",
+}
+
+func (r Revision) String() string {
+	if name, ok := revisionNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("revision(%d)", int32(r))
+}
+
+// Rules are the EVM rules taking effect since an upgrade
+type Rules struct {
+	Revision Revision
+	// The refund of a tx is no more than gasUsed/RefundQuotient, which is 2 before London and 5 since
+	// London (EIP-3529)
+	RefundQuotient uint64
+	// The BLS12-381 precompiles of EIP-2537 are enabled at the addresses from 0x0a to 0x12
+	BLSPrecompiles bool
+	// The precompile verifying the Schnorr signatures of Bitcoin Cash is enabled at 0x2715
+	SchnorrPrecompile bool
+	// The precompile verifying the SPV proofs of the BCH mainchain TXs is enabled at 0x2716
+	BchSpvPrecompile bool
+	// The precompile returning the random beacons provided by the consensus is enabled at 0x2718
+	RandomBeaconPrecompile bool
+	// The native modules registered in Go are callable by contracts at 0x2800~0x28ff
+	NativeModules bool
+}
+
+// The rules used before ChainConfig is introduced
+var DefaultRules = Rules{Revision: Istanbul, RefundQuotient: 2}
+
+type Upgrade struct {
+	Height int64
+	Rules
+}
+
+// ChainConfig schedules the upgrades of the EVM rules by height, such that the chain can be upgraded without
+// rebuilding with different constants. DefaultRules are used before the first upgrade.
+type ChainConfig struct {
+	Upgrades []Upgrade // sorted by height
+}
+
+func (cfg *ChainConfig) Validate() error {
+	for i, u := range cfg.Upgrades {
+		if i != 0 && u.Height <= cfg.Upgrades[i-1].Height {
+			return fmt.Errorf("upgrade at %d is not after the one at %d", u.Height, cfg.Upgrades[i-1].Height)
+		}
+		if _, ok := revisionNames[u.Revision]; !ok {
+			return fmt.Errorf("upgrade at %d has unsupported %s", u.Height, u.Revision)
+		}
+		if u.RefundQuotient == 0 {
+			return fmt.Errorf("upgrade at %d has zero refund quotient", u.Height)
+		}
+		if i == 0 {
+			continue
+		}
+		if prev := cfg.Upgrades[i-1]; prev.BLSPrecompiles && !u.BLSPrecompiles {
+			return fmt.Errorf("upgrade at %d disables the BLS precompiles", u.Height)
+		} else if prev.SchnorrPrecompile && !u.SchnorrPrecompile {
+			return fmt.Errorf("upgrade at %d disables the Schnorr precompile", u.Height)
+		} else if prev.BchSpvPrecompile && !u.BchSpvPrecompile {
+			return fmt.Errorf("upgrade at %d disables the BCH SPV precompile", u.Height)
+		} else if prev.RandomBeaconPrecompile && !u.RandomBeaconPrecompile {
+			return fmt.Errorf("upgrade at %d disables the random beacon precompile", u.Height)
+		} else if prev.NativeModules && !u.NativeModules {
+			return fmt.Errorf("upgrade at %d disables the native modules", u.Height)
+		}
+	}
+	return nil
+}
+
+// The rules of the block at height. A nil ChainConfig always returns DefaultRules.
+func (cfg *ChainConfig) RulesAt(height int64) Rules {
+	rules := DefaultRules
+	if cfg == nil {
+		return rules
+	}
+	for _, u := range cfg.Upgrades {
+		if u.Height > height {
+			break
+		}
+		rules = u.Rules
+	}
+	return rules
+}
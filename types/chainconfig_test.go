@@ -0,0 +1,60 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainConfig(t *testing.T) {
+	var nilCfg *ChainConfig
+	require.Equal(t, DefaultRules, nilCfg.RulesAt(100))
+
+	london := Rules{Revision: London, RefundQuotient: 5}
+	shanghai := Rules{Revision: Shanghai, RefundQuotient: 5}
+	cfg := &ChainConfig{Upgrades: []Upgrade{{Height: 10, Rules: london}, {Height: 20, Rules: shanghai}}}
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, DefaultRules, cfg.RulesAt(9))
+	require.Equal(t, london, cfg.RulesAt(10))
+	require.Equal(t, london, cfg.RulesAt(19))
+	require.Equal(t, shanghai, cfg.RulesAt(20))
+	require.Equal(t, shanghai, cfg.RulesAt(1000))
+
+	cfg.Upgrades[1].Height = 10
+	require.EqualError(t, cfg.Validate(), "upgrade at 10 is not after the one at 10")
+	cfg.Upgrades[1].Height = 20
+	cfg.Upgrades[1].Revision = 12
+	require.EqualError(t, cfg.Validate(), "upgrade at 20 has unsupported revision(12)")
+	cfg.Upgrades[1].Revision = Shanghai
+	cfg.Upgrades[1].RefundQuotient = 0
+	require.EqualError(t, cfg.Validate(), "upgrade at 20 has zero refund quotient")
+	cfg.Upgrades[1].RefundQuotient = 5
+	cfg.Upgrades[0].BLSPrecompiles = true
+	require.EqualError(t, cfg.Validate(), "upgrade at 20 disables the BLS precompiles")
+	cfg.Upgrades[1].BLSPrecompiles = true
+	require.NoError(t, cfg.Validate())
+	cfg.Upgrades[0].SchnorrPrecompile = true
+	require.EqualError(t, cfg.Validate(), "upgrade at 20 disables the Schnorr precompile")
+	cfg.Upgrades[1].SchnorrPrecompile = true
+	require.NoError(t, cfg.Validate())
+	cfg.Upgrades[0].BchSpvPrecompile = true
+	require.EqualError(t, cfg.Validate(), "upgrade at 20 disables the BCH SPV precompile")
+	cfg.Upgrades[1].BchSpvPrecompile = true
+	require.NoError(t, cfg.Validate())
+	cfg.Upgrades[0].RandomBeaconPrecompile = true
+	require.EqualError(t, cfg.Validate(), "upgrade at 20 disables the random beacon precompile")
+	cfg.Upgrades[1].RandomBeaconPrecompile = true
+	require.NoError(t, cfg.Validate())
+	cfg.Upgrades[0].NativeModules = true
+	require.EqualError(t, cfg.Validate(), "upgrade at 20 disables the native modules")
+	cfg.Upgrades[1].NativeModules = true
+	require.NoError(t, cfg.Validate())
+}
+
+func TestChainConfigInContext(t *testing.T) {
+	cfg := &ChainConfig{Upgrades: []Upgrade{{Height: 1, Rules: Rules{Revision: Berlin, RefundQuotient: 2}}}}
+	ctx := NewContext(nil, nil)
+	ctx.SetChainConfig(cfg)
+	require.Same(t, cfg, ctx.WithDb(nil).ChainConfig)
+	require.Same(t, cfg, ctx.WithRbt(nil).ChainConfig)
+}
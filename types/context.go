@@ -2,25 +2,29 @@ package types
 
 import (
 	"bytes"
-	"errors"
 	"math"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/holiman/uint256"
 	"github.com/smartbch/moeingads/store/rabbit"
+	storetypes "github.com/smartbch/moeingads/store/types"
 	modbtypes "github.com/smartbch/moeingdb/types"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingevm/errors"
 )
 
+// kept for the existing callers, they are the same as the ones in moeingevm/errors
 var (
-	ErrAccountNotExist        = errors.New("account does not exist")
-	ErrNonceTooSmall          = errors.New("tx nonce is smaller than the account nonce")
-	ErrSameNonceAlredyInBlock = errors.New("tx with same nonce already in block")
-	ErrNonceTooLarge          = errors.New("tx nonce is larger than the account nonce")
-	ErrTooManyEntries         = errors.New("too many candidicate entries to be returned, please limit the difference between startHeight and endHeight")
+	ErrAccountNotExist        = errors.ErrAccountNotExist
+	ErrNonceTooSmall          = errors.ErrNonceTooSmall
+	ErrSameNonceAlredyInBlock = errors.ErrSameNonceAlredyInBlock
+	ErrNonceTooLarge          = errors.ErrNonceTooLarge
+	ErrTooManyEntries         = errors.ErrTooManyEntries
 )
 
-// update WithRbtCopy when fields change in Context
+// update withRbtParent when fields change in Context
 type Context struct {
 	Rbt                 *rabbit.RabbitStore
 	Db                  modbtypes.DB
@@ -30,6 +34,29 @@ type Context struct {
 	StakingForkBlock    int64
 	ShaGateForkBlock    int64
 	Type                uint8
+	// it provides the state missing in Rbt if it is not nil, such as the state of a forked node
+	Remote RemoteState
+	// the upgrades of the EVM rules, DefaultRules are used if it is nil
+	ChainConfig *ChainConfig
+
+	closed    bool
+	createdAt []byte            // the stack where this Context was created, only recorded in debug builds
+	scope     *OverlayBaseStore // the parent of Rbt, if this Context is a sub-context made by RunScoped
+}
+
+// RemoteState is the origin of the state which is not in the local store, such as a live node forked by a
+// sandbox. It must copy a fetched value into the local store, and return the local one afterwards, such
+// that the later changes and deletions are kept.
+type RemoteState interface {
+	// Returns the value of key, which is missing in the RabbitStore of a Context
+	Fetch(key []byte) []byte
+}
+
+// ctxLogger reports the misuses of Context which are tolerated, such as closing it twice
+var ctxLogger log.Logger = log.NewNopLogger()
+
+func SetContextLogger(logger log.Logger) {
+	ctxLogger = logger
 }
 
 func NewContext(rbt *rabbit.RabbitStore, db modbtypes.DB) *Context {
@@ -40,10 +67,12 @@ func NewContext(rbt *rabbit.RabbitStore, db modbtypes.DB) *Context {
 		SymbolSbchForkBlock: math.MaxInt64,
 		StakingForkBlock:    math.MaxInt64,
 		ShaGateForkBlock:    math.MaxInt64,
+		createdAt:           creationStack(),
 	}
 }
 
 func (c *Context) WithRbt(rabbitStore *rabbit.RabbitStore) *Context {
+	c.mustNotBeClosed()
 	return &Context{
 		Rbt:                 rabbitStore,
 		Db:                  c.Db,
@@ -52,10 +81,14 @@ func (c *Context) WithRbt(rabbitStore *rabbit.RabbitStore) *Context {
 		StakingForkBlock:    c.StakingForkBlock,
 		ShaGateForkBlock:    c.ShaGateForkBlock,
 		Height:              c.Height,
+		Remote:              c.Remote,
+		ChainConfig:         c.ChainConfig,
+		createdAt:           creationStack(),
 	}
 }
 
 func (c *Context) WithDb(db modbtypes.DB) *Context {
+	c.mustNotBeClosed()
 	return &Context{
 		Rbt:                 c.Rbt,
 		Db:                  db,
@@ -64,6 +97,9 @@ func (c *Context) WithDb(db modbtypes.DB) *Context {
 		StakingForkBlock:    c.StakingForkBlock,
 		ShaGateForkBlock:    c.ShaGateForkBlock,
 		Height:              c.Height,
+		Remote:              c.Remote,
+		ChainConfig:         c.ChainConfig,
+		createdAt:           creationStack(),
 	}
 }
 
@@ -75,51 +111,129 @@ const (
 )
 
 func (c *Context) SetType(t uint8) {
+	c.mustNotBeClosed()
 	c.Type = t
 }
 
 func (c *Context) SetXHedgeForkBlock(xHedgeForkBlock int64) {
+	c.mustNotBeClosed()
 	c.XHedgeForkBlock = xHedgeForkBlock
 }
 
 func (c *Context) SetSymbolSbchBlock(symbolSbchForkBlock int64) {
+	c.mustNotBeClosed()
 	c.SymbolSbchForkBlock = symbolSbchForkBlock
 }
 
 func (c *Context) SetStakingForkBlock(stakingForkBlock int64) {
+	c.mustNotBeClosed()
 	c.StakingForkBlock = stakingForkBlock
 }
 
 func (c *Context) SetShaGateForkBlock(shaGateForkBlock int64) {
+	c.mustNotBeClosed()
 	c.ShaGateForkBlock = shaGateForkBlock
 }
 
+func (c *Context) SetChainConfig(cfg *ChainConfig) {
+	c.mustNotBeClosed()
+	c.ChainConfig = cfg
+}
+
 func (c *Context) SetCurrentHeight(height int64) {
+	c.mustNotBeClosed()
 	c.Height = height
 }
 
 func (c *Context) IsXHedgeFork() bool {
+	c.mustNotBeClosed()
 	return c.Height >= c.XHedgeForkBlock
 }
 
 func (c *Context) IsSymbolSbchFork() bool {
+	c.mustNotBeClosed()
 	return c.Height >= c.SymbolSbchForkBlock
 }
 
 func (c *Context) IsStakingFork() bool {
+	c.mustNotBeClosed()
 	return c.Height >= c.StakingForkBlock
 }
 
 func (c *Context) IsShaGateFork() bool {
+	c.mustNotBeClosed()
 	return c.Height >= c.ShaGateForkBlock
 }
 
 //new empty rbt with same parent store as the old one
 func (c *Context) WithRbtCopy() *Context {
+	c.mustNotBeClosed()
+	if !c.Rbt.IsClean() {
+		panic("Can not copy when rabbitstore is not clean")
+	}
+	return c.withRbtParent(c.Rbt.GetBaseStore())
+}
+
+// Like WithRbtCopy, but the new rbt reads through 'cow', which is shared by all the copies made in a round.
+// So the copies do not fetch and cache the same entries again and again, they only diverge at the written ones.
+func (c *Context) WithCowRbtCopy(cow *CowBaseStore) *Context {
+	c.mustNotBeClosed()
 	if !c.Rbt.IsClean() {
 		panic("Can not copy when rabbitstore is not clean")
 	}
-	parent := c.Rbt.GetBaseStore()
+	if cow.Parent() != c.Rbt.GetBaseStore() {
+		panic("CowBaseStore does not share the parent store of rabbitstore")
+	}
+	return c.withRbtParent(cow)
+}
+
+// Like WithRbtCopy, but the new rbt reads and writes back through 'overlay', which keeps the updates in memory
+func (c *Context) WithOverlayRbtCopy(overlay *OverlayBaseStore) *Context {
+	c.mustNotBeClosed()
+	if !c.Rbt.IsClean() {
+		panic("Can not copy when rabbitstore is not clean")
+	}
+	if overlay.parent != c.Rbt.GetBaseStore() {
+		panic("OverlayBaseStore does not share the parent store of rabbitstore")
+	}
+	return c.withRbtParent(overlay)
+}
+
+// RunScoped runs fn on a sub-context of c, whose changes are written back to the base store of c only if fn
+// returns nil. They are discarded if fn returns an error or panics, so a failing system hook cannot leave
+// partial state. The panic is not recovered. fn must not close sub.
+//
+// c must be clean as in WithRbtCopy, unless it is a sub-context itself: the scopes can be nested, and then
+// the changes made through c are visible to fn, and the ones committed by fn are only kept if c commits too.
+func (c *Context) RunScoped(fn func(sub *Context) error) error {
+	c.mustNotBeClosed()
+	if c.scope != nil {
+		// move the changes of c into its overlay, which is the parent of the nested one
+		c.Rbt.CloseAndWriteBack(true)
+		r := rabbit.NewRabbitStore(c.scope)
+		c.Rbt = &r
+	} else if !c.Rbt.IsClean() {
+		panic("Can not run a scope when rabbitstore is not clean")
+	}
+	overlay := NewOverlayBaseStore(c.Rbt.GetBaseStore())
+	sub := c.withRbtParent(overlay)
+	sub.scope = overlay
+	committed := false
+	defer func() {
+		if !committed { // fn returned an error or panicked
+			sub.Close(false)
+		}
+	}()
+	if err := fn(sub); err != nil {
+		return err
+	}
+	committed = true
+	sub.Close(true)
+	overlay.WriteToParent()
+	return nil
+}
+
+func (c *Context) withRbtParent(parent storetypes.BaseStoreI) *Context {
 	r := rabbit.NewRabbitStore(parent)
 	return &Context{
 		Rbt:                 &r,
@@ -130,18 +244,65 @@ func (c *Context) WithRbtCopy() *Context {
 		SymbolSbchForkBlock: c.SymbolSbchForkBlock,
 		Height:              c.Height,
 		Type:                c.Type,
+		Remote:              c.Remote,
+		ChainConfig:         c.ChainConfig,
+		createdAt:           creationStack(),
 	}
 }
 
+// Close is idempotent: the RabbitStore is only closed (and written back) the first time
 func (c *Context) Close(dirty bool) {
+	if c.closed {
+		ctxLogger.Error("Context is closed twice", "height", c.Height, "createdAt", string(c.createdAt))
+		return
+	}
+	c.closed = true
 	if c.Rbt != nil {
 		c.Rbt.CloseAndWriteBack(dirty)
 	}
 }
 
+func (c *Context) IsClosed() bool {
+	return c.closed
+}
+
+// Reopen returns a new Context with the settings of the closed c and a clean RabbitStore over its base
+// store, such that the state can still be read after c releases the base store in Close.
+func (c *Context) Reopen() *Context {
+	if !c.closed {
+		panic("Can not reopen a Context which is not closed")
+	}
+	return c.withRbtParent(c.Rbt.GetBaseStore())
+}
+
+// Panics if the Context is used after Close, because its RabbitStore may have been written back
+// and the further changes would be silently lost.
+func (c *Context) mustNotBeClosed() {
+	if !c.closed {
+		return
+	}
+	if len(c.createdAt) == 0 {
+		panic("Context is used after Close (build with '-tags debug' to see where it was created)")
+	}
+	panic("Context is used after Close, it was created at:\n" + string(c.createdAt))
+}
+
+// Returns the value of k in Rbt, or the one fetched from Remote, which is then cached in Rbt
+func (c *Context) getOrFetch(k []byte) []byte {
+	v := c.Rbt.Get(k)
+	if v != nil || c.Remote == nil {
+		return v
+	}
+	if v = c.Remote.Fetch(k); v != nil {
+		c.Rbt.Set(k, v)
+	}
+	return v
+}
+
 func (c *Context) GetAccount(address common.Address) *AccountInfo {
+	c.mustNotBeClosed()
 	k := GetAccountKey(address)
-	v := c.Rbt.Get(k)
+	v := c.getOrFetch(k)
 	if len(v) == 0 {
 		return nil
 	}
@@ -149,13 +310,15 @@ func (c *Context) GetAccount(address common.Address) *AccountInfo {
 }
 
 func (c *Context) SetAccount(address common.Address, acc *AccountInfo) {
+	c.mustNotBeClosed()
 	k := GetAccountKey(address)
 	c.Rbt.Set(k, acc.Bytes())
 }
 
 func (c *Context) GetCode(contract common.Address) *BytecodeInfo {
+	c.mustNotBeClosed()
 	k := GetBytecodeKey(contract)
-	v := c.Rbt.Get(k)
+	v := c.getOrFetch(k)
 	if v != nil {
 		return NewBytecodeInfo(v)
 	}
@@ -163,26 +326,31 @@ func (c *Context) GetCode(contract common.Address) *BytecodeInfo {
 }
 
 func (c *Context) GetStorageAt(seq uint64, key string) []byte {
+	c.mustNotBeClosed()
 	k := GetValueKey(seq, key)
-	return c.Rbt.Get(k)
+	return c.getOrFetch(k)
 }
 
 func (c *Context) GetValueAtMapKey(seq uint64, mapSlot string, mapKey string) []byte {
+	c.mustNotBeClosed()
 	key := crypto.Keccak256([]byte(mapKey), []byte(mapSlot))
 	return c.GetStorageAt(seq, string(key))
 }
 
 func (c *Context) SetValueAtMapKey(seq uint64, mapSlot string, mapKey string, val []byte) {
+	c.mustNotBeClosed()
 	key := crypto.Keccak256([]byte(mapKey), []byte(mapSlot))
 	c.SetStorageAt(seq, string(key), val)
 }
 
 func (c *Context) DeleteValueAtMapKey(seq uint64, mapSlot string, mapKey string) {
+	c.mustNotBeClosed()
 	key := crypto.Keccak256([]byte(mapKey), []byte(mapSlot))
 	c.DeleteStorageAt(seq, string(key))
 }
 
 func (c *Context) GetAndDeleteValueAtMapKey(seq uint64, mapSlot string, mapKey string) []byte {
+	c.mustNotBeClosed()
 	key := crypto.Keccak256([]byte(mapKey), []byte(mapSlot))
 	res := c.GetStorageAt(seq, string(key))
 	c.DeleteStorageAt(seq, string(key))
@@ -190,6 +358,7 @@ func (c *Context) GetAndDeleteValueAtMapKey(seq uint64, mapSlot string, mapKey s
 }
 
 func (c *Context) GetDynamicArray(seq uint64, arrSlot string) (res [][]byte) {
+	c.mustNotBeClosed()
 	arrLen := uint256.NewInt(0)
 	arrLenBz := c.GetStorageAt(seq, arrSlot)
 	if len(arrLenBz) == 32 {
@@ -208,6 +377,7 @@ func (c *Context) GetDynamicArray(seq uint64, arrSlot string) (res [][]byte) {
 }
 
 func (c *Context) CreateDynamicArray(seq uint64, arrSlot string, contents [][]byte) {
+	c.mustNotBeClosed()
 	arrLen := uint256.NewInt(uint64(len(contents)))
 	c.SetStorageAt(seq, arrSlot, arrLen.PaddedBytes(32))
 	startSlot := uint256.NewInt(0).SetBytes32(crypto.Keccak256([]byte(arrSlot)))
@@ -218,6 +388,7 @@ func (c *Context) CreateDynamicArray(seq uint64, arrSlot string, contents [][]by
 }
 
 func (c *Context) DeleteDynamicArray(seq uint64, arrSlot string) {
+	c.mustNotBeClosed()
 	arrLen := uint256.NewInt(0)
 	arrLenBz := c.GetStorageAt(seq, arrSlot)
 	if len(arrLenBz) == 32 {
@@ -236,16 +407,19 @@ func (c *Context) DeleteDynamicArray(seq uint64, arrSlot string) {
 }
 
 func (c *Context) SetStorageAt(seq uint64, key string, val []byte) {
+	c.mustNotBeClosed()
 	k := GetValueKey(seq, key)
 	c.Rbt.Set(k, val)
 }
 
 func (c *Context) DeleteStorageAt(seq uint64, key string) {
+	c.mustNotBeClosed()
 	k := GetValueKey(seq, key)
 	c.Rbt.Delete(k)
 }
 
 func (c *Context) GetCurrBlockBasicInfo() *Block {
+	c.mustNotBeClosed()
 	blk := &Block{}
 	data := c.Rbt.Get([]byte{CURR_BLOCK_KEY})
 	if len(data) == 0 {
@@ -256,18 +430,22 @@ func (c *Context) GetCurrBlockBasicInfo() *Block {
 }
 
 func (c *Context) SetCurrBlockBasicInfo(blk *Block) {
+	c.mustNotBeClosed()
 	c.Rbt.Set([]byte{CURR_BLOCK_KEY}, blk.SerializeBasicInfo())
 }
 
 func (c *Context) StoreBlock(blk *modbtypes.Block, txid2sigMap map[[32]byte][65]byte) {
+	c.mustNotBeClosed()
 	c.Db.AddBlock(blk, -1, txid2sigMap)
 }
 
 func (c *Context) GetLatestHeight() int64 {
+	c.mustNotBeClosed()
 	return c.Db.GetLatestHeight()
 }
 
 func (c *Context) GetTxByBlkHtAndTxIndex(height uint64, index uint64) *Transaction {
+	c.mustNotBeClosed()
 	bz := c.Db.GetTxByHeightAndIndex(int64(height), int(index))
 	tx := &Transaction{}
 	_, err := tx.UnmarshalMsg(bz)
@@ -278,6 +456,7 @@ func (c *Context) GetTxByBlkHtAndTxIndex(height uint64, index uint64) *Transacti
 }
 
 func (c *Context) GetTxByHash(txHash common.Hash) (tx *Transaction, sig [65]byte, err error) {
+	c.mustNotBeClosed()
 	c.Db.GetTxByHash(txHash, func(b []byte) bool {
 		tmp := &Transaction{}
 		_, err := tmp.UnmarshalMsg(b[65:])
@@ -295,6 +474,7 @@ func (c *Context) GetTxByHash(txHash common.Hash) (tx *Transaction, sig [65]byte
 }
 
 func (c *Context) GetBlockHashByHeight(height uint64) [32]byte {
+	c.mustNotBeClosed()
 	var zero32 [32]byte
 	res := c.Db.GetBlockHashByHeight(int64(height))
 	if res == zero32 {
@@ -307,6 +487,7 @@ func (c *Context) GetBlockHashByHeight(height uint64) [32]byte {
 }
 
 func (c *Context) GetBlockByHeight(height uint64) (*Block, error) {
+	c.mustNotBeClosed()
 	bz := c.Db.GetBlockByHeight(int64(height))
 	if len(bz) == 0 {
 		return nil, ErrBlockNotFound
@@ -321,6 +502,7 @@ func (c *Context) GetBlockByHeight(height uint64) (*Block, error) {
 }
 
 func (c *Context) GetBlockByHash(hash common.Hash) (blk *Block, err error) {
+	c.mustNotBeClosed()
 	c.Db.GetBlockByHash(hash, func(bz []byte) bool {
 		tmp := &Block{}
 		_, err := tmp.UnmarshalMsg(bz)
@@ -337,6 +519,7 @@ func (c *Context) GetBlockByHash(hash common.Hash) (blk *Block, err error) {
 }
 
 func (c *Context) GetBalance(owner common.Address) (*uint256.Int, error) {
+	c.mustNotBeClosed()
 	if acc := c.GetAccount(owner); acc != nil {
 		return acc.Balance(), nil
 	}
@@ -344,6 +527,7 @@ func (c *Context) GetBalance(owner common.Address) (*uint256.Int, error) {
 }
 
 func (c *Context) CheckNonce(sender common.Address, nonce uint64) (*AccountInfo, error) {
+	c.mustNotBeClosed()
 	acc := c.GetAccount(sender)
 	if acc == nil {
 		return nil, ErrAccountNotExist
@@ -383,6 +567,7 @@ func isInTopicSlice(topic [32]byte, topics [][32]byte) bool {
 
 func (c *Context) BasicQueryLogs(address common.Address, topics []common.Hash,
 	startHeight, endHeight, limit uint32) (logs []Log, err error) {
+	c.mustNotBeClosed()
 
 	var rawAddress [20]byte = address
 	rawTopics := FromGethHashes(topics)
@@ -418,6 +603,7 @@ func (c *Context) BasicQueryLogs(address common.Address, topics []common.Hash,
 type FilterFunc func(addr common.Address, topics []common.Hash, addrList []common.Address, topicsList [][]common.Hash) (ok bool)
 
 func (c *Context) QueryLogs(addresses []common.Address, topics [][]common.Hash, startHeight, endHeight uint32, filter FilterFunc) (logs []Log, err error) {
+	c.mustNotBeClosed()
 	rawAddresses := FromGethAddreses(addresses)
 	rawTopics := make([][][32]byte, len(topics))
 	for i, t := range topics {
@@ -449,6 +635,7 @@ func (c *Context) QueryLogs(addresses []common.Address, topics [][]common.Hash,
 }
 
 func (c *Context) QueryTxBySrc(addr common.Address, startHeight, endHeight, limit uint32) (txs []*Transaction, sigs [][65]byte, err error) {
+	c.mustNotBeClosed()
 	err = c.Db.QueryTxBySrc(addr, startHeight, endHeight, func(data []byte) bool {
 		if data == nil {
 			err = ErrTooManyEntries
@@ -473,6 +660,7 @@ func (c *Context) QueryTxBySrc(addr common.Address, startHeight, endHeight, limi
 }
 
 func (c *Context) QueryTxByDst(addr common.Address, startHeight, endHeight, limit uint32) (txs []*Transaction, sigs [][65]byte, err error) {
+	c.mustNotBeClosed()
 	err = c.Db.QueryTxByDst(addr, startHeight, endHeight, func(data []byte) bool {
 		if data == nil {
 			err = ErrTooManyEntries
@@ -497,6 +685,7 @@ func (c *Context) QueryTxByDst(addr common.Address, startHeight, endHeight, limi
 }
 
 func (c *Context) QueryTxByAddr(addr common.Address, startHeight, endHeight, limit uint32) (txs []*Transaction, sigs [][65]byte, err error) {
+	c.mustNotBeClosed()
 	err = c.Db.QueryTxBySrcOrDst(addr, startHeight, endHeight, func(data []byte) bool {
 		if data == nil {
 			err = ErrTooManyEntries
@@ -521,10 +710,12 @@ func (c *Context) QueryTxByAddr(addr common.Address, startHeight, endHeight, lim
 }
 
 func (c *Context) GetTxListByHeight(height uint32) (txs []*Transaction, sigs [][65]byte, err error) {
+	c.mustNotBeClosed()
 	return c.GetTxListByHeightWithRange(height, 0, math.MaxInt32)
 }
 
 func (c *Context) GetTxListByHeightWithRange(height uint32, start, end int) (txs []*Transaction, sigs [][65]byte, err error) {
+	c.mustNotBeClosed()
 	txContents := c.Db.GetTxListByHeightWithRange(int64(height), start, end)
 	txs = make([]*Transaction, len(txContents))
 	sigs = make([][65]byte, len(txContents))
@@ -541,18 +732,21 @@ func (c *Context) GetTxListByHeightWithRange(height uint32, start, end int) (txs
 
 // return the times addr acts as the to-address of a transaction
 func (c *Context) GetToAddressCount(addr common.Address) int64 {
+	c.mustNotBeClosed()
 	k := append([]byte{modbtypes.TO_ADDR_KEY}, addr[:]...)
 	return c.Db.QueryNotificationCounter(k)
 }
 
 // return the times addr acts as the from-address of a transaction
 func (c *Context) GetFromAddressCount(addr common.Address) int64 {
+	c.mustNotBeClosed()
 	k := append([]byte{modbtypes.FROM_ADDR_KEY}, addr[:]...)
 	return c.Db.QueryNotificationCounter(k)
 }
 
 // return the times addr acts as the to-address of a SEP20 Transfer event at some contract
 func (c *Context) GetSep20ToAddressCount(contract common.Address, addr common.Address) int64 {
+	c.mustNotBeClosed()
 	var zero12 [12]byte
 	k := append([]byte{modbtypes.TRANS_TO_ADDR_KEY}, contract[:]...)
 	k = append(k, zero12[:]...)
@@ -562,6 +756,7 @@ func (c *Context) GetSep20ToAddressCount(contract common.Address, addr common.Ad
 
 // return the times addr acts as a from-address of a SEP20 Transfer event at some contract
 func (c *Context) GetSep20FromAddressCount(contract common.Address, addr common.Address) int64 {
+	c.mustNotBeClosed()
 	var zero12 [12]byte
 	k := append([]byte{modbtypes.TRANS_FROM_ADDR_KEY}, contract[:]...)
 	k = append(k, zero12[:]...)
@@ -0,0 +1,9 @@
+//go:build debug
+
+package types
+
+import "runtime/debug"
+
+func creationStack() []byte {
+	return debug.Stack()
+}
@@ -0,0 +1,8 @@
+//go:build !debug
+
+package types
+
+// Recording stacks is too expensive for the many Contexts created per block, so it is only done in debug builds
+func creationStack() []byte {
+	return nil
+}
@@ -0,0 +1,241 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/smartbch/moeingads/store"
+	"github.com/smartbch/moeingads/store/rabbit"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/errors"
+)
+
+func newTestContext() *Context {
+	rbt := rabbit.NewRabbitStore(store.NewMockRootStore())
+	return NewContext(&rbt, nil)
+}
+
+func TestContextCloseTwice(t *testing.T) {
+	ctx := newTestContext()
+	ctx.SetAccount(common.Address{1}, ZeroAccountInfo())
+	require.False(t, ctx.IsClosed())
+	ctx.Close(true)
+	require.True(t, ctx.IsClosed())
+	require.NotPanics(t, func() { ctx.Close(true) })
+}
+
+func TestContextUseAfterClose(t *testing.T) {
+	ctx := newTestContext()
+	ctx.Close(false)
+	require.Panics(t, func() { ctx.GetAccount(common.Address{1}) })
+	require.Panics(t, func() { ctx.SetAccount(common.Address{1}, ZeroAccountInfo()) })
+	require.Panics(t, func() { ctx.GetStorageAt(1, string(make([]byte, 32))) })
+	require.Panics(t, func() { ctx.DeleteStorageAt(1, string(make([]byte, 32))) })
+	require.Panics(t, func() { ctx.GetCode(common.Address{1}) })
+	require.Panics(t, func() { ctx.GetValueAtMapKey(1, "slot", "key") })
+	require.Panics(t, func() { ctx.GetDynamicArray(1, "slot") })
+	require.Panics(t, func() { ctx.GetBalance(common.Address{1}) })
+	require.Panics(t, func() { ctx.GetLatestHeight() })
+	require.Panics(t, func() { ctx.IsStakingFork() })
+	require.Panics(t, func() { ctx.SetCurrentHeight(1) })
+	// the copies of a closed Context are not made either
+	require.Panics(t, func() { ctx.WithRbtCopy() })
+	require.Panics(t, func() { ctx.WithCowRbtCopy(NewCowBaseStore(ctx.Rbt.GetBaseStore())) })
+	require.Panics(t, func() { ctx.WithOverlayRbtCopy(NewOverlayBaseStore(ctx.Rbt.GetBaseStore())) })
+	require.Panics(t, func() { ctx.WithRbt(ctx.Rbt) })
+	require.Panics(t, func() { ctx.WithDb(nil) })
+	require.Panics(t, func() { _ = ctx.RunScoped(func(*Context) error { return nil }) })
+}
+
+func TestContextReopen(t *testing.T) {
+	root := store.NewMockRootStore()
+	rbt := rabbit.NewRabbitStore(root)
+	ctx := NewContext(&rbt, nil)
+	ctx.SetCurrentHeight(10)
+	require.Panics(t, func() { ctx.Reopen() })
+	ctx.SetAccount(common.Address{1}, ZeroAccountInfo())
+	ctx.Close(true)
+	reopened := ctx.Reopen()
+	require.False(t, reopened.IsClosed())
+	require.Equal(t, int64(10), reopened.Height)
+	require.NotNil(t, reopened.GetAccount(common.Address{1}))
+	reopened.Close(false)
+}
+
+func TestCowRbtCopy(t *testing.T) {
+	root := store.NewMockRootStore()
+	rbt := rabbit.NewRabbitStore(root)
+	ctx := NewContext(&rbt, nil)
+	acc := ZeroAccountInfo()
+	acc.UpdateNonce(1)
+	ctx.SetAccount(common.Address{1}, acc)
+	ctx.Close(true)
+
+	rbt = rabbit.NewRabbitStore(root)
+	ctx = NewContext(&rbt, nil)
+	cow := NewCowBaseStore(root)
+	ctx1 := ctx.WithCowRbtCopy(cow)
+	ctx2 := ctx.WithCowRbtCopy(cow)
+	require.Equal(t, uint64(1), ctx1.GetAccount(common.Address{1}).Nonce())
+	acc = ctx2.GetAccount(common.Address{1})
+	acc.UpdateNonce(2)
+	ctx2.SetAccount(common.Address{1}, acc)
+	require.Equal(t, uint64(1), ctx1.GetAccount(common.Address{1}).Nonce())
+	require.Equal(t, uint64(2), ctx2.GetAccount(common.Address{1}).Nonce())
+	ctx1.Close(false)
+	ctx2.Close(true)
+
+	ctx3 := ctx.WithCowRbtCopy(cow)
+	require.Equal(t, uint64(1), ctx3.GetAccount(common.Address{1}).Nonce()) // not applied yet
+	ctx3.Close(false)
+	root.Update(cow.ApplyPendingUpdates)
+	ctx3 = ctx.WithCowRbtCopy(cow)
+	require.Equal(t, uint64(2), ctx3.GetAccount(common.Address{1}).Nonce())
+	ctx3.Close(false)
+	require.Panics(t, func() { ctx.WithCowRbtCopy(NewCowBaseStore(store.NewMockRootStore())) })
+	ctx.Close(false)
+}
+
+// heightRecorder records the height of the last GetAtHeight call
+type heightRecorder struct {
+	*store.MockRootStore
+	height uint64
+}
+
+func (hr *heightRecorder) GetAtHeight(key []byte, height uint64) []byte {
+	hr.height = height
+	return hr.Get(key)
+}
+
+func TestSnapshotHandle(t *testing.T) {
+	var h SnapshotHandle
+	require.Nil(t, h.Latest())
+	hr := &heightRecorder{MockRootStore: store.NewMockRootStore()}
+	template := newTestContext()
+	template.XHedgeForkBlock = 7
+	h.Publish(NewSnapshot(10, [32]byte{1}, hr, template))
+	h.Publish(NewSnapshot(11, [32]byte{2}, hr, template))
+	s := h.Latest()
+	require.Equal(t, int64(11), s.Height)
+	require.Equal(t, [32]byte{2}, s.Root)
+	ctx := s.NewContext()
+	require.Equal(t, int64(11), ctx.Height)
+	require.Equal(t, int64(7), ctx.XHedgeForkBlock)
+	require.Nil(t, ctx.GetAccount(common.Address{1}))
+	require.Equal(t, uint64(11), hr.height)
+	ctx.Close(false)
+	template.Close(false)
+}
+
+func TestOverlayRbtCopy(t *testing.T) {
+	root := store.NewMockRootStore()
+	rbt := rabbit.NewRabbitStore(root)
+	ctx := NewContext(&rbt, nil)
+	acc := ZeroAccountInfo()
+	acc.UpdateNonce(1)
+	ctx.SetAccount(common.Address{1}, acc)
+	ctx.SetAccount(common.Address{2}, acc)
+	ctx.Close(true)
+
+	rbt = rabbit.NewRabbitStore(root)
+	ctx = NewContext(&rbt, nil)
+	overlay := NewOverlayBaseStore(root)
+	ctx1 := ctx.WithOverlayRbtCopy(overlay)
+	acc = ctx1.GetAccount(common.Address{1})
+	acc.UpdateNonce(2)
+	ctx1.SetAccount(common.Address{1}, acc)
+	ctx1.Rbt.Delete(GetAccountKey(common.Address{2}))
+	ctx1.Close(true)
+
+	ctx2 := ctx.WithOverlayRbtCopy(overlay)
+	require.Equal(t, uint64(2), ctx2.GetAccount(common.Address{1}).Nonce())
+	require.Nil(t, ctx2.GetAccount(common.Address{2}))
+	ctx2.Close(false)
+
+	// the parent is not changed
+	require.Equal(t, uint64(1), ctx.GetAccount(common.Address{1}).Nonce())
+	require.Equal(t, uint64(1), ctx.GetAccount(common.Address{2}).Nonce())
+	require.Panics(t, func() { ctx.WithOverlayRbtCopy(NewOverlayBaseStore(store.NewMockRootStore())) })
+	ctx.Close(false)
+}
+
+func TestRunScoped(t *testing.T) {
+	root := store.NewMockRootStore()
+	rbt := rabbit.NewRabbitStore(root)
+	ctx := NewContext(&rbt, nil)
+	nonceOf := func(addr common.Address) uint64 {
+		if acc := ctx.GetAccount(addr); acc != nil {
+			return acc.Nonce()
+		}
+		return 0
+	}
+	setNonce := func(c *Context, addr common.Address, nonce uint64) {
+		acc := ZeroAccountInfo()
+		acc.UpdateNonce(nonce)
+		c.SetAccount(addr, acc)
+	}
+	reopen := func() {
+		ctx.Close(false)
+		rbt := rabbit.NewRabbitStore(root)
+		ctx = NewContext(&rbt, nil)
+	}
+	errHook := errors.New("hook failed")
+
+	require.NoError(t, ctx.RunScoped(func(sub *Context) error {
+		setNonce(sub, common.Address{1}, 1)
+		return nil
+	}))
+	require.Equal(t, uint64(1), nonceOf(common.Address{1}))
+	reopen()
+
+	require.Equal(t, errHook, ctx.RunScoped(func(sub *Context) error {
+		setNonce(sub, common.Address{1}, 2)
+		return errHook
+	}))
+	require.Equal(t, uint64(1), nonceOf(common.Address{1}))
+	reopen()
+
+	require.Panics(t, func() {
+		_ = ctx.RunScoped(func(sub *Context) error {
+			setNonce(sub, common.Address{1}, 3)
+			panic("hook panicked")
+		})
+	})
+	require.Equal(t, uint64(1), nonceOf(common.Address{1}))
+	reopen()
+
+	// the failed inner scope is discarded, while the outer one commits
+	require.NoError(t, ctx.RunScoped(func(sub *Context) error {
+		setNonce(sub, common.Address{1}, 4)
+		require.Equal(t, errHook, sub.RunScoped(func(inner *Context) error {
+			require.Equal(t, uint64(4), inner.GetAccount(common.Address{1}).Nonce())
+			setNonce(inner, common.Address{2}, 4)
+			return errHook
+		}))
+		require.NoError(t, sub.RunScoped(func(inner *Context) error {
+			setNonce(inner, common.Address{3}, 4)
+			return nil
+		}))
+		require.Equal(t, uint64(4), sub.GetAccount(common.Address{3}).Nonce())
+		return nil
+	}))
+	require.Equal(t, uint64(4), nonceOf(common.Address{1}))
+	require.Zero(t, nonceOf(common.Address{2}))
+	require.Equal(t, uint64(4), nonceOf(common.Address{3}))
+	reopen()
+
+	// the committed inner scope is discarded with the failed outer one
+	require.Equal(t, errHook, ctx.RunScoped(func(sub *Context) error {
+		require.NoError(t, sub.RunScoped(func(inner *Context) error {
+			setNonce(inner, common.Address{2}, 5)
+			return nil
+		}))
+		return errHook
+	}))
+	require.Zero(t, nonceOf(common.Address{2}))
+
+	ctx.SetAccount(common.Address{4}, ZeroAccountInfo())
+	require.Panics(t, func() { _ = ctx.RunScoped(func(sub *Context) error { return nil }) })
+	ctx.Close(false)
+}
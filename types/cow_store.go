@@ -0,0 +1,132 @@
+package types
+
+import (
+	"sync"
+
+	storetypes "github.com/smartbch/moeingads/store/types"
+)
+
+var _ storetypes.BaseStoreI = (*CowBaseStore)(nil)
+
+// CowBaseStore sits between a parent store and the many RabbitStores copied from one Context in a round.
+// The copies share the values read from the parent through it, while each copy's own cache only
+// diverges for the entries it writes. The parent must not be updated by others while a CowBaseStore
+// is in use.
+// The updates (write-backs of the copies) made through it are batched, and they are applied to the
+// parent in order by ApplyPendingUpdates, which is called in the parent's Update. Before that, the
+// reads still get the parent's values.
+type CowBaseStore struct {
+	parent  storetypes.BaseStoreI
+	cache   sync.Map // string(key) => []byte, nil means the key does not exist in parent
+	mtx     sync.Mutex
+	pending []func(db storetypes.SetDeleter)
+}
+
+func NewCowBaseStore(parent storetypes.BaseStoreI) *CowBaseStore {
+	return &CowBaseStore{parent: parent}
+}
+
+func (cow *CowBaseStore) Parent() storetypes.BaseStoreI {
+	return cow.parent
+}
+
+func (cow *CowBaseStore) RLock() {
+	cow.parent.RLock()
+}
+
+func (cow *CowBaseStore) RUnlock() {
+	cow.parent.RUnlock()
+}
+
+func (cow *CowBaseStore) Get(key []byte) []byte {
+	v, ok := cow.cache.Load(string(key))
+	if !ok {
+		v, _ = cow.cache.LoadOrStore(string(key), cow.parent.Get(key))
+	}
+	bz := v.([]byte)
+	if bz == nil {
+		return nil
+	}
+	return append([]byte{}, bz...) // RabbitStore keeps the returned slice, so it must not be shared
+}
+
+func (cow *CowBaseStore) GetAtHeight(key []byte, height uint64) []byte {
+	return cow.parent.GetAtHeight(key, height)
+}
+
+func (cow *CowBaseStore) PrepareForUpdate(key []byte) {
+	cow.parent.PrepareForUpdate(key)
+}
+
+func (cow *CowBaseStore) PrepareForDeletion(key []byte) {
+	cow.parent.PrepareForDeletion(key)
+}
+
+func (cow *CowBaseStore) Update(updater func(db storetypes.SetDeleter)) {
+	cow.mtx.Lock()
+	cow.pending = append(cow.pending, updater)
+	cow.mtx.Unlock()
+}
+
+// Run the pending updaters in the order of Update on db, which is provided by the parent's Update
+func (cow *CowBaseStore) ApplyPendingUpdates(db storetypes.SetDeleter) {
+	cow.mtx.Lock()
+	pending := cow.pending
+	cow.pending = nil
+	cow.mtx.Unlock()
+	sd := &cowSetDeleter{db: db, cow: cow}
+	for _, updater := range pending {
+		updater(sd)
+	}
+}
+
+// Like ApplyPendingUpdates, but observe is called with each updated key and its values before and after the
+// update. A nil value means the key does not exist.
+func (cow *CowBaseStore) ApplyPendingUpdatesAndObserve(db storetypes.SetDeleter, observe func(key, before, after []byte)) {
+	cow.mtx.Lock()
+	pending := cow.pending
+	cow.pending = nil
+	cow.mtx.Unlock()
+	sd := &cowSetDeleter{db: db, cow: cow, observe: observe}
+	for _, updater := range pending {
+		updater(sd)
+	}
+}
+
+func (cow *CowBaseStore) ActiveCount() int {
+	return cow.parent.ActiveCount()
+}
+
+// cowSetDeleter drops the shared values which are overwritten in parent
+type cowSetDeleter struct {
+	db      storetypes.SetDeleter
+	cow     *CowBaseStore
+	observe func(key, before, after []byte) // nil if the updates are not observed
+}
+
+func (sd *cowSetDeleter) Set(key, value []byte) {
+	sd.observeUpdate(key, value)
+	sd.cow.cache.Delete(string(key))
+	sd.db.Set(key, value)
+}
+
+func (sd *cowSetDeleter) Delete(key []byte) {
+	sd.observeUpdate(key, nil)
+	sd.cow.cache.Delete(string(key))
+	sd.db.Delete(key)
+}
+
+// A RabbitStore reads a key through cow before writing it, so the value before the update is in cache. Two
+// copies writing the same key do not commit in the same round, so it is not overwritten by another copy.
+func (sd *cowSetDeleter) observeUpdate(key, after []byte) {
+	if sd.observe == nil {
+		return
+	}
+	var before []byte
+	if v, ok := sd.cow.cache.Load(string(key)); ok {
+		before = v.([]byte)
+	} else {
+		before = sd.cow.parent.Get(key)
+	}
+	sd.observe(key, before, after)
+}
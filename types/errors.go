@@ -1,6 +1,6 @@
 package types
 
-import "errors"
+import "github.com/smartbch/moeingevm/errors"
 
 var (
 	ErrAccNotFound         = errors.New("account not found")
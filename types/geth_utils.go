@@ -1,8 +1,12 @@
 package types
 
 import (
+	"math/big"
+
 	gethcmn "github.com/ethereum/go-ethereum/common"
 	gethtypes "github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/smartbch/moeingevm/utils"
 )
 
 func ToGethLogs(logs []Log) []*gethtypes.Log {
@@ -50,3 +54,66 @@ func FromGethAddreses(gethAddresses []gethcmn.Address) [][20]byte {
 	}
 	return rawAddresses
 }
+
+func FromGethLogs(gethLogs []*gethtypes.Log) []Log {
+	logs := make([]Log, len(gethLogs))
+	for i, gethLog := range gethLogs {
+		logs[i] = FromGethLog(gethLog)
+	}
+	return logs
+}
+
+func FromGethLog(gethLog *gethtypes.Log) Log {
+	return Log{
+		Address:     gethLog.Address,
+		Topics:      FromGethHashes(gethLog.Topics),
+		Data:        gethLog.Data,
+		BlockNumber: gethLog.BlockNumber,
+		TxHash:      gethLog.TxHash,
+		TxIndex:     gethLog.TxIndex,
+		BlockHash:   gethLog.BlockHash,
+		Index:       gethLog.Index,
+		Removed:     gethLog.Removed,
+	}
+}
+
+// ToGethTx returns an unsigned geth tx of the same type, so it is lossy:
+//   - the signature is empty, so its Hash() differs from tx.Hash and its sender cannot be recovered
+//   - the access list of an EIP-2930/EIP-1559 tx is not recorded, so it is empty
+//   - the fee caps of an EIP-1559 tx are not recorded, so both GasFeeCap and GasTipCap are GasPrice
+func (tx *Transaction) ToGethTx(chainID *big.Int) *gethtypes.Transaction {
+	var to *gethcmn.Address
+	if !tx.IsCreation() {
+		addr := gethcmn.Address(tx.To)
+		to = &addr
+	}
+	value := new(big.Int).SetBytes(tx.Value[:])
+	gasPrice := new(big.Int).SetBytes(tx.GasPrice[:])
+	switch tx.Type {
+	case gethtypes.AccessListTxType:
+		return gethtypes.NewTx(&gethtypes.AccessListTx{ChainID: chainID, Nonce: tx.Nonce, GasPrice: gasPrice,
+			Gas: tx.Gas, To: to, Value: value, Data: tx.Input})
+	case gethtypes.DynamicFeeTxType:
+		return gethtypes.NewTx(&gethtypes.DynamicFeeTx{ChainID: chainID, Nonce: tx.Nonce, GasTipCap: gasPrice,
+			GasFeeCap: gasPrice, Gas: tx.Gas, To: to, Value: value, Data: tx.Input})
+	}
+	return gethtypes.NewTx(&gethtypes.LegacyTx{Nonce: tx.Nonce, GasPrice: gasPrice, Gas: tx.Gas, To: to,
+		Value: value, Data: tx.Input})
+}
+
+// FromGethTx fills the fields of tx which are known before execution. The sender must be recovered by the
+// caller with a signer. The fee caps and the access list are dropped, because Transaction has no such fields.
+func (tx *Transaction) FromGethTx(gethTx *gethtypes.Transaction, sender gethcmn.Address) {
+	tx.Hash = gethTx.Hash()
+	tx.Type = gethTx.Type()
+	tx.Nonce = gethTx.Nonce()
+	tx.From = sender
+	tx.To = [20]byte{}
+	if to := gethTx.To(); to != nil {
+		tx.To = *to
+	}
+	tx.Gas = gethTx.Gas()
+	tx.Input = gethTx.Data()
+	copy(tx.Value[:], utils.BigIntToSlice32(gethTx.Value()))
+	copy(tx.GasPrice[:], utils.BigIntToSlice32(gethTx.GasPrice()))
+}
@@ -0,0 +1,51 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGethLogs(t *testing.T) {
+	logs := []Log{{Address: [20]byte{1}, Topics: [][32]byte{{2}, {3}}, Data: []byte{4}, BlockNumber: 5,
+		TxHash: [32]byte{6}, TxIndex: 7, BlockHash: [32]byte{8}, Index: 9, Removed: true}}
+	require.Equal(t, logs, FromGethLogs(ToGethLogs(logs)))
+}
+
+func TestGethTx(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	chainID := big.NewInt(10000)
+	to := gethcmn.Address{1}
+	signer := gethtypes.NewLondonSigner(chainID)
+	for _, inner := range []gethtypes.TxData{
+		&gethtypes.LegacyTx{Nonce: 1, GasPrice: big.NewInt(2), Gas: 3, To: &to, Value: big.NewInt(4), Data: []byte{5}},
+		&gethtypes.AccessListTx{ChainID: chainID, Nonce: 1, GasPrice: big.NewInt(2), Gas: 3, Value: big.NewInt(4)},
+		&gethtypes.DynamicFeeTx{ChainID: chainID, Nonce: 1, GasTipCap: big.NewInt(2), GasFeeCap: big.NewInt(2),
+			Gas: 3, To: &to, Value: big.NewInt(4)},
+	} {
+		gethTx, err := gethtypes.SignNewTx(key, signer, inner)
+		require.NoError(t, err)
+		var tx Transaction
+		tx.FromGethTx(gethTx, sender)
+		require.Equal(t, [32]byte(gethTx.Hash()), tx.Hash)
+		require.Equal(t, gethTx.Type(), tx.Type)
+		require.Equal(t, gethTx.To() == nil, tx.IsCreation())
+		require.Equal(t, uint64(4), new(big.Int).SetBytes(tx.Value[:]).Uint64())
+
+		// the converted tx is unsigned, so its hash differs
+		res := tx.ToGethTx(chainID)
+		require.Equal(t, gethTx.Type(), res.Type())
+		require.Equal(t, gethTx.Nonce(), res.Nonce())
+		require.Equal(t, gethTx.GasPrice(), res.GasPrice())
+		require.Equal(t, gethTx.Gas(), res.Gas())
+		require.Equal(t, gethTx.To(), res.To())
+		require.Equal(t, gethTx.Value(), res.Value())
+		require.Equal(t, gethTx.Data(), res.Data())
+		require.NotEqual(t, gethTx.Hash(), res.Hash())
+	}
+}
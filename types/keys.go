@@ -2,10 +2,14 @@ package types
 
 import (
 	"encoding/binary"
+	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
 	coretypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/golang/snappy"
 
+	"github.com/smartbch/moeingevm/errors"
 	"github.com/smartbch/moeingevm/utils"
 )
 
@@ -23,8 +27,19 @@ const ACCOUNT_KEY byte = 23
 const BYTECODE_KEY byte = 25
 const VALUE_KEY byte = 27
 const CURR_BLOCK_KEY byte = 29
+const ARCHIVED_ACCOUNT_KEY byte = 31
+const VERIFICATION_KEY byte = 35
+const BCH_HEADER_KEY byte = 37
+const BCH_HEADER_TIP_KEY byte = 39
+const BCH_CHAIN_WORK_KEY byte = 41
+const RANDOM_BEACON_KEY byte = 43
+const RANDOM_BEACON_LATEST_KEY byte = 45
+const BCH_HEADER_BY_HASH_KEY byte = 47
 
 var StandbyTxQueueKey [8]byte = [8]byte{255, 255, 255, 255, 255, 255, 255, 0}
+var BaseFeeKey [8]byte = [8]byte{255, 255, 255, 255, 255, 255, 255, 1}
+var MinGasPriceKey [8]byte = [8]byte{255, 255, 255, 255, 255, 255, 255, 2}
+var ScheduledTxQueueKey [8]byte = [8]byte{255, 255, 255, 255, 255, 255, 255, 3}
 
 const TOO_OLD_THRESHOLD uint64 = 10
 
@@ -33,6 +48,13 @@ const FAILED_TO_COMMIT int = 1025
 const ACCOUNT_NOT_EXIST int = 1026
 const TX_NONCE_TOO_SMALL int = 1027
 const TX_NONCE_TOO_LARGE int = 1029
+const ABORTED_BY_HINTS int = 1030
+const EXECUTION_PANIC int = 1031
+const TX_TOO_LARGE int = 1032
+const STORAGE_QUOTA_EXCEEDED int = 1033
+const EVICTED_FROM_QUEUE int = 1034
+const EXPIRED_IN_QUEUE int = 1035
+const SENDER_QUEUE_FULL int = 1036
 
 func GetCreationCounterKey(lsb uint8) []byte {
 	bz := make([]byte, 2)
@@ -47,6 +69,13 @@ func GetAccountKey(addr common.Address) []byte {
 	return append(bz, addr[:]...)
 }
 
+// The key of the hash of an archived account, which is needed to resurrect it
+func GetArchivedAccountKey(addr common.Address) []byte {
+	bz := make([]byte, 1, 1+len(addr))
+	bz[0] = ARCHIVED_ACCOUNT_KEY
+	return append(bz, addr[:]...)
+}
+
 func GetBytecodeKey(addr common.Address) []byte {
 	bz := make([]byte, 1, 1+len(addr))
 	bz[0] = BYTECODE_KEY
@@ -63,6 +92,51 @@ func GetValueKey(seq uint64, key string) []byte {
 	return append(bz, []byte(key)...)
 }
 
+// The key of the verification record of a contract
+func GetVerificationKey(addr common.Address) []byte {
+	bz := make([]byte, 1, 1+len(addr))
+	bz[0] = VERIFICATION_KEY
+	return append(bz, addr[:]...)
+}
+
+// The key of the header of the BCH mainchain block at height
+func GetBchHeaderKey(height uint64) []byte {
+	bz := make([]byte, 9)
+	bz[0] = BCH_HEADER_KEY
+	binary.BigEndian.PutUint64(bz[1:], height)
+	return bz
+}
+
+// The key of the total work of the BCH mainchain until the block at height
+func GetBchChainWorkKey(height uint64) []byte {
+	bz := make([]byte, 9)
+	bz[0] = BCH_CHAIN_WORK_KEY
+	binary.BigEndian.PutUint64(bz[1:], height)
+	return bz
+}
+
+// The key of the height of the latest BCH mainchain header stored
+var BchHeaderTipKey = []byte{BCH_HEADER_TIP_KEY}
+
+// The key of the BCH header with hash, which is on the mainchain or a side branch, along with its height
+// and the total work until it
+func GetBchHeaderByHashKey(hash [32]byte) []byte {
+	bz := make([]byte, 1, 1+len(hash))
+	bz[0] = BCH_HEADER_BY_HASH_KEY
+	return append(bz, hash[:]...)
+}
+
+// The key of the random beacon of the block at height
+func GetRandomBeaconKey(height uint64) []byte {
+	bz := make([]byte, 9)
+	bz[0] = RANDOM_BEACON_KEY
+	binary.BigEndian.PutUint64(bz[1:], height)
+	return bz
+}
+
+// The key of the height of the latest random beacon
+var RandomBeaconLatestKey = []byte{RANDOM_BEACON_LATEST_KEY}
+
 func GetStandbyTxKey(num uint64) []byte {
 	var buf [8]byte
 	num += uint64(128+64) << 56 // raise it to the non-rabbit range
@@ -70,6 +144,38 @@ func GetStandbyTxKey(num uint64) []byte {
 	return buf[:]
 }
 
+// The key of the tx at num in the scheduled queue, after the range of standby queue
+func GetScheduledTxKey(num uint64) []byte {
+	var buf [8]byte
+	num += uint64(128+64+32) << 56
+	binary.BigEndian.PutUint64(buf[:], num)
+	return buf[:]
+}
+
+// The key of the positions in the scheduled queue of the TXs scheduled at height
+func GetScheduledHeightKey(height uint64) []byte {
+	var buf [8]byte
+	height += uint64(128+64+16) << 56
+	binary.BigEndian.PutUint64(buf[:], height)
+	return buf[:]
+}
+
+// The key of the number of storage slots counted for the contract with sequence seq, which is written to
+// trunk directly
+func GetStorageCountKey(seq uint64) []byte {
+	bz := make([]byte, 9)
+	bz[0] = 128 + 64 + 4 // in the non-rabbit range, between standby queue and the tx hashes
+	binary.BigEndian.PutUint64(bz[1:], seq)
+	return bz
+}
+
+// The key of the position of the tx with hash in the standby queue or the scheduled queue
+func GetQueuedTxHashKey(hash common.Hash) []byte {
+	bz := make([]byte, 1, 1+len(hash))
+	bz[0] = 128 + 64 + 8 // in the non-rabbit range, between standby queue and the scheduled heights
+	return append(bz, hash[:]...)
+}
+
 type EvmLog struct {
 	Address common.Address
 	Topics  []common.Hash
@@ -84,6 +190,9 @@ type BlockInfo struct {
 	GasLimit   int64
 	Difficulty [32]byte
 	ChainId    [32]byte
+	BaseFee    [32]byte // filled by the engine, zero if the base fee is not used
+	// The randomness provided by the consensus, zero if there is none
+	RandomBeacon [32]byte
 }
 
 type BasicTx struct {
@@ -100,27 +209,133 @@ type TxToRun struct {
 	BasicTx
 	HashID common.Hash
 	Height uint64
+	// A scheduled tx is executed no earlier than the block of this height, zero means it is not scheduled
+	NotBefore uint64
+	// The maxFeePerGas and maxPriorityFeePerGas of a dynamic fee tx, and the base fee it pays, which is
+	// decided when it is prepared. GasPrice is its effective gas price, min(GasFeeCap, BaseFee+GasTipCap).
+	GasFeeCap [32]byte
+	GasTipCap [32]byte
+	BaseFee   [32]byte
+	// The access list declared by an EIP-2930 or EIP-1559 tx
+	AccessList coretypes.AccessList
+	// The EIP-2718 type of the tx, which is zero for a legacy tx and the entries queued before the envelope,
+	// except the dynamic fee ones, whose type is recovered from TxToRunFormatDynamicFee
+	Type uint8
+	// The fields in the envelope which are unknown to this version, such that they are kept when the tx
+	// is written back into the standby queue
+	UnknownFields []byte
+}
+
+// A dynamic fee tx is told by its type instead of its GasFeeCap, which may be zero
+func (tx *TxToRun) IsDynamicFee() bool {
+	return tx.Type == coretypes.DynamicFeeTxType
+}
+
+// The intrinsic gas of the access list, as in EIP-2930
+func (tx *TxToRun) AccessListGas() uint64 {
+	return uint64(len(tx.AccessList))*params.TxAccessListAddressGas +
+		uint64(tx.AccessList.StorageKeys())*params.TxAccessListStorageKeyGas
 }
 
+// The format of TxToRun's bytes is stored in the most significant byte of Height, which is always
+// zero for a real height. So the bytes in the old format are decoded as TxToRunFormatRaw.
+// The format is a set of the following bits, which is closed: the layout of the bytes with an unknown bit
+// cannot be known, so FromBytes panics on it. No more bits are added, new fields go into the envelope.
+const (
+	TxToRunFormatRaw        byte = 0
+	TxToRunFormatSnappy     byte = 1  // Data is compressed with snappy
+	TxToRunFormatScheduled  byte = 2  // NotBefore is stored before Nonce
+	TxToRunFormatDynamicFee byte = 4  // GasFeeCap, GasTipCap and BaseFee are stored after Data
+	TxToRunFormatAccessList byte = 8  // AccessList and its length (4 bytes) are stored after Data
+	TxToRunFormatEnvelope   byte = 16 // the envelope and its length (4 bytes) are stored right after Data
+
+	txToRunFormatAll = TxToRunFormatSnappy | TxToRunFormatScheduled | TxToRunFormatDynamicFee |
+		TxToRunFormatAccessList | TxToRunFormatEnvelope
+)
+
+// The envelope is a list of fields, each of which is a tag (1 byte), the length of its value (4 bytes) and
+// the value. New fields are added to the envelope instead of new format bits, so the entries written by a
+// newer version can still be decoded, with the unknown fields kept in UnknownFields. Only the envelope
+// fields are forward-compatible.
+const (
+	EnvelopeFieldType byte = 1 // the EIP-2718 type, 1 byte
+)
+
 func (tx TxToRun) ToBytes() []byte {
-	res := make([]byte, 0, 32+20+20+8+32+32+8+len(tx.Data)+8)
+	return tx.toBytes(TxToRunFormatRaw, tx.Data)
+}
+
+// Same as ToBytes, but Data is compressed
+func (tx TxToRun) ToCompressedBytes() []byte {
+	return tx.toBytes(TxToRunFormatSnappy, snappy.Encode(nil, tx.Data))
+}
+
+func (tx TxToRun) toBytes(format byte, data []byte) []byte {
+	if tx.NotBefore != 0 {
+		format |= TxToRunFormatScheduled
+	}
+	if tx.IsDynamicFee() {
+		format |= TxToRunFormatDynamicFee
+	}
+	if len(tx.AccessList) != 0 {
+		format |= TxToRunFormatAccessList
+	}
+	hasEnvelope := tx.Type != 0 || len(tx.UnknownFields) != 0
+	if hasEnvelope {
+		format |= TxToRunFormatEnvelope
+	}
+	res := make([]byte, 0, 32+20+20+8+32+32+8+len(data)+96+16)
 	res = append(res, tx.HashID[:]...)
 	res = append(res, tx.From[:]...)
 	res = append(res, tx.To[:]...)
 	var buf [8]byte
 	binary.BigEndian.PutUint64(buf[:], tx.Height)
+	buf[0] = format
 	res = append(res, buf[:]...)
 	res = append(res, tx.Value[:]...)
 	res = append(res, tx.GasPrice[:]...)
 	binary.BigEndian.PutUint64(buf[:], tx.Gas)
 	res = append(res, buf[:]...)
-	res = append(res, tx.Data...)
+	res = append(res, data...)
+	if hasEnvelope {
+		start := len(res)
+		if tx.Type != 0 {
+			res = appendEnvelopeField(res, EnvelopeFieldType, []byte{tx.Type})
+		}
+		res = append(res, tx.UnknownFields...)
+		binary.BigEndian.PutUint32(buf[:4], uint32(len(res)-start))
+		res = append(res, buf[:4]...)
+	}
+	if len(tx.AccessList) != 0 {
+		start := len(res)
+		for _, tuple := range tx.AccessList {
+			res = append(res, tuple.Address[:]...)
+			binary.BigEndian.PutUint32(buf[:4], uint32(len(tuple.StorageKeys)))
+			res = append(res, buf[:4]...)
+			for _, key := range tuple.StorageKeys {
+				res = append(res, key[:]...)
+			}
+		}
+		binary.BigEndian.PutUint32(buf[:4], uint32(len(res)-start))
+		res = append(res, buf[:4]...)
+	}
+	if tx.IsDynamicFee() {
+		res = append(res, tx.GasFeeCap[:]...)
+		res = append(res, tx.GasTipCap[:]...)
+		res = append(res, tx.BaseFee[:]...)
+	}
+	if tx.NotBefore != 0 {
+		binary.BigEndian.PutUint64(buf[:], tx.NotBefore)
+		res = append(res, buf[:]...)
+	}
 	var nonceBuf [8]byte
 	binary.BigEndian.PutUint64(nonceBuf[:], tx.Nonce)
 	res = append(res, nonceBuf[:]...)
 	return res
 }
 
+// Decode the bytes written by ToBytes or ToCompressedBytes. It panics with ErrQueueCorrupted if they are
+// corrupted or have a format bit unknown to this version.
 func (tx *TxToRun) FromBytes(bz []byte) {
 	copy(tx.HashID[:], bz)
 	bz = bz[32:]
@@ -128,7 +343,8 @@ func (tx *TxToRun) FromBytes(bz []byte) {
 	bz = bz[20:]
 	copy(tx.To[:], bz)
 	bz = bz[20:]
-	tx.Height = binary.BigEndian.Uint64(bz[:8])
+	format := bz[0]
+	tx.Height = binary.BigEndian.Uint64(bz[:8]) & (1<<56 - 1)
 	bz = bz[8:]
 	copy(tx.Value[:], bz)
 	bz = bz[32:]
@@ -136,11 +352,96 @@ func (tx *TxToRun) FromBytes(bz []byte) {
 	bz = bz[32:]
 	tx.Gas = binary.BigEndian.Uint64(bz[:8])
 	bz = bz[8:]
-	tx.Data = append([]byte{}, bz[:len(bz)-8]...)
+	if format&^txToRunFormatAll != 0 {
+		panic(fmt.Errorf("%w: unknown format %d", errors.ErrQueueCorrupted, format))
+	}
+	dataEnd := len(bz) - 8
+	tx.NotBefore = 0
+	if format&TxToRunFormatScheduled != 0 {
+		tx.NotBefore = binary.BigEndian.Uint64(bz[dataEnd-8 : dataEnd])
+		dataEnd -= 8
+	}
+	tx.GasFeeCap, tx.GasTipCap, tx.BaseFee = [32]byte{}, [32]byte{}, [32]byte{}
+	if format&TxToRunFormatDynamicFee != 0 {
+		copy(tx.GasFeeCap[:], bz[dataEnd-96:dataEnd-64])
+		copy(tx.GasTipCap[:], bz[dataEnd-64:dataEnd-32])
+		copy(tx.BaseFee[:], bz[dataEnd-32:dataEnd])
+		dataEnd -= 96
+	}
+	tx.AccessList = nil
+	if format&TxToRunFormatAccessList != 0 {
+		size := int(binary.BigEndian.Uint32(bz[dataEnd-4 : dataEnd]))
+		dataEnd -= 4 + size
+		tx.AccessList = decodeAccessList(bz[dataEnd : dataEnd+size])
+	}
+	tx.Type, tx.UnknownFields = 0, nil
+	if format&TxToRunFormatEnvelope != 0 {
+		size := int(binary.BigEndian.Uint32(bz[dataEnd-4 : dataEnd]))
+		dataEnd -= 4 + size
+		tx.decodeEnvelope(bz[dataEnd : dataEnd+size])
+	}
+	if format&TxToRunFormatDynamicFee != 0 && tx.Type == 0 { // queued before the envelope
+		tx.Type = coretypes.DynamicFeeTxType
+	}
+	if format&TxToRunFormatSnappy != 0 {
+		var err error
+		tx.Data, err = snappy.Decode(nil, bz[:dataEnd])
+		if err != nil {
+			panic(fmt.Errorf("%w: %s", errors.ErrQueueCorrupted, err))
+		}
+	} else {
+		tx.Data = append([]byte{}, bz[:dataEnd]...)
+	}
 	bz = bz[len(bz)-8:]
 	tx.Nonce = binary.BigEndian.Uint64(bz[:])
 }
 
+func decodeAccessList(bz []byte) coretypes.AccessList {
+	var list coretypes.AccessList
+	for len(bz) != 0 {
+		if len(bz) < 24 {
+			panic(fmt.Errorf("%w: truncated access list", errors.ErrQueueCorrupted))
+		}
+		tuple := coretypes.AccessTuple{Address: common.BytesToAddress(bz[:20])}
+		n := int(binary.BigEndian.Uint32(bz[20:24]))
+		bz = bz[24:]
+		if len(bz) < 32*n {
+			panic(fmt.Errorf("%w: truncated access list", errors.ErrQueueCorrupted))
+		}
+		tuple.StorageKeys = make([]common.Hash, n)
+		for i := range tuple.StorageKeys {
+			copy(tuple.StorageKeys[i][:], bz[32*i:])
+		}
+		bz = bz[32*n:]
+		list = append(list, tuple)
+	}
+	return list
+}
+
+func appendEnvelopeField(bz []byte, tag byte, value []byte) []byte {
+	var buf [5]byte
+	buf[0] = tag
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(value)))
+	return append(append(bz, buf[:]...), value...)
+}
+
+func (tx *TxToRun) decodeEnvelope(bz []byte) {
+	for len(bz) != 0 {
+		if len(bz) < 5 || len(bz) < 5+int(binary.BigEndian.Uint32(bz[1:5])) {
+			panic(fmt.Errorf("%w: truncated envelope", errors.ErrQueueCorrupted))
+		}
+		tag, size := bz[0], int(binary.BigEndian.Uint32(bz[1:5]))
+		value := bz[5 : 5+size]
+		switch {
+		case tag == EnvelopeFieldType && size == 1:
+			tx.Type = value[0]
+		default:
+			tx.UnknownFields = append(tx.UnknownFields, bz[:5+size]...)
+		}
+		bz = bz[5+size:]
+	}
+}
+
 func (tx *TxToRun) FromGethTx(gethTx *coretypes.Transaction, sender common.Address, height uint64) {
 	tx.HashID = gethTx.Hash()
 	tx.From = sender
@@ -148,9 +449,17 @@ func (tx *TxToRun) FromGethTx(gethTx *coretypes.Transaction, sender common.Addre
 		tx.To = *to
 	}
 	tx.Height = height
+	tx.Type = gethTx.Type()
 	tx.Gas = gethTx.Gas()
 	tx.Data = gethTx.Data()
 	tx.Nonce = gethTx.Nonce()
 	copy(tx.Value[:], utils.BigIntToSlice32(gethTx.Value()))
 	copy(tx.GasPrice[:], utils.BigIntToSlice32(gethTx.GasPrice()))
+	if gethTx.Type() == coretypes.DynamicFeeTxType {
+		copy(tx.GasFeeCap[:], utils.BigIntToSlice32(gethTx.GasFeeCap()))
+		copy(tx.GasTipCap[:], utils.BigIntToSlice32(gethTx.GasTipCap()))
+	}
+	if list := gethTx.AccessList(); len(list) != 0 {
+		tx.AccessList = list
+	}
 }
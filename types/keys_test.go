@@ -0,0 +1,102 @@
+package types
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	coretypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxToRunFormats(t *testing.T) {
+	tx := TxToRun{
+		BasicTx: BasicTx{
+			From:  common.Address{1},
+			To:    common.Address{2},
+			Gas:   21000,
+			Data:  bytes.Repeat([]byte{7}, 4096),
+			Nonce: 3,
+		},
+		HashID: common.Hash{9},
+		Height: 100,
+	}
+	raw := tx.ToBytes()
+	compressed := tx.ToCompressedBytes()
+	require.Less(t, len(compressed), len(raw)/10)
+	for _, bz := range [][]byte{raw, compressed} {
+		var decoded TxToRun
+		decoded.FromBytes(bz)
+		require.Equal(t, tx, decoded)
+	}
+	scheduled := tx
+	scheduled.NotBefore = 200
+	for _, bz := range [][]byte{scheduled.ToBytes(), scheduled.ToCompressedBytes()} {
+		var decoded TxToRun
+		decoded.FromBytes(bz)
+		require.Equal(t, scheduled, decoded)
+	}
+	dynamic := scheduled
+	dynamic.Type = coretypes.DynamicFeeTxType
+	dynamic.GasFeeCap[31], dynamic.GasTipCap[31], dynamic.BaseFee[31] = 30, 2, 20
+	for _, bz := range [][]byte{dynamic.ToBytes(), dynamic.ToCompressedBytes()} {
+		var decoded TxToRun
+		decoded.FromBytes(bz)
+		require.Equal(t, dynamic, decoded)
+	}
+	withList := dynamic
+	withList.AccessList = coretypes.AccessList{
+		{Address: common.Address{3}, StorageKeys: []common.Hash{{4}, {5}}},
+		{Address: common.Address{6}, StorageKeys: []common.Hash{}},
+	}
+	require.Equal(t, uint64(2*2400+2*1900), withList.AccessListGas())
+	for _, bz := range [][]byte{withList.ToBytes(), withList.ToCompressedBytes()} {
+		var decoded TxToRun
+		decoded.FromBytes(bz)
+		require.Equal(t, withList, decoded)
+	}
+
+	typed := withList
+	typed.Type = coretypes.DynamicFeeTxType
+	for _, bz := range [][]byte{typed.ToBytes(), typed.ToCompressedBytes()} {
+		var decoded TxToRun
+		decoded.FromBytes(bz)
+		require.Equal(t, typed, decoded)
+	}
+	// a field added by a newer version is kept as it is
+	typed.UnknownFields = appendEnvelopeField(nil, 200, []byte{1, 2, 3})
+	var decoded TxToRun
+	decoded.FromBytes(typed.ToBytes())
+	require.Equal(t, typed, decoded)
+	require.Equal(t, typed.ToBytes(), decoded.ToBytes())
+	require.Panics(t, func() { new(TxToRun).decodeEnvelope(typed.UnknownFields[:6]) }) // truncated
+
+	compressed[32+20+20] = 100 // unknown format
+	require.Panics(t, func() { new(TxToRun).FromBytes(compressed) })
+}
+
+func TestTxToRunDynamicFee(t *testing.T) {
+	tx := TxToRun{HashID: common.Hash{9}, Height: 100}
+	tx.Data = []byte{1, 2}
+	require.False(t, tx.IsDynamicFee())
+	// a dynamic fee tx whose caps are zero is still a dynamic fee tx
+	tx.Type = coretypes.DynamicFeeTxType
+	require.True(t, tx.IsDynamicFee())
+	var decoded TxToRun
+	decoded.FromBytes(tx.ToBytes())
+	require.True(t, decoded.IsDynamicFee())
+	require.Equal(t, tx, decoded)
+
+	// a dynamic fee tx queued before the envelope gets its type from the format
+	old := TxToRun{HashID: common.Hash{9}, Height: 100}
+	bz := old.ToBytes()
+	bz[32+20+20] |= TxToRunFormatDynamicFee
+	caps := make([]byte, 96)
+	caps[31], caps[63], caps[95] = 30, 2, 20
+	bz = append(bz[:len(bz)-8:len(bz)-8], append(caps, bz[len(bz)-8:]...)...) // before Nonce
+	decoded = TxToRun{}
+	decoded.FromBytes(bz)
+	require.True(t, decoded.IsDynamicFee())
+	require.Equal(t, byte(30), decoded.GasFeeCap[31])
+	require.Equal(t, byte(20), decoded.BaseFee[31])
+}
@@ -0,0 +1,106 @@
+package types
+
+import (
+	"sort"
+	"sync"
+
+	storetypes "github.com/smartbch/moeingads/store/types"
+)
+
+var _ storetypes.BaseStoreI = (*OverlayBaseStore)(nil)
+
+// OverlayBaseStore keeps the updates made through it in memory, instead of writing them to the parent store.
+// The reads get the updated values first and then the parent's. It is used to run blocks speculatively, such
+// as the simulations which must not change the world state. The parent must not be updated while it is in use.
+type OverlayBaseStore struct {
+	parent storetypes.BaseStoreI
+	mtx    sync.RWMutex
+	dirty  map[string][]byte // nil means the key is deleted
+}
+
+func NewOverlayBaseStore(parent storetypes.BaseStoreI) *OverlayBaseStore {
+	return &OverlayBaseStore{parent: parent, dirty: make(map[string][]byte)}
+}
+
+func (o *OverlayBaseStore) RLock() {
+	o.parent.RLock()
+}
+
+func (o *OverlayBaseStore) RUnlock() {
+	o.parent.RUnlock()
+}
+
+func (o *OverlayBaseStore) Get(key []byte) []byte {
+	o.mtx.RLock()
+	v, ok := o.dirty[string(key)]
+	o.mtx.RUnlock()
+	if !ok {
+		return o.parent.Get(key)
+	}
+	if v == nil {
+		return nil
+	}
+	return append([]byte{}, v...)
+}
+
+// The history is not overlaid
+func (o *OverlayBaseStore) GetAtHeight(key []byte, height uint64) []byte {
+	return o.parent.GetAtHeight(key, height)
+}
+
+func (o *OverlayBaseStore) PrepareForUpdate(key []byte) {}
+
+func (o *OverlayBaseStore) PrepareForDeletion(key []byte) {}
+
+func (o *OverlayBaseStore) Update(updater func(db storetypes.SetDeleter)) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	updater(overlaySetDeleter{dirty: o.dirty})
+}
+
+// Writes the updates kept in memory to the parent in one Update, in the order of keys, and clears them
+func (o *OverlayBaseStore) WriteToParent() {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if len(o.dirty) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(o.dirty))
+	for k := range o.dirty {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys { // they were not prepared in the parent when they were written through o
+		if o.dirty[k] == nil {
+			o.parent.PrepareForDeletion([]byte(k))
+		} else {
+			o.parent.PrepareForUpdate([]byte(k))
+		}
+	}
+	o.parent.Update(func(db storetypes.SetDeleter) {
+		for _, k := range keys {
+			if v := o.dirty[k]; v == nil {
+				db.Delete([]byte(k))
+			} else {
+				db.Set([]byte(k), v)
+			}
+		}
+	})
+	o.dirty = make(map[string][]byte)
+}
+
+func (o *OverlayBaseStore) ActiveCount() int {
+	return o.parent.ActiveCount()
+}
+
+type overlaySetDeleter struct {
+	dirty map[string][]byte
+}
+
+func (sd overlaySetDeleter) Set(key, value []byte) {
+	sd.dirty[string(key)] = append([]byte{}, value...)
+}
+
+func (sd overlaySetDeleter) Delete(key []byte) {
+	sd.dirty[string(key)] = nil
+}
@@ -0,0 +1,116 @@
+package types
+
+import (
+	"math/big"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Returns the gas price paid per gas, which is GasPrice for the records written before EffectiveGasPrice
+// was added
+func (tx *Transaction) GetEffectiveGasPrice() *big.Int {
+	if tx.EffectiveGasPrice == [32]byte{} {
+		return new(big.Int).SetBytes(tx.GasPrice[:])
+	}
+	return new(big.Int).SetBytes(tx.EffectiveGasPrice[:])
+}
+
+func (tx *Transaction) IsCreation() bool {
+	return tx.To == [20]byte{}
+}
+
+// Returns nil if tx is not a contract creation. As in geth, the address is derived from the sender and the
+// nonce even if the creation failed.
+func (tx *Transaction) CreatedContract() *gethcmn.Address {
+	if !tx.IsCreation() {
+		return nil
+	}
+	addr := gethcmn.Address(tx.ContractAddress)
+	if addr == (gethcmn.Address{}) {
+		addr = crypto.CreateAddress(tx.From, tx.Nonce)
+	}
+	return &addr
+}
+
+func (tx *Transaction) ToGethReceipt() *gethtypes.Receipt {
+	receipt := &gethtypes.Receipt{
+		Type:              tx.Type,
+		Status:            tx.Status,
+		CumulativeGasUsed: tx.CumulativeGasUsed,
+		Bloom:             gethtypes.BytesToBloom(tx.LogsBloom[:]),
+		Logs:              ToGethLogs(tx.Logs),
+		TxHash:            tx.Hash,
+		GasUsed:           tx.GasUsed,
+		BlockHash:         tx.BlockHash,
+		BlockNumber:       big.NewInt(tx.BlockNumber),
+		TransactionIndex:  uint(tx.TransactionIndex),
+	}
+	if addr := tx.CreatedContract(); addr != nil {
+		receipt.ContractAddress = *addr
+	}
+	return receipt
+}
+
+// ToGethReceipts converts the receipts of the TXs in a block, such that gethtypes.DeriveSha can build
+// their Merkle trie. The conversion is lossy: StatusStr, OutData, EffectiveGasPrice, the internal calls
+// and the read/write lists have no counterparts in geth's receipts.
+func ToGethReceipts(txs []*Transaction) gethtypes.Receipts {
+	receipts := make(gethtypes.Receipts, len(txs))
+	for i, tx := range txs {
+		receipts[i] = tx.ToGethReceipt()
+	}
+	return receipts
+}
+
+// FromGethReceipt fills the receipt fields of tx, which is the reverse of ToGethReceipt. The fields of the
+// tx itself, such as From and Input, are filled by FromGethTx. PostState is dropped, because the receipts
+// here always have the status (EIP-658), and so is the contract address of a failed creation.
+func (tx *Transaction) FromGethReceipt(receipt *gethtypes.Receipt) {
+	tx.Type = receipt.Type
+	tx.Status = receipt.Status
+	tx.CumulativeGasUsed = receipt.CumulativeGasUsed
+	tx.GasUsed = receipt.GasUsed
+	copy(tx.LogsBloom[:], receipt.Bloom[:])
+	tx.Logs = FromGethLogs(receipt.Logs)
+	tx.Hash = receipt.TxHash
+	tx.BlockHash = receipt.BlockHash
+	if receipt.BlockNumber != nil {
+		tx.BlockNumber = receipt.BlockNumber.Int64()
+	}
+	tx.TransactionIndex = int64(receipt.TransactionIndex)
+	tx.ContractAddress = [20]byte{}
+	if receipt.Status == gethtypes.ReceiptStatusSuccessful {
+		tx.ContractAddress = receipt.ContractAddress
+	}
+}
+
+// ReceiptFields returns the fields of eth_getTransactionReceipt, which are encoded into JSON in the same way as
+// geth: the quantities are hex strings, "to" is null for a contract creation, and "contractAddress" is null
+// otherwise. There is no "root" because the receipts always have the status (EIP-658).
+func (tx *Transaction) ReceiptFields() map[string]interface{} {
+	var to *gethcmn.Address
+	if !tx.IsCreation() {
+		addr := gethcmn.Address(tx.To)
+		to = &addr
+	}
+	logs := ToGethLogs(tx.Logs)
+	return map[string]interface{}{
+		"blockHash":         gethcmn.Hash(tx.BlockHash),
+		"blockNumber":       hexutil.Uint64(tx.BlockNumber),
+		"transactionHash":   gethcmn.Hash(tx.Hash),
+		"transactionIndex":  hexutil.Uint64(tx.TransactionIndex),
+		"from":              gethcmn.Address(tx.From),
+		"to":                to,
+		"gasUsed":           hexutil.Uint64(tx.GasUsed),
+		"cumulativeGasUsed": hexutil.Uint64(tx.CumulativeGasUsed),
+		"effectiveGasPrice": (*hexutil.Big)(tx.GetEffectiveGasPrice()),
+		"contractAddress":   tx.CreatedContract(),
+		"logs":              logs,
+		"logsBloom":         gethtypes.BytesToBloom(tx.LogsBloom[:]),
+		"type":              hexutil.Uint(tx.Type),
+		"status":            hexutil.Uint(tx.Status),
+	}
+}
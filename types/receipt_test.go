@@ -0,0 +1,96 @@
+package types
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiptFields(t *testing.T) {
+	tx := &Transaction{
+		Hash:              [32]byte{1},
+		TransactionIndex:  2,
+		Nonce:             5,
+		BlockHash:         [32]byte{3},
+		BlockNumber:       10,
+		From:              [20]byte{4},
+		To:                [20]byte{5},
+		CumulativeGasUsed: 50000,
+		GasUsed:           21000,
+		Logs:              []Log{{Address: [20]byte{5}, Topics: [][32]byte{{6}}, TxIndex: 2, Index: 7}},
+		Status:            gethtypes.ReceiptStatusSuccessful,
+		Type:              gethtypes.DynamicFeeTxType,
+	}
+	copy(tx.GasPrice[:], big.NewInt(20).FillBytes(make([]byte, 32)))
+	bloom := gethtypes.CreateBloom(gethtypes.Receipts{{Logs: ToGethLogs(tx.Logs)}})
+	copy(tx.LogsBloom[:], bloom[:])
+
+	// the records written before EffectiveGasPrice was added use GasPrice
+	require.Equal(t, big.NewInt(20), tx.GetEffectiveGasPrice())
+	tx.EffectiveGasPrice[31] = 15
+	require.Equal(t, big.NewInt(15), tx.GetEffectiveGasPrice())
+
+	receipt := tx.ToGethReceipt()
+	require.Equal(t, uint8(2), receipt.Type)
+	require.Equal(t, bloom, receipt.Bloom)
+	require.Equal(t, gethcmn.Address{}, receipt.ContractAddress)
+	require.Equal(t, uint(2), receipt.TransactionIndex)
+	require.Equal(t, uint(7), receipt.Logs[0].Index)
+
+	bz, err := json.Marshal(tx.ReceiptFields())
+	require.NoError(t, err)
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(bz, &fields))
+	require.Equal(t, "0x2", fields["type"])
+	require.Equal(t, "0xf", fields["effectiveGasPrice"])
+	require.Equal(t, "0xa", fields["blockNumber"])
+	require.Equal(t, "0x1", fields["status"])
+	require.Nil(t, fields["contractAddress"])
+	require.Equal(t, "0x0500000000000000000000000000000000000000", fields["to"])
+	require.Equal(t, "0x"+gethcmn.Bytes2Hex(bloom[:]), fields["logsBloom"])
+	require.Equal(t, "0x7", fields["logs"].([]interface{})[0].(map[string]interface{})["logIndex"])
+	require.NotContains(t, fields, "root")
+
+	// a failed creation still has the contract address, and "to" is null
+	tx.To = [20]byte{}
+	tx.Status = gethtypes.ReceiptStatusFailed
+	created := crypto.CreateAddress(tx.From, tx.Nonce)
+	require.Equal(t, created, tx.ToGethReceipt().ContractAddress)
+	bz, _ = json.Marshal(tx.ReceiptFields())
+	require.NoError(t, json.Unmarshal(bz, &fields))
+	require.Nil(t, fields["to"])
+	require.Equal(t, "0x0", fields["status"])
+	require.Equal(t, created.Hex(), gethcmn.HexToAddress(fields["contractAddress"].(string)).Hex())
+	tx.ContractAddress = [20]byte{9}
+	require.Equal(t, gethcmn.Address{9}, *tx.CreatedContract())
+}
+
+func TestFromGethReceipt(t *testing.T) {
+	tx := &Transaction{
+		Hash:              [32]byte{1},
+		TransactionIndex:  2,
+		BlockHash:         [32]byte{3},
+		BlockNumber:       10,
+		To:                [20]byte{5},
+		CumulativeGasUsed: 50000,
+		GasUsed:           21000,
+		Logs:              []Log{{Address: [20]byte{5}, Topics: [][32]byte{{6}}, Data: []byte{1}, TxIndex: 2, Index: 7}},
+		Status:            gethtypes.ReceiptStatusSuccessful,
+		Type:              gethtypes.AccessListTxType,
+		StatusStr:         "success",
+	}
+	tx.LogsBloom[0] = 1
+	res := Transaction{To: tx.To} // To is filled by FromGethTx
+	res.FromGethReceipt(tx.ToGethReceipt())
+	tx.StatusStr = "" // not in geth's receipts
+	require.Equal(t, *tx, res)
+
+	receipts := ToGethReceipts([]*Transaction{tx, tx})
+	require.Equal(t, 2, receipts.Len())
+	require.Equal(t, tx.ToGethReceipt(), receipts[1])
+}
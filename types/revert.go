@@ -0,0 +1,43 @@
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var panicSelector = crypto.Keccak256([]byte("Panic(uint256)"))[:4]
+
+// the panic codes of the checks generated by Solidity
+var panicReasons = map[uint64]string{
+	0x00: "generic panic",
+	0x01: "assert(false)",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "enum overflow",
+	0x22: "invalid encoded storage byte array accessed",
+	0x31: "out-of-bounds array access; popping on an empty array",
+	0x32: "out-of-bounds access of an array or bytesN",
+	0x41: "out of memory",
+	0x51: "uninitialized function",
+}
+
+// UnpackRevertReason decodes the revert data of Error(string) and Panic(uint256), which are raised by
+// require, revert and assert of Solidity. It returns false for the other data, such as the custom errors.
+func UnpackRevertReason(data []byte) (string, bool) {
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return reason, true
+	}
+	if len(data) != 4+32 || !bytes.Equal(data[:4], panicSelector) {
+		return "", false
+	}
+	code := new(big.Int).SetBytes(data[4:])
+	reason, ok := panicReasons[code.Uint64()]
+	if !ok || !code.IsUint64() {
+		reason = "unknown panic code"
+	}
+	return fmt.Sprintf("panic: %s (0x%x)", reason, code), true
+}
@@ -0,0 +1,36 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnpackRevertReason(t *testing.T) {
+	// require(false, "not owner")
+	data := hexutil.MustDecode("0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000009" +
+		"6e6f74206f776e65720000000000000000000000000000000000000000000000")
+	reason, ok := UnpackRevertReason(data)
+	require.True(t, ok)
+	require.Equal(t, "not owner", reason)
+
+	data = append(hexutil.MustDecode("0x4e487b71"), common.BigToHash(common.Big1).Bytes()...)
+	data[len(data)-1] = 0x11
+	reason, ok = UnpackRevertReason(data)
+	require.True(t, ok)
+	require.Equal(t, "panic: arithmetic underflow or overflow (0x11)", reason)
+	data[len(data)-1] = 0x99
+	reason, _ = UnpackRevertReason(data)
+	require.Equal(t, "panic: unknown panic code (0x99)", reason)
+
+	_, ok = UnpackRevertReason(hexutil.MustDecode("0x12345678")) // a custom error
+	require.False(t, ok)
+	_, ok = UnpackRevertReason(nil)
+	require.False(t, ok)
+	_, ok = UnpackRevertReason(data[:20])
+	require.False(t, ok)
+}
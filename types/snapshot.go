@@ -0,0 +1,68 @@
+package types
+
+import (
+	"sync/atomic"
+
+	"github.com/smartbch/moeingads/store/rabbit"
+	storetypes "github.com/smartbch/moeingads/store/types"
+	modbtypes "github.com/smartbch/moeingdb/types"
+)
+
+// Snapshot is the state after a finalized block. The Contexts it creates read the state at Height, so
+// they never observe a block which is partially committed, even when the commit happens concurrently.
+type Snapshot struct {
+	Height int64
+	Root   [32]byte
+
+	store               storetypes.BaseStoreI
+	db                  modbtypes.DB
+	xHedgeForkBlock     int64
+	symbolSbchForkBlock int64
+	stakingForkBlock    int64
+	shaGateForkBlock    int64
+	chainConfig         *ChainConfig
+}
+
+// store must support GetAtHeight, such as a RootStore. The Db, fork heights and ChainConfig are taken from template.
+func NewSnapshot(height int64, root [32]byte, store storetypes.BaseStoreI, template *Context) *Snapshot {
+	return &Snapshot{
+		Height:              height,
+		Root:                root,
+		store:               store,
+		db:                  template.Db,
+		xHedgeForkBlock:     template.XHedgeForkBlock,
+		symbolSbchForkBlock: template.SymbolSbchForkBlock,
+		stakingForkBlock:    template.StakingForkBlock,
+		shaGateForkBlock:    template.ShaGateForkBlock,
+		chainConfig:         template.ChainConfig,
+	}
+}
+
+// Returns a read-only Context, which must be closed with Close(false)
+func (s *Snapshot) NewContext() *Context {
+	rbt := rabbit.NewReadOnlyRabbitStoreAtHeight(s.store, uint64(s.Height))
+	ctx := NewContext(&rbt, s.db)
+	ctx.Height = s.Height
+	ctx.XHedgeForkBlock = s.xHedgeForkBlock
+	ctx.SymbolSbchForkBlock = s.symbolSbchForkBlock
+	ctx.StakingForkBlock = s.stakingForkBlock
+	ctx.ShaGateForkBlock = s.shaGateForkBlock
+	ctx.ChainConfig = s.chainConfig
+	return ctx
+}
+
+// SnapshotHandle publishes the Snapshot of the last finalized block to the RPC layer. The committer
+// calls Publish after each commit, and the readers switch to the new Snapshot atomically.
+type SnapshotHandle struct {
+	v atomic.Value
+}
+
+func (h *SnapshotHandle) Publish(s *Snapshot) {
+	h.v.Store(s)
+}
+
+// Returns nil if nothing is published
+func (h *SnapshotHandle) Latest() *Snapshot {
+	s, _ := h.v.Load().(*Snapshot)
+	return s
+}
@@ -161,6 +161,12 @@ type Transaction struct {
 	StatusStr         string    `msg:"statusstr"`    //tx execute result explained
 	OutData           []byte    `msg:"outdata"`      //the output data from the transaction
 	//PostState  []byte  //look at Receipt.PostState
+	Type              uint8     `msg:"type"`         //the EIP-2718 type of the transaction, zero in the records written before it was added.
+	EffectiveGasPrice [32]byte  `msg:"egasprice"`    //the gas price paid per gas, zero in the records written before it was added.
+	InputHash         [32]byte  `msg:"inputhash"`    //the keccak256 hash of Input, if it is truncated in this record, otherwise zero.
+	OutDataHash       [32]byte  `msg:"outhash"`      //the keccak256 hash of OutData, if it is truncated in this record, otherwise zero.
+	RevertReason      string    `msg:"revertreason"` //the reason decoded from OutData, which is the revert data, if the transaction is reverted with Error(string) or Panic(uint256).
+	OutDataTruncated  bool      `msg:"outtrunc"`     //OutData is truncated to the max size allowed by the consensus.
 
 	InternalTxCalls   []InternalTxCall   `msg:"itxcalls"`
 	InternalTxReturns []InternalTxReturn `msg:"itxreturns"`
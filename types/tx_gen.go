@@ -3032,6 +3032,42 @@ func (z *Transaction) DecodeMsg(dc *msgp.Reader) (err error) {
 				err = msgp.WrapError(err, "OutData")
 				return
 			}
+		case "type":
+			z.Type, err = dc.ReadUint8()
+			if err != nil {
+				err = msgp.WrapError(err, "Type")
+				return
+			}
+		case "egasprice":
+			err = dc.ReadExactBytes((z.EffectiveGasPrice)[:])
+			if err != nil {
+				err = msgp.WrapError(err, "EffectiveGasPrice")
+				return
+			}
+		case "inputhash":
+			err = dc.ReadExactBytes((z.InputHash)[:])
+			if err != nil {
+				err = msgp.WrapError(err, "InputHash")
+				return
+			}
+		case "outhash":
+			err = dc.ReadExactBytes((z.OutDataHash)[:])
+			if err != nil {
+				err = msgp.WrapError(err, "OutDataHash")
+				return
+			}
+		case "revertreason":
+			z.RevertReason, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "RevertReason")
+				return
+			}
+		case "outtrunc":
+			z.OutDataTruncated, err = dc.ReadBool()
+			if err != nil {
+				err = msgp.WrapError(err, "OutDataTruncated")
+				return
+			}
 		case "itxcalls":
 			var zb0003 uint32
 			zb0003, err = dc.ReadArrayHeader()
@@ -3044,10 +3080,10 @@ func (z *Transaction) DecodeMsg(dc *msgp.Reader) (err error) {
 			} else {
 				z.InternalTxCalls = make([]InternalTxCall, zb0003)
 			}
-			for za0010 := range z.InternalTxCalls {
-				err = z.InternalTxCalls[za0010].DecodeMsg(dc)
+			for za0013 := range z.InternalTxCalls {
+				err = z.InternalTxCalls[za0013].DecodeMsg(dc)
 				if err != nil {
-					err = msgp.WrapError(err, "InternalTxCalls", za0010)
+					err = msgp.WrapError(err, "InternalTxCalls", za0013)
 					return
 				}
 			}
@@ -3063,10 +3099,10 @@ func (z *Transaction) DecodeMsg(dc *msgp.Reader) (err error) {
 			} else {
 				z.InternalTxReturns = make([]InternalTxReturn, zb0004)
 			}
-			for za0011 := range z.InternalTxReturns {
-				err = z.InternalTxReturns[za0011].DecodeMsg(dc)
+			for za0014 := range z.InternalTxReturns {
+				err = z.InternalTxReturns[za0014].DecodeMsg(dc)
 				if err != nil {
-					err = msgp.WrapError(err, "InternalTxReturns", za0011)
+					err = msgp.WrapError(err, "InternalTxReturns", za0014)
 					return
 				}
 			}
@@ -3101,9 +3137,9 @@ func (z *Transaction) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *Transaction) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 22
+	// map header, size 28
 	// write "hash"
-	err = en.Append(0xde, 0x0, 0x16, 0xa4, 0x68, 0x61, 0x73, 0x68)
+	err = en.Append(0xde, 0x0, 0x1c, 0xa4, 0x68, 0x61, 0x73, 0x68)
 	if err != nil {
 		return
 	}
@@ -3299,6 +3335,66 @@ func (z *Transaction) EncodeMsg(en *msgp.Writer) (err error) {
 		err = msgp.WrapError(err, "OutData")
 		return
 	}
+	// write "type"
+	err = en.Append(0xa4, 0x74, 0x79, 0x70, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteUint8(z.Type)
+	if err != nil {
+		err = msgp.WrapError(err, "Type")
+		return
+	}
+	// write "egasprice"
+	err = en.Append(0xa9, 0x65, 0x67, 0x61, 0x73, 0x70, 0x72, 0x69, 0x63, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes((z.EffectiveGasPrice)[:])
+	if err != nil {
+		err = msgp.WrapError(err, "EffectiveGasPrice")
+		return
+	}
+	// write "inputhash"
+	err = en.Append(0xa9, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x68, 0x61, 0x73, 0x68)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes((z.InputHash)[:])
+	if err != nil {
+		err = msgp.WrapError(err, "InputHash")
+		return
+	}
+	// write "outhash"
+	err = en.Append(0xa7, 0x6f, 0x75, 0x74, 0x68, 0x61, 0x73, 0x68)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes((z.OutDataHash)[:])
+	if err != nil {
+		err = msgp.WrapError(err, "OutDataHash")
+		return
+	}
+	// write "revertreason"
+	err = en.Append(0xac, 0x72, 0x65, 0x76, 0x65, 0x72, 0x74, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.RevertReason)
+	if err != nil {
+		err = msgp.WrapError(err, "RevertReason")
+		return
+	}
+	// write "outtrunc"
+	err = en.Append(0xa8, 0x6f, 0x75, 0x74, 0x74, 0x72, 0x75, 0x6e, 0x63)
+	if err != nil {
+		return
+	}
+	err = en.WriteBool(z.OutDataTruncated)
+	if err != nil {
+		err = msgp.WrapError(err, "OutDataTruncated")
+		return
+	}
 	// write "itxcalls"
 	err = en.Append(0xa8, 0x69, 0x74, 0x78, 0x63, 0x61, 0x6c, 0x6c, 0x73)
 	if err != nil {
@@ -3309,10 +3405,10 @@ func (z *Transaction) EncodeMsg(en *msgp.Writer) (err error) {
 		err = msgp.WrapError(err, "InternalTxCalls")
 		return
 	}
-	for za0010 := range z.InternalTxCalls {
-		err = z.InternalTxCalls[za0010].EncodeMsg(en)
+	for za0013 := range z.InternalTxCalls {
+		err = z.InternalTxCalls[za0013].EncodeMsg(en)
 		if err != nil {
-			err = msgp.WrapError(err, "InternalTxCalls", za0010)
+			err = msgp.WrapError(err, "InternalTxCalls", za0013)
 			return
 		}
 	}
@@ -3326,10 +3422,10 @@ func (z *Transaction) EncodeMsg(en *msgp.Writer) (err error) {
 		err = msgp.WrapError(err, "InternalTxReturns")
 		return
 	}
-	for za0011 := range z.InternalTxReturns {
-		err = z.InternalTxReturns[za0011].EncodeMsg(en)
+	for za0014 := range z.InternalTxReturns {
+		err = z.InternalTxReturns[za0014].EncodeMsg(en)
 		if err != nil {
-			err = msgp.WrapError(err, "InternalTxReturns", za0011)
+			err = msgp.WrapError(err, "InternalTxReturns", za0014)
 			return
 		}
 	}
@@ -3356,9 +3452,9 @@ func (z *Transaction) EncodeMsg(en *msgp.Writer) (err error) {
 // MarshalMsg implements msgp.Marshaler
 func (z *Transaction) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 22
+	// map header, size 28
 	// string "hash"
-	o = append(o, 0xde, 0x0, 0x16, 0xa4, 0x68, 0x61, 0x73, 0x68)
+	o = append(o, 0xde, 0x0, 0x1c, 0xa4, 0x68, 0x61, 0x73, 0x68)
 	o = msgp.AppendBytes(o, (z.Hash)[:])
 	// string "index"
 	o = append(o, 0xa5, 0x69, 0x6e, 0x64, 0x65, 0x78)
@@ -3421,23 +3517,41 @@ func (z *Transaction) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "outdata"
 	o = append(o, 0xa7, 0x6f, 0x75, 0x74, 0x64, 0x61, 0x74, 0x61)
 	o = msgp.AppendBytes(o, z.OutData)
+	// string "type"
+	o = append(o, 0xa4, 0x74, 0x79, 0x70, 0x65)
+	o = msgp.AppendUint8(o, z.Type)
+	// string "egasprice"
+	o = append(o, 0xa9, 0x65, 0x67, 0x61, 0x73, 0x70, 0x72, 0x69, 0x63, 0x65)
+	o = msgp.AppendBytes(o, (z.EffectiveGasPrice)[:])
+	// string "inputhash"
+	o = append(o, 0xa9, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x68, 0x61, 0x73, 0x68)
+	o = msgp.AppendBytes(o, (z.InputHash)[:])
+	// string "outhash"
+	o = append(o, 0xa7, 0x6f, 0x75, 0x74, 0x68, 0x61, 0x73, 0x68)
+	o = msgp.AppendBytes(o, (z.OutDataHash)[:])
+	// string "revertreason"
+	o = append(o, 0xac, 0x72, 0x65, 0x76, 0x65, 0x72, 0x74, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e)
+	o = msgp.AppendString(o, z.RevertReason)
+	// string "outtrunc"
+	o = append(o, 0xa8, 0x6f, 0x75, 0x74, 0x74, 0x72, 0x75, 0x6e, 0x63)
+	o = msgp.AppendBool(o, z.OutDataTruncated)
 	// string "itxcalls"
 	o = append(o, 0xa8, 0x69, 0x74, 0x78, 0x63, 0x61, 0x6c, 0x6c, 0x73)
 	o = msgp.AppendArrayHeader(o, uint32(len(z.InternalTxCalls)))
-	for za0010 := range z.InternalTxCalls {
-		o, err = z.InternalTxCalls[za0010].MarshalMsg(o)
+	for za0013 := range z.InternalTxCalls {
+		o, err = z.InternalTxCalls[za0013].MarshalMsg(o)
 		if err != nil {
-			err = msgp.WrapError(err, "InternalTxCalls", za0010)
+			err = msgp.WrapError(err, "InternalTxCalls", za0013)
 			return
 		}
 	}
 	// string "itxreturns"
 	o = append(o, 0xaa, 0x69, 0x74, 0x78, 0x72, 0x65, 0x74, 0x75, 0x72, 0x6e, 0x73)
 	o = msgp.AppendArrayHeader(o, uint32(len(z.InternalTxReturns)))
-	for za0011 := range z.InternalTxReturns {
-		o, err = z.InternalTxReturns[za0011].MarshalMsg(o)
+	for za0014 := range z.InternalTxReturns {
+		o, err = z.InternalTxReturns[za0014].MarshalMsg(o)
 		if err != nil {
-			err = msgp.WrapError(err, "InternalTxReturns", za0011)
+			err = msgp.WrapError(err, "InternalTxReturns", za0014)
 			return
 		}
 	}
@@ -3600,6 +3714,42 @@ func (z *Transaction) UnmarshalMsg(bts []byte) (o []byte, err error) {
 				err = msgp.WrapError(err, "OutData")
 				return
 			}
+		case "type":
+			z.Type, bts, err = msgp.ReadUint8Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Type")
+				return
+			}
+		case "egasprice":
+			bts, err = msgp.ReadExactBytes(bts, (z.EffectiveGasPrice)[:])
+			if err != nil {
+				err = msgp.WrapError(err, "EffectiveGasPrice")
+				return
+			}
+		case "inputhash":
+			bts, err = msgp.ReadExactBytes(bts, (z.InputHash)[:])
+			if err != nil {
+				err = msgp.WrapError(err, "InputHash")
+				return
+			}
+		case "outhash":
+			bts, err = msgp.ReadExactBytes(bts, (z.OutDataHash)[:])
+			if err != nil {
+				err = msgp.WrapError(err, "OutDataHash")
+				return
+			}
+		case "revertreason":
+			z.RevertReason, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "RevertReason")
+				return
+			}
+		case "outtrunc":
+			z.OutDataTruncated, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "OutDataTruncated")
+				return
+			}
 		case "itxcalls":
 			var zb0003 uint32
 			zb0003, bts, err = msgp.ReadArrayHeaderBytes(bts)
@@ -3612,10 +3762,10 @@ func (z *Transaction) UnmarshalMsg(bts []byte) (o []byte, err error) {
 			} else {
 				z.InternalTxCalls = make([]InternalTxCall, zb0003)
 			}
-			for za0010 := range z.InternalTxCalls {
-				bts, err = z.InternalTxCalls[za0010].UnmarshalMsg(bts)
+			for za0013 := range z.InternalTxCalls {
+				bts, err = z.InternalTxCalls[za0013].UnmarshalMsg(bts)
 				if err != nil {
-					err = msgp.WrapError(err, "InternalTxCalls", za0010)
+					err = msgp.WrapError(err, "InternalTxCalls", za0013)
 					return
 				}
 			}
@@ -3631,10 +3781,10 @@ func (z *Transaction) UnmarshalMsg(bts []byte) (o []byte, err error) {
 			} else {
 				z.InternalTxReturns = make([]InternalTxReturn, zb0004)
 			}
-			for za0011 := range z.InternalTxReturns {
-				bts, err = z.InternalTxReturns[za0011].UnmarshalMsg(bts)
+			for za0014 := range z.InternalTxReturns {
+				bts, err = z.InternalTxReturns[za0014].UnmarshalMsg(bts)
 				if err != nil {
-					err = msgp.WrapError(err, "InternalTxReturns", za0011)
+					err = msgp.WrapError(err, "InternalTxReturns", za0014)
 					return
 				}
 			}
@@ -3673,13 +3823,13 @@ func (z *Transaction) Msgsize() (s int) {
 	for za0008 := range z.Logs {
 		s += z.Logs[za0008].Msgsize()
 	}
-	s += 6 + msgp.ArrayHeaderSize + (256 * (msgp.ByteSize)) + 7 + msgp.Uint64Size + 10 + msgp.StringPrefixSize + len(z.StatusStr) + 8 + msgp.BytesPrefixSize + len(z.OutData) + 9 + msgp.ArrayHeaderSize
-	for za0010 := range z.InternalTxCalls {
-		s += z.InternalTxCalls[za0010].Msgsize()
+	s += 6 + msgp.ArrayHeaderSize + (256 * (msgp.ByteSize)) + 7 + msgp.Uint64Size + 10 + msgp.StringPrefixSize + len(z.StatusStr) + 8 + msgp.BytesPrefixSize + len(z.OutData) + 5 + msgp.Uint8Size + 10 + msgp.ArrayHeaderSize + (32 * (msgp.ByteSize)) + 10 + msgp.ArrayHeaderSize + (32 * (msgp.ByteSize)) + 8 + msgp.ArrayHeaderSize + (32 * (msgp.ByteSize)) + 13 + msgp.StringPrefixSize + len(z.RevertReason) + 9 + msgp.BoolSize + 9 + msgp.ArrayHeaderSize
+	for za0013 := range z.InternalTxCalls {
+		s += z.InternalTxCalls[za0013].Msgsize()
 	}
 	s += 11 + msgp.ArrayHeaderSize
-	for za0011 := range z.InternalTxReturns {
-		s += z.InternalTxReturns[za0011].Msgsize()
+	for za0014 := range z.InternalTxReturns {
+		s += z.InternalTxReturns[za0014].Msgsize()
 	}
 	s += 7
 	if z.RwLists == nil {